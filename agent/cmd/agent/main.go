@@ -17,15 +17,21 @@ import (
 func main() {
 	// Parse command line flags
 	var (
-		controlPlaneURL = flag.String("control-plane", "https://api.computehive.io", "Control plane URL")
-		token           = flag.String("token", "", "Authentication token")
-		workDir         = flag.String("work-dir", getDefaultWorkDir(), "Working directory for jobs")
-		maxJobs         = flag.Int("max-jobs", 5, "Maximum concurrent jobs")
-		enableGPU       = flag.Bool("enable-gpu", true, "Enable GPU support")
-		enableTrusted   = flag.Bool("enable-trusted", false, "Enable trusted execution (TEE)")
-		logLevel        = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
-		configFile      = flag.String("config", "", "Configuration file path")
-		version         = flag.Bool("version", false, "Show version information")
+		controlPlaneURL  = flag.String("control-plane", "https://api.computehive.io", "Control plane URL")
+		token            = flag.String("token", "", "Authentication token")
+		joinToken        = flag.String("join-token", "", "Join token used to enroll the agent on first start")
+		workDir          = flag.String("work-dir", getDefaultWorkDir(), "Working directory for jobs")
+		maxJobs          = flag.Int("max-jobs", 5, "Maximum concurrent jobs")
+		enableGPU        = flag.Bool("enable-gpu", true, "Enable GPU support")
+		enableTrusted    = flag.Bool("enable-trusted", false, "Enable trusted execution (TEE)")
+		enableExec       = flag.Bool("enable-exec", true, "Allow interactive exec sessions into running jobs")
+		logLevel         = flag.String("log-level", "info", "Log level (debug, info, warn, error)")
+		labels           = flag.String("labels", "", "Agent labels for fleet config profiles (key=value,...)")
+		resourceInterval = flag.Duration("resource-interval", 5*time.Second, "How often resource usage is sampled")
+		tunnelURL        = flag.String("tunnel-url", "", "Relay for exposed job ports (defaults to the control plane)")
+		forceRelay       = flag.Bool("force-relay", false, "Report relayed connectivity even with a public address")
+		configFile       = flag.String("config", "", "Configuration file path")
+		version          = flag.Bool("version", false, "Show version information")
 	)
 	
 	flag.Parse()
@@ -37,18 +43,29 @@ func main() {
 	
 	// Create configuration
 	config := &core.Config{
-		ControlPlaneURL:    *controlPlaneURL,
-		Token:              *token,
-		HeartbeatInterval:  30 * time.Second,
-		JobPollingInterval: 10 * time.Second,
-		MetricsInterval:    60 * time.Second,
-		MaxConcurrentJobs:  *maxJobs,
-		WorkDir:            *workDir,
-		EnableGPU:          *enableGPU,
-		EnableTrustedExec:  *enableTrusted,
-		LogLevel:           *logLevel,
+		ControlPlaneURL:        *controlPlaneURL,
+		Token:                  *token,
+		JoinToken:              *joinToken,
+		HeartbeatInterval:      30 * time.Second,
+		JobPollingInterval:     10 * time.Second,
+		MetricsInterval:        60 * time.Second,
+		MaxConcurrentJobs:      *maxJobs,
+		WorkDir:                *workDir,
+		EnableGPU:              *enableGPU,
+		EnableTrustedExec:      *enableTrusted,
+		EnableExec:             *enableExec,
+		LogLevel:               *logLevel,
+		ResourceSampleInterval: *resourceInterval,
+		TunnelURL:              *tunnelURL,
+		ForceRelay:             *forceRelay,
 	}
 	
+	agentLabels, err := core.ParseLabels(*labels)
+	if err != nil {
+		log.Fatalf("Invalid labels: %v", err)
+	}
+	config.Labels = agentLabels
+	
 	// Load config from file if specified
 	if *configFile != "" {
 		if err := loadConfigFromFile(*configFile, config); err != nil {
@@ -137,6 +154,10 @@ func loadConfigFromEnv(config *core.Config) {
 		config.Token = token
 	}
 	
+	if joinToken := os.Getenv("COMPUTEHIVE_JOIN_TOKEN"); joinToken != "" {
+		config.JoinToken = joinToken
+	}
+	
 	if workDir := os.Getenv("COMPUTEHIVE_WORK_DIR"); workDir != "" {
 		config.WorkDir = workDir
 	}
@@ -144,6 +165,16 @@ func loadConfigFromEnv(config *core.Config) {
 	if maxJobs := os.Getenv("COMPUTEHIVE_MAX_JOBS"); maxJobs != "" {
 		// Parse and set max jobs
 	}
+	
+	if tunnelURL := os.Getenv("COMPUTEHIVE_TUNNEL_URL"); tunnelURL != "" {
+		config.TunnelURL = tunnelURL
+	}
+	
+	if interval := os.Getenv("COMPUTEHIVE_RESOURCE_INTERVAL"); interval != "" {
+		if d, err := time.ParseDuration(interval); err == nil {
+			config.ResourceSampleInterval = d
+		}
+	}
 }
 
 // validateConfig validates the configuration
@@ -156,5 +187,10 @@ func validateConfig(config *core.Config) error {
 		return fmt.Errorf("max concurrent jobs must be positive")
 	}
 	
+	// Sampling walks the process table while jobs run, so keep it infrequent
+	if config.ResourceSampleInterval < time.Second {
+		return fmt.Errorf("resource sample interval must be at least 1s")
+	}
+	
 	return nil
 }
@@ -6,6 +6,8 @@ import (
 	"log"
 	"sync"
 	"time"
+	
+	"github.com/computehive/agent/pkg/agentlib"
 )
 
 // Agent represents the main compute agent
@@ -15,8 +17,13 @@ type Agent struct {
 	client          *Client
 	resourceMonitor *ResourceMonitor
 	jobExecutor     *JobExecutor
+	execManager     *ExecManager
+	tunnelManager   *TunnelManager
+	diagnostics     *Diagnostics
 	metrics         *AgentMetrics
 	status          AgentStatus
+	profile         *ConfigAssignment // Applied fleet config profile, nil for local config
+	connectivity    *Connectivity     // Last connectivity check
 	mu              sync.RWMutex
 	ctx             context.Context
 	cancel          context.CancelFunc
@@ -32,11 +39,25 @@ func NewAgent(config *Config) (*Agent, error) {
 		return nil, fmt.Errorf("failed to create client: %w", err)
 	}
 	
-	resourceMonitor := NewResourceMonitor()
 	jobExecutor := NewJobExecutor(config)
+	resourceMonitor := agentlib.NewResourceMonitor(agentlib.ResourceMonitorConfig{
+		SampleInterval: config.ResourceSampleInterval,
+		Jobs:           jobExecutor,
+	})
+	
+	// Enrolled agents keep their identity across restarts
+	id := GenerateAgentID()
+	enrollment, err := loadEnrollment(config.WorkDir)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to load enrollment: %w", err)
+	}
+	if enrollment != nil {
+		id = enrollment.AgentID
+	}
 	
 	agent := &Agent{
-		id:              GenerateAgentID(),
+		id:              id,
 		config:          config,
 		client:          client,
 		resourceMonitor: resourceMonitor,
@@ -46,6 +67,12 @@ func NewAgent(config *Config) (*Agent, error) {
 		ctx:             ctx,
 		cancel:          cancel,
 	}
+	agent.execManager = NewExecManager(agent.id, client, jobExecutor, config.WorkDir)
+	agent.tunnelManager = NewTunnelManager(agent.id, client, jobExecutor)
+	agent.diagnostics = NewDiagnostics(agent)
+	jobExecutor.onWarning = agent.reportJobWarning
+	jobExecutor.onProgress = agent.reportJobProgress
+	jobExecutor.onLogs = agent.reportJobLogs
 	
 	return agent, nil
 }
@@ -66,9 +93,16 @@ func (a *Agent) Start() error {
 	a.setStatus(AgentStatusActive)
 	
 	// Start main loops
+	go a.connectivityLoop()
 	go a.heartbeatLoop()
 	go a.jobPollingLoop()
 	go a.metricsReportingLoop()
+	go a.configControlLoop()
+	go a.diagnosticsPollingLoop()
+	go a.resizePollingLoop()
+	if a.config.EnableExec {
+		go a.execPollingLoop()
+	}
 	
 	log.Printf("Agent %s started successfully", a.id)
 	return nil
@@ -98,24 +132,19 @@ func (a *Agent) Stop() error {
 	return nil
 }
 
-// register registers the agent with the control plane
+// register enrolls the agent with the control plane and waits for approval.
+// Agents started with credentials and no join token skip enrollment.
 func (a *Agent) register() error {
-	resources := a.resourceMonitor.GetResources()
-	
-	req := &RegisterRequest{
-		AgentID:      a.id,
-		Version:      Version,
-		Platform:     GetPlatformInfo(),
-		Resources:    resources,
-		Capabilities: a.getCapabilities(),
+	if a.config.Token != "" && a.config.JoinToken == "" {
+		if state, err := loadEnrollment(a.config.WorkDir); err == nil && state == nil {
+			log.Printf("Agent %s using provisioned credentials", a.id)
+			return nil
+		}
 	}
 	
-	resp, err := a.client.Register(a.ctx, req)
-	if err != nil {
+	if err := a.enroll(); err != nil {
 		return err
 	}
-	
-	a.config.Token = resp.Token
 	log.Printf("Agent registered successfully with ID: %s", a.id)
 	return nil
 }
@@ -155,6 +184,8 @@ func (a *Agent) sendHeartbeat() error {
 		Resources:  resources,
 		ActiveJobs: activeJobs,
 		Metrics:    a.metrics.GetSnapshot(),
+		Labels:     a.config.Labels,
+		Connectivity: a.getConnectivity(),
 	}
 	
 	return a.client.SendHeartbeat(a.ctx, heartbeat)
@@ -209,12 +240,20 @@ func (a *Agent) executeJob(job *Job) error {
 		return fmt.Errorf("job validation failed: %w", err)
 	}
 	
+	// Expose declared ports through the tunnel service while the job runs
+	if len(job.ExposedPorts) > 0 {
+		tunnelCtx, stopTunnel := context.WithCancel(a.ctx)
+		defer stopTunnel()
+		go a.tunnelManager.Serve(tunnelCtx, job)
+	}
+	
 	// Execute the job
 	result, err := a.jobExecutor.Execute(a.ctx, job)
 	if err != nil {
 		a.metrics.IncrementJobsFailed()
 		return err
 	}
+	a.diagnostics.recordResult(result)
 	
 	// Report result to control plane
 	if err := a.client.ReportJobResult(a.ctx, result); err != nil {
@@ -226,6 +265,47 @@ func (a *Agent) executeJob(job *Job) error {
 	return nil
 }
 
+// reportJobWarning raises a warning about a running job to its owner
+func (a *Agent) reportJobWarning(jobID string, warning *JobWarning) {
+	if err := a.client.ReportJobWarning(a.ctx, a.id, jobID, warning); err != nil {
+		log.Printf("Failed to report warning for job %s: %v", jobID, err)
+	}
+}
+
+// reportJobProgress reports how far a running job has got to its owner
+func (a *Agent) reportJobProgress(jobID string, progress *JobProgress) {
+	if err := a.client.ReportJobProgress(a.ctx, a.id, jobID, progress); err != nil {
+		log.Printf("Failed to report progress of job %s: %v", jobID, err)
+	}
+}
+
+// reportJobLogs ships lines a running job wrote to its owner's log tail
+func (a *Agent) reportJobLogs(jobID string, lines []JobLogLine) {
+	if err := a.client.ReportJobLogs(a.ctx, a.id, jobID, lines); err != nil {
+		log.Printf("Failed to ship logs of job %s: %v", jobID, err)
+	}
+}
+
+// execPollingLoop polls for interactive exec sessions into running jobs
+func (a *Agent) execPollingLoop() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	
+	for {
+		select {
+		case <-ticker.C:
+			if a.jobExecutor.GetActiveJobCount() == 0 {
+				continue
+			}
+			if err := a.execManager.Poll(a.ctx); err != nil {
+				log.Printf("Failed to poll exec sessions: %v", err)
+			}
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
 // validateJob checks if the job can be executed on this agent
 func (a *Agent) validateJob(job *Job) error {
 	resources := a.resourceMonitor.GetResources()
@@ -248,13 +328,19 @@ func (a *Agent) validateJob(job *Job) error {
 			job.Requirements.GPUCount, len(resources.GPUs))
 	}
 	
-	return nil
+	// Only containers have ports of their own to expose
+	if len(job.ExposedPorts) > 0 && job.Type != JobTypeDocker {
+		return fmt.Errorf("exposed ports require a docker job, not %s", job.Type)
+	}
+	
+	// Enforce limits and runtimes from the fleet config profile
+	return a.validateProfileLimits(job)
 }
 
 // hasCapacity checks if the agent can accept new jobs
 func (a *Agent) hasCapacity() bool {
 	activeJobs := a.jobExecutor.GetActiveJobCount()
-	return activeJobs < a.config.MaxConcurrentJobs
+	return activeJobs < a.maxConcurrentJobs()
 }
 
 // reportJobFailure notifies the control plane of a job failure
@@ -303,7 +389,7 @@ func (a *Agent) reportMetrics() error {
 
 // getCapabilities returns the agent's capabilities
 func (a *Agent) getCapabilities() []string {
-	caps := []string{"docker", "kubernetes"}
+	caps := []string{"docker", "kubernetes", "sidecars"}
 	
 	resources := a.resourceMonitor.GetResources()
 	if len(resources.GPUs) > 0 {
@@ -1,7 +1,7 @@
 package core
 
 import (
-	"context"
+	"net"
 	"testing"
 	"time"
 )
@@ -76,41 +76,6 @@ func TestAgentMetrics(t *testing.T) {
 	}
 }
 
-func TestResourceMonitor(t *testing.T) {
-	rm := NewResourceMonitor()
-	if rm == nil {
-		t.Fatal("ResourceMonitor is nil")
-	}
-
-	// Test getting resources
-	resources := rm.GetResources()
-	if resources == nil {
-		t.Fatal("Resources is nil")
-	}
-
-	// Start monitoring in a goroutine
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	go rm.Start(ctx)
-
-	// Give it time to collect initial data
-	time.Sleep(100 * time.Millisecond)
-
-	// Get resources again
-	resources = rm.GetResources()
-	
-	// Basic validation - CPU should have cores
-	if resources.CPU.Cores <= 0 {
-		t.Error("CPU cores should be greater than 0")
-	}
-
-	// Memory should have total
-	if resources.Memory.Total <= 0 {
-		t.Error("Memory total should be greater than 0")
-	}
-}
-
 func TestJobExecutor(t *testing.T) {
 	config := &Config{
 		WorkDir:           "/tmp/computehive-test",
@@ -160,4 +125,74 @@ func TestGenerateAgentID(t *testing.T) {
 	if id1 == id2 {
 		t.Error("Generated IDs should be unique")
 	}
-} 
\ No newline at end of file
+} 
+func TestHashEnv(t *testing.T) {
+	a := hashEnv([]string{"A=1", "B=2"})
+	b := hashEnv([]string{"B=2", "A=1"})
+
+	if a != b {
+		t.Error("Env hash should not depend on variable order")
+	}
+
+	if a == hashEnv([]string{"A=1", "B=3"}) {
+		t.Error("Env hash should change when a value changes")
+	}
+}
+
+func TestPredictOOM(t *testing.T) {
+	start := time.Now()
+	samples := func(fromMB, stepMB float64) []memorySample {
+		var out []memorySample
+		for i := 0; i < 10; i++ {
+			out = append(out, memorySample{at: start.Add(time.Duration(i) * 2 * time.Second), mb: fromMB + float64(i)*stepMB})
+		}
+		return out
+	}
+
+	// 10 MB every 2s is 300 MB/min; from 1590 MB the 2048 MB limit is ~92s away
+	p := predictOOM(samples(1500, 10), 2048)
+	if !p.warn || p.growthMBPerMinute < 299 || p.growthMBPerMinute > 301 {
+		t.Errorf("Expected a warning at 300 MB/min, got %+v", p)
+	}
+	if p.eta < 90*time.Second || p.eta > 93*time.Second {
+		t.Errorf("ETA = %s, want about 92s", p.eta)
+	}
+
+	// The same growth is no concern while most of the limit is free
+	if p := predictOOM(samples(100, 10), 2048); p.warn {
+		t.Errorf("Growth far from the limit should not warn: %+v", p)
+	}
+	// Slow growth does not reach the limit within the horizon
+	if p := predictOOM(samples(1500, 1), 2048); p.warn {
+		t.Errorf("Slow growth should not warn: %+v", p)
+	}
+	// Flat usage close to the limit warns without an ETA
+	if p := predictOOM(samples(2000, 0), 2048); !p.warn || p.eta != 0 {
+		t.Errorf("Usage near the limit should warn: %+v", p)
+	}
+	// Too few samples to fit a trend
+	if p := predictOOM(samples(1500, 10)[:3], 2048); p.warn {
+		t.Errorf("Three samples should not predict: %+v", p)
+	}
+}
+
+func TestClassifyConnectivity(t *testing.T) {
+	local := []net.IP{net.ParseIP("192.168.1.20"), net.ParseIP("2001:db8::20")}
+
+	tests := []struct {
+		observed   string
+		forceRelay bool
+		want       string
+	}{
+		{"2001:db8::20", false, ConnectivityDirect},
+		{"192.168.1.20", false, ConnectivityDirect},
+		{"203.0.113.7", false, ConnectivityRelayed}, // NAT or CGNAT
+		{"", false, ConnectivityRelayed},            // Control plane unreachable
+		{"2001:db8::20", true, ConnectivityRelayed},
+	}
+	for _, tt := range tests {
+		if got := classifyConnectivity(local, net.ParseIP(tt.observed), tt.forceRelay); got != tt.want {
+			t.Errorf("classifyConnectivity(%q, force=%v) = %s, want %s", tt.observed, tt.forceRelay, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// maxConfigBackoff caps the wait between control channel reconnects
+const maxConfigBackoff = 30 * time.Second
+
+// ParseLabels parses labels in the form "key=value,key2=value2"
+func ParseLabels(s string) (Labels, error) {
+	labels := make(Labels)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", pair)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// configControlLoop applies fleet config profiles the control plane pushes
+// over the agent's control channel. The assigned profile is fetched each
+// time the channel connects, so changes made while it was down apply too.
+func (a *Agent) configControlLoop() {
+	backoff := time.Second
+	for {
+		if err := a.syncConfigProfile(a.ctx); err != nil {
+			log.Printf("Failed to sync config profile: %v", err)
+		}
+		connected, err := a.serveControlChannel(a.ctx)
+		if err != nil && a.ctx.Err() == nil {
+			log.Printf("Control channel lost: %v", err)
+		}
+		if connected {
+			backoff = time.Second
+		}
+
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < maxConfigBackoff {
+			backoff *= 2
+		}
+	}
+}
+
+// serveControlChannel applies the config pushed over the control channel
+// until it closes, reporting whether it connected
+func (a *Agent) serveControlChannel(ctx context.Context) (bool, error) {
+	conn, err := a.client.DialControl(ctx, a.id)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	// Unblock the read below on shutdown
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	for {
+		var msg ControlMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			return true, err
+		}
+		if msg.Type == ControlMessageConfig && msg.Config != nil {
+			if err := a.applyConfigProfile(ctx, msg.Config); err != nil {
+				log.Printf("Failed to report config profile status: %v", err)
+			}
+		}
+	}
+}
+
+// syncConfigProfile fetches the assigned profile and applies it
+func (a *Agent) syncConfigProfile(ctx context.Context) error {
+	assignment, err := a.client.GetConfigAssignment(ctx, a.id)
+	if err != nil {
+		return err
+	}
+	return a.applyConfigProfile(ctx, assignment)
+}
+
+// applyConfigProfile applies an assigned profile when it changed
+func (a *Agent) applyConfigProfile(ctx context.Context, assignment *ConfigAssignment) error {
+	a.mu.Lock()
+	current := a.profile
+	unchanged := (current == nil && assignment.ProfileID == "") ||
+		(current != nil && current.ProfileID == assignment.ProfileID && current.Revision == assignment.Revision)
+	a.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	// No profile applies any more: fall back to the local configuration
+	if assignment.ProfileID == "" || assignment.Spec == nil {
+		a.mu.Lock()
+		a.profile = nil
+		a.mu.Unlock()
+		log.Printf("Config profile removed, using local configuration")
+		return nil
+	}
+
+	status := &ConfigStatus{ProfileID: assignment.ProfileID, Revision: assignment.Revision}
+	if err := assignment.Spec.Validate(); err != nil {
+		status.Error = err.Error()
+		log.Printf("Rejected config profile %s revision %d: %v", assignment.ProfileID, assignment.Revision, err)
+	} else {
+		a.mu.Lock()
+		a.profile = assignment
+		a.mu.Unlock()
+		log.Printf("Applied config profile %s revision %d (update channel %q)",
+			assignment.ProfileID, assignment.Revision, assignment.Spec.UpdateChannel)
+	}
+
+	return a.client.ReportConfigStatus(ctx, a.id, status)
+}
+
+// activeProfile returns the applied profile spec, or nil when running on local configuration
+func (a *Agent) activeProfile() *ProfileSpec {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.profile == nil {
+		return nil
+	}
+	return a.profile.Spec
+}
+
+// maxConcurrentJobs returns the job concurrency limit, preferring the profile's
+func (a *Agent) maxConcurrentJobs() int {
+	if profile := a.activeProfile(); profile != nil && profile.MaxConcurrentJobs > 0 {
+		return profile.MaxConcurrentJobs
+	}
+	return a.config.MaxConcurrentJobs
+}
+
+// validateProfileLimits checks a job against the applied profile
+func (a *Agent) validateProfileLimits(job *Job) error {
+	profile := a.activeProfile()
+	if profile == nil {
+		return nil
+	}
+
+	if !profile.AllowsRuntime(job.Type) {
+		return fmt.Errorf("runtime %s is disabled by the config profile", job.Type)
+	}
+	if profile.MaxCPUCores > 0 && job.Requirements.CPUCores > profile.MaxCPUCores {
+		return fmt.Errorf("job requires %d CPU cores, profile allows %d",
+			job.Requirements.CPUCores, profile.MaxCPUCores)
+	}
+	if profile.MaxMemoryMB > 0 && job.Requirements.MemoryMB > profile.MaxMemoryMB {
+		return fmt.Errorf("job requires %d MB memory, profile allows %d MB",
+			job.Requirements.MemoryMB, profile.MaxMemoryMB)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+)
+
+// connectivityCheckInterval is how often the agent re-checks its
+// connectivity; home connections change addresses without notice
+const connectivityCheckInterval = 15 * time.Minute
+
+// checkConnectivity classifies the agent's connectivity
+func (a *Agent) checkConnectivity() *Connectivity {
+	local := localAddresses()
+	conn := &Connectivity{CheckedAt: time.Now()}
+	for _, ip := range local {
+		conn.Addresses = append(conn.Addresses, ip.String())
+		if ip.To4() == nil && !ip.IsPrivate() {
+			conn.IPv6 = true
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, 10*time.Second)
+	defer cancel()
+	observed, err := a.client.ReflectAddress(ctx, a.id)
+	if err != nil {
+		log.Printf("Failed to check connectivity: %v", err)
+	}
+	observedIP := net.ParseIP(observed)
+	if observedIP != nil {
+		conn.ObservedAddress = observedIP.String()
+	}
+	conn.Class = classifyConnectivity(local, observedIP, a.config.ForceRelay)
+	return conn
+}
+
+// classifyConnectivity returns direct when the observed address is one of
+// the local ones. An unknown observed address counts as relayed.
+func classifyConnectivity(local []net.IP, observed net.IP, forceRelay bool) string {
+	if forceRelay || observed == nil {
+		return ConnectivityRelayed
+	}
+	for _, ip := range local {
+		if ip.Equal(observed) {
+			return ConnectivityDirect
+		}
+	}
+	return ConnectivityRelayed
+}
+
+// localAddresses lists the agent's routable interface addresses, IPv4 and
+// IPv6, leaving out loopback and link-local ones
+func localAddresses() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		ips = append(ips, ipNet.IP)
+	}
+	return ips
+}
+
+// connectivityLoop keeps the agent's connectivity current
+func (a *Agent) connectivityLoop() {
+	ticker := time.NewTicker(connectivityCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		conn := a.checkConnectivity()
+		a.mu.Lock()
+		previous := a.connectivity
+		a.connectivity = conn
+		a.mu.Unlock()
+		if previous == nil || previous.Class != conn.Class {
+			log.Printf("Agent connectivity is %s (observed address %q)", conn.Class, conn.ObservedAddress)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// getConnectivity returns the agent's last connectivity check, nil before
+// the first
+func (a *Agent) getConnectivity() *Connectivity {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.connectivity
+}
@@ -0,0 +1,292 @@
+package core
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Diagnostics limits
+const (
+	diagnosticsPollInterval = 30 * time.Second
+	maxRecentLogLines       = 2000
+	maxRecentResults        = 50
+	maxResultOutput         = 4096 // Bytes of output and error kept per job result
+	redacted                = "[REDACTED]"
+)
+
+// Diagnostics collects support bundles requested by the control plane, so
+// provider machines can be debugged without SSH access. A bundle is a
+// gzipped tar of recent agent logs, the agent's configuration with secrets
+// redacted, a resource snapshot and the last job results, sealed with
+// AES-GCM under a key the control plane issued for that request.
+type Diagnostics struct {
+	agent   *Agent
+	logs    *logRing
+	results []*JobResult // Most recent last
+	active  map[string]bool
+	mu      sync.Mutex
+}
+
+// NewDiagnostics creates a collector and starts capturing the standard
+// logger's output
+func NewDiagnostics(agent *Agent) *Diagnostics {
+	d := &Diagnostics{
+		agent:  agent,
+		logs:   newLogRing(maxRecentLogLines),
+		active: make(map[string]bool),
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, d.logs))
+	return d
+}
+
+// recordResult keeps a job result for later bundles
+func (d *Diagnostics) recordResult(result *JobResult) {
+	kept := *result
+	kept.Output = truncate(kept.Output, maxResultOutput)
+	kept.Error = truncate(kept.Error, maxResultOutput)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results = append(d.results, &kept)
+	if len(d.results) > maxRecentResults {
+		d.results = d.results[len(d.results)-maxRecentResults:]
+	}
+}
+
+// diagnosticsPollingLoop picks up diagnostics requests
+func (a *Agent) diagnosticsPollingLoop() {
+	ticker := time.NewTicker(diagnosticsPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.diagnostics.Poll(a.ctx); err != nil {
+				log.Printf("Failed to poll diagnostics requests: %v", err)
+			}
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// Poll fetches pending requests and collects any not already in progress
+func (d *Diagnostics) Poll(ctx context.Context) error {
+	requests, err := d.agent.client.GetDiagnosticsRequests(ctx, d.agent.id)
+	if err != nil {
+		return err
+	}
+
+	for _, req := range requests {
+		d.mu.Lock()
+		running := d.active[req.ID]
+		d.active[req.ID] = true
+		d.mu.Unlock()
+
+		if !running {
+			go d.run(ctx, req)
+		}
+	}
+	return nil
+}
+
+// run collects, seals and uploads one bundle, reporting failures back
+func (d *Diagnostics) run(ctx context.Context, req *DiagnosticsRequest) {
+	defer func() {
+		d.mu.Lock()
+		delete(d.active, req.ID)
+		d.mu.Unlock()
+	}()
+
+	log.Printf("Collecting diagnostics bundle %s", req.ID)
+	sealed, err := d.collect(req)
+	if err == nil {
+		err = d.agent.client.UploadDiagnostics(ctx, d.agent.id, req.ID, sealed)
+	}
+	if err != nil {
+		log.Printf("Diagnostics bundle %s failed: %v", req.ID, err)
+		if reportErr := d.agent.client.ReportDiagnosticsFailure(ctx, d.agent.id, req.ID, err.Error()); reportErr != nil {
+			log.Printf("Failed to report diagnostics failure: %v", reportErr)
+		}
+		return
+	}
+	log.Printf("Uploaded diagnostics bundle %s (%d bytes)", req.ID, len(sealed))
+}
+
+// collect builds the bundle and encrypts it
+func (d *Diagnostics) collect(req *DiagnosticsRequest) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(req.Key)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid bundle key")
+	}
+
+	a := d.agent
+	d.mu.Lock()
+	results := d.results
+	if req.JobResults >= 0 && req.JobResults < len(results) {
+		results = results[len(results)-req.JobResults:]
+	}
+	results = append([]*JobResult(nil), results...)
+	d.mu.Unlock()
+
+	a.mu.RLock()
+	profile := a.profile
+	a.mu.RUnlock()
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"agent.json", map[string]interface{}{
+			"agent_id":     a.id,
+			"version":      Version,
+			"platform":     GetPlatformInfo(),
+			"status":       a.getStatus(),
+			"capabilities": a.getCapabilities(),
+			"profile":      profile,
+			"collected_at": time.Now(),
+		}},
+		{"config.json", redactConfig(a.config)},
+		{"resources.json", map[string]interface{}{
+			"resources":   a.resourceMonitor.GetResources(),
+			"metrics":     a.metrics.GetSnapshot(),
+			"active_jobs": a.jobExecutor.GetActiveJobs(),
+		}},
+		{"job_results.json", results},
+	}
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, file := range files {
+		data, err := json.MarshalIndent(file.content, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", file.name, err)
+		}
+		if err := addFile(tw, file.name, data, now); err != nil {
+			return nil, err
+		}
+	}
+	logs := d.redactSecrets(strings.Join(d.logs.Lines(req.LogLines), ""))
+	if err := addFile(tw, "agent.log", []byte(logs), now); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return seal(key, archive.Bytes())
+}
+
+// redactSecrets removes the agent's credentials from free text
+func (d *Diagnostics) redactSecrets(text string) string {
+	for _, secret := range []string{d.agent.config.Token, d.agent.config.JoinToken} {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, redacted)
+		}
+	}
+	return text
+}
+
+// redactConfig copies the configuration without credentials
+func redactConfig(config *Config) Config {
+	clean := *config
+	if clean.Token != "" {
+		clean.Token = redacted
+	}
+	if clean.JoinToken != "" {
+		clean.JoinToken = redacted
+	}
+	return clean
+}
+
+func addFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: modTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// seal encrypts data with AES-256-GCM; the nonce is prepended
+func seal(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max] + "... [truncated]"
+}
+
+// logRing keeps the last lines written to the agent's log
+type logRing struct {
+	lines []string
+	next  int
+	full  bool
+	mu    sync.Mutex
+}
+
+func newLogRing(size int) *logRing {
+	return &logRing{lines: make([]string, size)}
+}
+
+// Write records each line written; the standard logger writes one entry per call
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lines[r.next] = string(p)
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+	return len(p), nil
+}
+
+// Lines returns up to n of the most recent lines, oldest first
+func (r *logRing) Lines(n int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lines []string
+	if r.full {
+		lines = append(lines, r.lines[r.next:]...)
+	}
+	lines = append(lines, r.lines[:r.next]...)
+	if n > 0 && n < len(lines) {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
@@ -0,0 +1,168 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// enrollmentFile keeps an agent's identity across restarts, in the work dir
+const enrollmentFile = "enrollment.json"
+
+// enrollmentPollInterval is how often a pending agent checks for approval
+const enrollmentPollInterval = 30 * time.Second
+
+// Enrollment states reported by the control plane
+const (
+	EnrollmentPending  = "pending"
+	EnrollmentApproved = "approved"
+	EnrollmentRejected = "rejected"
+	EnrollmentRevoked  = "revoked"
+)
+
+// EnrollmentState is what an agent persists once it has enrolled. The secret
+// is the only proof of the agent's identity, so the file is private.
+type EnrollmentState struct {
+	AgentID          string    `json:"agent_id"`
+	EnrollmentSecret string    `json:"enrollment_secret"`
+	EnrolledAt       time.Time `json:"enrolled_at"`
+}
+
+// loadEnrollment reads the persisted enrollment, or nil if the agent never
+// enrolled
+func loadEnrollment(workDir string) (*EnrollmentState, error) {
+	data, err := os.ReadFile(filepath.Join(workDir, enrollmentFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state EnrollmentState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", enrollmentFile, err)
+	}
+	return &state, nil
+}
+
+func saveEnrollment(workDir string, state *EnrollmentState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(workDir, enrollmentFile), data, 0600)
+}
+
+// enroll requests enrollment with the join token on first start, then waits
+// until an admin approves the agent and its credentials arrive
+func (a *Agent) enroll() error {
+	state, err := loadEnrollment(a.config.WorkDir)
+	if err != nil {
+		return err
+	}
+
+	if state == nil {
+		if a.config.JoinToken == "" {
+			return fmt.Errorf("a join token is required to enroll this agent")
+		}
+		_, _, fingerprint := hardwareFingerprint()
+		resp, err := a.client.Register(a.ctx, &RegisterRequest{
+			AgentID:             a.id,
+			JoinToken:           a.config.JoinToken,
+			HardwareFingerprint: fingerprint,
+			Version:             Version,
+			Platform:            GetPlatformInfo(),
+			Resources:           a.resourceMonitor.GetResources(),
+			Capabilities:        a.getCapabilities(),
+			ProtocolVersions:    SupportedProtocolVersions,
+		})
+		if err != nil {
+			return err
+		}
+		warnDeprecatedProtocol(resp)
+
+		state = &EnrollmentState{AgentID: a.id, EnrollmentSecret: resp.EnrollmentSecret, EnrolledAt: time.Now()}
+		if err := saveEnrollment(a.config.WorkDir, state); err != nil {
+			return fmt.Errorf("failed to save enrollment: %w", err)
+		}
+		log.Printf("Agent %s enrolled, awaiting approval", a.id)
+	}
+
+	resp, err := a.awaitCredentials(state)
+	if err != nil {
+		return err
+	}
+	a.config.Token = resp.Token
+	if !resp.ExpiresAt.IsZero() {
+		go a.credentialRefreshLoop(state, resp.ExpiresAt)
+	}
+	return nil
+}
+
+// awaitCredentials polls until the enrollment is decided
+func (a *Agent) awaitCredentials(state *EnrollmentState) (*RegisterResponse, error) {
+	for {
+		resp, err := a.client.GetEnrollmentCredentials(a.ctx, state.AgentID, state.EnrollmentSecret)
+		if err != nil {
+			// The control plane may have lost the enrollment; removing the file re-enrolls
+			log.Printf("Failed to check enrollment (remove %s to enroll again): %v",
+				filepath.Join(a.config.WorkDir, enrollmentFile), err)
+		} else {
+			switch resp.Status {
+			case EnrollmentApproved:
+				warnDeprecatedProtocol(resp)
+				return resp, nil
+			case EnrollmentRejected, EnrollmentRevoked:
+				return nil, fmt.Errorf("enrollment %s: %s", resp.Status, resp.Reason)
+			}
+		}
+
+		select {
+		case <-time.After(enrollmentPollInterval):
+		case <-a.ctx.Done():
+			return nil, a.ctx.Err()
+		}
+	}
+}
+
+// warnDeprecatedProtocol logs the control plane's notice that the protocol
+// this agent speaks will stop being accepted
+func warnDeprecatedProtocol(resp *RegisterResponse) {
+	if resp.Deprecation != "" {
+		log.Printf("Warning: %s", resp.Deprecation)
+	}
+}
+
+// credentialRefreshLoop renews credentials once 80% of their lifetime has
+// passed
+func (a *Agent) credentialRefreshLoop(state *EnrollmentState, expiresAt time.Time) {
+	for {
+		wait := time.Until(expiresAt) * 4 / 5
+		if wait < enrollmentPollInterval {
+			wait = enrollmentPollInterval
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-a.ctx.Done():
+			return
+		}
+
+		resp, err := a.client.GetEnrollmentCredentials(a.ctx, state.AgentID, state.EnrollmentSecret)
+		if err != nil {
+			log.Printf("Failed to renew credentials: %v", err)
+			continue
+		}
+		if resp.Status != EnrollmentApproved {
+			log.Printf("Agent enrollment %s, credentials not renewed: %s", resp.Status, resp.Reason)
+			return
+		}
+		expiresAt = resp.ExpiresAt
+	}
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/computehive/agent/pkg/agentlib"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// captureEnvironment snapshots the environment a job ran in. It runs while
+// the job directory still exists so downloaded binaries can be hashed.
+func (je *JobExecutor) captureEnvironment(ctx context.Context, job *Job, workDir string) *ExecutionEnvironment {
+	env := &ExecutionEnvironment{
+		OS:           runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		AgentVersion: Version,
+		EnvHash:      hashEnv(job.Payload.Env),
+		CapturedAt:   time.Now(),
+	}
+
+	switch job.Type {
+	case JobTypeDocker:
+		env.Runtime = "docker"
+		env.ImageRef = job.Payload.Image
+		env.RuntimeVersion = commandOutput(ctx, "docker", "version", "--format", "{{.Server.Version}}")
+		env.ImageDigest = imageDigest(ctx, job.Payload.Image)
+	case JobTypeBinary:
+		env.Runtime = "binary"
+		path := job.Payload.BinaryURL
+		if isURL(path) {
+			path = filepath.Join(workDir, "executable")
+		}
+		env.ArtifactDigest = fileDigest(path)
+	case JobTypeScript:
+		if interpreter, err := scriptInterpreter(job.Payload.Language); err == nil {
+			env.Runtime = interpreter
+			env.RuntimeVersion = commandOutput(ctx, interpreter, "--version")
+		}
+		sum := sha256.Sum256([]byte(job.Payload.Script))
+		env.ArtifactDigest = "sha256:" + hex.EncodeToString(sum[:])
+	default:
+		env.Runtime = string(job.Type)
+	}
+
+	if gpuRuntime := agentlib.DetectGPURuntime(ctx); gpuRuntime != nil && gpuRuntime.CUDAVersion != "" {
+		env.DriverVersion = gpuRuntime.DriverVersion
+		env.CUDAVersion = gpuRuntime.CUDAVersion
+	}
+
+	env.CPUModel, env.GPUModels, env.HardwareFingerprint = hardwareFingerprint()
+	return env
+}
+
+// hashEnv hashes environment variables independent of their order. Values
+// are hashed rather than recorded since they may hold secrets.
+func hashEnv(vars []string) string {
+	sorted := append([]string(nil), vars...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\x00")))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// hardwareFingerprint identifies the hardware class a job ran on: CPU model
+// and count, memory size and GPU models. Hosts built alike share a fingerprint.
+func hardwareFingerprint() (string, []string, string) {
+	cpuModel := ""
+	if info, err := cpu.Info(); err == nil && len(info) > 0 {
+		cpuModel = strings.TrimSpace(info[0].ModelName)
+	}
+	var memoryGB uint64
+	if vm, err := mem.VirtualMemory(); err == nil {
+		memoryGB = vm.Total / (1 << 30)
+	}
+
+	var gpuModels []string
+	for _, gpu := range agentlib.DetectGPUs() {
+		gpuModels = append(gpuModels, gpu.Model)
+	}
+	sort.Strings(gpuModels)
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"arch":      runtime.GOARCH,
+		"cpu_model": cpuModel,
+		"cpus":      runtime.NumCPU(),
+		"memory_gb": memoryGB,
+		"gpus":      gpuModels,
+	})
+	sum := sha256.Sum256(data)
+	return cpuModel, gpuModels, hex.EncodeToString(sum[:16])
+}
+
+// imageDigest returns an image's registry digest, falling back to the local
+// image ID for images that were never pushed
+func imageDigest(ctx context.Context, image string) string {
+	if digest := commandOutput(ctx, "docker", "image", "inspect", "--format", "{{if .RepoDigests}}{{index .RepoDigests 0}}{{end}}", image); digest != "" {
+		return digest
+	}
+	return commandOutput(ctx, "docker", "image", "inspect", "--format", "{{.Id}}", image)
+}
+
+// fileDigest returns the sha256 digest of a file, or "" if it cannot be read
+func fileDigest(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// commandOutput returns the first non-empty line a command prints, or "" if
+// it fails
+func commandOutput(ctx context.Context, name string, args ...string) string {
+	for _, line := range strings.Split(rawOutput(ctx, name, args...), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// rawOutput runs a command with a short timeout and returns its combined output
+func rawOutput(ctx context.Context, name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	return string(output)
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ptyDrainTimeout bounds how long output is relayed after the exec process exits
+const ptyDrainTimeout = 2 * time.Second
+
+// ExecManager bridges interactive exec sessions between the control plane
+// and running jobs. Consumers request a session through the scheduler; the
+// agent picks it up while polling, dials back over an authenticated
+// WebSocket and attaches a PTY (or plain pipes) to a process inside the job.
+//
+// Terminal data travels as binary WebSocket messages; control messages
+// (resize, exit) travel as JSON text messages.
+type ExecManager struct {
+	agentID  string
+	client   *Client
+	executor *JobExecutor
+	workDir  string
+	active   map[string]bool
+	mu       sync.Mutex
+}
+
+// NewExecManager creates a new exec session manager
+func NewExecManager(agentID string, client *Client, executor *JobExecutor, workDir string) *ExecManager {
+	return &ExecManager{
+		agentID:  agentID,
+		client:   client,
+		executor: executor,
+		workDir:  workDir,
+		active:   make(map[string]bool),
+	}
+}
+
+// Poll fetches pending exec sessions and starts any that are not yet running
+func (em *ExecManager) Poll(ctx context.Context) error {
+	sessions, err := em.client.GetExecSessions(ctx, em.agentID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		em.mu.Lock()
+		running := em.active[session.ID]
+		em.active[session.ID] = true
+		em.mu.Unlock()
+
+		if !running {
+			go em.run(ctx, session)
+		}
+	}
+	return nil
+}
+
+// run attaches one exec session until the process exits or the consumer disconnects
+func (em *ExecManager) run(ctx context.Context, session *ExecSession) {
+	defer func() {
+		em.mu.Lock()
+		delete(em.active, session.ID)
+		em.mu.Unlock()
+	}()
+
+	conn, err := em.client.DialExecSession(ctx, em.agentID, session.ID)
+	if err != nil {
+		log.Printf("Failed to attach exec session %s: %v", session.ID, err)
+		return
+	}
+	defer conn.Close()
+
+	cmd, err := em.executor.ExecCommand(ctx, session.JobID, session.Command, session.TTY)
+	if err != nil {
+		em.sendControl(conn, &ExecControlMessage{Type: "error", Error: err.Error()})
+		return
+	}
+
+	// Optional session recording, uploaded as a job artifact afterwards
+	var recording *os.File
+	if session.Record {
+		path := filepath.Join(em.workDir, fmt.Sprintf("exec-%s.log", session.ID))
+		if recording, err = os.Create(path); err != nil {
+			log.Printf("Failed to create recording for exec session %s: %v", session.ID, err)
+		} else {
+			defer os.Remove(path)
+		}
+	}
+
+	var exitCode int
+	if session.TTY {
+		exitCode, err = em.runPTY(conn, cmd, session, recording)
+	} else {
+		exitCode, err = em.runPipes(conn, cmd, recording)
+	}
+	if err != nil {
+		em.sendControl(conn, &ExecControlMessage{Type: "error", Error: err.Error()})
+	} else {
+		em.sendControl(conn, &ExecControlMessage{Type: "exit", ExitCode: exitCode})
+	}
+
+	if recording != nil {
+		em.uploadRecording(ctx, session, recording)
+	}
+}
+
+// runPTY runs cmd on a pseudo-terminal and relays it over conn
+func (em *ExecManager) runPTY(conn *websocket.Conn, cmd *exec.Cmd, session *ExecSession, recording io.Writer) (int, error) {
+	master, slave, err := openPTY()
+	if err != nil {
+		return -1, err
+	}
+	defer master.Close()
+
+	if session.Cols > 0 && session.Rows > 0 {
+		resizePTY(master, session.Cols, session.Rows)
+	}
+
+	cmd.Stdin = slave
+	cmd.Stdout = slave
+	cmd.Stderr = slave
+	cmd.SysProcAttr = ptySysProcAttr()
+	if err := cmd.Start(); err != nil {
+		slave.Close()
+		return -1, fmt.Errorf("failed to start exec process: %w", err)
+	}
+	slave.Close()
+
+	done := make(chan struct{})
+	go func() {
+		em.pumpOutput(conn, master, recording)
+		close(done)
+	}()
+	go em.pumpInput(conn, master, func(msg *ExecControlMessage) {
+		if msg.Type == "resize" {
+			resizePTY(master, msg.Cols, msg.Rows)
+		}
+	}, cmd)
+
+	exitCode, err := waitExitCode(cmd)
+	// The terminal stays open while background processes hold it, so drain
+	// output briefly, then close it; conn has one writer again before the
+	// exit frame is sent
+	select {
+	case <-done:
+	case <-time.After(ptyDrainTimeout):
+		master.Close()
+		<-done
+	}
+	return exitCode, err
+}
+
+// runPipes runs cmd without a terminal, relaying stdin and combined output
+func (em *ExecManager) runPipes(conn *websocket.Conn, cmd *exec.Cmd, recording io.Writer) (int, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return -1, err
+	}
+	outReader, outWriter := io.Pipe()
+	cmd.Stdout = outWriter
+	cmd.Stderr = outWriter
+
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("failed to start exec process: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		em.pumpOutput(conn, outReader, recording)
+		close(done)
+	}()
+	go em.pumpInput(conn, stdin, nil, cmd)
+
+	exitCode, err := waitExitCode(cmd)
+	outWriter.Close()
+	<-done
+	return exitCode, err
+}
+
+// pumpOutput copies process output to the WebSocket and the recording
+func (em *ExecManager) pumpOutput(conn *websocket.Conn, r io.Reader, recording io.Writer) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if recording != nil {
+				recording.Write(buf[:n])
+			}
+			if writeErr := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); writeErr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// pumpInput copies consumer input to the process and dispatches control messages.
+// The process is killed when the consumer disconnects.
+func (em *ExecManager) pumpInput(conn *websocket.Conn, w io.Writer, onControl func(*ExecControlMessage), cmd *exec.Cmd) {
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			if cmd.Process != nil {
+				cmd.Process.Kill()
+			}
+			return
+		}
+
+		switch msgType {
+		case websocket.BinaryMessage:
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+		case websocket.TextMessage:
+			var msg ExecControlMessage
+			if err := json.Unmarshal(data, &msg); err == nil && onControl != nil {
+				onControl(&msg)
+			}
+		}
+	}
+}
+
+func (em *ExecManager) sendControl(conn *websocket.Conn, msg *ExecControlMessage) {
+	data, _ := json.Marshal(msg)
+	conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// uploadRecording stores the session transcript as a job artifact
+func (em *ExecManager) uploadRecording(ctx context.Context, session *ExecSession, recording *os.File) {
+	defer recording.Close()
+
+	info, err := recording.Stat()
+	if err != nil || info.Size() == 0 {
+		return
+	}
+	if _, err := recording.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+
+	artifact := &JobArtifact{
+		Name:     fmt.Sprintf("exec-%s-%s.log", session.ID, time.Now().UTC().Format("20060102T150405Z")),
+		Path:     recording.Name(),
+		Size:     info.Size(),
+		MimeType: "text/plain",
+	}
+	if err := em.client.UploadArtifact(ctx, session.JobID, artifact, recording); err != nil {
+		log.Printf("Failed to upload recording for exec session %s: %v", session.ID, err)
+	}
+}
+
+// waitExitCode waits for cmd and extracts its exit code
+func waitExitCode(cmd *exec.Cmd) (int, error) {
+	err := cmd.Wait()
+	if err == nil {
+		return 0, nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+	return -1, err
+}
@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -8,8 +9,11 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
+	
+	"github.com/computehive/agent/pkg/agentlib"
 )
 
 // JobExecutor handles job execution
@@ -19,6 +23,10 @@ type JobExecutor struct {
 	mu          sync.RWMutex
 	workDir     string
 	dockerAvailable bool
+	nvidiaGPUs  bool // Docker can hand GPUs to containers through the NVIDIA runtime
+	onWarning   func(jobID string, warning *JobWarning) // Raises job warnings to the control plane
+	onProgress  func(jobID string, progress *JobProgress) // Reports job progress to the control plane
+	onLogs      func(jobID string, lines []JobLogLine) // Ships job output to the control plane as it is written
 }
 
 // ActiveJob represents a currently running job
@@ -28,6 +36,8 @@ type ActiveJob struct {
 	Cancel    context.CancelFunc
 	StartTime time.Time
 	Process   *os.Process
+	restart   bool            // A resize stopped the container to start it again
+	watchdog  *memoryWatchdog // Of the running container, to follow memory resizes
 }
 
 // NewJobExecutor creates a new job executor
@@ -40,6 +50,9 @@ func NewJobExecutor(config *Config) *JobExecutor {
 	
 	// Check Docker availability
 	executor.dockerAvailable = executor.checkDockerAvailable()
+	if runtime := agentlib.DetectGPURuntime(context.Background()); executor.dockerAvailable && runtime != nil {
+		executor.nvidiaGPUs = runtime.CUDAVersion != ""
+	}
 	
 	// Create work directory if it doesn't exist
 	if err := os.MkdirAll(executor.workDir, 0755); err != nil {
@@ -80,6 +93,10 @@ func (je *JobExecutor) Execute(ctx context.Context, job *Job) (*JobResult, error
 		je.mu.Unlock()
 	}()
 	
+	// Follow the progress the job writes to its working directory
+	stopProgress := je.watchProgress(jobCtx, job.ID, jobDir)
+	defer stopProgress()
+	
 	// Execute based on job type
 	var result *JobResult
 	var err error
@@ -97,17 +114,23 @@ func (je *JobExecutor) Execute(ctx context.Context, job *Job) (*JobResult, error
 		err = fmt.Errorf("unsupported job type: %s", job.Type)
 	}
 	
+	// Snapshot the environment before the job directory is removed so the
+	// run can be reproduced later
+	environment := je.captureEnvironment(ctx, job, jobDir)
+	
 	if err != nil {
 		return &JobResult{
-			JobID:      job.ID,
-			AgentID:    GenerateAgentID(),
-			Status:     JobStatusFailed,
-			Error:      err.Error(),
-			StartedAt:  activeJob.StartTime,
-			FinishedAt: time.Now(),
+			JobID:       job.ID,
+			AgentID:     GenerateAgentID(),
+			Status:      JobStatusFailed,
+			Error:       err.Error(),
+			StartedAt:   activeJob.StartTime,
+			FinishedAt:  time.Now(),
+			Environment: environment,
 		}, nil
 	}
 	
+	result.Environment = environment
 	return result, nil
 }
 
@@ -117,15 +140,30 @@ func (je *JobExecutor) executeDockerJob(ctx context.Context, job *Job, workDir s
 		return nil, fmt.Errorf("Docker is not available on this system")
 	}
 	
-	// Build Docker command
-	args := []string{"run", "--rm"}
+	// Build Docker command; the container is named so exec sessions can attach,
+	// and its ID is written outside the job directory so the resource monitor
+	// can find its cgroup
+	cidFile := je.containerIDPath(job.ID)
+	os.Remove(cidFile) // Docker refuses to start over a file left by a crashed agent
+	defer os.Remove(cidFile)
 	
-	// Add resource limits
-	if job.Requirements.CPUCores > 0 {
-		args = append(args, fmt.Sprintf("--cpus=%d", job.Requirements.CPUCores))
-	}
-	if job.Requirements.MemoryMB > 0 {
-		args = append(args, fmt.Sprintf("--memory=%dm", job.Requirements.MemoryMB))
+	// Jobs with sidecars run as a pod, which the main container joins last
+	runCtx := ctx
+	var pod *jobPod
+	var args []string
+	if runsAsPod(job) {
+		var err error
+		if pod, err = je.startPod(ctx, job, workDir); err != nil {
+			return nil, err
+		}
+		defer pod.teardown()
+		runCtx = pod.ctx
+		args = append(args, pod.joinArgs()...)
+	} else {
+		// Publish exposed ports on loopback only; the tunnel reaches them from the host
+		for _, port := range job.ExposedPorts {
+			args = append(args, "-p", fmt.Sprintf("127.0.0.1::%d", port.Port))
+		}
 	}
 	
 	// Add work directory as volume
@@ -141,9 +179,49 @@ func (je *JobExecutor) executeDockerJob(ctx context.Context, job *Job, workDir s
 	args = append(args, job.Payload.Image)
 	args = append(args, job.Payload.Command...)
 	
-	// Execute Docker command
-	cmd := exec.CommandContext(ctx, "docker", args...)
-	output, err := cmd.CombinedOutput()
+	// Execute Docker command, sampling usage for right-sizing analytics and
+	// watching memory growth to warn before an OOM kill. A resize that
+	// changes GPUs stops the container, which starts again with the job's
+	// new resources.
+	sampler := startUsageSampler(ctx, containerName(job.ID))
+	logs, stopLogs := je.shipLogs(job.ID)
+	var output []byte
+	var err error
+	for {
+		je.mu.RLock()
+		current := *job
+		je.mu.RUnlock()
+		
+		runArgs := []string{"run", "--rm", "--name", containerName(job.ID), "--cidfile", cidFile}
+		runArgs = append(runArgs, je.resourceArgs(&current)...)
+		runArgs = append(runArgs, args...)
+		
+		watchdog := je.startMemoryWatchdog(runCtx, &current)
+		je.setWatchdog(job.ID, watchdog)
+		var runOutput bytes.Buffer
+		cmd := exec.CommandContext(runCtx, "docker", runArgs...)
+		cmd.Stdout = io.MultiWriter(&runOutput, logs)
+		cmd.Stderr = cmd.Stdout
+		err = cmd.Run()
+		je.setWatchdog(job.ID, nil)
+		watchdog.Stop()
+		output = append(output, runOutput.Bytes()...)
+		
+		if runCtx.Err() != nil || !je.takeRestart(job.ID) {
+			break
+		}
+		os.Remove(cidFile)
+		log.Printf("Restarting job %s with resized resources", job.ID)
+	}
+	stopLogs()
+	
+	// Sidecars stop with the main container; their logs follow its output
+	var sidecarErr error
+	if pod != nil {
+		var logs string
+		logs, sidecarErr = pod.stop()
+		output = append(output, logs...)
+	}
 	
 	result := &JobResult{
 		JobID:      job.ID,
@@ -153,6 +231,7 @@ func (je *JobExecutor) executeDockerJob(ctx context.Context, job *Job, workDir s
 		ExitCode:   0,
 		StartedAt:  time.Now(),
 		FinishedAt: time.Now(),
+		Metrics:    sampler.Stop(),
 	}
 	
 	if err != nil {
@@ -162,10 +241,29 @@ func (je *JobExecutor) executeDockerJob(ctx context.Context, job *Job, workDir s
 			result.ExitCode = exitErr.ExitCode()
 		}
 	}
+	if sidecarErr != nil {
+		result.Status = JobStatusFailed
+		result.Error = sidecarErr.Error()
+	}
 	
 	return result, nil
 }
 
+// resourceArgs returns the resource limits of a job's main container
+func (je *JobExecutor) resourceArgs(job *Job) []string {
+	var args []string
+	if job.Requirements.CPUCores > 0 {
+		args = append(args, fmt.Sprintf("--cpus=%d", job.Requirements.CPUCores))
+	}
+	if job.Requirements.MemoryMB > 0 {
+		args = append(args, fmt.Sprintf("--memory=%dm", mainMemoryMB(job)))
+	}
+	if job.Requirements.GPUCount > 0 && je.nvidiaGPUs {
+		args = append(args, fmt.Sprintf("--gpus=%d", job.Requirements.GPUCount))
+	}
+	return args
+}
+
 // executeBinaryJob runs a binary executable job
 func (je *JobExecutor) executeBinaryJob(ctx context.Context, job *Job, workDir string) (*JobResult, error) {
 	// Download binary if URL is provided
@@ -191,7 +289,7 @@ func (je *JobExecutor) executeBinaryJob(ctx context.Context, job *Job, workDir s
 	cmd.Env = append(os.Environ(), job.Payload.Env...)
 	
 	// Capture output
-	output, err := cmd.CombinedOutput()
+	output, err := je.runJobProcess(job.ID, cmd)
 	
 	result := &JobResult{
 		JobID:      job.ID,
@@ -216,24 +314,11 @@ func (je *JobExecutor) executeBinaryJob(ctx context.Context, job *Job, workDir s
 
 // executeScriptJob runs a script-based job
 func (je *JobExecutor) executeScriptJob(ctx context.Context, job *Job, workDir string) (*JobResult, error) {
-	// Determine interpreter based on language
-	var interpreter string
-	var args []string
-	
-	switch job.Payload.Language {
-	case "python":
-		interpreter = "python3"
-	case "javascript", "js":
-		interpreter = "node"
-	case "bash", "sh":
-		interpreter = "bash"
-	case "ruby":
-		interpreter = "ruby"
-	case "perl":
-		interpreter = "perl"
-	default:
-		return nil, fmt.Errorf("unsupported script language: %s", job.Payload.Language)
+	interpreter, err := scriptInterpreter(job.Payload.Language)
+	if err != nil {
+		return nil, err
 	}
+	var args []string
 	
 	// Write script to file
 	scriptPath := filepath.Join(workDir, "script")
@@ -252,7 +337,7 @@ func (je *JobExecutor) executeScriptJob(ctx context.Context, job *Job, workDir s
 		cmd.Stdin = nil // Could pipe input data here if needed
 	}
 	
-	output, err := cmd.CombinedOutput()
+	output, err := je.runJobProcess(job.ID, cmd)
 	
 	result := &JobResult{
 		JobID:      job.ID,
@@ -288,6 +373,48 @@ func (je *JobExecutor) executeScriptJob(ctx context.Context, job *Job, workDir s
 	return result, nil
 }
 
+// runJobProcess runs a job's process and returns its combined output, which
+// is shipped as it is written. The process is recorded on the active job so
+// its usage can be attributed.
+func (je *JobExecutor) runJobProcess(jobID string, cmd *exec.Cmd) ([]byte, error) {
+	logs, stopLogs := je.shipLogs(jobID)
+	defer stopLogs()
+	
+	var output bytes.Buffer
+	cmd.Stdout = io.MultiWriter(&output, logs)
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	
+	je.mu.Lock()
+	if activeJob, exists := je.activeJobs[jobID]; exists {
+		activeJob.Process = cmd.Process
+	}
+	je.mu.Unlock()
+	
+	err := cmd.Wait()
+	return output.Bytes(), err
+}
+
+// scriptInterpreter determines the interpreter for a script language
+func scriptInterpreter(language string) (string, error) {
+	switch language {
+	case "python":
+		return "python3", nil
+	case "javascript", "js":
+		return "node", nil
+	case "bash", "sh":
+		return "bash", nil
+	case "ruby":
+		return "ruby", nil
+	case "perl":
+		return "perl", nil
+	default:
+		return "", fmt.Errorf("unsupported script language: %s", language)
+	}
+}
+
 // executeWASMJob runs a WebAssembly job
 func (je *JobExecutor) executeWASMJob(ctx context.Context, job *Job, workDir string) (*JobResult, error) {
 	// This would require a WASM runtime like wasmtime or wasmer
@@ -306,6 +433,32 @@ func (je *JobExecutor) GetActiveJobs() []string {
 	return jobs
 }
 
+// JobProcesses reports the root process or container of each active job
+func (je *JobExecutor) JobProcesses() []agentlib.JobProcess {
+	je.mu.RLock()
+	defer je.mu.RUnlock()
+	
+	procs := make([]agentlib.JobProcess, 0, len(je.activeJobs))
+	for id, activeJob := range je.activeJobs {
+		proc := agentlib.JobProcess{
+			JobID:    id,
+			CPUCores: activeJob.Job.Requirements.CPUCores,
+			MemoryMB: activeJob.Job.Requirements.MemoryMB,
+		}
+		if activeJob.Process != nil {
+			proc.PID = int32(activeJob.Process.Pid)
+		}
+		// Docker writes the ID once the container is created
+		if activeJob.Job.Type == JobTypeDocker {
+			if containerID, err := os.ReadFile(je.containerIDPath(id)); err == nil {
+				proc.ContainerID = strings.TrimSpace(string(containerID))
+			}
+		}
+		procs = append(procs, proc)
+	}
+	return procs
+}
+
 // GetActiveJobCount returns the number of active jobs
 func (je *JobExecutor) GetActiveJobCount() int {
 	je.mu.RLock()
@@ -327,6 +480,37 @@ func (je *JobExecutor) CancelJob(jobID string) error {
 	return nil
 }
 
+// ExecCommand builds a command that runs inside an active job's environment.
+// Docker jobs exec into the job container; other jobs run in the job directory.
+func (je *JobExecutor) ExecCommand(ctx context.Context, jobID string, command []string, tty bool) (*exec.Cmd, error) {
+	je.mu.RLock()
+	activeJob, exists := je.activeJobs[jobID]
+	je.mu.RUnlock()
+	
+	if !exists {
+		return nil, fmt.Errorf("job %s is not running on this agent", jobID)
+	}
+	
+	if len(command) == 0 {
+		command = []string{"/bin/sh"}
+	}
+	
+	if activeJob.Job.Type == JobTypeDocker {
+		args := []string{"exec", "-i"}
+		if tty {
+			args = append(args, "-t")
+		}
+		args = append(args, containerName(jobID))
+		args = append(args, command...)
+		return exec.CommandContext(ctx, "docker", args...), nil
+	}
+	
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Dir = filepath.Join(je.workDir, jobID)
+	cmd.Env = append(os.Environ(), activeJob.Job.Payload.Env...)
+	return cmd, nil
+}
+
 // WaitForCompletion waits for all active jobs to complete
 func (je *JobExecutor) WaitForCompletion(timeout time.Duration) error {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
@@ -354,6 +538,49 @@ func (je *JobExecutor) checkDockerAvailable() bool {
 	return err == nil
 }
 
+// ResolvePort returns the host address serving an exposed port of an active job
+func (je *JobExecutor) ResolvePort(ctx context.Context, jobID string, port int) (string, error) {
+	je.mu.RLock()
+	activeJob, exists := je.activeJobs[jobID]
+	je.mu.RUnlock()
+	
+	if !exists {
+		return "", fmt.Errorf("job %s is not running on this agent", jobID)
+	}
+	
+	// Other job types share the host's network, so their ports could be any
+	// service on the provider's machine
+	if activeJob.Job.Type != JobTypeDocker {
+		return "", fmt.Errorf("job %s is not a container; only container ports can be exposed", jobID)
+	}
+	
+	// Docker picked the host port when the container started; in a pod the
+	// ports belong to the container holding its network namespace
+	container := containerName(jobID)
+	if runsAsPod(activeJob.Job) {
+		container = podContainerName(jobID)
+	}
+	output, err := exec.CommandContext(ctx, "docker", "port", container, fmt.Sprintf("%d/tcp", port)).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve port %d: %w", port, err)
+	}
+	addr := strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+	if addr == "" {
+		return "", fmt.Errorf("port %d is not published", port)
+	}
+	return addr, nil
+}
+
+// containerIDPath returns the file Docker writes a job's container ID to
+func (je *JobExecutor) containerIDPath(jobID string) string {
+	return filepath.Join(je.workDir, jobID+".cid")
+}
+
+// containerName returns the Docker container name for a job
+func containerName(jobID string) string {
+	return "computehive-" + jobID
+}
+
 // isURL checks if a string is a URL
 func isURL(s string) bool {
 	return len(s) > 7 && (s[:7] == "http://" || s[:8] == "https://")
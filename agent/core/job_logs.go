@@ -0,0 +1,115 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// Job log shipping settings
+const (
+	logFlushInterval = 2 * time.Second
+	maxLogBatchLines = 200  // Sent at once when a job writes faster than the flush interval
+	maxLogLineLength = 4096 // Longer lines are cut
+)
+
+// logShipper forwards a job's output to the control plane a line at a time
+// while the job runs, so its owner can follow it before the job finishes
+type logShipper struct {
+	jobID   string
+	send    func(jobID string, lines []JobLogLine)
+	mu      sync.Mutex
+	partial []byte
+	lines   []JobLogLine
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// shipLogs returns a writer for a job's output that ships each line it
+// completes, and a function that sends what is left and stops shipping
+func (je *JobExecutor) shipLogs(jobID string) (io.Writer, func()) {
+	if je.onLogs == nil {
+		return io.Discard, func() {}
+	}
+	s := &logShipper{
+		jobID: jobID,
+		send:  je.onLogs,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s, func() {
+		close(s.stop)
+		<-s.done
+	}
+}
+
+// Write splits output into lines, keeping an unfinished last line for the
+// next write
+func (s *logShipper) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			break
+		}
+		s.add(s.partial[:i])
+		s.partial = s.partial[i+1:]
+	}
+	if len(s.partial) > maxLogLineLength {
+		s.add(s.partial)
+		s.partial = nil
+	}
+	return len(p), nil
+}
+
+// add queues a line. Callers hold s.mu.
+func (s *logShipper) add(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(line) > maxLogLineLength {
+		line = line[:maxLogLineLength]
+	}
+	s.lines = append(s.lines, JobLogLine{Timestamp: time.Now(), Stream: "output", Message: string(line)})
+}
+
+// run sends queued lines every flush interval until stopped, then sends the
+// rest, including an unfinished last line
+func (s *logShipper) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(logFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stop:
+			s.mu.Lock()
+			if len(s.partial) > 0 {
+				s.add(s.partial)
+				s.partial = nil
+			}
+			s.mu.Unlock()
+			s.flush()
+			return
+		}
+	}
+}
+
+// flush sends the queued lines in batches of at most maxLogBatchLines
+func (s *logShipper) flush() {
+	s.mu.Lock()
+	lines := s.lines
+	s.lines = nil
+	s.mu.Unlock()
+
+	for len(lines) > 0 {
+		n := min(len(lines), maxLogBatchLines)
+		s.send(s.jobID, lines[:n])
+		lines = lines[n:]
+	}
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Job progress settings
+const (
+	progressFileName     = "progress" // In the job's working directory, /work for Docker jobs
+	progressPollInterval = 5 * time.Second
+	maxProgressMessage   = 256
+)
+
+// watchProgress reports the progress a job writes to the progress file in
+// its working directory, as a percentage optionally followed by a message
+// ("42.5 rendering frame 17"), whenever the file changes. It returns a
+// function that stops watching.
+func (je *JobExecutor) watchProgress(ctx context.Context, jobID, jobDir string) func() {
+	if je.onProgress == nil {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(progressPollInterval)
+		defer ticker.Stop()
+
+		path := filepath.Join(jobDir, progressFileName)
+		var last string
+		for {
+			select {
+			case <-ticker.C:
+				data, err := os.ReadFile(path)
+				if err != nil {
+					continue
+				}
+				line := strings.TrimSpace(string(data))
+				if line == last {
+					continue
+				}
+				last = line
+				if progress, ok := parseProgress(line); ok {
+					je.onProgress(jobID, progress)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// parseProgress reads a progress line: a percentage from 0 to 100, then an
+// optional message
+func parseProgress(line string) (*JobProgress, bool) {
+	value, message, _ := strings.Cut(line, " ")
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	if err != nil || percent < 0 || percent > 100 {
+		return nil, false
+	}
+	message = strings.TrimSpace(message)
+	if len(message) > maxProgressMessage {
+		message = message[:maxProgressMessage]
+	}
+	return &JobProgress{Progress: percent, Message: message}, true
+}
@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// resizePollInterval is how often the agent asks for resizes of its jobs
+const resizePollInterval = 15 * time.Second
+
+// resizePollingLoop picks up resizes of running jobs
+func (a *Agent) resizePollingLoop() {
+	ticker := time.NewTicker(resizePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.pollResizes(a.ctx); err != nil {
+				log.Printf("Failed to poll job resizes: %v", err)
+			}
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
+
+// pollResizes applies pending resizes one at a time and reports each back
+// before the next poll can return it again
+func (a *Agent) pollResizes(ctx context.Context) error {
+	resizes, err := a.client.GetJobResizes(ctx, a.id)
+	if err != nil {
+		return err
+	}
+
+	for _, resize := range resizes {
+		err := a.jobExecutor.Resize(ctx, resize)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+			log.Printf("Resize %s of job %s failed: %v", resize.ID, resize.JobID, err)
+		} else {
+			log.Printf("Resized job %s to %d CPU cores, %d MB memory and %d GPUs", resize.JobID, resize.CPUCores, resize.MemoryMB, resize.GPUCount)
+		}
+		if err := a.client.ReportJobResize(ctx, a.id, resize.ID, err == nil, reason); err != nil {
+			log.Printf("Failed to report resize %s: %v", resize.ID, err)
+		}
+	}
+	return nil
+}
+
+// Resize changes the resources of a running Docker job. CPU and memory are
+// updated on the running container; a restart stops the container, and the
+// job's run loop starts it again with the new resources.
+func (je *JobExecutor) Resize(ctx context.Context, resize *JobResize) error {
+	je.mu.Lock()
+	activeJob, exists := je.activeJobs[resize.JobID]
+	if !exists {
+		je.mu.Unlock()
+		return fmt.Errorf("job %s is not running on this agent", resize.JobID)
+	}
+	if activeJob.Job.Type != JobTypeDocker {
+		je.mu.Unlock()
+		return fmt.Errorf("job %s is not a Docker job", resize.JobID)
+	}
+	if resize.Restart && resize.GPUCount > 0 && !je.nvidiaGPUs {
+		je.mu.Unlock()
+		return fmt.Errorf("no NVIDIA container runtime to give job %s GPUs", resize.JobID)
+	}
+	previous := activeJob.Job.Requirements
+	resized := *activeJob.Job
+	resized.Requirements.CPUCores = resize.CPUCores
+	resized.Requirements.MemoryMB = resize.MemoryMB
+	resized.Requirements.GPUCount = resize.GPUCount
+
+	if resize.Restart {
+		activeJob.Job.Requirements = resized.Requirements
+		activeJob.restart = true
+		je.mu.Unlock()
+
+		if err := runDocker(ctx, "stop", containerName(resize.JobID)); err != nil {
+			je.mu.Lock()
+			activeJob.Job.Requirements = previous
+			activeJob.restart = false
+			je.mu.Unlock()
+			return err
+		}
+		return nil
+	}
+	je.mu.Unlock()
+
+	// docker run leaves swap at twice the memory limit; Docker refuses a
+	// memory limit above the old swap limit unless both are raised
+	memoryMB := mainMemoryMB(&resized)
+	err := runDocker(ctx, "update", "--cpus", fmt.Sprint(resize.CPUCores),
+		"--memory", fmt.Sprintf("%dm", memoryMB), "--memory-swap", fmt.Sprintf("%dm", 2*memoryMB), containerName(resize.JobID))
+	if err != nil {
+		return err
+	}
+
+	je.mu.Lock()
+	activeJob.Job.Requirements = resized.Requirements
+	activeJob.watchdog.setLimit(memoryMB)
+	je.mu.Unlock()
+	return nil
+}
+
+// setWatchdog records the memory watchdog of a job's running container
+func (je *JobExecutor) setWatchdog(jobID string, watchdog *memoryWatchdog) {
+	je.mu.Lock()
+	defer je.mu.Unlock()
+	if activeJob, exists := je.activeJobs[jobID]; exists {
+		activeJob.watchdog = watchdog
+	}
+}
+
+// takeRestart reports whether a resize stopped a job's container to start
+// it again, clearing the request
+func (je *JobExecutor) takeRestart(jobID string) bool {
+	je.mu.Lock()
+	defer je.mu.Unlock()
+	activeJob, exists := je.activeJobs[jobID]
+	if !exists || !activeJob.restart {
+		return false
+	}
+	activeJob.restart = false
+	return true
+}
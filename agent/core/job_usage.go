@@ -0,0 +1,125 @@
+package core
+
+import (
+	"context"
+	"math"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usageSampleInterval is how often a running container's usage is sampled
+const usageSampleInterval = 10 * time.Second
+
+// usageSampler records CPU and memory usage of a job container over its lifetime
+type usageSampler struct {
+	container string
+	cpuCores  []float64
+	memPeakMB int64
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// startUsageSampler begins sampling a container until Stop is called
+func startUsageSampler(ctx context.Context, container string) *usageSampler {
+	s := &usageSampler{
+		container: container,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s
+}
+
+func (s *usageSampler) run(ctx context.Context) {
+	defer close(s.stopped)
+
+	ticker := time.NewTicker(usageSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.sample(ctx)
+		}
+	}
+}
+
+// sample reads one usage point from docker stats
+func (s *usageSampler) sample(ctx context.Context) {
+	output, err := exec.CommandContext(ctx, "docker", "stats", "--no-stream",
+		"--format", "{{.CPUPerc}}|{{.MemUsage}}", s.container).Output()
+	if err != nil {
+		return
+	}
+
+	fields := strings.SplitN(strings.TrimSpace(string(output)), "|", 2)
+	if len(fields) != 2 {
+		return
+	}
+
+	// CPUPerc is relative to one core, so 250% means 2.5 cores
+	cpu, err := strconv.ParseFloat(strings.TrimSuffix(fields[0], "%"), 64)
+	if err == nil {
+		s.cpuCores = append(s.cpuCores, cpu/100)
+	}
+
+	// MemUsage is "used / limit"
+	used := strings.TrimSpace(strings.SplitN(fields[1], "/", 2)[0])
+	if mb, ok := parseDockerSizeMB(used); ok && mb > s.memPeakMB {
+		s.memPeakMB = mb
+	}
+}
+
+// Stop ends sampling and returns the collected metrics, or nil with no samples
+func (s *usageSampler) Stop() *JobMetrics {
+	close(s.done)
+	<-s.stopped
+
+	if len(s.cpuCores) == 0 {
+		return nil
+	}
+
+	sorted := append([]float64(nil), s.cpuCores...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	idx := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+
+	return &JobMetrics{
+		CPUCoresAvg:  sum / float64(len(sorted)),
+		CPUCoresP95:  sorted[idx],
+		MemoryPeakMB: s.memPeakMB,
+		Samples:      len(sorted),
+	}
+}
+
+// parseDockerSizeMB parses sizes such as "512MiB" or "1.5GiB" into megabytes
+func parseDockerSizeMB(size string) (int64, bool) {
+	units := []struct {
+		suffix string
+		mb     float64
+	}{
+		{"KiB", 1.0 / 1024}, {"MiB", 1}, {"GiB", 1024}, {"TiB", 1024 * 1024},
+		{"kB", 1.0 / 1000}, {"MB", 1}, {"GB", 1000}, {"B", 1.0 / (1024 * 1024)},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(size, unit.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSuffix(size, unit.suffix), 64)
+			if err != nil {
+				return 0, false
+			}
+			return int64(math.Ceil(v * unit.mb)), true
+		}
+	}
+	return 0, false
+}
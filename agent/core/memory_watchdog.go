@@ -0,0 +1,254 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/computehive/agent/pkg/agentlib"
+)
+
+// Memory watchdog settings
+const (
+	memoryWatchInterval   = 2 * time.Second
+	memoryWatchWindow     = 30 // Samples the growth rate is fitted over
+	memoryWatchMinSamples = 5
+	oomPredictionHorizon  = 2 * time.Minute // Warn once the limit is this close at the current growth rate
+	oomImminentRatio      = 0.95            // Warn above this share of the limit whatever the growth
+	oomPredictMinRatio    = 0.5             // Growth below this share of the limit is not a concern yet
+	oomWarningCooldown    = 5 * time.Minute
+	checkpointTimeout     = 5 * time.Minute
+)
+
+// memorySample is one reading of a container's memory use
+type memorySample struct {
+	at time.Time
+	mb float64
+}
+
+// oomPrediction is what the watchdog concluded from recent samples
+type oomPrediction struct {
+	currentMB         float64
+	growthMBPerMinute float64
+	eta               time.Duration // Until the limit at the current growth rate, 0 when not growing
+	warn              bool
+}
+
+// memoryWatchdog follows the memory of a Docker job's main container and
+// warns the job's owner when its growth predicts an OOM kill, so the job can
+// be checkpointed before the kernel kills it. The memory usage sampler is too
+// coarse for this: a leak can fill the remaining memory between two of its
+// samples.
+type memoryWatchdog struct {
+	je            *JobExecutor
+	ctx           context.Context
+	job           *Job
+	limitMB       atomic.Int64 // Follows resizes of the running container
+	samples       []memorySample
+	lastWarning   time.Time
+	checkpointing bool
+	mu            sync.Mutex
+	done          chan struct{}
+	stopped       chan struct{}
+}
+
+// startMemoryWatchdog watches a Docker job until Stop is called. Jobs
+// without a memory limit cannot run out of memory and are not watched.
+func (je *JobExecutor) startMemoryWatchdog(ctx context.Context, job *Job) *memoryWatchdog {
+	if job.Requirements.MemoryMB <= 0 || je.onWarning == nil {
+		return nil
+	}
+	w := &memoryWatchdog{
+		je:      je,
+		ctx:     ctx,
+		job:     job,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	w.limitMB.Store(int64(mainMemoryMB(job)))
+	go w.run()
+	return w
+}
+
+func (w *memoryWatchdog) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(memoryWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			mb, ok := w.je.containerMemoryMB(w.ctx, w.job.ID)
+			if !ok {
+				continue
+			}
+			w.samples = append(w.samples, memorySample{at: now, mb: mb})
+			if len(w.samples) > memoryWatchWindow {
+				w.samples = w.samples[1:]
+			}
+
+			prediction := predictOOM(w.samples, float64(w.limitMB.Load()))
+			if prediction.warn && now.Sub(w.lastWarning) >= oomWarningCooldown {
+				w.lastWarning = now
+				w.warn(prediction)
+			}
+		}
+	}
+}
+
+// Stop ends watching; it is safe to call on a nil watchdog
+func (w *memoryWatchdog) Stop() {
+	if w == nil {
+		return
+	}
+	close(w.done)
+	<-w.stopped
+}
+
+// setLimit changes the memory limit predictions are made against; it is
+// safe to call on a nil watchdog
+func (w *memoryWatchdog) setLimit(mb int) {
+	if w == nil {
+		return
+	}
+	w.limitMB.Store(int64(mb))
+}
+
+// warn reports a predicted OOM and triggers the job's checkpoint, if it
+// declares one and the previous checkpoint has finished
+func (w *memoryWatchdog) warn(prediction oomPrediction) {
+	limitMB := w.limitMB.Load()
+	warning := &JobWarning{
+		Kind:              WarningMemoryPressure,
+		MemoryMB:          int64(prediction.currentMB),
+		LimitMB:           limitMB,
+		GrowthMBPerMinute: prediction.growthMBPerMinute,
+	}
+	if prediction.eta > 0 {
+		warning.PredictedOOMSeconds = int(prediction.eta.Seconds())
+		warning.Message = fmt.Sprintf("Memory use of %d MB is growing by %.0f MB/min and will reach the %d MB limit in about %s",
+			warning.MemoryMB, warning.GrowthMBPerMinute, limitMB, prediction.eta.Round(time.Second))
+	} else {
+		warning.Message = fmt.Sprintf("Memory use of %d MB is close to the %d MB limit", warning.MemoryMB, limitMB)
+	}
+
+	w.mu.Lock()
+	checkpoint := w.job.Payload.Checkpoint != nil && !w.checkpointing
+	w.checkpointing = w.checkpointing || checkpoint
+	w.mu.Unlock()
+	if checkpoint {
+		warning.Checkpoint = "triggered"
+		warning.Message += "; checkpoint triggered"
+	}
+
+	log.Printf("Job %s: %s", w.job.ID, warning.Message)
+	w.je.onWarning(w.job.ID, warning)
+
+	if checkpoint {
+		go w.checkpoint()
+	}
+}
+
+// checkpoint asks the job to save its state. A failure is reported to the
+// owner, who may still want to act before the job is killed.
+func (w *memoryWatchdog) checkpoint() {
+	defer func() {
+		w.mu.Lock()
+		w.checkpointing = false
+		w.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(w.ctx, checkpointTimeout)
+	defer cancel()
+
+	container := containerName(w.job.ID)
+	var err error
+	if checkpoint := w.job.Payload.Checkpoint; checkpoint.Signal != "" {
+		err = runDocker(ctx, "kill", "--signal", checkpoint.Signal, container)
+	} else {
+		err = runDocker(ctx, append([]string{"exec", container}, checkpoint.Command...)...)
+	}
+	if err == nil || w.ctx.Err() != nil {
+		return
+	}
+
+	log.Printf("Job %s: checkpoint failed: %v", w.job.ID, err)
+	w.je.onWarning(w.job.ID, &JobWarning{
+		Kind:       WarningCheckpointFailed,
+		LimitMB:    w.limitMB.Load(),
+		Checkpoint: "failed",
+		Message:    fmt.Sprintf("Checkpoint failed: %v", err),
+	})
+}
+
+// predictOOM fits a line through the samples to find how fast memory grows
+// and when it reaches the limit. It warns when the limit is within the
+// prediction horizon, or memory is already nearly exhausted.
+func predictOOM(samples []memorySample, limitMB float64) oomPrediction {
+	if len(samples) == 0 || limitMB <= 0 {
+		return oomPrediction{}
+	}
+	p := oomPrediction{currentMB: samples[len(samples)-1].mb}
+	imminent := p.currentMB >= oomImminentRatio*limitMB
+	if len(samples) < memoryWatchMinSamples {
+		p.warn = imminent
+		return p
+	}
+
+	// Least squares slope in MB per second
+	var sumT, sumM, sumTT, sumTM float64
+	for _, sample := range samples {
+		t := sample.at.Sub(samples[0].at).Seconds()
+		sumT += t
+		sumM += sample.mb
+		sumTT += t * t
+		sumTM += t * sample.mb
+	}
+	n := float64(len(samples))
+	denominator := n*sumTT - sumT*sumT
+	if denominator == 0 {
+		p.warn = imminent
+		return p
+	}
+	slope := (n*sumTM - sumT*sumM) / denominator
+
+	if slope > 0 {
+		p.growthMBPerMinute = slope * 60
+		p.eta = time.Duration((limitMB - p.currentMB) / slope * float64(time.Second))
+		if p.eta < 0 {
+			p.eta = 0
+		}
+	}
+	p.warn = imminent || (slope > 0 && p.currentMB >= oomPredictMinRatio*limitMB && p.eta <= oomPredictionHorizon)
+	return p
+}
+
+// containerMemoryMB reads the memory use of a job's main container, from its
+// cgroup where possible and from docker stats otherwise
+func (je *JobExecutor) containerMemoryMB(ctx context.Context, jobID string) (float64, bool) {
+	if containerID, err := os.ReadFile(je.containerIDPath(jobID)); err == nil {
+		if _, memoryBytes, ok := agentlib.ContainerUsage(strings.TrimSpace(string(containerID))); ok {
+			return float64(memoryBytes) / (1 << 20), true
+		}
+	}
+
+	output, err := exec.CommandContext(ctx, "docker", "stats", "--no-stream",
+		"--format", "{{.MemUsage}}", containerName(jobID)).Output()
+	if err != nil {
+		return 0, false
+	}
+	used := strings.TrimSpace(strings.SplitN(string(output), "/", 2)[0])
+	mb, ok := parseDockerSizeMB(used)
+	return float64(mb), ok
+}
@@ -0,0 +1,220 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Pod settings
+const (
+	podInfraImage      = "registry.k8s.io/pause:3.9" // Holds the pod's namespaces and does nothing else
+	sidecarStopTimeout = 10 * time.Second
+	podCleanupTimeout  = 30 * time.Second
+	minMainMemoryMB    = 64
+)
+
+// jobPod runs a Docker job's sidecars next to its main container as one
+// unit. An infrastructure container owns the network and IPC namespaces and
+// the published ports; the sidecars and the main container join it, so they
+// reach each other on localhost and share /dev/shm. The shared volume, if
+// any, is mounted into all of them. Sidecars start before the main container
+// and are stopped once it exits; a sidecar that fails while the main
+// container runs stops it and fails the job.
+type jobPod struct {
+	job      *Job
+	ctx      context.Context // Runs the main container; canceled when a sidecar fails
+	cancel   context.CancelFunc
+	failure  error // First sidecar failure while the main container ran
+	stopping bool
+	watchers sync.WaitGroup
+	mu       sync.Mutex
+}
+
+// runsAsPod reports whether a Docker job needs a pod
+func runsAsPod(job *Job) bool {
+	return len(job.Payload.Sidecars) > 0 || job.Payload.SharedVolume != nil
+}
+
+// podContainerName returns the name of a pod's infrastructure container
+func podContainerName(jobID string) string {
+	return containerName(jobID) + "-pod"
+}
+
+// podVolumeName returns the name of a pod's shared volume
+func podVolumeName(jobID string) string {
+	return containerName(jobID) + "-shared"
+}
+
+// sidecarContainerName returns the name of one of a job's sidecars
+func sidecarContainerName(jobID, sidecar string) string {
+	return containerName(jobID) + "-" + sidecar
+}
+
+// mainMemoryMB is the main container's share of a job's memory. The
+// scheduler counts sidecar memory in the job's requirements, so it is
+// carved out here unless that would starve the main container.
+func mainMemoryMB(job *Job) int {
+	memoryMB := job.Requirements.MemoryMB
+	for _, sidecar := range job.Payload.Sidecars {
+		memoryMB -= sidecar.MemoryMB
+	}
+	if memoryMB < minMainMemoryMB {
+		return job.Requirements.MemoryMB
+	}
+	return memoryMB
+}
+
+// startPod creates the shared volume and the infrastructure container, then
+// starts the sidecars. On error everything already created is removed.
+func (je *JobExecutor) startPod(ctx context.Context, job *Job, workDir string) (*jobPod, error) {
+	pod := &jobPod{job: job}
+	// Containers left by a crashed agent would block the names
+	pod.remove()
+	pod.ctx, pod.cancel = context.WithCancel(ctx)
+
+	if vol := job.Payload.SharedVolume; vol != nil {
+		args := []string{"volume", "create"}
+		if vol.Medium != "disk" {
+			args = append(args, "--opt", "type=tmpfs", "--opt", "device=tmpfs", "--opt", fmt.Sprintf("o=size=%dm", vol.SizeMB))
+		}
+		if err := runDocker(ctx, append(args, podVolumeName(job.ID))...); err != nil {
+			pod.teardown()
+			return nil, fmt.Errorf("failed to create shared volume: %w", err)
+		}
+	}
+
+	// Ports are published by the container that owns the network namespace
+	infra := []string{"run", "-d", "--name", podContainerName(job.ID), "--ipc", "shareable"}
+	for _, port := range job.ExposedPorts {
+		infra = append(infra, "-p", fmt.Sprintf("127.0.0.1::%d", port.Port))
+	}
+	if err := runDocker(ctx, append(infra, podInfraImage)...); err != nil {
+		pod.teardown()
+		return nil, fmt.Errorf("failed to start pod: %w", err)
+	}
+
+	for _, sidecar := range job.Payload.Sidecars {
+		name := sidecarContainerName(job.ID, sidecar.Name)
+		args := append([]string{"run", "-d", "--name", name}, pod.joinArgs()...)
+		if sidecar.MemoryMB > 0 {
+			args = append(args, fmt.Sprintf("--memory=%dm", sidecar.MemoryMB))
+		}
+		args = append(args, "-v", fmt.Sprintf("%s:/work", workDir))
+		for _, env := range sidecar.Env {
+			args = append(args, "-e", env)
+		}
+		args = append(args, sidecar.Image)
+		args = append(args, sidecar.Command...)
+
+		if err := runDocker(ctx, args...); err != nil {
+			pod.teardown()
+			return nil, fmt.Errorf("failed to start sidecar %s: %w", sidecar.Name, err)
+		}
+		pod.watch(sidecar.Name, name)
+	}
+	return pod, nil
+}
+
+// joinArgs are the docker run flags that put a container into the pod
+func (p *jobPod) joinArgs() []string {
+	infra := "container:" + podContainerName(p.job.ID)
+	args := []string{"--network", infra, "--ipc", infra}
+	if vol := p.job.Payload.SharedVolume; vol != nil {
+		args = append(args, "-v", podVolumeName(p.job.ID)+":"+vol.MountPath)
+	}
+	return args
+}
+
+// watch waits for a sidecar to exit. A sidecar that fails before the main
+// container is done takes the main container down with it, or keeps it from
+// starting.
+func (p *jobPod) watch(sidecar, container string) {
+	p.watchers.Add(1)
+	go func() {
+		defer p.watchers.Done()
+		output, err := exec.Command("docker", "wait", container).Output()
+		if err != nil {
+			return // Removed during teardown
+		}
+		code, _ := strconv.Atoi(strings.TrimSpace(string(output)))
+		if code == 0 {
+			return
+		}
+
+		p.mu.Lock()
+		first := !p.stopping && p.failure == nil
+		if first {
+			p.failure = fmt.Errorf("sidecar %s exited with code %d", sidecar, code)
+		}
+		p.mu.Unlock()
+		if first {
+			exec.Command("docker", "stop", containerName(p.job.ID)).Run()
+			p.cancel()
+		}
+	}()
+}
+
+// stop stops the sidecars once the main container has exited and returns
+// their logs and the sidecar failure, if one ended the job
+func (p *jobPod) stop() (string, error) {
+	p.mu.Lock()
+	p.stopping = true
+	failure := p.failure
+	p.mu.Unlock()
+
+	if len(p.job.Payload.Sidecars) == 0 {
+		return "", failure
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), podCleanupTimeout)
+	defer cancel()
+
+	args := []string{"stop", "-t", strconv.Itoa(int(sidecarStopTimeout.Seconds()))}
+	for _, sidecar := range p.job.Payload.Sidecars {
+		args = append(args, sidecarContainerName(p.job.ID, sidecar.Name))
+	}
+	runDocker(ctx, args...)
+
+	var logs strings.Builder
+	for _, sidecar := range p.job.Payload.Sidecars {
+		output, _ := exec.CommandContext(ctx, "docker", "logs", sidecarContainerName(p.job.ID, sidecar.Name)).CombinedOutput()
+		fmt.Fprintf(&logs, "\n--- sidecar %s ---\n%s", sidecar.Name, output)
+	}
+	return logs.String(), failure
+}
+
+// teardown removes the pod once the job is done
+func (p *jobPod) teardown() {
+	p.remove()
+	p.watchers.Wait()
+	p.cancel()
+}
+
+// remove deletes every container of the pod, including a main container that
+// outlived a timeout, and the shared volume
+func (p *jobPod) remove() {
+	ctx, cancel := context.WithTimeout(context.Background(), podCleanupTimeout)
+	defer cancel()
+
+	containers := []string{containerName(p.job.ID), podContainerName(p.job.ID)}
+	for _, sidecar := range p.job.Payload.Sidecars {
+		containers = append(containers, sidecarContainerName(p.job.ID, sidecar.Name))
+	}
+	exec.CommandContext(ctx, "docker", append([]string{"rm", "-f"}, containers...)...).Run()
+	if p.job.Payload.SharedVolume != nil {
+		exec.CommandContext(ctx, "docker", "volume", "rm", "-f", podVolumeName(p.job.ID)).Run()
+	}
+}
+
+// runDocker runs a docker command, reporting its output on failure
+func runDocker(ctx context.Context, args ...string) error {
+	output, err := exec.CommandContext(ctx, "docker", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("docker %s: %v: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
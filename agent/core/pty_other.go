@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package core
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openPTY is only implemented on Linux; other platforms support non-TTY exec sessions
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, fmt.Errorf("interactive terminals are not supported on this platform")
+}
+
+// resizePTY is a no-op on platforms without pty support
+func resizePTY(pty *os.File, cols, rows uint16) error {
+	return nil
+}
+
+// ptySysProcAttr returns no special attributes on platforms without pty support
+func ptySysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
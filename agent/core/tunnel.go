@@ -0,0 +1,155 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// tunnelOpenRequest asks the agent to open a data connection to a job port
+type tunnelOpenRequest struct {
+	Type   string `json:"type"`
+	ConnID string `json:"conn_id"`
+	Port   int    `json:"port"`
+}
+
+// TunnelManager exposes job ports through the tunnel service. The agent
+// keeps an outbound control connection per job; whenever a consumer connects,
+// the service asks for a data connection, which the agent also dials
+// outbound, so providers never need to open inbound firewall ports.
+type TunnelManager struct {
+	agentID  string
+	client   *Client
+	executor *JobExecutor
+}
+
+// NewTunnelManager creates a new tunnel manager
+func NewTunnelManager(agentID string, client *Client, executor *JobExecutor) *TunnelManager {
+	return &TunnelManager{
+		agentID:  agentID,
+		client:   client,
+		executor: executor,
+	}
+}
+
+// Serve maintains the job's control connection until ctx is cancelled
+func (tm *TunnelManager) Serve(ctx context.Context, job *Job) {
+	exposed := make(map[int]bool, len(job.ExposedPorts))
+	for _, port := range job.ExposedPorts {
+		exposed[port.Port] = true
+	}
+
+	backoff := time.Second
+	for {
+		if err := tm.serveControl(ctx, job.ID, exposed); err != nil && ctx.Err() == nil {
+			log.Printf("Tunnel control connection for job %s lost: %v", job.ID, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// serveControl handles open requests on one control connection
+func (tm *TunnelManager) serveControl(ctx context.Context, jobID string, exposed map[int]bool) error {
+	conn, err := tm.client.DialTunnelControl(ctx, tm.agentID, jobID)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Unblock the read loop when the job ends
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var req tunnelOpenRequest
+		if err := json.Unmarshal(data, &req); err != nil || req.Type != "open" {
+			continue
+		}
+		if !exposed[req.Port] {
+			log.Printf("Tunnel for job %s requested unexposed port %d", jobID, req.Port)
+			continue
+		}
+		go tm.openData(ctx, jobID, req)
+	}
+}
+
+// openData connects a job port to a new data connection
+func (tm *TunnelManager) openData(ctx context.Context, jobID string, req tunnelOpenRequest) {
+	addr, err := tm.executor.ResolvePort(ctx, jobID, req.Port)
+	if err != nil {
+		log.Printf("Tunnel for job %s: %v", jobID, err)
+		return
+	}
+
+	local, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		log.Printf("Tunnel for job %s failed to reach %s: %v", jobID, addr, err)
+		return
+	}
+	defer local.Close()
+
+	remote, err := tm.client.DialTunnelData(ctx, jobID, req.ConnID)
+	if err != nil {
+		log.Printf("Tunnel for job %s failed to open data connection: %v", jobID, err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		// remote -> local
+		for {
+			msgType, data, err := remote.ReadMessage()
+			if err != nil {
+				break
+			}
+			if msgType != websocket.BinaryMessage {
+				continue
+			}
+			if _, err := local.Write(data); err != nil {
+				break
+			}
+		}
+		done <- struct{}{}
+	}()
+	go func() {
+		// local -> remote
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := local.Read(buf)
+			if n > 0 {
+				if writeErr := remote.WriteMessage(websocket.BinaryMessage, buf[:n]); writeErr != nil {
+					break
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					log.Printf("Tunnel for job %s read error: %v", jobID, err)
+				}
+				break
+			}
+		}
+		done <- struct{}{}
+	}()
+	<-done
+}
@@ -4,6 +4,7 @@ go 1.21
 
 require (
 	github.com/google/uuid v1.5.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/shirou/gopsutil/v3 v3.23.12
 	golang.org/x/sys v0.15.0
 )
@@ -0,0 +1,202 @@
+package agentlib
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResourceMonitor(t *testing.T) {
+	rm := NewResourceMonitor(ResourceMonitorConfig{})
+	if rm == nil {
+		t.Fatal("ResourceMonitor is nil")
+	}
+
+	// Test getting resources
+	resources := rm.GetResources()
+	if resources == nil {
+		t.Fatal("Resources is nil")
+	}
+
+	// Start monitoring in a goroutine
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go rm.Start(ctx)
+
+	// Give it time to collect initial data
+	time.Sleep(100 * time.Millisecond)
+
+	// Get resources again
+	resources = rm.GetResources()
+
+	// Basic validation - CPU should have cores
+	if resources.CPU.Cores <= 0 {
+		t.Error("CPU cores should be greater than 0")
+	}
+
+	// Memory should have total
+	if resources.Memory.Total <= 0 {
+		t.Error("Memory total should be greater than 0")
+	}
+}
+
+func TestParsePressure(t *testing.T) {
+	stall := parsePressure("some avg10=12.50 avg60=3.00 avg300=0.75 total=123456\nfull avg10=1.25 avg60=0.50 avg300=0.00 total=789\n")
+
+	if stall.SomeAvg10 != 12.5 || stall.SomeAvg60 != 3 || stall.SomeAvg300 != 0.75 {
+		t.Errorf("Unexpected some averages: %+v", stall)
+	}
+	if stall.FullAvg10 != 1.25 || stall.FullAvg60 != 0.5 {
+		t.Errorf("Unexpected full averages: %+v", stall)
+	}
+
+	// Older kernels have no full line for CPU
+	if cpu := parsePressure("some avg10=5.00 avg60=0.00 avg300=0.00 total=1\n"); cpu.SomeAvg10 != 5 || cpu.FullAvg10 != 0 {
+		t.Errorf("Unexpected CPU pressure: %+v", cpu)
+	}
+}
+
+type fakeJobSource []JobProcess
+
+func (f fakeJobSource) JobProcesses() []JobProcess { return f }
+
+func TestUsageBreakdown(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep not available")
+	}
+	cmd := exec.Command(sleep, "5")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	rm := NewResourceMonitor(ResourceMonitorConfig{
+		Jobs: fakeJobSource{{JobID: "job-1", PID: int32(cmd.Process.Pid), CPUCores: 2, MemoryMB: 512}},
+	})
+
+	// The first sample only records a baseline for CPU usage
+	rm.updateResources()
+	if rm.GetResources().Usage != nil {
+		t.Error("First sample should not report a breakdown")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	rm.updateResources()
+	usage := rm.GetResources().Usage
+	if usage == nil || len(usage.Jobs) != 1 {
+		t.Fatalf("Expected usage of one job, got %+v", usage)
+	}
+
+	job := usage.Jobs[0]
+	if job.JobID != "job-1" || job.RequestedCPUCores != 2 || job.RequestedMemoryMB != 512 {
+		t.Errorf("Unexpected job usage: %+v", job)
+	}
+	if job.MemoryBytes <= 0 {
+		t.Error("Job memory should be attributed from its process")
+	}
+	if usage.Agent.MemoryBytes <= 0 {
+		t.Error("Agent memory should be reported")
+	}
+	if usage.Background.CPUCores < 0 || usage.Background.MemoryBytes < 0 {
+		t.Errorf("Background usage should not be negative: %+v", usage.Background)
+	}
+}
+
+func TestParseROCmVersion(t *testing.T) {
+	for content, want := range map[string]string{
+		"6.0.2-115\n": "6.0.2",
+		"5.7.1":       "5.7.1",
+		" 6.1.0+rc1 ": "6.1.0",
+	} {
+		if got := parseROCmVersion(content); got != want {
+			t.Errorf("parseROCmVersion(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for ip, want := range map[string]bool{
+		"127.0.0.1":      true,
+		"127.0.0.1/8":    true,
+		"::1":            true,
+		"::1/128":        true,
+		"10.0.0.1/24":    false,
+		"2001:db8::1/64": false,
+		"not-an-ip":      false,
+	} {
+		if got := isLoopback(ip); got != want {
+			t.Errorf("isLoopback(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+type fakeExecutor struct{}
+
+func (fakeExecutor) Execute(ctx context.Context, job *Job) (*JobResult, error) {
+	return &JobResult{JobID: job.ID, Status: JobStatusCompleted, Output: "rendered"}, nil
+}
+
+func (fakeExecutor) CancelJob(jobID string) error { return nil }
+
+func (fakeExecutor) GetActiveJobs() []string { return nil }
+
+func TestProvider(t *testing.T) {
+	results := make(chan JobResult, 1)
+	var served bool
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "RenderFarm/2.1" {
+			t.Errorf("Unexpected user agent %q", r.Header.Get("User-Agent"))
+		}
+		switch r.URL.Path {
+		case "/api/v1/agents/farm-1/jobs":
+			mu.Lock()
+			jobs := []*Job{}
+			if !served {
+				jobs = append(jobs, &Job{ID: "job-1", Type: JobTypeScript})
+				served = true
+			}
+			mu.Unlock()
+			json.NewEncoder(w).Encode(jobs)
+		case "/api/v1/jobs/job-1/result":
+			var result JobResult
+			json.NewDecoder(r.Body).Decode(&result)
+			results <- result
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewClient(ClientConfig{ControlPlaneURL: server.URL, Token: "token", UserAgent: "RenderFarm/2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider, err := NewProvider(ProviderConfig{
+		AgentID:            "farm-1",
+		Client:             client,
+		Executor:           fakeExecutor{},
+		JobPollingInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go provider.Run(ctx)
+
+	select {
+	case result := <-results:
+		if result.AgentID != "farm-1" || result.Status != JobStatusCompleted || result.ProtocolVersion != ProtocolVersion {
+			t.Errorf("Unexpected job result: %+v", result)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Job result was not reported")
+	}
+}
@@ -0,0 +1,382 @@
+package agentlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ClientConfig is how a client reaches the control plane
+type ClientConfig struct {
+	ControlPlaneURL string
+	TunnelURL       string // Relay for exposed ports, the control plane when empty
+	Token           string // Agent credentials; set by Register once enrollment is approved
+	UserAgent       string // Identifies the embedding software, ComputeHive-Agent/<Version> when empty
+}
+
+// Client handles communication with the control plane
+type Client struct {
+	baseURL    string
+	tunnelURL  string // Relay for exposed ports
+	userAgent  string
+	httpClient *http.Client
+	token      string
+}
+
+// NewClient creates a new control plane client
+func NewClient(config ClientConfig) (*Client, error) {
+	if config.ControlPlaneURL == "" {
+		return nil, fmt.Errorf("control plane URL is required")
+	}
+	tunnelURL := config.TunnelURL
+	if tunnelURL == "" {
+		tunnelURL = config.ControlPlaneURL
+	}
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = fmt.Sprintf("ComputeHive-Agent/%s", Version)
+	}
+	return &Client{
+		baseURL:   config.ControlPlaneURL,
+		tunnelURL: tunnelURL,
+		userAgent: userAgent,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+		token: config.Token,
+	}, nil
+}
+
+// Register registers the agent with the control plane
+func (c *Client) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	var resp RegisterResponse
+	err := c.doRequest(ctx, "POST", "/api/v1/agents/register", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Agents enrolling with a join token get credentials only once approved
+	if resp.Token != "" {
+		c.token = resp.Token
+	}
+
+	return &resp, nil
+}
+
+// GetEnrollmentCredentials checks an enrollment, returning credentials once
+// the agent is approved
+func (c *Client) GetEnrollmentCredentials(ctx context.Context, agentID, secret string) (*RegisterResponse, error) {
+	var resp RegisterResponse
+	endpoint := fmt.Sprintf("/api/v1/agents/enrollments/%s/credentials", agentID)
+	body := map[string]interface{}{"enrollment_secret": secret, "protocol_versions": SupportedProtocolVersions}
+	err := c.doRequest(ctx, "POST", endpoint, body, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Token != "" {
+		c.token = resp.Token
+	}
+
+	return &resp, nil
+}
+
+// Deregister removes the agent from the control plane
+func (c *Client) Deregister(ctx context.Context, agentID string) error {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/deregister", agentID)
+	return c.doRequest(ctx, "POST", endpoint, nil, nil)
+}
+
+// SendHeartbeat sends a heartbeat to the control plane
+func (c *Client) SendHeartbeat(ctx context.Context, heartbeat *Heartbeat) error {
+	heartbeat.ProtocolVersion = ProtocolVersion
+	return c.doRequest(ctx, "POST", "/api/v1/agents/heartbeat", heartbeat, nil)
+}
+
+// ReflectAddress returns the address the control plane sees the agent
+// connect from
+func (c *Client) ReflectAddress(ctx context.Context, agentID string) (string, error) {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/reflect", agentID)
+	var resp struct {
+		Address string `json:"address"`
+	}
+	err := c.doRequest(ctx, "GET", endpoint, nil, &resp)
+	return resp.Address, err
+}
+
+// GetJobs retrieves available jobs for the agent
+func (c *Client) GetJobs(ctx context.Context, agentID string) ([]*Job, error) {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/jobs", agentID)
+	var jobs []*Job
+	err := c.doRequest(ctx, "GET", endpoint, nil, &jobs)
+	return jobs, err
+}
+
+// ReportJobResult reports the result of a job execution
+func (c *Client) ReportJobResult(ctx context.Context, result *JobResult) error {
+	result.ProtocolVersion = ProtocolVersion
+	endpoint := fmt.Sprintf("/api/v1/jobs/%s/result", result.JobID)
+	return c.doRequest(ctx, "POST", endpoint, result, nil)
+}
+
+// ReportJobWarning raises a warning about a running job to its owner
+func (c *Client) ReportJobWarning(ctx context.Context, agentID, jobID string, warning *JobWarning) error {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/jobs/%s/warnings", agentID, jobID)
+	return c.doRequest(ctx, "POST", endpoint, warning, nil)
+}
+
+// ReportJobProgress reports how far a running job has got to its owner
+func (c *Client) ReportJobProgress(ctx context.Context, agentID, jobID string, progress *JobProgress) error {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/jobs/%s/progress", agentID, jobID)
+	return c.doRequest(ctx, "POST", endpoint, progress, nil)
+}
+
+// ReportJobLogs sends lines a running job wrote to its owner's log tail
+func (c *Client) ReportJobLogs(ctx context.Context, agentID, jobID string, lines []JobLogLine) error {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/jobs/%s/logs", agentID, jobID)
+	return c.doRequest(ctx, "POST", endpoint, lines, nil)
+}
+
+// ReportMetrics sends metrics to the control plane
+func (c *Client) ReportMetrics(ctx context.Context, metrics *MetricsReport) error {
+	return c.doRequest(ctx, "POST", "/api/v1/agents/metrics", metrics, nil)
+}
+
+// GetExecSessions retrieves exec sessions waiting for the agent to attach
+func (c *Client) GetExecSessions(ctx context.Context, agentID string) ([]*ExecSession, error) {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/exec-sessions", agentID)
+	var sessions []*ExecSession
+	err := c.doRequest(ctx, "GET", endpoint, nil, &sessions)
+	return sessions, err
+}
+
+// GetDiagnosticsRequests retrieves diagnostics bundles the control plane requested
+func (c *Client) GetDiagnosticsRequests(ctx context.Context, agentID string) ([]*DiagnosticsRequest, error) {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/diagnostics/pending", agentID)
+	var requests []*DiagnosticsRequest
+	err := c.doRequest(ctx, "GET", endpoint, nil, &requests)
+	return requests, err
+}
+
+// UploadDiagnostics uploads an encrypted diagnostics bundle
+func (c *Client) UploadDiagnostics(ctx context.Context, agentID, requestID string, bundle []byte) error {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/diagnostics/%s/bundle", agentID, requestID)
+	req, err := http.NewRequestWithContext(ctx, "PUT", c.baseURL+endpoint, bytes.NewReader(bundle))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// ReportDiagnosticsFailure tells the control plane a bundle could not be collected
+func (c *Client) ReportDiagnosticsFailure(ctx context.Context, agentID, requestID, reason string) error {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/diagnostics/%s/failure", agentID, requestID)
+	return c.doRequest(ctx, "POST", endpoint, map[string]string{"error": reason}, nil)
+}
+
+// GetJobResizes retrieves resizes of running jobs the agent has yet to apply
+func (c *Client) GetJobResizes(ctx context.Context, agentID string) ([]*JobResize, error) {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/resizes/pending", agentID)
+	var resizes []*JobResize
+	err := c.doRequest(ctx, "GET", endpoint, nil, &resizes)
+	return resizes, err
+}
+
+// ReportJobResize tells the control plane whether a resize was applied
+func (c *Client) ReportJobResize(ctx context.Context, agentID, resizeID string, applied bool, reason string) error {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/resizes/%s/result", agentID, resizeID)
+	body := map[string]interface{}{"applied": applied, "error": reason}
+	return c.doRequest(ctx, "POST", endpoint, body, nil)
+}
+
+// GetConfigAssignment retrieves the fleet config profile assigned to the agent
+func (c *Client) GetConfigAssignment(ctx context.Context, agentID string) (*ConfigAssignment, error) {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/config", agentID)
+	var assignment ConfigAssignment
+	err := c.doRequest(ctx, "GET", endpoint, nil, &assignment)
+	return &assignment, err
+}
+
+// ReportConfigStatus reports whether a config profile revision was applied
+func (c *Client) ReportConfigStatus(ctx context.Context, agentID string, status *ConfigStatus) error {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/config/status", agentID)
+	return c.doRequest(ctx, "POST", endpoint, status, nil)
+}
+
+// DialExecSession opens the agent side of an exec session stream
+func (c *Client) DialExecSession(ctx context.Context, agentID, sessionID string) (*websocket.Conn, error) {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/exec-sessions/%s/attach", agentID, sessionID)
+	return c.dialWebSocket(ctx, c.baseURL, endpoint)
+}
+
+// DialControl opens the agent's control channel, over which the control
+// plane pushes fleet config profile changes
+func (c *Client) DialControl(ctx context.Context, agentID string) (*websocket.Conn, error) {
+	endpoint := fmt.Sprintf("/api/v1/agents/%s/control", agentID)
+	return c.dialWebSocket(ctx, c.baseURL, endpoint)
+}
+
+// DialTunnelControl opens the control connection for a job's port tunnel
+func (c *Client) DialTunnelControl(ctx context.Context, agentID, jobID string) (*websocket.Conn, error) {
+	endpoint := fmt.Sprintf("/api/v1/tunnels/%s/control?agent_id=%s", jobID, agentID)
+	return c.dialWebSocket(ctx, c.tunnelURL, endpoint)
+}
+
+// DialTunnelData opens a data connection requested by the tunnel service
+func (c *Client) DialTunnelData(ctx context.Context, jobID, connID string) (*websocket.Conn, error) {
+	endpoint := fmt.Sprintf("/api/v1/tunnels/%s/data/%s", jobID, connID)
+	return c.dialWebSocket(ctx, c.tunnelURL, endpoint)
+}
+
+// dialWebSocket opens an authenticated WebSocket to the control plane or
+// the tunnel relay
+func (c *Client) dialWebSocket(ctx context.Context, baseURL, endpoint string) (*websocket.Conn, error) {
+	wsURL := baseURL
+	if strings.HasPrefix(wsURL, "https://") {
+		wsURL = "wss://" + strings.TrimPrefix(wsURL, "https://")
+	} else {
+		wsURL = "ws://" + strings.TrimPrefix(wsURL, "http://")
+	}
+	wsURL += endpoint
+
+	header := http.Header{}
+	header.Set("User-Agent", c.userAgent)
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("websocket dial failed with status %d: %w", resp.StatusCode, err)
+		}
+		return nil, fmt.Errorf("websocket dial failed: %w", err)
+	}
+	return conn, nil
+}
+
+// doRequest performs an HTTP request
+func (c *Client) doRequest(ctx context.Context, method, endpoint string, body, result interface{}) error {
+	url := c.baseURL + endpoint
+
+	var bodyReader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		bodyReader = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	// Execute request
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Check status code
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Decode response if needed
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// UploadArtifact uploads a job artifact
+func (c *Client) UploadArtifact(ctx context.Context, jobID string, artifact *JobArtifact, data io.Reader) error {
+	endpoint := fmt.Sprintf("/api/v1/jobs/%s/artifacts", jobID)
+
+	// In a real implementation, this would use multipart/form-data
+	// For now, we'll use a simplified approach
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+endpoint, data)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("X-Artifact-Name", artifact.Name)
+	req.Header.Set("X-Artifact-Size", fmt.Sprintf("%d", artifact.Size))
+	req.Header.Set("Content-Type", artifact.MimeType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// DownloadJobData downloads input data for a job
+func (c *Client) DownloadJobData(ctx context.Context, jobID string, dest io.Writer) error {
+	endpoint := fmt.Sprintf("/api/v1/jobs/%s/data", jobID)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("download failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	_, err = io.Copy(dest, resp.Body)
+	return err
+}
@@ -0,0 +1,30 @@
+// Package agentlib embeds ComputeHive capacity-provider functionality in
+// other software, such as a render farm manager that offers idle nodes to
+// ComputeHive instead of running the standalone agent next to itself.
+//
+// It holds the agent's control-plane Client and wire types, the Executor
+// interface jobs are run through, and the ResourceMonitor that samples the
+// host for heartbeats. A Provider ties them together:
+//
+//	client, err := agentlib.NewClient(agentlib.ClientConfig{
+//		ControlPlaneURL: "https://api.computehive.io",
+//		Token:           token,
+//		UserAgent:       "RenderFarm/2.1",
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	provider, err := agentlib.NewProvider(agentlib.ProviderConfig{
+//		AgentID:           agentID,
+//		Client:            client,
+//		Executor:          farmExecutor, // Implements agentlib.Executor
+//		MaxConcurrentJobs: 4,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	return provider.Run(ctx)
+//
+// The standalone agent in github.com/computehive/agent/core is built on the
+// same client, types and resource monitor.
+package agentlib
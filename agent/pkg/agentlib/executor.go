@@ -0,0 +1,37 @@
+package agentlib
+
+import (
+	"context"
+)
+
+// Executor runs the jobs the control plane assigns to an agent. The
+// standalone agent runs Docker, binary, script and WASM jobs; software
+// embedding ComputeHive can hand jobs to its own scheduler instead, such as
+// a render farm queue.
+type Executor interface {
+	// Execute runs a job to completion, returning its result. An error means
+	// the job could not be run at all and is reported as failed.
+	Execute(ctx context.Context, job *Job) (*JobResult, error)
+
+	// CancelJob stops a running job
+	CancelJob(jobID string) error
+
+	// GetActiveJobs returns the IDs of running jobs
+	GetActiveJobs() []string
+}
+
+// JobProcess identifies what a running job runs as, so its usage can be
+// told apart from the rest of the host
+type JobProcess struct {
+	JobID       string
+	PID         int32  // Root process of binary and script jobs
+	ContainerID string // Docker jobs, once the container was created
+	CPUCores    int    // Requested
+	MemoryMB    int    // Requested
+}
+
+// JobProcessSource reports the processes of running jobs. Executors that
+// implement it have their jobs' usage split out in resource reports.
+type JobProcessSource interface {
+	JobProcesses() []JobProcess
+}
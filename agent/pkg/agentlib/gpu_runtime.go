@@ -0,0 +1,103 @@
+package agentlib
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// gpuRuntimeRefreshInterval is how often driver and runtime versions are
+// read again. They only change when the host is upgraded, and reading them
+// runs nvidia-smi or rocm-smi.
+const gpuRuntimeRefreshInterval = 10 * time.Minute
+
+// rocmVersionFile is where ROCm installs record their version
+const rocmVersionFile = "/opt/rocm/.info/version"
+
+// cudaVersionPattern extracts the CUDA version from the nvidia-smi banner
+var cudaVersionPattern = regexp.MustCompile(`CUDA Version:\s*([0-9.]+)`)
+
+// rocmDriverPattern extracts the amdgpu driver version from rocm-smi
+var rocmDriverPattern = regexp.MustCompile(`Driver version:\s*([0-9.]+)`)
+
+// GPURuntime is the GPU driver and compute runtime installed on the agent.
+// The scheduler only places jobs here whose minimum versions it meets.
+type GPURuntime struct {
+	DriverVersion string `json:"driver_version,omitempty"`
+	CUDAVersion   string `json:"cuda_version,omitempty"` // Highest CUDA version the driver supports
+	ROCmVersion   string `json:"rocm_version,omitempty"`
+}
+
+// DetectGPURuntime reads the installed NVIDIA or AMD driver and the CUDA or
+// ROCm version it supports, or returns nil when neither is installed
+func DetectGPURuntime(ctx context.Context) *GPURuntime {
+	versions := &GPURuntime{}
+	if driver := firstLine(runTool(ctx, "nvidia-smi", "--query-gpu=driver_version", "--format=csv,noheader")); driver != "" {
+		versions.DriverVersion = driver
+		if m := cudaVersionPattern.FindStringSubmatch(runTool(ctx, "nvidia-smi")); m != nil {
+			versions.CUDAVersion = m[1]
+		}
+	}
+	if data, err := os.ReadFile(rocmVersionFile); err == nil {
+		versions.ROCmVersion = parseROCmVersion(string(data))
+	}
+	if versions.DriverVersion == "" && versions.ROCmVersion != "" {
+		if m := rocmDriverPattern.FindStringSubmatch(runTool(ctx, "rocm-smi", "--showdriverversion")); m != nil {
+			versions.DriverVersion = m[1]
+		}
+	}
+
+	if *versions == (GPURuntime{}) {
+		return nil
+	}
+	return versions
+}
+
+// parseROCmVersion trims the build suffix from a ROCm version file, so
+// 6.0.2-115 reads as 6.0.2
+func parseROCmVersion(content string) string {
+	version := strings.TrimSpace(content)
+	if i := strings.IndexAny(version, "-+ \n"); i >= 0 {
+		version = version[:i]
+	}
+	return version
+}
+
+// getGPURuntime returns the agent's GPU runtime, reading it again once it is
+// older than gpuRuntimeRefreshInterval. Hosts without GPUs report none.
+func (rm *ResourceMonitor) getGPURuntime(gpus []GPUInfo, now time.Time) *GPURuntime {
+	if len(gpus) == 0 {
+		return nil
+	}
+	if rm.gpuRuntimeAt.IsZero() || now.Sub(rm.gpuRuntimeAt) >= gpuRuntimeRefreshInterval {
+		rm.gpuRuntime = DetectGPURuntime(context.Background())
+		rm.gpuRuntimeAt = now
+	}
+	return rm.gpuRuntime
+}
+
+// runTool runs a GPU vendor tool with a short timeout and returns its
+// output, or "" if it is missing or fails
+func runTool(ctx context.Context, name string, args ...string) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	return string(output)
+}
+
+// firstLine returns the first non-empty line of a tool's output
+func firstLine(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
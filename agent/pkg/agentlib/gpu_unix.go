@@ -0,0 +1,165 @@
+//go:build !windows
+// +build !windows
+
+package agentlib
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// DetectGPUs detects available GPUs on the system
+func DetectGPUs() []GPUInfo {
+	var gpus []GPUInfo
+
+	// Try NVIDIA GPUs
+	if nvidiaGPUs := detectNVIDIAGPUs(); len(nvidiaGPUs) > 0 {
+		gpus = append(gpus, nvidiaGPUs...)
+	}
+
+	// Try AMD GPUs
+	if amdGPUs := detectAMDGPUs(); len(amdGPUs) > 0 {
+		gpus = append(gpus, amdGPUs...)
+	}
+
+	// Try Intel GPUs (for integrated graphics)
+	if intelGPUs := detectIntelGPUs(); len(intelGPUs) > 0 {
+		gpus = append(gpus, intelGPUs...)
+	}
+
+	return gpus
+}
+
+// detectNVIDIAGPUs detects NVIDIA GPUs using nvidia-smi
+func detectNVIDIAGPUs() []GPUInfo {
+	var gpus []GPUInfo
+
+	// Check if nvidia-smi is available
+	output, err := exec.Command("nvidia-smi", "--query-gpu=index,name,memory.total,utilization.gpu,temperature.gpu,power.draw,uuid,memory.used", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return gpus
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	for _, line := range lines {
+		parts := strings.Split(line, ", ")
+		if len(parts) >= 6 {
+			gpu := GPUInfo{
+				ID:     parts[0],
+				Model:  parts[1],
+				Vendor: "NVIDIA",
+			}
+
+			// Parse memory (in MB)
+			if _, err := fmt.Sscanf(parts[2], "%d", &gpu.MemoryMB); err != nil {
+				gpu.MemoryMB = 0
+			}
+
+			// Parse usage
+			if _, err := fmt.Sscanf(parts[3], "%f", &gpu.Usage); err != nil {
+				gpu.Usage = 0
+			}
+
+			// Parse temperature
+			if _, err := fmt.Sscanf(parts[4], "%f", &gpu.Temperature); err != nil {
+				gpu.Temperature = 0
+			}
+
+			// Parse power
+			if _, err := fmt.Sscanf(parts[5], "%f", &gpu.PowerWatts); err != nil {
+				gpu.PowerWatts = 0
+			}
+
+			// UUID matches GPUs to the processes running on them
+			if len(parts) >= 8 {
+				gpu.UUID = parts[6]
+				if _, err := fmt.Sscanf(parts[7], "%d", &gpu.MemoryUsedMB); err != nil {
+					gpu.MemoryUsedMB = 0
+				}
+			}
+
+			gpus = append(gpus, gpu)
+		}
+	}
+
+	return gpus
+}
+
+// detectGPUProcesses lists the compute processes running on NVIDIA GPUs
+func detectGPUProcesses() []gpuProcess {
+	var procs []gpuProcess
+
+	output, err := exec.Command("nvidia-smi", "--query-compute-apps=pid,gpu_uuid,used_memory", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return procs
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.Split(line, ", ")
+		if len(parts) < 3 {
+			continue
+		}
+		proc := gpuProcess{GPUUUID: parts[1]}
+		if _, err := fmt.Sscanf(parts[0], "%d", &proc.PID); err != nil {
+			continue
+		}
+		// Memory is "[N/A]" without permission to query other users' processes
+		fmt.Sscanf(parts[2], "%d", &proc.MemoryMB)
+		procs = append(procs, proc)
+	}
+
+	return procs
+}
+
+// detectAMDGPUs detects AMD GPUs using rocm-smi
+func detectAMDGPUs() []GPUInfo {
+	var gpus []GPUInfo
+
+	// Check if rocm-smi is available
+	output, err := exec.Command("rocm-smi", "--showid", "--showproductname", "--showmeminfo", "vram", "--showuse", "--showtemp", "--showpower").Output()
+	if err != nil {
+		return gpus
+	}
+
+	// Parse rocm-smi output (simplified)
+	// In a real implementation, this would need proper parsing
+	lines := strings.Split(string(output), "\n")
+	for i, line := range lines {
+		if strings.Contains(line, "GPU[") {
+			gpu := GPUInfo{
+				ID:     fmt.Sprintf("%d", i),
+				Vendor: "AMD",
+				Model:  "AMD GPU", // Would need to parse actual model
+			}
+			gpus = append(gpus, gpu)
+		}
+	}
+
+	return gpus
+}
+
+// detectIntelGPUs detects Intel integrated GPUs
+func detectIntelGPUs() []GPUInfo {
+	var gpus []GPUInfo
+
+	// On Linux, check for Intel GPU in /sys
+	if runtime.GOOS == "linux" {
+		if _, err := os.Stat("/sys/class/drm/card0"); err == nil {
+			// Check if it's Intel
+			vendor, _ := os.ReadFile("/sys/class/drm/card0/device/vendor")
+			if strings.TrimSpace(string(vendor)) == "0x8086" { // Intel vendor ID
+				gpu := GPUInfo{
+					ID:     "0",
+					Vendor: "Intel",
+					Model:  "Intel Integrated Graphics",
+				}
+				gpus = append(gpus, gpu)
+			}
+		}
+	}
+
+	return gpus
+}
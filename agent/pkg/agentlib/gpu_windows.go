@@ -0,0 +1,135 @@
+//go:build windows
+// +build windows
+
+package agentlib
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// DetectGPUs detects available GPUs on Windows
+func DetectGPUs() []GPUInfo {
+	var gpus []GPUInfo
+
+	// Try NVIDIA GPUs
+	if nvidiaGPUs := detectNVIDIAGPUs(); len(nvidiaGPUs) > 0 {
+		gpus = append(gpus, nvidiaGPUs...)
+	}
+
+	// Try AMD GPUs (would need Windows-specific implementation)
+	// For now, we'll use WMI to detect GPUs
+	if wmiGPUs := detectGPUsViaWMI(); len(wmiGPUs) > 0 {
+		gpus = append(gpus, wmiGPUs...)
+	}
+
+	return gpus
+}
+
+// detectGPUProcesses is not implemented on Windows, so GPU memory is not
+// attributed to jobs there
+func detectGPUProcesses() []gpuProcess {
+	return nil
+}
+
+// detectNVIDIAGPUs detects NVIDIA GPUs using nvidia-smi on Windows
+func detectNVIDIAGPUs() []GPUInfo {
+	var gpus []GPUInfo
+
+	// nvidia-smi is typically in C:\Program Files\NVIDIA Corporation\NVSMI\
+	nvidiaSMIPath := `C:\Program Files\NVIDIA Corporation\NVSMI\nvidia-smi.exe`
+
+	// Check if nvidia-smi exists
+	if _, err := os.Stat(nvidiaSMIPath); err != nil {
+		// Try in PATH
+		nvidiaSMIPath = "nvidia-smi"
+	}
+
+	output, err := exec.Command(nvidiaSMIPath, "--query-gpu=index,name,memory.total,utilization.gpu,temperature.gpu,power.draw", "--format=csv,noheader,nounits").Output()
+	if err != nil {
+		return gpus
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	for _, line := range lines {
+		parts := strings.Split(line, ", ")
+		if len(parts) >= 6 {
+			gpu := GPUInfo{
+				ID:     parts[0],
+				Model:  parts[1],
+				Vendor: "NVIDIA",
+			}
+
+			// Parse memory (in MB)
+			if _, err := fmt.Sscanf(parts[2], "%d", &gpu.MemoryMB); err != nil {
+				gpu.MemoryMB = 0
+			}
+
+			// Parse usage
+			if _, err := fmt.Sscanf(parts[3], "%f", &gpu.Usage); err != nil {
+				gpu.Usage = 0
+			}
+
+			// Parse temperature
+			if _, err := fmt.Sscanf(parts[4], "%f", &gpu.Temperature); err != nil {
+				gpu.Temperature = 0
+			}
+
+			// Parse power
+			if _, err := fmt.Sscanf(parts[5], "%f", &gpu.PowerWatts); err != nil {
+				gpu.PowerWatts = 0
+			}
+
+			gpus = append(gpus, gpu)
+		}
+	}
+
+	return gpus
+}
+
+// detectGPUsViaWMI uses WMI to detect GPUs on Windows
+func detectGPUsViaWMI() []GPUInfo {
+	var gpus []GPUInfo
+
+	// Use WMIC to query video controllers
+	output, err := exec.Command("wmic", "path", "win32_VideoController", "get", "Name,AdapterRAM", "/format:csv").Output()
+	if err != nil {
+		return gpus
+	}
+
+	lines := strings.Split(string(output), "\n")
+	for i, line := range lines {
+		// Skip header and empty lines
+		if i < 2 || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		parts := strings.Split(line, ",")
+		if len(parts) >= 3 {
+			memoryBytes := 0
+			fmt.Sscanf(parts[1], "%d", &memoryBytes)
+
+			gpu := GPUInfo{
+				ID:       fmt.Sprintf("%d", i-2),
+				Model:    strings.TrimSpace(parts[2]),
+				MemoryMB: memoryBytes / (1024 * 1024),
+			}
+
+			// Determine vendor from model name
+			modelLower := strings.ToLower(gpu.Model)
+			if strings.Contains(modelLower, "nvidia") {
+				gpu.Vendor = "NVIDIA"
+			} else if strings.Contains(modelLower, "amd") || strings.Contains(modelLower, "radeon") {
+				gpu.Vendor = "AMD"
+			} else if strings.Contains(modelLower, "intel") {
+				gpu.Vendor = "Intel"
+			}
+
+			gpus = append(gpus, gpu)
+		}
+	}
+
+	return gpus
+}
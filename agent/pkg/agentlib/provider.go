@@ -0,0 +1,190 @@
+package agentlib
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Provider defaults, matching the standalone agent
+const (
+	defaultHeartbeatInterval  = 30 * time.Second
+	defaultJobPollingInterval = 10 * time.Second
+)
+
+// ProviderConfig configures an embedded capacity provider
+type ProviderConfig struct {
+	AgentID            string           // Identity the client's credentials were issued to
+	Client             *Client          // Holding the agent's credentials
+	Executor           Executor         // Runs assigned jobs
+	Resources          *ResourceMonitor // Created from the executor when nil
+	Labels             Labels           // Select fleet config profiles
+	MaxConcurrentJobs  int              // 1 when zero
+	HeartbeatInterval  time.Duration    // 30s when zero
+	JobPollingInterval time.Duration    // 10s when zero
+}
+
+// Provider offers a machine's capacity to ComputeHive from inside another
+// program. It reports resources in heartbeats, polls for jobs while below
+// MaxConcurrentJobs and hands them to the executor, reporting each result.
+//
+// The client must already hold credentials, from a provisioned token or an
+// approved enrollment through Client.Register. Exec sessions, diagnostics,
+// resizes, port tunnels and fleet config profiles are features of the
+// standalone agent and are not served.
+type Provider struct {
+	config    ProviderConfig
+	resources *ResourceMonitor
+	metrics   *AgentMetrics
+	running   int // Jobs handed to the executor and not yet reported
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+}
+
+// NewProvider creates a provider from its config
+func NewProvider(config ProviderConfig) (*Provider, error) {
+	if config.AgentID == "" || config.Client == nil || config.Executor == nil {
+		return nil, fmt.Errorf("agent ID, client and executor are required")
+	}
+	if config.MaxConcurrentJobs <= 0 {
+		config.MaxConcurrentJobs = 1
+	}
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if config.JobPollingInterval <= 0 {
+		config.JobPollingInterval = defaultJobPollingInterval
+	}
+
+	resources := config.Resources
+	if resources == nil {
+		jobs, _ := config.Executor.(JobProcessSource)
+		resources = NewResourceMonitor(ResourceMonitorConfig{Jobs: jobs})
+	}
+	return &Provider{
+		config:    config,
+		resources: resources,
+		metrics:   NewAgentMetrics(),
+	}, nil
+}
+
+// Run serves the control plane until ctx is cancelled, then waits for
+// running jobs to be reported. It does not deregister the agent.
+func (p *Provider) Run(ctx context.Context) error {
+	go p.resources.Start(ctx)
+
+	heartbeats := time.NewTicker(p.config.HeartbeatInterval)
+	defer heartbeats.Stop()
+	polls := time.NewTicker(p.config.JobPollingInterval)
+	defer polls.Stop()
+
+	for {
+		select {
+		case <-heartbeats.C:
+			if err := p.sendHeartbeat(ctx); err != nil {
+				log.Printf("Failed to send heartbeat: %v", err)
+				p.mu.Lock()
+				p.metrics.IncrementHeartbeatFailures()
+				p.mu.Unlock()
+			}
+		case <-polls.C:
+			if err := p.pollJobs(ctx); err != nil {
+				log.Printf("Failed to poll jobs: %v", err)
+			}
+		case <-ctx.Done():
+			p.wg.Wait()
+			return nil
+		}
+	}
+}
+
+// Resources returns the provider's latest resource snapshot
+func (p *Provider) Resources() *Resources {
+	return p.resources.GetResources()
+}
+
+// sendHeartbeat reports the provider's status and resources
+func (p *Provider) sendHeartbeat(ctx context.Context) error {
+	p.mu.Lock()
+	status := AgentStatusActive
+	if p.running >= p.config.MaxConcurrentJobs {
+		status = AgentStatusBusy
+	}
+	metrics := p.metrics.GetSnapshot()
+	p.mu.Unlock()
+
+	return p.config.Client.SendHeartbeat(ctx, &Heartbeat{
+		AgentID:    p.config.AgentID,
+		Timestamp:  time.Now(),
+		Status:     status,
+		Resources:  p.resources.GetResources(),
+		ActiveJobs: p.config.Executor.GetActiveJobs(),
+		Metrics:    metrics,
+		Labels:     p.config.Labels,
+	})
+}
+
+// pollJobs starts the jobs assigned to the provider while it has capacity
+func (p *Provider) pollJobs(ctx context.Context) error {
+	p.mu.Lock()
+	full := p.running >= p.config.MaxConcurrentJobs
+	p.mu.Unlock()
+	if full {
+		return nil
+	}
+
+	jobs, err := p.config.Client.GetJobs(ctx, p.config.AgentID)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		p.mu.Lock()
+		p.running++
+		p.metrics.IncrementJobsStarted()
+		p.mu.Unlock()
+
+		p.wg.Add(1)
+		go p.runJob(ctx, job)
+	}
+	return nil
+}
+
+// runJob executes a job and reports its result
+func (p *Provider) runJob(ctx context.Context, job *Job) {
+	defer p.wg.Done()
+	defer func() {
+		p.mu.Lock()
+		p.running--
+		p.mu.Unlock()
+	}()
+
+	result, err := p.config.Executor.Execute(ctx, job)
+	if err != nil {
+		log.Printf("Failed to execute job %s: %v", job.ID, err)
+		result = &JobResult{
+			JobID:     job.ID,
+			Status:    JobStatusFailed,
+			Error:     err.Error(),
+			Timestamp: time.Now(),
+		}
+	}
+	result.AgentID = p.config.AgentID
+
+	p.mu.Lock()
+	if result.Status == JobStatusCompleted {
+		p.metrics.IncrementJobsCompleted()
+	} else {
+		p.metrics.IncrementJobsFailed()
+	}
+	p.mu.Unlock()
+
+	// Results are reported even once ctx is cancelled, so jobs are not left
+	// running on the control plane's books
+	reportCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := p.config.Client.ReportJobResult(reportCtx, result); err != nil {
+		log.Printf("Failed to report result of job %s: %v", job.ID, err)
+	}
+}
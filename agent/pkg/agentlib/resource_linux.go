@@ -0,0 +1,128 @@
+//go:build linux
+// +build linux
+
+package agentlib
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readPressure reads pressure stall information, or returns nil when the
+// kernel does not expose it (before 4.20, or booted with psi=0)
+func readPressure() *PressureInfo {
+	cpu, err := os.ReadFile("/proc/pressure/cpu")
+	if err != nil {
+		return nil
+	}
+	info := &PressureInfo{CPU: parsePressure(string(cpu))}
+	if memory, err := os.ReadFile("/proc/pressure/memory"); err == nil {
+		info.Memory = parsePressure(string(memory))
+	}
+	if io, err := os.ReadFile("/proc/pressure/io"); err == nil {
+		info.IO = parsePressure(string(io))
+	}
+	return info
+}
+
+// containerCgroupDirs are where Docker places a container's cgroup with the
+// systemd and cgroupfs drivers, for cgroup v2 and the v1 cpuacct and memory
+// hierarchies
+var containerCgroupDirs = struct{ v2, v1CPU, v1Memory []string }{
+	v2: []string{
+		"/sys/fs/cgroup/system.slice/docker-%s.scope",
+		"/sys/fs/cgroup/docker/%s",
+	},
+	v1CPU: []string{
+		"/sys/fs/cgroup/cpuacct/system.slice/docker-%s.scope",
+		"/sys/fs/cgroup/cpuacct/docker/%s",
+	},
+	v1Memory: []string{
+		"/sys/fs/cgroup/memory/system.slice/docker-%s.scope",
+		"/sys/fs/cgroup/memory/docker/%s",
+	},
+}
+
+// ContainerUsage reads a container's cumulative CPU seconds and its memory
+// use from its cgroup. Memory excludes inactive page cache, as docker stats
+// does.
+func ContainerUsage(containerID string) (cpuSeconds float64, memoryBytes int64, ok bool) {
+	if dir := findCgroupDir(containerCgroupDirs.v2, containerID); dir != "" {
+		usec, err := readCgroupStat(filepath.Join(dir, "cpu.stat"), "usage_usec")
+		if err != nil {
+			return 0, 0, false
+		}
+		current, _ := readCgroupValue(filepath.Join(dir, "memory.current"))
+		inactive, _ := readCgroupStat(filepath.Join(dir, "memory.stat"), "inactive_file")
+		return float64(usec) / 1e6, nonNegative(current - inactive), true
+	}
+
+	cpuDir := findCgroupDir(containerCgroupDirs.v1CPU, containerID)
+	if cpuDir == "" {
+		return 0, 0, false
+	}
+	nsec, err := readCgroupValue(filepath.Join(cpuDir, "cpuacct.usage"))
+	if err != nil {
+		return 0, 0, false
+	}
+	if memDir := findCgroupDir(containerCgroupDirs.v1Memory, containerID); memDir != "" {
+		usage, _ := readCgroupValue(filepath.Join(memDir, "memory.usage_in_bytes"))
+		inactive, _ := readCgroupStat(filepath.Join(memDir, "memory.stat"), "total_inactive_file")
+		memoryBytes = nonNegative(usage - inactive)
+	}
+	return float64(nsec) / 1e9, memoryBytes, true
+}
+
+// pidInContainer reports whether a process belongs to a container's cgroup
+func pidInContainer(pid int32, containerID string) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+	return err == nil && strings.Contains(string(data), containerID)
+}
+
+func findCgroupDir(patterns []string, containerID string) string {
+	for _, pattern := range patterns {
+		dir := fmt.Sprintf(pattern, containerID)
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+// readCgroupValue reads a cgroup file holding a single number
+func readCgroupValue(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readCgroupStat reads one key of a cgroup file of "key value" lines
+func readCgroupStat(path, key string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == key {
+			return strconv.ParseInt(value, 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("%s has no %s", path, key)
+}
+
+func nonNegative(v int64) int64 {
+	if v < 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,341 @@
+package agentlib
+
+import (
+	"context"
+	"math"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// defaultResourceSampleInterval is how often resources are sampled unless configured
+const defaultResourceSampleInterval = 5 * time.Second
+
+// ResourceMonitorConfig configures a resource monitor
+type ResourceMonitorConfig struct {
+	SampleInterval time.Duration    // How often resources are sampled, every 5s when zero
+	Jobs           JobProcessSource // Running jobs to attribute usage to, nil if none
+}
+
+// ResourceMonitor monitors system resources
+type ResourceMonitor struct {
+	resources *Resources
+	mu        sync.RWMutex
+	interval  time.Duration
+	jobs      JobProcessSource // Running jobs to attribute usage to, nil if none
+
+	// Sampling state, only used by the sampling goroutine
+	cpuStatic    CPUInfo            // Model and frequency, read once
+	lastTimes    *cpu.TimesStat     // Host CPU times at the last sample
+	lastCPU      map[string]float64 // Cumulative CPU seconds of each job and the agent at the last sample
+	lastSample   time.Time
+	self         *process.Process
+	gpuRuntime   *GPURuntime // Driver and runtime versions, read every gpuRuntimeRefreshInterval
+	gpuRuntimeAt time.Time
+}
+
+// NewResourceMonitor creates a new resource monitor
+func NewResourceMonitor(config ResourceMonitorConfig) *ResourceMonitor {
+	rm := &ResourceMonitor{
+		resources: &Resources{},
+		interval:  defaultResourceSampleInterval,
+		jobs:      config.Jobs,
+	}
+	if config.SampleInterval > 0 {
+		rm.interval = config.SampleInterval
+	}
+	rm.self, _ = process.NewProcess(int32(os.Getpid()))
+	return rm
+}
+
+// Start begins monitoring resources
+func (rm *ResourceMonitor) Start(ctx context.Context) {
+	// Initial resource scan
+	rm.updateResources()
+
+	ticker := time.NewTicker(rm.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rm.updateResources()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GetResources returns the current resource snapshot
+func (rm *ResourceMonitor) GetResources() *Resources {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	// Return a copy to prevent race conditions; samples are replaced, never
+	// modified, so the pointed-to load, pressure, usage and GPU runtime can be
+	// shared
+	return &Resources{
+		CPU:        rm.resources.CPU,
+		Memory:     rm.resources.Memory,
+		GPUs:       append([]GPUInfo{}, rm.resources.GPUs...),
+		Storage:    rm.resources.Storage,
+		Network:    rm.resources.Network,
+		Load:       rm.resources.Load,
+		Pressure:   rm.resources.Pressure,
+		Usage:      rm.resources.Usage,
+		GPURuntime: rm.resources.GPURuntime,
+	}
+}
+
+// updateResources updates the resource information
+func (rm *ResourceMonitor) updateResources() {
+	resources := &Resources{}
+
+	// Update CPU info
+	resources.CPU = rm.getCPUInfo()
+
+	// Update memory info
+	resources.Memory = rm.getMemoryInfo()
+
+	// Update storage info
+	resources.Storage = rm.getStorageInfo()
+
+	// Update network info
+	resources.Network = rm.getNetworkInfo()
+
+	// Update GPU info (platform-specific)
+	resources.GPUs = rm.getGPUInfo()
+	resources.GPURuntime = rm.getGPURuntime(resources.GPUs, time.Now())
+
+	// Load averages and pressure show contention that usage alone hides
+	resources.Load = rm.getLoadInfo()
+	resources.Pressure = readPressure()
+
+	// Split usage between jobs, the agent and background load
+	resources.Usage = rm.getUsageBreakdown(resources, time.Now())
+
+	rm.mu.Lock()
+	rm.resources = resources
+	rm.mu.Unlock()
+}
+
+// getCPUInfo retrieves CPU information
+func (rm *ResourceMonitor) getCPUInfo() CPUInfo {
+	// Model and frequency do not change, so they are only read once
+	if rm.cpuStatic.Cores == 0 {
+		rm.cpuStatic = CPUInfo{
+			Cores:   runtime.NumCPU(),
+			Threads: runtime.GOMAXPROCS(0),
+		}
+		if cpuInfo, err := cpu.Info(); err == nil && len(cpuInfo) > 0 {
+			rm.cpuStatic.Model = cpuInfo[0].ModelName
+			rm.cpuStatic.FrequencyHz = int64(cpuInfo[0].Mhz * 1000000)
+		}
+	}
+	info := rm.cpuStatic
+
+	// Usage is measured since the last sample instead of blocking to measure
+	// a fresh interval
+	if times, err := cpu.Times(false); err == nil && len(times) > 0 {
+		info.Usage = cpuBusyPercent(rm.lastTimes, &times[0])
+		rm.lastTimes = &times[0]
+	}
+
+	return info
+}
+
+// cpuBusyPercent returns the share of CPU time spent busy between two
+// samples, or since boot without a previous sample
+func cpuBusyPercent(prev, cur *cpu.TimesStat) float64 {
+	busy, total := cpuBusyTime(cur)
+	if prev != nil {
+		prevBusy, prevTotal := cpuBusyTime(prev)
+		busy, total = busy-prevBusy, total-prevTotal
+	}
+	if total <= 0 {
+		return 0
+	}
+	return math.Min(100, math.Max(0, busy/total*100))
+}
+
+// cpuBusyTime returns the busy and total CPU seconds of a times sample. Guest
+// time is already included in user and nice time.
+func cpuBusyTime(t *cpu.TimesStat) (busy, total float64) {
+	total = t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+	return total - t.Idle - t.Iowait, total
+}
+
+// getMemoryInfo retrieves memory information
+func (rm *ResourceMonitor) getMemoryInfo() MemoryInfo {
+	info := MemoryInfo{}
+
+	if vmStat, err := mem.VirtualMemory(); err == nil {
+		info.Total = int64(vmStat.Total)
+		info.Available = int64(vmStat.Available)
+		info.Used = int64(vmStat.Used)
+		info.Usage = vmStat.UsedPercent
+	}
+
+	// A host that is swapping has less usable memory than it reports available
+	if swap, err := mem.SwapMemory(); err == nil {
+		info.SwapTotal = int64(swap.Total)
+		info.SwapUsed = int64(swap.Used)
+	}
+
+	return info
+}
+
+// getLoadInfo retrieves the system load averages
+func (rm *ResourceMonitor) getLoadInfo() *LoadInfo {
+	avg, err := load.Avg()
+	if err != nil {
+		return nil
+	}
+	return &LoadInfo{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}
+}
+
+// parsePressure parses a /proc/pressure file:
+//
+//	some avg10=1.53 avg60=0.87 avg300=0.35 total=12345
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//
+// The CPU file has no "full" line before Linux 5.13.
+func parsePressure(data string) PressureStall {
+	var stall PressureStall
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		var avg10, avg60, avg300 *float64
+		switch fields[0] {
+		case "some":
+			avg10, avg60, avg300 = &stall.SomeAvg10, &stall.SomeAvg60, &stall.SomeAvg300
+		case "full":
+			avg10, avg60, avg300 = &stall.FullAvg10, &stall.FullAvg60, &stall.FullAvg300
+		default:
+			continue
+		}
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			switch key {
+			case "avg10":
+				*avg10 = v
+			case "avg60":
+				*avg60 = v
+			case "avg300":
+				*avg300 = v
+			}
+		}
+	}
+	return stall
+}
+
+// getStorageInfo retrieves storage information
+func (rm *ResourceMonitor) getStorageInfo() StorageInfo {
+	info := StorageInfo{}
+
+	if usage, err := disk.Usage("/"); err == nil {
+		info.Total = int64(usage.Total)
+		info.Available = int64(usage.Free)
+		info.Used = int64(usage.Used)
+		info.Usage = usage.UsedPercent
+	}
+
+	return info
+}
+
+// getNetworkInfo retrieves network information
+func (rm *ResourceMonitor) getNetworkInfo() NetworkInfo {
+	info := NetworkInfo{
+		Interfaces: []NetworkInterface{},
+		Bandwidth:  1000, // Default 1Gbps
+	}
+
+	if interfaces, err := psnet.Interfaces(); err == nil {
+		for _, iface := range interfaces {
+			if len(iface.Addrs) > 0 {
+				ni := NetworkInterface{
+					Name: iface.Name,
+					Type: "ethernet",
+				}
+
+				// Get first non-loopback IP
+				for _, addr := range iface.Addrs {
+					ip := addr.Addr
+					if ip != "" && !isLoopback(ip) {
+						ni.IP = ip
+						break
+					}
+				}
+
+				if ni.IP != "" {
+					info.Interfaces = append(info.Interfaces, ni)
+				}
+			}
+		}
+	}
+
+	return info
+}
+
+// getGPUInfo retrieves GPU information (stub - implemented in platform-specific files)
+func (rm *ResourceMonitor) getGPUInfo() []GPUInfo {
+	// This is overridden in platform-specific implementations
+	return DetectGPUs()
+}
+
+// MonitorJob monitors resources for a specific job
+func (rm *ResourceMonitor) MonitorJob(ctx context.Context, jobID string) *JobMetrics {
+	metrics := &JobMetrics{}
+
+	// Monitor resources during job execution
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var maxMemory int64
+	var totalCPUTime time.Duration
+
+	for {
+		select {
+		case <-ticker.C:
+			// Update memory peak
+			if mem := rm.resources.Memory.Used; mem > maxMemory {
+				maxMemory = mem
+			}
+
+			// Estimate CPU time (simplified)
+			totalCPUTime += time.Second * time.Duration(rm.resources.CPU.Usage/100)
+
+		case <-ctx.Done():
+			metrics.CPUTime = totalCPUTime
+			metrics.MemoryPeakMB = maxMemory / (1024 * 1024)
+			return metrics
+		}
+	}
+}
+
+// isLoopback checks if an IP address, optionally with a prefix length, is
+// an IPv4 or IPv6 loopback address
+func isLoopback(ip string) bool {
+	if parsed, _, err := net.ParseCIDR(ip); err == nil {
+		return parsed.IsLoopback()
+	}
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLoopback()
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package agentlib
+
+// readPressure is only implemented on Linux; other platforms report no
+// pressure stall information
+func readPressure() *PressureInfo {
+	return nil
+}
+
+// ContainerUsage is only implemented on Linux. Elsewhere containers run in a
+// VM whose usage the host sees as a whole, so it counts as background load.
+func ContainerUsage(containerID string) (cpuSeconds float64, memoryBytes int64, ok bool) {
+	return 0, 0, false
+}
+
+// pidInContainer is only implemented on Linux
+func pidInContainer(pid int32, containerID string) bool {
+	return false
+}
@@ -0,0 +1,193 @@
+package agentlib
+
+import (
+	"math"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// gpuProcess is a compute process running on a GPU
+type gpuProcess struct {
+	PID      int32
+	GPUUUID  string
+	MemoryMB int
+}
+
+// getUsageBreakdown attributes the host's usage to running jobs and the
+// agent; whatever remains is background load. CPU usage is measured between
+// samples, so the first sample only records a baseline and returns nil.
+func (rm *ResourceMonitor) getUsageBreakdown(resources *Resources, now time.Time) *UsageBreakdown {
+	elapsed := now.Sub(rm.lastSample).Seconds()
+	if rm.lastSample.IsZero() {
+		elapsed = 0
+	}
+	lastCPU := rm.lastCPU
+	rm.lastCPU = make(map[string]float64)
+	rm.lastSample = now
+
+	// coresSince records a cumulative CPU time and returns the cores it used
+	// since the last sample. Time of exited child processes drops out of a
+	// job's total, so a shrinking total counts as idle.
+	coresSince := func(key string, cpuSeconds float64) float64 {
+		rm.lastCPU[key] = cpuSeconds
+		prev, ok := lastCPU[key]
+		if !ok || elapsed <= 0 {
+			return 0
+		}
+		return math.Max(0, (cpuSeconds-prev)/elapsed)
+	}
+
+	var jobs []JobProcess
+	if rm.jobs != nil {
+		jobs = rm.jobs.JobProcesses()
+	}
+	trees := jobProcessTrees(jobs)
+
+	breakdown := &UsageBreakdown{Jobs: make([]JobResourceUsage, 0, len(jobs))}
+	owners := make(map[int32]int) // PID to index in breakdown.Jobs
+	for _, job := range jobs {
+		usage := JobResourceUsage{
+			JobID:             job.JobID,
+			RequestedCPUCores: job.CPUCores,
+			RequestedMemoryMB: job.MemoryMB,
+		}
+		var cpuSeconds float64
+		if job.ContainerID != "" {
+			cpuSeconds, usage.MemoryBytes, _ = ContainerUsage(job.ContainerID)
+		} else {
+			for _, p := range trees[job.JobID] {
+				if times, err := p.Times(); err == nil {
+					cpuSeconds += times.User + times.System
+				}
+				if mem, err := p.MemoryInfo(); err == nil {
+					usage.MemoryBytes += int64(mem.RSS)
+				}
+				owners[p.Pid] = len(breakdown.Jobs)
+			}
+		}
+		usage.CPUCores = coresSince("job:"+job.JobID, cpuSeconds)
+		breakdown.Jobs = append(breakdown.Jobs, usage)
+	}
+
+	if rm.self != nil {
+		if times, err := rm.self.Times(); err == nil {
+			breakdown.Agent.CPUCores = coresSince("agent", times.User+times.System)
+		}
+		if mem, err := rm.self.MemoryInfo(); err == nil {
+			breakdown.Agent.MemoryBytes = int64(mem.RSS)
+		}
+	}
+
+	rm.attributeGPUs(resources, breakdown, jobs, owners)
+
+	if elapsed <= 0 {
+		return nil
+	}
+
+	// Background load is what the host uses beyond the agent and its jobs
+	busyCores := float64(resources.CPU.Cores) * resources.CPU.Usage / 100
+	usedMemory := resources.Memory.Used
+	for _, job := range breakdown.Jobs {
+		busyCores -= job.CPUCores
+		usedMemory -= job.MemoryBytes
+	}
+	breakdown.Background.CPUCores = math.Max(0, busyCores-breakdown.Agent.CPUCores)
+	if usedMemory -= breakdown.Agent.MemoryBytes; usedMemory > 0 {
+		breakdown.Background.MemoryBytes = usedMemory
+	}
+	return breakdown
+}
+
+// attributeGPUs marks GPUs running compute processes as in use and charges
+// their memory to the owning job, or to background load
+func (rm *ResourceMonitor) attributeGPUs(resources *Resources, breakdown *UsageBreakdown, jobs []JobProcess, owners map[int32]int) {
+	nvidia := false
+	for _, gpu := range resources.GPUs {
+		nvidia = nvidia || gpu.Vendor == "NVIDIA"
+	}
+	if !nvidia {
+		return
+	}
+
+	for _, proc := range detectGPUProcesses() {
+		gpuID := ""
+		for i := range resources.GPUs {
+			if resources.GPUs[i].UUID == proc.GPUUUID {
+				resources.GPUs[i].InUse = true
+				gpuID = resources.GPUs[i].ID
+			}
+		}
+
+		owner, ok := owners[proc.PID]
+		if !ok {
+			// Container processes are matched by their cgroup
+			for i, job := range jobs {
+				if job.ContainerID != "" && pidInContainer(proc.PID, job.ContainerID) {
+					owner, ok = i, true
+					break
+				}
+			}
+		}
+		if !ok {
+			breakdown.Background.GPUMemoryMB += proc.MemoryMB
+			continue
+		}
+		job := &breakdown.Jobs[owner]
+		job.GPUMemoryMB += proc.MemoryMB
+		if gpuID != "" && !containsString(job.GPUs, gpuID) {
+			job.GPUs = append(job.GPUs, gpuID)
+		}
+	}
+}
+
+// jobProcessTrees finds the processes descending from each job's root
+// process. It scans the process table, so it only runs while binary or
+// script jobs are running.
+func jobProcessTrees(jobs []JobProcess) map[string][]*process.Process {
+	roots := make(map[int32]string)
+	for _, job := range jobs {
+		if job.PID != 0 {
+			roots[job.PID] = job.JobID
+		}
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+
+	procs, err := process.Processes()
+	if err != nil {
+		return nil
+	}
+	byPID := make(map[int32]*process.Process, len(procs))
+	children := make(map[int32][]int32)
+	for _, p := range procs {
+		byPID[p.Pid] = p
+		if ppid, err := p.Ppid(); err == nil {
+			children[ppid] = append(children[ppid], p.Pid)
+		}
+	}
+
+	trees := make(map[string][]*process.Process, len(roots))
+	for root, jobID := range roots {
+		queue := []int32{root}
+		for len(queue) > 0 {
+			pid := queue[0]
+			queue = queue[1:]
+			if p, ok := byPID[pid]; ok {
+				trees[jobID] = append(trees[jobID], p)
+			}
+			queue = append(queue, children[pid]...)
+		}
+	}
+	return trees
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
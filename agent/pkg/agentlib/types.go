@@ -0,0 +1,572 @@
+package agentlib
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Version is the agent version
+	Version = "1.0.0"
+
+	// ProtocolVersion is the wire protocol version of heartbeats and job
+	// results this agent sends
+	ProtocolVersion = 3
+)
+
+// SupportedProtocolVersions are the protocol versions the agent can speak,
+// offered to the control plane at registration
+var SupportedProtocolVersions = []int{ProtocolVersion}
+
+// Labels are key/value attributes the control plane uses to group agents
+type Labels map[string]string
+
+// AgentStatus represents the agent's current status
+type AgentStatus string
+
+const (
+	AgentStatusInitializing AgentStatus = "initializing"
+	AgentStatusActive       AgentStatus = "active"
+	AgentStatusBusy         AgentStatus = "busy"
+	AgentStatusShuttingDown AgentStatus = "shutting_down"
+	AgentStatusStopped      AgentStatus = "stopped"
+	AgentStatusError        AgentStatus = "error"
+)
+
+// Job represents a compute job
+type Job struct {
+	ID           string               `json:"id"`
+	Type         JobType              `json:"type"`
+	Requirements ResourceRequirements `json:"requirements"`
+	Payload      JobPayload           `json:"payload"`
+	Priority     int                  `json:"priority"`
+	Timeout      time.Duration        `json:"timeout"`
+	CreatedAt    time.Time            `json:"created_at"`
+	MaxRetries   int                  `json:"max_retries"`
+	ExposedPorts []ExposedPort        `json:"exposed_ports,omitempty"`
+}
+
+// ExposedPort is a job port made reachable through the tunnel service
+type ExposedPort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// JobType represents the type of job
+type JobType string
+
+const (
+	JobTypeDocker     JobType = "docker"
+	JobTypeKubernetes JobType = "kubernetes"
+	JobTypeBinary     JobType = "binary"
+	JobTypeWASM       JobType = "wasm"
+	JobTypeScript     JobType = "script"
+)
+
+// JobStatus represents the status of a job
+type JobStatus string
+
+const (
+	JobStatusPending   JobStatus = "pending"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusCompleted JobStatus = "completed"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusCancelled JobStatus = "cancelled"
+)
+
+// JobPayload contains job-specific execution details
+type JobPayload struct {
+	// Docker job fields
+	Image   string   `json:"image,omitempty"`
+	Command []string `json:"command,omitempty"`
+	Env     []string `json:"env,omitempty"`
+
+	// Containers run next to a Docker job's main container as one pod
+	Sidecars     []Sidecar     `json:"sidecars,omitempty"`
+	SharedVolume *SharedVolume `json:"shared_volume,omitempty"`
+
+	// How a Docker job saves its state when it is about to run out of memory
+	Checkpoint *Checkpoint `json:"checkpoint,omitempty"`
+
+	// Binary job fields
+	BinaryURL string   `json:"binary_url,omitempty"`
+	Args      []string `json:"args,omitempty"`
+
+	// Script job fields
+	Script   string `json:"script,omitempty"`
+	Language string `json:"language,omitempty"`
+
+	// Input/output
+	InputData  string `json:"input_data,omitempty"`
+	OutputPath string `json:"output_path,omitempty"`
+}
+
+// Sidecar is a container that runs alongside a Docker job's main container
+type Sidecar struct {
+	Name     string   `json:"name"`
+	Image    string   `json:"image"`
+	Command  []string `json:"command,omitempty"`
+	Env      []string `json:"env,omitempty"`
+	MemoryMB int      `json:"memory_mb,omitempty"`
+}
+
+// SharedVolume is scratch space mounted into every container of a pod
+type SharedVolume struct {
+	MountPath string `json:"mount_path"`
+	SizeMB    int    `json:"size_mb"`
+	Medium    string `json:"medium"` // memory (tmpfs) or disk
+}
+
+// Checkpoint tells a job to save its state, by running a command inside its
+// container or sending it a signal
+type Checkpoint struct {
+	Command []string `json:"command,omitempty"`
+	Signal  string   `json:"signal,omitempty"`
+}
+
+// Job warning kinds
+const (
+	WarningMemoryPressure   = "memory_pressure"
+	WarningCheckpointFailed = "checkpoint_failed"
+)
+
+// JobWarning tells a job's owner about a problem seen while it runs
+type JobWarning struct {
+	Kind                string  `json:"kind"`
+	MemoryMB            int64   `json:"memory_mb,omitempty"`
+	LimitMB             int64   `json:"limit_mb,omitempty"`
+	GrowthMBPerMinute   float64 `json:"growth_mb_per_minute,omitempty"`
+	PredictedOOMSeconds int     `json:"predicted_oom_seconds,omitempty"`
+	Checkpoint          string  `json:"checkpoint,omitempty"` // triggered or failed
+	Message             string  `json:"message"`
+}
+
+// JobProgress tells a job's owner how far it has got
+type JobProgress struct {
+	Progress float64 `json:"progress"` // Percent complete, 0-100
+	Message  string  `json:"message,omitempty"`
+}
+
+// JobLogLine is one line of a running job's output
+type JobLogLine struct {
+	Timestamp time.Time `json:"timestamp"`
+	Stream    string    `json:"stream,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// ResourceRequirements specifies job resource needs
+type ResourceRequirements struct {
+	CPUCores     int      `json:"cpu_cores"`
+	MemoryMB     int      `json:"memory_mb"`
+	GPUCount     int      `json:"gpu_count"`
+	GPUType      string   `json:"gpu_type,omitempty"`
+	StorageMB    int      `json:"storage_mb"`
+	NetworkMbps  int      `json:"network_mbps"`
+	TrustedExec  bool     `json:"trusted_exec"`
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// Resources represents available system resources
+type Resources struct {
+	CPU        CPUInfo         `json:"cpu"`
+	Memory     MemoryInfo      `json:"memory"`
+	GPUs       []GPUInfo       `json:"gpus,omitempty"`
+	Storage    StorageInfo     `json:"storage"`
+	Network    NetworkInfo     `json:"network"`
+	Load       *LoadInfo       `json:"load,omitempty"`
+	Pressure   *PressureInfo   `json:"pressure,omitempty"`    // Linux 4.20+ only
+	Usage      *UsageBreakdown `json:"usage,omitempty"`       // Omitted until two samples were taken
+	GPURuntime *GPURuntime     `json:"gpu_runtime,omitempty"` // Omitted on hosts without GPUs
+}
+
+// CPUInfo contains CPU information
+type CPUInfo struct {
+	Model       string  `json:"model"`
+	Cores       int     `json:"cores"`
+	Threads     int     `json:"threads"`
+	FrequencyHz int64   `json:"frequency_hz"`
+	Usage       float64 `json:"usage"`
+}
+
+// MemoryInfo contains memory information
+type MemoryInfo struct {
+	Total     int64   `json:"total"`
+	Available int64   `json:"available"`
+	Used      int64   `json:"used"`
+	Usage     float64 `json:"usage"`
+	SwapTotal int64   `json:"swap_total"`
+	SwapUsed  int64   `json:"swap_used"`
+}
+
+// GPUInfo contains GPU information
+type GPUInfo struct {
+	ID           string  `json:"id"`
+	UUID         string  `json:"uuid,omitempty"`
+	Model        string  `json:"model"`
+	Vendor       string  `json:"vendor"`
+	MemoryMB     int     `json:"memory_mb"`
+	MemoryUsedMB int     `json:"memory_used_mb"`
+	Usage        float64 `json:"usage"`
+	Temperature  float64 `json:"temperature"`
+	PowerWatts   float64 `json:"power_watts"`
+	InUse        bool    `json:"in_use"` // A compute process is running on it
+}
+
+// LoadInfo contains the system load averages
+type LoadInfo struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+// PressureInfo contains pressure stall information: the share of time tasks
+// were stalled waiting for each resource
+type PressureInfo struct {
+	CPU    PressureStall `json:"cpu"`
+	Memory PressureStall `json:"memory"`
+	IO     PressureStall `json:"io"`
+}
+
+// PressureStall holds stall percentages averaged over 10s, 60s and 300s.
+// "Some" counts time at least one task stalled, "full" time all tasks did.
+type PressureStall struct {
+	SomeAvg10  float64 `json:"some_avg10"`
+	SomeAvg60  float64 `json:"some_avg60"`
+	SomeAvg300 float64 `json:"some_avg300"`
+	FullAvg10  float64 `json:"full_avg10"`
+	FullAvg60  float64 `json:"full_avg60"`
+	FullAvg300 float64 `json:"full_avg300"`
+}
+
+// UsageBreakdown splits the host's resource usage between running jobs, the
+// agent itself and background load from everything else on the host
+type UsageBreakdown struct {
+	Jobs       []JobResourceUsage `json:"jobs"`
+	Agent      ProcessUsage       `json:"agent"`
+	Background ProcessUsage       `json:"background"`
+}
+
+// ProcessUsage is the resource usage of a group of processes
+type ProcessUsage struct {
+	CPUCores    float64 `json:"cpu_cores"`
+	MemoryBytes int64   `json:"memory_bytes"`
+	GPUMemoryMB int     `json:"gpu_memory_mb,omitempty"`
+}
+
+// JobResourceUsage is what a running job uses next to what it requested
+type JobResourceUsage struct {
+	JobID string `json:"job_id"`
+	ProcessUsage
+	GPUs              []string `json:"gpus,omitempty"` // IDs of the GPUs its processes run on
+	RequestedCPUCores int      `json:"requested_cpu_cores"`
+	RequestedMemoryMB int      `json:"requested_memory_mb"`
+}
+
+// StorageInfo contains storage information
+type StorageInfo struct {
+	Total     int64   `json:"total"`
+	Available int64   `json:"available"`
+	Used      int64   `json:"used"`
+	Usage     float64 `json:"usage"`
+}
+
+// NetworkInfo contains network information
+type NetworkInfo struct {
+	Interfaces []NetworkInterface `json:"interfaces"`
+	Bandwidth  int                `json:"bandwidth_mbps"`
+}
+
+// NetworkInterface represents a network interface
+type NetworkInterface struct {
+	Name string `json:"name"`
+	IP   string `json:"ip"`
+	Type string `json:"type"`
+}
+
+// ExecutionEnvironment records what a job actually ran on, so a later run
+// can be pinned to the same or an equivalent environment
+type ExecutionEnvironment struct {
+	ImageRef            string    `json:"image_ref,omitempty"`       // Image as requested
+	ImageDigest         string    `json:"image_digest,omitempty"`    // Registry digest, or local image ID when unpushed
+	ArtifactDigest      string    `json:"artifact_digest,omitempty"` // sha256 of the binary or script that ran
+	Runtime             string    `json:"runtime"`                   // docker, python3, node, binary, ...
+	RuntimeVersion      string    `json:"runtime_version,omitempty"`
+	DriverVersion       string    `json:"driver_version,omitempty"`
+	CUDAVersion         string    `json:"cuda_version,omitempty"`
+	EnvHash             string    `json:"env_hash"` // sha256 of the job's sorted environment variables
+	HardwareFingerprint string    `json:"hardware_fingerprint"`
+	CPUModel            string    `json:"cpu_model,omitempty"`
+	GPUModels           []string  `json:"gpu_models,omitempty"`
+	OS                  string    `json:"os"`
+	Arch                string    `json:"arch"`
+	AgentVersion        string    `json:"agent_version"`
+	CapturedAt          time.Time `json:"captured_at"`
+}
+
+// JobResult represents the result of a job execution
+type JobResult struct {
+	ProtocolVersion int                   `json:"protocol_version"`
+	JobID           string                `json:"job_id"`
+	AgentID         string                `json:"agent_id"`
+	Status          JobStatus             `json:"status"`
+	Output          string                `json:"output,omitempty"`
+	Error           string                `json:"error,omitempty"`
+	ExitCode        int                   `json:"exit_code"`
+	StartedAt       time.Time             `json:"started_at"`
+	FinishedAt      time.Time             `json:"finished_at"`
+	Metrics         *JobMetrics           `json:"metrics,omitempty"`
+	Artifacts       []JobArtifact         `json:"artifacts,omitempty"`
+	Environment     *ExecutionEnvironment `json:"environment,omitempty"`
+	Timestamp       time.Time             `json:"timestamp"`
+}
+
+// JobMetrics contains job execution metrics
+type JobMetrics struct {
+	CPUTime      time.Duration `json:"cpu_time"`
+	MemoryPeakMB int64         `json:"memory_peak_mb"`
+	NetworkInMB  int64         `json:"network_in_mb"`
+	NetworkOutMB int64         `json:"network_out_mb"`
+	DiskReadMB   int64         `json:"disk_read_mb"`
+	DiskWriteMB  int64         `json:"disk_write_mb"`
+	CPUCoresAvg  float64       `json:"cpu_cores_avg,omitempty"`
+	CPUCoresP95  float64       `json:"cpu_cores_p95,omitempty"`
+	Samples      int           `json:"samples,omitempty"`
+}
+
+// JobArtifact represents an output artifact from a job
+type JobArtifact struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+	MimeType string `json:"mime_type"`
+}
+
+// ExecSession is a pending interactive session into a running job
+type ExecSession struct {
+	ID      string   `json:"id"`
+	JobID   string   `json:"job_id"`
+	Command []string `json:"command,omitempty"`
+	TTY     bool     `json:"tty"`
+	Cols    uint16   `json:"cols,omitempty"`
+	Rows    uint16   `json:"rows,omitempty"`
+	Record  bool     `json:"record"`
+}
+
+// ExecControlMessage is a JSON control frame on an exec session stream
+type ExecControlMessage struct {
+	Type     string `json:"type"` // resize, exit, error
+	Cols     uint16 `json:"cols,omitempty"`
+	Rows     uint16 `json:"rows,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DiagnosticsRequest asks the agent for a support bundle. The bundle is
+// encrypted with Key before it leaves the machine.
+type DiagnosticsRequest struct {
+	ID         string `json:"id"`
+	Key        string `json:"key"` // Base64 AES-256 key
+	LogLines   int    `json:"log_lines"`
+	JobResults int    `json:"job_results"`
+}
+
+// JobResize asks the agent to change the resources of a running Docker
+// job. CPU and memory change in place; when Restart is set the container
+// is stopped and started again, which GPU changes need.
+type JobResize struct {
+	ID       string `json:"id"`
+	JobID    string `json:"job_id"`
+	CPUCores int    `json:"cpu_cores"`
+	MemoryMB int    `json:"memory_mb"`
+	GPUCount int    `json:"gpu_count"`
+	Restart  bool   `json:"restart"`
+}
+
+// ProfileSpec is a centrally managed configuration applied on top of the local config
+type ProfileSpec struct {
+	MaxConcurrentJobs int      `json:"max_concurrent_jobs,omitempty"`
+	MaxCPUCores       int      `json:"max_cpu_cores,omitempty"` // Per job
+	MaxMemoryMB       int      `json:"max_memory_mb,omitempty"` // Per job
+	Runtimes          []string `json:"runtimes,omitempty"`      // Enabled job types; empty enables all
+	UpdateChannel     string   `json:"update_channel,omitempty"`
+}
+
+// Validate checks that an agent can honor a profile spec
+func (spec *ProfileSpec) Validate() error {
+	for _, runtime := range spec.Runtimes {
+		switch JobType(runtime) {
+		case JobTypeDocker, JobTypeKubernetes, JobTypeBinary, JobTypeWASM, JobTypeScript:
+		default:
+			return fmt.Errorf("unsupported runtime %q", runtime)
+		}
+	}
+	if spec.MaxConcurrentJobs < 0 || spec.MaxCPUCores < 0 || spec.MaxMemoryMB < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	return nil
+}
+
+// AllowsRuntime reports whether a job type is enabled by the spec
+func (spec *ProfileSpec) AllowsRuntime(jobType JobType) bool {
+	if len(spec.Runtimes) == 0 {
+		return true
+	}
+	for _, runtime := range spec.Runtimes {
+		if JobType(runtime) == jobType {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigAssignment is the profile revision the control plane wants the agent to run
+type ConfigAssignment struct {
+	ProfileID string       `json:"profile_id,omitempty"`
+	Revision  int          `json:"revision,omitempty"`
+	Spec      *ProfileSpec `json:"spec,omitempty"`
+}
+
+// Control channel message types
+const (
+	ControlMessageConfig = "config" // Carries the agent's current ConfigAssignment
+)
+
+// ControlMessage is pushed to the agent over its control channel
+type ControlMessage struct {
+	Type   string            `json:"type"`
+	Config *ConfigAssignment `json:"config,omitempty"`
+}
+
+// ConfigStatus reports the outcome of applying a profile revision
+type ConfigStatus struct {
+	ProfileID string `json:"profile_id"`
+	Revision  int    `json:"revision"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RegisterRequest is sent to register an agent
+type RegisterRequest struct {
+	AgentID             string     `json:"agent_id"`
+	JoinToken           string     `json:"join_token"`
+	HardwareFingerprint string     `json:"hardware_fingerprint"`
+	Version             string     `json:"version"`
+	Platform            Platform   `json:"platform"`
+	Resources           *Resources `json:"resources"`
+	Capabilities        []string   `json:"capabilities"`
+	ProtocolVersions    []int      `json:"protocol_versions"`
+}
+
+// RegisterResponse is received after registration and while polling an
+// enrollment
+type RegisterResponse struct {
+	Status           string    `json:"status"`                      // pending, approved, rejected or revoked
+	EnrollmentSecret string    `json:"enrollment_secret,omitempty"` // Returned once, on registration
+	Token            string    `json:"token,omitempty"`             // Credentials, once approved
+	ExpiresAt        time.Time `json:"expires_at"`
+	Reason           string    `json:"reason,omitempty"`
+	ProtocolVersion  int       `json:"protocol_version"`      // Negotiated with the control plane
+	Deprecation      string    `json:"deprecation,omitempty"` // Set when that version will stop being accepted
+}
+
+// Platform contains platform information
+type Platform struct {
+	OS               string `json:"os"`
+	Arch             string `json:"arch"`
+	Version          string `json:"version"`
+	Hostname         string `json:"hostname"`
+	ContainerRuntime string `json:"container_runtime,omitempty"`
+}
+
+// Heartbeat is sent periodically to the control plane
+type Heartbeat struct {
+	ProtocolVersion int           `json:"protocol_version"`
+	AgentID         string        `json:"agent_id"`
+	Timestamp       time.Time     `json:"timestamp"`
+	Status          AgentStatus   `json:"status"`
+	Resources       *Resources    `json:"resources"`
+	ActiveJobs      []string      `json:"active_jobs"`
+	Metrics         *AgentMetrics `json:"metrics"`
+	Labels          Labels        `json:"labels,omitempty"`
+	Connectivity    *Connectivity `json:"connectivity,omitempty"`
+}
+
+// Connectivity classes
+const (
+	ConnectivityDirect  = "direct"  // The control plane sees one of the agent's own addresses
+	ConnectivityRelayed = "relayed" // Behind NAT or CGNAT, or relaying by choice
+)
+
+// Connectivity describes how the agent is connected, reported in heartbeats.
+//
+// The agent starts every connection to the control plane itself, so it works
+// from behind NAT and CGNAT. It is classified as direct when the address the
+// control plane sees it connect from is one of its own, meaning no address
+// translation happened; otherwise it is relayed. Direct does not mean inbound
+// connections get through a firewall, so providers behind one may force
+// relayed. Exposed ports are relayed through the tunnel service either way.
+type Connectivity struct {
+	Class           string    `json:"class"`
+	ObservedAddress string    `json:"observed_address,omitempty"` // Address the control plane saw
+	Addresses       []string  `json:"addresses,omitempty"`        // Routable addresses on the agent's interfaces
+	IPv6            bool      `json:"ipv6"`                       // The agent has a global IPv6 address
+	CheckedAt       time.Time `json:"checked_at"`
+}
+
+// AgentMetrics contains agent performance metrics
+type AgentMetrics struct {
+	JobsStarted       int64     `json:"jobs_started"`
+	JobsCompleted     int64     `json:"jobs_completed"`
+	JobsFailed        int64     `json:"jobs_failed"`
+	HeartbeatFailures int64     `json:"heartbeat_failures"`
+	UptimeSeconds     int64     `json:"uptime_seconds"`
+	LastReportTime    time.Time `json:"last_report_time"`
+}
+
+// MetricsReport contains detailed metrics for reporting
+type MetricsReport struct {
+	AgentID   string        `json:"agent_id"`
+	Timestamp time.Time     `json:"timestamp"`
+	Metrics   *AgentMetrics `json:"metrics"`
+	Resources *Resources    `json:"resources"`
+}
+
+// NewAgentMetrics creates a new AgentMetrics instance
+func NewAgentMetrics() *AgentMetrics {
+	return &AgentMetrics{
+		LastReportTime: time.Now(),
+	}
+}
+
+// IncrementJobsStarted increments the jobs started counter
+func (m *AgentMetrics) IncrementJobsStarted() {
+	m.JobsStarted++
+}
+
+// IncrementJobsCompleted increments the jobs completed counter
+func (m *AgentMetrics) IncrementJobsCompleted() {
+	m.JobsCompleted++
+}
+
+// IncrementJobsFailed increments the jobs failed counter
+func (m *AgentMetrics) IncrementJobsFailed() {
+	m.JobsFailed++
+}
+
+// IncrementHeartbeatFailures increments the heartbeat failures counter
+func (m *AgentMetrics) IncrementHeartbeatFailures() {
+	m.HeartbeatFailures++
+}
+
+// GetSnapshot returns a copy of the metrics
+func (m *AgentMetrics) GetSnapshot() *AgentMetrics {
+	return &AgentMetrics{
+		JobsStarted:       m.JobsStarted,
+		JobsCompleted:     m.JobsCompleted,
+		JobsFailed:        m.JobsFailed,
+		HeartbeatFailures: m.HeartbeatFailures,
+		UptimeSeconds:     int64(time.Since(m.LastReportTime).Seconds()),
+		LastReportTime:    time.Now(),
+	}
+}
@@ -6,12 +6,14 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/computehive/core-services/pkg/health"
+	"github.com/computehive/core-services/pkg/obs"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -56,7 +58,7 @@ func NewAuthService() *AuthService {
 		b := make([]byte, 32)
 		rand.Read(b)
 		secret = base64.URLEncoding.EncodeToString(b)
-		log.Printf("WARNING: Using generated JWT secret. Set JWT_SECRET environment variable in production.")
+		slog.Warn("Using generated JWT secret. Set JWT_SECRET environment variable in production.")
 	}
 
 	return &AuthService{
@@ -354,6 +356,7 @@ func (s *AuthService) Middleware(next http.HandlerFunc) http.HandlerFunc {
 
 		// Add claims to request context
 		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = obs.WithCaller(ctx, claims.UserID, "")
 		next(w, r.WithContext(ctx))
 	}
 }
@@ -377,6 +380,12 @@ func generateID() string {
 	return base64.URLEncoding.EncodeToString(b)
 }
 
+// isAdmin reports whether the authenticated caller is an admin
+func isAdmin(r *http.Request) bool {
+	claims, ok := r.Context().Value("claims").(*Claims)
+	return ok && claims.Role == "admin"
+}
+
 func generateRefreshToken() string {
 	b := make([]byte, 32)
 	rand.Read(b)
@@ -384,6 +393,8 @@ func generateRefreshToken() string {
 }
 
 func main() {
+	obs.Init("auth-service")
+
 	// Initialize service
 	authService := NewAuthService()
 
@@ -402,10 +413,15 @@ func main() {
 
 	// Setup routes
 	router := mux.NewRouter()
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
+	router.Use(obs.Middleware)
+	// Health checks: /healthz is liveness only, /readyz runs dependency checks
+	checker := health.NewChecker("auth-service")
+	router.HandleFunc("/healthz", checker.LivenessHandler).Methods("GET")
+	router.HandleFunc("/readyz", checker.ReadinessHandler).Methods("GET")
+	router.HandleFunc("/health", checker.ReadinessHandler).Methods("GET") // Legacy alias
+
+	// Runtime logging control
+	router.HandleFunc("/admin/logging", authService.Middleware(obs.Logging.Handler(isAdmin))).Methods("GET", "PUT")
 
 	// Auth routes
 	router.HandleFunc("/api/v1/auth/register", authService.Register).Methods("POST")
@@ -443,8 +459,8 @@ func main() {
 		port = "8001"
 	}
 
-	log.Printf("Auth service starting on port %s", port)
+	slog.Info("Auth service starting", "port", port)
 	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		obs.Fatal("Failed to start server", err)
 	}
 } 
\ No newline at end of file
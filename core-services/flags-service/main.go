@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/computehive/core-services/pkg/flags"
+	"github.com/computehive/core-services/pkg/health"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/cors"
+)
+
+// FlagsService is the admin API for feature flags. Services never call it to
+// evaluate flags; their flags.Client watches the bucket this service writes.
+type FlagsService struct {
+	nats *nats.Conn
+	kv   nats.KeyValue
+
+	// Metrics
+	changes *prometheus.CounterVec
+}
+
+// FlagRevision is a stored flag and its revision in the bucket, which
+// callers pass back in If-Match to update without overwriting someone else
+type FlagRevision struct {
+	*flags.Flag
+	Revision uint64 `json:"revision"`
+	Deleted  bool   `json:"deleted,omitempty"` // History only
+}
+
+// NewFlagsService creates a new flags service
+func NewFlagsService() (*FlagsService, error) {
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		natsURL = "nats://localhost:4222"
+	}
+
+	nc, err := nats.Connect(natsURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	kv, err := flags.OpenBucket(nc)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FlagsService{
+		nats: nc,
+		kv:   kv,
+		changes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "flags_changes_total",
+			Help: "Feature flag changes by operation",
+		}, []string{"operation"}),
+	}
+	prometheus.MustRegister(s.changes)
+
+	return s, nil
+}
+
+// HTTP Handlers
+
+// ListFlags returns every flag, or those of one service
+func (s *FlagsService) ListFlags(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	service := r.URL.Query().Get("service")
+
+	keys, err := s.kv.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		obs.WriteError(w, r, obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to list flags: %w", err)))
+		return
+	}
+	sort.Strings(keys)
+
+	list := make([]FlagRevision, 0, len(keys))
+	for _, key := range keys {
+		if service != "" && flags.Service(key) != service {
+			continue
+		}
+		flag, err := s.get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			continue // Deleted since it was listed
+		} else if err != nil {
+			obs.WriteError(w, r, err)
+			return
+		}
+		list = append(list, *flag)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetFlag returns one flag
+func (s *FlagsService) GetFlag(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	flag, err := s.get(mux.Vars(r)["key"])
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		http.Error(w, "Flag not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+
+	writeFlag(w, http.StatusOK, flag)
+}
+
+// PutFlag creates or replaces a flag. With If-Match set to the revision the
+// caller read, the update fails if the flag changed since.
+func (s *FlagsService) PutFlag(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	claims := r.Context().Value("claims").(*Claims)
+
+	var flag flags.Flag
+	if err := json.NewDecoder(r.Body).Decode(&flag); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	flag.Key = mux.Vars(r)["key"]
+	flag.UpdatedBy = claims.UserID
+	flag.UpdatedAt = time.Now()
+	if err := flag.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, _ := json.Marshal(flag)
+
+	var revision uint64
+	var err error
+	if match := r.Header.Get("If-Match"); match != "" {
+		expected, parseErr := strconv.ParseUint(strings.Trim(match, `"`), 10, 64)
+		if parseErr != nil {
+			http.Error(w, "If-Match must be a flag revision", http.StatusBadRequest)
+			return
+		}
+		revision, err = s.kv.Update(flag.Key, data, expected)
+		var apiErr *nats.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence {
+			http.Error(w, "Flag changed since revision "+strconv.FormatUint(expected, 10), http.StatusPreconditionFailed)
+			return
+		}
+	} else {
+		revision, err = s.kv.Put(flag.Key, data)
+	}
+	if err != nil {
+		obs.WriteError(w, r, obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to store flag: %w", err)))
+		return
+	}
+
+	s.changes.WithLabelValues("put").Inc()
+	slog.InfoContext(r.Context(), "Feature flag updated", "key", flag.Key, "kind", flag.Kind,
+		"enabled", flag.Enabled, "percentage", flag.Percentage, "revision", revision, "by", claims.UserID)
+
+	writeFlag(w, http.StatusOK, &FlagRevision{Flag: &flag, Revision: revision})
+}
+
+// DeleteFlag removes a flag, which turns it off everywhere
+func (s *FlagsService) DeleteFlag(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	claims := r.Context().Value("claims").(*Claims)
+	key := mux.Vars(r)["key"]
+
+	if _, err := s.kv.Get(key); errors.Is(err, nats.ErrKeyNotFound) {
+		http.Error(w, "Flag not found", http.StatusNotFound)
+		return
+	}
+	if err := s.kv.Delete(key); err != nil {
+		obs.WriteError(w, r, obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to delete flag: %w", err)))
+		return
+	}
+
+	s.changes.WithLabelValues("delete").Inc()
+	slog.InfoContext(r.Context(), "Feature flag deleted", "key", key, "by", claims.UserID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFlagHistory returns the recent revisions of a flag, newest first, as an
+// audit trail of who changed it
+func (s *FlagsService) GetFlagHistory(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	entries, err := s.kv.History(mux.Vars(r)["key"])
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		http.Error(w, "Flag not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		obs.WriteError(w, r, obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to read flag history: %w", err)))
+		return
+	}
+
+	history := make([]FlagRevision, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		revision := FlagRevision{Flag: &flags.Flag{Key: entry.Key(), UpdatedAt: entry.Created()}, Revision: entry.Revision()}
+		if entry.Operation() == nats.KeyValuePut {
+			json.Unmarshal(entry.Value(), revision.Flag)
+		} else {
+			revision.Deleted = true
+		}
+		history = append(history, revision)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// EvaluateFlag shows what a flag serves a given tenant and user, to check
+// targeting before ramping up
+func (s *FlagsService) EvaluateFlag(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var fc flags.Context
+	if err := json.NewDecoder(r.Body).Decode(&fc); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	flag, err := s.get(mux.Vars(r)["key"])
+	enabled := false
+	if err == nil {
+		enabled = flag.Evaluate(fc)
+	} else if !errors.Is(err, nats.ErrKeyNotFound) {
+		obs.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"key":     mux.Vars(r)["key"],
+		"context": fc,
+		"enabled": enabled,
+		"exists":  err == nil,
+	})
+}
+
+// get reads a flag and its revision
+func (s *FlagsService) get(key string) (*FlagRevision, error) {
+	entry, err := s.kv.Get(key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, err
+	} else if err != nil {
+		return nil, obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to read flag: %w", err))
+	}
+	var flag flags.Flag
+	if err := json.Unmarshal(entry.Value(), &flag); err != nil {
+		return nil, fmt.Errorf("stored flag %s is malformed: %w", key, err)
+	}
+	return &FlagRevision{Flag: &flag, Revision: entry.Revision()}, nil
+}
+
+func writeFlag(w http.ResponseWriter, status int, flag *FlagRevision) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", strconv.Quote(strconv.FormatUint(flag.Revision, 10)))
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(flag)
+}
+
+// requireAdmin rejects callers other than admins
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !isAdmin(r) {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// JWT Claims type
+type Claims struct {
+	UserID   string   `json:"user_id"`
+	Email    string   `json:"email"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Scopes   []string `json:"scopes"`
+	jwt.RegisteredClaims
+}
+
+// Auth middleware
+func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Simple auth check - in production, validate JWT properly
+		tokenString := r.Header.Get("Authorization")
+		if tokenString == "" {
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+
+		// Mock claims for development
+		claims := &Claims{
+			UserID: "user-123",
+			Role:   "user",
+		}
+
+		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = obs.WithCaller(ctx, claims.UserID, "")
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// isAdmin reports whether the authenticated caller is an admin
+func isAdmin(r *http.Request) bool {
+	claims, ok := r.Context().Value("claims").(*Claims)
+	return ok && claims.Role == "admin"
+}
+
+func main() {
+	obs.Init("flags-service")
+
+	flagsService, err := NewFlagsService()
+	if err != nil {
+		obs.Fatal("Failed to create flags service", err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(obs.Middleware)
+
+	// Health checks: /healthz is liveness only, /readyz runs dependency checks
+	checker := health.NewChecker("flags-service")
+	checker.AddCheck("nats", true, health.NATSCheck(flagsService.nats))
+	router.HandleFunc("/healthz", checker.LivenessHandler).Methods("GET")
+	router.HandleFunc("/readyz", checker.ReadinessHandler).Methods("GET")
+
+	// Metrics endpoint
+	router.Handle("/metrics", promhttp.Handler())
+
+	// Runtime logging control
+	router.HandleFunc("/admin/logging", authMiddleware(obs.Logging.Handler(isAdmin))).Methods("GET", "PUT")
+
+	// Admin endpoints
+	router.HandleFunc("/api/v1/flags", authMiddleware(flagsService.ListFlags)).Methods("GET")
+	router.HandleFunc("/api/v1/flags/{key}", authMiddleware(flagsService.GetFlag)).Methods("GET")
+	router.HandleFunc("/api/v1/flags/{key}", authMiddleware(flagsService.PutFlag)).Methods("PUT")
+	router.HandleFunc("/api/v1/flags/{key}", authMiddleware(flagsService.DeleteFlag)).Methods("DELETE")
+	router.HandleFunc("/api/v1/flags/{key}/history", authMiddleware(flagsService.GetFlagHistory)).Methods("GET")
+	router.HandleFunc("/api/v1/flags/{key}/evaluate", authMiddleware(flagsService.EvaluateFlag)).Methods("POST")
+
+	// Setup CORS
+	c := cors.New(cors.Options{
+		AllowedOrigins:   []string{"http://localhost:3000", "https://computehive.io"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "If-Match"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+	})
+
+	handler := c.Handler(router)
+
+	// Start server
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8008"
+	}
+
+	slog.Info("Flags service starting", "port", port)
+	if err := http.ListenAndServe(":"+port, handler); err != nil {
+		obs.Fatal("Failed to start server", err)
+	}
+}
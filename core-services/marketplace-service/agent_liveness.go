@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/nats-io/nats.go"
+)
+
+// offerExpiredAgentOffline marks offers expired because their agent stopped
+// heartbeating; only these are restored when the agent returns
+const offerExpiredAgentOffline = "agent_offline"
+
+// subscribeToAgentLiveness follows the resource-service liveness reaper so
+// offers never outlive the agent serving them
+func (s *MarketplaceService) subscribeToAgentLiveness() {
+	s.bus.Subscribe("agent.expired", func(ctx context.Context, msg *nats.Msg) error {
+		agentID, err := livenessAgentID(msg)
+		if err != nil {
+			return err
+		}
+		s.expireAgentOffers(ctx, agentID)
+		return nil
+	})
+
+	s.bus.Subscribe("agent.restored", func(ctx context.Context, msg *nats.Msg) error {
+		agentID, err := livenessAgentID(msg)
+		if err != nil {
+			return err
+		}
+		s.restoreAgentOffers(ctx, agentID)
+		return nil
+	})
+}
+
+// livenessAgentID extracts the agent from a liveness event
+func livenessAgentID(msg *nats.Msg) (string, error) {
+	var event struct {
+		AgentID string `json:"agent_id"`
+	}
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		return "", obs.Wrap(obs.CodeInvalidArgument, err)
+	}
+	if event.AgentID == "" {
+		return "", obs.Errorf(obs.CodeInvalidArgument, "liveness event has no agent_id")
+	}
+	return event.AgentID, nil
+}
+
+// expireAgentOffers expires the active offers of an agent that went away
+func (s *MarketplaceService) expireAgentOffers(ctx context.Context, agentID string) {
+	var reports []ExecutionReport
+
+	s.mu.Lock()
+	for _, offer := range s.offers {
+		if offer.AgentID != agentID || offer.Status != "active" {
+			continue
+		}
+		offer.Status = "expired"
+		offer.ExpiredReason = offerExpiredAgentOffline
+		offer.UpdatedAt = time.Now()
+		reports = append(reports, offerReport(offer, ExecExpired, "agent stopped heartbeating"))
+	}
+	if len(reports) > 0 {
+		s.updateActiveMetrics()
+	}
+	s.mu.Unlock()
+
+	for _, report := range reports {
+		s.executions.Report(report)
+	}
+	if len(reports) > 0 {
+		slog.InfoContext(ctx, "Expired offers of offline agent", "agent_id", agentID, "offers", len(reports))
+	}
+}
+
+// restoreAgentOffers reactivates offers expired while their agent was away,
+// unless they would have expired on their own in the meantime
+func (s *MarketplaceService) restoreAgentOffers(ctx context.Context, agentID string) {
+	now := time.Now()
+	var reports []ExecutionReport
+
+	s.mu.Lock()
+	for _, offer := range s.offers {
+		if offer.AgentID != agentID || offer.Status != "expired" || offer.ExpiredReason != offerExpiredAgentOffline {
+			continue
+		}
+		offer.ExpiredReason = ""
+		if now.After(offer.ExpiresAt) {
+			continue
+		}
+		offer.Status = "active"
+		offer.UpdatedAt = now
+		reports = append(reports, offerReport(offer, ExecRestated, "agent is heartbeating again"))
+	}
+	if len(reports) > 0 {
+		s.updateActiveMetrics()
+	}
+	s.mu.Unlock()
+
+	for _, report := range reports {
+		s.executions.Report(report)
+	}
+	if len(reports) > 0 {
+		slog.InfoContext(ctx, "Restored offers of returning agent", "agent_id", agentID, "offers", len(reports))
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/computehive/core-services/pkg/maintenance"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/nats-io/nats.go"
+)
+
+// subscribeToAgentMaintenance follows the maintenance windows providers
+// declare for their agents, so offers list them and matches show the
+// downtime falling within them
+func (s *MarketplaceService) subscribeToAgentMaintenance() {
+	s.bus.Subscribe("agent.maintenance", func(ctx context.Context, msg *nats.Msg) error {
+		var event struct {
+			AgentID string               `json:"agent_id"`
+			Windows []maintenance.Window `json:"windows"`
+		}
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		if event.AgentID == "" {
+			return obs.Errorf(obs.CodeInvalidArgument, "maintenance event has no agent_id")
+		}
+		if err := maintenance.Validate(event.Windows); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		s.setAgentMaintenance(ctx, event.AgentID, event.Windows)
+		return nil
+	})
+}
+
+// setAgentMaintenance records an agent's windows and restates the offers it
+// serves. Matches keep the downtime listed when they were made.
+func (s *MarketplaceService) setAgentMaintenance(ctx context.Context, agentID string, windows []maintenance.Window) {
+	var changed []*Offer
+
+	s.mu.Lock()
+	if len(windows) == 0 {
+		delete(s.maintenance, agentID)
+		windows = nil
+	} else {
+		s.maintenance[agentID] = windows
+	}
+	for _, offer := range s.offers {
+		if offer.AgentID != agentID {
+			continue
+		}
+		offer.Maintenance = windows
+		offer.UpdatedAt = time.Now()
+		if offer.Status == "active" {
+			snapshot := *offer
+			changed = append(changed, &snapshot)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, offer := range changed {
+		s.broadcastUpdate("offers", map[string]interface{}{
+			"type": "offer_maintenance_changed",
+			"data": offer,
+		})
+	}
+	slog.InfoContext(ctx, "Agent maintenance windows updated", "agent_id", agentID, "windows", len(windows), "active_offers", len(changed))
+}
@@ -0,0 +1,675 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Inconsistency kinds. The first group is repaired automatically because the
+// repair only frees capacity nobody can still be using; the rest are queued
+// for an admin.
+const (
+	IssueReservationMissingMatch = "reservation_missing_match" // Offer reserved for a match that does not exist
+	IssueReservationEndedMatch   = "reservation_ended_match"   // Offer still reserved for a match that ended
+	IssueMatchJobsFailed         = "match_jobs_failed"         // Every job of a live match failed or was cancelled
+	IssueAllocationJobEnded      = "allocation_job_ended"      // Allocation still held for a finished job
+
+	IssueMatchOfferMismatch   = "match_offer_mismatch"   // Live match whose offer is not reserved for it
+	IssueBidMissingOffer      = "bid_missing_offer"      // Matched bid pointing at an unknown offer
+	IssueJobUnknownMatch      = "job_unknown_match"      // Running job for a match the marketplace does not know
+	IssueAllocationUnknownJob = "allocation_unknown_job" // Allocation for a job the scheduler does not know
+)
+
+// Issue states
+const (
+	IssueOpen     = "open"
+	IssueRepaired = "repaired"
+	IssueResolved = "resolved"
+)
+
+// maxClosedIssues is the number of repaired and resolved issues retained
+const maxClosedIssues = 500
+
+// ConsistencyIssue is one inconsistency between offers, matches, jobs and
+// allocations
+type ConsistencyIssue struct {
+	ID         string     `json:"id"`
+	Kind       string     `json:"kind"`
+	Subject    string     `json:"subject"` // e.g. offer/<id>, allocation/<id>
+	Detail     string     `json:"detail"`
+	Status     string     `json:"status"`
+	Repair     string     `json:"repair,omitempty"` // What the checker changed
+	FirstSeen  time.Time  `json:"first_seen"`
+	LastSeen   time.Time  `json:"last_seen"`
+	ClosedAt   *time.Time `json:"closed_at,omitempty"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+	Note       string     `json:"note,omitempty"`
+}
+
+// ConsistencyRun summarizes one pass of the checker
+type ConsistencyRun struct {
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Offers      int       `json:"offers"`
+	Matches     int       `json:"matches"`
+	Jobs        int       `json:"jobs"`
+	Allocations int       `json:"allocations"`
+	Repaired    int       `json:"repaired"`
+	Reported    int       `json:"reported"` // Newly queued for an admin
+	Open        int       `json:"open"`
+	Errors      []string  `json:"errors,omitempty"` // Sources that could not be read; their checks were skipped
+}
+
+// schedulerJob is the part of a scheduler job the checker needs
+type schedulerJob struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	MatchID     string     `json:"match_id"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+// resourceAllocation is the part of a resource-service allocation the
+// checker needs
+type resourceAllocation struct {
+	ID        string    `json:"id"`
+	JobID     string    `json:"job_id"`
+	Status    string    `json:"status"`
+	StartTime time.Time `json:"start_time"`
+}
+
+// finding is an inconsistency seen during a pass
+type finding struct {
+	kind    string
+	subject string
+	detail  string
+	repair  string // Empty unless the checker fixed it
+}
+
+// ConsistencyChecker periodically cross-references the marketplace's offers
+// and matches with scheduler jobs and resource-service allocations.
+//
+// It runs every CONSISTENCY_CHECK_INTERVAL_SECONDS (default 300). Matches and
+// allocations younger than CONSISTENCY_GRACE_SECONDS (default 120) are left
+// alone, so state still propagating between services is not mistaken for an
+// inconsistency. Jobs are read from SCHEDULER_URL and allocations from
+// RESOURCE_SERVICE_URL. Repairs are logged and recorded; other issues stay
+// open in the admin queue until an admin resolves them or a later pass no
+// longer finds them.
+type ConsistencyChecker struct {
+	service      *MarketplaceService
+	httpClient   *http.Client
+	schedulerURL string
+	resourceURL  string
+	serviceToken string
+	interval     time.Duration
+	grace        time.Duration
+	open         map[string]*ConsistencyIssue // kind/subject -> issue
+	closed       []*ConsistencyIssue
+	lastRun      *ConsistencyRun
+	running      sync.Mutex // Serializes passes
+	mu           sync.Mutex
+
+	issuesFound *prometheus.CounterVec
+}
+
+// NewConsistencyChecker creates the checker from the environment
+func NewConsistencyChecker(s *MarketplaceService) *ConsistencyChecker {
+	schedulerURL := os.Getenv("SCHEDULER_URL")
+	if schedulerURL == "" {
+		schedulerURL = "http://scheduler-service:8002"
+	}
+	resourceURL := os.Getenv("RESOURCE_SERVICE_URL")
+	if resourceURL == "" {
+		resourceURL = "http://resource-service:8006"
+	}
+
+	c := &ConsistencyChecker{
+		service:      s,
+		httpClient:   &http.Client{Timeout: 30 * time.Second, Transport: obs.Transport(nil)},
+		schedulerURL: schedulerURL,
+		resourceURL:  resourceURL,
+		serviceToken: os.Getenv("SERVICE_TOKEN"),
+		interval:     time.Duration(envInt("CONSISTENCY_CHECK_INTERVAL_SECONDS", 300)) * time.Second,
+		grace:        time.Duration(envInt("CONSISTENCY_GRACE_SECONDS", 120)) * time.Second,
+		open:         make(map[string]*ConsistencyIssue),
+		issuesFound: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "marketplace_consistency_issues_total",
+			Help: "Inconsistencies found by the consistency checker",
+		}, []string{"kind", "outcome"}),
+	}
+	prometheus.MustRegister(c.issuesFound)
+	return c
+}
+
+func (c *ConsistencyChecker) run(ctx context.Context) {
+	if c.interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Check(ctx)
+		}
+	}
+}
+
+// Check runs one pass: it reads jobs and allocations, repairs what is safe to
+// repair and queues the rest
+func (c *ConsistencyChecker) Check(ctx context.Context) *ConsistencyRun {
+	c.running.Lock()
+	defer c.running.Unlock()
+
+	run := &ConsistencyRun{StartedAt: time.Now()}
+
+	jobs, err := c.fetchJobs(ctx)
+	if err != nil {
+		run.Errors = append(run.Errors, "jobs: "+err.Error())
+	}
+	allocations, err := c.fetchAllocations(ctx)
+	if err != nil {
+		run.Errors = append(run.Errors, "allocations: "+err.Error())
+	}
+	run.Jobs = len(jobs)
+	run.Allocations = len(allocations)
+
+	findings := c.checkMarketplace(ctx, run, jobs)
+	if jobs != nil && allocations != nil {
+		findings = append(findings, c.checkAllocations(ctx, jobs, allocations)...)
+	}
+
+	c.record(ctx, run, findings)
+	run.FinishedAt = time.Now()
+
+	c.mu.Lock()
+	c.lastRun = run
+	c.mu.Unlock()
+
+	if run.Repaired > 0 || run.Reported > 0 {
+		slog.InfoContext(ctx, "Consistency check found issues", "repaired", run.Repaired, "reported", run.Reported, "open", run.Open)
+	}
+	return run
+}
+
+// checkMarketplace cross-references offers, bids and matches with each other
+// and with scheduler jobs. jobs is nil when the scheduler could not be read,
+// which skips the checks that depend on it.
+func (c *ConsistencyChecker) checkMarketplace(ctx context.Context, run *ConsistencyRun, jobs map[string]*schedulerJob) []finding {
+	s := c.service
+	now := time.Now()
+
+	jobsByMatch := make(map[string][]*schedulerJob)
+	for _, job := range jobs {
+		if job.MatchID != "" {
+			jobsByMatch[job.MatchID] = append(jobsByMatch[job.MatchID], job)
+		}
+	}
+
+	var findings []finding
+	var reports []ExecutionReport
+	var failed []*Match
+
+	s.mu.Lock()
+	run.Offers = len(s.offers)
+	run.Matches = len(s.matches)
+
+	// Matches the scheduler gave up on release their offer
+	if jobs != nil {
+		for _, match := range s.matches {
+			if matchEnded(match) || now.Sub(match.CreatedAt) < c.grace {
+				continue
+			}
+			matchJobs := jobsByMatch[match.ID]
+			if len(matchJobs) == 0 || !allJobsFailed(matchJobs) {
+				continue
+			}
+
+			match.Status = "failed"
+			match.CompletedAt = &now
+			failed = append(failed, match)
+			f := finding{
+				kind:    IssueMatchJobsFailed,
+				subject: "match/" + match.ID,
+				detail:  fmt.Sprintf("all %d jobs of the match failed or were cancelled", len(matchJobs)),
+				repair:  "marked the match failed",
+			}
+			if offer, exists := s.offers[match.OfferID]; exists && offer.Status == "reserved" && offer.ReservationID == match.ID {
+				reports = append(reports, s.releaseReservation(offer, now, "match failed"))
+				f.repair += " and released offer " + offer.ID
+			}
+			findings = append(findings, f)
+		}
+	}
+
+	for _, offer := range s.offers {
+		if offer.Status != "reserved" {
+			continue
+		}
+		match, exists := s.matches[offer.ReservationID]
+		switch {
+		case !exists:
+			reports = append(reports, s.releaseReservation(offer, now, "reservation has no match"))
+			findings = append(findings, finding{
+				kind:    IssueReservationMissingMatch,
+				subject: "offer/" + offer.ID,
+				detail:  fmt.Sprintf("offer is reserved for unknown match %q", offer.ReservationID),
+				repair:  "released the reservation",
+			})
+		case match.OfferID != offer.ID:
+			findings = append(findings, finding{
+				kind:    IssueMatchOfferMismatch,
+				subject: "offer/" + offer.ID,
+				detail:  fmt.Sprintf("offer is reserved for match %s, which is for offer %s", match.ID, match.OfferID),
+			})
+		case matchEnded(match):
+			reports = append(reports, s.releaseReservation(offer, now, "match "+match.Status))
+			findings = append(findings, finding{
+				kind:    IssueReservationEndedMatch,
+				subject: "offer/" + offer.ID,
+				detail:  fmt.Sprintf("offer is still reserved for %s match %s", match.Status, match.ID),
+				repair:  "released the reservation",
+			})
+		}
+	}
+
+	for _, match := range s.matches {
+		if matchEnded(match) || now.Sub(match.CreatedAt) < c.grace {
+			continue
+		}
+		offer, exists := s.offers[match.OfferID]
+		if !exists {
+			findings = append(findings, finding{
+				kind:    IssueMatchOfferMismatch,
+				subject: "match/" + match.ID,
+				detail:  fmt.Sprintf("%s match is for unknown offer %s", match.Status, match.OfferID),
+			})
+		} else if offer.ReservationID != match.ID {
+			findings = append(findings, finding{
+				kind:    IssueMatchOfferMismatch,
+				subject: "match/" + match.ID,
+				detail:  fmt.Sprintf("%s match is for offer %s, which is %s with reservation %q", match.Status, offer.ID, offer.Status, offer.ReservationID),
+			})
+		}
+	}
+
+	for _, bid := range s.bids {
+		if bid.Status != "matched" {
+			continue
+		}
+		if _, exists := s.offers[bid.MatchedOfferID]; !exists {
+			findings = append(findings, finding{
+				kind:    IssueBidMissingOffer,
+				subject: "bid/" + bid.ID,
+				detail:  fmt.Sprintf("bid is matched to unknown offer %q", bid.MatchedOfferID),
+			})
+		}
+	}
+
+	for matchID, matchJobs := range jobsByMatch {
+		if _, exists := s.matches[matchID]; exists {
+			continue
+		}
+		for _, job := range matchJobs {
+			if jobEnded(job) {
+				continue
+			}
+			findings = append(findings, finding{
+				kind:    IssueJobUnknownMatch,
+				subject: "job/" + job.ID,
+				detail:  fmt.Sprintf("%s job runs under unknown match %s", job.Status, matchID),
+			})
+		}
+	}
+
+	if len(reports) > 0 {
+		s.updateActiveMetrics()
+	}
+	s.mu.Unlock()
+
+	for _, report := range reports {
+		s.executions.Report(report)
+	}
+	for _, match := range failed {
+		s.publishEvent(ctx, "match.failed", match)
+		s.broadcastUpdate("matches", map[string]interface{}{
+			"type": "match_failed",
+			"data": match,
+		})
+	}
+	return findings
+}
+
+// checkAllocations releases allocations of finished jobs and reports those
+// of jobs the scheduler does not know
+func (c *ConsistencyChecker) checkAllocations(ctx context.Context, jobs map[string]*schedulerJob, allocations []resourceAllocation) []finding {
+	now := time.Now()
+	var findings []finding
+
+	for _, allocation := range allocations {
+		if allocation.Status != "active" || now.Sub(allocation.StartTime) < c.grace {
+			continue
+		}
+		subject := "allocation/" + allocation.ID
+
+		job, exists := jobs[allocation.JobID]
+		if !exists {
+			findings = append(findings, finding{
+				kind:    IssueAllocationUnknownJob,
+				subject: subject,
+				detail:  fmt.Sprintf("allocation is held for unknown job %q", allocation.JobID),
+			})
+			continue
+		}
+		if !jobEnded(job) || (job.CompletedAt != nil && now.Sub(*job.CompletedAt) < c.grace) {
+			continue
+		}
+
+		f := finding{
+			kind:    IssueAllocationJobEnded,
+			subject: subject,
+			detail:  fmt.Sprintf("allocation is still held for %s job %s", job.Status, job.ID),
+			repair:  "released the allocation",
+		}
+		if err := c.releaseAllocation(ctx, allocation.ID); err != nil {
+			obs.LogError(ctx, "Failed to release allocation of finished job", err, "allocation_id", allocation.ID, "job_id", job.ID)
+			f.repair = ""
+			f.detail += "; release failed: " + err.Error()
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// record applies a pass's findings to the admin queue. Open issues the pass
+// no longer finds are resolved, unless a source could not be read.
+func (c *ConsistencyChecker) record(ctx context.Context, run *ConsistencyRun, findings []finding) {
+	now := time.Now()
+	seen := make(map[string]bool, len(findings))
+	var queued []ConsistencyIssue
+
+	c.mu.Lock()
+	for _, f := range findings {
+		if f.repair != "" {
+			issue := &ConsistencyIssue{
+				ID:        generateID(),
+				Kind:      f.kind,
+				Subject:   f.subject,
+				Detail:    f.detail,
+				Status:    IssueRepaired,
+				Repair:    f.repair,
+				FirstSeen: now,
+				LastSeen:  now,
+				ClosedAt:  &now,
+			}
+			c.close(issue)
+			run.Repaired++
+			c.issuesFound.WithLabelValues(f.kind, IssueRepaired).Inc()
+			slog.InfoContext(ctx, "Repaired inconsistency", "kind", f.kind, "subject", f.subject, "repair", f.repair)
+			continue
+		}
+
+		key := f.kind + "/" + f.subject
+		seen[key] = true
+		if issue, exists := c.open[key]; exists {
+			issue.Detail = f.detail
+			issue.LastSeen = now
+			continue
+		}
+		issue := &ConsistencyIssue{
+			ID:        generateID(),
+			Kind:      f.kind,
+			Subject:   f.subject,
+			Detail:    f.detail,
+			Status:    IssueOpen,
+			FirstSeen: now,
+			LastSeen:  now,
+		}
+		c.open[key] = issue
+		queued = append(queued, *issue)
+		run.Reported++
+		c.issuesFound.WithLabelValues(f.kind, "reported").Inc()
+	}
+
+	if len(run.Errors) == 0 {
+		for key, issue := range c.open {
+			if seen[key] {
+				continue
+			}
+			issue.Status = IssueResolved
+			issue.ClosedAt = &now
+			issue.ResolvedBy = "checker"
+			delete(c.open, key)
+			c.close(issue)
+		}
+	}
+	run.Open = len(c.open)
+	c.mu.Unlock()
+
+	for i := range queued {
+		slog.WarnContext(ctx, "Queued inconsistency for review", "kind", queued[i].Kind, "subject", queued[i].Subject, "detail", queued[i].Detail)
+		c.service.publishEvent(ctx, "marketplace.consistency.issue", &queued[i])
+	}
+}
+
+// close retains a repaired or resolved issue. Callers hold c.mu.
+func (c *ConsistencyChecker) close(issue *ConsistencyIssue) {
+	c.closed = append(c.closed, issue)
+	if len(c.closed) > maxClosedIssues {
+		c.closed = c.closed[len(c.closed)-maxClosedIssues:]
+	}
+}
+
+// releaseReservation returns a reserved offer to the book, or expires it if
+// it lapsed while reserved. Callers hold s.mu.
+func (s *MarketplaceService) releaseReservation(offer *Offer, now time.Time, text string) ExecutionReport {
+	offer.ReservationID = ""
+	offer.UpdatedAt = now
+	if now.After(offer.ExpiresAt) {
+		offer.Status = "expired"
+		return offerReport(offer, ExecExpired, text)
+	}
+	offer.Status = "active"
+	return offerReport(offer, ExecRestated, text)
+}
+
+func matchEnded(match *Match) bool {
+	return match.Status == "completed" || match.Status == "failed" || match.Status == "cancelled"
+}
+
+func jobEnded(job *schedulerJob) bool {
+	return job.Status == "completed" || job.Status == "failed" || job.Status == "cancelled"
+}
+
+// allJobsFailed reports whether none of a match's jobs ran to completion or
+// can still run
+func allJobsFailed(jobs []*schedulerJob) bool {
+	for _, job := range jobs {
+		if job.Status != "failed" && job.Status != "cancelled" {
+			return false
+		}
+	}
+	return true
+}
+
+// Source reads
+
+func (c *ConsistencyChecker) fetchJobs(ctx context.Context) (map[string]*schedulerJob, error) {
+	var list []*schedulerJob
+	if err := c.get(ctx, c.schedulerURL+"/api/v1/jobs", &list); err != nil {
+		return nil, err
+	}
+	jobs := make(map[string]*schedulerJob, len(list))
+	for _, job := range list {
+		jobs[job.ID] = job
+	}
+	return jobs, nil
+}
+
+func (c *ConsistencyChecker) fetchAllocations(ctx context.Context) ([]resourceAllocation, error) {
+	allocations := []resourceAllocation{}
+	if err := c.get(ctx, c.resourceURL+"/api/v1/allocations?status=active", &allocations); err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
+
+func (c *ConsistencyChecker) get(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.serviceToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return obs.ResponseError(resp, "GET %s", url)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *ConsistencyChecker) releaseAllocation(ctx context.Context, allocationID string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/v1/allocations/%s/release", c.resourceURL, allocationID), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.serviceToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return obs.ResponseError(resp, "allocation %s not released", allocationID)
+	}
+	return nil
+}
+
+// HTTP Handlers
+
+// GetConsistency returns the last pass and the admin queue. ?status=
+// repaired, resolved or all lists closed issues instead of open ones.
+func (c *ConsistencyChecker) GetConsistency(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = IssueOpen
+	}
+	if status != IssueOpen && status != IssueRepaired && status != IssueResolved && status != "all" {
+		http.Error(w, "status must be open, repaired, resolved or all", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	issues := make([]ConsistencyIssue, 0)
+	if status == IssueOpen || status == "all" {
+		for _, issue := range c.open {
+			issues = append(issues, *issue)
+		}
+	}
+	if status != IssueOpen {
+		for _, issue := range c.closed {
+			if status == "all" || issue.Status == status {
+				issues = append(issues, *issue)
+			}
+		}
+	}
+	lastRun := c.lastRun
+	c.mu.Unlock()
+
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].FirstSeen.After(issues[j].FirstSeen)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"last_run": lastRun,
+		"issues":   issues,
+	})
+}
+
+// RunConsistencyCheck runs a pass right away and returns its summary
+func (c *ConsistencyChecker) RunConsistencyCheck(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+	run := c.Check(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(run)
+}
+
+// ResolveConsistencyIssue closes a queued issue an admin dealt with
+func (c *ConsistencyChecker) ResolveConsistencyIssue(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	issueID := mux.Vars(r)["id"]
+	claims := r.Context().Value("claims").(*Claims)
+	now := time.Now()
+
+	c.mu.Lock()
+	var resolved *ConsistencyIssue
+	for key, issue := range c.open {
+		if issue.ID != issueID {
+			continue
+		}
+		issue.Status = IssueResolved
+		issue.ClosedAt = &now
+		issue.ResolvedBy = claims.UserID
+		issue.Note = req.Note
+		delete(c.open, key)
+		c.close(issue)
+		resolved = issue
+		break
+	}
+	var result ConsistencyIssue
+	if resolved != nil {
+		result = *resolved
+	}
+	c.mu.Unlock()
+
+	if resolved == nil {
+		http.Error(w, "Open issue not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
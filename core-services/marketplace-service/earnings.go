@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// EarningsSimulationRequest describes hardware a prospective provider is
+// considering listing
+type EarningsSimulationRequest struct {
+	Resources    ResourceSpecification      `json:"resources"`
+	Region       string                     `json:"region,omitempty"`   // Price index region, defaults to the local region
+	Location     string                     `json:"location,omitempty"` // Offer location within the region
+	PricePerHour map[string]decimal.Decimal `json:"price_per_hour,omitempty"`
+	Features     []string                   `json:"features,omitempty"`
+	HoursPerDay  float64                    `json:"hours_per_day,omitempty"`
+	LookbackDays int                        `json:"lookback_days,omitempty"`
+}
+
+// EarningsScenario is one projected outcome of a simulation
+type EarningsScenario struct {
+	Utilization    float64         `json:"utilization"` // Fraction of available hours rented
+	RentedHours    float64         `json:"rented_hours_per_day"`
+	DailyRevenue   decimal.Decimal `json:"daily_revenue"`
+	MonthlyRevenue decimal.Decimal `json:"monthly_revenue"`
+}
+
+// EarningsSimulation is the projected utilization and revenue for a hardware
+// spec, derived from marketplace demand over the lookback window
+type EarningsSimulation struct {
+	Region         string                     `json:"region"`
+	Location       string                     `json:"location,omitempty"`
+	PricePerHour   map[string]decimal.Decimal `json:"price_per_hour"`
+	LookbackDays   int                        `json:"lookback_days"`
+	HoursPerDay    float64                    `json:"hours_per_day"`
+	BidsObserved   int                        `json:"bids_observed"`
+	BidsEligible   int                        `json:"bids_eligible"` // Bids this hardware could have served
+	MatchRate      float64                    `json:"match_rate"`    // Share of observed bids that matched
+	AvgCompetitors float64                    `json:"avg_competitors"`
+	Low            EarningsScenario           `json:"low"`
+	Expected       EarningsScenario           `json:"expected"`
+	High           EarningsScenario           `json:"high"`
+	Confidence     string                     `json:"confidence"` // low, medium, high
+	Assumptions    []string                   `json:"assumptions"`
+}
+
+// SimulateEarnings estimates what a hardware spec would earn if listed now.
+// Recent bids are replayed against a simulated offer priced at the requested
+// prices (or the price index medians); each bid it could serve contributes its
+// revenue weighted by the market match rate and the hardware's share of the
+// competing offers that could also have served it.
+func (s *MarketplaceService) SimulateEarnings(w http.ResponseWriter, r *http.Request) {
+	var req EarningsSimulationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Resources.CPU.Cores <= 0 || req.Resources.Memory.TotalMB <= 0 {
+		http.Error(w, "CPU cores and memory must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.HoursPerDay <= 0 || req.HoursPerDay > 24 {
+		req.HoursPerDay = 24
+	}
+	if req.LookbackDays <= 0 {
+		req.LookbackDays = 7
+	}
+	if req.LookbackDays > 30 {
+		req.LookbackDays = 30
+	}
+
+	index := s.priceIndex.LocalIndex()
+	if req.Region != "" && req.Region != index.Region {
+		s.priceIndex.mu.RLock()
+		index = s.priceIndex.remote[req.Region]
+		s.priceIndex.mu.RUnlock()
+		if index == nil {
+			http.Error(w, "Unknown region", http.StatusNotFound)
+			return
+		}
+	}
+
+	prices := make(map[string]decimal.Decimal)
+	for resource, price := range indexPrices(index, req.Location) {
+		prices[resource] = price
+	}
+	for resource, price := range req.PricePerHour {
+		prices[resource] = price
+	}
+	if _, ok := prices["cpu"]; !ok {
+		http.Error(w, "No market price available for this region; set price_per_hour", http.StatusUnprocessableEntity)
+		return
+	}
+
+	sim := s.simulateEarnings(req, index.Region, prices)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sim)
+}
+
+func (s *MarketplaceService) simulateEarnings(req EarningsSimulationRequest, region string, prices map[string]decimal.Decimal) *EarningsSimulation {
+	now := time.Now()
+	since := now.AddDate(0, 0, -req.LookbackDays)
+
+	candidate := &Offer{
+		Resources:    req.Resources,
+		PricePerHour: prices,
+		Location:     req.Location,
+		Features:     req.Features,
+		Status:       "active",
+	}
+	candidate.Availability.StartTime = time.Time{}
+	candidate.Availability.EndTime = now.AddDate(100, 0, 0)
+
+	sim := &EarningsSimulation{
+		Region:       region,
+		Location:     req.Location,
+		PricePerHour: prices,
+		LookbackDays: req.LookbackDays,
+		HoursPerDay:  req.HoursPerDay,
+	}
+
+	type eligibleBid struct {
+		hours       float64
+		revenue     decimal.Decimal
+		competitors int
+	}
+	var eligible []eligibleBid
+	matched := 0
+
+	s.mu.RLock()
+	for _, bid := range s.bids {
+		if bid.CreatedAt.Before(since) || bid.Status == "cancelled" {
+			continue
+		}
+		sim.BidsObserved++
+		if bid.Status == "matched" {
+			matched++
+		}
+
+		if !s.matcher.offerMeetsRequirements(candidate, bid) || !offerServesGPUTypes(candidate, bid) {
+			continue
+		}
+
+		competitors := 0
+		for _, offer := range s.offers {
+			if offer.Status == "cancelled" || offer.Status == "expired" {
+				continue
+			}
+			if s.matcher.offerMeetsRequirements(offer, bid) && offerServesGPUTypes(offer, bid) {
+				competitors++
+			}
+		}
+
+		eligible = append(eligible, eligibleBid{
+			hours:       bid.Duration.Hours(),
+			revenue:     s.matcher.calculateOfferPrice(candidate, bid).Mul(decimal.NewFromFloat(bid.Duration.Hours())),
+			competitors: competitors,
+		})
+	}
+	s.mu.RUnlock()
+
+	sim.BidsEligible = len(eligible)
+	if sim.BidsObserved > 0 {
+		sim.MatchRate = float64(matched) / float64(sim.BidsObserved)
+	}
+
+	// Expected case: win a fair share of each eligible bid against the offers
+	// that could also have served it. High case: win every eligible bid the
+	// market filled. Low case: half the expected share.
+	var expectedHours, highHours float64
+	expectedRevenue, highRevenue := decimal.Zero, decimal.Zero
+	totalCompetitors := 0
+	for _, bid := range eligible {
+		share := sim.MatchRate / float64(bid.competitors+1)
+		expectedHours += bid.hours * share
+		expectedRevenue = expectedRevenue.Add(bid.revenue.Mul(decimal.NewFromFloat(share)))
+		highHours += bid.hours * sim.MatchRate
+		highRevenue = highRevenue.Add(bid.revenue.Mul(decimal.NewFromFloat(sim.MatchRate)))
+		totalCompetitors += bid.competitors
+	}
+	if len(eligible) > 0 {
+		sim.AvgCompetitors = float64(totalCompetitors) / float64(len(eligible))
+	}
+
+	availableHours := float64(req.LookbackDays) * req.HoursPerDay
+	days := float64(req.LookbackDays)
+	sim.Expected = earningsScenario(expectedHours, expectedRevenue, availableHours, days)
+	sim.High = earningsScenario(highHours, highRevenue, availableHours, days)
+	sim.Low = earningsScenario(expectedHours/2, expectedRevenue.Div(decimal.NewFromInt(2)), availableHours, days)
+
+	switch {
+	case sim.BidsEligible >= 50:
+		sim.Confidence = "high"
+	case sim.BidsEligible >= 10:
+		sim.Confidence = "medium"
+	default:
+		sim.Confidence = "low"
+	}
+
+	sim.Assumptions = []string{
+		"Demand is replayed from bids placed on this marketplace over the lookback window",
+		"Each eligible bid is won in proportion to the offers that could also have served it",
+		"The hardware is rented to one bid at a time and only during the available hours per day",
+		"Revenue is gross of payment processing and platform fees",
+	}
+	if _, ok := req.PricePerHour["cpu"]; !ok {
+		sim.Assumptions = append(sim.Assumptions, "Prices default to the regional price index median")
+	}
+
+	return sim
+}
+
+// earningsScenario converts rented hours and revenue over the lookback window
+// into daily and monthly figures, capping rented hours at what is available
+func earningsScenario(hours float64, revenue decimal.Decimal, availableHours, days float64) EarningsScenario {
+	if hours > availableHours && hours > 0 {
+		revenue = revenue.Mul(decimal.NewFromFloat(availableHours / hours))
+		hours = availableHours
+	}
+
+	daily := revenue.Div(decimal.NewFromFloat(days))
+	return EarningsScenario{
+		Utilization:    math.Round(hours/availableHours*1000) / 1000,
+		RentedHours:    math.Round(hours/days*100) / 100,
+		DailyRevenue:   daily.Round(2),
+		MonthlyRevenue: daily.Mul(decimal.NewFromInt(30)).Round(2),
+	}
+}
+
+// indexPrices returns the median price per resource from an index, preferring
+// entries for the given location and falling back to the median across all
+// locations in the region
+func indexPrices(index *RegionPriceIndex, location string) map[string]decimal.Decimal {
+	prices := make(map[string]decimal.Decimal)
+	regional := make(map[string][]decimal.Decimal)
+
+	for _, entry := range index.Entries {
+		if location != "" && entry.Location == location {
+			prices[entry.Resource] = entry.Median
+		}
+		regional[entry.Resource] = append(regional[entry.Resource], entry.Median)
+	}
+
+	for resource, medians := range regional {
+		if _, ok := prices[resource]; ok {
+			continue
+		}
+		sum := decimal.Zero
+		for _, median := range medians {
+			sum = sum.Add(median)
+		}
+		prices[resource] = sum.Div(decimal.NewFromInt(int64(len(medians))))
+	}
+
+	return prices
+}
+
+// offerServesGPUTypes reports whether an offer has enough GPUs of one of the
+// bid's accepted GPU types
+func offerServesGPUTypes(offer *Offer, bid *Bid) bool {
+	if len(bid.Requirements.GPUTypes) == 0 {
+		return true
+	}
+	for _, model := range bid.Requirements.GPUTypes {
+		if offerHasGPUType(offer, model, bid.Requirements.MinGPU) {
+			return true
+		}
+	}
+	return false
+}
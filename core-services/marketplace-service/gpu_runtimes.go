@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/computehive/core-services/pkg/gpuruntime"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/nats-io/nats.go"
+)
+
+// subscribeToAgentGPURuntime follows the GPU driver and runtime versions
+// agents report to the scheduler, so offers show them and bids needing newer
+// ones skip the offers
+func (s *MarketplaceService) subscribeToAgentGPURuntime() {
+	s.bus.Subscribe("agent.gpu_runtime", func(ctx context.Context, msg *nats.Msg) error {
+		var event struct {
+			AgentID    string               `json:"agent_id"`
+			GPURuntime *gpuruntime.Versions `json:"gpu_runtime"`
+		}
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		if event.AgentID == "" {
+			return obs.Errorf(obs.CodeInvalidArgument, "GPU runtime event has no agent_id")
+		}
+		if event.GPURuntime.IsZero() {
+			event.GPURuntime = nil
+		}
+		s.setAgentGPURuntime(ctx, event.AgentID, event.GPURuntime)
+		return nil
+	})
+}
+
+// setAgentGPURuntime records an agent's GPU runtime and restates the offers
+// it serves
+func (s *MarketplaceService) setAgentGPURuntime(ctx context.Context, agentID string, versions *gpuruntime.Versions) {
+	var changed []*Offer
+
+	s.mu.Lock()
+	if versions == nil {
+		delete(s.gpuRuntimes, agentID)
+	} else {
+		s.gpuRuntimes[agentID] = versions
+	}
+	for _, offer := range s.offers {
+		if offer.AgentID != agentID {
+			continue
+		}
+		offer.GPURuntime = versions
+		offer.UpdatedAt = time.Now()
+		if offer.Status == "active" {
+			snapshot := *offer
+			changed = append(changed, &snapshot)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, offer := range changed {
+		s.broadcastUpdate("offers", map[string]interface{}{
+			"type": "offer_gpu_runtime_changed",
+			"data": offer,
+		})
+	}
+	slog.InfoContext(ctx, "Agent GPU runtime updated", "agent_id", agentID, "gpu_runtime", versions, "active_offers", len(changed))
+}
@@ -4,13 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/computehive/core-services/pkg/events"
+	"github.com/computehive/core-services/pkg/gpuruntime"
+	"github.com/computehive/core-services/pkg/health"
+	"github.com/computehive/core-services/pkg/maintenance"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/computehive/core-services/pkg/trust"
+	"github.com/computehive/core-services/pkg/wshub"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -28,17 +35,24 @@ type Offer struct {
 	AgentID         string                 `json:"agent_id"`
 	Resources       ResourceSpecification  `json:"resources"`
 	PricePerHour    map[string]decimal.Decimal `json:"price_per_hour"`
+	PriceFloor      map[string]decimal.Decimal `json:"price_floor,omitempty"` // Minimum price per unit hour the offer trades at
 	MinDuration     time.Duration          `json:"min_duration"`
 	MaxDuration     time.Duration          `json:"max_duration"`
 	Availability    AvailabilityWindow     `json:"availability"`
 	Location        string                 `json:"location"`
 	Features        []string               `json:"features"`
 	SLAGuarantees   SLAGuarantees          `json:"sla_guarantees"`
-	Status          string                 `json:"status"` // active, reserved, expired
+	Status          string                 `json:"status"` // active, reserved, expired, cancelled
 	CreatedAt       time.Time              `json:"created_at"`
 	UpdatedAt       time.Time              `json:"updated_at"`
 	ExpiresAt       time.Time              `json:"expires_at"`
 	ReservationID   string                 `json:"reservation_id,omitempty"`
+	TimeInForce     string                 `json:"time_in_force,omitempty"` // GTC, GTT
+	ClientOrderID   string                 `json:"client_order_id,omitempty"`
+	ExpiredReason   string                 `json:"expired_reason,omitempty"` // agent_offline when its agent stopped heartbeating
+	TrustTier       trust.Tier             `json:"trust_tier"` // Of the agent serving the offer, set by the scheduler
+	GPURuntime      *gpuruntime.Versions   `json:"gpu_runtime,omitempty"` // Driver and CUDA/ROCm versions of the agent, reported by the scheduler
+	Maintenance     []maintenance.Window   `json:"maintenance_windows,omitempty"` // Recurring windows the provider takes the agent down in
 }
 
 // Bid represents a request for compute resources
@@ -56,6 +70,9 @@ type Bid struct {
 	CreatedAt        time.Time              `json:"created_at"`
 	ExpiresAt        time.Time              `json:"expires_at"`
 	MatchedOfferID   string                 `json:"matched_offer_id,omitempty"`
+	TimeInForce      string                 `json:"time_in_force,omitempty"` // GTC, GTT, FOK
+	ClientOrderID    string                 `json:"client_order_id,omitempty"`
+	PriorityTime     time.Time              `json:"priority_time"` // Orders time among bids at the same price
 }
 
 // Match represents a matched bid and offer
@@ -68,11 +85,12 @@ type Match struct {
 	AgreedPrice    decimal.Decimal `json:"agreed_price"`
 	StartTime      time.Time       `json:"start_time"`
 	EndTime        time.Time       `json:"end_time"`
-	Status         string          `json:"status"` // pending, confirmed, active, completed, disputed
+	Status         string          `json:"status"` // pending, confirmed, active, completed, failed, disputed
 	ContractHash   string          `json:"contract_hash,omitempty"`
 	CreatedAt      time.Time       `json:"created_at"`
 	ConfirmedAt    *time.Time      `json:"confirmed_at,omitempty"`
 	CompletedAt    *time.Time      `json:"completed_at,omitempty"`
+	Maintenance    []maintenance.Occurrence `json:"upcoming_maintenance,omitempty"` // Planned downtime of the agent between start and end
 }
 
 // ResourceSpecification details what resources are available
@@ -93,6 +111,8 @@ type ResourceRequirements struct {
 	MinStorage  int      `json:"min_storage_mb"`
 	MinNetwork  int      `json:"min_network_mbps"`
 	Features    []string `json:"required_features,omitempty"`
+	MinTrustTier trust.Tier `json:"min_trust_tier,omitempty"` // Least trusted agent tier accepted
+	gpuruntime.Requirements // Minimum GPU driver, CUDA and ROCm versions
 }
 
 // Resource specification types
@@ -147,10 +167,20 @@ type MarketplaceService struct {
 	matches     map[string]*Match
 	mu          sync.RWMutex
 	nats        *nats.Conn
+	bus         *events.Bus
 	matcher     *MatchingEngine
 	wsUpgrader  websocket.Upgrader
-	subscribers map[string]map[*websocket.Conn]bool // topic -> connections
-	subMu       sync.RWMutex
+	wsHub       *wshub.Hub
+	priceIndex  *PriceIndexReplicator
+	onboarding  *Onboarding
+	quotes      *QuoteBook
+	executions  *ExecutionReports
+	floors      *PriceFloors
+	consistency *ConsistencyChecker
+	makers      *MarketMakers
+	agentTiers  map[string]trust.Tier // Agent trust tiers published by the scheduler
+	gpuRuntimes map[string]*gpuruntime.Versions // Agent GPU runtimes published by the scheduler
+	maintenance map[string][]maintenance.Window // Agent maintenance windows published by the scheduler
 	
 	// Metrics
 	offersCreated   prometheus.Counter
@@ -179,12 +209,22 @@ func NewMarketplaceService() (*MarketplaceService, error) {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 	
+	// Match confirmations and agent lifecycle events go through JetStream
+	bus, err := events.Connect(nc, "marketplace-service")
+	if err != nil {
+		return nil, err
+	}
+	
 	s := &MarketplaceService{
 		offers:      make(map[string]*Offer),
 		bids:        make(map[string]*Bid),
 		matches:     make(map[string]*Match),
+		agentTiers:  make(map[string]trust.Tier),
+		gpuRuntimes: make(map[string]*gpuruntime.Versions),
+		maintenance: make(map[string][]maintenance.Window),
 		nats:        nc,
-		subscribers: make(map[string]map[*websocket.Conn]bool),
+		bus:         bus,
+		wsHub:       wshub.New("marketplace", wshub.Config{}),
 		wsUpgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				// Configure this properly in production
@@ -226,6 +266,9 @@ func NewMarketplaceService() (*MarketplaceService, error) {
 		s.matchingTime, s.activeOffers, s.activeBids,
 	)
 	
+	// Provider price floors, enforced by the matching engine
+	s.floors = NewPriceFloors(s)
+	
 	// Create matching engine
 	s.matcher = &MatchingEngine{
 		service: s,
@@ -235,6 +278,30 @@ func NewMarketplaceService() (*MarketplaceService, error) {
 	// Start matching engine
 	go s.matcher.run()
 	
+	// Start price index publication and cross-region replication
+	s.priceIndex = NewPriceIndexReplicator(s)
+	go s.priceIndex.run(context.Background())
+	
+	// Provider onboarding and offer visibility gates
+	s.onboarding = NewOnboarding(s)
+	s.onboarding.subscribe()
+	
+	// Binding price quotes
+	s.quotes = NewQuoteBook(s)
+	go s.quotes.run(context.Background())
+	
+	// Market makers, their quotes and obligations
+	s.makers = NewMarketMakers(s)
+	go s.makers.run(context.Background())
+	
+	// Execution reports and expiry of resting orders
+	s.executions = NewExecutionReports()
+	go s.expireOrders()
+	
+	// Cross-check offers and matches with scheduler jobs and allocations
+	s.consistency = NewConsistencyChecker(s)
+	go s.consistency.run(context.Background())
+	
 	// Subscribe to events
 	s.subscribeToEvents()
 	
@@ -261,14 +328,36 @@ func (s *MarketplaceService) CreateOffer(w http.ResponseWriter, r *http.Request)
 	offer.CreatedAt = time.Now()
 	offer.UpdatedAt = time.Now()
 	
+	// Time-in-force flags are part of the institutional order API
+	if offer.TimeInForce != "" {
+		if !s.institutional(claims) {
+			http.Error(w, "Time-in-force orders require a KYC-verified institutional account", http.StatusForbidden)
+			return
+		}
+		if err := applyTimeInForce(offer.TimeInForce, &offer.ExpiresAt, "offer"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	
 	// Validate offer
 	if err := s.validateOffer(&offer); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	
-	// Store offer
+	// Unverified providers may only list small offers
+	if err := s.onboarding.checkOfferAllowed(&offer); err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+	
+	// Store offer, showing the trust tier, GPU runtime and maintenance windows
+	// of the agent serving it
 	s.mu.Lock()
+	offer.TrustTier = s.agentTier(offer.AgentID)
+	offer.GPURuntime = s.gpuRuntimes[offer.AgentID]
+	offer.Maintenance = s.maintenance[offer.AgentID]
 	s.offers[offer.ID] = &offer
 	s.mu.Unlock()
 	
@@ -277,7 +366,8 @@ func (s *MarketplaceService) CreateOffer(w http.ResponseWriter, r *http.Request)
 	s.updateActiveMetrics()
 	
 	// Publish event
-	s.publishEvent("offer.created", &offer)
+	s.executions.Report(offerReport(&offer, ExecNew, ""))
+	s.publishEvent(r.Context(), "offer.created", &offer)
 	
 	// Broadcast to WebSocket subscribers
 	s.broadcastUpdate("offers", map[string]interface{}{
@@ -305,6 +395,19 @@ func (s *MarketplaceService) CreateBid(w http.ResponseWriter, r *http.Request) {
 	bid.ID = generateID()
 	bid.Status = "pending"
 	bid.CreatedAt = time.Now()
+	bid.PriorityTime = bid.CreatedAt
+	
+	// Time-in-force flags are part of the institutional order API
+	if bid.TimeInForce != "" {
+		if !s.institutional(claims) {
+			http.Error(w, "Time-in-force orders require a KYC-verified institutional account", http.StatusForbidden)
+			return
+		}
+		if err := applyTimeInForce(bid.TimeInForce, &bid.ExpiresAt, "bid"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 	
 	// Validate bid
 	if err := s.validateBid(&bid); err != nil {
@@ -322,7 +425,8 @@ func (s *MarketplaceService) CreateBid(w http.ResponseWriter, r *http.Request) {
 	s.updateActiveMetrics()
 	
 	// Publish event
-	s.publishEvent("bid.created", &bid)
+	s.executions.Report(bidReport(&bid, ExecNew, ""))
+	s.publishEvent(r.Context(), "bid.created", &bid)
 	
 	// Broadcast to WebSocket subscribers
 	s.broadcastUpdate("bids", map[string]interface{}{
@@ -330,8 +434,12 @@ func (s *MarketplaceService) CreateBid(w http.ResponseWriter, r *http.Request) {
 		"data": bid,
 	})
 	
-	// Trigger immediate matching attempt
-	go s.matcher.matchBid(&bid)
+	// Fill-or-kill bids match now or never; others get an immediate attempt
+	if bid.TimeInForce == TimeInForceFOK {
+		s.fillOrKill(r.Context(), &bid)
+	} else {
+		go s.matcher.matchBid(&bid)
+	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(bid)
@@ -344,6 +452,20 @@ func (s *MarketplaceService) ListOffers(w http.ResponseWriter, r *http.Request)
 	minMemory := r.URL.Query().Get("min_memory")
 	maxPrice := r.URL.Query().Get("max_price")
 	location := r.URL.Query().Get("location")
+	minTier, err := trust.Parse(r.URL.Query().Get("min_trust_tier"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	minRuntime := gpuruntime.Requirements{
+		MinDriverVersion: r.URL.Query().Get("min_driver_version"),
+		MinCUDAVersion:   r.URL.Query().Get("min_cuda_version"),
+		MinROCmVersion:   r.URL.Query().Get("min_rocm_version"),
+	}
+	if err := minRuntime.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -363,6 +485,14 @@ func (s *MarketplaceService) ListOffers(w http.ResponseWriter, r *http.Request)
 			continue
 		}
 		
+		if !offer.TrustTier.Meets(minTier) {
+			continue
+		}
+		
+		if minRuntime.Unmet(offer.GPURuntime) != "" {
+			continue
+		}
+		
 		filteredOffers = append(filteredOffers, offer)
 	}
 	
@@ -378,6 +508,28 @@ func (s *MarketplaceService) ListOffers(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(filteredOffers)
 }
 
+// GetOffer retrieves an offer in any status
+func (s *MarketplaceService) GetOffer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	offerID := vars["id"]
+	
+	s.mu.RLock()
+	offer, exists := s.offers[offerID]
+	var snapshot Offer
+	if exists {
+		snapshot = *offer
+	}
+	s.mu.RUnlock()
+	
+	if !exists {
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
 // GetMatch retrieves match details
 func (s *MarketplaceService) GetMatch(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -447,7 +599,7 @@ func (s *MarketplaceService) ConfirmMatch(w http.ResponseWriter, r *http.Request
 	s.mu.Unlock()
 	
 	// Publish confirmation event
-	s.publishEvent("match.confirmed", match)
+	s.publishEvent(r.Context(), "match.confirmed", match)
 	
 	// Broadcast update
 	s.broadcastUpdate("matches", map[string]interface{}{
@@ -462,43 +614,18 @@ func (s *MarketplaceService) ConfirmMatch(w http.ResponseWriter, r *http.Request
 func (s *MarketplaceService) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	conn, err := s.wsUpgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		slog.WarnContext(r.Context(), "WebSocket upgrade failed", obs.KeyError, err)
 		return
 	}
-	defer conn.Close()
 	
 	// Subscribe to topics based on query parameters
 	topics := r.URL.Query()["topic"]
 	if len(topics) == 0 {
-		topics = []string{"offers", "bids", "matches"} // Subscribe to all by default
-	}
-	
-	// Register connection
-	s.subMu.Lock()
-	for _, topic := range topics {
-		if s.subscribers[topic] == nil {
-			s.subscribers[topic] = make(map[*websocket.Conn]bool)
-		}
-		s.subscribers[topic][conn] = true
+		topics = []string{"offers", "bids", "matches", "quotes"} // Subscribe to all by default
 	}
-	s.subMu.Unlock()
 	
-	// Unregister on disconnect
-	defer func() {
-		s.subMu.Lock()
-		for _, topic := range topics {
-			delete(s.subscribers[topic], conn)
-		}
-		s.subMu.Unlock()
-	}()
-	
-	// Keep connection alive
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			break
-		}
-	}
+	// The hub writes to the connection; this goroutine only reads
+	s.wsHub.Register(conn, topics...).ReadPump()
 }
 
 // Matching Engine implementation
@@ -532,9 +659,12 @@ func (me *MatchingEngine) performMatching() {
 	
 	me.service.mu.RUnlock()
 	
-	// Sort bids by price (highest first)
+	// Sort bids by price (highest first), then by time priority
 	sort.Slice(activeBids, func(i, j int) bool {
-		return activeBids[i].MaxPricePerHour.GreaterThan(activeBids[j].MaxPricePerHour)
+		if !activeBids[i].MaxPricePerHour.Equal(activeBids[j].MaxPricePerHour) {
+			return activeBids[i].MaxPricePerHour.GreaterThan(activeBids[j].MaxPricePerHour)
+		}
+		return activeBids[i].PriorityTime.Before(activeBids[j].PriorityTime)
 	})
 	
 	// Match bids with offers
@@ -586,6 +716,7 @@ func (me *MatchingEngine) matchBid(bid *Bid) {
 			EndTime:     bid.StartTime.Add(bid.Duration),
 			Status:      "pending",
 			CreatedAt:   time.Now(),
+			Maintenance: maintenance.Upcoming(bestOffer.Maintenance, bid.StartTime, bid.StartTime.Add(bid.Duration)),
 		}
 		
 		me.service.matches[match.ID] = match
@@ -599,9 +730,11 @@ func (me *MatchingEngine) matchBid(bid *Bid) {
 		// Update metrics
 		me.service.matchesCreated.Inc()
 		me.service.updateActiveMetrics()
+		me.service.reportTrade(match, bid, bestOffer)
+		me.service.makers.recordTrade(match, bid, bestOffer)
 		
 		// Publish match event
-		me.service.publishEvent("match.created", match)
+		me.service.publishEvent(context.Background(), "match.created", match)
 		
 		// Broadcast update
 		me.service.broadcastUpdate("matches", map[string]interface{}{
@@ -609,7 +742,7 @@ func (me *MatchingEngine) matchBid(bid *Bid) {
 			"data": match,
 		})
 		
-		log.Printf("Created match %s: bid %s with offer %s", match.ID, bid.ID, bestOffer.ID)
+		slog.Info("Created match", "match_id", match.ID, "bid_id", bid.ID, "offer_id", bestOffer.ID)
 	}
 }
 
@@ -643,10 +776,10 @@ func (me *MatchingEngine) offerMeetsRequirements(offer *Offer, bid *Bid) bool {
 		return false
 	}
 	
-	// Check price
-	offerPrice := offer.PricePerHour["cpu"].Mul(decimal.NewFromInt(int64(bid.Requirements.MinCPU)))
+	// Check price, never below the offer's floors
+	offerPrice := me.service.floors.price(offer, "cpu").Mul(decimal.NewFromInt(int64(bid.Requirements.MinCPU)))
 	if bid.Requirements.MinGPU > 0 {
-		gpuPrice := offer.PricePerHour["gpu"].Mul(decimal.NewFromInt(int64(bid.Requirements.MinGPU)))
+		gpuPrice := me.service.floors.price(offer, "gpu").Mul(decimal.NewFromInt(int64(bid.Requirements.MinGPU)))
 		offerPrice = offerPrice.Add(gpuPrice)
 	}
 	
@@ -674,6 +807,16 @@ func (me *MatchingEngine) offerMeetsRequirements(offer *Offer, bid *Bid) bool {
 		}
 	}
 	
+	// Check the agent is trusted enough
+	if !offer.TrustTier.Meets(bid.Requirements.MinTrustTier) {
+		return false
+	}
+	
+	// Check the agent's GPU driver and runtime are new enough
+	if bid.Requirements.Unmet(offer.GPURuntime) != "" {
+		return false
+	}
+	
 	// Check required features
 	for _, required := range bid.Requirements.Features {
 		found := false
@@ -729,20 +872,33 @@ func (me *MatchingEngine) calculateMatchScore(offer *Offer, bid *Bid) float64 {
 	return score
 }
 
+// calculateOfferPrice prices a bid's requirements on an offer, with each
+// resource raised to the offer's price floor
 func (me *MatchingEngine) calculateOfferPrice(offer *Offer, bid *Bid) decimal.Decimal {
-	cpuPrice := offer.PricePerHour["cpu"].Mul(decimal.NewFromInt(int64(bid.Requirements.MinCPU)))
-	memPrice := offer.PricePerHour["memory"].Mul(decimal.NewFromInt(int64(bid.Requirements.MinMemory))).Div(decimal.NewFromInt(1024))
-	
-	totalPrice := cpuPrice.Add(memPrice)
+	totalPrice := me.resourcePrice(offer, bid, "cpu").Add(me.resourcePrice(offer, bid, "memory"))
 	
 	if bid.Requirements.MinGPU > 0 {
-		gpuPrice := offer.PricePerHour["gpu"].Mul(decimal.NewFromInt(int64(bid.Requirements.MinGPU)))
-		totalPrice = totalPrice.Add(gpuPrice)
+		totalPrice = totalPrice.Add(me.resourcePrice(offer, bid, "gpu"))
 	}
 	
 	return totalPrice
 }
 
+// resourcePrice prices one resource of a bid's requirements on an offer per
+// hour; storage is not charged
+func (me *MatchingEngine) resourcePrice(offer *Offer, bid *Bid, resource string) decimal.Decimal {
+	price := me.service.floors.price(offer, resource)
+	switch resource {
+	case "cpu":
+		return price.Mul(decimal.NewFromInt(int64(bid.Requirements.MinCPU)))
+	case "memory":
+		return price.Mul(decimal.NewFromInt(int64(bid.Requirements.MinMemory))).Div(decimal.NewFromInt(1024))
+	case "gpu":
+		return price.Mul(decimal.NewFromInt(int64(bid.Requirements.MinGPU)))
+	}
+	return decimal.Zero
+}
+
 func (me *MatchingEngine) calculateAgreedPrice(offer *Offer, bid *Bid) decimal.Decimal {
 	// Simple implementation: use offer price
 	// In production, could implement more sophisticated pricing strategies
@@ -758,6 +914,9 @@ func (s *MarketplaceService) validateOffer(offer *Offer) error {
 	if offer.Resources.Memory.TotalMB <= 0 {
 		return fmt.Errorf("memory must be positive")
 	}
+	if err := validateFloors(offer.PriceFloor); err != nil {
+		return err
+	}
 	if offer.ExpiresAt.IsZero() {
 		offer.ExpiresAt = time.Now().Add(24 * time.Hour) // Default 24h expiry
 	}
@@ -783,6 +942,14 @@ func (s *MarketplaceService) validateBid(bid *Bid) error {
 	if bid.Duration <= 0 {
 		return fmt.Errorf("duration must be positive")
 	}
+	tier, err := trust.Parse(string(bid.Requirements.MinTrustTier))
+	if err != nil {
+		return err
+	}
+	bid.Requirements.MinTrustTier = tier
+	if err := bid.Requirements.Requirements.Validate(); err != nil {
+		return err
+	}
 	if bid.ExpiresAt.IsZero() {
 		bid.ExpiresAt = time.Now().Add(1 * time.Hour) // Default 1h expiry
 	}
@@ -813,57 +980,56 @@ func (s *MarketplaceService) updateActiveMetrics() {
 }
 
 func (s *MarketplaceService) broadcastUpdate(topic string, data interface{}) {
-	s.subMu.RLock()
-	connections := s.subscribers[topic]
-	s.subMu.RUnlock()
-	
-	if len(connections) == 0 {
+	if s.wsHub.Len() == 0 {
 		return
 	}
 	
 	message, err := json.Marshal(data)
 	if err != nil {
-		log.Printf("Failed to marshal update: %v", err)
+		slog.Error("Failed to marshal update", "topic", topic, obs.KeyError, err)
 		return
 	}
 	
-	s.subMu.RLock()
-	defer s.subMu.RUnlock()
-	
-	for conn := range connections {
-		go func(c *websocket.Conn) {
-			if err := c.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("WebSocket write error: %v", err)
-			}
-		}(conn)
-	}
+	// Queued per client; slow clients drop updates rather than delay others
+	s.wsHub.Broadcast(topic, message)
 }
 
-func (s *MarketplaceService) publishEvent(event string, data interface{}) {
+func (s *MarketplaceService) publishEvent(ctx context.Context, event string, data interface{}) {
 	jsonData, _ := json.Marshal(data)
-	s.nats.Publish(event, jsonData)
+	if err := s.bus.Publish(ctx, event, jsonData); err != nil {
+		obs.LogError(ctx, "Failed to publish event", err, "event", event)
+	}
 }
 
 func (s *MarketplaceService) subscribeToEvents() {
 	// Subscribe to agent updates to update offers
-	s.nats.Subscribe("agent.status", func(msg *nats.Msg) {
+	s.nats.Subscribe("agent.status", obs.NATSHandler(func(ctx context.Context, msg *nats.Msg) error {
 		var status map[string]interface{}
 		if err := json.Unmarshal(msg.Data, &status); err != nil {
-			return
+			return obs.Wrap(obs.CodeInvalidArgument, err)
 		}
 		
-		agentID := status["agent_id"].(string)
-		agentStatus := status["status"].(string)
+		agentID, _ := status["agent_id"].(string)
+		agentStatus, _ := status["status"].(string)
 		
 		// Update offers from this agent
-		s.mu.Lock()
-		for _, offer := range s.offers {
-			if offer.AgentID == agentID && agentStatus == "offline" {
-				offer.Status = "expired"
-			}
+		if agentStatus == "offline" {
+			s.expireAgentOffers(ctx, agentID)
 		}
-		s.mu.Unlock()
-	})
+		return nil
+	}))
+	
+	// Expire and restore offers as the liveness reaper sees agents come and go
+	s.subscribeToAgentLiveness()
+	
+	// Show agent trust tiers on offers and enforce them in matching
+	s.subscribeToAgentTrust()
+	
+	// Show agent GPU runtime versions on offers and enforce job minimums
+	s.subscribeToAgentGPURuntime()
+	
+	// Show planned agent maintenance on offers and matches
+	s.subscribeToAgentMaintenance()
 }
 
 // JWT Claims type
@@ -893,6 +1059,7 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 		
 		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = obs.WithCaller(ctx, claims.UserID, "")
 		next(w, r.WithContext(ctx))
 	}
 }
@@ -901,31 +1068,80 @@ func generateID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
 
+// isAdmin reports whether the authenticated caller is an admin
+func isAdmin(r *http.Request) bool {
+	claims, ok := r.Context().Value("claims").(*Claims)
+	return ok && claims.Role == "admin"
+}
+
 func main() {
+	obs.Init("marketplace-service")
+	
 	// Create marketplace service
 	marketplace, err := NewMarketplaceService()
 	if err != nil {
-		log.Fatalf("Failed to create marketplace service: %v", err)
+		obs.Fatal("Failed to create marketplace service", err)
 	}
 	
 	// Setup routes
 	router := mux.NewRouter()
+	router.Use(obs.Middleware)
 	
-	// Health check
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
+	// Health checks: /healthz is liveness only, /readyz runs dependency checks
+	checker := health.NewChecker("marketplace-service")
+	checker.AddCheck("nats", true, health.NATSCheck(marketplace.nats))
+	router.HandleFunc("/healthz", checker.LivenessHandler).Methods("GET")
+	router.HandleFunc("/readyz", checker.ReadinessHandler).Methods("GET")
+	router.HandleFunc("/health", checker.ReadinessHandler).Methods("GET") // Legacy alias
 	
 	// Metrics endpoint
 	router.Handle("/metrics", promhttp.Handler())
 	
+	// Runtime logging control
+	router.HandleFunc("/admin/logging", authMiddleware(obs.Logging.Handler(isAdmin))).Methods("GET", "PUT")
+	
+	// Consistency checker admin queue
+	router.HandleFunc("/api/v1/admin/consistency", authMiddleware(marketplace.consistency.GetConsistency)).Methods("GET")
+	router.HandleFunc("/api/v1/admin/consistency/run", authMiddleware(marketplace.consistency.RunConsistencyCheck)).Methods("POST")
+	router.HandleFunc("/api/v1/admin/consistency/issues/{id}/resolve", authMiddleware(marketplace.consistency.ResolveConsistencyIssue)).Methods("POST")
+	
 	// Marketplace endpoints
 	router.HandleFunc("/api/v1/offers", authMiddleware(marketplace.CreateOffer)).Methods("POST")
 	router.HandleFunc("/api/v1/offers", marketplace.ListOffers).Methods("GET")
+	router.HandleFunc("/api/v1/price-index", marketplace.GetPriceIndex).Methods("GET")
+	router.HandleFunc("/api/v1/providers/earnings/simulate", marketplace.SimulateEarnings).Methods("POST")
+	router.HandleFunc("/api/v1/providers/price-floors", authMiddleware(marketplace.floors.GetPriceFloors)).Methods("GET")
+	router.HandleFunc("/api/v1/providers/price-floors", authMiddleware(marketplace.floors.SetPriceFloors)).Methods("PUT")
+	router.HandleFunc("/api/v1/offers/{id}", marketplace.GetOffer).Methods("GET")
+	router.HandleFunc("/api/v1/offers/{id}", authMiddleware(marketplace.ReplaceOffer)).Methods("PUT")
+	router.HandleFunc("/api/v1/offers/{id}", authMiddleware(marketplace.CancelOffer)).Methods("DELETE")
 	router.HandleFunc("/api/v1/bids", authMiddleware(marketplace.CreateBid)).Methods("POST")
+	router.HandleFunc("/api/v1/bids/{id}", authMiddleware(marketplace.ReplaceBid)).Methods("PUT")
+	router.HandleFunc("/api/v1/bids/{id}", authMiddleware(marketplace.CancelBid)).Methods("DELETE")
+	router.HandleFunc("/api/v1/executions", authMiddleware(marketplace.ListExecutions)).Methods("GET")
+	router.HandleFunc("/api/v1/executions/stream", authMiddleware(marketplace.StreamExecutions)).Methods("GET")
+	router.HandleFunc("/api/v1/quotes", authMiddleware(marketplace.quotes.CreateQuote)).Methods("POST")
+	router.HandleFunc("/api/v1/quotes/{id}", authMiddleware(marketplace.quotes.GetQuote)).Methods("GET")
+	router.HandleFunc("/api/v1/quotes/{id}/redeem", marketplace.quotes.RedeemQuote).Methods("POST") // Scheduler only, with SERVICE_TOKEN
 	router.HandleFunc("/api/v1/matches/{id}", authMiddleware(marketplace.GetMatch)).Methods("GET")
 	router.HandleFunc("/api/v1/matches/{id}/confirm", authMiddleware(marketplace.ConfirmMatch)).Methods("POST")
+	router.HandleFunc("/api/v1/matches/{id}/resize", authMiddleware(marketplace.ResizeMatch)).Methods("POST") // The consumer, or the scheduler with SERVICE_TOKEN
+	
+	// Provider onboarding endpoints
+	router.HandleFunc("/api/v1/providers/onboarding", authMiddleware(marketplace.onboarding.StartOnboarding)).Methods("POST")
+	router.HandleFunc("/api/v1/providers/onboarding", authMiddleware(marketplace.onboarding.GetOnboarding)).Methods("GET")
+	router.HandleFunc("/api/v1/providers/onboarding/kyc", authMiddleware(marketplace.onboarding.SubmitKYC)).Methods("POST")
+	router.HandleFunc("/api/v1/providers/onboarding/activate", authMiddleware(marketplace.onboarding.Activate)).Methods("POST")
+	router.HandleFunc("/api/v1/providers/{id}/onboarding", authMiddleware(marketplace.onboarding.GetProviderOnboarding)).Methods("GET")
+	router.HandleFunc("/api/v1/providers/{id}/kyc/review", authMiddleware(marketplace.onboarding.ReviewKYC)).Methods("POST")
+	
+	// Market maker endpoints; quotes are streamed by the makers and published on the quotes topic
+	router.HandleFunc("/api/v1/market-makers", authMiddleware(marketplace.makers.RegisterMarketMaker)).Methods("POST")
+	router.HandleFunc("/api/v1/market-makers", authMiddleware(marketplace.makers.ListMarketMakers)).Methods("GET")
+	router.HandleFunc("/api/v1/market-makers/quotes", marketplace.makers.ListMakerQuotes).Methods("GET")
+	router.HandleFunc("/api/v1/market-makers/quotes/stream", authMiddleware(marketplace.makers.StreamMakerQuotes)).Methods("GET")
+	router.HandleFunc("/api/v1/market-makers/{id}", authMiddleware(marketplace.makers.GetMarketMaker)).Methods("GET")
+	router.HandleFunc("/api/v1/market-makers/{id}", authMiddleware(marketplace.makers.RevokeMarketMaker)).Methods("DELETE")
 	
 	// WebSocket endpoint
 	router.HandleFunc("/ws", marketplace.HandleWebSocket)
@@ -946,8 +1162,8 @@ func main() {
 		port = "8003"
 	}
 	
-	log.Printf("Marketplace service starting on port %s", port)
+	slog.Info("Marketplace service starting", "port", port)
 	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		obs.Fatal("Failed to start server", err)
 	}
 } 
\ No newline at end of file
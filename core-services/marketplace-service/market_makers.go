@@ -0,0 +1,634 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shopspring/decimal"
+)
+
+// Market maker states
+const (
+	MakerActive  = "active"
+	MakerRevoked = "revoked"
+)
+
+// Market maker defaults and limits
+const (
+	makerSampleInterval   = 10 * time.Second
+	makerWriteTimeout     = 10 * time.Second
+	defaultMakerUptimePct = 90.0
+	defaultMakerSpreadPct = 5.0
+	maxMakerRebateBps     = 1000
+	maxMakerHistory       = 30 // Settled periods kept per market maker
+	rebateCurrency        = "USD"
+)
+
+// MakerObligations are what a market maker commits to in return for fee
+// rebates
+type MakerObligations struct {
+	MinUptimePct float64 `json:"min_uptime_pct"` // Share of the period spent quoting within the spread and size
+	MaxSpreadPct float64 `json:"max_spread_pct"` // Widest (ask - bid) / mid that counts as quoting
+	MinSize      int     `json:"min_size"`       // Units quoted on each side
+}
+
+// MakerQuote is a market maker's two-sided quote for its resource class, per
+// unit hour like Offer.PricePerHour. The ask reprices the maker's active
+// offers in the class; the bid is the price the maker stands ready to buy
+// capacity at and is published with the book.
+type MakerQuote struct {
+	MarketMakerID string          `json:"market_maker_id"`
+	Resource      string          `json:"resource"`
+	Location      string          `json:"location,omitempty"`
+	BidPrice      decimal.Decimal `json:"bid_price"`
+	BidSize       int             `json:"bid_size"`
+	AskPrice      decimal.Decimal `json:"ask_price"`
+	AskSize       int             `json:"ask_size"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// ObligationPeriod measures a market maker against its obligations over one
+// settlement period
+type ObligationPeriod struct {
+	ID               string          `json:"id"`
+	MarketMakerID    string          `json:"market_maker_id"`
+	AccountID        string          `json:"account_id"`
+	Start            time.Time       `json:"start"`
+	End              time.Time       `json:"end"`
+	Samples          int             `json:"samples"`
+	CompliantSamples int             `json:"compliant_samples"`
+	UptimePct        float64         `json:"uptime_pct"`
+	Trades           int             `json:"trades"`
+	Volume           decimal.Decimal `json:"volume"` // Notional of the class traded as provider
+	Met              bool            `json:"met"`
+	RebateBps        int             `json:"rebate_bps"`
+	Rebate           decimal.Decimal `json:"rebate"`
+	Currency         string          `json:"currency"`
+	SettledAt        *time.Time      `json:"settled_at,omitempty"`
+	Note             string          `json:"note,omitempty"`
+}
+
+// MarketMaker is an account designated to provide liquidity in one resource
+// class: a resource in one location, or in all of them when Location is empty
+type MarketMaker struct {
+	ID          string             `json:"id"`
+	AccountID   string             `json:"account_id"`
+	Resource    string             `json:"resource"`
+	Location    string             `json:"location,omitempty"`
+	Obligations MakerObligations   `json:"obligations"`
+	RebateBps   int                `json:"rebate_bps"` // Paid on the period's volume when obligations are met
+	Status      string             `json:"status"`
+	CreatedBy   string             `json:"created_by"`
+	CreatedAt   time.Time          `json:"created_at"`
+	RevokedAt   *time.Time         `json:"revoked_at,omitempty"`
+	Quote       *MakerQuote        `json:"quote,omitempty"` // Live while the quote stream that set it is connected
+	Period      *ObligationPeriod  `json:"period,omitempty"`
+	History     []ObligationPeriod `json:"history,omitempty"` // Settled periods, oldest first
+
+	quoteSession string // Stream that owns Quote
+}
+
+// MarketMakers registers market makers, takes their quotes and tracks their
+// obligations.
+//
+// Admins designate accounts for a resource class. A maker streams two-sided
+// quotes over a WebSocket; quotes are pulled when the stream disconnects.
+// Every 10 seconds each maker is sampled: it is compliant when it has a live
+// quote no wider than its spread obligation with at least its minimum size
+// on both sides. Periods last MARKET_MAKER_PERIOD_MINUTES (default 1440)
+// and are aligned to the clock. At the end of each period a maker whose
+// compliant share met its uptime obligation earns RebateBps of the volume it
+// traded in the class as provider; the settled period is published as
+// market_maker.settled, and the payment service credits the rebate.
+type MarketMakers struct {
+	service *MarketplaceService
+	makers  map[string]*MarketMaker
+	period  time.Duration
+	mu      sync.Mutex
+
+	uptime  *prometheus.GaugeVec
+	rebates prometheus.Counter
+}
+
+// NewMarketMakers creates the market maker registry from the environment
+func NewMarketMakers(s *MarketplaceService) *MarketMakers {
+	m := &MarketMakers{
+		service: s,
+		makers:  make(map[string]*MarketMaker),
+		period:  time.Duration(envInt("MARKET_MAKER_PERIOD_MINUTES", 24*60)) * time.Minute,
+		uptime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "marketplace_market_maker_uptime_percent",
+			Help: "Share of the current period each market maker met its quoting obligations",
+		}, []string{"market_maker_id"}),
+		rebates: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "marketplace_market_maker_rebates_usd_total",
+			Help: "Fee rebates earned by market makers at settlement",
+		}),
+	}
+	if m.period <= 0 {
+		m.period = 24 * time.Hour
+	}
+	prometheus.MustRegister(m.uptime, m.rebates)
+	return m
+}
+
+func (m *MarketMakers) run(ctx context.Context) {
+	ticker := time.NewTicker(makerSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sample(ctx, time.Now())
+		}
+	}
+}
+
+// sample records each active maker's compliance and settles periods that
+// have ended
+func (m *MarketMakers) sample(ctx context.Context, now time.Time) {
+	var settled []ObligationPeriod
+
+	m.mu.Lock()
+	for _, maker := range m.makers {
+		if maker.Status != MakerActive {
+			continue
+		}
+		if !now.Before(maker.Period.End) {
+			settled = append(settled, m.settle(maker, now, ""))
+			maker.Period = m.newPeriod(maker, now)
+		}
+		maker.Period.Samples++
+		if maker.compliant() {
+			maker.Period.CompliantSamples++
+		}
+		m.uptime.WithLabelValues(maker.ID).Set(maker.Period.uptimePct())
+	}
+	m.mu.Unlock()
+
+	m.publishSettled(ctx, settled)
+}
+
+// newPeriod starts the period containing now
+func (m *MarketMakers) newPeriod(maker *MarketMaker, now time.Time) *ObligationPeriod {
+	start := now.Truncate(m.period)
+	return &ObligationPeriod{
+		ID:            fmt.Sprintf("%s-%d", maker.ID, start.Unix()),
+		MarketMakerID: maker.ID,
+		AccountID:     maker.AccountID,
+		Start:         start,
+		End:           start.Add(m.period),
+		Volume:        decimal.Zero,
+		RebateBps:     maker.RebateBps,
+		Rebate:        decimal.Zero,
+		Currency:      rebateCurrency,
+	}
+}
+
+// settle closes a maker's current period and computes its rebate. A note
+// forfeits the rebate. Callers hold m.mu.
+func (m *MarketMakers) settle(maker *MarketMaker, now time.Time, note string) ObligationPeriod {
+	period := *maker.Period
+	period.UptimePct = period.uptimePct()
+	period.Met = note == "" && period.Samples > 0 && period.UptimePct >= maker.Obligations.MinUptimePct
+	if period.Met {
+		period.Rebate = period.Volume.Mul(decimal.NewFromInt(int64(period.RebateBps))).Div(decimal.NewFromInt(10000)).Round(2)
+	}
+	period.SettledAt = &now
+	period.Note = note
+
+	maker.History = append(maker.History, period)
+	if len(maker.History) > maxMakerHistory {
+		maker.History = maker.History[len(maker.History)-maxMakerHistory:]
+	}
+	return period
+}
+
+func (m *MarketMakers) publishSettled(ctx context.Context, settled []ObligationPeriod) {
+	for i := range settled {
+		period := &settled[i]
+		slog.InfoContext(ctx, "Settled market maker period", "market_maker_id", period.MarketMakerID,
+			"account_id", period.AccountID, "uptime_pct", period.UptimePct, "met", period.Met, "rebate", period.Rebate)
+		m.rebates.Add(period.Rebate.InexactFloat64())
+		m.service.publishEvent(ctx, "market_maker.settled", period)
+	}
+}
+
+func (p *ObligationPeriod) uptimePct() float64 {
+	if p.Samples == 0 {
+		return 0
+	}
+	return float64(p.CompliantSamples) / float64(p.Samples) * 100
+}
+
+// compliant reports whether the maker's live quote meets its obligations
+func (maker *MarketMaker) compliant() bool {
+	q := maker.Quote
+	if q == nil || q.BidSize < maker.Obligations.MinSize || q.AskSize < maker.Obligations.MinSize {
+		return false
+	}
+	return quoteSpreadPct(q) <= maker.Obligations.MaxSpreadPct
+}
+
+// quoteSpreadPct is a quote's spread as a percentage of its mid price
+func quoteSpreadPct(q *MakerQuote) float64 {
+	mid := q.BidPrice.Add(q.AskPrice).Div(decimal.NewFromInt(2))
+	if !mid.IsPositive() {
+		return 100
+	}
+	return q.AskPrice.Sub(q.BidPrice).Div(mid).InexactFloat64() * 100
+}
+
+// covers reports whether an offer's location is in the maker's class
+func (maker *MarketMaker) covers(location string) bool {
+	return maker.Location == "" || maker.Location == location
+}
+
+// recordTrade credits a new match to the period volume of the provider's
+// market maker classes, each with its resource's share of the trade. Called
+// by the matching engine with the marketplace lock held.
+func (m *MarketMakers) recordTrade(match *Match, bid *Bid, offer *Offer) {
+	hours := decimal.NewFromFloat(match.EndTime.Sub(match.StartTime).Hours())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, maker := range m.makers {
+		if maker.Status != MakerActive || maker.AccountID != offer.ProviderID || !maker.covers(offer.Location) {
+			continue
+		}
+		notional := m.service.matcher.resourcePrice(offer, bid, maker.Resource).Mul(hours)
+		if !notional.IsPositive() {
+			continue
+		}
+		maker.Period.Trades++
+		maker.Period.Volume = maker.Period.Volume.Add(notional)
+	}
+}
+
+// applyQuote validates and stores a quote from a maker's stream, then
+// reprices the maker's active offers in the class to the ask
+func (m *MarketMakers) applyQuote(ctx context.Context, accountID, session string, quote MakerQuote) (*MakerQuote, error) {
+	switch {
+	case !quote.BidPrice.IsPositive():
+		return nil, fmt.Errorf("bid_price must be positive")
+	case !quote.AskPrice.GreaterThan(quote.BidPrice):
+		return nil, fmt.Errorf("ask_price must be above bid_price")
+	case quote.BidSize < 0 || quote.AskSize < 0:
+		return nil, fmt.Errorf("sizes must not be negative")
+	}
+
+	m.mu.Lock()
+	maker, exists := m.makers[quote.MarketMakerID]
+	if !exists || maker.AccountID != accountID {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("market maker %s not found", quote.MarketMakerID)
+	}
+	if maker.Status != MakerActive {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("market maker %s is %s", maker.ID, maker.Status)
+	}
+	quote.Resource = maker.Resource
+	quote.Location = maker.Location
+	quote.UpdatedAt = time.Now()
+	maker.Quote = &quote
+	maker.quoteSession = session
+	class := *maker
+	m.mu.Unlock()
+
+	// The marketplace lock is taken after m.mu is released; the matching
+	// engine takes them in the other order
+	s := m.service
+	var reports []ExecutionReport
+	s.mu.Lock()
+	for _, offer := range s.offers {
+		if offer.ProviderID != accountID || offer.Status != "active" || !class.covers(offer.Location) {
+			continue
+		}
+		if price, ok := offer.PricePerHour[class.Resource]; !ok || price.Equal(quote.AskPrice) {
+			continue
+		}
+		offer.PricePerHour[class.Resource] = quote.AskPrice
+		offer.UpdatedAt = quote.UpdatedAt
+		reports = append(reports, offerReport(offer, ExecReplaced, "repriced by market maker quote"))
+	}
+	s.mu.Unlock()
+
+	for _, report := range reports {
+		s.executions.Report(report)
+	}
+	s.broadcastUpdate("quotes", map[string]interface{}{
+		"type": "quote_updated",
+		"data": quote,
+	})
+	return &quote, nil
+}
+
+// pullQuotes withdraws the quotes a disconnected stream set
+func (m *MarketMakers) pullQuotes(session string) {
+	var pulled []string
+
+	m.mu.Lock()
+	for _, maker := range m.makers {
+		if maker.Quote != nil && maker.quoteSession == session {
+			maker.Quote = nil
+			maker.quoteSession = ""
+			pulled = append(pulled, maker.ID)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, id := range pulled {
+		m.service.broadcastUpdate("quotes", map[string]interface{}{
+			"type": "quote_pulled",
+			"data": map[string]string{"market_maker_id": id},
+		})
+	}
+}
+
+// snapshot copies a maker for a response; callers hold m.mu
+func (maker *MarketMaker) snapshot() MarketMaker {
+	copied := *maker
+	if maker.Quote != nil {
+		quote := *maker.Quote
+		copied.Quote = &quote
+	}
+	if maker.Period != nil {
+		period := *maker.Period
+		period.UptimePct = period.uptimePct()
+		copied.Period = &period
+	}
+	copied.History = append([]ObligationPeriod(nil), maker.History...)
+	return copied
+}
+
+// HTTP Handlers
+
+// RegisterMarketMaker designates an account as market maker for a resource
+// class (admin only)
+func (m *MarketMakers) RegisterMarketMaker(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		AccountID   string           `json:"account_id"`
+		Resource    string           `json:"resource"`
+		Location    string           `json:"location"`
+		Obligations MakerObligations `json:"obligations"`
+		RebateBps   int              `json:"rebate_bps"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	obligations := &req.Obligations
+	if obligations.MinUptimePct == 0 {
+		obligations.MinUptimePct = defaultMakerUptimePct
+	}
+	if obligations.MaxSpreadPct == 0 {
+		obligations.MaxSpreadPct = defaultMakerSpreadPct
+	}
+	if obligations.MinSize == 0 {
+		obligations.MinSize = 1
+	}
+	switch {
+	case req.AccountID == "":
+		http.Error(w, "account_id is required", http.StatusBadRequest)
+		return
+	case !floorResources[req.Resource]:
+		http.Error(w, "resource must be cpu, memory, gpu or storage", http.StatusBadRequest)
+		return
+	case obligations.MinUptimePct < 0 || obligations.MinUptimePct > 100:
+		http.Error(w, "min_uptime_pct must be between 0 and 100", http.StatusBadRequest)
+		return
+	case obligations.MaxSpreadPct < 0 || obligations.MinSize < 0:
+		http.Error(w, "max_spread_pct and min_size must not be negative", http.StatusBadRequest)
+		return
+	case req.RebateBps < 0 || req.RebateBps > maxMakerRebateBps:
+		http.Error(w, fmt.Sprintf("rebate_bps must be between 0 and %d", maxMakerRebateBps), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	maker := &MarketMaker{
+		ID:          generateID(),
+		AccountID:   req.AccountID,
+		Resource:    req.Resource,
+		Location:    req.Location,
+		Obligations: *obligations,
+		RebateBps:   req.RebateBps,
+		Status:      MakerActive,
+		CreatedBy:   claims.UserID,
+		CreatedAt:   now,
+	}
+	maker.Period = m.newPeriod(maker, now)
+
+	m.mu.Lock()
+	for _, existing := range m.makers {
+		if existing.Status == MakerActive && existing.AccountID == maker.AccountID &&
+			existing.Resource == maker.Resource && existing.Location == maker.Location {
+			m.mu.Unlock()
+			http.Error(w, "Account is already a market maker for this resource class", http.StatusConflict)
+			return
+		}
+	}
+	m.makers[maker.ID] = maker
+	snapshot := maker.snapshot()
+	m.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Registered market maker", "market_maker_id", maker.ID, "account_id", maker.AccountID,
+		"resource", maker.Resource, "location", maker.Location)
+	m.service.publishEvent(r.Context(), "market_maker.registered", &snapshot)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// ListMarketMakers returns every market maker to admins and the caller's own
+// designations to everyone else
+func (m *MarketMakers) ListMarketMakers(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	status := r.URL.Query().Get("status")
+
+	m.mu.Lock()
+	makers := make([]MarketMaker, 0)
+	for _, maker := range m.makers {
+		if claims.Role != "admin" && maker.AccountID != claims.UserID {
+			continue
+		}
+		if status != "" && maker.Status != status {
+			continue
+		}
+		makers = append(makers, maker.snapshot())
+	}
+	m.mu.Unlock()
+
+	sort.Slice(makers, func(i, j int) bool { return makers[i].CreatedAt.Before(makers[j].CreatedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(makers)
+}
+
+// GetMarketMaker returns a market maker with its current period and settled
+// history
+func (m *MarketMakers) GetMarketMaker(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	m.mu.Lock()
+	maker, exists := m.makers[mux.Vars(r)["id"]]
+	var snapshot MarketMaker
+	if exists {
+		snapshot = maker.snapshot()
+	}
+	m.mu.Unlock()
+
+	if !exists || (claims.Role != "admin" && snapshot.AccountID != claims.UserID) {
+		http.Error(w, "Market maker not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// RevokeMarketMaker ends a designation (admin only). The current period is
+// settled without a rebate and the maker's quote is pulled.
+func (m *MarketMakers) RevokeMarketMaker(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	now := time.Now()
+	m.mu.Lock()
+	maker, exists := m.makers[mux.Vars(r)["id"]]
+	if !exists {
+		m.mu.Unlock()
+		http.Error(w, "Market maker not found", http.StatusNotFound)
+		return
+	}
+	if maker.Status != MakerActive {
+		m.mu.Unlock()
+		http.Error(w, "Market maker is already revoked", http.StatusConflict)
+		return
+	}
+	settled := m.settle(maker, now, "designation revoked")
+	maker.Status = MakerRevoked
+	maker.RevokedAt = &now
+	maker.Period = nil
+	maker.Quote = nil
+	maker.quoteSession = ""
+	m.uptime.DeleteLabelValues(maker.ID)
+	snapshot := maker.snapshot()
+	m.mu.Unlock()
+
+	m.publishSettled(r.Context(), []ObligationPeriod{settled})
+	m.service.publishEvent(r.Context(), "market_maker.revoked", &snapshot)
+	m.service.broadcastUpdate("quotes", map[string]interface{}{
+		"type": "quote_pulled",
+		"data": map[string]string{"market_maker_id": maker.ID},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// ListMakerQuotes returns the live market maker quotes, optionally for one
+// resource or location
+func (m *MarketMakers) ListMakerQuotes(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	location := r.URL.Query().Get("location")
+
+	m.mu.Lock()
+	quotes := make([]MakerQuote, 0)
+	for _, maker := range m.makers {
+		if maker.Quote == nil || (resource != "" && maker.Resource != resource) || (location != "" && !maker.covers(location)) {
+			continue
+		}
+		quotes = append(quotes, *maker.Quote)
+	}
+	m.mu.Unlock()
+
+	sort.Slice(quotes, func(i, j int) bool {
+		if quotes[i].Resource != quotes[j].Resource {
+			return quotes[i].Resource < quotes[j].Resource
+		}
+		if quotes[i].Location != quotes[j].Location {
+			return quotes[i].Location < quotes[j].Location
+		}
+		return quotes[i].AskPrice.LessThan(quotes[j].AskPrice)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quotes)
+}
+
+// StreamMakerQuotes takes quote updates from a market maker over a
+// WebSocket. Each message is a MakerQuote naming one of the caller's
+// designations and is answered with an ack or an error. The stream's quotes
+// are pulled when it disconnects.
+func (m *MarketMakers) StreamMakerQuotes(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	m.mu.Lock()
+	designated := false
+	for _, maker := range m.makers {
+		if maker.AccountID == claims.UserID && maker.Status == MakerActive {
+			designated = true
+			break
+		}
+	}
+	m.mu.Unlock()
+	if !designated {
+		http.Error(w, "Account is not a designated market maker", http.StatusForbidden)
+		return
+	}
+
+	conn, err := m.service.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "WebSocket upgrade failed", obs.KeyError, err)
+		return
+	}
+	defer conn.Close()
+
+	session := generateID()
+	defer m.pullQuotes(session)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var quote MakerQuote
+		var reply map[string]interface{}
+		if err := json.Unmarshal(data, &quote); err != nil {
+			reply = map[string]interface{}{"type": "error", "error": "Invalid quote"}
+		} else if applied, err := m.applyQuote(r.Context(), claims.UserID, session, quote); err != nil {
+			reply = map[string]interface{}{"type": "error", "market_maker_id": quote.MarketMakerID, "error": err.Error()}
+		} else {
+			reply = map[string]interface{}{"type": "ack", "quote": applied}
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(makerWriteTimeout))
+		if err := conn.WriteJSON(reply); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// matchResizeRequest is the body of a match resize: the job's resources
+// after the resize
+type matchResizeRequest struct {
+	CPUCores int `json:"cpu_cores"`
+	MemoryMB int `json:"memory_mb"`
+	GPUCount int `json:"gpu_count"`
+
+	ConsumerID string `json:"consumer_id,omitempty"` // The job's owner, when the scheduler calls with SERVICE_TOKEN
+}
+
+// isServiceCaller reports whether a request presents SERVICE_TOKEN
+func isServiceCaller(r *http.Request) bool {
+	token := os.Getenv("SERVICE_TOKEN")
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
+
+// ResizeMatch re-prices a live match for new resources on the same offer,
+// when the scheduler resizes the job running under it. The provider's offer
+// must hold the new resources; the agreed price becomes what the offer
+// charges for them. The scheduler calls it with SERVICE_TOKEN on behalf of
+// the consumer it names.
+func (s *MarketplaceService) ResizeMatch(w http.ResponseWriter, r *http.Request) {
+	var req matchResizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CPUCores <= 0 || req.MemoryMB <= 0 || req.GPUCount < 0 {
+		http.Error(w, "cpu_cores and memory_mb must be positive and gpu_count not negative", http.StatusBadRequest)
+		return
+	}
+
+	service := isServiceCaller(r)
+	if service && req.ConsumerID == "" {
+		http.Error(w, "consumer_id is required", http.StatusBadRequest)
+		return
+	}
+	claims := r.Context().Value("claims").(*Claims)
+	matchID := mux.Vars(r)["id"]
+
+	s.mu.Lock()
+	match, exists := s.matches[matchID]
+	if !exists {
+		s.mu.Unlock()
+		http.Error(w, "Match not found", http.StatusNotFound)
+		return
+	}
+	if (service && match.ConsumerID != req.ConsumerID) || (!service && match.ConsumerID != claims.UserID && claims.Role != "admin") {
+		s.mu.Unlock()
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	if match.Status != "confirmed" && match.Status != "active" {
+		s.mu.Unlock()
+		http.Error(w, "Only confirmed or active matches can be resized", http.StatusConflict)
+		return
+	}
+	offer, offerExists := s.offers[match.OfferID]
+	bid, bidExists := s.bids[match.BidID]
+	if !offerExists || !bidExists {
+		s.mu.Unlock()
+		http.Error(w, "Match offer or bid no longer exists", http.StatusConflict)
+		return
+	}
+
+	gpus := 0
+	for _, gpu := range offer.Resources.GPU {
+		gpus += gpu.Count
+	}
+	if req.CPUCores > offer.Resources.CPU.Cores || req.MemoryMB > offer.Resources.Memory.TotalMB || req.GPUCount > gpus {
+		s.mu.Unlock()
+		http.Error(w, "The provider's offer does not have the requested resources", http.StatusConflict)
+		return
+	}
+
+	resized := *bid
+	resized.Requirements.MinCPU = req.CPUCores
+	resized.Requirements.MinMemory = req.MemoryMB
+	resized.Requirements.MinGPU = req.GPUCount
+	*bid = resized
+	previous := match.AgreedPrice
+	match.AgreedPrice = s.matcher.calculateAgreedPrice(offer, bid)
+	snapshot := *match
+	s.mu.Unlock()
+
+	s.publishEvent(r.Context(), "match.resized", map[string]interface{}{
+		"match":          snapshot,
+		"previous_price": previous,
+		"cpu_cores":      req.CPUCores,
+		"memory_mb":      req.MemoryMB,
+		"gpu_count":      req.GPUCount,
+	})
+	s.broadcastUpdate("matches", map[string]interface{}{
+		"type": "match_resized",
+		"data": snapshot,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/nats-io/nats.go"
+)
+
+// Provider onboarding stages. Providers start pending, become verified once
+// KYC is approved and all verification jobs pass, and are active after they
+// activate their account.
+const (
+	ProviderPending   = "pending"
+	ProviderVerified  = "verified"
+	ProviderActive    = "active"
+	ProviderSuspended = "suspended"
+)
+
+// Verification check kinds
+const (
+	CheckBenchmark    = "benchmark"
+	CheckConnectivity = "connectivity"
+)
+
+// KYCSubmission holds the provider's identity verification state
+type KYCSubmission struct {
+	Status       string     `json:"status"` // none, submitted, approved, rejected
+	DocumentType string     `json:"document_type,omitempty"`
+	DocumentRef  string     `json:"document_ref,omitempty"` // Reference into the KYC vendor or document store
+	SubmittedAt  *time.Time `json:"submitted_at,omitempty"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	ReviewedBy   string     `json:"reviewed_by,omitempty"`
+	RejectReason string     `json:"reject_reason,omitempty"`
+}
+
+// VerificationCheck is an automatic job run on the provider's agent
+type VerificationCheck struct {
+	Kind        string     `json:"kind"`
+	JobID       string     `json:"job_id,omitempty"`
+	Status      string     `json:"status"` // pending, running, passed, failed
+	Detail      string     `json:"detail,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// ProviderProfile tracks a provider through onboarding
+type ProviderProfile struct {
+	ProviderID  string               `json:"provider_id"`
+	AgentID     string               `json:"agent_id"`
+	Status      string               `json:"status"`
+	KYC         KYCSubmission        `json:"kyc"`
+	Checks      []*VerificationCheck `json:"checks"`
+	CreatedAt   time.Time            `json:"created_at"`
+	UpdatedAt   time.Time            `json:"updated_at"`
+	ActivatedAt *time.Time           `json:"activated_at,omitempty"`
+}
+
+// Onboarding manages provider onboarding and gates marketplace visibility.
+//
+// Verification jobs are submitted to the scheduler at SCHEDULER_URL and pinned
+// to the provider's agent, which the scheduler must record as owned by the
+// provider. KYC submissions are forwarded to KYC_WEBHOOK_URL
+// when set; otherwise an admin reviews them through the API. Providers that
+// are not active may only list offers up to ONBOARDING_MAX_UNVERIFIED_CPU
+// cores and ONBOARDING_MAX_UNVERIFIED_GPUS GPUs.
+type Onboarding struct {
+	service          *MarketplaceService
+	providers        map[string]*ProviderProfile
+	jobIndex         map[string]string // verification job ID -> provider ID
+	mu               sync.RWMutex
+	httpClient       *http.Client
+	schedulerURL     string
+	serviceToken     string
+	kycWebhookURL    string
+	benchmarkImage   string
+	maxUnverifiedCPU int
+	maxUnverifiedGPU int
+}
+
+// NewOnboarding creates the onboarding manager from the environment
+func NewOnboarding(s *MarketplaceService) *Onboarding {
+	schedulerURL := os.Getenv("SCHEDULER_URL")
+	if schedulerURL == "" {
+		schedulerURL = "http://scheduler-service:8002"
+	}
+
+	benchmarkImage := os.Getenv("ONBOARDING_BENCHMARK_IMAGE")
+	if benchmarkImage == "" {
+		benchmarkImage = "computehive/benchmark:latest"
+	}
+
+	return &Onboarding{
+		service:          s,
+		providers:        make(map[string]*ProviderProfile),
+		jobIndex:         make(map[string]string),
+		httpClient:       &http.Client{Timeout: 10 * time.Second, Transport: obs.Transport(nil)},
+		schedulerURL:     schedulerURL,
+		serviceToken:     os.Getenv("SERVICE_TOKEN"),
+		kycWebhookURL:    os.Getenv("KYC_WEBHOOK_URL"),
+		benchmarkImage:   benchmarkImage,
+		maxUnverifiedCPU: envInt("ONBOARDING_MAX_UNVERIFIED_CPU", 8),
+		maxUnverifiedGPU: envInt("ONBOARDING_MAX_UNVERIFIED_GPUS", 0),
+	}
+}
+
+// checkOfferAllowed rejects offers above the size threshold from providers
+// that have not completed onboarding
+func (o *Onboarding) checkOfferAllowed(offer *Offer) error {
+	o.mu.RLock()
+	profile, exists := o.providers[offer.ProviderID]
+	active := exists && profile.Status == ProviderActive
+	suspended := exists && profile.Status == ProviderSuspended
+	o.mu.RUnlock()
+
+	if suspended {
+		return obs.Errorf(obs.CodePermissionDenied, "provider is suspended")
+	}
+	if active {
+		return nil
+	}
+
+	gpus := 0
+	for _, gpu := range offer.Resources.GPU {
+		gpus += gpu.Count
+	}
+	if offer.Resources.CPU.Cores > o.maxUnverifiedCPU || gpus > o.maxUnverifiedGPU {
+		return obs.Errorf(obs.CodePermissionDenied, "offers above %d CPU cores or %d GPUs require a verified and active provider",
+			o.maxUnverifiedCPU, o.maxUnverifiedGPU)
+	}
+	return nil
+}
+
+// KYCApproved reports whether an account has passed KYC review
+func (o *Onboarding) KYCApproved(accountID string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	profile, exists := o.providers[accountID]
+	return exists && profile.KYC.Status == "approved"
+}
+
+// HTTP Handlers
+
+// StartOnboarding registers the caller as a provider and launches verification jobs
+func (o *Onboarding) StartOnboarding(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AgentID string `json:"agent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.AgentID == "" {
+		http.Error(w, "agent_id is required", http.StatusBadRequest)
+		return
+	}
+
+	claims := r.Context().Value("claims").(*Claims)
+
+	owner, err := o.agentOwner(r.Context(), req.AgentID)
+	if err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+	if owner != claims.UserID {
+		http.Error(w, "Agent is not owned by the caller", http.StatusForbidden)
+		return
+	}
+
+	o.mu.Lock()
+	profile, exists := o.providers[claims.UserID]
+	if exists && profile.Status != ProviderPending {
+		o.mu.Unlock()
+		http.Error(w, "Provider has already been verified", http.StatusConflict)
+		return
+	}
+	if !exists {
+		profile = &ProviderProfile{
+			ProviderID: claims.UserID,
+			Status:     ProviderPending,
+			KYC:        KYCSubmission{Status: "none"},
+			CreatedAt:  time.Now(),
+		}
+		o.providers[claims.UserID] = profile
+	}
+	profile.AgentID = req.AgentID
+	profile.Checks = []*VerificationCheck{
+		{Kind: CheckBenchmark, Status: "pending"},
+		{Kind: CheckConnectivity, Status: "pending"},
+	}
+	profile.UpdatedAt = time.Now()
+	o.mu.Unlock()
+
+	go o.runVerification(context.WithoutCancel(r.Context()), claims.UserID)
+
+	o.writeProfile(w, claims.UserID)
+}
+
+// GetOnboarding returns the caller's onboarding profile
+func (o *Onboarding) GetOnboarding(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	o.writeProfile(w, claims.UserID)
+}
+
+// GetProviderOnboarding returns any provider's onboarding profile (admin only)
+func (o *Onboarding) GetProviderOnboarding(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+	o.writeProfile(w, mux.Vars(r)["id"])
+}
+
+// SubmitKYC records KYC documents and forwards them to the KYC vendor hook
+func (o *Onboarding) SubmitKYC(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		DocumentType string `json:"document_type"`
+		DocumentRef  string `json:"document_ref"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DocumentType == "" || req.DocumentRef == "" {
+		http.Error(w, "document_type and document_ref are required", http.StatusBadRequest)
+		return
+	}
+
+	claims := r.Context().Value("claims").(*Claims)
+
+	o.mu.Lock()
+	profile, exists := o.providers[claims.UserID]
+	if !exists {
+		o.mu.Unlock()
+		http.Error(w, "Onboarding not started", http.StatusNotFound)
+		return
+	}
+	if profile.KYC.Status == "approved" {
+		o.mu.Unlock()
+		http.Error(w, "KYC already approved", http.StatusConflict)
+		return
+	}
+	now := time.Now()
+	profile.KYC = KYCSubmission{
+		Status:       "submitted",
+		DocumentType: req.DocumentType,
+		DocumentRef:  req.DocumentRef,
+		SubmittedAt:  &now,
+	}
+	profile.UpdatedAt = now
+	o.mu.Unlock()
+
+	if o.kycWebhookURL != "" {
+		go o.forwardKYC(claims.UserID, req.DocumentType, req.DocumentRef)
+	}
+
+	o.writeProfile(w, claims.UserID)
+}
+
+// ReviewKYC approves or rejects a provider's KYC submission. It is called by
+// admins or by the KYC vendor hook using an admin token.
+func (o *Onboarding) ReviewKYC(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Approved bool   `json:"approved"`
+		Reason   string `json:"reason,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	providerID := mux.Vars(r)["id"]
+
+	o.mu.Lock()
+	profile, exists := o.providers[providerID]
+	if !exists || profile.KYC.Status != "submitted" {
+		o.mu.Unlock()
+		http.Error(w, "No pending KYC submission", http.StatusNotFound)
+		return
+	}
+	now := time.Now()
+	profile.KYC.ReviewedAt = &now
+	profile.KYC.ReviewedBy = claims.UserID
+	if req.Approved {
+		profile.KYC.Status = "approved"
+		profile.KYC.RejectReason = ""
+	} else {
+		profile.KYC.Status = "rejected"
+		profile.KYC.RejectReason = req.Reason
+	}
+	profile.UpdatedAt = now
+	o.mu.Unlock()
+
+	o.advance(r.Context(), providerID)
+	o.writeProfile(w, providerID)
+}
+
+// Activate moves a verified provider to active, unlocking full marketplace visibility
+func (o *Onboarding) Activate(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	o.mu.Lock()
+	profile, exists := o.providers[claims.UserID]
+	if !exists || profile.Status != ProviderVerified {
+		o.mu.Unlock()
+		http.Error(w, "Provider must be verified before activation", http.StatusConflict)
+		return
+	}
+	now := time.Now()
+	profile.Status = ProviderActive
+	profile.ActivatedAt = &now
+	profile.UpdatedAt = now
+	o.mu.Unlock()
+
+	o.publishStatus(r.Context(), claims.UserID, ProviderActive)
+	o.writeProfile(w, claims.UserID)
+}
+
+// Verification
+
+// runVerification submits the benchmark and connectivity jobs for a provider
+func (o *Onboarding) runVerification(ctx context.Context, providerID string) {
+	o.mu.RLock()
+	profile, exists := o.providers[providerID]
+	if !exists {
+		o.mu.RUnlock()
+		return
+	}
+	agentID := profile.AgentID
+	checks := profile.Checks
+	o.mu.RUnlock()
+
+	for _, check := range checks {
+		jobID, err := o.submitVerificationJob(ctx, providerID, agentID, check.Kind)
+
+		o.mu.Lock()
+		now := time.Now()
+		check.StartedAt = &now
+		if err != nil {
+			check.Status = "failed"
+			check.Detail = err.Error()
+			check.CompletedAt = &now
+		} else {
+			check.Status = "running"
+			check.JobID = jobID
+			o.jobIndex[jobID] = providerID
+		}
+		o.mu.Unlock()
+
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to submit verification job", "provider_id", providerID, "check", check.Kind, obs.KeyError, err)
+		}
+	}
+}
+
+// agentOwner returns the user the scheduler records as owning an agent, or
+// "" if ownership was never set
+func (o *Onboarding) agentOwner(ctx context.Context, agentID string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", o.schedulerURL+"/api/v1/agents/"+url.PathEscape(agentID)+"/trust", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.serviceToken)
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return "", obs.Errorf(obs.CodeUnavailable, "failed to look up agent: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", obs.ResponseError(resp, "agent %s", agentID)
+	}
+	var record struct {
+		OwnerID string `json:"owner_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		return "", fmt.Errorf("failed to decode agent trust: %w", err)
+	}
+	return record.OwnerID, nil
+}
+
+// submitVerificationJob submits a job pinned to the provider's agent
+func (o *Onboarding) submitVerificationJob(ctx context.Context, providerID, agentID, kind string) (string, error) {
+	payload := map[string]interface{}{
+		"image": o.benchmarkImage,
+		"args":  []string{kind},
+	}
+	job := map[string]interface{}{
+		"type":     "docker",
+		"priority": 8,
+		"requirements": map[string]interface{}{
+			"cpu_cores":  1,
+			"memory_mb":  512,
+			"storage_mb": 100,
+		},
+		"payload":         payload,
+		"max_retries":     1,
+		"target_agent_id": agentID,
+		"tags": map[string]string{
+			"purpose":  "provider-verification",
+			"provider": providerID,
+		},
+	}
+
+	body, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", o.schedulerURL+"/api/v1/jobs", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+o.serviceToken)
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to submit verification job: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("scheduler returned status %d", resp.StatusCode)
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to decode scheduler response: %w", err)
+	}
+	return created.ID, nil
+}
+
+// handleJobEvent records the outcome of a verification job
+func (o *Onboarding) handleJobEvent(ctx context.Context, msg *nats.Msg) error {
+	var job struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(msg.Data, &job); err != nil {
+		return obs.Wrap(obs.CodeInvalidArgument, err)
+	}
+
+	o.mu.Lock()
+	providerID, exists := o.jobIndex[job.ID]
+	if !exists {
+		o.mu.Unlock()
+		return nil
+	}
+	delete(o.jobIndex, job.ID)
+
+	if profile, ok := o.providers[providerID]; ok {
+		now := time.Now()
+		for _, check := range profile.Checks {
+			if check.JobID != job.ID {
+				continue
+			}
+			check.CompletedAt = &now
+			if job.Status == "completed" {
+				check.Status = "passed"
+			} else {
+				check.Status = "failed"
+				check.Detail = fmt.Sprintf("verification job %s", job.Status)
+			}
+		}
+		profile.UpdatedAt = now
+	}
+	o.mu.Unlock()
+
+	o.advance(ctx, providerID)
+	return nil
+}
+
+// advance promotes a pending provider to verified once KYC is approved and
+// every verification check has passed
+func (o *Onboarding) advance(ctx context.Context, providerID string) {
+	o.mu.Lock()
+	profile, exists := o.providers[providerID]
+	if !exists || profile.Status != ProviderPending || profile.KYC.Status != "approved" {
+		o.mu.Unlock()
+		return
+	}
+	for _, check := range profile.Checks {
+		if check.Status != "passed" {
+			o.mu.Unlock()
+			return
+		}
+	}
+	profile.Status = ProviderVerified
+	profile.UpdatedAt = time.Now()
+	o.mu.Unlock()
+
+	o.publishStatus(ctx, providerID, ProviderVerified)
+}
+
+func (o *Onboarding) forwardKYC(providerID, documentType, documentRef string) {
+	body, _ := json.Marshal(map[string]string{
+		"provider_id":   providerID,
+		"document_type": documentType,
+		"document_ref":  documentRef,
+	})
+
+	resp, err := o.httpClient.Post(o.kycWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Error("Failed to forward KYC submission", "provider_id", providerID, obs.KeyError, err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		slog.Error("KYC webhook rejected submission", "provider_id", providerID, "status", resp.StatusCode)
+	}
+}
+
+func (o *Onboarding) publishStatus(ctx context.Context, providerID, status string) {
+	o.service.publishEvent(ctx, "provider.status_changed", map[string]interface{}{
+		"provider_id": providerID,
+		"status":      status,
+		"timestamp":   time.Now(),
+	})
+}
+
+func (o *Onboarding) writeProfile(w http.ResponseWriter, providerID string) {
+	o.mu.RLock()
+	profile, exists := o.providers[providerID]
+	var data []byte
+	if exists {
+		data, _ = json.Marshal(profile)
+	}
+	o.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Onboarding not started", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func (o *Onboarding) subscribe() {
+	o.service.bus.Subscribe("job.completed", o.handleJobEvent)
+	o.service.bus.Subscribe("job.failed", o.handleJobEvent)
+}
+
+// envInt reads an integer environment variable with a default
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,695 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+)
+
+// Time-in-force values for bids and offers. Orders without one keep the
+// default expiry applied at validation.
+const (
+	TimeInForceGTC = "GTC" // Good till cancelled, rests for up to maxGTCDuration
+	TimeInForceGTT = "GTT" // Good till time, rests until ExpiresAt
+	TimeInForceFOK = "FOK" // Fill or kill, matched on arrival or cancelled
+)
+
+// maxGTCDuration bounds how long a good-till-cancelled order rests
+const maxGTCDuration = 30 * 24 * time.Hour
+
+// maxExecutionReports is the number of recent reports retained per account
+const maxExecutionReports = 1000
+
+// Execution report types, after FIX ExecType
+const (
+	ExecNew       = "new"
+	ExecReplaced  = "replaced"
+	ExecCancelled = "cancelled"
+	ExecExpired   = "expired"
+	ExecTrade     = "trade"
+	ExecRestated  = "restated" // Reactivated without a client request
+)
+
+// ExecutionReport records one change to an account's order
+type ExecutionReport struct {
+	ExecID        uint64                     `json:"exec_id"` // Increases monotonically; resume with since=exec_id
+	AccountID     string                     `json:"account_id"`
+	OrderID       string                     `json:"order_id"`
+	ClientOrderID string                     `json:"client_order_id,omitempty"`
+	Side          string                     `json:"side"` // bid, offer
+	ExecType      string                     `json:"exec_type"`
+	OrderStatus   string                     `json:"order_status"`
+	TimeInForce   string                     `json:"time_in_force,omitempty"`
+	LimitPrice    *decimal.Decimal           `json:"limit_price,omitempty"`    // Bid max price per hour
+	PricePerHour  map[string]decimal.Decimal `json:"price_per_hour,omitempty"` // Offer prices
+	MatchID       string                     `json:"match_id,omitempty"`
+	TradePrice    *decimal.Decimal           `json:"trade_price,omitempty"`
+	Text          string                     `json:"text,omitempty"`
+	Timestamp     time.Time                  `json:"timestamp"`
+}
+
+// ExecutionReports retains recent execution reports per account and streams
+// new ones to the account's subscribers
+type ExecutionReports struct {
+	seq         uint64
+	reports     map[string][]ExecutionReport
+	subscribers map[string]map[chan ExecutionReport]struct{}
+	mu          sync.Mutex
+}
+
+// NewExecutionReports creates an empty report store
+func NewExecutionReports() *ExecutionReports {
+	return &ExecutionReports{
+		reports:     make(map[string][]ExecutionReport),
+		subscribers: make(map[string]map[chan ExecutionReport]struct{}),
+	}
+}
+
+// Report stores a report and delivers it to the account's live streams. It
+// never takes the marketplace lock, so callers may hold it.
+func (e *ExecutionReports) Report(report ExecutionReport) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.seq++
+	report.ExecID = e.seq
+	report.Timestamp = time.Now()
+
+	kept := append(e.reports[report.AccountID], report)
+	if len(kept) > maxExecutionReports {
+		kept = append([]ExecutionReport(nil), kept[len(kept)-maxExecutionReports:]...)
+	}
+	e.reports[report.AccountID] = kept
+
+	for ch := range e.subscribers[report.AccountID] {
+		select {
+		case ch <- report:
+		default:
+			// The stream falls behind; the client resumes with since=exec_id
+		}
+	}
+}
+
+// Since returns an account's retained reports after an exec ID
+func (e *ExecutionReports) Since(accountID string, since uint64) []ExecutionReport {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	reports := make([]ExecutionReport, 0)
+	for _, report := range e.reports[accountID] {
+		if report.ExecID > since {
+			reports = append(reports, report)
+		}
+	}
+	return reports
+}
+
+func (e *ExecutionReports) subscribe(accountID string) chan ExecutionReport {
+	ch := make(chan ExecutionReport, 256)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.subscribers[accountID] == nil {
+		e.subscribers[accountID] = make(map[chan ExecutionReport]struct{})
+	}
+	e.subscribers[accountID][ch] = struct{}{}
+	return ch
+}
+
+func (e *ExecutionReports) unsubscribe(accountID string, ch chan ExecutionReport) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.subscribers[accountID], ch)
+	if len(e.subscribers[accountID]) == 0 {
+		delete(e.subscribers, accountID)
+	}
+}
+
+// bidReport builds a report from a bid; callers hold the marketplace lock or own the bid
+func bidReport(bid *Bid, execType, text string) ExecutionReport {
+	price := bid.MaxPricePerHour
+	return ExecutionReport{
+		AccountID:     bid.ConsumerID,
+		OrderID:       bid.ID,
+		ClientOrderID: bid.ClientOrderID,
+		Side:          "bid",
+		ExecType:      execType,
+		OrderStatus:   bid.Status,
+		TimeInForce:   bid.TimeInForce,
+		LimitPrice:    &price,
+		Text:          text,
+	}
+}
+
+// offerReport builds a report from an offer; callers hold the marketplace lock or own the offer
+func offerReport(offer *Offer, execType, text string) ExecutionReport {
+	prices := make(map[string]decimal.Decimal, len(offer.PricePerHour))
+	for resource, price := range offer.PricePerHour {
+		prices[resource] = price
+	}
+	return ExecutionReport{
+		AccountID:     offer.ProviderID,
+		OrderID:       offer.ID,
+		ClientOrderID: offer.ClientOrderID,
+		Side:          "offer",
+		ExecType:      execType,
+		OrderStatus:   offer.Status,
+		TimeInForce:   offer.TimeInForce,
+		PricePerHour:  prices,
+		Text:          text,
+	}
+}
+
+// reportTrade reports a new match to both the consumer and the provider.
+// Called by the matching engine with the marketplace lock held.
+func (s *MarketplaceService) reportTrade(match *Match, bid *Bid, offer *Offer) {
+	price := match.AgreedPrice
+
+	report := bidReport(bid, ExecTrade, "")
+	report.MatchID = match.ID
+	report.TradePrice = &price
+	s.executions.Report(report)
+
+	report = offerReport(offer, ExecTrade, "")
+	report.MatchID = match.ID
+	report.TradePrice = &price
+	s.executions.Report(report)
+}
+
+// applyTimeInForce validates a time-in-force flag and sets the order expiry
+// it implies. Offers cannot be fill-or-kill since they never cross on arrival.
+func applyTimeInForce(tif string, expiresAt *time.Time, side string) error {
+	now := time.Now()
+	switch tif {
+	case "":
+		return nil
+	case TimeInForceGTC:
+		*expiresAt = now.Add(maxGTCDuration)
+	case TimeInForceGTT:
+		if !expiresAt.After(now) {
+			return fmt.Errorf("good-till-time orders need an expires_at in the future")
+		}
+		if expiresAt.After(now.Add(maxGTCDuration)) {
+			return fmt.Errorf("expires_at may be at most %s ahead", maxGTCDuration)
+		}
+	case TimeInForceFOK:
+		if side != "bid" {
+			return fmt.Errorf("fill-or-kill applies to bids only")
+		}
+		*expiresAt = now.Add(time.Minute)
+	default:
+		return fmt.Errorf("time_in_force must be GTC, GTT or FOK")
+	}
+	return nil
+}
+
+// institutional reports whether an account may use the institutional order
+// API: time-in-force flags, amendments and execution reports. Accounts qualify
+// with an approved KYC review or an institutional trading scope.
+func (s *MarketplaceService) institutional(claims *Claims) bool {
+	if claims.Role == "admin" {
+		return true
+	}
+	for _, scope := range claims.Scopes {
+		if scope == "trade:institutional" {
+			return true
+		}
+	}
+	return s.onboarding.KYCApproved(claims.UserID)
+}
+
+// fillOrKill matches a fill-or-kill bid immediately and cancels it if no
+// offer can fill it
+func (s *MarketplaceService) fillOrKill(ctx context.Context, bid *Bid) {
+	s.matcher.matchBid(bid)
+
+	s.mu.Lock()
+	killed := bid.Status == "pending"
+	var report ExecutionReport
+	if killed {
+		bid.Status = "cancelled"
+		report = bidReport(bid, ExecCancelled, "fill-or-kill order could not be filled")
+		s.updateActiveMetrics()
+	}
+	s.mu.Unlock()
+
+	if killed {
+		s.executions.Report(report)
+		s.publishEvent(ctx, "bid.cancelled", bid)
+	}
+}
+
+// expireOrders moves resting orders past their expiry to expired
+func (s *MarketplaceService) expireOrders() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		var reports []ExecutionReport
+
+		s.mu.Lock()
+		for _, bid := range s.bids {
+			if bid.Status == "pending" && now.After(bid.ExpiresAt) {
+				bid.Status = "expired"
+				reports = append(reports, bidReport(bid, ExecExpired, ""))
+			}
+		}
+		for _, offer := range s.offers {
+			if offer.Status == "active" && now.After(offer.ExpiresAt) {
+				offer.Status = "expired"
+				reports = append(reports, offerReport(offer, ExecExpired, ""))
+			}
+		}
+		if len(reports) > 0 {
+			s.updateActiveMetrics()
+		}
+		s.mu.Unlock()
+
+		for _, report := range reports {
+			s.executions.Report(report)
+		}
+	}
+}
+
+// HTTP Handlers
+
+// ReplaceBid amends a pending bid in place (cancel-replace). The bid keeps its
+// queue priority only when the amendment cannot make it harder to fill ahead
+// of others: the price and start time are unchanged and no requirement or the
+// duration grows. Any other change moves it to the back of its price level.
+func (s *MarketplaceService) ReplaceBid(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if !s.institutional(claims) {
+		http.Error(w, "Order amendments require a KYC-verified institutional account", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		ClientOrderID    string                `json:"client_order_id"`
+		Requirements     *ResourceRequirements `json:"requirements"`
+		MaxPricePerHour  *decimal.Decimal      `json:"max_price_per_hour"`
+		Duration         *time.Duration        `json:"duration"`
+		StartTime        *time.Time            `json:"start_time"`
+		ExpiresAt        *time.Time            `json:"expires_at"`
+		TimeInForce      *string               `json:"time_in_force"`
+		Location         *string               `json:"location"`
+		PreferredRegions []string              `json:"preferred_regions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	bidID := mux.Vars(r)["id"]
+
+	s.mu.Lock()
+	bid, exists := s.bids[bidID]
+	if !exists {
+		s.mu.Unlock()
+		http.Error(w, "Bid not found", http.StatusNotFound)
+		return
+	}
+	if bid.ConsumerID != claims.UserID {
+		s.mu.Unlock()
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	if bid.Status != "pending" {
+		s.mu.Unlock()
+		http.Error(w, "Only pending bids can be amended", http.StatusConflict)
+		return
+	}
+
+	amended := *bid
+	if req.ClientOrderID != "" {
+		amended.ClientOrderID = req.ClientOrderID
+	}
+	if req.Requirements != nil {
+		amended.Requirements = *req.Requirements
+	}
+	if req.MaxPricePerHour != nil {
+		amended.MaxPricePerHour = *req.MaxPricePerHour
+	}
+	if req.Duration != nil {
+		amended.Duration = *req.Duration
+	}
+	if req.StartTime != nil {
+		amended.StartTime = *req.StartTime
+	}
+	if req.ExpiresAt != nil {
+		amended.ExpiresAt = *req.ExpiresAt
+	}
+	if req.TimeInForce != nil {
+		amended.TimeInForce = *req.TimeInForce
+	}
+	if req.Location != nil {
+		amended.Location = *req.Location
+	}
+	if req.PreferredRegions != nil {
+		amended.PreferredRegions = req.PreferredRegions
+	}
+
+	var err error
+	if amended.TimeInForce == TimeInForceFOK {
+		err = fmt.Errorf("resting bids cannot be amended to fill-or-kill")
+	} else if req.TimeInForce != nil || req.ExpiresAt != nil {
+		err = applyTimeInForce(amended.TimeInForce, &amended.ExpiresAt, "bid")
+	}
+	if err == nil {
+		err = s.validateBid(&amended)
+	}
+	if err != nil {
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	retained := amended.MaxPricePerHour.Equal(bid.MaxPricePerHour) &&
+		amended.StartTime.Equal(bid.StartTime) &&
+		amended.Duration <= bid.Duration &&
+		!requirementsGrew(bid.Requirements, amended.Requirements)
+	text := "priority retained"
+	if !retained {
+		amended.PriorityTime = time.Now()
+		text = "priority reset"
+	}
+
+	*bid = amended
+	report := bidReport(bid, ExecReplaced, text)
+	s.mu.Unlock()
+
+	s.executions.Report(report)
+	s.publishEvent(r.Context(), "bid.replaced", bid)
+	s.broadcastUpdate("bids", map[string]interface{}{
+		"type": "bid_replaced",
+		"data": bid,
+	})
+
+	go s.matcher.matchBid(bid)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bid)
+}
+
+// requirementsGrew reports whether next asks for more than prev: a larger
+// minimum, an extra required feature, a newer GPU runtime, or fewer accepted
+// GPU types
+func requirementsGrew(prev, next ResourceRequirements) bool {
+	if next.MinCPU > prev.MinCPU || next.MinMemory > prev.MinMemory || next.MinGPU > prev.MinGPU ||
+		next.MinStorage > prev.MinStorage || next.MinNetwork > prev.MinNetwork {
+		return true
+	}
+	if !containsAll(prev.Features, next.Features) || !prev.MinTrustTier.Meets(next.MinTrustTier) {
+		return true
+	}
+	if !prev.Covers(next.Requirements) {
+		return true
+	}
+	// An empty GPU type list accepts any GPU
+	return len(next.GPUTypes) > 0 && (len(prev.GPUTypes) == 0 || !containsAll(next.GPUTypes, prev.GPUTypes))
+}
+
+// containsAll reports whether every value of subset is in set
+func containsAll(set, subset []string) bool {
+	for _, value := range subset {
+		found := false
+		for _, candidate := range set {
+			if candidate == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// CancelBid cancels a pending bid
+func (s *MarketplaceService) CancelBid(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	bidID := mux.Vars(r)["id"]
+
+	s.mu.Lock()
+	bid, exists := s.bids[bidID]
+	if !exists {
+		s.mu.Unlock()
+		http.Error(w, "Bid not found", http.StatusNotFound)
+		return
+	}
+	if bid.ConsumerID != claims.UserID && claims.Role != "admin" {
+		s.mu.Unlock()
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	if bid.Status != "pending" {
+		s.mu.Unlock()
+		http.Error(w, "Only pending bids can be cancelled", http.StatusConflict)
+		return
+	}
+	bid.Status = "cancelled"
+	report := bidReport(bid, ExecCancelled, "")
+	s.updateActiveMetrics()
+	s.mu.Unlock()
+
+	s.executions.Report(report)
+	s.publishEvent(r.Context(), "bid.cancelled", bid)
+	s.broadcastUpdate("bids", map[string]interface{}{
+		"type": "bid_cancelled",
+		"data": bid,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReplaceOffer amends the prices, availability and expiry of an active offer.
+// Resources cannot change; list a new offer for different hardware.
+func (s *MarketplaceService) ReplaceOffer(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if !s.institutional(claims) {
+		http.Error(w, "Order amendments require a KYC-verified institutional account", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		ClientOrderID string                     `json:"client_order_id"`
+		PricePerHour  map[string]decimal.Decimal `json:"price_per_hour"`
+		PriceFloor    map[string]decimal.Decimal `json:"price_floor"`
+		Availability  *AvailabilityWindow        `json:"availability"`
+		ExpiresAt     *time.Time                 `json:"expires_at"`
+		TimeInForce   *string                    `json:"time_in_force"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	offerID := mux.Vars(r)["id"]
+
+	s.mu.Lock()
+	offer, exists := s.offers[offerID]
+	if !exists {
+		s.mu.Unlock()
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return
+	}
+	if offer.ProviderID != claims.UserID {
+		s.mu.Unlock()
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	if offer.Status != "active" {
+		s.mu.Unlock()
+		http.Error(w, "Only active offers can be amended", http.StatusConflict)
+		return
+	}
+
+	amended := *offer
+	if req.ClientOrderID != "" {
+		amended.ClientOrderID = req.ClientOrderID
+	}
+	if req.PricePerHour != nil {
+		amended.PricePerHour = req.PricePerHour
+	}
+	if req.PriceFloor != nil {
+		amended.PriceFloor = req.PriceFloor
+	}
+	if req.Availability != nil {
+		amended.Availability = *req.Availability
+	}
+	if req.ExpiresAt != nil {
+		amended.ExpiresAt = *req.ExpiresAt
+	}
+	if req.TimeInForce != nil {
+		amended.TimeInForce = *req.TimeInForce
+	}
+
+	var err error
+	if req.TimeInForce != nil || req.ExpiresAt != nil {
+		err = applyTimeInForce(amended.TimeInForce, &amended.ExpiresAt, "offer")
+	}
+	if err == nil {
+		err = s.validateOffer(&amended)
+	}
+	if err != nil {
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	amended.UpdatedAt = time.Now()
+	*offer = amended
+	report := offerReport(offer, ExecReplaced, "")
+	s.mu.Unlock()
+
+	s.executions.Report(report)
+	s.publishEvent(r.Context(), "offer.replaced", offer)
+	s.broadcastUpdate("offers", map[string]interface{}{
+		"type": "offer_replaced",
+		"data": offer,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(offer)
+}
+
+// CancelOffer withdraws an active offer
+func (s *MarketplaceService) CancelOffer(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	offerID := mux.Vars(r)["id"]
+
+	s.mu.Lock()
+	offer, exists := s.offers[offerID]
+	if !exists {
+		s.mu.Unlock()
+		http.Error(w, "Offer not found", http.StatusNotFound)
+		return
+	}
+	if offer.ProviderID != claims.UserID && claims.Role != "admin" {
+		s.mu.Unlock()
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	if offer.Status != "active" {
+		s.mu.Unlock()
+		http.Error(w, "Only active offers can be cancelled", http.StatusConflict)
+		return
+	}
+	offer.Status = "cancelled"
+	offer.UpdatedAt = time.Now()
+	report := offerReport(offer, ExecCancelled, "")
+	s.updateActiveMetrics()
+	s.mu.Unlock()
+
+	s.executions.Report(report)
+	s.publishEvent(r.Context(), "offer.cancelled", offer)
+	s.broadcastUpdate("offers", map[string]interface{}{
+		"type": "offer_cancelled",
+		"data": offer,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListExecutions returns the caller's retained execution reports after since
+func (s *MarketplaceService) ListExecutions(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if !s.institutional(claims) {
+		http.Error(w, "Execution reports require a KYC-verified institutional account", http.StatusForbidden)
+		return
+	}
+
+	since, ok := parseSince(r)
+	if !ok {
+		http.Error(w, "Invalid since", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.executions.Since(claims.UserID, since))
+}
+
+// StreamExecutions streams the caller's execution reports over a WebSocket,
+// first replaying retained reports after since
+func (s *MarketplaceService) StreamExecutions(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if !s.institutional(claims) {
+		http.Error(w, "Execution reports require a KYC-verified institutional account", http.StatusForbidden)
+		return
+	}
+
+	since, ok := parseSince(r)
+	if !ok {
+		http.Error(w, "Invalid since", http.StatusBadRequest)
+		return
+	}
+
+	conn, err := s.wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "WebSocket upgrade failed", obs.KeyError, err)
+		return
+	}
+	defer conn.Close()
+
+	// Subscribe before replaying so no report falls between the two
+	live := s.executions.subscribe(claims.UserID)
+	defer s.executions.unsubscribe(claims.UserID, live)
+
+	last := since
+	for _, report := range s.executions.Since(claims.UserID, since) {
+		if err := conn.WriteJSON(report); err != nil {
+			return
+		}
+		last = report.ExecID
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case report := <-live:
+			if report.ExecID <= last {
+				continue
+			}
+			if err := conn.WriteJSON(report); err != nil {
+				return
+			}
+			last = report.ExecID
+		case <-closed:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+			return
+		}
+	}
+}
+
+// parseSince reads the since exec ID query parameter
+func parseSince(r *http.Request) (uint64, bool) {
+	v := r.URL.Query().Get("since")
+	if v == "" {
+		return 0, true
+	}
+	since, err := strconv.ParseUint(v, 10, 64)
+	return since, err == nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// floorResources are the resources a price floor can protect, priced per
+// unit per hour like Offer.PricePerHour: per core, per GB of memory, per GPU
+// and per GB of storage
+var floorResources = map[string]bool{"cpu": true, "memory": true, "gpu": true, "storage": true}
+
+// ProviderPriceFloors are a provider's minimum prices across all its offers.
+// Floors for a location replace Default for offers in that location.
+type ProviderPriceFloors struct {
+	ProviderID string                                `json:"provider_id"`
+	Default    map[string]decimal.Decimal            `json:"default,omitempty"`   // resource -> minimum price per unit hour
+	Locations  map[string]map[string]decimal.Decimal `json:"locations,omitempty"` // location -> resource -> minimum price
+	UpdatedAt  time.Time                             `json:"updated_at"`
+}
+
+// FloorBreach records the market price of a resource staying below a
+// provider's floor in one location
+type FloorBreach struct {
+	ProviderID  string          `json:"provider_id"`
+	Location    string          `json:"location"`
+	Resource    string          `json:"resource"`
+	Floor       decimal.Decimal `json:"floor"`
+	MarketPrice decimal.Decimal `json:"market_price"` // Price index median
+	Since       time.Time       `json:"since"`
+	NotifiedAt  *time.Time      `json:"notified_at,omitempty"`
+}
+
+// PriceFloors holds provider price floors and watches the market against
+// them.
+//
+// The matching engine never prices an offer below its floor: each resource
+// trades at the higher of the offer's price and the floor, so auto-priced or
+// underpriced offers either clear at the floor or not at all. The effective
+// floor is the higher of the offer's own PriceFloor and its provider's floor
+// for the offer's location.
+//
+// When the price index median for a resource stays below a provider's floor
+// in a location where the provider has offers for PRICE_FLOOR_ALERT_MINUTES
+// (default 60), a provider.price_floor.breached event notifies the provider
+// once; provider.price_floor.recovered follows when the market recovers.
+type PriceFloors struct {
+	service    *MarketplaceService
+	providers  map[string]*ProviderPriceFloors
+	breaches   map[string]*FloorBreach // provider|location|resource -> breach
+	alertAfter time.Duration
+	mu         sync.RWMutex
+}
+
+// NewPriceFloors creates the floor registry from the environment
+func NewPriceFloors(s *MarketplaceService) *PriceFloors {
+	return &PriceFloors{
+		service:    s,
+		providers:  make(map[string]*ProviderPriceFloors),
+		breaches:   make(map[string]*FloorBreach),
+		alertAfter: time.Duration(envInt("PRICE_FLOOR_ALERT_MINUTES", 60)) * time.Minute,
+	}
+}
+
+// floor returns the effective floor of one resource of an offer
+func (p *PriceFloors) floor(offer *Offer, resource string) decimal.Decimal {
+	floor := offer.PriceFloor[resource]
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if provider, ok := p.providers[offer.ProviderID]; ok {
+		if providerFloor, ok := provider.floorFor(offer.Location, resource); ok && providerFloor.GreaterThan(floor) {
+			floor = providerFloor
+		}
+	}
+	return floor
+}
+
+// price returns what one unit of a resource of an offer trades at: its price,
+// raised to the floor
+func (p *PriceFloors) price(offer *Offer, resource string) decimal.Decimal {
+	return decimal.Max(offer.PricePerHour[resource], p.floor(offer, resource))
+}
+
+// floorFor returns the provider's floor for a resource in a location
+func (f *ProviderPriceFloors) floorFor(location, resource string) (decimal.Decimal, bool) {
+	if floors, ok := f.Locations[location]; ok {
+		floor, ok := floors[resource]
+		return floor, ok
+	}
+	floor, ok := f.Default[resource]
+	return floor, ok
+}
+
+// validateFloors rejects unknown resources and negative floors
+func validateFloors(floors map[string]decimal.Decimal) error {
+	for resource, floor := range floors {
+		if !floorResources[resource] {
+			return fmt.Errorf("unknown price floor resource %q", resource)
+		}
+		if floor.IsNegative() {
+			return fmt.Errorf("price floor for %s must not be negative", resource)
+		}
+	}
+	return nil
+}
+
+// watchMarket compares the price index with every provider's floors in the
+// locations the provider has live offers, and notifies providers of breaches
+// that lasted alertAfter
+func (p *PriceFloors) watchMarket(ctx context.Context, index *RegionPriceIndex) {
+	s := p.service
+	now := time.Now()
+
+	s.mu.RLock()
+	locations := make(map[string]map[string]bool) // provider -> locations with live offers
+	for _, offer := range s.offers {
+		if offer.Status != "active" && offer.Status != "reserved" {
+			continue
+		}
+		if locations[offer.ProviderID] == nil {
+			locations[offer.ProviderID] = make(map[string]bool)
+		}
+		locations[offer.ProviderID][offer.Location] = true
+	}
+	s.mu.RUnlock()
+
+	marketPrices := make(map[string]map[string]decimal.Decimal) // location -> resource -> median
+	var breached, recovered []FloorBreach
+	seen := make(map[string]bool)
+
+	p.mu.Lock()
+	for providerID, floors := range p.providers {
+		for location := range locations[providerID] {
+			if marketPrices[location] == nil {
+				marketPrices[location] = indexPrices(index, location)
+			}
+			for resource := range floorResources {
+				floor, ok := floors.floorFor(location, resource)
+				market, priced := marketPrices[location][resource]
+				if !ok || !priced || !market.LessThan(floor) {
+					continue
+				}
+
+				key := providerID + "|" + location + "|" + resource
+				seen[key] = true
+				breach, exists := p.breaches[key]
+				if !exists {
+					breach = &FloorBreach{ProviderID: providerID, Location: location, Resource: resource, Since: now}
+					p.breaches[key] = breach
+				}
+				breach.Floor = floor
+				breach.MarketPrice = market
+
+				if breach.NotifiedAt == nil && now.Sub(breach.Since) >= p.alertAfter {
+					breach.NotifiedAt = &now
+					breached = append(breached, *breach)
+				}
+			}
+		}
+	}
+	for key, breach := range p.breaches {
+		if seen[key] {
+			continue
+		}
+		if breach.NotifiedAt != nil {
+			recovered = append(recovered, *breach)
+		}
+		delete(p.breaches, key)
+	}
+	p.mu.Unlock()
+
+	for i := range breached {
+		breach := &breached[i]
+		slog.InfoContext(ctx, "Market below provider price floor", "provider_id", breach.ProviderID,
+			"location", breach.Location, "resource", breach.Resource, "floor", breach.Floor, "market_price", breach.MarketPrice)
+		s.publishEvent(ctx, "provider.price_floor.breached", breach)
+	}
+	for i := range recovered {
+		s.publishEvent(ctx, "provider.price_floor.recovered", &recovered[i])
+	}
+}
+
+// providerBreaches returns a provider's current breaches; callers hold p.mu
+func (p *PriceFloors) providerBreaches(providerID string) []FloorBreach {
+	breaches := make([]FloorBreach, 0)
+	for _, breach := range p.breaches {
+		if breach.ProviderID == providerID {
+			breaches = append(breaches, *breach)
+		}
+	}
+	sort.Slice(breaches, func(i, j int) bool {
+		if breaches[i].Location != breaches[j].Location {
+			return breaches[i].Location < breaches[j].Location
+		}
+		return breaches[i].Resource < breaches[j].Resource
+	})
+	return breaches
+}
+
+// HTTP Handlers
+
+// GetPriceFloors returns the caller's price floors and the markets currently
+// below them
+func (p *PriceFloors) GetPriceFloors(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	p.mu.RLock()
+	floors := ProviderPriceFloors{ProviderID: claims.UserID}
+	if existing, ok := p.providers[claims.UserID]; ok {
+		floors = *existing
+	}
+	breaches := p.providerBreaches(claims.UserID)
+	p.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"floors":   floors,
+		"breaches": breaches,
+	})
+}
+
+// SetPriceFloors replaces the caller's price floors. Empty floors remove
+// them.
+func (p *PriceFloors) SetPriceFloors(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	var req struct {
+		Default   map[string]decimal.Decimal            `json:"default"`
+		Locations map[string]map[string]decimal.Decimal `json:"locations"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := validateFloors(req.Default); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for location, floors := range req.Locations {
+		if location == "" {
+			http.Error(w, "Price floor locations must be named", http.StatusBadRequest)
+			return
+		}
+		if err := validateFloors(floors); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	floors := &ProviderPriceFloors{
+		ProviderID: claims.UserID,
+		Default:    req.Default,
+		Locations:  req.Locations,
+		UpdatedAt:  time.Now(),
+	}
+
+	p.mu.Lock()
+	if len(req.Default) == 0 && len(req.Locations) == 0 {
+		delete(p.providers, claims.UserID)
+	} else {
+		p.providers[claims.UserID] = floors
+	}
+	p.mu.Unlock()
+
+	p.service.publishEvent(r.Context(), "provider.price_floors.updated", floors)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(floors)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/shopspring/decimal"
+)
+
+// PriceIndexEntry is the market price for one resource type in one location
+type PriceIndexEntry struct {
+	Resource  string          `json:"resource"` // cpu, gpu, memory, storage
+	Location  string          `json:"location"`
+	Median    decimal.Decimal `json:"median"`
+	Min       decimal.Decimal `json:"min"`
+	Max       decimal.Decimal `json:"max"`
+	Samples   int             `json:"samples"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// RegionPriceIndex is the full price index published by one region
+type RegionPriceIndex struct {
+	Region    string            `json:"region"`
+	Entries   []PriceIndexEntry `json:"entries"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// PriceIndexReplicator computes the local price index and replicates the
+// indices of peer regions so every region can quote global prices.
+//
+// Peers are configured with MARKETPLACE_FEDERATION_PEERS as comma-separated
+// region=url pairs; the local region name comes from REGION.
+type PriceIndexReplicator struct {
+	service    *MarketplaceService
+	region     string
+	peers      map[string]string // region -> base URL
+	remote     map[string]*RegionPriceIndex
+	mu         sync.RWMutex
+	httpClient *http.Client
+}
+
+// NewPriceIndexReplicator creates a replicator from the environment
+func NewPriceIndexReplicator(s *MarketplaceService) *PriceIndexReplicator {
+	region := os.Getenv("REGION")
+	if region == "" {
+		region = "default"
+	}
+
+	r := &PriceIndexReplicator{
+		service:    s,
+		region:     region,
+		peers:      make(map[string]string),
+		remote:     make(map[string]*RegionPriceIndex),
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: obs.Transport(nil)},
+	}
+
+	for _, entry := range strings.Split(os.Getenv("MARKETPLACE_FEDERATION_PEERS"), ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[0] == region {
+			continue
+		}
+		r.peers[parts[0]] = strings.TrimRight(parts[1], "/")
+	}
+
+	return r
+}
+
+// LocalIndex computes the price index from currently active offers
+func (r *PriceIndexReplicator) LocalIndex() *RegionPriceIndex {
+	r.service.mu.RLock()
+	samples := make(map[string][]decimal.Decimal) // resource|location -> prices
+	for _, offer := range r.service.offers {
+		if offer.Status != "active" {
+			continue
+		}
+		for resource, price := range offer.PricePerHour {
+			key := resource + "|" + offer.Location
+			samples[key] = append(samples[key], price)
+		}
+	}
+	r.service.mu.RUnlock()
+
+	now := time.Now()
+	index := &RegionPriceIndex{
+		Region:    r.region,
+		Entries:   make([]PriceIndexEntry, 0, len(samples)),
+		UpdatedAt: now,
+	}
+
+	for key, prices := range samples {
+		parts := strings.SplitN(key, "|", 2)
+		sort.Slice(prices, func(i, j int) bool {
+			return prices[i].LessThan(prices[j])
+		})
+
+		median := prices[len(prices)/2]
+		if len(prices)%2 == 0 {
+			median = prices[len(prices)/2-1].Add(prices[len(prices)/2]).Div(decimal.NewFromInt(2))
+		}
+
+		index.Entries = append(index.Entries, PriceIndexEntry{
+			Resource:  parts[0],
+			Location:  parts[1],
+			Median:    median,
+			Min:       prices[0],
+			Max:       prices[len(prices)-1],
+			Samples:   len(prices),
+			UpdatedAt: now,
+		})
+	}
+
+	sort.Slice(index.Entries, func(i, j int) bool {
+		if index.Entries[i].Resource != index.Entries[j].Resource {
+			return index.Entries[i].Resource < index.Entries[j].Resource
+		}
+		return index.Entries[i].Location < index.Entries[j].Location
+	})
+
+	return index
+}
+
+// run publishes the local index, checks it against provider price floors
+// and pulls peer indices every minute
+func (r *PriceIndexReplicator) run(ctx context.Context) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		local := r.LocalIndex()
+		r.service.publishEvent(ctx, "marketplace.price_index", local)
+		r.service.floors.watchMarket(ctx, local)
+		r.pullPeers(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (r *PriceIndexReplicator) pullPeers(ctx context.Context) {
+	for region, baseURL := range r.peers {
+		index, err := r.fetchPeer(ctx, baseURL)
+		if err != nil {
+			slog.Warn("Failed to replicate price index", "region", region, obs.KeyError, err)
+			continue
+		}
+		index.Region = region
+
+		r.mu.Lock()
+		r.remote[region] = index
+		r.mu.Unlock()
+	}
+}
+
+func (r *PriceIndexReplicator) fetchPeer(ctx context.Context, baseURL string) (*RegionPriceIndex, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+"/api/v1/price-index?scope=local", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, obs.ResponseError(resp, "peer returned status %d", resp.StatusCode)
+	}
+
+	var index RegionPriceIndex
+	if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
+
+// GetPriceIndex returns the local price index, or with scope=global (the
+// default) the local index plus every replicated peer index
+func (s *MarketplaceService) GetPriceIndex(w http.ResponseWriter, r *http.Request) {
+	local := s.priceIndex.LocalIndex()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("scope") == "local" {
+		json.NewEncoder(w).Encode(local)
+		return
+	}
+
+	indices := []*RegionPriceIndex{local}
+	s.priceIndex.mu.RLock()
+	for _, index := range s.priceIndex.remote {
+		indices = append(indices, index)
+	}
+	s.priceIndex.mu.RUnlock()
+
+	sort.Slice(indices[1:], func(i, j int) bool {
+		return indices[i+1].Region < indices[j+1].Region
+	})
+
+	json.NewEncoder(w).Encode(indices)
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/gpuruntime"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/computehive/core-services/pkg/trust"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// QuoteRequirements is the requirement set a consumer wants priced. Field
+// names follow scheduler job requirements so a quote can be submitted as-is.
+type QuoteRequirements struct {
+	CPUCores                int        `json:"cpu_cores"`
+	MemoryMB                int        `json:"memory_mb"`
+	GPUCount                int        `json:"gpu_count"`
+	GPUType                 string     `json:"gpu_type,omitempty"`
+	StorageMB               int        `json:"storage_mb"`
+	NetworkMbps             int        `json:"network_mbps"`
+	DurationHours           float64    `json:"duration_hours"`
+	Regions                 []string   `json:"regions,omitempty"`
+	MinTrustTier            trust.Tier `json:"min_trust_tier,omitempty"`
+	gpuruntime.Requirements            // Minimum GPU driver, CUDA and ROCm versions
+}
+
+// Quote is a binding price per hour for a requirement set, valid until ExpiresAt
+type Quote struct {
+	ID           string            `json:"id"`
+	ConsumerID   string            `json:"consumer_id"`
+	Requirements QuoteRequirements `json:"requirements"`
+	PricePerHour decimal.Decimal   `json:"price_per_hour"`
+	Currency     string            `json:"currency"`
+	OfferID      string            `json:"offer_id"`
+	Location     string            `json:"location"`
+	Status       string            `json:"status"` // active, redeemed, expired
+	CreatedAt    time.Time         `json:"created_at"`
+	ExpiresAt    time.Time         `json:"expires_at"`
+	RedeemedBy   string            `json:"redeemed_by,omitempty"` // Job ID
+}
+
+// quoteRetention is how long expired and redeemed quotes stay readable
+const quoteRetention = 24 * time.Hour
+
+// QuoteBook issues and redeems price quotes. Quotes are valid for
+// QUOTE_VALIDITY_MINUTES (default 15) and can be redeemed once, by the
+// scheduler presenting SERVICE_TOKEN on the consumer's behalf.
+type QuoteBook struct {
+	service      *MarketplaceService
+	quotes       map[string]*Quote
+	validity     time.Duration
+	serviceToken string
+	mu           sync.Mutex
+}
+
+// NewQuoteBook creates a quote book from the environment
+func NewQuoteBook(s *MarketplaceService) *QuoteBook {
+	validity := 15 * time.Minute
+	if minutes, err := strconv.Atoi(os.Getenv("QUOTE_VALIDITY_MINUTES")); err == nil && minutes > 0 {
+		validity = time.Duration(minutes) * time.Minute
+	}
+
+	return &QuoteBook{
+		service:      s,
+		quotes:       make(map[string]*Quote),
+		validity:     validity,
+		serviceToken: os.Getenv("SERVICE_TOKEN"),
+	}
+}
+
+// run drops quotes quoteRetention after they expire
+func (q *QuoteBook) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			q.mu.Lock()
+			for id, quote := range q.quotes {
+				if now.Sub(quote.ExpiresAt) > quoteRetention {
+					delete(q.quotes, id)
+				}
+			}
+			q.mu.Unlock()
+		}
+	}
+}
+
+// HTTP Handlers
+
+// CreateQuote prices a requirement set against current offers
+func (q *QuoteBook) CreateQuote(w http.ResponseWriter, r *http.Request) {
+	var req QuoteRequirements
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CPUCores <= 0 || req.MemoryMB <= 0 {
+		http.Error(w, "cpu_cores and memory_mb must be positive", http.StatusBadRequest)
+		return
+	}
+	if req.DurationHours <= 0 {
+		req.DurationHours = 1
+	}
+	tier, err := trust.Parse(string(req.MinTrustTier))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.MinTrustTier = tier
+	if err := req.Requirements.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offer, price := q.bestOffer(&req)
+	if offer == nil {
+		http.Error(w, "No offers can satisfy these requirements", http.StatusNotFound)
+		return
+	}
+
+	claims := r.Context().Value("claims").(*Claims)
+	now := time.Now()
+	quote := &Quote{
+		ID:           generateID(),
+		ConsumerID:   claims.UserID,
+		Requirements: req,
+		PricePerHour: price,
+		Currency:     "USD",
+		OfferID:      offer.ID,
+		Location:     offer.Location,
+		Status:       "active",
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(q.validity),
+	}
+
+	q.mu.Lock()
+	q.quotes[quote.ID] = quote
+	q.mu.Unlock()
+
+	q.service.publishEvent(r.Context(), "quote.created", quote)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(quote)
+}
+
+// GetQuote returns a quote owned by the caller
+func (q *QuoteBook) GetQuote(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	q.mu.Lock()
+	quote, exists := q.quotes[mux.Vars(r)["id"]]
+	if exists {
+		q.expire(quote)
+	}
+	var data []byte
+	if exists {
+		data, _ = json.Marshal(quote)
+	}
+	q.mu.Unlock()
+
+	if !exists {
+		http.Error(w, "Quote not found", http.StatusNotFound)
+		return
+	}
+	if quote.ConsumerID != claims.UserID && claims.Role != "admin" {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// RedeemQuote binds a quote to a job. Only the scheduler may call it, on
+// submission with the job's owner and requirements, authenticated with
+// SERVICE_TOKEN; a quote is redeemable once.
+func (q *QuoteBook) RedeemQuote(w http.ResponseWriter, r *http.Request) {
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if q.serviceToken == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(q.serviceToken)) != 1 {
+		http.Error(w, "Service token required", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		JobID        string            `json:"job_id"`
+		ConsumerID   string            `json:"consumer_id"`
+		Requirements QuoteRequirements `json:"requirements"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.JobID == "" || req.ConsumerID == "" {
+		http.Error(w, "job_id and consumer_id are required", http.StatusBadRequest)
+		return
+	}
+
+	q.mu.Lock()
+	quote, exists := q.quotes[mux.Vars(r)["id"]]
+	var err error
+	switch {
+	case !exists:
+		err = obs.Errorf(obs.CodeNotFound, "quote not found")
+	case quote.ConsumerID != req.ConsumerID:
+		err = obs.Errorf(obs.CodePermissionDenied, "quote belongs to another consumer")
+	case q.expire(quote):
+		err = obs.Errorf(obs.CodeConflict, "quote expired at %s", quote.ExpiresAt.Format(time.RFC3339))
+	case quote.Status != "active":
+		err = obs.Errorf(obs.CodeConflict, "quote already redeemed")
+	case !quote.Requirements.covers(&req.Requirements):
+		err = obs.Errorf(obs.CodeConflict, "job requirements exceed the quoted requirements")
+	}
+	if err == nil {
+		quote.Status = "redeemed"
+		quote.RedeemedBy = req.JobID
+	}
+	var data []byte
+	if err == nil {
+		data, _ = json.Marshal(quote)
+	}
+	q.mu.Unlock()
+
+	if err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+
+	q.service.publishEvent(r.Context(), "quote.redeemed", quote)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// bestOffer returns the cheapest active offer satisfying the requirements
+func (q *QuoteBook) bestOffer(req *QuoteRequirements) (*Offer, decimal.Decimal) {
+	bid := &Bid{
+		Requirements: ResourceRequirements{
+			MinCPU:       req.CPUCores,
+			MinMemory:    req.MemoryMB,
+			MinGPU:       req.GPUCount,
+			MinStorage:   req.StorageMB,
+			MinNetwork:   req.NetworkMbps,
+			MinTrustTier: req.MinTrustTier,
+			Requirements: req.Requirements,
+		},
+		MaxPricePerHour:  decimal.NewFromFloat(math.MaxFloat32),
+		Duration:         time.Duration(req.DurationHours * float64(time.Hour)),
+		StartTime:        time.Now(),
+		PreferredRegions: req.Regions,
+	}
+	if req.GPUType != "" {
+		bid.Requirements.GPUTypes = []string{req.GPUType}
+	}
+
+	matcher := q.service.matcher
+	q.service.mu.RLock()
+	defer q.service.mu.RUnlock()
+
+	var best *Offer
+	var bestPrice decimal.Decimal
+	for _, offer := range q.service.offers {
+		if offer.Status != "active" || !matcher.offerMeetsRequirements(offer, bid) {
+			continue
+		}
+		if req.GPUType != "" && !offerHasGPUType(offer, req.GPUType, req.GPUCount) {
+			continue
+		}
+		price := matcher.calculateOfferPrice(offer, bid)
+		if best == nil || price.LessThan(bestPrice) {
+			best = offer
+			bestPrice = price
+		}
+	}
+	return best, bestPrice
+}
+
+// expire marks an active quote expired once its window has passed; callers hold q.mu
+func (q *QuoteBook) expire(quote *Quote) bool {
+	if quote.Status == "active" && time.Now().After(quote.ExpiresAt) {
+		quote.Status = "expired"
+	}
+	return quote.Status == "expired"
+}
+
+// covers reports whether a quote's requirements are at least as large as a
+// job's, for no longer, and in regions the quote was priced for
+func (r *QuoteRequirements) covers(job *QuoteRequirements) bool {
+	if job.CPUCores > r.CPUCores || job.MemoryMB > r.MemoryMB || job.GPUCount > r.GPUCount ||
+		job.StorageMB > r.StorageMB || job.NetworkMbps > r.NetworkMbps || job.DurationHours > r.DurationHours {
+		return false
+	}
+	// A job free to run anywhere was not priced by a quote for some regions
+	if len(r.Regions) > 0 && len(job.Regions) == 0 {
+		return false
+	}
+	if !containsAll(r.Regions, job.Regions) {
+		return false
+	}
+	if !r.MinTrustTier.Meets(job.MinTrustTier) || !r.Covers(job.Requirements) {
+		return false
+	}
+	return job.GPUCount == 0 || job.GPUType == "" || job.GPUType == r.GPUType
+}
+
+// offerHasGPUType checks that an offer has enough GPUs of a model
+func offerHasGPUType(offer *Offer, model string, count int) bool {
+	available := 0
+	for _, gpu := range offer.Resources.GPU {
+		if gpu.Model == model {
+			available += gpu.Count
+		}
+	}
+	return available >= count
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/computehive/core-services/pkg/trust"
+	"github.com/nats-io/nats.go"
+)
+
+// subscribeToAgentTrust follows the trust tiers the scheduler computes, so
+// offers show their agent's tier and bids can require one
+func (s *MarketplaceService) subscribeToAgentTrust() {
+	s.bus.Subscribe("agent.trust", func(ctx context.Context, msg *nats.Msg) error {
+		var event struct {
+			AgentID string     `json:"agent_id"`
+			Tier    trust.Tier `json:"tier"`
+		}
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		if event.AgentID == "" {
+			return obs.Errorf(obs.CodeInvalidArgument, "trust event has no agent_id")
+		}
+		tier, err := trust.Parse(string(event.Tier))
+		if err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		s.setAgentTier(ctx, event.AgentID, tier)
+		return nil
+	})
+}
+
+// agentTier returns the trust tier of an agent; callers hold s.mu
+func (s *MarketplaceService) agentTier(agentID string) trust.Tier {
+	if tier, known := s.agentTiers[agentID]; known {
+		return tier
+	}
+	return trust.Community
+}
+
+// setAgentTier records an agent's tier and restates the offers it serves
+func (s *MarketplaceService) setAgentTier(ctx context.Context, agentID string, tier trust.Tier) {
+	var changed []*Offer
+
+	s.mu.Lock()
+	s.agentTiers[agentID] = tier
+	for _, offer := range s.offers {
+		if offer.AgentID != agentID || offer.TrustTier == tier {
+			continue
+		}
+		offer.TrustTier = tier
+		offer.UpdatedAt = time.Now()
+		if offer.Status == "active" {
+			snapshot := *offer
+			changed = append(changed, &snapshot)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, offer := range changed {
+		s.broadcastUpdate("offers", map[string]interface{}{
+			"type": "offer_trust_changed",
+			"data": offer,
+		})
+	}
+	slog.InfoContext(ctx, "Agent trust tier updated", "agent_id", agentID, "tier", tier, "active_offers", len(changed))
+}
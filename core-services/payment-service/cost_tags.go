@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/computehive/core-services/pkg/tagfilter"
+	"github.com/shopspring/decimal"
+)
+
+// untaggedValue groups spend from jobs that do not carry the requested tag key
+const untaggedValue = "(untagged)"
+
+// TagSpend is the spend attributed to one value of a tag key
+type TagSpend struct {
+	Value  string          `json:"value"`
+	Amount decimal.Decimal `json:"amount"`
+	Jobs   int             `json:"jobs"`
+}
+
+// TagSpendReport breaks down job spend by a cost allocation tag key
+type TagSpendReport struct {
+	UserID      string            `json:"user_id"`
+	GroupBy     string            `json:"group_by"`
+	Filters     map[string]string `json:"filters,omitempty"`
+	PeriodStart time.Time         `json:"period_start"`
+	PeriodEnd   time.Time         `json:"period_end"`
+	Currency    string            `json:"currency"`
+	Total       decimal.Decimal   `json:"total"`
+	Breakdown   []TagSpend        `json:"breakdown"`
+}
+
+// GetSpendByTag returns job spend grouped by a tag key, optionally filtered by tags.
+// Query: group_by=team&tag=project=alpha&start=<RFC3339>&end=<RFC3339>
+func (s *PaymentService) GetSpendByTag(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	query := r.URL.Query()
+
+	groupBy := query.Get("group_by")
+	if groupBy == "" {
+		http.Error(w, "group_by is required", http.StatusBadRequest)
+		return
+	}
+
+	filters, err := tagfilter.Parse(query["tag"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	end := time.Now()
+	start := end.AddDate(0, -1, 0)
+	if v := query.Get("start"); v != "" {
+		if start, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Invalid start time", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("end"); v != "" {
+		if end, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "Invalid end time", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report := &TagSpendReport{
+		UserID:      claims.UserID,
+		GroupBy:     groupBy,
+		Filters:     filters,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Currency:    "USD",
+		Total:       decimal.Zero,
+	}
+
+	groups := make(map[string]*TagSpend)
+	s.mu.RLock()
+	for _, payment := range s.payments {
+		if !isBillableJobPayment(payment, claims.UserID, start, end) {
+			continue
+		}
+		if !tagfilter.Match(payment.Tags, filters) {
+			continue
+		}
+		value, ok := payment.Tags[groupBy]
+		if !ok {
+			value = untaggedValue
+		}
+		group, exists := groups[value]
+		if !exists {
+			group = &TagSpend{Value: value, Amount: decimal.Zero}
+			groups[value] = group
+		}
+		group.Amount = group.Amount.Add(payment.Amount)
+		group.Jobs++
+		report.Total = report.Total.Add(payment.Amount)
+	}
+	s.mu.RUnlock()
+
+	report.Breakdown = make([]TagSpend, 0, len(groups))
+	for _, group := range groups {
+		report.Breakdown = append(report.Breakdown, *group)
+	}
+	sort.Slice(report.Breakdown, func(i, j int) bool {
+		return report.Breakdown[i].Amount.GreaterThan(report.Breakdown[j].Amount)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// jobLineItems builds invoice line items for a user's job payments in a period
+func (s *PaymentService) jobLineItems(userID string, start, end time.Time) ([]LineItem, decimal.Decimal) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	items := []LineItem{}
+	total := decimal.Zero
+	for _, payment := range s.payments {
+		if !isBillableJobPayment(payment, userID, start, end) {
+			continue
+		}
+		items = append(items, LineItem{
+			Description: fmt.Sprintf("Compute job %s", payment.JobID),
+			Quantity:    decimal.NewFromInt(1),
+			UnitPrice:   payment.Amount,
+			Amount:      payment.Amount,
+			JobID:       payment.JobID,
+			Tags:        payment.Tags,
+		})
+		total = total.Add(payment.Amount)
+	}
+	return items, total
+}
+
+// isBillableJobPayment reports whether a payment is a user's job charge within a period
+func isBillableJobPayment(payment *Payment, userID string, start, end time.Time) bool {
+	if payment.UserID != userID || payment.Type != "job_payment" || payment.Status == "failed" {
+		return false
+	}
+	return !payment.CreatedAt.Before(start) && payment.CreatedAt.Before(end)
+}
+
+// spendByTag totals line item amounts per tag key and value
+func spendByTag(items []LineItem) map[string]map[string]decimal.Decimal {
+	spend := make(map[string]map[string]decimal.Decimal)
+	for _, item := range items {
+		for key, value := range item.Tags {
+			if spend[key] == nil {
+				spend[key] = make(map[string]decimal.Decimal)
+			}
+			spend[key][value] = spend[key][value].Add(item.Amount)
+		}
+	}
+	if len(spend) == 0 {
+		return nil
+	}
+	return spend
+}
+
+// jobTags extracts cost allocation tags from a job event
+func jobTags(job map[string]interface{}) map[string]string {
+	raw, ok := job["tags"].(map[string]interface{})
+	if !ok || len(raw) == 0 {
+		return nil
+	}
+	tags := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if str, ok := value.(string); ok {
+			tags[key] = str
+		}
+	}
+	return tags
+}
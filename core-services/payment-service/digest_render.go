@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// digestTemplate renders a digest as an HTML email
+var digestTemplate = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"money": func(amount decimal.Decimal) string { return amount.StringFixed(2) },
+	"hours": func(hours float64) string { return fmt.Sprintf("%.1f", hours) },
+	"date":  digestDate,
+	"title": digestSubject,
+	"types": sortedTypeCounts,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{title .}}</title></head>
+<body style="font-family: Helvetica, Arial, sans-serif; color: #222; max-width: 720px;">
+<h1 style="font-size: 20px;">{{title .}}</h1>
+<p>{{date .PeriodStart}} to {{date .PeriodEnd}} (UTC)</p>
+<table cellpadding="6">
+<tr><td>Total spend</td><td><strong>{{money .TotalSpend}} {{.Currency}}</strong></td></tr>
+<tr><td>Charged jobs</td><td>{{.Jobs}}</td></tr>
+<tr><td>Compute hours</td><td>{{hours .ComputeHours}}</td></tr>
+</table>
+{{if .SpendByProject}}
+<h2 style="font-size: 16px;">Spend by {{.ProjectTag}}</h2>
+<table cellpadding="6" border="1" style="border-collapse: collapse;">
+<tr><th align="left">{{.ProjectTag}}</th><th align="right">Jobs</th><th align="right">Spend</th></tr>
+{{range .SpendByProject}}<tr><td>{{.Value}}</td><td align="right">{{.Jobs}}</td><td align="right">{{money .Amount}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .TopJobs}}
+<h2 style="font-size: 16px;">Top jobs</h2>
+<table cellpadding="6" border="1" style="border-collapse: collapse;">
+<tr><th align="left">Job</th><th align="left">Type</th><th align="left">Project</th><th align="right">Hours</th><th align="right">Cost</th></tr>
+{{range .TopJobs}}<tr><td>{{if .Name}}{{.Name}} ({{.JobID}}){{else}}{{.JobID}}{{end}}</td><td>{{.Type}}</td><td>{{.Project}}</td><td align="right">{{hours .ComputeHours}}</td><td align="right">{{money .Cost}}</td></tr>
+{{end}}</table>
+{{end}}
+{{with .Utilization}}
+<h2 style="font-size: 16px;">Utilization efficiency</h2>
+{{if .Jobs}}<table cellpadding="6">
+<tr><td>CPU used of requested</td><td>{{.CPUEfficiency}}%</td></tr>
+<tr><td>Peak memory of requested</td><td>{{.MemoryEfficiency}}%</td></tr>
+<tr><td>Over-provisioned jobs</td><td>{{.OverProvisioned}} of {{.Jobs}}</td></tr>
+</table>
+{{if .OverProvisioned}}<p>Over-provisioned jobs used under half of the CPU and memory they requested. Smaller requests would cost less.</p>{{end}}
+{{else}}<p>No finished jobs reported usage this period.</p>{{end}}
+{{end}}
+{{with .FailedJobs}}
+<h2 style="font-size: 16px;">Failed jobs</h2>
+<p>{{.Failed}} of {{.Finished}} finished jobs failed ({{.FailureRate}}%).</p>
+{{if .Jobs}}<p>{{range $i, $t := types .ByType}}{{if $i}}, {{end}}{{$t}}{{end}}</p>
+<table cellpadding="6" border="1" style="border-collapse: collapse;">
+<tr><th align="left">Job</th><th align="left">Type</th><th align="left">Agent</th><th align="right">Retries</th><th align="left">Failed</th></tr>
+{{range .Jobs}}<tr><td>{{if .Name}}{{.Name}} ({{.JobID}}){{else}}{{.JobID}}{{end}}</td><td>{{.Type}}</td><td>{{.AgentID}}</td><td align="right">{{.Retries}}</td><td>{{date .FailedAt}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+// renderDigestHTML renders a digest as an HTML document
+func renderDigestHTML(report *DigestReport) (string, error) {
+	var out bytes.Buffer
+	if err := digestTemplate.Execute(&out, report); err != nil {
+		return "", fmt.Errorf("failed to render digest: %w", err)
+	}
+	return out.String(), nil
+}
+
+// renderDigestPDF renders a digest as a plain text PDF
+func renderDigestPDF(report *DigestReport) []byte {
+	lines := []string{
+		digestSubject(report),
+		fmt.Sprintf("%s to %s (UTC)", digestDate(report.PeriodStart), digestDate(report.PeriodEnd)),
+		"",
+		fmt.Sprintf("Total spend:   %s %s", report.TotalSpend.StringFixed(2), report.Currency),
+		fmt.Sprintf("Charged jobs:  %d", report.Jobs),
+		fmt.Sprintf("Compute hours: %.1f", report.ComputeHours),
+	}
+	if len(report.SpendByProject) > 0 {
+		lines = append(lines, "", "Spend by "+report.ProjectTag)
+		for _, spend := range report.SpendByProject {
+			lines = append(lines, fmt.Sprintf("  %-40s %6d jobs %12s", spend.Value, spend.Jobs, spend.Amount.StringFixed(2)))
+		}
+	}
+	if len(report.TopJobs) > 0 {
+		lines = append(lines, "", "Top jobs")
+		for _, job := range report.TopJobs {
+			lines = append(lines, fmt.Sprintf("  %-40s %8.1f h %12s", digestJobLabel(job.Name, job.JobID), job.ComputeHours, job.Cost.StringFixed(2)))
+		}
+	}
+	if u := report.Utilization; u != nil {
+		lines = append(lines, "", "Utilization efficiency")
+		if u.Jobs == 0 {
+			lines = append(lines, "  No finished jobs reported usage this period.")
+		} else {
+			lines = append(lines,
+				fmt.Sprintf("  CPU used of requested:    %.1f%%", u.CPUEfficiency),
+				fmt.Sprintf("  Peak memory of requested: %.1f%%", u.MemoryEfficiency),
+				fmt.Sprintf("  Over-provisioned jobs:    %d of %d", u.OverProvisioned, u.Jobs))
+		}
+	}
+	if f := report.FailedJobs; f != nil {
+		lines = append(lines, "", "Failed jobs",
+			fmt.Sprintf("  %d of %d finished jobs failed (%.1f%%)", f.Failed, f.Finished, f.FailureRate))
+		if len(f.ByType) > 0 {
+			lines = append(lines, "  "+strings.Join(sortedTypeCounts(f.ByType), ", "))
+		}
+		for _, job := range f.Jobs {
+			lines = append(lines, fmt.Sprintf("  %-40s %-12s %s", digestJobLabel(job.Name, job.JobID), job.Type, digestDate(job.FailedAt)))
+		}
+	}
+	return textPDF(lines)
+}
+
+// digestSubject is a digest's email subject and title
+func digestSubject(report *DigestReport) string {
+	frequency := "Weekly"
+	if report.Frequency == DigestMonthly {
+		frequency = "Monthly"
+	}
+	return fmt.Sprintf("%s ComputeHive digest for %s, %s", frequency, report.OrgID, digestDate(report.PeriodStart))
+}
+
+// digestFilename names a rendered digest
+func digestFilename(report *DigestReport, format string) string {
+	return fmt.Sprintf("digest-%s-%s-%s.%s", report.Frequency, report.PeriodStart.Format("20060102"), report.PeriodEnd.Format("20060102"), format)
+}
+
+func digestDate(t time.Time) string {
+	return t.Format("Jan 2, 2006")
+}
+
+func digestJobLabel(name, jobID string) string {
+	if name == "" {
+		return jobID
+	}
+	return fmt.Sprintf("%s (%s)", name, jobID)
+}
+
+// sortedTypeCounts lists job type counts, most frequent first
+func sortedTypeCounts(counts map[string]int) []string {
+	types := make([]string, 0, len(counts))
+	for jobType := range counts {
+		types = append(types, jobType)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		if counts[types[i]] != counts[types[j]] {
+			return counts[types[i]] > counts[types[j]]
+		}
+		return types[i] < types[j]
+	})
+	for i, jobType := range types {
+		types[i] = fmt.Sprintf("%s: %d", jobType, counts[jobType])
+	}
+	return types
+}
+
+// textPDF lays lines of text out on Letter pages in a monospaced font
+func textPDF(lines []string) []byte {
+	const (
+		pageWidth  = 612
+		pageHeight = 792
+		margin     = 50
+		fontSize   = 9
+		leading    = 13
+	)
+	perPage := (pageHeight - 2*margin) / leading
+	var pages [][]string
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	pages = append(pages, lines)
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1-3 are the catalog, page tree and font; each page then takes
+	// two, the page and its content stream
+	out.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", fontSize, leading, margin, pageHeight-margin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) '\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// pdfEscape makes text safe inside a PDF string; characters outside
+// printable ASCII are replaced
+func pdfEscape(text string) string {
+	var out strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			out.WriteByte('?')
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
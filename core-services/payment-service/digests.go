@@ -0,0 +1,750 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// Digest report settings
+const (
+	digestCheckInterval = time.Hour
+	digestJobRetention  = 40 * 24 * time.Hour // Finished jobs kept for the longest period, with a margin
+	digestTopJobs       = 10
+	digestFailedJobs    = 20 // Failed jobs listed individually
+	maxDigestReports    = 60 // Reports retained per organization
+	defaultProjectTag   = "project"
+)
+
+// Digest frequencies. Periods are in UTC; weeks start on Monday.
+const (
+	DigestWeekly  = "weekly"
+	DigestMonthly = "monthly"
+)
+
+// Digest sections
+const (
+	SectionSpendByProject = "spend_by_project"
+	SectionTopJobs        = "top_jobs"
+	SectionUtilization    = "utilization"
+	SectionFailedJobs     = "failed_jobs"
+)
+
+// digestSections are every section, in the order they are rendered
+var digestSections = []string{SectionSpendByProject, SectionTopJobs, SectionUtilization, SectionFailedJobs}
+
+// Digest formats
+const (
+	DigestHTML = "html"
+	DigestPDF  = "pdf" // The HTML email with the report attached as a PDF
+)
+
+// DigestConfig is an organization's digest subscription
+type DigestConfig struct {
+	OrgID       string    `json:"org_id"`
+	Enabled     bool      `json:"enabled"`
+	Frequencies []string  `json:"frequencies"` // weekly, monthly
+	Recipients  []string  `json:"recipients"`  // Email addresses
+	Sections    []string  `json:"sections"`    // Defaults to every section
+	Format      string    `json:"format"`      // html, pdf
+	ProjectTag  string    `json:"project_tag"` // Cost allocation tag that names a job's project
+	UpdatedBy   string    `json:"updated_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// includes reports whether a section is part of the digest
+func (c *DigestConfig) includes(section string) bool {
+	for _, s := range c.Sections {
+		if s == section {
+			return true
+		}
+	}
+	return false
+}
+
+// DigestJob is one of the period's most expensive jobs
+type DigestJob struct {
+	JobID        string          `json:"job_id"`
+	Name         string          `json:"name,omitempty"`
+	Type         string          `json:"type,omitempty"`
+	UserID       string          `json:"user_id"`
+	Project      string          `json:"project,omitempty"`
+	Cost         decimal.Decimal `json:"cost"`
+	ComputeHours float64         `json:"compute_hours"`
+}
+
+// DigestUtilization compares what finished jobs used with what they
+// requested, weighted by how long they ran
+type DigestUtilization struct {
+	Jobs             int     `json:"jobs"`              // Finished jobs with usage samples
+	CPUEfficiency    float64 `json:"cpu_efficiency"`    // Percent of requested CPU used on average
+	MemoryEfficiency float64 `json:"memory_efficiency"` // Percent of requested memory used at peak
+	OverProvisioned  int     `json:"over_provisioned"`  // Jobs that used under half of both
+}
+
+// DigestFailures summarizes the period's failed jobs
+type DigestFailures struct {
+	Failed      int               `json:"failed"`
+	Finished    int               `json:"finished"`     // Completed and failed jobs
+	FailureRate float64           `json:"failure_rate"` // Percent of finished jobs
+	ByType      map[string]int    `json:"by_type"`
+	Jobs        []DigestFailedJob `json:"jobs"` // Most recent first
+}
+
+// DigestFailedJob is one failed job
+type DigestFailedJob struct {
+	JobID    string    `json:"job_id"`
+	Name     string    `json:"name,omitempty"`
+	Type     string    `json:"type,omitempty"`
+	UserID   string    `json:"user_id"`
+	AgentID  string    `json:"agent_id,omitempty"`
+	Retries  int       `json:"retries"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DigestReport is an organization's spend and utilization digest for a period
+type DigestReport struct {
+	ID             string             `json:"id"`
+	OrgID          string             `json:"org_id"`
+	Frequency      string             `json:"frequency"`
+	PeriodStart    time.Time          `json:"period_start"`
+	PeriodEnd      time.Time          `json:"period_end"`
+	Currency       string             `json:"currency"`
+	TotalSpend     decimal.Decimal    `json:"total_spend"`
+	Jobs           int                `json:"jobs"` // Charged jobs
+	ComputeHours   float64            `json:"compute_hours"`
+	ProjectTag     string             `json:"project_tag,omitempty"`
+	SpendByProject []TagSpend         `json:"spend_by_project,omitempty"`
+	TopJobs        []DigestJob        `json:"top_jobs,omitempty"`
+	Utilization    *DigestUtilization `json:"utilization,omitempty"`
+	FailedJobs     *DigestFailures    `json:"failed_jobs,omitempty"`
+	Recipients     []string           `json:"recipients,omitempty"`
+	DeliveredAt    *time.Time         `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+}
+
+// NotificationEmail asks the notification service to send an email
+type NotificationEmail struct {
+	ID          string                   `json:"id"`
+	Kind        string                   `json:"kind"` // e.g. digest
+	OrgID       string                   `json:"org_id,omitempty"`
+	To          []string                 `json:"to"`
+	Subject     string                   `json:"subject"`
+	HTML        string                   `json:"html"`
+	Attachments []NotificationAttachment `json:"attachments,omitempty"`
+}
+
+// NotificationAttachment is a file attached to an email
+type NotificationAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"` // Base64 in JSON
+}
+
+// finishedJob is what digests keep of a completed or failed job
+type finishedJob struct {
+	JobID             string
+	Name              string
+	Type              string
+	UserID            string
+	OrgID             string
+	Status            string
+	AgentID           string
+	Retries           int
+	RequestedCPU      float64
+	RequestedMemoryMB float64
+	CPUCoresAvg       float64
+	MemoryPeakMB      float64
+	Samples           int
+	RunHours          float64
+	FinishedAt        time.Time
+}
+
+// Digests sends organizations weekly and monthly digests of their spend by
+// project, most expensive jobs, utilization efficiency and failed jobs.
+//
+// Spend comes from the organization's job payments; utilization and
+// failures from the completed and failed jobs the service sees on the job
+// stream. Once a period closes, its digest is rendered as HTML, or with a
+// PDF attached, and handed to the notification service on
+// "notification.email" for each recipient. A digest that cannot be handed
+// over is retried on the next check. Enabling a frequency starts with the
+// period in progress, so no digest covers time before it was configured.
+type Digests struct {
+	service     *PaymentService
+	configs     map[string]*DigestConfig   // by org ID
+	sentThrough map[string]time.Time       // org ID|frequency -> end of the last period sent
+	jobs        map[string]*finishedJob    // by job ID
+	reports     map[string][]*DigestReport // by org ID, oldest first
+	mu          sync.Mutex
+}
+
+// NewDigests creates the digest scheduler
+func NewDigests(s *PaymentService) *Digests {
+	return &Digests{
+		service:     s,
+		configs:     make(map[string]*DigestConfig),
+		sentThrough: make(map[string]time.Time),
+		jobs:        make(map[string]*finishedJob),
+		reports:     make(map[string][]*DigestReport),
+	}
+}
+
+// digestPeriod returns the period of a frequency in progress at now
+func digestPeriod(frequency string, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	if frequency == DigestMonthly {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := today.AddDate(0, 0, -((int(now.Weekday()) + 6) % 7))
+	return start, start.AddDate(0, 0, 7)
+}
+
+// recordJob keeps a finished job of an organization for its digests
+func (d *Digests) recordJob(job map[string]interface{}) {
+	jobID := stringField(job, "id")
+	orgID := stringField(job, "org_id")
+	if jobID == "" || orgID == "" {
+		return
+	}
+
+	finished := &finishedJob{
+		JobID:      jobID,
+		Name:       stringField(job, "name"),
+		Type:       stringField(job, "type"),
+		UserID:     stringField(job, "user_id"),
+		OrgID:      orgID,
+		Status:     stringField(job, "status"),
+		AgentID:    stringField(job, "assigned_agent_id"),
+		FinishedAt: time.Now().UTC(),
+	}
+	if completedAt, err := time.Parse(time.RFC3339Nano, stringField(job, "completed_at")); err == nil {
+		finished.FinishedAt = completedAt.UTC()
+	}
+	if retries, ok := job["retry_count"].(float64); ok {
+		finished.Retries = int(retries)
+	}
+	if requirements, ok := job["requirements"].(map[string]interface{}); ok {
+		finished.RequestedCPU, _ = requirements["cpu_cores"].(float64)
+		finished.RequestedMemoryMB, _ = requirements["memory_mb"].(float64)
+	}
+	if usage, ok := job["usage"].(map[string]interface{}); ok {
+		finished.CPUCoresAvg, _ = usage["cpu_cores_avg"].(float64)
+		finished.MemoryPeakMB, _ = usage["memory_peak_mb"].(float64)
+		if samples, ok := usage["samples"].(float64); ok {
+			finished.Samples = int(samples)
+		}
+	}
+	finished.RunHours, _ = jobRunHours(job)
+
+	d.mu.Lock()
+	d.jobs[jobID] = finished
+	d.mu.Unlock()
+}
+
+// run sends digests as their periods close
+func (d *Digests) run() {
+	ticker := time.NewTicker(digestCheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		d.sendDue(now.UTC())
+		d.pruneJobs(now.UTC())
+	}
+}
+
+// sendDue sends every digest whose period closed since it was last sent
+func (d *Digests) sendDue(now time.Time) {
+	type due struct {
+		config     DigestConfig
+		frequency  string
+		start, end time.Time
+		previous   time.Time
+	}
+
+	d.mu.Lock()
+	var pending []due
+	for orgID, config := range d.configs {
+		if !config.Enabled || len(config.Recipients) == 0 {
+			continue
+		}
+		for _, frequency := range config.Frequencies {
+			start, _ := digestPeriod(frequency, now)
+			key := orgID + "|" + frequency
+			previous := d.sentThrough[key]
+			if !previous.Before(start) {
+				continue
+			}
+			closedStart, _ := digestPeriod(frequency, start.Add(-time.Nanosecond))
+			d.sentThrough[key] = start
+			pending = append(pending, due{config: *config, frequency: frequency, start: closedStart, end: start, previous: previous})
+		}
+	}
+	d.mu.Unlock()
+
+	for _, p := range pending {
+		report := d.build(&p.config, p.frequency, p.start, p.end, now)
+		if err := d.deliver(context.Background(), report, &p.config); err != nil {
+			slog.Error("Failed to send digest, retrying at the next check", "org_id", p.config.OrgID,
+				"frequency", p.frequency, "period_start", p.start, "error", err)
+			d.mu.Lock()
+			d.sentThrough[p.config.OrgID+"|"+p.frequency] = p.previous
+			d.mu.Unlock()
+			continue
+		}
+		slog.Info("Digest sent", "org_id", report.OrgID, "frequency", report.Frequency,
+			"period_start", report.PeriodStart, "recipients", len(report.Recipients))
+	}
+}
+
+// pruneJobs forgets finished jobs too old for any digest
+func (d *Digests) pruneJobs(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for jobID, job := range d.jobs {
+		if now.Sub(job.FinishedAt) > digestJobRetention {
+			delete(d.jobs, jobID)
+		}
+	}
+}
+
+// build assembles an organization's digest for a period
+func (d *Digests) build(config *DigestConfig, frequency string, start, end, now time.Time) *DigestReport {
+	report := &DigestReport{
+		ID:          generateID(),
+		OrgID:       config.OrgID,
+		Frequency:   frequency,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Currency:    "USD",
+		TotalSpend:  decimal.Zero,
+		Recipients:  append([]string(nil), config.Recipients...),
+		CreatedAt:   now,
+	}
+
+	s := d.service
+	s.mu.RLock()
+	var payments []*Payment
+	for _, payment := range s.payments {
+		if payment.OrgID != config.OrgID || payment.Type != "job_payment" || payment.Status == "failed" {
+			continue
+		}
+		if !payment.CreatedAt.Before(start) && payment.CreatedAt.Before(end) {
+			payments = append(payments, payment)
+		}
+	}
+	s.mu.RUnlock()
+
+	d.mu.Lock()
+	var jobs []*finishedJob
+	names := make(map[string]string)
+	for _, job := range d.jobs {
+		names[job.JobID] = job.Name
+		if job.OrgID == config.OrgID && !job.FinishedAt.Before(start) && job.FinishedAt.Before(end) {
+			jobs = append(jobs, job)
+		}
+	}
+	d.mu.Unlock()
+
+	projects := make(map[string]*TagSpend)
+	var top []DigestJob
+	for _, payment := range payments {
+		report.TotalSpend = report.TotalSpend.Add(payment.Amount)
+		report.ComputeHours += payment.ComputeHours
+		report.Jobs++
+
+		project, tagged := payment.Tags[config.ProjectTag]
+		if !tagged {
+			project = untaggedValue
+		}
+		spend, exists := projects[project]
+		if !exists {
+			spend = &TagSpend{Value: project, Amount: decimal.Zero}
+			projects[project] = spend
+		}
+		spend.Amount = spend.Amount.Add(payment.Amount)
+		spend.Jobs++
+
+		top = append(top, DigestJob{
+			JobID:        payment.JobID,
+			Name:         names[payment.JobID],
+			Type:         payment.JobType,
+			UserID:       payment.UserID,
+			Project:      payment.Tags[config.ProjectTag],
+			Cost:         payment.Amount,
+			ComputeHours: payment.ComputeHours,
+		})
+	}
+
+	if config.includes(SectionSpendByProject) {
+		report.ProjectTag = config.ProjectTag
+		report.SpendByProject = make([]TagSpend, 0, len(projects))
+		for _, spend := range projects {
+			report.SpendByProject = append(report.SpendByProject, *spend)
+		}
+		sort.Slice(report.SpendByProject, func(i, j int) bool {
+			return report.SpendByProject[i].Amount.GreaterThan(report.SpendByProject[j].Amount)
+		})
+	}
+	if config.includes(SectionTopJobs) {
+		sort.Slice(top, func(i, j int) bool { return top[i].Cost.GreaterThan(top[j].Cost) })
+		if len(top) > digestTopJobs {
+			top = top[:digestTopJobs]
+		}
+		report.TopJobs = append([]DigestJob{}, top...)
+	}
+	if config.includes(SectionUtilization) {
+		report.Utilization = digestUtilization(jobs)
+	}
+	if config.includes(SectionFailedJobs) {
+		report.FailedJobs = digestFailures(jobs)
+	}
+	return report
+}
+
+// digestUtilization weighs each job's usage against its request by run time
+func digestUtilization(jobs []*finishedJob) *DigestUtilization {
+	utilization := &DigestUtilization{}
+	var cpuUsed, cpuRequested, memoryUsed, memoryRequested float64
+	for _, job := range jobs {
+		if job.Samples == 0 || job.RunHours <= 0 || job.RequestedCPU <= 0 || job.RequestedMemoryMB <= 0 {
+			continue
+		}
+		utilization.Jobs++
+		cpuUsed += job.CPUCoresAvg * job.RunHours
+		cpuRequested += job.RequestedCPU * job.RunHours
+		memoryUsed += job.MemoryPeakMB * job.RunHours
+		memoryRequested += job.RequestedMemoryMB * job.RunHours
+		if job.CPUCoresAvg < job.RequestedCPU/2 && job.MemoryPeakMB < job.RequestedMemoryMB/2 {
+			utilization.OverProvisioned++
+		}
+	}
+	if cpuRequested > 0 {
+		utilization.CPUEfficiency = percent(cpuUsed, cpuRequested)
+		utilization.MemoryEfficiency = percent(memoryUsed, memoryRequested)
+	}
+	return utilization
+}
+
+// digestFailures summarizes the failed jobs among the finished ones
+func digestFailures(jobs []*finishedJob) *DigestFailures {
+	failures := &DigestFailures{ByType: make(map[string]int), Jobs: []DigestFailedJob{}}
+	for _, job := range jobs {
+		switch job.Status {
+		case "completed":
+			failures.Finished++
+		case "failed":
+			failures.Finished++
+			failures.Failed++
+			jobType := job.Type
+			if jobType == "" {
+				jobType = unknownJobType
+			}
+			failures.ByType[jobType]++
+			failures.Jobs = append(failures.Jobs, DigestFailedJob{
+				JobID:    job.JobID,
+				Name:     job.Name,
+				Type:     job.Type,
+				UserID:   job.UserID,
+				AgentID:  job.AgentID,
+				Retries:  job.Retries,
+				FailedAt: job.FinishedAt,
+			})
+		}
+	}
+	if failures.Finished > 0 {
+		failures.FailureRate = percent(float64(failures.Failed), float64(failures.Finished))
+	}
+	sort.Slice(failures.Jobs, func(i, j int) bool { return failures.Jobs[i].FailedAt.After(failures.Jobs[j].FailedAt) })
+	if len(failures.Jobs) > digestFailedJobs {
+		failures.Jobs = failures.Jobs[:digestFailedJobs]
+	}
+	return failures
+}
+
+// percent returns part as a percentage of whole, to one decimal
+func percent(part, whole float64) float64 {
+	value, _ := decimal.NewFromFloat(part / whole * 100).Round(1).Float64()
+	return value
+}
+
+// deliver hands a digest to the notification service and keeps it in the
+// organization's history
+func (d *Digests) deliver(ctx context.Context, report *DigestReport, config *DigestConfig) error {
+	body, err := renderDigestHTML(report)
+	if err != nil {
+		return err
+	}
+	email := NotificationEmail{
+		ID:      report.ID,
+		Kind:    "digest",
+		OrgID:   report.OrgID,
+		To:      report.Recipients,
+		Subject: digestSubject(report),
+		HTML:    body,
+	}
+	if config.Format == DigestPDF {
+		email.Attachments = []NotificationAttachment{{
+			Filename:    digestFilename(report, DigestPDF),
+			ContentType: "application/pdf",
+			Content:     renderDigestPDF(report),
+		}}
+	}
+
+	data, _ := json.Marshal(email)
+	if err := d.service.bus.Publish(ctx, "notification.email", data); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	report.DeliveredAt = &now
+	d.mu.Lock()
+	history := append(d.reports[report.OrgID], report)
+	if len(history) > maxDigestReports {
+		history = history[len(history)-maxDigestReports:]
+	}
+	d.reports[report.OrgID] = history
+	d.mu.Unlock()
+	return nil
+}
+
+// validate fills in defaults and checks a digest configuration
+func (c *DigestConfig) validate() error {
+	if len(c.Frequencies) == 0 && c.Enabled {
+		return fmt.Errorf("at least one frequency is required")
+	}
+	seen := make(map[string]bool)
+	for _, frequency := range c.Frequencies {
+		if frequency != DigestWeekly && frequency != DigestMonthly {
+			return fmt.Errorf("unknown frequency %q: use %s or %s", frequency, DigestWeekly, DigestMonthly)
+		}
+		if seen[frequency] {
+			return fmt.Errorf("frequency %s is listed twice", frequency)
+		}
+		seen[frequency] = true
+	}
+
+	if len(c.Recipients) == 0 && c.Enabled {
+		return fmt.Errorf("at least one recipient is required")
+	}
+	for i, recipient := range c.Recipients {
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q", recipient)
+		}
+		c.Recipients[i] = address.Address
+	}
+
+	if len(c.Sections) == 0 {
+		c.Sections = append([]string(nil), digestSections...)
+	}
+	for _, section := range c.Sections {
+		known := false
+		for _, s := range digestSections {
+			known = known || s == section
+		}
+		if !known {
+			return fmt.Errorf("unknown section %q", section)
+		}
+	}
+
+	if c.Format == "" {
+		c.Format = DigestHTML
+	}
+	if c.Format != DigestHTML && c.Format != DigestPDF {
+		return fmt.Errorf("format must be %s or %s", DigestHTML, DigestPDF)
+	}
+	if c.ProjectTag == "" {
+		c.ProjectTag = defaultProjectTag
+	}
+	return nil
+}
+
+// canManageOrg reports whether a caller may see and change an
+// organization's digests
+func canManageOrg(claims *Claims, orgID string) bool {
+	return claims.Role == "admin" || (claims.OrgID != "" && claims.OrgID == orgID)
+}
+
+// writeDigest writes a report as JSON, HTML or PDF
+func writeDigest(w http.ResponseWriter, report *DigestReport, format string) {
+	switch format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	case DigestHTML:
+		body, err := renderDigestHTML(report)
+		if err != nil {
+			http.Error(w, "Failed to render digest", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(body))
+	case DigestPDF:
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+digestFilename(report, DigestPDF)+`"`)
+		w.Write(renderDigestPDF(report))
+	default:
+		http.Error(w, "format must be json, html or pdf", http.StatusBadRequest)
+	}
+}
+
+// HTTP Handlers
+
+// GetDigestConfig returns an organization's digest configuration
+func (d *Digests) GetDigestConfig(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	orgID := mux.Vars(r)["org"]
+	if !canManageOrg(claims, orgID) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	d.mu.Lock()
+	config, exists := d.configs[orgID]
+	var current DigestConfig
+	if exists {
+		current = *config
+	}
+	d.mu.Unlock()
+	if !exists {
+		http.Error(w, "No digests configured", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(current)
+}
+
+// UpdateDigestConfig sets an organization's digest recipients, frequencies
+// and sections
+func (d *Digests) UpdateDigestConfig(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	orgID := mux.Vars(r)["org"]
+	if !canManageOrg(claims, orgID) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var config DigestConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := config.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now().UTC()
+	config.OrgID = orgID
+	config.UpdatedBy = claims.UserID
+	config.UpdatedAt = now
+
+	d.mu.Lock()
+	d.configs[orgID] = &config
+	for _, frequency := range config.Frequencies {
+		key := orgID + "|" + frequency
+		if _, sent := d.sentThrough[key]; !sent {
+			d.sentThrough[key], _ = digestPeriod(frequency, now)
+		}
+	}
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config)
+}
+
+// ListDigests returns the digests sent to an organization, newest first
+func (d *Digests) ListDigests(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	orgID := mux.Vars(r)["org"]
+	if !canManageOrg(claims, orgID) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	d.mu.Lock()
+	history := d.reports[orgID]
+	reports := make([]*DigestReport, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		reports = append(reports, history[i])
+	}
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
+
+// GetDigest returns a sent digest.
+// Query: format=json|html|pdf
+func (d *Digests) GetDigest(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	vars := mux.Vars(r)
+	orgID := vars["org"]
+	if !canManageOrg(claims, orgID) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	var report *DigestReport
+	d.mu.Lock()
+	for _, sent := range d.reports[orgID] {
+		if sent.ID == vars["id"] {
+			report = sent
+		}
+	}
+	d.mu.Unlock()
+	if report == nil {
+		http.Error(w, "Digest not found", http.StatusNotFound)
+		return
+	}
+
+	writeDigest(w, report, r.URL.Query().Get("format"))
+}
+
+// PreviewDigest builds a digest of the period in progress so far, without
+// sending it.
+// Query: frequency=weekly|monthly, format=json|html|pdf
+func (d *Digests) PreviewDigest(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	orgID := mux.Vars(r)["org"]
+	if !canManageOrg(claims, orgID) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	frequency := r.URL.Query().Get("frequency")
+	if frequency == "" {
+		frequency = DigestWeekly
+	}
+	if frequency != DigestWeekly && frequency != DigestMonthly {
+		http.Error(w, "frequency must be weekly or monthly", http.StatusBadRequest)
+		return
+	}
+
+	d.mu.Lock()
+	config := DigestConfig{OrgID: orgID}
+	if existing, ok := d.configs[orgID]; ok {
+		config = *existing
+	}
+	d.mu.Unlock()
+	if err := config.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	start, _ := digestPeriod(frequency, now)
+	writeDigest(w, d.build(&config, frequency, start, now, now), r.URL.Query().Get("format"))
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// holdCurrency is the currency marketplace matches are priced and settled in
+const holdCurrency = "USD"
+
+// holdSettlementGrace is how long a hold outlives its match so that the
+// final settlement can still post against it
+const holdSettlementGrace = time.Hour
+
+// Balance hold states
+const (
+	HoldActive   = "active"
+	HoldSettled  = "settled"  // Settlements consumed the whole hold
+	HoldReleased = "released" // The match ended with part of the hold unused
+)
+
+// BalanceHold earmarks a consumer's funds for the committed duration of an
+// active marketplace match. Funds stay in the available balance so
+// settlements can draw on them, but withdrawals may not dip into them.
+type BalanceHold struct {
+	ID         string          `json:"id"`
+	UserID     string          `json:"user_id"`
+	MatchID    string          `json:"match_id"`
+	Currency   string          `json:"currency"`
+	Amount     decimal.Decimal `json:"amount"`
+	Remaining  decimal.Decimal `json:"remaining"`
+	Status     string          `json:"status"` // active, settled, released
+	ExpiresAt  time.Time       `json:"expires_at"`
+	CreatedAt  time.Time       `json:"created_at"`
+	ReleasedAt *time.Time      `json:"released_at,omitempty"`
+}
+
+// heldAmount totals a user's active holds in a currency. Callers hold the
+// service lock.
+func (s *PaymentService) heldAmount(userID, currency string) decimal.Decimal {
+	total := decimal.Zero
+	for _, hold := range s.holds {
+		if hold.UserID == userID && hold.Currency == currency && hold.Status == HoldActive {
+			total = total.Add(hold.Remaining)
+		}
+	}
+	return total
+}
+
+// adjustHeld moves a balance's held figure by delta. Callers hold the service lock.
+func (s *PaymentService) adjustHeld(userID, currency string, delta decimal.Decimal) {
+	balance, exists := s.balances[userID]
+	if !exists {
+		balance = &Balance{
+			UserID:      userID,
+			Available:   make(map[string]decimal.Decimal),
+			Pending:     make(map[string]decimal.Decimal),
+			Reserved:    make(map[string]decimal.Decimal),
+			LastUpdated: time.Now(),
+		}
+		s.balances[userID] = balance
+	}
+	if balance.Held == nil {
+		balance.Held = make(map[string]decimal.Decimal)
+	}
+	balance.Held[currency] = balance.Held[currency].Add(delta)
+	balance.LastUpdated = time.Now()
+}
+
+// handleMatchConfirmed places a hold on the consumer's balance sized to the
+// match's agreed hourly price over its committed duration
+func (s *PaymentService) handleMatchConfirmed(ctx context.Context, match map[string]interface{}) {
+	matchID, _ := match["id"].(string)
+	consumerID, _ := match["consumer_id"].(string)
+	priceStr, _ := match["agreed_price"].(string)
+	startStr, _ := match["start_time"].(string)
+	endStr, _ := match["end_time"].(string)
+	if matchID == "" || consumerID == "" {
+		return
+	}
+
+	price, err := decimal.NewFromString(priceStr)
+	if err != nil {
+		slog.WarnContext(ctx, "Match has an invalid agreed price", "match_id", matchID, "price", priceStr)
+		return
+	}
+	start, err1 := time.Parse(time.RFC3339Nano, startStr)
+	end, err2 := time.Parse(time.RFC3339Nano, endStr)
+	if err1 != nil || err2 != nil || !end.After(start) {
+		slog.WarnContext(ctx, "Match has an invalid committed duration", "match_id", matchID)
+		return
+	}
+
+	hours := decimal.NewFromFloat(end.Sub(start).Hours())
+	amount := price.Mul(hours).Round(2)
+	if !amount.IsPositive() {
+		return
+	}
+
+	s.mu.Lock()
+	// Confirmation is published once per confirming party; hold only once
+	if _, exists := s.holds[matchID]; exists {
+		s.mu.Unlock()
+		return
+	}
+	hold := &BalanceHold{
+		ID:        generateID(),
+		UserID:    consumerID,
+		MatchID:   matchID,
+		Currency:  holdCurrency,
+		Amount:    amount,
+		Remaining: amount,
+		Status:    HoldActive,
+		ExpiresAt: end.Add(holdSettlementGrace),
+		CreatedAt: time.Now(),
+	}
+	s.holds[matchID] = hold
+	s.adjustHeld(consumerID, hold.Currency, amount)
+	s.mu.Unlock()
+
+	slog.InfoContext(ctx, "Placed balance hold", "match_id", matchID, "consumer_id", consumerID,
+		"amount", amount.String(), "currency", hold.Currency)
+	s.publishHoldEvent("hold.placed", hold)
+}
+
+// settleAgainstHold decrements a match's hold as a settlement posts.
+// Callers hold the service lock.
+func (s *PaymentService) settleAgainstHold(payment *Payment) {
+	if payment.MatchID == "" {
+		return
+	}
+	hold, exists := s.holds[payment.MatchID]
+	if !exists || hold.Status != HoldActive || hold.UserID != payment.UserID || hold.Currency != payment.Currency {
+		return
+	}
+
+	consumed := decimal.Min(payment.Amount, hold.Remaining)
+	hold.Remaining = hold.Remaining.Sub(consumed)
+	s.adjustHeld(hold.UserID, hold.Currency, consumed.Neg())
+	if hold.Remaining.IsZero() {
+		now := time.Now()
+		hold.Status = HoldSettled
+		hold.ReleasedAt = &now
+	}
+}
+
+// releaseExpiredHolds frees the unused remainder of holds whose match has ended
+func (s *PaymentService) releaseExpiredHolds() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, hold := range s.releaseExpired(time.Now()) {
+			s.publishHoldEvent("hold.released", hold)
+		}
+	}
+}
+
+// releaseExpired releases the active holds expired by now and returns them
+func (s *PaymentService) releaseExpired(now time.Time) []*BalanceHold {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var released []*BalanceHold
+	for _, hold := range s.holds {
+		if hold.Status != HoldActive || now.Before(hold.ExpiresAt) {
+			continue
+		}
+		s.adjustHeld(hold.UserID, hold.Currency, hold.Remaining.Neg())
+		hold.Status = HoldReleased
+		hold.ReleasedAt = &now
+		released = append(released, hold)
+	}
+	return released
+}
+
+// checkWithdrawable returns the balance a withdrawal draws on, or an error if
+// it would overdraw the balance or leave the user's active match holds
+// unfunded. Callers hold the service lock.
+func (s *PaymentService) checkWithdrawable(payment *Payment) (*Balance, error) {
+	balance, exists := s.balances[payment.UserID]
+	if !exists || balance.Available[payment.Currency].LessThan(payment.Amount) {
+		return nil, fmt.Errorf("insufficient balance")
+	}
+	held := s.heldAmount(payment.UserID, payment.Currency)
+	if free := balance.Available[payment.Currency].Sub(held); free.LessThan(payment.Amount) {
+		return nil, fmt.Errorf("insufficient balance: %s %s is held for active matches, %s is withdrawable",
+			held, payment.Currency, decimal.Max(free, decimal.Zero))
+	}
+	return balance, nil
+}
+
+func (s *PaymentService) publishHoldEvent(event string, hold *BalanceHold) {
+	data, _ := json.Marshal(hold)
+	s.nats.Publish(event, data)
+}
+
+// GetHolds returns the caller's balance holds, newest first
+func (s *PaymentService) GetHolds(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	status := r.URL.Query().Get("status")
+
+	s.mu.RLock()
+	holds := make([]*BalanceHold, 0)
+	for _, hold := range s.holds {
+		if hold.UserID != claims.UserID || (status != "" && hold.Status != status) {
+			continue
+		}
+		holds = append(holds, hold)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(holds, func(i, j int) bool { return holds[i].CreatedAt.After(holds[j].CreatedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holds)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func newHoldTestService() *PaymentService {
+	return &PaymentService{
+		balances: make(map[string]*Balance),
+		holds:    make(map[string]*BalanceHold),
+	}
+}
+
+func confirmedMatch(id, consumer, price string, start time.Time, hours int) map[string]interface{} {
+	return map[string]interface{}{
+		"id":           id,
+		"consumer_id":  consumer,
+		"agreed_price": price,
+		"start_time":   start.Format(time.RFC3339Nano),
+		"end_time":     start.Add(time.Duration(hours) * time.Hour).Format(time.RFC3339Nano),
+	}
+}
+
+func TestHandleMatchConfirmed(t *testing.T) {
+	start := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		matches   []map[string]interface{}
+		wantHolds int
+		wantHeld  string
+	}{
+		{"once", []map[string]interface{}{confirmedMatch("m1", "u1", "1.50", start, 2)}, 1, "3"},
+		{"confirmed by both parties", []map[string]interface{}{confirmedMatch("m1", "u1", "1.50", start, 2), confirmedMatch("m1", "u1", "1.50", start, 2)}, 1, "3"},
+		{"two matches", []map[string]interface{}{confirmedMatch("m1", "u1", "1.50", start, 2), confirmedMatch("m2", "u1", "2", start, 1)}, 2, "5"},
+		{"invalid price", []map[string]interface{}{confirmedMatch("m1", "u1", "cheap", start, 2)}, 0, "0"},
+		{"no duration", []map[string]interface{}{confirmedMatch("m1", "u1", "1.50", start, 0)}, 0, "0"},
+		{"no consumer", []map[string]interface{}{confirmedMatch("m1", "", "1.50", start, 2)}, 0, "0"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newHoldTestService()
+			for _, m := range c.matches {
+				s.handleMatchConfirmed(context.Background(), m)
+			}
+			if len(s.holds) != c.wantHolds {
+				t.Fatalf("Expected %d holds, got %d", c.wantHolds, len(s.holds))
+			}
+			if held := s.heldAmount("u1", holdCurrency); !held.Equal(decimal.RequireFromString(c.wantHeld)) {
+				t.Errorf("Expected %s held, got %s", c.wantHeld, held)
+			}
+			if c.wantHolds > 0 && !s.balances["u1"].Held[holdCurrency].Equal(decimal.RequireFromString(c.wantHeld)) {
+				t.Errorf("Balance shows %s held, want %s", s.balances["u1"].Held[holdCurrency], c.wantHeld)
+			}
+		})
+	}
+}
+
+func TestSettleAgainstHold(t *testing.T) {
+	cases := []struct {
+		name          string
+		payment       Payment
+		wantRemaining string
+		wantStatus    string
+	}{
+		{"partial", Payment{UserID: "u1", MatchID: "m1", Amount: decimal.NewFromInt(4), Currency: "USD"}, "6", HoldActive},
+		{"whole hold", Payment{UserID: "u1", MatchID: "m1", Amount: decimal.NewFromInt(10), Currency: "USD"}, "0", HoldSettled},
+		{"beyond the hold", Payment{UserID: "u1", MatchID: "m1", Amount: decimal.NewFromInt(15), Currency: "USD"}, "0", HoldSettled},
+		{"another user", Payment{UserID: "u2", MatchID: "m1", Amount: decimal.NewFromInt(4), Currency: "USD"}, "10", HoldActive},
+		{"another currency", Payment{UserID: "u1", MatchID: "m1", Amount: decimal.NewFromInt(4), Currency: "ETH"}, "10", HoldActive},
+		{"no match", Payment{UserID: "u1", Amount: decimal.NewFromInt(4), Currency: "USD"}, "10", HoldActive},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newHoldTestService()
+			s.holds["m1"] = &BalanceHold{UserID: "u1", MatchID: "m1", Currency: "USD",
+				Amount: decimal.NewFromInt(10), Remaining: decimal.NewFromInt(10), Status: HoldActive}
+			s.adjustHeld("u1", "USD", decimal.NewFromInt(10))
+
+			s.settleAgainstHold(&c.payment)
+
+			hold := s.holds["m1"]
+			want := decimal.RequireFromString(c.wantRemaining)
+			if !hold.Remaining.Equal(want) || hold.Status != c.wantStatus {
+				t.Errorf("Expected %s remaining and %s, got %s and %s", want, c.wantStatus, hold.Remaining, hold.Status)
+			}
+			if held := s.balances["u1"].Held["USD"]; !held.Equal(want) {
+				t.Errorf("Balance shows %s held, want %s", held, want)
+			}
+			if (hold.Status == HoldSettled) != (hold.ReleasedAt != nil) {
+				t.Error("Settled holds should record when they were released, and only they")
+			}
+		})
+	}
+}
+
+func TestReleaseExpired(t *testing.T) {
+	now := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name       string
+		status     string
+		expiresAt  time.Time
+		wantStatus string
+		wantHeld   string
+	}{
+		{"expired", HoldActive, now.Add(-time.Minute), HoldReleased, "0"},
+		{"expires now", HoldActive, now, HoldReleased, "0"},
+		{"still running", HoldActive, now.Add(time.Minute), HoldActive, "6"},
+		{"already settled", HoldSettled, now.Add(-time.Minute), HoldSettled, "6"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newHoldTestService()
+			s.holds["m1"] = &BalanceHold{UserID: "u1", MatchID: "m1", Currency: "USD", Amount: decimal.NewFromInt(10),
+				Remaining: decimal.NewFromInt(6), Status: c.status, ExpiresAt: c.expiresAt}
+			s.adjustHeld("u1", "USD", decimal.NewFromInt(6))
+
+			released := s.releaseExpired(now)
+
+			if hold := s.holds["m1"]; hold.Status != c.wantStatus {
+				t.Errorf("Expected %s, got %s", c.wantStatus, hold.Status)
+			}
+			if wantReleased := c.wantStatus == HoldReleased && c.status == HoldActive; (len(released) == 1) != wantReleased {
+				t.Errorf("Expected released=%v, got %d holds", wantReleased, len(released))
+			}
+			if held := s.balances["u1"].Held["USD"]; !held.Equal(decimal.RequireFromString(c.wantHeld)) {
+				t.Errorf("Balance shows %s held, want %s", held, c.wantHeld)
+			}
+		})
+	}
+}
+
+func TestCheckWithdrawable(t *testing.T) {
+	cases := []struct {
+		name    string
+		user    string
+		amount  int64
+		held    int64
+		wantErr bool
+	}{
+		{"free balance", "u1", 70, 30, false},
+		{"into the hold", "u1", 71, 30, true},
+		{"beyond the balance", "u1", 101, 0, true},
+		{"whole balance without holds", "u1", 100, 0, false},
+		{"no balance", "u2", 1, 0, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := newHoldTestService()
+			s.balances["u1"] = &Balance{UserID: "u1", Available: map[string]decimal.Decimal{"USD": decimal.NewFromInt(100)}}
+			if c.held > 0 {
+				s.holds["m1"] = &BalanceHold{UserID: "u1", MatchID: "m1", Currency: "USD",
+					Amount: decimal.NewFromInt(c.held), Remaining: decimal.NewFromInt(c.held), Status: HoldActive}
+			}
+
+			balance, err := s.checkWithdrawable(&Payment{UserID: c.user, Amount: decimal.NewFromInt(c.amount), Currency: "USD"})
+			if (err != nil) != c.wantErr {
+				t.Fatalf("Expected error=%v, got %v", c.wantErr, err)
+			}
+			if err == nil && balance != s.balances["u1"] {
+				t.Error("Expected the user's balance")
+			}
+		})
+	}
+}
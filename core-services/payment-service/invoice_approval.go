@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Invoice approval states for enterprise accounts. Invoices move
+// draft → pending_approval → approved → paid; a rejected invoice returns to
+// draft so its PO number can be corrected and resubmitted.
+const (
+	InvoiceDraft           = "draft"
+	InvoicePendingApproval = "pending_approval"
+	InvoiceApproved        = "approved"
+	InvoicePaid            = "paid"
+	InvoiceOverdue         = "overdue"
+)
+
+// paymentTermDays maps payment terms to the days an invoice is due after issue
+var paymentTermDays = map[string]int{
+	"net_30": 30,
+	"net_60": 60,
+}
+
+// defaultPaymentTerms applies to accounts without a billing profile
+const defaultPaymentTerms = "net_30"
+
+// BillingProfile holds an account's enterprise billing settings
+type BillingProfile struct {
+	UserID          string    `json:"user_id"`
+	Enterprise      bool      `json:"enterprise"`                  // Invoices require approval before they are payable
+	PaymentTerms    string    `json:"payment_terms"`               // net_30, net_60
+	RequirePO       bool      `json:"require_po"`                  // Invoices cannot be submitted without a PO number
+	DefaultPONumber string    `json:"default_po_number,omitempty"` // Copied onto new invoices
+	Approvers       []string  `json:"approvers,omitempty"`         // User IDs allowed to approve invoices
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// InvoiceTransition records one state change of an invoice
+type InvoiceTransition struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	By     string    `json:"by"`
+	Reason string    `json:"reason,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// isApprover reports whether a user may approve the profile's invoices
+func (p *BillingProfile) isApprover(userID string) bool {
+	for _, approver := range p.Approvers {
+		if approver == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// billingProfile returns an account's profile, or the default one for
+// accounts that have not been set up for enterprise billing. Callers hold
+// the service lock.
+func (s *PaymentService) billingProfile(userID string) *BillingProfile {
+	if profile, ok := s.billingProfiles[userID]; ok {
+		return profile
+	}
+	return &BillingProfile{UserID: userID, PaymentTerms: defaultPaymentTerms}
+}
+
+// applyBillingProfile sets terms, due date and PO number on a new invoice.
+// Callers hold the service lock.
+func (s *PaymentService) applyBillingProfile(invoice *Invoice) {
+	profile := s.billingProfile(invoice.UserID)
+	invoice.PaymentTerms = profile.PaymentTerms
+	invoice.DueDate = invoice.CreatedAt.AddDate(0, 0, paymentTermDays[profile.PaymentTerms])
+	invoice.PONumber = profile.DefaultPONumber
+	invoice.RequiresApproval = profile.Enterprise
+}
+
+// transitionInvoice moves an invoice to a new state and records who moved it.
+// Callers hold the service lock.
+func transitionInvoice(invoice *Invoice, to, by, reason string) {
+	invoice.History = append(invoice.History, InvoiceTransition{
+		From:   invoice.Status,
+		To:     to,
+		By:     by,
+		Reason: reason,
+		At:     time.Now(),
+	})
+	invoice.Status = to
+}
+
+// markOverdueInvoices flags payable invoices that are past their due date
+func (s *PaymentService) markOverdueInvoices() {
+	now := time.Now()
+	var overdue []*Invoice
+
+	s.mu.Lock()
+	for _, invoice := range s.invoices {
+		if invoice.Status == InvoicePaid || invoice.Status == InvoiceOverdue || !now.After(invoice.DueDate) {
+			continue
+		}
+		// Enterprise invoices are not payable, and so not overdue, until approved
+		if invoice.RequiresApproval && invoice.Status != InvoiceApproved {
+			continue
+		}
+		transitionInvoice(invoice, InvoiceOverdue, "system", "")
+		overdue = append(overdue, invoice)
+	}
+	s.mu.Unlock()
+
+	for _, invoice := range overdue {
+		s.publishInvoiceEvent("invoice.overdue", invoice)
+	}
+}
+
+// HTTP Handlers
+
+// GetBillingProfile returns an account's billing profile
+func (s *PaymentService) GetBillingProfile(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	userID := mux.Vars(r)["user_id"]
+
+	s.mu.RLock()
+	profile := s.billingProfile(userID)
+	allowed := claims.Role == "admin" || claims.UserID == userID || profile.isApprover(claims.UserID)
+	s.mu.RUnlock()
+
+	if !allowed {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// UpdateBillingProfile sets an account's billing profile. Account owners may
+// designate approvers and PO requirements; enterprise status and payment
+// terms are contractual and can only be changed by an admin.
+func (s *PaymentService) UpdateBillingProfile(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	userID := mux.Vars(r)["user_id"]
+
+	if claims.Role != "admin" && claims.UserID != userID {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	var req BillingProfile
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.PaymentTerms == "" {
+		req.PaymentTerms = defaultPaymentTerms
+	}
+	if _, ok := paymentTermDays[req.PaymentTerms]; !ok {
+		http.Error(w, "Payment terms must be net_30 or net_60", http.StatusBadRequest)
+		return
+	}
+
+	approvers := make([]string, 0, len(req.Approvers))
+	seen := make(map[string]bool)
+	for _, approver := range req.Approvers {
+		approver = strings.TrimSpace(approver)
+		if approver != "" && !seen[approver] {
+			seen[approver] = true
+			approvers = append(approvers, approver)
+		}
+	}
+
+	s.mu.Lock()
+	current := s.billingProfile(userID)
+	if claims.Role != "admin" && (req.Enterprise != current.Enterprise || req.PaymentTerms != current.PaymentTerms) {
+		s.mu.Unlock()
+		http.Error(w, "Only admins can change enterprise status or payment terms", http.StatusForbidden)
+		return
+	}
+	if req.Enterprise && len(approvers) == 0 {
+		s.mu.Unlock()
+		http.Error(w, "Enterprise accounts need at least one approver", http.StatusBadRequest)
+		return
+	}
+
+	profile := &BillingProfile{
+		UserID:          userID,
+		Enterprise:      req.Enterprise,
+		PaymentTerms:    req.PaymentTerms,
+		RequirePO:       req.RequirePO,
+		DefaultPONumber: strings.TrimSpace(req.DefaultPONumber),
+		Approvers:       approvers,
+		UpdatedAt:       time.Now(),
+	}
+	s.billingProfiles[userID] = profile
+	s.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Billing profile updated", "account_id", userID,
+		"enterprise", profile.Enterprise, "terms", profile.PaymentTerms)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// GetPendingApprovals lists invoices awaiting the caller's approval
+func (s *PaymentService) GetPendingApprovals(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	s.mu.RLock()
+	pending := make([]*Invoice, 0)
+	for _, invoice := range s.invoices {
+		if invoice.Status != InvoicePendingApproval {
+			continue
+		}
+		if claims.Role == "admin" || s.billingProfile(invoice.UserID).isApprover(claims.UserID) {
+			pending = append(pending, invoice)
+		}
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pending)
+}
+
+// SetInvoicePO sets the purchase order number of a draft invoice
+func (s *PaymentService) SetInvoicePO(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	var req struct {
+		PONumber string `json:"po_number"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	invoice, exists := s.invoices[mux.Vars(r)["id"]]
+	if !exists || (invoice.UserID != claims.UserID && claims.Role != "admin") {
+		s.mu.Unlock()
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	if invoice.Status != InvoiceDraft {
+		s.mu.Unlock()
+		http.Error(w, "PO number can only be changed on draft invoices", http.StatusConflict)
+		return
+	}
+	invoice.PONumber = strings.TrimSpace(req.PONumber)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// SubmitInvoice sends a draft enterprise invoice for approval
+func (s *PaymentService) SubmitInvoice(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	s.mu.Lock()
+	invoice, exists := s.invoices[mux.Vars(r)["id"]]
+	if !exists || (invoice.UserID != claims.UserID && claims.Role != "admin") {
+		s.mu.Unlock()
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	if err := s.checkSubmittable(invoice); err != nil {
+		s.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	transitionInvoice(invoice, InvoicePendingApproval, claims.UserID, "")
+	s.mu.Unlock()
+
+	s.publishInvoiceEvent("invoice.submitted", invoice)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// checkSubmittable reports why an invoice cannot be submitted for approval.
+// Callers hold the service lock.
+func (s *PaymentService) checkSubmittable(invoice *Invoice) error {
+	if !invoice.RequiresApproval {
+		return fmt.Errorf("invoice does not require approval")
+	}
+	if invoice.Status != InvoiceDraft {
+		return fmt.Errorf("only draft invoices can be submitted, invoice is %s", invoice.Status)
+	}
+	if s.billingProfile(invoice.UserID).RequirePO && invoice.PONumber == "" {
+		return fmt.Errorf("a PO number is required before submission")
+	}
+	return nil
+}
+
+// ApproveInvoice approves a pending invoice, making it payable
+func (s *PaymentService) ApproveInvoice(w http.ResponseWriter, r *http.Request) {
+	s.decideInvoice(w, r, true)
+}
+
+// RejectInvoice returns a pending invoice to draft with a reason
+func (s *PaymentService) RejectInvoice(w http.ResponseWriter, r *http.Request) {
+	s.decideInvoice(w, r, false)
+}
+
+// decideInvoice approves or rejects a pending invoice. Only designated
+// approvers may decide, and not on an invoice they submitted themselves.
+func (s *PaymentService) decideInvoice(w http.ResponseWriter, r *http.Request, approve bool) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if !approve && strings.TrimSpace(req.Reason) == "" {
+		http.Error(w, "A reason is required to reject an invoice", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	invoice, exists := s.invoices[mux.Vars(r)["id"]]
+	if !exists {
+		s.mu.Unlock()
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	if !s.billingProfile(invoice.UserID).isApprover(claims.UserID) {
+		s.mu.Unlock()
+		http.Error(w, "Not an approver for this account", http.StatusForbidden)
+		return
+	}
+	if invoice.Status != InvoicePendingApproval {
+		s.mu.Unlock()
+		http.Error(w, "Invoice is not pending approval", http.StatusConflict)
+		return
+	}
+	if n := len(invoice.History); n > 0 && invoice.History[n-1].By == claims.UserID {
+		s.mu.Unlock()
+		http.Error(w, "Invoices must be approved by someone other than the submitter", http.StatusForbidden)
+		return
+	}
+
+	event := "invoice.rejected"
+	if approve {
+		now := time.Now()
+		invoice.ApprovedBy = claims.UserID
+		invoice.ApprovedAt = &now
+		transitionInvoice(invoice, InvoiceApproved, claims.UserID, req.Reason)
+		event = "invoice.approved"
+	} else {
+		transitionInvoice(invoice, InvoiceDraft, claims.UserID, req.Reason)
+	}
+	s.mu.Unlock()
+
+	s.publishInvoiceEvent(event, invoice)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoice)
+}
+
+// MarkInvoicePaid records settlement of an invoice, e.g. a wire received
+// against net terms. Enterprise invoices must be approved first.
+func (s *PaymentService) MarkInvoicePaid(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Reference string `json:"reference"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	invoice, exists := s.invoices[mux.Vars(r)["id"]]
+	if !exists {
+		s.mu.Unlock()
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	payable := invoice.Status == InvoiceApproved || invoice.Status == InvoiceOverdue ||
+		(!invoice.RequiresApproval && invoice.Status != InvoicePaid)
+	if !payable {
+		s.mu.Unlock()
+		http.Error(w, fmt.Sprintf("Invoice is %s and not payable", invoice.Status), http.StatusConflict)
+		return
+	}
+	now := time.Now()
+	invoice.PaidAt = &now
+	transitionInvoice(invoice, InvoicePaid, claims.UserID, req.Reference)
+	s.mu.Unlock()
+
+	s.publishInvoiceEvent("invoice.paid", invoice)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invoice)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// ledgerCheckInterval is how often the service looks for a closed month that
+// has not been snapshotted yet
+const ledgerCheckInterval = 10 * time.Minute
+
+// ledgerGenesis is the previous checksum of the first snapshot in the chain
+const ledgerGenesis = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// Revenue categories. Rebates are paid out of platform fees, so they count
+// against revenue.
+const (
+	revenueCompute = "compute"
+	revenueRebates = "market_maker_rebates"
+)
+
+// LedgerSnapshot is the immutable state of the ledger at the end of a
+// calendar month. Snapshots form a hash chain: each checksum covers the
+// snapshot's content and the previous snapshot's checksum, so altering or
+// removing any snapshot breaks every checksum after it.
+//
+// The checksum is the hex SHA-256 of the snapshot's JSON encoding with the
+// checksum field empty. Maps encode with sorted keys and amounts as decimal
+// strings, so auditors can recompute it from the API response.
+type LedgerSnapshot struct {
+	Sequence         int                                   `json:"sequence"` // Position in the chain, starting at 1
+	Period           string                                `json:"period"`   // YYYY-MM
+	PeriodStart      time.Time                             `json:"period_start"`
+	PeriodEnd        time.Time                             `json:"period_end"`
+	CurrencyOfRecord string                                `json:"currency_of_record"` // Platform reporting currency
+	Accounts         []AccountSnapshot                     `json:"accounts"`
+	Totals           map[string]decimal.Decimal            `json:"totals"`  // Sum of account balances by currency
+	Revenue          map[string]map[string]decimal.Decimal `json:"revenue"` // category -> currency -> amount earned in the period
+	PaymentCount     int                                   `json:"payment_count"`
+	PreviousChecksum string                                `json:"previous_checksum"`
+	Checksum         string                                `json:"checksum"`
+	CreatedAt        time.Time                             `json:"created_at"`
+}
+
+// AccountSnapshot is one account's available balances at the end of a period
+type AccountSnapshot struct {
+	AccountID        string                     `json:"account_id"`
+	CurrencyOfRecord string                     `json:"currency_of_record"` // Currency the account transacts in most
+	Balances         map[string]decimal.Decimal `json:"balances"`
+}
+
+// LedgerVerification is the result of re-checking the snapshot chain
+type LedgerVerification struct {
+	Valid     bool   `json:"valid"`
+	Snapshots int    `json:"snapshots"`
+	Head      string `json:"head,omitempty"`      // Checksum of the latest snapshot
+	BrokenAt  string `json:"broken_at,omitempty"` // Period of the first snapshot that fails
+	Error     string `json:"error,omitempty"`
+}
+
+// ledgerCurrency returns the platform's currency of record
+func ledgerCurrency() string {
+	if currency := os.Getenv("LEDGER_CURRENCY"); currency != "" {
+		return currency
+	}
+	return holdCurrency
+}
+
+// checksum computes a snapshot's chained checksum
+func (snap LedgerSnapshot) checksum() string {
+	snap.Checksum = ""
+	data, _ := json.Marshal(snap)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ledgerSnapshotter snapshots every month as soon as it closes
+func (s *PaymentService) ledgerSnapshotter() {
+	ticker := time.NewTicker(ledgerCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.snapshotClosedMonths(time.Now().UTC())
+		<-ticker.C
+	}
+}
+
+// snapshotClosedMonths appends a snapshot for every closed month after the
+// chain head, starting with the last closed month on a fresh ledger
+func (s *PaymentService) snapshotClosedMonths(now time.Time) {
+	currentMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := currentMonth.AddDate(0, -1, 0)
+	if n := len(s.snapshots); n > 0 {
+		start = s.snapshots[n-1].PeriodEnd
+	}
+	for ; start.Before(currentMonth); start = start.AddDate(0, 1, 0) {
+		snap := s.takeSnapshot(start, start.AddDate(0, 1, 0), now)
+		s.snapshots = append(s.snapshots, snap)
+
+		slog.Info("Ledger snapshot taken", "period", snap.Period, "accounts", len(snap.Accounts),
+			"payments", snap.PaymentCount, "checksum", snap.Checksum)
+		data, _ := json.Marshal(snap)
+		s.nats.Publish("ledger.snapshot", data)
+	}
+}
+
+// takeSnapshot builds the snapshot of a period and chains it to the head.
+// Balances are the current ones with every later movement rolled back, so a
+// snapshot taken late still shows the month-end state. Callers hold the
+// service lock.
+func (s *PaymentService) takeSnapshot(periodStart, periodEnd, now time.Time) *LedgerSnapshot {
+	snap := &LedgerSnapshot{
+		Sequence:         len(s.snapshots) + 1,
+		Period:           periodStart.Format("2006-01"),
+		PeriodStart:      periodStart,
+		PeriodEnd:        periodEnd,
+		CurrencyOfRecord: ledgerCurrency(),
+		Accounts:         []AccountSnapshot{},
+		Totals:           make(map[string]decimal.Decimal),
+		Revenue:          make(map[string]map[string]decimal.Decimal),
+		PreviousChecksum: ledgerGenesis,
+		CreatedAt:        now,
+	}
+	if n := len(s.snapshots); n > 0 {
+		snap.PreviousChecksum = s.snapshots[n-1].Checksum
+	}
+
+	balances := make(map[string]map[string]decimal.Decimal)
+	for userID, balance := range s.balances {
+		balances[userID] = make(map[string]decimal.Decimal)
+		for currency, amount := range balance.Available {
+			balances[userID][currency] = amount
+		}
+	}
+
+	activity := make(map[string]map[string]int) // account -> currency -> payments
+	for _, payment := range s.payments {
+		at, delta, ok := balanceMovement(payment)
+		if !ok {
+			continue
+		}
+		if !at.Before(periodEnd) {
+			if balances[payment.UserID] == nil {
+				balances[payment.UserID] = make(map[string]decimal.Decimal)
+			}
+			balances[payment.UserID][payment.Currency] = balances[payment.UserID][payment.Currency].Sub(delta)
+			continue
+		}
+
+		if activity[payment.UserID] == nil {
+			activity[payment.UserID] = make(map[string]int)
+		}
+		activity[payment.UserID][payment.Currency]++
+		if at.Before(periodStart) {
+			continue
+		}
+		snap.PaymentCount++
+		if category := revenueCategory(payment); category != "" {
+			if snap.Revenue[category] == nil {
+				snap.Revenue[category] = make(map[string]decimal.Decimal)
+			}
+			amount := payment.Amount
+			if category == revenueRebates {
+				amount = amount.Neg()
+			}
+			snap.Revenue[category][payment.Currency] = snap.Revenue[category][payment.Currency].Add(amount)
+		}
+	}
+
+	for userID, byCurrency := range balances {
+		account := AccountSnapshot{
+			AccountID:        userID,
+			CurrencyOfRecord: accountCurrency(activity[userID], snap.CurrencyOfRecord),
+			Balances:         make(map[string]decimal.Decimal),
+		}
+		for currency, amount := range byCurrency {
+			if amount.IsZero() {
+				continue
+			}
+			account.Balances[currency] = amount
+			snap.Totals[currency] = snap.Totals[currency].Add(amount)
+		}
+		if len(account.Balances) > 0 || len(activity[userID]) > 0 {
+			snap.Accounts = append(snap.Accounts, account)
+		}
+	}
+	sort.Slice(snap.Accounts, func(i, j int) bool { return snap.Accounts[i].AccountID < snap.Accounts[j].AccountID })
+
+	snap.Checksum = snap.checksum()
+	return snap
+}
+
+// balanceMovement returns when and by how much a payment moved its account's
+// available balance, mirroring updateBalance. Withdrawals leave the available
+// balance when they start processing; everything else moves on completion.
+func balanceMovement(payment *Payment) (time.Time, decimal.Decimal, bool) {
+	switch payment.Type {
+	case "withdrawal":
+		if payment.Status == "processing" || payment.Status == "completed" {
+			return payment.CreatedAt, payment.Amount.Neg(), true
+		}
+		return time.Time{}, decimal.Zero, false
+	}
+
+	if payment.Status != "completed" || payment.CompletedAt == nil {
+		return time.Time{}, decimal.Zero, false
+	}
+	switch payment.Type {
+	case "deposit", "rebate":
+		return *payment.CompletedAt, payment.Amount, true
+	case "job_payment":
+		return *payment.CompletedAt, payment.Amount.Neg(), true
+	}
+	return time.Time{}, decimal.Zero, false
+}
+
+// revenueCategory returns the revenue category a payment counts towards, or
+// "" for movements that are not revenue such as deposits
+func revenueCategory(payment *Payment) string {
+	switch payment.Type {
+	case "job_payment":
+		return revenueCompute
+	case "rebate":
+		return revenueRebates
+	}
+	return ""
+}
+
+// accountCurrency picks an account's currency of record: the one it has made
+// the most payments in, preferring the platform currency on a tie
+func accountCurrency(activity map[string]int, platform string) string {
+	currencies := make([]string, 0, len(activity))
+	for currency := range activity {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	best, bestCount := platform, activity[platform]
+	for _, currency := range currencies {
+		if activity[currency] > bestCount {
+			best, bestCount = currency, activity[currency]
+		}
+	}
+	return best
+}
+
+// verifyLedger recomputes every checksum and link in the snapshot chain.
+// Callers hold the service lock.
+func (s *PaymentService) verifyLedger() LedgerVerification {
+	result := LedgerVerification{Valid: true, Snapshots: len(s.snapshots)}
+	previous := ledgerGenesis
+	for i, snap := range s.snapshots {
+		switch {
+		case snap.Sequence != i+1:
+			result.Error = fmt.Sprintf("sequence %d out of order", snap.Sequence)
+		case snap.PreviousChecksum != previous:
+			result.Error = "previous checksum does not match the preceding snapshot"
+		case snap.checksum() != snap.Checksum:
+			result.Error = "checksum does not match contents"
+		}
+		if result.Error != "" {
+			result.Valid = false
+			result.BrokenAt = snap.Period
+			return result
+		}
+		previous = snap.Checksum
+	}
+	if len(s.snapshots) > 0 {
+		result.Head = previous
+	}
+	return result
+}
+
+// ListLedgerSnapshots returns the month-end ledger snapshots, oldest first.
+// Query: from=YYYY-MM, to=YYYY-MM
+func (s *PaymentService) ListLedgerSnapshots(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	for _, period := range []string{from, to} {
+		if _, err := time.Parse("2006-01", period); period != "" && err != nil {
+			http.Error(w, "from and to must be YYYY-MM", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.RLock()
+	snapshots := []*LedgerSnapshot{}
+	for _, snap := range s.snapshots {
+		if (from == "" || snap.Period >= from) && (to == "" || snap.Period <= to) {
+			snapshots = append(snapshots, snap)
+		}
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// GetLedgerSnapshot returns the snapshot of one month
+func (s *PaymentService) GetLedgerSnapshot(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	period := mux.Vars(r)["period"]
+	s.mu.RLock()
+	var found *LedgerSnapshot
+	for _, snap := range s.snapshots {
+		if snap.Period == period {
+			found = snap
+			break
+		}
+	}
+	s.mu.RUnlock()
+
+	if found == nil {
+		http.Error(w, "Snapshot not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
+
+// VerifyLedger re-checks the snapshot chain for tampering
+func (s *PaymentService) VerifyLedger(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	s.mu.RLock()
+	result := s.verifyLedger()
+	s.mu.RUnlock()
+
+	if !result.Valid {
+		slog.ErrorContext(r.Context(), "Ledger snapshot chain broken", "period", result.BrokenAt, "error", result.Error)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
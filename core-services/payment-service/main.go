@@ -5,7 +5,7 @@ import (
 	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math/big"
 	"net/http"
 	"os"
@@ -13,6 +13,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/computehive/core-services/pkg/events"
+	"github.com/computehive/core-services/pkg/health"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/computehive/core-services/pkg/tagfilter"
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -33,7 +37,8 @@ import (
 type Payment struct {
 	ID              string          `json:"id"`
 	UserID          string          `json:"user_id"`
-	Type            string          `json:"type"` // deposit, withdrawal, job_payment, refund
+	OrgID           string          `json:"org_id,omitempty"` // Organization of the charged user
+	Type            string          `json:"type"` // deposit, withdrawal, job_payment, refund, rebate
 	Amount          decimal.Decimal `json:"amount"`
 	Currency        string          `json:"currency"` // ETH, USDC, etc.
 	Status          string          `json:"status"`   // pending, processing, completed, failed
@@ -41,9 +46,15 @@ type Payment struct {
 	FromAddress     string          `json:"from_address,omitempty"`
 	ToAddress       string          `json:"to_address,omitempty"`
 	JobID           string          `json:"job_id,omitempty"`
+	MatchID         string          `json:"match_id,omitempty"` // Marketplace match a job payment settles
+	PaymentMethodID string          `json:"payment_method_id,omitempty"` // Verified method a withdrawal pays out to
 	CreatedAt       time.Time       `json:"created_at"`
 	CompletedAt     *time.Time      `json:"completed_at,omitempty"`
 	FailureReason   string          `json:"failure_reason,omitempty"`
+	Tags            map[string]string `json:"tags,omitempty"` // Cost allocation tags copied from the job
+	JobType         string          `json:"job_type,omitempty"`      // Runtime of the charged job, e.g. docker
+	ComputeHours    float64         `json:"compute_hours,omitempty"` // Wall-clock hours the charged job ran
+	Reference       string          `json:"reference,omitempty"`     // What a rebate was earned for, e.g. a market maker period
 }
 
 // Invoice represents a billing invoice
@@ -54,10 +65,17 @@ type Invoice struct {
 	PeriodEnd       time.Time       `json:"period_end"`
 	TotalAmount     decimal.Decimal `json:"total_amount"`
 	Currency        string          `json:"currency"`
-	Status          string          `json:"status"` // draft, pending, paid, overdue
+	Status          string          `json:"status"` // draft, pending_approval, approved, paid, overdue
 	DueDate         time.Time       `json:"due_date"`
 	PaidAt          *time.Time      `json:"paid_at,omitempty"`
+	PONumber        string          `json:"po_number,omitempty"`
+	PaymentTerms    string          `json:"payment_terms,omitempty"` // net_30, net_60
+	RequiresApproval bool           `json:"requires_approval,omitempty"`
+	ApprovedBy      string          `json:"approved_by,omitempty"`
+	ApprovedAt      *time.Time      `json:"approved_at,omitempty"`
+	History         []InvoiceTransition `json:"history,omitempty"`
 	LineItems       []LineItem      `json:"line_items"`
+	SpendByTag      map[string]map[string]decimal.Decimal `json:"spend_by_tag,omitempty"` // tag key -> tag value -> amount
 	CreatedAt       time.Time       `json:"created_at"`
 }
 
@@ -68,6 +86,7 @@ type LineItem struct {
 	UnitPrice   decimal.Decimal `json:"unit_price"`
 	Amount      decimal.Decimal `json:"amount"`
 	JobID       string          `json:"job_id,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
 }
 
 // Balance represents user account balance
@@ -76,6 +95,7 @@ type Balance struct {
 	Available       map[string]decimal.Decimal   `json:"available"`
 	Pending         map[string]decimal.Decimal   `json:"pending"`
 	Reserved        map[string]decimal.Decimal   `json:"reserved"`
+	Held            map[string]decimal.Decimal   `json:"held,omitempty"` // Part of available held for active matches
 	LastUpdated     time.Time                    `json:"last_updated"`
 }
 
@@ -87,6 +107,18 @@ type PaymentMethod struct {
 	Details         map[string]interface{} `json:"details"`
 	IsDefault       bool                   `json:"is_default"`
 	CreatedAt       time.Time              `json:"created_at"`
+	
+	// Withdrawals require a verified method: wallets sign a challenge, bank
+	// accounts confirm micro-deposits
+	Verification          string     `json:"verification"` // pending, verified, failed, not_required, locked
+	Challenge             string     `json:"challenge,omitempty"` // Message a wallet signs to prove ownership
+	VerificationAttempts  int        `json:"verification_attempts,omitempty"`
+	VerificationRestarts  int        `json:"verification_restarts,omitempty"` // Locked after maxVerificationRestarts
+	VerificationStartedAt *time.Time `json:"verification_started_at,omitempty"`
+	VerificationExpiresAt *time.Time `json:"verification_expires_at,omitempty"`
+	VerificationError     string     `json:"verification_error,omitempty"`
+	VerifiedAt            *time.Time `json:"verified_at,omitempty"`
+	microDeposits         []decimal.Decimal // Amounts sent to a bank account, never exposed
 }
 
 // BlockchainConfig holds blockchain connection details
@@ -103,10 +135,18 @@ type PaymentService struct {
 	invoices        map[string]*Invoice
 	balances        map[string]*Balance
 	paymentMethods  map[string][]*PaymentMethod
+	billingProfiles map[string]*BillingProfile
+	holds           map[string]*BalanceHold // by match ID
+	snapshots       []*LedgerSnapshot       // Month-end ledger hash chain, oldest first
 	mu              sync.RWMutex
 	nats            *nats.Conn
+	bus             *events.Bus
 	ethClient       *ethclient.Client
 	blockchain      BlockchainConfig
+	chain           PaymentProvider
+	fiat            PaymentProvider
+	sandbox         *Sandbox
+	digests         *Digests
 	
 	// Metrics
 	paymentsProcessed   *prometheus.CounterVec
@@ -129,15 +169,24 @@ func NewPaymentService() (*PaymentService, error) {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 	
-	// Connect to Ethereum
+	// Job completions and matches arrive through JetStream so none are missed while down
+	bus, err := events.Connect(nc, "payment-service")
+	if err != nil {
+		return nil, err
+	}
+	
+	// Connect to Ethereum; the sandbox never touches a real chain
 	rpcURL := os.Getenv("ETH_RPC_URL")
 	if rpcURL == "" {
 		rpcURL = "http://localhost:8545" // Default to local node
 	}
 	
-	ethClient, err := ethclient.Dial(rpcURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Ethereum: %w", err)
+	var ethClient *ethclient.Client
+	if !sandboxEnabled() {
+		ethClient, err = ethclient.Dial(rpcURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to Ethereum: %w", err)
+		}
 	}
 	
 	// Parse private key for transactions
@@ -167,7 +216,10 @@ func NewPaymentService() (*PaymentService, error) {
 		invoices:       make(map[string]*Invoice),
 		balances:       make(map[string]*Balance),
 		paymentMethods: make(map[string][]*PaymentMethod),
+		billingProfiles: make(map[string]*BillingProfile),
+		holds:          make(map[string]*BalanceHold),
 		nats:           nc,
+		bus:            bus,
 		ethClient:      ethClient,
 		blockchain: BlockchainConfig{
 			RPCURL:          rpcURL,
@@ -224,6 +276,23 @@ func NewPaymentService() (*PaymentService, error) {
 		s.failedPayments,
 	)
 	
+	// Choose payment providers. No card processor is integrated yet, so live
+	// fiat currencies take the same simulated off-chain path as chain ones.
+	if sandboxEnabled() {
+		s.sandbox = NewSandbox(s)
+		s.chain, s.fiat = s.sandbox.Providers()
+		if err := s.sandbox.Reset(nil); err != nil {
+			return nil, err
+		}
+		slog.Warn("Payment sandbox enabled: providers are deterministic fakes")
+	} else {
+		s.chain = &ethereumProvider{service: s}
+		s.fiat = s.chain
+	}
+	
+	// Weekly and monthly digests for organizations
+	s.digests = NewDigests(s)
+	
 	// Subscribe to events
 	s.subscribeToEvents()
 	
@@ -231,6 +300,9 @@ func NewPaymentService() (*PaymentService, error) {
 	go s.paymentProcessor()
 	go s.blockchainMonitor()
 	go s.invoiceGenerator()
+	go s.releaseExpiredHolds()
+	go s.ledgerSnapshotter()
+	go s.digests.run()
 	
 	return s, nil
 }
@@ -244,7 +316,9 @@ func (s *PaymentService) ProcessPayment(w http.ResponseWriter, r *http.Request)
 		Amount   string `json:"amount"`
 		Currency string `json:"currency"`
 		JobID    string `json:"job_id,omitempty"`
+		MatchID  string `json:"match_id,omitempty"`
 		ToUserID string `json:"to_user_id,omitempty"`
+		PaymentMethodID string `json:"payment_method_id,omitempty"` // Withdrawal destination, defaults to the default method
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -278,11 +352,23 @@ func (s *PaymentService) ProcessPayment(w http.ResponseWriter, r *http.Request)
 		Currency:  req.Currency,
 		Status:    "pending",
 		JobID:     req.JobID,
+		MatchID:   req.MatchID,
 		CreatedAt: time.Now(),
 	}
 	
 	// Store payment
 	s.mu.Lock()
+	// Withdrawals only pay out to a verified wallet or bank account
+	if payment.Type == "withdrawal" {
+		method, err := s.withdrawalDestination(userID, req.PaymentMethodID)
+		if err != nil {
+			s.mu.Unlock()
+			obs.WriteError(w, r, err)
+			return
+		}
+		payment.PaymentMethodID = method.ID
+		payment.ToAddress = walletAddress(method)
+	}
 	s.payments[payment.ID] = payment
 	s.mu.Unlock()
 	
@@ -338,12 +424,22 @@ func (s *PaymentService) GetPaymentHistory(w http.ResponseWriter, r *http.Reques
 	limit := 100 // Default limit
 	offset := 0  // Default offset
 	
+	tagFilters, err := tagfilter.Parse(r.URL.Query()["tag"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jobID := r.URL.Query().Get("job_id")
+	
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	
 	var userPayments []*Payment
 	for _, payment := range s.payments {
-		if payment.UserID == userID {
+		if jobID != "" && payment.JobID != jobID {
+			continue
+		}
+		if payment.UserID == userID && tagfilter.Match(payment.Tags, tagFilters) {
 			userPayments = append(userPayments, payment)
 		}
 	}
@@ -394,19 +490,29 @@ func (s *PaymentService) AddPaymentMethod(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Invalid payment method type", http.StatusBadRequest)
 		return
 	}
+	if req.Type == "crypto_wallet" {
+		if address, _ := req.Details["address"].(string); !common.IsHexAddress(address) {
+			http.Error(w, "Crypto wallets need a valid address in details.address", http.StatusBadRequest)
+			return
+		}
+	}
 	
 	// Create payment method
 	method := &PaymentMethod{
-		ID:        generateID(),
-		UserID:    userID,
-		Type:      req.Type,
-		Details:   req.Details,
-		IsDefault: false,
-		CreatedAt: time.Now(),
+		ID:           generateID(),
+		UserID:       userID,
+		Type:         req.Type,
+		Details:      req.Details,
+		IsDefault:    false,
+		CreatedAt:    time.Now(),
+		Verification: verificationNotRequired,
 	}
 	
 	// Store payment method
 	s.mu.Lock()
+	if requiresVerification(method.Type) {
+		s.startVerification(method)
+	}
 	if s.paymentMethods[userID] == nil {
 		s.paymentMethods[userID] = make([]*PaymentMethod, 0)
 	}
@@ -440,6 +546,8 @@ func (s *PaymentService) processPayment(payment *Payment) {
 		err = s.processWithdrawal(payment)
 	case "job_payment":
 		err = s.processJobPayment(payment)
+	case "rebate":
+		// Rebates are paid out of platform fees and credited to the balance
 	default:
 		err = fmt.Errorf("unsupported payment type: %s", payment.Type)
 	}
@@ -447,7 +555,8 @@ func (s *PaymentService) processPayment(payment *Payment) {
 	if err != nil {
 		s.updatePaymentStatus(payment.ID, "failed", err.Error())
 		s.failedPayments.Inc()
-		log.Printf("Payment %s failed: %v", payment.ID, err)
+		slog.Error("Payment failed", "payment_id", payment.ID, "type", payment.Type, obs.KeyUserID, payment.UserID,
+			obs.KeyCode, obs.CodeOf(err), obs.KeyError, err)
 	} else {
 		s.updatePaymentStatus(payment.ID, "completed", "")
 		s.paymentsProcessed.WithLabelValues(payment.Type, "completed", payment.Currency).Inc()
@@ -462,62 +571,53 @@ func (s *PaymentService) processPayment(payment *Payment) {
 }
 
 func (s *PaymentService) processDeposit(payment *Payment) error {
-	// In production, this would:
-	// 1. Monitor blockchain for incoming transaction
-	// 2. Verify transaction confirmations
-	// 3. Credit user account
-	
-	// For now, simulate deposit processing
-	time.Sleep(2 * time.Second)
-	
-	// Generate transaction hash (mock)
-	payment.TxHash = fmt.Sprintf("0x%x", time.Now().UnixNano())
+	txHash, err := s.providerFor(payment.Currency).Deposit(context.Background(), payment)
+	if err != nil {
+		return err
+	}
+	payment.TxHash = txHash
 	
 	return nil
 }
 
 func (s *PaymentService) processWithdrawal(payment *Payment) error {
-	// Check user balance
-	s.mu.RLock()
-	balance, exists := s.balances[payment.UserID]
-	s.mu.RUnlock()
-	
-	if !exists || balance.Available[payment.Currency].LessThan(payment.Amount) {
-		return fmt.Errorf("insufficient balance")
-	}
-	
-	// Reserve funds
+	// Check the destination is still verified, then check user balance and
+	// reserve funds, leaving active match holds funded
 	s.mu.Lock()
+	if _, err := s.withdrawalDestination(payment.UserID, payment.PaymentMethodID); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	balance, err := s.checkWithdrawable(payment)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
 	balance.Available[payment.Currency] = balance.Available[payment.Currency].Sub(payment.Amount)
 	balance.Reserved[payment.Currency] = balance.Reserved[payment.Currency].Add(payment.Amount)
 	s.mu.Unlock()
 	
-	// Process blockchain withdrawal
-	if payment.Currency == "ETH" {
-		txHash, err := s.sendETH(payment.ToAddress, payment.Amount)
-		if err != nil {
-			// Restore balance
-			s.mu.Lock()
-			balance.Available[payment.Currency] = balance.Available[payment.Currency].Add(payment.Amount)
-			balance.Reserved[payment.Currency] = balance.Reserved[payment.Currency].Sub(payment.Amount)
-			s.mu.Unlock()
-			return err
-		}
-		payment.TxHash = txHash
+	// Send the withdrawal through the currency's provider
+	txHash, err := s.providerFor(payment.Currency).Withdraw(context.Background(), payment)
+	if err != nil {
+		// Restore balance
+		s.mu.Lock()
+		balance.Available[payment.Currency] = balance.Available[payment.Currency].Add(payment.Amount)
+		balance.Reserved[payment.Currency] = balance.Reserved[payment.Currency].Sub(payment.Amount)
+		s.mu.Unlock()
+		return err
 	}
+	payment.TxHash = txHash
 	
 	return nil
 }
 
 func (s *PaymentService) processJobPayment(payment *Payment) error {
-	// Process job payment through escrow contract
-	// This would interact with the smart contract
-	
-	// For now, simulate processing
-	time.Sleep(1 * time.Second)
-	
-	// Generate transaction hash (mock)
-	payment.TxHash = fmt.Sprintf("0x%x", time.Now().UnixNano())
+	txHash, err := s.providerFor(payment.Currency).ChargeJob(context.Background(), payment)
+	if err != nil {
+		return err
+	}
+	payment.TxHash = txHash
 	
 	return nil
 }
@@ -593,6 +693,9 @@ func (s *PaymentService) updateBalance(payment *Payment) {
 	case "job_payment":
 		// Handle job payment balance updates
 		balance.Available[payment.Currency] = balance.Available[payment.Currency].Sub(payment.Amount)
+		s.settleAgainstHold(payment)
+	case "rebate":
+		balance.Available[payment.Currency] = balance.Available[payment.Currency].Add(payment.Amount)
 	}
 	
 	balance.LastUpdated = time.Now()
@@ -623,6 +726,12 @@ func (s *PaymentService) blockchainMonitor() {
 	}
 }
 
+// checkEthereum verifies the RPC node is reachable. Deposits and job payments
+// keep working off-chain without it, so it only degrades readiness.
+func (s *PaymentService) checkEthereum(ctx context.Context) error {
+	return s.chain.Check(ctx)
+}
+
 func (s *PaymentService) invoiceGenerator() {
 	// Generate monthly invoices
 	ticker := time.NewTicker(24 * time.Hour)
@@ -634,6 +743,7 @@ func (s *PaymentService) invoiceGenerator() {
 		if now.Day() == 1 {
 			s.generateMonthlyInvoices()
 		}
+		s.markOverdueInvoices()
 	}
 }
 
@@ -650,21 +760,26 @@ func (s *PaymentService) generateMonthlyInvoices() {
 	
 	for userID := range users {
 		// Calculate monthly usage
+		periodStart := time.Now().AddDate(0, -1, 0)
+		periodEnd := time.Now()
+		lineItems, total := s.jobLineItems(userID, periodStart, periodEnd)
+		
 		// Create invoice
 		invoice := &Invoice{
 			ID:          generateID(),
 			UserID:      userID,
-			PeriodStart: time.Now().AddDate(0, -1, 0),
-			PeriodEnd:   time.Now(),
-			TotalAmount: decimal.Zero,
+			PeriodStart: periodStart,
+			PeriodEnd:   periodEnd,
+			TotalAmount: total,
 			Currency:    "USD",
-			Status:      "draft",
-			DueDate:     time.Now().AddDate(0, 0, 30),
-			LineItems:   []LineItem{},
+			Status:      InvoiceDraft,
+			LineItems:   lineItems,
+			SpendByTag:  spendByTag(lineItems),
 			CreatedAt:   time.Now(),
 		}
 		
 		s.mu.Lock()
+		s.applyBillingProfile(invoice)
 		s.invoices[invoice.ID] = invoice
 		s.mu.Unlock()
 		
@@ -675,23 +790,42 @@ func (s *PaymentService) generateMonthlyInvoices() {
 
 func (s *PaymentService) subscribeToEvents() {
 	// Subscribe to job completion events
-	s.nats.Subscribe("job.completed", func(msg *nats.Msg) {
+	s.bus.Subscribe("job.completed", func(ctx context.Context, msg *nats.Msg) error {
 		var job map[string]interface{}
 		if err := json.Unmarshal(msg.Data, &job); err != nil {
-			return
+			return obs.Wrap(obs.CodeInvalidArgument, err)
 		}
 		
 		s.handleJobCompletion(job)
+		s.digests.recordJob(job)
+		return nil
+	})
+	
+	// Subscribe to job failures for digest failure summaries
+	s.bus.Subscribe("job.failed", func(ctx context.Context, msg *nats.Msg) error {
+		var job map[string]interface{}
+		if err := json.Unmarshal(msg.Data, &job); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		
+		s.digests.recordJob(job)
+		return nil
 	})
 	
 	// Subscribe to marketplace match events
-	s.nats.Subscribe("marketplace.match.confirmed", func(msg *nats.Msg) {
+	s.bus.Subscribe("match.confirmed", func(ctx context.Context, msg *nats.Msg) error {
 		var match map[string]interface{}
 		if err := json.Unmarshal(msg.Data, &match); err != nil {
-			return
+			return obs.Wrap(obs.CodeInvalidArgument, err)
 		}
 		
-		s.handleMatchConfirmed(match)
+		s.handleMatchConfirmed(ctx, match)
+		return nil
+	})
+	
+	// Subscribe to market maker settlements to credit fee rebates
+	s.bus.Subscribe("market_maker.settled", func(ctx context.Context, msg *nats.Msg) error {
+		return s.handleMakerSettled(ctx, msg.Data)
 	})
 }
 
@@ -700,20 +834,43 @@ func (s *PaymentService) handleJobCompletion(job map[string]interface{}) {
 	jobID, _ := job["id"].(string)
 	userID, _ := job["user_id"].(string)
 	cost, _ := job["cost"].(float64)
-	
+	matchID, _ := job["match_id"].(string)
+
+	// Jobs submitted with a price quote settle at the quoted hourly rate
+	if quotedCost, ok := quotedJobCost(job); ok {
+		cost = quotedCost
+	}
+
+	// Federated jobs are billed once, by the region that accepted them
+	if homeRegion, _ := job["home_region"].(string); homeRegion != "" && homeRegion != localRegion() {
+		return
+	}
+
 	if jobID != "" && userID != "" && cost > 0 {
 		payment := &Payment{
 			ID:        generateID(),
 			UserID:    userID,
+			OrgID:     stringField(job, "org_id"),
 			Type:      "job_payment",
 			Amount:    decimal.NewFromFloat(cost),
 			Currency:  "USD",
 			Status:    "pending",
 			JobID:     jobID,
+			MatchID:   matchID,
+			Tags:      jobTags(job),
+			JobType:   stringField(job, "type"),
 			CreatedAt: time.Now(),
 		}
+		payment.ComputeHours, _ = jobRunHours(job)
 		
 		s.mu.Lock()
+		// Completions are redelivered until acknowledged; charge each job once
+		for _, existing := range s.payments {
+			if existing.Type == "job_payment" && existing.JobID == jobID {
+				s.mu.Unlock()
+				return
+			}
+		}
 		s.payments[payment.ID] = payment
 		s.mu.Unlock()
 		
@@ -722,11 +879,6 @@ func (s *PaymentService) handleJobCompletion(job map[string]interface{}) {
 	}
 }
 
-func (s *PaymentService) handleMatchConfirmed(match map[string]interface{}) {
-	// Handle marketplace match confirmation
-	// This would trigger payment processing
-}
-
 func (s *PaymentService) updatePaymentStatus(paymentID, status, failureReason string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -759,6 +911,7 @@ type Claims struct {
 	Email    string   `json:"email"`
 	Username string   `json:"username"`
 	Role     string   `json:"role"`
+	OrgID    string   `json:"org_id,omitempty"`
 	Scopes   []string `json:"scopes"`
 	jwt.RegisteredClaims
 }
@@ -784,41 +937,132 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 		
 		claims := token.Claims.(*Claims)
+		if claims.Role == "agent" {
+			http.Error(w, "Agent credentials cannot call user APIs", http.StatusForbidden)
+			return
+		}
 		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = obs.WithCaller(ctx, claims.UserID, "")
 		next(w, r.WithContext(ctx))
 	}
 }
 
+// quotedJobCost prices a job at its quoted hourly rate for the time it ran
+func quotedJobCost(job map[string]interface{}) (float64, bool) {
+	price, _ := job["quoted_price_per_hour"].(float64)
+	if price <= 0 {
+		return 0, false
+	}
+	
+	hours, ok := jobRunHours(job)
+	if !ok {
+		return 0, false
+	}
+	return price * hours, true
+}
+
+// jobRunHours returns how long a finished job ran, from its start (or
+// scheduling, if it never reported a start) to its completion
+func jobRunHours(job map[string]interface{}) (float64, bool) {
+	startedAt, err := time.Parse(time.RFC3339Nano, stringField(job, "started_at"))
+	if err != nil {
+		if startedAt, err = time.Parse(time.RFC3339Nano, stringField(job, "scheduled_at")); err != nil {
+			return 0, false
+		}
+	}
+	completedAt, err := time.Parse(time.RFC3339Nano, stringField(job, "completed_at"))
+	if err != nil || completedAt.Before(startedAt) {
+		return 0, false
+	}
+	
+	return completedAt.Sub(startedAt).Hours(), true
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	v, _ := m[key].(string)
+	return v
+}
+
+// localRegion returns the region this control plane serves
+func localRegion() string {
+	if region := os.Getenv("REGION"); region != "" {
+		return region
+	}
+	return "default"
+}
+
 func generateID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
 
+// isAdmin reports whether the authenticated caller is an admin
+func isAdmin(r *http.Request) bool {
+	claims, ok := r.Context().Value("claims").(*Claims)
+	return ok && claims.Role == "admin"
+}
+
 func main() {
+	obs.Init("payment-service")
+	
 	paymentService, err := NewPaymentService()
 	if err != nil {
-		log.Fatalf("Failed to create payment service: %v", err)
+		obs.Fatal("Failed to create payment service", err)
 	}
 	
 	router := mux.NewRouter()
+	router.Use(obs.Middleware)
 	
-	// Health check
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"status": "healthy"})
-	}).Methods("GET")
+	// Health checks: /healthz is liveness only, /readyz runs dependency checks
+	checker := health.NewChecker("payment-service")
+	checker.AddCheck("nats", true, health.NATSCheck(paymentService.nats))
+	checker.AddCheck("ethereum", false, paymentService.checkEthereum)
+	router.HandleFunc("/healthz", checker.LivenessHandler).Methods("GET")
+	router.HandleFunc("/readyz", checker.ReadinessHandler).Methods("GET")
+	router.HandleFunc("/health", checker.ReadinessHandler).Methods("GET") // Legacy alias
 	
 	// Prometheus metrics
 	router.Handle("/metrics", promhttp.Handler())
 	
+	// Runtime logging control
+	router.HandleFunc("/admin/logging", authMiddleware(obs.Logging.Handler(isAdmin))).Methods("GET", "PUT")
+	
 	// API routes
 	api := router.PathPrefix("/api/v1").Subrouter()
 	
 	// Payment endpoints
 	api.HandleFunc("/payments", authMiddleware(paymentService.ProcessPayment)).Methods("POST")
 	api.HandleFunc("/payments/balance", authMiddleware(paymentService.GetBalance)).Methods("GET")
+	api.HandleFunc("/payments/holds", authMiddleware(paymentService.GetHolds)).Methods("GET")
 	api.HandleFunc("/payments", authMiddleware(paymentService.GetPaymentHistory)).Methods("GET")
 	api.HandleFunc("/payments/invoices", authMiddleware(paymentService.GetInvoices)).Methods("GET")
+	api.HandleFunc("/payments/invoices/approvals", authMiddleware(paymentService.GetPendingApprovals)).Methods("GET")
+	api.HandleFunc("/payments/invoices/{id}/po", authMiddleware(paymentService.SetInvoicePO)).Methods("PUT")
+	api.HandleFunc("/payments/invoices/{id}/submit", authMiddleware(paymentService.SubmitInvoice)).Methods("POST")
+	api.HandleFunc("/payments/invoices/{id}/approve", authMiddleware(paymentService.ApproveInvoice)).Methods("POST")
+	api.HandleFunc("/payments/invoices/{id}/reject", authMiddleware(paymentService.RejectInvoice)).Methods("POST")
+	api.HandleFunc("/payments/invoices/{id}/paid", authMiddleware(paymentService.MarkInvoicePaid)).Methods("POST")
+	api.HandleFunc("/payments/billing-profiles/{user_id}", authMiddleware(paymentService.GetBillingProfile)).Methods("GET")
+	api.HandleFunc("/payments/billing-profiles/{user_id}", authMiddleware(paymentService.UpdateBillingProfile)).Methods("PUT")
+	api.HandleFunc("/payments/usage", authMiddleware(paymentService.GetUsageReport)).Methods("GET")
+	api.HandleFunc("/payments/usage/tags", authMiddleware(paymentService.GetSpendByTag)).Methods("GET")
+	api.HandleFunc("/payments/orgs/{org}/digests", authMiddleware(paymentService.digests.ListDigests)).Methods("GET")
+	api.HandleFunc("/payments/orgs/{org}/digests/config", authMiddleware(paymentService.digests.GetDigestConfig)).Methods("GET")
+	api.HandleFunc("/payments/orgs/{org}/digests/config", authMiddleware(paymentService.digests.UpdateDigestConfig)).Methods("PUT")
+	api.HandleFunc("/payments/orgs/{org}/digests/preview", authMiddleware(paymentService.digests.PreviewDigest)).Methods("GET")
+	api.HandleFunc("/payments/orgs/{org}/digests/{id}", authMiddleware(paymentService.digests.GetDigest)).Methods("GET")
+	api.HandleFunc("/payments/ledger/snapshots", authMiddleware(paymentService.ListLedgerSnapshots)).Methods("GET")
+	api.HandleFunc("/payments/ledger/snapshots/{period}", authMiddleware(paymentService.GetLedgerSnapshot)).Methods("GET")
+	api.HandleFunc("/payments/ledger/verify", authMiddleware(paymentService.VerifyLedger)).Methods("GET")
 	api.HandleFunc("/payments/methods", authMiddleware(paymentService.AddPaymentMethod)).Methods("POST")
+	api.HandleFunc("/payments/methods", authMiddleware(paymentService.GetPaymentMethods)).Methods("GET")
+	api.HandleFunc("/payments/methods/{id}/verify", authMiddleware(paymentService.VerifyPaymentMethod)).Methods("POST")
+	api.HandleFunc("/payments/methods/{id}/verification", authMiddleware(paymentService.RestartVerification)).Methods("POST")
+	
+	// Sandbox endpoints exist only in sandbox environments
+	if paymentService.sandbox != nil {
+		api.HandleFunc("/sandbox", authMiddleware(paymentService.sandbox.GetSandbox)).Methods("GET")
+		api.HandleFunc("/sandbox/reset", authMiddleware(paymentService.sandbox.ResetSandbox)).Methods("POST")
+	}
 	
 	// CORS middleware
 	c := cors.New(cors.Options{
@@ -835,8 +1079,8 @@ func main() {
 		port = "8004"
 	}
 	
-	log.Printf("Payment service starting on port %s", port)
+	slog.Info("Payment service starting", "port", port)
 	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		obs.Fatal("Failed to start server", err)
 	}
 } 
\ No newline at end of file
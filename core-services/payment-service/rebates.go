@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/shopspring/decimal"
+)
+
+// settledMakerPeriod is the part of a marketplace market_maker.settled event
+// the payment service needs
+type settledMakerPeriod struct {
+	ID        string          `json:"id"`
+	AccountID string          `json:"account_id"`
+	Met       bool            `json:"met"`
+	Rebate    decimal.Decimal `json:"rebate"`
+	Currency  string          `json:"currency"`
+}
+
+// handleMakerSettled credits the fee rebate a market maker earned for a
+// settled obligation period to its balance, once per period
+func (s *PaymentService) handleMakerSettled(ctx context.Context, data []byte) error {
+	var period settledMakerPeriod
+	if err := json.Unmarshal(data, &period); err != nil {
+		return obs.Wrap(obs.CodeInvalidArgument, err)
+	}
+	if !period.Met || !period.Rebate.IsPositive() || period.ID == "" || period.AccountID == "" {
+		return nil
+	}
+	if period.Currency == "" {
+		period.Currency = "USD"
+	}
+
+	payment := &Payment{
+		ID:        generateID(),
+		UserID:    period.AccountID,
+		Type:      "rebate",
+		Amount:    period.Rebate,
+		Currency:  period.Currency,
+		Status:    "pending",
+		Reference: period.ID,
+		CreatedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	// Settlements are redelivered until acknowledged; credit each period once
+	for _, existing := range s.payments {
+		if existing.Type == "rebate" && existing.Reference == period.ID {
+			s.mu.Unlock()
+			return nil
+		}
+	}
+	s.payments[payment.ID] = payment
+	s.mu.Unlock()
+
+	slog.InfoContext(ctx, "Crediting market maker rebate", "period_id", period.ID, obs.KeyUserID, period.AccountID,
+		"amount", period.Rebate.String(), "currency", period.Currency)
+	go s.processPayment(payment)
+	return nil
+}
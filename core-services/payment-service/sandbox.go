@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/shopspring/decimal"
+)
+
+// sandboxFailures maps the cents of a payment amount to the failure code a
+// sandbox provider forces, in the style of card processor test numbers. A
+// deposit of 10.92 always fails with insufficient_funds.
+var sandboxFailures = map[int64]string{
+	91: "card_declined",
+	92: "insufficient_funds",
+	93: "network_timeout",
+	94: "tx_reverted",
+	95: "invalid_address",
+}
+
+// SandboxFixtures is the state a sandbox is seeded with
+type SandboxFixtures struct {
+	Balances        []*Balance        `json:"balances,omitempty"`
+	PaymentMethods  []*PaymentMethod  `json:"payment_methods,omitempty"`
+	Payments        []*Payment        `json:"payments,omitempty"`
+	Invoices        []*Invoice        `json:"invoices,omitempty"`
+	BillingProfiles []*BillingProfile `json:"billing_profiles,omitempty"`
+}
+
+// Sandbox swaps the blockchain and fiat providers for deterministic fakes so
+// billing flows can be tested without real chains or card processors.
+//
+// It is enabled per environment with PAYMENT_SANDBOX=true. Payments confirm
+// instantly unless their amount forces a failure code (see sandboxFailures).
+// Transaction references derive from PAYMENT_SANDBOX_SEED and a call counter,
+// so replaying the same requests after a reset yields the same references.
+// Bank accounts are always sent micro-deposits of 0.32 and 0.45.
+// PAYMENT_SANDBOX_FIXTURES names a JSON fixture file loaded at startup and on
+// reset.
+type Sandbox struct {
+	service  *PaymentService
+	seed     string
+	fixtures string
+	calls    uint64
+	mu       sync.Mutex
+}
+
+// sandboxEnabled reports whether this environment runs the payment sandbox
+func sandboxEnabled() bool {
+	return os.Getenv("PAYMENT_SANDBOX") == "true"
+}
+
+// NewSandbox creates the sandbox from the environment
+func NewSandbox(s *PaymentService) *Sandbox {
+	seed := os.Getenv("PAYMENT_SANDBOX_SEED")
+	if seed == "" {
+		seed = "computehive-sandbox"
+	}
+	return &Sandbox{
+		service:  s,
+		seed:     seed,
+		fixtures: os.Getenv("PAYMENT_SANDBOX_FIXTURES"),
+	}
+}
+
+// Providers returns the fake chain and fiat providers
+func (sb *Sandbox) Providers() (chain PaymentProvider, fiat PaymentProvider) {
+	return &sandboxProvider{sandbox: sb, rail: "chain"}, &sandboxProvider{sandbox: sb, rail: "fiat"}
+}
+
+// reference derives a deterministic transaction reference for a call
+func (sb *Sandbox) reference(rail, operation string, payment *Payment) string {
+	sb.mu.Lock()
+	sb.calls++
+	call := sb.calls
+	sb.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%d|%s|%s|%s|%s",
+		sb.seed, rail, operation, call, payment.UserID, payment.Amount.String(), payment.Currency, payment.JobID)))
+	if rail == "fiat" {
+		return "sbx_" + hex.EncodeToString(sum[:12])
+	}
+	return "0x" + hex.EncodeToString(sum[:])
+}
+
+// forcedFailure returns the failure code a payment's amount forces, if any
+func forcedFailure(amount decimal.Decimal) string {
+	cents := amount.Mul(decimal.NewFromInt(100)).Truncate(0).IntPart() % 100
+	return sandboxFailures[cents]
+}
+
+// Reset clears all payment state and loads fixtures. With no fixtures given,
+// the fixture file is loaded if configured.
+func (sb *Sandbox) Reset(fixtures *SandboxFixtures) error {
+	if fixtures == nil && sb.fixtures != "" {
+		data, err := os.ReadFile(sb.fixtures)
+		if err != nil {
+			return fmt.Errorf("failed to read fixtures: %w", err)
+		}
+		fixtures = &SandboxFixtures{}
+		if err := json.Unmarshal(data, fixtures); err != nil {
+			return fmt.Errorf("failed to parse fixtures: %w", err)
+		}
+	}
+
+	s := sb.service
+	s.mu.Lock()
+	s.payments = make(map[string]*Payment)
+	s.invoices = make(map[string]*Invoice)
+	s.balances = make(map[string]*Balance)
+	s.paymentMethods = make(map[string][]*PaymentMethod)
+	s.billingProfiles = make(map[string]*BillingProfile)
+	s.holds = make(map[string]*BalanceHold)
+	s.snapshots = nil
+
+	if fixtures != nil {
+		for _, balance := range fixtures.Balances {
+			if balance.Available == nil {
+				balance.Available = make(map[string]decimal.Decimal)
+			}
+			if balance.Pending == nil {
+				balance.Pending = make(map[string]decimal.Decimal)
+			}
+			if balance.Reserved == nil {
+				balance.Reserved = make(map[string]decimal.Decimal)
+			}
+			s.balances[balance.UserID] = balance
+		}
+		for _, method := range fixtures.PaymentMethods {
+			// Fixtures may seed verified methods; others start verification
+			if method.Verification == "" {
+				method.Verification = verificationNotRequired
+				if requiresVerification(method.Type) {
+					s.startVerification(method)
+				}
+			}
+			s.paymentMethods[method.UserID] = append(s.paymentMethods[method.UserID], method)
+		}
+		for _, payment := range fixtures.Payments {
+			s.payments[payment.ID] = payment
+		}
+		for _, invoice := range fixtures.Invoices {
+			s.invoices[invoice.ID] = invoice
+		}
+		for _, profile := range fixtures.BillingProfiles {
+			s.billingProfiles[profile.UserID] = profile
+		}
+	}
+	s.mu.Unlock()
+
+	sb.mu.Lock()
+	sb.calls = 0
+	sb.mu.Unlock()
+
+	return nil
+}
+
+// sandboxProvider is a deterministic fake payment rail
+type sandboxProvider struct {
+	sandbox *Sandbox
+	rail    string
+}
+
+func (p *sandboxProvider) settle(operation string, payment *Payment) (string, error) {
+	if code := forcedFailure(payment.Amount); code != "" {
+		return "", fmt.Errorf("sandbox %s %s failed: %s", p.rail, operation, code)
+	}
+	return p.sandbox.reference(p.rail, operation, payment), nil
+}
+
+func (p *sandboxProvider) Deposit(ctx context.Context, payment *Payment) (string, error) {
+	return p.settle("deposit", payment)
+}
+
+func (p *sandboxProvider) Withdraw(ctx context.Context, payment *Payment) (string, error) {
+	return p.settle("withdrawal", payment)
+}
+
+func (p *sandboxProvider) ChargeJob(ctx context.Context, payment *Payment) (string, error) {
+	return p.settle("job_payment", payment)
+}
+
+func (p *sandboxProvider) Check(ctx context.Context) error {
+	return nil
+}
+
+// HTTP Handlers
+
+// GetSandbox describes the sandbox configuration and forced failure amounts
+func (sb *Sandbox) GetSandbox(w http.ResponseWriter, r *http.Request) {
+	cents := make([]int64, 0, len(sandboxFailures))
+	for c := range sandboxFailures {
+		cents = append(cents, c)
+	}
+	sort.Slice(cents, func(i, j int) bool { return cents[i] < cents[j] })
+
+	failures := make([]map[string]string, 0, len(cents))
+	for _, c := range cents {
+		failures = append(failures, map[string]string{
+			"amount_cents": fmt.Sprintf(".%02d", c),
+			"code":         sandboxFailures[c],
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"enabled":       true,
+		"seed":          sb.seed,
+		"fixtures_file": sb.fixtures,
+		"failure_codes": failures,
+	})
+}
+
+// ResetSandbox clears all payment state and seeds it with the fixtures in the
+// request body, or with the fixture file when the body is empty
+func (sb *Sandbox) ResetSandbox(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var fixtures *SandboxFixtures
+	if len(body) > 0 {
+		fixtures = &SandboxFixtures{}
+		if err := json.Unmarshal(body, fixtures); err != nil {
+			http.Error(w, "Invalid fixtures", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := sb.Reset(fixtures); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.WarnContext(r.Context(), "Payment sandbox reset")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Usage report periods
+const (
+	periodCurrentMonth = "current_month"
+	periodLastMonth    = "last_month"
+	periodLast7Days    = "last_7_days"
+	periodLast30Days   = "last_30_days"
+	periodCustom       = "custom"
+)
+
+// maxUsageReportDays bounds custom usage report ranges
+const maxUsageReportDays = 366
+
+// unknownJobType groups charges recorded before job types were tracked
+const unknownJobType = "unknown"
+
+// UsageReport aggregates a user's metered job usage over a period
+type UsageReport struct {
+	UserID         string            `json:"user_id"`
+	Period         string            `json:"period"`
+	PeriodStart    time.Time         `json:"period_start"`
+	PeriodEnd      time.Time         `json:"period_end"`
+	Currency       string            `json:"currency"`
+	ComputeCost    decimal.Decimal   `json:"compute_cost"`
+	ComputeHours   float64           `json:"compute_hours"`
+	Jobs           int               `json:"jobs"`
+	DailyBreakdown []DailyUsage      `json:"daily_breakdown"`
+	JobTypeCosts   []JobTypeCost     `json:"job_type_costs"`
+	Projections    *UsageProjections `json:"projections,omitempty"` // Only for periods still in progress
+}
+
+// DailyUsage is the usage charged on one UTC day
+type DailyUsage struct {
+	Date         string          `json:"date"` // YYYY-MM-DD
+	Cost         decimal.Decimal `json:"cost"`
+	ComputeHours float64         `json:"compute_hours"`
+	Jobs         int             `json:"jobs"`
+}
+
+// JobTypeCost is the usage charged for one job type
+type JobTypeCost struct {
+	JobType      string          `json:"job_type"`
+	Cost         decimal.Decimal `json:"cost"`
+	ComputeHours float64         `json:"compute_hours"`
+	Jobs         int             `json:"jobs"`
+	Percent      float64         `json:"percent"` // Share of the period's compute cost
+}
+
+// UsageProjections extrapolates spend from the period's daily average so far
+type UsageProjections struct {
+	DailyAverage       decimal.Decimal `json:"daily_average"`
+	ProjectedPeriodEnd decimal.Decimal `json:"projected_period_end"` // Total expected by the end of the period
+	ProjectedMonthly   decimal.Decimal `json:"projected_monthly"`    // 30 days at the daily average
+}
+
+// GetUsageReport returns the caller's job usage with a daily breakdown, costs
+// per job type and spend projections, as JSON or CSV.
+// Query: period=current_month|last_month|last_7_days|last_30_days or
+// start=<RFC3339>&end=<RFC3339>, format=json|csv
+func (s *PaymentService) GetUsageReport(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	query := r.URL.Query()
+
+	period, start, end, err := usagePeriod(query.Get("period"), query.Get("start"), query.Get("end"), time.Now().UTC())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" && strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		format = "csv"
+	}
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	var payments []*Payment
+	for _, payment := range s.payments {
+		if isBillableJobPayment(payment, claims.UserID, start, end) {
+			payments = append(payments, payment)
+		}
+	}
+	s.mu.RUnlock()
+
+	report := buildUsageReport(claims.UserID, period, start, end, payments, time.Now().UTC())
+
+	if format == "csv" {
+		writeUsageCSV(w, report)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// usagePeriod resolves a named period or an explicit start and end into a
+// half-open UTC range
+func usagePeriod(period, startParam, endParam string, now time.Time) (string, time.Time, time.Time, error) {
+	if startParam != "" || endParam != "" {
+		if period != "" && period != periodCustom {
+			return "", time.Time{}, time.Time{}, fmt.Errorf("period and start/end are mutually exclusive")
+		}
+		start, err := time.Parse(time.RFC3339, startParam)
+		if err != nil {
+			return "", time.Time{}, time.Time{}, fmt.Errorf("invalid or missing start time")
+		}
+		end := now
+		if endParam != "" {
+			if end, err = time.Parse(time.RFC3339, endParam); err != nil {
+				return "", time.Time{}, time.Time{}, fmt.Errorf("invalid end time")
+			}
+		}
+		if !end.After(start) {
+			return "", time.Time{}, time.Time{}, fmt.Errorf("end must be after start")
+		}
+		if end.Sub(start) > maxUsageReportDays*24*time.Hour {
+			return "", time.Time{}, time.Time{}, fmt.Errorf("range must not exceed %d days", maxUsageReportDays)
+		}
+		return periodCustom, start.UTC(), end.UTC(), nil
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	switch period {
+	case "", periodCurrentMonth:
+		return periodCurrentMonth, monthStart, monthStart.AddDate(0, 1, 0), nil
+	case periodLastMonth:
+		return periodLastMonth, monthStart.AddDate(0, -1, 0), monthStart, nil
+	case periodLast7Days:
+		return periodLast7Days, today.AddDate(0, 0, -6), today.AddDate(0, 0, 1), nil
+	case periodLast30Days:
+		return periodLast30Days, today.AddDate(0, 0, -29), today.AddDate(0, 0, 1), nil
+	}
+	return "", time.Time{}, time.Time{}, fmt.Errorf("unknown period %q: use %s, %s, %s or %s, or start and end",
+		period, periodCurrentMonth, periodLastMonth, periodLast7Days, periodLast30Days)
+}
+
+// buildUsageReport aggregates job payments into a usage report. Every day of
+// the period up to now appears in the daily breakdown, including days
+// without usage.
+func buildUsageReport(userID, period string, start, end time.Time, payments []*Payment, now time.Time) *UsageReport {
+	report := &UsageReport{
+		UserID:         userID,
+		Period:         period,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+		Currency:       "USD",
+		ComputeCost:    decimal.Zero,
+		DailyBreakdown: []DailyUsage{},
+	}
+
+	last := end
+	if now.Before(last) {
+		last = now
+	}
+	days := make(map[string]*DailyUsage)
+	for day := start.Truncate(24 * time.Hour); day.Before(last); day = day.AddDate(0, 0, 1) {
+		report.DailyBreakdown = append(report.DailyBreakdown, DailyUsage{Date: day.Format("2006-01-02"), Cost: decimal.Zero})
+	}
+	for i := range report.DailyBreakdown {
+		days[report.DailyBreakdown[i].Date] = &report.DailyBreakdown[i]
+	}
+
+	types := make(map[string]*JobTypeCost)
+	for _, payment := range payments {
+		report.ComputeCost = report.ComputeCost.Add(payment.Amount)
+		report.ComputeHours += payment.ComputeHours
+		report.Jobs++
+
+		if day, ok := days[payment.CreatedAt.UTC().Format("2006-01-02")]; ok {
+			day.Cost = day.Cost.Add(payment.Amount)
+			day.ComputeHours += payment.ComputeHours
+			day.Jobs++
+		}
+
+		jobType := payment.JobType
+		if jobType == "" {
+			jobType = unknownJobType
+		}
+		typeCost, exists := types[jobType]
+		if !exists {
+			typeCost = &JobTypeCost{JobType: jobType, Cost: decimal.Zero}
+			types[jobType] = typeCost
+		}
+		typeCost.Cost = typeCost.Cost.Add(payment.Amount)
+		typeCost.ComputeHours += payment.ComputeHours
+		typeCost.Jobs++
+	}
+
+	report.JobTypeCosts = make([]JobTypeCost, 0, len(types))
+	for _, typeCost := range types {
+		if report.ComputeCost.IsPositive() {
+			typeCost.Percent, _ = typeCost.Cost.Div(report.ComputeCost).Mul(decimal.NewFromInt(100)).Round(1).Float64()
+		}
+		report.JobTypeCosts = append(report.JobTypeCosts, *typeCost)
+	}
+	sort.Slice(report.JobTypeCosts, func(i, j int) bool {
+		return report.JobTypeCosts[i].Cost.GreaterThan(report.JobTypeCosts[j].Cost)
+	})
+
+	// Completed periods have nothing left to project
+	if now.After(start) && now.Before(end) {
+		elapsedDays := decimal.NewFromFloat(now.Sub(start).Hours() / 24)
+		if elapsedDays.LessThan(decimal.NewFromInt(1)) {
+			elapsedDays = decimal.NewFromInt(1)
+		}
+		dailyAverage := report.ComputeCost.Div(elapsedDays)
+		remainingDays := decimal.NewFromFloat(end.Sub(now).Hours() / 24)
+		report.Projections = &UsageProjections{
+			DailyAverage:       dailyAverage.Round(2),
+			ProjectedPeriodEnd: report.ComputeCost.Add(dailyAverage.Mul(remainingDays)).Round(2),
+			ProjectedMonthly:   dailyAverage.Mul(decimal.NewFromInt(30)).Round(2),
+		}
+	}
+
+	return report
+}
+
+// writeUsageCSV exports a report's daily breakdown as CSV
+func writeUsageCSV(w http.ResponseWriter, report *UsageReport) {
+	filename := fmt.Sprintf("usage-%s-%s.csv", report.PeriodStart.Format("20060102"), report.PeriodEnd.Format("20060102"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"date", "jobs", "compute_hours", "cost", "currency"})
+	for _, day := range report.DailyBreakdown {
+		out.Write([]string{
+			day.Date,
+			strconv.Itoa(day.Jobs),
+			strconv.FormatFloat(day.ComputeHours, 'f', 2, 64),
+			day.Cost.StringFixed(2),
+			report.Currency,
+		})
+	}
+	out.Write([]string{"total", strconv.Itoa(report.Jobs), strconv.FormatFloat(report.ComputeHours, 'f', 2, 64),
+		report.ComputeCost.StringFixed(2), report.Currency})
+	out.Flush()
+}
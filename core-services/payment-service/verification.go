@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+// Payment method verification states
+const (
+	verificationPending     = "pending"
+	verificationVerified    = "verified"
+	verificationFailed      = "failed"
+	verificationNotRequired = "not_required"
+	verificationLocked      = "locked" // Restarted too often; support has to unlock it
+)
+
+const (
+	// maxVerificationAttempts is how many wrong answers fail a verification
+	maxVerificationAttempts = 3
+	// walletChallengeTTL is how long a wallet has to sign its challenge
+	walletChallengeTTL = 24 * time.Hour
+	// microDepositTTL is how long micro-deposits can be confirmed; bank
+	// transfers take a few business days to arrive
+	microDepositTTL = 10 * 24 * time.Hour
+	// maxVerificationRestarts is how many times a failed or expired
+	// verification can be restarted before the method is locked
+	maxVerificationRestarts = 3
+	// verificationRestartCooldown is how long after a verification starts it
+	// can be restarted, so micro-deposits cannot be sent in a loop
+	verificationRestartCooldown = time.Hour
+)
+
+// sandboxMicroDeposits are the fixed micro-deposit amounts in the sandbox, so
+// tests can confirm bank accounts without reading statements
+var sandboxMicroDeposits = []string{"0.32", "0.45"}
+
+// requiresVerification reports whether funds can be withdrawn to a method
+// type, and so whether it must be verified first
+func requiresVerification(methodType string) bool {
+	return methodType == "crypto_wallet" || methodType == "bank_account"
+}
+
+// startVerification issues a new wallet challenge or sends new
+// micro-deposits, resetting attempts. Callers hold the service lock.
+func (s *PaymentService) startVerification(method *PaymentMethod) {
+	method.Verification = verificationPending
+	method.VerificationAttempts = 0
+	method.VerificationError = ""
+	method.VerifiedAt = nil
+	now := time.Now()
+	method.VerificationStartedAt = &now
+
+	switch method.Type {
+	case "crypto_wallet":
+		method.Challenge = fmt.Sprintf("ComputeHive wallet verification\nAddress: %s\nMethod: %s\nNonce: %s",
+			walletAddress(method), method.ID, randomHex(16))
+		expires := time.Now().Add(walletChallengeTTL)
+		method.VerificationExpiresAt = &expires
+	case "bank_account":
+		method.Challenge = ""
+		method.microDeposits = s.microDepositAmounts()
+		expires := time.Now().Add(microDepositTTL)
+		method.VerificationExpiresAt = &expires
+		go s.sendMicroDeposits(method.UserID, method.ID, method.microDeposits)
+	}
+}
+
+// microDepositAmounts picks two distinct amounts between 0.01 and 0.99
+func (s *PaymentService) microDepositAmounts() []decimal.Decimal {
+	if s.sandbox != nil {
+		amounts := make([]decimal.Decimal, len(sandboxMicroDeposits))
+		for i, amount := range sandboxMicroDeposits {
+			amounts[i] = decimal.RequireFromString(amount)
+		}
+		return amounts
+	}
+
+	first := randomCents()
+	second := randomCents()
+	for second == first {
+		second = randomCents()
+	}
+	return []decimal.Decimal{decimal.New(first, -2), decimal.New(second, -2)}
+}
+
+// sendMicroDeposits pays the micro-deposits to a bank account through the
+// fiat provider, failing the verification if the bank rejects them
+func (s *PaymentService) sendMicroDeposits(userID, methodID string, amounts []decimal.Decimal) {
+	for _, amount := range amounts {
+		deposit := &Payment{
+			ID:              generateID(),
+			UserID:          userID,
+			Type:            "micro_deposit",
+			Amount:          amount,
+			Currency:        "USD",
+			Status:          "processing",
+			ToAddress:       methodID,
+			PaymentMethodID: methodID,
+			CreatedAt:       time.Now(),
+		}
+		if _, err := s.fiat.Withdraw(context.Background(), deposit); err != nil {
+			slog.Error("Micro-deposit failed", "payment_method_id", methodID, obs.KeyUserID, userID, obs.KeyError, err)
+			s.mu.Lock()
+			if method := s.findPaymentMethod(userID, methodID); method != nil && method.Verification == verificationPending {
+				method.Verification = verificationFailed
+				method.VerificationError = "micro-deposits could not be sent to this account"
+			}
+			s.mu.Unlock()
+			return
+		}
+	}
+}
+
+// findPaymentMethod returns one of a user's payment methods. Callers hold the
+// service lock.
+func (s *PaymentService) findPaymentMethod(userID, methodID string) *PaymentMethod {
+	for _, method := range s.paymentMethods[userID] {
+		if method.ID == methodID {
+			return method
+		}
+	}
+	return nil
+}
+
+// withdrawalDestination resolves and checks the payment method a withdrawal
+// pays out to: the given one, or the user's default. Callers hold the service
+// lock.
+func (s *PaymentService) withdrawalDestination(userID, methodID string) (*PaymentMethod, error) {
+	var method *PaymentMethod
+	if methodID != "" {
+		method = s.findPaymentMethod(userID, methodID)
+	} else {
+		for _, m := range s.paymentMethods[userID] {
+			if m.IsDefault {
+				method = m
+			}
+		}
+	}
+	switch {
+	case method == nil:
+		return nil, obs.Errorf(obs.CodeInvalidArgument, "withdrawals need a payment method: add a crypto wallet or bank account")
+	case !requiresVerification(method.Type):
+		return nil, obs.Errorf(obs.CodeInvalidArgument, "cannot withdraw to a %s, use a crypto wallet or bank account", method.Type)
+	case method.Verification != verificationVerified:
+		return nil, obs.Errorf(obs.CodeFailedPrecondition, "payment method %s is not verified", method.ID)
+	}
+	return method, nil
+}
+
+// verifyWalletSignature checks that a personal_sign signature of the
+// challenge was made by the wallet's address
+func verifyWalletSignature(method *PaymentMethod, signature string) bool {
+	sig, err := hexutil.Decode(signature)
+	if err != nil || len(sig) != crypto.SignatureLength {
+		return false
+	}
+	// Wallets return the recovery ID as 27/28
+	if sig[crypto.RecoveryIDOffset] >= 27 {
+		sig[crypto.RecoveryIDOffset] -= 27
+	}
+	pub, err := crypto.SigToPub(accounts.TextHash([]byte(method.Challenge)), sig)
+	if err != nil {
+		return false
+	}
+	return crypto.PubkeyToAddress(*pub) == common.HexToAddress(walletAddress(method))
+}
+
+// matchesMicroDeposits reports whether the confirmed amounts are the
+// micro-deposits sent, in any order
+func matchesMicroDeposits(sent []decimal.Decimal, confirmed []string) bool {
+	if len(confirmed) != len(sent) {
+		return false
+	}
+	used := make([]bool, len(sent))
+	for _, value := range confirmed {
+		amount, err := decimal.NewFromString(strings.TrimSpace(value))
+		if err != nil {
+			return false
+		}
+		found := false
+		for i, deposit := range sent {
+			if !used[i] && deposit.Equal(amount) {
+				used[i], found = true, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// walletAddress returns a crypto wallet's address from its details
+func walletAddress(method *PaymentMethod) string {
+	address, _ := method.Details["address"].(string)
+	return address
+}
+
+func randomCents() int64 {
+	n, err := rand.Int(rand.Reader, big.NewInt(99))
+	if err != nil {
+		return 1
+	}
+	return n.Int64() + 1
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// HTTP Handlers
+
+// GetPaymentMethods lists the caller's payment methods and their verification
+func (s *PaymentService) GetPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	s.mu.RLock()
+	methods := make([]PaymentMethod, 0, len(s.paymentMethods[claims.UserID]))
+	for _, method := range s.paymentMethods[claims.UserID] {
+		methods = append(methods, *method)
+	}
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(methods)
+}
+
+// VerifyPaymentMethod completes a payment method's verification: a wallet
+// signs its challenge ({"signature": "0x..."}) and a bank account confirms its
+// micro-deposits ({"amounts": ["0.32", "0.45"]})
+func (s *PaymentService) VerifyPaymentMethod(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	methodID := mux.Vars(r)["id"]
+
+	var req struct {
+		Signature string   `json:"signature,omitempty"`
+		Amounts   []string `json:"amounts,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	method := s.findPaymentMethod(claims.UserID, methodID)
+	if method == nil {
+		http.Error(w, "Payment method not found", http.StatusNotFound)
+		return
+	}
+	if method.Verification != verificationPending {
+		http.Error(w, fmt.Sprintf("Payment method verification is %s", method.Verification), http.StatusConflict)
+		return
+	}
+	if method.VerificationExpiresAt != nil && time.Now().After(*method.VerificationExpiresAt) {
+		method.Verification = verificationFailed
+		method.VerificationError = "verification expired"
+		http.Error(w, "Verification expired; restart it to try again", http.StatusConflict)
+		return
+	}
+
+	var ok bool
+	switch method.Type {
+	case "crypto_wallet":
+		ok = verifyWalletSignature(method, req.Signature)
+	case "bank_account":
+		ok = matchesMicroDeposits(method.microDeposits, req.Amounts)
+	}
+
+	if !ok {
+		method.VerificationAttempts++
+		if method.VerificationAttempts >= maxVerificationAttempts {
+			method.Verification = verificationFailed
+			method.VerificationError = "too many failed attempts"
+		}
+		slog.WarnContext(r.Context(), "Payment method verification failed", "payment_method_id", method.ID,
+			"type", method.Type, "attempts", method.VerificationAttempts)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(method)
+		return
+	}
+
+	now := time.Now()
+	method.Verification = verificationVerified
+	method.VerifiedAt = &now
+	method.VerificationExpiresAt = nil
+	method.Challenge = ""
+	method.microDeposits = nil
+	slog.InfoContext(r.Context(), "Payment method verified", "payment_method_id", method.ID, "type", method.Type)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(method)
+}
+
+// RestartVerification issues a new challenge or new micro-deposits for a
+// payment method whose verification failed or expired. Restarts wait out a
+// cooldown, and the method is locked once they run out.
+func (s *PaymentService) RestartVerification(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	methodID := mux.Vars(r)["id"]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	method := s.findPaymentMethod(claims.UserID, methodID)
+	if method == nil {
+		http.Error(w, "Payment method not found", http.StatusNotFound)
+		return
+	}
+	if !requiresVerification(method.Type) || method.Verification == verificationVerified || method.Verification == verificationLocked {
+		http.Error(w, fmt.Sprintf("Payment method verification is %s", method.Verification), http.StatusConflict)
+		return
+	}
+	expired := method.VerificationExpiresAt != nil && time.Now().After(*method.VerificationExpiresAt)
+	if method.Verification == verificationPending && !expired {
+		http.Error(w, "Verification is still pending", http.StatusConflict)
+		return
+	}
+	if method.VerificationStartedAt != nil {
+		if wait := time.Until(method.VerificationStartedAt.Add(verificationRestartCooldown)); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			http.Error(w, "Verification was restarted recently; try again later", http.StatusTooManyRequests)
+			return
+		}
+	}
+	if method.VerificationRestarts >= maxVerificationRestarts {
+		method.Verification = verificationLocked
+		method.VerificationError = "too many verification restarts; contact support"
+		slog.WarnContext(r.Context(), "Payment method verification locked", "payment_method_id", method.ID,
+			"type", method.Type, "restarts", method.VerificationRestarts)
+		http.Error(w, "Payment method is locked after too many verification restarts; contact support", http.StatusForbidden)
+		return
+	}
+
+	method.VerificationRestarts++
+	s.startVerification(method)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(method)
+}
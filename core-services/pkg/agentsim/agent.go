@@ -0,0 +1,424 @@
+package agentsim
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/protocol"
+	"github.com/nats-io/nats.go"
+)
+
+const mebibyte = 1024 * 1024
+
+// Agent is one simulated agent
+type Agent struct {
+	fleet    *Fleet
+	id       string
+	spec     Spec
+	gpuInUse []bool
+	running  map[string]*runningJob
+	used     requirements // Resources held by running jobs
+	accepted int
+	online   bool
+	subs     []*nats.Subscription
+	stats    Stats
+	mu       sync.Mutex
+}
+
+// requirements is the part of an assigned job an agent reserves
+type requirements struct {
+	CPUCores  int    `json:"cpu_cores"`
+	MemoryMB  int    `json:"memory_mb"`
+	GPUCount  int    `json:"gpu_count"`
+	GPUType   string `json:"gpu_type"`
+	StorageMB int    `json:"storage_mb"`
+}
+
+type runningJob struct {
+	requirements requirements
+	gpus         []int
+	startedAt    time.Time
+	cancel       chan struct{}
+}
+
+// assignment is the request the scheduler sends on agent.<id>.assign
+type assignment struct {
+	JobID string `json:"job_id"`
+	Job   struct {
+		Requirements requirements `json:"requirements"`
+	} `json:"job"`
+}
+
+// jobResult is the outcome an agent reports on job.result
+type jobResult struct {
+	ProtocolVersion int       `json:"protocol_version"`
+	JobID           string    `json:"job_id"`
+	AgentID         string    `json:"agent_id"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	ExitCode        int       `json:"exit_code"`
+	StartedAt       time.Time `json:"started_at"`
+	FinishedAt      time.Time `json:"finished_at"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+func newAgent(fleet *Fleet, id string, spec Spec) *Agent {
+	return &Agent{
+		fleet:    fleet,
+		id:       id,
+		spec:     spec,
+		gpuInUse: make([]bool, len(spec.GPUs)),
+		running:  make(map[string]*runningJob),
+	}
+}
+
+// ID returns the agent's ID
+func (a *Agent) ID() string {
+	return a.id
+}
+
+// Spec returns the agent's spec
+func (a *Agent) Spec() Spec {
+	return a.spec
+}
+
+// Stats returns what the agent did so far
+func (a *Agent) Stats() Stats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stats
+}
+
+// RunningJobs returns the IDs of the jobs the agent is running
+func (a *Agent) RunningJobs() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.runningJobIDs()
+}
+
+// Crash takes the agent offline: it stops heartbeating and answering, and
+// abandons its running jobs without reporting results
+func (a *Agent) Crash() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, sub := range a.subs {
+		sub.Unsubscribe()
+	}
+	a.subs = nil
+	a.online = false
+	for jobID, job := range a.running {
+		close(job.cancel)
+		a.release(jobID)
+	}
+}
+
+// Restore brings a crashed agent back online with no running jobs
+func (a *Agent) Restore() error {
+	return a.start()
+}
+
+func (a *Agent) start() error {
+	a.mu.Lock()
+	if a.online {
+		a.mu.Unlock()
+		return nil
+	}
+	nc := a.fleet.nc
+	assignSub, err := nc.Subscribe(fmt.Sprintf("agent.%s.assign", a.id), a.handleAssign)
+	if err != nil {
+		a.mu.Unlock()
+		return err
+	}
+	cancelSub, err := nc.Subscribe(fmt.Sprintf("agent.%s.job.cancel", a.id), a.handleCancel)
+	if err != nil {
+		assignSub.Unsubscribe()
+		a.mu.Unlock()
+		return err
+	}
+	a.subs = []*nats.Subscription{assignSub, cancelSub}
+	a.online = true
+	a.mu.Unlock()
+
+	a.sendHeartbeat()
+	return nil
+}
+
+func (a *Agent) handleAssign(msg *nats.Msg) {
+	a.mu.Lock()
+	a.stats.Assignments++
+	a.mu.Unlock()
+
+	if a.spec.Failure.Unresponsive {
+		return
+	}
+	if a.spec.AssignLatency > 0 {
+		time.Sleep(a.spec.AssignLatency)
+	}
+
+	var req assignment
+	if err := json.Unmarshal(msg.Data, &req); err != nil || req.JobID == "" {
+		a.reject(msg)
+		return
+	}
+	if a.fleet.chance(a.spec.Failure.RejectRate) {
+		a.reject(msg)
+		return
+	}
+
+	a.mu.Lock()
+	job, ok := a.allocate(req.JobID, req.Job.Requirements)
+	if !ok {
+		a.mu.Unlock()
+		a.reject(msg)
+		return
+	}
+	a.stats.Accepted++
+	a.accepted++
+	crash := a.spec.Failure.CrashAfter > 0 && a.accepted >= a.spec.Failure.CrashAfter
+	a.mu.Unlock()
+
+	a.fleet.recordPlacement(req.JobID, a.id)
+	respond(msg, true)
+
+	if crash {
+		a.Crash()
+		return
+	}
+	go a.run(req.JobID, job)
+}
+
+func (a *Agent) reject(msg *nats.Msg) {
+	a.mu.Lock()
+	a.stats.Rejected++
+	a.mu.Unlock()
+	respond(msg, false)
+}
+
+func respond(msg *nats.Msg, accepted bool) {
+	data, _ := json.Marshal(map[string]bool{"accepted": accepted})
+	msg.Respond(data)
+}
+
+func (a *Agent) handleCancel(msg *nats.Msg) {
+	var req struct {
+		JobID string `json:"job_id"`
+	}
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	job, ok := a.running[req.JobID]
+	if ok {
+		close(job.cancel)
+		a.release(req.JobID)
+		a.stats.Cancelled++
+	}
+	a.mu.Unlock()
+
+	if ok {
+		a.fleet.recordFinished(req.JobID, "cancelled")
+		a.sendHeartbeat()
+	}
+}
+
+// run holds a job's resources for the spec's run time, then reports it
+func (a *Agent) run(jobID string, job *runningJob) {
+	select {
+	case <-job.cancel:
+		return
+	case <-time.After(a.spec.RunTime):
+	}
+
+	result := jobResult{
+		JobID:      jobID,
+		AgentID:    a.id,
+		Status:     "completed",
+		StartedAt:  job.startedAt,
+		FinishedAt: time.Now(),
+		Timestamp:  time.Now(),
+	}
+	if a.fleet.chance(a.spec.Failure.FailRate) {
+		result.Status = "failed"
+		result.Error = "simulated failure"
+		result.ExitCode = 1
+	}
+
+	a.mu.Lock()
+	// Crashed or cancelled while finishing
+	if a.running[jobID] != job {
+		a.mu.Unlock()
+		return
+	}
+	a.release(jobID)
+	if result.Status == "failed" {
+		a.stats.Failed++
+	} else {
+		a.stats.Completed++
+	}
+	a.mu.Unlock()
+
+	if err := a.fleet.publishResult(result); err == nil {
+		a.fleet.recordFinished(jobID, result.Status)
+	}
+	a.sendHeartbeat()
+}
+
+// allocate reserves a job's requirements if they fit. Callers hold a.mu.
+func (a *Agent) allocate(jobID string, req requirements) (*runningJob, bool) {
+	if !a.online {
+		return nil, false
+	}
+	if _, exists := a.running[jobID]; exists {
+		return nil, false
+	}
+	if a.used.CPUCores+req.CPUCores > a.spec.CPUCores ||
+		a.used.MemoryMB+req.MemoryMB > a.spec.MemoryMB ||
+		a.used.StorageMB+req.StorageMB > a.spec.StorageMB {
+		return nil, false
+	}
+
+	var gpus []int
+	for i, gpu := range a.spec.GPUs {
+		if len(gpus) == req.GPUCount {
+			break
+		}
+		if !a.gpuInUse[i] && (req.GPUType == "" || gpu.Model == req.GPUType) {
+			gpus = append(gpus, i)
+		}
+	}
+	if len(gpus) < req.GPUCount {
+		return nil, false
+	}
+
+	for _, i := range gpus {
+		a.gpuInUse[i] = true
+	}
+	a.used.CPUCores += req.CPUCores
+	a.used.MemoryMB += req.MemoryMB
+	a.used.StorageMB += req.StorageMB
+
+	job := &runningJob{requirements: req, gpus: gpus, startedAt: time.Now(), cancel: make(chan struct{})}
+	a.running[jobID] = job
+	return job, true
+}
+
+// release frees a running job's resources. Callers hold a.mu.
+func (a *Agent) release(jobID string) {
+	job, ok := a.running[jobID]
+	if !ok {
+		return
+	}
+	for _, i := range job.gpus {
+		a.gpuInUse[i] = false
+	}
+	a.used.CPUCores -= job.requirements.CPUCores
+	a.used.MemoryMB -= job.requirements.MemoryMB
+	a.used.StorageMB -= job.requirements.StorageMB
+	delete(a.running, jobID)
+}
+
+func (a *Agent) runningJobIDs() []string {
+	ids := make([]string, 0, len(a.running))
+	for id := range a.running {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (a *Agent) sendHeartbeat() {
+	a.mu.Lock()
+	if !a.online {
+		a.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(a.heartbeat())
+	a.mu.Unlock()
+	if err != nil {
+		return
+	}
+	a.fleet.nc.Publish("agent.heartbeat", data)
+}
+
+// heartbeat builds a heartbeat in the agent's wire format: memory and
+// storage in bytes, utilization in percent. Callers hold a.mu.
+func (a *Agent) heartbeat() map[string]interface{} {
+	spec := a.spec
+
+	gpus := make([]map[string]interface{}, len(spec.GPUs))
+	for i, gpu := range spec.GPUs {
+		gpus[i] = map[string]interface{}{
+			"id":        fmt.Sprintf("%d", i),
+			"model":     gpu.Model,
+			"memory_mb": gpu.MemoryMB,
+			"in_use":    a.gpuInUse[i],
+		}
+	}
+
+	jobs := make([]map[string]interface{}, 0, len(a.running))
+	for _, id := range a.runningJobIDs() {
+		job := a.running[id]
+		jobs = append(jobs, map[string]interface{}{
+			"job_id":              id,
+			"cpu_cores":           float64(job.requirements.CPUCores),
+			"memory_bytes":        int64(job.requirements.MemoryMB) * mebibyte,
+			"requested_cpu_cores": job.requirements.CPUCores,
+			"requested_memory_mb": job.requirements.MemoryMB,
+		})
+	}
+
+	memoryTotal := int64(spec.MemoryMB) * mebibyte
+	memoryUsed := int64(a.used.MemoryMB) * mebibyte
+	storageTotal := int64(spec.StorageMB) * mebibyte
+	storageUsed := int64(a.used.StorageMB) * mebibyte
+
+	return map[string]interface{}{
+		"protocol_version": protocol.Current,
+		"agent_id":         a.id,
+		"timestamp":        time.Now(),
+		"status":           "active",
+		"location":         spec.Location,
+		"capabilities":     spec.Capabilities,
+		"labels":           spec.Labels,
+		"active_jobs":      a.runningJobIDs(),
+		"resources": map[string]interface{}{
+			"cpu": map[string]interface{}{
+				"cores": spec.CPUCores,
+				"usage": percent(a.used.CPUCores, spec.CPUCores),
+			},
+			"memory": map[string]interface{}{
+				"total":     memoryTotal,
+				"available": memoryTotal - memoryUsed,
+				"used":      memoryUsed,
+				"usage":     percent(a.used.MemoryMB, spec.MemoryMB),
+			},
+			"gpus": gpus,
+			"storage": map[string]interface{}{
+				"total":     storageTotal,
+				"available": storageTotal - storageUsed,
+				"used":      storageUsed,
+				"usage":     percent(a.used.StorageMB, spec.StorageMB),
+			},
+			"network": map[string]interface{}{
+				"bandwidth_mbps": spec.NetworkMbps,
+			},
+			"usage": map[string]interface{}{
+				"jobs":       jobs,
+				"agent":      map[string]interface{}{"cpu_cores": 0, "memory_bytes": 0},
+				"background": map[string]interface{}{"cpu_cores": 0, "memory_bytes": 0},
+			},
+		},
+	}
+}
+
+func percent(used, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(used) / float64(total) * 100
+}
@@ -0,0 +1,330 @@
+// Package agentsim simulates fleets of agents against a real scheduler over
+// NATS, for regression tests of placement, retries and throughput.
+//
+// Simulated agents speak the current agent protocol: they heartbeat on
+// "agent.heartbeat" in the agent's wire format, answer assignment requests
+// on "agent.<id>.assign", honor cancellations on "agent.<id>.job.cancel" and
+// report outcomes on "job.result" through JetStream. They run no workloads;
+// an accepted job holds the resources it requested for Spec.RunTime.
+//
+//	fleet, err := agentsim.NewFleet(nc, agentsim.Config{Seed: 1})
+//	fleet.Add("cpu", 200, agentsim.Spec{CPUCores: 8, MemoryMB: 16384})
+//	fleet.Add("gpu", 10, agentsim.Spec{CPUCores: 32, MemoryMB: 131072, GPUs: []agentsim.GPU{{Model: "A100"}}})
+//	fleet.Start()
+//	defer fleet.Stop()
+//
+// Failure modes (Failure) are drawn from a seeded source, so a run with the
+// same seed and the same assignment order makes the same decisions.
+package agentsim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/events"
+	"github.com/computehive/core-services/pkg/protocol"
+	"github.com/nats-io/nats.go"
+)
+
+// Defaults applied to zero Config and Spec fields
+const (
+	DefaultHeartbeatInterval = 5 * time.Second
+	DefaultRunTime           = time.Second
+	DefaultStorageMB         = 100 * 1024
+	DefaultNetworkMbps       = 1000
+)
+
+// Config configures a fleet
+type Config struct {
+	HeartbeatInterval time.Duration // How often agents heartbeat
+	Seed              int64         // Seeds failure decisions
+}
+
+// Spec describes a simulated agent's resources and behavior
+type Spec struct {
+	CPUCores     int
+	MemoryMB     int
+	StorageMB    int
+	NetworkMbps  int
+	GPUs         []GPU
+	Location     string
+	Capabilities []string
+	Labels       map[string]string
+
+	AssignLatency time.Duration // Delay before answering an assignment
+	RunTime       time.Duration // How long each accepted job runs
+	Failure       Failure
+}
+
+// GPU is a simulated GPU
+type GPU struct {
+	Model    string
+	MemoryMB int
+}
+
+// Failure configures how a simulated agent misbehaves
+type Failure struct {
+	RejectRate   float64 // Fraction of assignments refused
+	FailRate     float64 // Fraction of accepted jobs that report failure
+	Unresponsive bool    // Never answer assignments, so requests time out
+	CrashAfter   int     // Go silent after accepting this many jobs; 0 never crashes
+}
+
+// Stats counts what simulated agents did
+type Stats struct {
+	Assignments int `json:"assignments"` // Assignment requests received
+	Accepted    int `json:"accepted"`
+	Rejected    int `json:"rejected"` // Refused by RejectRate or for lack of resources
+	Completed   int `json:"completed"`
+	Failed      int `json:"failed"`
+	Cancelled   int `json:"cancelled"`
+}
+
+func (s *Stats) add(o Stats) {
+	s.Assignments += o.Assignments
+	s.Accepted += o.Accepted
+	s.Rejected += o.Rejected
+	s.Completed += o.Completed
+	s.Failed += o.Failed
+	s.Cancelled += o.Cancelled
+}
+
+// Placement records a job an agent accepted
+type Placement struct {
+	JobID      string
+	AgentID    string
+	AcceptedAt time.Time
+}
+
+// Fleet runs simulated agents on one NATS connection
+type Fleet struct {
+	nc         *nats.Conn
+	bus        *events.Bus
+	config     Config
+	agents     []*Agent
+	byID       map[string]*Agent
+	named      map[string]int // Agents created per name prefix
+	placements []Placement
+	finished   map[string]string // job ID -> final status
+	changed    chan struct{}     // Closed and replaced whenever a job finishes
+	rng        *rand.Rand
+	started    bool
+	stop       chan struct{}
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+}
+
+// NewFleet creates an empty fleet
+func NewFleet(nc *nats.Conn, config Config) (*Fleet, error) {
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	bus, err := events.Connect(nc, "agentsim")
+	if err != nil {
+		return nil, err
+	}
+	return &Fleet{
+		nc:       nc,
+		bus:      bus,
+		config:   config,
+		byID:     make(map[string]*Agent),
+		named:    make(map[string]int),
+		finished: make(map[string]string),
+		changed:  make(chan struct{}),
+		rng:      rand.New(rand.NewSource(config.Seed)),
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// Add creates count agents with the same spec, named <prefix>-0,
+// <prefix>-1 and so on; further calls with a prefix continue its numbering
+func (f *Fleet) Add(prefix string, count int, spec Spec) []*Agent {
+	if spec.RunTime <= 0 {
+		spec.RunTime = DefaultRunTime
+	}
+	if spec.StorageMB <= 0 {
+		spec.StorageMB = DefaultStorageMB
+	}
+	if spec.NetworkMbps <= 0 {
+		spec.NetworkMbps = DefaultNetworkMbps
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	added := make([]*Agent, 0, count)
+	for i := 0; i < count; i++ {
+		agent := newAgent(f, fmt.Sprintf("%s-%d", prefix, f.named[prefix]), spec)
+		f.named[prefix]++
+		f.agents = append(f.agents, agent)
+		f.byID[agent.id] = agent
+		added = append(added, agent)
+	}
+	return added
+}
+
+// Start connects every agent and begins heartbeating. Each agent sends its
+// first heartbeat right away. Calling Start again starts the agents added
+// since.
+func (f *Fleet) Start() error {
+	f.mu.Lock()
+	agents := append([]*Agent(nil), f.agents...)
+	started := f.started
+	f.started = true
+	f.mu.Unlock()
+
+	for _, agent := range agents {
+		if err := agent.start(); err != nil {
+			f.Stop()
+			return fmt.Errorf("failed to start agent %s: %w", agent.id, err)
+		}
+	}
+
+	if !started {
+		f.wg.Add(1)
+		go f.heartbeatLoop()
+	}
+	return nil
+}
+
+// Stop disconnects every agent. Running jobs are abandoned without results.
+func (f *Fleet) Stop() {
+	f.mu.Lock()
+	select {
+	case <-f.stop:
+		f.mu.Unlock()
+		return
+	default:
+		close(f.stop)
+	}
+	agents := append([]*Agent(nil), f.agents...)
+	f.mu.Unlock()
+
+	for _, agent := range agents {
+		agent.Crash()
+	}
+	f.wg.Wait()
+}
+
+// Agent returns an agent by ID
+func (f *Fleet) Agent(id string) *Agent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.byID[id]
+}
+
+// Agents returns every agent in the fleet
+func (f *Fleet) Agents() []*Agent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*Agent(nil), f.agents...)
+}
+
+// Placements returns every accepted assignment in the order accepted
+func (f *Fleet) Placements() []Placement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Placement(nil), f.placements...)
+}
+
+// PlacedOn returns the agent that accepted a job, or "" if none did yet. A
+// retried job returns the agent that accepted it last.
+func (f *Fleet) PlacedOn(jobID string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.placements) - 1; i >= 0; i-- {
+		if f.placements[i].JobID == jobID {
+			return f.placements[i].AgentID
+		}
+	}
+	return ""
+}
+
+// Stats totals the stats of every agent
+func (f *Fleet) Stats() Stats {
+	var total Stats
+	for _, agent := range f.Agents() {
+		total.add(agent.Stats())
+	}
+	return total
+}
+
+// WaitForJobs blocks until the given jobs have reported a final result, or
+// ctx ends. It returns the final status of each job.
+func (f *Fleet) WaitForJobs(ctx context.Context, jobIDs ...string) (map[string]string, error) {
+	for {
+		f.mu.Lock()
+		results := make(map[string]string, len(jobIDs))
+		for _, id := range jobIDs {
+			if status, ok := f.finished[id]; ok {
+				results[id] = status
+			}
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		if len(results) == len(jobIDs) {
+			return results, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return results, fmt.Errorf("%d of %d jobs finished: %w", len(results), len(jobIDs), ctx.Err())
+		}
+	}
+}
+
+func (f *Fleet) heartbeatLoop() {
+	defer f.wg.Done()
+	ticker := time.NewTicker(f.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			for _, agent := range f.Agents() {
+				agent.sendHeartbeat()
+			}
+		}
+	}
+}
+
+// chance draws from the fleet's seeded source
+func (f *Fleet) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rng.Float64() < rate
+}
+
+func (f *Fleet) recordPlacement(jobID, agentID string) {
+	f.mu.Lock()
+	f.placements = append(f.placements, Placement{JobID: jobID, AgentID: agentID, AcceptedAt: time.Now()})
+	f.mu.Unlock()
+}
+
+func (f *Fleet) recordFinished(jobID, status string) {
+	f.mu.Lock()
+	f.finished[jobID] = status
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.mu.Unlock()
+}
+
+// publishResult reports a job's outcome the way agents do
+func (f *Fleet) publishResult(result jobResult) error {
+	result.ProtocolVersion = protocol.Current
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return f.bus.Publish(context.Background(), "job.result", data)
+}
@@ -0,0 +1,118 @@
+package agentsim
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func testAgent(spec Spec) *Agent {
+	fleet := &Fleet{rng: rand.New(rand.NewSource(1))}
+	agent := newAgent(fleet, "sim-0", spec)
+	agent.online = true
+	return agent
+}
+
+func TestAllocate(t *testing.T) {
+	agent := testAgent(Spec{
+		CPUCores:  8,
+		MemoryMB:  16384,
+		StorageMB: 10240,
+		GPUs:      []GPU{{Model: "A100"}, {Model: "T4"}},
+	})
+
+	if _, ok := agent.allocate("job-1", requirements{CPUCores: 4, MemoryMB: 8192, GPUCount: 1, GPUType: "A100"}); !ok {
+		t.Fatal("job-1 should fit")
+	}
+	if _, ok := agent.allocate("job-2", requirements{CPUCores: 2, MemoryMB: 1024, GPUCount: 1, GPUType: "A100"}); ok {
+		t.Error("job-2 needs the A100 job-1 holds")
+	}
+	if _, ok := agent.allocate("job-3", requirements{CPUCores: 5, MemoryMB: 1024}); ok {
+		t.Error("job-3 needs more CPU than is left")
+	}
+	if _, ok := agent.allocate("job-4", requirements{CPUCores: 4, MemoryMB: 8192, GPUCount: 1}); !ok {
+		t.Error("job-4 should fit on the T4")
+	}
+
+	agent.release("job-1")
+	if agent.used.CPUCores != 4 || agent.used.MemoryMB != 8192 || agent.gpuInUse[0] || !agent.gpuInUse[1] {
+		t.Errorf("Unexpected usage after release: %+v, GPUs %v", agent.used, agent.gpuInUse)
+	}
+
+	agent.online = false
+	if _, ok := agent.allocate("job-5", requirements{CPUCores: 1}); ok {
+		t.Error("Crashed agents accept nothing")
+	}
+}
+
+func TestHeartbeatReportsHeldResources(t *testing.T) {
+	agent := testAgent(Spec{CPUCores: 8, MemoryMB: 8192, StorageMB: 10240, GPUs: []GPU{{Model: "A100", MemoryMB: 40960}}})
+	agent.allocate("job-1", requirements{CPUCores: 2, MemoryMB: 2048, GPUCount: 1})
+
+	data, err := json.Marshal(agent.heartbeat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hb struct {
+		AgentID    string   `json:"agent_id"`
+		ActiveJobs []string `json:"active_jobs"`
+		Resources  struct {
+			CPU struct {
+				Cores int     `json:"cores"`
+				Usage float64 `json:"usage"`
+			} `json:"cpu"`
+			Memory struct {
+				Total     int64 `json:"total"`
+				Available int64 `json:"available"`
+			} `json:"memory"`
+			GPUs []struct {
+				InUse bool `json:"in_use"`
+			} `json:"gpus"`
+			Usage struct {
+				Jobs []struct {
+					RequestedCPUCores int `json:"requested_cpu_cores"`
+				} `json:"jobs"`
+			} `json:"usage"`
+		} `json:"resources"`
+	}
+	if err := json.Unmarshal(data, &hb); err != nil {
+		t.Fatal(err)
+	}
+
+	res := hb.Resources
+	if hb.AgentID != "sim-0" || len(hb.ActiveJobs) != 1 {
+		t.Errorf("Unexpected heartbeat: %s", data)
+	}
+	if res.CPU.Cores != 8 || res.CPU.Usage != 25 {
+		t.Errorf("CPU = %+v, want 8 cores at 25%%", res.CPU)
+	}
+	if res.Memory.Total != 8192*mebibyte || res.Memory.Available != 6144*mebibyte {
+		t.Errorf("Memory = %+v", res.Memory)
+	}
+	if len(res.GPUs) != 1 || !res.GPUs[0].InUse {
+		t.Errorf("GPU should be in use: %s", data)
+	}
+	if len(res.Usage.Jobs) != 1 || res.Usage.Jobs[0].RequestedCPUCores != 2 {
+		t.Errorf("Usage breakdown should list the job: %s", data)
+	}
+}
+
+func TestChanceIsSeeded(t *testing.T) {
+	draw := func() []bool {
+		fleet := &Fleet{rng: rand.New(rand.NewSource(42))}
+		draws := make([]bool, 20)
+		for i := range draws {
+			draws[i] = fleet.chance(0.5)
+		}
+		return draws
+	}
+	first, second := draw(), draw()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatal("Draws with the same seed should match")
+		}
+	}
+	if (&Fleet{}).chance(0) {
+		t.Error("A zero rate never fires")
+	}
+}
@@ -0,0 +1,237 @@
+// Package events carries the platform's critical events over NATS JetStream
+// so they survive a consumer being down.
+//
+// Subjects listed in Streams are retained by JetStream. Each service reads
+// them through a durable consumer that resumes where it left off after a
+// restart. Handlers acknowledge by returning nil. A returned error redelivers
+// the message with backoff, up to MaxDeliveries attempts. After that, or
+// straight away for errors wrapped with Permanent or coded
+// obs.CodeInvalidArgument, the message moves to "deadletter.<subject>",
+// where telemetry tracks it.
+//
+// Published messages carry the publisher's request fields (see obs.NewMsg),
+// and handlers receive them in their context.
+//
+// High-volume subjects such as heartbeats, metrics, logs and progress stay
+// on core NATS, where a lost message is superseded by the next one.
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/nats-io/nats.go"
+)
+
+// DeadLetterPrefix is prepended to the subject of messages that exhausted
+// their deliveries
+const DeadLetterPrefix = "deadletter."
+
+// Headers set on dead-lettered messages
+const (
+	HeaderConsumer   = "Computehive-Dlq-Consumer"
+	HeaderDeliveries = "Computehive-Dlq-Deliveries"
+	HeaderError      = "Computehive-Dlq-Error"
+	HeaderStreamSeq  = "Computehive-Dlq-Stream-Seq"
+)
+
+// MaxDeliveries is how many times a message is delivered before it is
+// dead-lettered
+const MaxDeliveries = 5
+
+// ackWait is how long a handler may run before the message is redelivered
+const ackWait = 30 * time.Second
+
+// retryBackoff is the delay before each redelivery after a handler error
+var retryBackoff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second, 2 * time.Minute}
+
+// Streams are the JetStream streams the services rely on
+var Streams = []nats.StreamConfig{
+	{
+		Name:     "JOBS",
+		Subjects: []string{"job.created", "job.scheduled", "job.result", "job.completed", "job.failed", "job.cancelled"},
+		Storage:  nats.FileStorage,
+		MaxAge:   7 * 24 * time.Hour,
+	},
+	{
+		Name:     "MATCHES",
+		Subjects: []string{"match.confirmed", "market_maker.settled"},
+		Storage:  nats.FileStorage,
+		MaxAge:   7 * 24 * time.Hour,
+	},
+	{
+		Name:     "AGENT_LIFECYCLE",
+		Subjects: []string{"agent.expired", "agent.restored", "agent.trust", "agent.gpu_runtime", "agent.maintenance"},
+		Storage:  nats.FileStorage,
+		MaxAge:   24 * time.Hour,
+	},
+	{
+		Name:     "NOTIFICATIONS",
+		Subjects: []string{"notification.email"},
+		Storage:  nats.FileStorage,
+		MaxAge:   7 * 24 * time.Hour,
+	},
+	{
+		Name:     "DEADLETTER",
+		Subjects: []string{DeadLetterPrefix + ">"},
+		Storage:  nats.FileStorage,
+		MaxAge:   30 * 24 * time.Hour,
+	},
+}
+
+// Handler processes one message. Returning nil acknowledges it. ctx carries
+// the request fields of whoever published the message.
+type Handler func(ctx context.Context, msg *nats.Msg) error
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks an error that retrying cannot fix, such as a malformed
+// payload, so the message is dead-lettered without further deliveries
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Bus publishes and consumes events for one service
+type Bus struct {
+	nc      *nats.Conn
+	js      nats.JetStreamContext
+	service string
+}
+
+// Connect enables JetStream on an existing connection and makes sure the
+// streams exist. service names the durable consumers, so every instance of
+// a service shares its consumers and each message is processed once per
+// service.
+func Connect(nc *nats.Conn, service string) (*Bus, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open JetStream context: %w", err)
+	}
+
+	for i := range Streams {
+		cfg := Streams[i]
+		if _, err := js.StreamInfo(cfg.Name); errors.Is(err, nats.ErrStreamNotFound) {
+			_, err = js.AddStream(&cfg)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
+			}
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to look up stream %s: %w", cfg.Name, err)
+		} else if _, err := js.UpdateStream(&cfg); err != nil {
+			return nil, fmt.Errorf("failed to update stream %s: %w", cfg.Name, err)
+		}
+	}
+
+	return &Bus{nc: nc, js: js, service: service}, nil
+}
+
+// retained reports whether a subject is captured by one of the streams
+func retained(subject string) bool {
+	for _, cfg := range Streams {
+		for _, s := range cfg.Subjects {
+			if s == subject || (strings.HasSuffix(s, ">") && strings.HasPrefix(subject, strings.TrimSuffix(s, ">"))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Publish sends an event carrying ctx's request fields. Retained subjects
+// wait for JetStream to store the message; others are published on core
+// NATS.
+func (b *Bus) Publish(ctx context.Context, subject string, data []byte) error {
+	msg := obs.NewMsg(ctx, subject, data)
+	if !retained(subject) {
+		return b.nc.PublishMsg(msg)
+	}
+	if _, err := b.js.PublishMsg(msg); err != nil {
+		return obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to publish %s: %w", subject, err))
+	}
+	return nil
+}
+
+// Subscribe consumes a retained subject through the service's durable
+// consumer for it. Instances of a service share the consumer, so handlers
+// must tolerate the redelivery of a message they already processed.
+func (b *Bus) Subscribe(subject string, handler Handler) (*nats.Subscription, error) {
+	durable := durableName(b.service, subject)
+	return b.js.QueueSubscribe(subject, durable, func(msg *nats.Msg) {
+		b.dispatch(durable, msg, handler)
+	},
+		nats.Durable(durable),
+		nats.ManualAck(),
+		nats.AckWait(ackWait),
+		nats.MaxDeliver(MaxDeliveries),
+		nats.DeliverAll(),
+	)
+}
+
+func (b *Bus) dispatch(durable string, msg *nats.Msg, handler Handler) {
+	ctx := obs.MessageContext(msg)
+	err := obs.Recover(func() error { return handler(ctx, msg) })
+	if err == nil {
+		msg.Ack()
+		return
+	}
+
+	deliveries := uint64(1)
+	var streamSeq uint64
+	if meta, metaErr := msg.Metadata(); metaErr == nil {
+		deliveries = meta.NumDelivered
+		streamSeq = meta.Sequence.Stream
+	}
+
+	var permanent permanentError
+	if !errors.As(err, &permanent) && obs.CodeOf(err) != obs.CodeInvalidArgument && deliveries < MaxDeliveries {
+		delay := retryBackoff[len(retryBackoff)-1]
+		if int(deliveries) <= len(retryBackoff) {
+			delay = retryBackoff[deliveries-1]
+		}
+		slog.WarnContext(ctx, "Event handler failed, retrying", "consumer", durable, "subject", msg.Subject,
+			"delivery", deliveries, "max_deliveries", MaxDeliveries, "retry_in", delay.String(),
+			obs.KeyCode, obs.CodeOf(err), obs.KeyError, err)
+		msg.NakWithDelay(delay)
+		return
+	}
+
+	dead := nats.NewMsg(DeadLetterPrefix + msg.Subject)
+	dead.Data = msg.Data
+	for key, values := range msg.Header {
+		dead.Header[key] = values
+	}
+	dead.Header.Set(HeaderConsumer, durable)
+	dead.Header.Set(HeaderDeliveries, strconv.FormatUint(deliveries, 10))
+	dead.Header.Set(HeaderError, err.Error())
+	dead.Header.Set(HeaderStreamSeq, strconv.FormatUint(streamSeq, 10))
+	if _, pubErr := b.js.PublishMsg(dead); pubErr != nil {
+		// Leave the message unacknowledged so it is not lost
+		slog.ErrorContext(ctx, "Failed to dead-letter event", "consumer", durable, "subject", msg.Subject,
+			obs.KeyError, pubErr)
+		msg.NakWithDelay(retryBackoff[len(retryBackoff)-1])
+		return
+	}
+
+	slog.ErrorContext(ctx, "Event dead-lettered", "consumer", durable, "subject", msg.Subject,
+		"deliveries", deliveries, obs.KeyCode, obs.CodeOf(err), obs.KeyError, err)
+	msg.Term()
+}
+
+// durableName derives a consumer name from the service and subject. Durable
+// names may not contain '.', '*' or '>'.
+func durableName(service, subject string) string {
+	name := strings.NewReplacer(".", "_", "*", "any", ">", "all").Replace(subject)
+	return service + "-" + name
+}
@@ -0,0 +1,53 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRetained(t *testing.T) {
+	cases := map[string]bool{
+		"job.completed":            true,
+		"match.confirmed":          true,
+		"market_maker.settled":     true,
+		"agent.trust":              true,
+		"agent.gpu_runtime":        true,
+		"agent.maintenance":        true,
+		"deadletter.job.completed": true,
+		"agent.heartbeat":          false,
+		"job.progress":             false,
+		"deadletterjob.completed":  false,
+	}
+	for subject, want := range cases {
+		if got := retained(subject); got != want {
+			t.Errorf("retained(%q) = %v, want %v", subject, got, want)
+		}
+	}
+}
+
+func TestDurableName(t *testing.T) {
+	if got := durableName("telemetry-service", "deadletter.>"); got != "telemetry-service-deadletter_all" {
+		t.Errorf("Unexpected durable name %q", got)
+	}
+	if got := durableName("payment-service", "job.completed"); got != "payment-service-job_completed" {
+		t.Errorf("Unexpected durable name %q", got)
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) should be nil")
+	}
+
+	cause := errors.New("malformed payload")
+	err := fmt.Errorf("handler: %w", Permanent(cause))
+
+	var permanent permanentError
+	if !errors.As(err, &permanent) {
+		t.Error("Wrapped permanent error should still be recognised")
+	}
+	if !errors.Is(err, cause) {
+		t.Error("Permanent error should unwrap to its cause")
+	}
+}
@@ -0,0 +1,132 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/nats-io/nats.go"
+)
+
+// Client caches a service's flags and keeps them current by watching the
+// bucket, so evaluating a flag never leaves the process
+type Client struct {
+	service string
+	watcher nats.KeyWatcher
+	ready   chan struct{}
+
+	mu    sync.RWMutex
+	flags map[string]*Flag
+}
+
+// OpenBucket returns the flags bucket, creating it if it does not exist
+func OpenBucket(nc *nats.Conn) (nats.KeyValue, error) {
+	js, err := nc.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open JetStream context: %w", err)
+	}
+	kv, err := js.KeyValue(Bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+			Bucket:      Bucket,
+			Description: "Feature flags, written by the flags service",
+			History:     10,
+			Storage:     nats.FileStorage,
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open flags bucket: %w", err)
+	}
+	return kv, nil
+}
+
+// NewClient starts caching the flags of service, or of every service if
+// service is empty. Flags read false until the initial values have loaded;
+// callers that must not start dark can wait on Ready.
+func NewClient(nc *nats.Conn, service string) (*Client, error) {
+	kv, err := OpenBucket(nc)
+	if err != nil {
+		return nil, err
+	}
+	keys := ">"
+	if service != "" {
+		keys = service + ".>"
+	}
+	watcher, err := kv.Watch(keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch flags: %w", err)
+	}
+
+	c := &Client{
+		service: service,
+		watcher: watcher,
+		ready:   make(chan struct{}),
+		flags:   make(map[string]*Flag),
+	}
+	go c.watch()
+	return c, nil
+}
+
+// watch applies updates from the bucket. The watcher first replays every
+// current flag, then a nil entry, then changes as they happen.
+func (c *Client) watch() {
+	loaded := false
+	for entry := range c.watcher.Updates() {
+		if entry == nil {
+			if !loaded {
+				loaded = true
+				close(c.ready)
+			}
+			continue
+		}
+
+		if entry.Operation() != nats.KeyValuePut {
+			c.mu.Lock()
+			delete(c.flags, entry.Key())
+			c.mu.Unlock()
+			continue
+		}
+
+		var flag Flag
+		if err := json.Unmarshal(entry.Value(), &flag); err != nil {
+			slog.Warn("Ignoring malformed feature flag", "key", entry.Key(), obs.KeyError, err)
+			continue
+		}
+		c.mu.Lock()
+		c.flags[entry.Key()] = &flag
+		c.mu.Unlock()
+	}
+}
+
+// Ready is closed once the initial flag values have loaded
+func (c *Client) Ready() <-chan struct{} {
+	return c.ready
+}
+
+// Enabled evaluates a flag for the caller ctx carries. key may omit the
+// client's service.
+func (c *Client) Enabled(ctx context.Context, key string) bool {
+	userID, tenant := obs.Caller(ctx)
+	return c.Evaluate(key, Context{TenantID: tenant, UserID: userID})
+}
+
+// Evaluate evaluates a flag for an explicit context, such as a background
+// job acting for a tenant
+func (c *Client) Evaluate(key string, fc Context) bool {
+	if c.service != "" && Service(key) != c.service {
+		key = c.service + "." + key
+	}
+	c.mu.RLock()
+	flag, exists := c.flags[key]
+	c.mu.RUnlock()
+	return exists && flag.Evaluate(fc)
+}
+
+// Close stops following updates
+func (c *Client) Close() error {
+	return c.watcher.Stop()
+}
@@ -0,0 +1,144 @@
+// Package flags evaluates feature flags, so risky features can ship dark and
+// be ramped up gradually.
+//
+// Flags are named <service>.<feature>, e.g. marketplace.new-matcher, and
+// live in a JetStream key-value bucket that the flags service writes. A flag
+// is one of three kinds:
+//
+//   - boolean: on or off for everyone
+//   - percentage: on for a stable share of users, so a user keeps the same
+//     answer as the share grows
+//   - targeted: on for listed tenants and users, and optionally a share of
+//     everyone else
+//
+// Any flag can be switched off, which serves false to everyone whatever its
+// kind. Unknown flags are off.
+package flags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Bucket is the key-value bucket holding the flags
+const Bucket = "FEATURE_FLAGS"
+
+// Kind is how a flag decides who it is on for
+type Kind string
+
+// Flag kinds
+const (
+	Boolean    Kind = "boolean"
+	Percentage Kind = "percentage"
+	Targeted   Kind = "targeted"
+)
+
+// keyPattern restricts keys to what key-value buckets accept, with the
+// service the flag belongs to before the first dot
+var keyPattern = regexp.MustCompile(`^[a-z0-9-]+\.[a-z0-9_.-]+$`)
+
+// maxTargets bounds the tenants and users a targeted flag lists
+const maxTargets = 1000
+
+// Flag is one feature flag
+type Flag struct {
+	Key         string    `json:"key"`
+	Description string    `json:"description,omitempty"`
+	Kind        Kind      `json:"kind"`
+	Enabled     bool      `json:"enabled"`              // Off serves false to everyone
+	Percentage  float64   `json:"percentage,omitempty"` // Share of users served true, 0-100; for targeted flags, of those not listed
+	Tenants     []string  `json:"tenants,omitempty"`    // Targeted: tenants served true
+	Users       []string  `json:"users,omitempty"`      // Targeted: users served true
+	UpdatedBy   string    `json:"updated_by,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Context is who a flag is evaluated for. The tenant is the caller's
+// organization, or the caller outside one.
+type Context struct {
+	TenantID string `json:"tenant_id,omitempty"`
+	UserID   string `json:"user_id,omitempty"`
+}
+
+// Service returns the service a flag key belongs to
+func Service(key string) string {
+	service, _, _ := strings.Cut(key, ".")
+	return service
+}
+
+// Validate checks a flag's key, kind and targeting
+func (f *Flag) Validate() error {
+	if !keyPattern.MatchString(f.Key) || len(f.Key) > 128 {
+		return fmt.Errorf("key must be <service>.<feature> in lowercase letters, digits, '-', '_' and '.'")
+	}
+	switch f.Kind {
+	case Boolean:
+		if f.Percentage != 0 || len(f.Tenants) > 0 || len(f.Users) > 0 {
+			return fmt.Errorf("boolean flags take no percentage or targets")
+		}
+	case Percentage:
+		if len(f.Tenants) > 0 || len(f.Users) > 0 {
+			return fmt.Errorf("percentage flags take no targets; use a targeted flag")
+		}
+	case Targeted:
+		if len(f.Tenants)+len(f.Users) > maxTargets {
+			return fmt.Errorf("at most %d tenants and users can be targeted", maxTargets)
+		}
+	default:
+		return fmt.Errorf("kind must be boolean, percentage or targeted")
+	}
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return fmt.Errorf("percentage must be between 0 and 100")
+	}
+	return nil
+}
+
+// Evaluate reports whether the flag is on for c
+func (f *Flag) Evaluate(c Context) bool {
+	if !f.Enabled {
+		return false
+	}
+	switch f.Kind {
+	case Boolean:
+		return true
+	case Targeted:
+		if contains(f.Tenants, c.TenantID) || contains(f.Users, c.UserID) {
+			return true
+		}
+	}
+	return f.inRollout(c)
+}
+
+// inRollout reports whether c falls within the flag's percentage. Users are
+// bucketed by user, falling back to tenant, hashed with the flag key so each
+// flag ramps through a different order of users.
+func (f *Flag) inRollout(c Context) bool {
+	if f.Percentage >= 100 {
+		return true
+	}
+	unit := c.UserID
+	if unit == "" {
+		unit = c.TenantID
+	}
+	if unit == "" || f.Percentage <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(f.Key + "/" + unit))
+	return float64(h.Sum32()%10000) < f.Percentage*100
+}
+
+func contains(list []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package flags
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	user := Context{TenantID: "org-1", UserID: "user-1"}
+
+	cases := []struct {
+		name string
+		flag Flag
+		want bool
+	}{
+		{"boolean on", Flag{Key: "svc.a", Kind: Boolean, Enabled: true}, true},
+		{"switched off", Flag{Key: "svc.a", Kind: Boolean}, false},
+		{"full rollout", Flag{Key: "svc.a", Kind: Percentage, Enabled: true, Percentage: 100}, true},
+		{"no rollout", Flag{Key: "svc.a", Kind: Percentage, Enabled: true}, false},
+		{"targeted tenant", Flag{Key: "svc.a", Kind: Targeted, Enabled: true, Tenants: []string{"org-1"}}, true},
+		{"targeted user", Flag{Key: "svc.a", Kind: Targeted, Enabled: true, Users: []string{"user-1"}}, true},
+		{"not targeted", Flag{Key: "svc.a", Kind: Targeted, Enabled: true, Users: []string{"user-2"}}, false},
+		{"targeted but off", Flag{Key: "svc.a", Kind: Targeted, Users: []string{"user-1"}}, false},
+	}
+	for _, c := range cases {
+		if got := c.flag.Evaluate(user); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPercentageRollout(t *testing.T) {
+	flag := Flag{Key: "marketplace.new-matcher", Kind: Percentage, Enabled: true, Percentage: 20}
+
+	on := 0
+	for i := 0; i < 10000; i++ {
+		if flag.Evaluate(Context{UserID: fmt.Sprintf("user-%d", i)}) {
+			on++
+		}
+	}
+	if on < 1800 || on > 2200 {
+		t.Errorf("Expected about 20%% of users, got %d of 10000", on)
+	}
+
+	// Users in the rollout stay in it as the percentage grows
+	ramped := flag
+	ramped.Percentage = 50
+	for i := 0; i < 1000; i++ {
+		c := Context{UserID: fmt.Sprintf("user-%d", i)}
+		if flag.Evaluate(c) && !ramped.Evaluate(c) {
+			t.Fatalf("user-%d dropped out of the rollout when it grew", i)
+		}
+	}
+
+	if flag.Evaluate(Context{}) {
+		t.Error("Anonymous contexts should not fall in a partial rollout")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := Flag{Key: "marketplace.new-matcher", Kind: Targeted, Users: []string{"user-1"}, Percentage: 5}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Valid flag rejected: %v", err)
+	}
+
+	for name, flag := range map[string]Flag{
+		"no service":       {Key: "new-matcher", Kind: Boolean},
+		"uppercase":        {Key: "marketplace.NewMatcher", Kind: Boolean},
+		"unknown kind":     {Key: "marketplace.a", Kind: "gradual"},
+		"boolean share":    {Key: "marketplace.a", Kind: Boolean, Percentage: 10},
+		"percentage users": {Key: "marketplace.a", Kind: Percentage, Users: []string{"user-1"}},
+		"over 100":         {Key: "marketplace.a", Kind: Percentage, Percentage: 101},
+	} {
+		if err := flag.Validate(); err == nil {
+			t.Errorf("%s: invalid flag accepted", name)
+		}
+	}
+}
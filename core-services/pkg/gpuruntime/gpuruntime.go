@@ -0,0 +1,157 @@
+// Package gpuruntime matches jobs to the GPU driver and compute runtime an
+// agent has installed.
+//
+// Agents report their NVIDIA or AMD driver version and the CUDA or ROCm
+// version it supports; jobs name the minimum versions their images were
+// built against. A job whose image needs a newer runtime than the agent's
+// driver supports fails when its container starts, so the scheduler treats
+// these minimums as hard placement constraints.
+package gpuruntime
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Versions is the GPU runtime an agent reports. Empty fields are unknown or
+// not installed.
+type Versions struct {
+	DriverVersion string `json:"driver_version,omitempty"` // e.g. 535.104.05
+	CUDAVersion   string `json:"cuda_version,omitempty"`   // Highest CUDA version the driver supports, e.g. 12.2
+	ROCmVersion   string `json:"rocm_version,omitempty"`   // e.g. 6.0.2
+}
+
+// IsZero reports whether no runtime is known
+func (v *Versions) IsZero() bool {
+	return v == nil || (v.DriverVersion == "" && v.CUDAVersion == "" && v.ROCmVersion == "")
+}
+
+// Requirements are the minimum runtime versions a job needs. Empty fields
+// accept any agent.
+type Requirements struct {
+	MinDriverVersion string `json:"min_driver_version,omitempty"`
+	MinCUDAVersion   string `json:"min_cuda_version,omitempty"`
+	MinROCmVersion   string `json:"min_rocm_version,omitempty"`
+}
+
+// IsZero reports whether the requirements accept any agent
+func (r Requirements) IsZero() bool {
+	return r.MinDriverVersion == "" && r.MinCUDAVersion == "" && r.MinROCmVersion == ""
+}
+
+// Validate checks every minimum is a version
+func (r Requirements) Validate() error {
+	for _, field := range r.fields() {
+		if field.min == "" {
+			continue
+		}
+		if _, err := parse(field.min); err != nil {
+			return fmt.Errorf("%s: %w", field.name, err)
+		}
+	}
+	return nil
+}
+
+// Unmet explains the first requirement the runtime does not meet, or
+// returns "" when it meets them all. A runtime that does not report a
+// version does not meet a minimum for it.
+func (r Requirements) Unmet(v *Versions) string {
+	if v == nil {
+		v = &Versions{}
+	}
+	for _, field := range r.fields() {
+		if field.min == "" {
+			continue
+		}
+		have := field.have(v)
+		if have == "" {
+			return fmt.Sprintf("%s %s required, agent reports none", field.label, field.min)
+		}
+		if Compare(have, field.min) < 0 {
+			return fmt.Sprintf("%s %s required, agent has %s", field.label, field.min, have)
+		}
+	}
+	return ""
+}
+
+// Covers reports whether every runtime meeting r also meets other, so r is
+// at least as strict
+func (r Requirements) Covers(other Requirements) bool {
+	mine, theirs := r.fields(), other.fields()
+	for i := range mine {
+		if theirs[i].min != "" && (mine[i].min == "" || Compare(mine[i].min, theirs[i].min) < 0) {
+			return false
+		}
+	}
+	return true
+}
+
+type requirement struct {
+	name, label, min string
+	have             func(*Versions) string
+}
+
+func (r Requirements) fields() []requirement {
+	return []requirement{
+		{"min_driver_version", "driver", r.MinDriverVersion, func(v *Versions) string { return v.DriverVersion }},
+		{"min_cuda_version", "CUDA", r.MinCUDAVersion, func(v *Versions) string { return v.CUDAVersion }},
+		{"min_rocm_version", "ROCm", r.MinROCmVersion, func(v *Versions) string { return v.ROCmVersion }},
+	}
+}
+
+// Valid reports whether s is a dotted numeric version such as 12.2 or
+// 535.104.05
+func Valid(s string) bool {
+	_, err := parse(s)
+	return err == nil
+}
+
+// Compare orders two dotted numeric versions, returning -1, 0 or 1. Missing
+// components count as zero, so 12.2 equals 12.2.0. Versions that do not
+// parse sort before those that do.
+func Compare(a, b string) int {
+	pa, errA := parse(a)
+	pb, errB := parse(b)
+	switch {
+	case errA != nil && errB != nil:
+		return 0
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func parse(s string) ([]int, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if s == "" {
+		return nil, fmt.Errorf("empty version")
+	}
+	parts := strings.Split(s, ".")
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q, want dotted numbers such as 12.2", s)
+		}
+		numbers[i] = n
+	}
+	return numbers, nil
+}
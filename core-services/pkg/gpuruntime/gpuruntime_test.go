@@ -0,0 +1,64 @@
+package gpuruntime
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"12.2", "12.2", 0},
+		{"12.2", "12.2.0", 0},
+		{"12.10", "12.2", 1},
+		{"11.8", "12.0", -1},
+		{"535.104.05", "535.54.03", 1},
+		{"v6.0.2", "6.0", 1},
+		{"bogus", "1.0", -1},
+	}
+	for _, c := range cases {
+		if got := Compare(c.a, c.b); got != c.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestUnmet(t *testing.T) {
+	runtime := &Versions{DriverVersion: "535.104.05", CUDAVersion: "12.2"}
+	cases := []struct {
+		name string
+		req  Requirements
+		met  bool
+	}{
+		{"none", Requirements{}, true},
+		{"older cuda", Requirements{MinCUDAVersion: "11.8"}, true},
+		{"same cuda", Requirements{MinCUDAVersion: "12.2"}, true},
+		{"newer cuda", Requirements{MinCUDAVersion: "12.4"}, false},
+		{"newer driver", Requirements{MinDriverVersion: "550"}, false},
+		{"rocm on nvidia", Requirements{MinROCmVersion: "6.0"}, false},
+	}
+	for _, c := range cases {
+		if reason := c.req.Unmet(runtime); (reason == "") != c.met {
+			t.Errorf("%s: got %q, want met=%v", c.name, reason, c.met)
+		}
+	}
+	if reason := (Requirements{MinCUDAVersion: "12.0"}).Unmet(nil); reason == "" {
+		t.Error("agent without a runtime met a CUDA requirement")
+	}
+}
+
+func TestValidateAndCovers(t *testing.T) {
+	if err := (Requirements{MinCUDAVersion: "12.x"}).Validate(); err == nil {
+		t.Error("invalid version accepted")
+	}
+	if err := (Requirements{MinCUDAVersion: "12.1", MinDriverVersion: "535.54.03"}).Validate(); err != nil {
+		t.Errorf("valid versions rejected: %v", err)
+	}
+
+	strict := Requirements{MinCUDAVersion: "12.2"}
+	if !strict.Covers(Requirements{MinCUDAVersion: "12.0"}) || !strict.Covers(Requirements{}) {
+		t.Error("stricter requirements do not cover looser ones")
+	}
+	if strict.Covers(Requirements{MinCUDAVersion: "12.4"}) || strict.Covers(Requirements{MinDriverVersion: "535"}) {
+		t.Error("looser requirements cover stricter ones")
+	}
+}
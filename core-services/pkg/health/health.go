@@ -0,0 +1,257 @@
+// Package health provides liveness and readiness endpoints shared by the
+// ComputeHive core services.
+//
+// Liveness (/healthz) only reports that the process is up and serving HTTP.
+// Readiness (/readyz) runs the registered dependency checks (database, NATS,
+// downstream services) and reports an overall status:
+//
+//   - up:       every check passed
+//   - degraded: a non-critical check failed; the instance keeps serving
+//   - down:     a critical check failed; the instance returns 503 so
+//     orchestrators stop routing traffic to it
+package health
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Overall and per-check statuses
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// CheckFunc verifies a single dependency. A nil error means healthy.
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named dependency check
+type Check struct {
+	Name     string
+	Critical bool
+	Fn       CheckFunc
+}
+
+// CheckResult is the outcome of a single check
+type CheckResult struct {
+	Status    string `json:"status"`
+	Critical  bool   `json:"critical"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// Report is the JSON body returned by the health endpoints
+type Report struct {
+	Service       string                 `json:"service"`
+	Status        string                 `json:"status"`
+	UptimeSeconds int64                  `json:"uptime_seconds"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Checks        map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// Checker holds the dependency checks for a service
+type Checker struct {
+	service   string
+	startedAt time.Time
+	timeout   time.Duration
+	checks    []Check
+	mu        sync.RWMutex
+}
+
+// NewChecker creates a checker for the named service
+func NewChecker(service string) *Checker {
+	return &Checker{
+		service:   service,
+		startedAt: time.Now(),
+		timeout:   2 * time.Second,
+	}
+}
+
+// SetTimeout overrides the per-check timeout (default 2s)
+func (c *Checker) SetTimeout(timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = timeout
+}
+
+// AddCheck registers a dependency check. Failing critical checks mark the
+// service down; failing non-critical checks mark it degraded.
+func (c *Checker) AddCheck(name string, critical bool, fn CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, Check{Name: name, Critical: critical, Fn: fn})
+}
+
+// Run executes all checks concurrently and builds a report
+func (c *Checker) Run(ctx context.Context) *Report {
+	c.mu.RLock()
+	checks := append([]Check{}, c.checks...)
+	timeout := c.timeout
+	c.mu.RUnlock()
+
+	report := &Report{
+		Service:       c.service,
+		Status:        StatusUp,
+		UptimeSeconds: int64(time.Since(c.startedAt).Seconds()),
+		Timestamp:     time.Now().UTC(),
+		Checks:        make(map[string]CheckResult, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := runCheck(checkCtx, check.Fn)
+			result := CheckResult{
+				Status:    StatusUp,
+				Critical:  check.Critical,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				result.Status = StatusDown
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			report.Checks[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	report.Status = aggregate(report.Checks)
+	return report
+}
+
+// runCheck runs fn but gives up once ctx expires, so a hung dependency
+// cannot stall the probe
+func runCheck(ctx context.Context, fn CheckFunc) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+}
+
+// aggregate derives the overall status from individual results
+func aggregate(results map[string]CheckResult) string {
+	status := StatusUp
+	for _, result := range results {
+		if result.Status == StatusUp {
+			continue
+		}
+		if result.Critical {
+			return StatusDown
+		}
+		status = StatusDegraded
+	}
+	return status
+}
+
+// LivenessHandler serves /healthz. It never runs dependency checks: a
+// failing database should not get a healthy process restarted.
+func (c *Checker) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	report := &Report{
+		Service:       c.service,
+		Status:        StatusUp,
+		UptimeSeconds: int64(time.Since(c.startedAt).Seconds()),
+		Timestamp:     time.Now().UTC(),
+	}
+	writeReport(w, report)
+}
+
+// ReadinessHandler serves /readyz
+func (c *Checker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, c.Run(r.Context()))
+}
+
+// CheckNames returns the registered check names in sorted order
+func (c *Checker) CheckNames() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := make([]string, 0, len(c.checks))
+	for _, check := range c.checks {
+		names = append(names, check.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeReport(w http.ResponseWriter, report *Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == StatusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// Common checks
+
+// NATSCheck verifies the NATS connection is established
+func NATSCheck(nc *nats.Conn) CheckFunc {
+	return func(ctx context.Context) error {
+		if nc == nil {
+			return fmt.Errorf("not configured")
+		}
+		if status := nc.Status(); status != nats.CONNECTED {
+			return fmt.Errorf("connection status: %v", status)
+		}
+		return nil
+	}
+}
+
+// SQLCheck pings the database
+func SQLCheck(db *sql.DB) CheckFunc {
+	return func(ctx context.Context) error {
+		if db == nil {
+			return fmt.Errorf("not configured")
+		}
+		return db.PingContext(ctx)
+	}
+}
+
+// HTTPCheck verifies a downstream service responds with a 2xx status
+func HTTPCheck(client *http.Client, url string) CheckFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
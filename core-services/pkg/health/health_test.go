@@ -0,0 +1,97 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReadinessAllUp(t *testing.T) {
+	c := NewChecker("test-service")
+	c.AddCheck("db", true, func(ctx context.Context) error { return nil })
+
+	rec := httptest.NewRecorder()
+	c.ReadinessHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	var report Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Status != StatusUp {
+		t.Errorf("Expected status %s, got %s", StatusUp, report.Status)
+	}
+	if report.Checks["db"].Status != StatusUp {
+		t.Errorf("Expected db check to be up, got %s", report.Checks["db"].Status)
+	}
+}
+
+func TestReadinessDegraded(t *testing.T) {
+	c := NewChecker("test-service")
+	c.AddCheck("db", true, func(ctx context.Context) error { return nil })
+	c.AddCheck("cache", false, func(ctx context.Context) error { return errors.New("unreachable") })
+
+	rec := httptest.NewRecorder()
+	c.ReadinessHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Degraded instances should stay ready, got %d", rec.Code)
+	}
+
+	report := c.Run(context.Background())
+	if report.Status != StatusDegraded {
+		t.Errorf("Expected status %s, got %s", StatusDegraded, report.Status)
+	}
+	if report.Checks["cache"].Error != "unreachable" {
+		t.Errorf("Expected check error to be reported, got %q", report.Checks["cache"].Error)
+	}
+}
+
+func TestReadinessCriticalDown(t *testing.T) {
+	c := NewChecker("test-service")
+	c.AddCheck("nats", true, func(ctx context.Context) error { return errors.New("disconnected") })
+
+	rec := httptest.NewRecorder()
+	c.ReadinessHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", rec.Code)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	c := NewChecker("test-service")
+	c.SetTimeout(50 * time.Millisecond)
+	c.AddCheck("slow", true, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	report := c.Run(context.Background())
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Run should not wait for a hung check")
+	}
+	if report.Status != StatusDown {
+		t.Errorf("Expected status %s, got %s", StatusDown, report.Status)
+	}
+}
+
+func TestLivenessSkipsChecks(t *testing.T) {
+	c := NewChecker("test-service")
+	c.AddCheck("nats", true, func(ctx context.Context) error { return errors.New("disconnected") })
+
+	rec := httptest.NewRecorder()
+	c.LivenessHandler(rec, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+}
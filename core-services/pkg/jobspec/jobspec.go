@@ -0,0 +1,378 @@
+// Package jobspec defines the declarative job document that the CLI, the
+// gateway and the scheduler accept, written in YAML or JSON:
+//
+//	apiVersion: computehive.io/v1
+//	kind: Job
+//	metadata:
+//	  name: train-resnet
+//	  tags:
+//	    team: vision
+//	spec:
+//	  runtime: docker
+//	  container:
+//	    image: pytorch/pytorch:2.1.0-cuda12.1-cudnn8-runtime
+//	    command: [python, train.py]
+//	  resources:
+//	    cpu: 8
+//	    memory: 32Gi
+//	    gpu:
+//	      count: 1
+//	      type: A100
+//	      minCudaVersion: "12.1"
+//	  timeout: 6h
+//
+// GPU jobs may name the minimum driver, CUDA or ROCm version their image
+// needs; agents with an older runtime are never chosen.
+//
+// Docker jobs may add sidecars, such as a data loader or a metrics exporter,
+// that run next to the main container on the same agent as one pod-like
+// unit: they share its network and IPC namespaces and an optional shared
+// volume, start before it and are stopped when it exits.
+//
+// Agents watch the memory of docker jobs and warn the job's owner when its
+// growth predicts an out-of-memory kill. A job that declares a checkpoint is
+// also told to save its state then, by a command run inside its container
+// or a signal:
+//
+//	checkpoint:
+//	  command: [python, save_checkpoint.py]
+//
+// Parse decodes a document, fills in defaults for what it leaves out and
+// validates it. Problems are reported together as a *ValidationError, each
+// naming the offending field by its path, such as spec.resources.memory.
+package jobspec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Supported document versions and kinds
+const (
+	APIVersionV1 = "computehive.io/v1"
+	KindJob      = "Job"
+)
+
+// Job is a job document
+type Job struct {
+	APIVersion string   `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string   `json:"kind" yaml:"kind"`
+	Metadata   Metadata `json:"metadata" yaml:"metadata"`
+	Spec       Spec     `json:"spec" yaml:"spec"`
+}
+
+// Metadata identifies a job
+type Metadata struct {
+	Name string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Tags map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"` // Cost allocation tags
+}
+
+// Runtime is how an agent executes a job
+type Runtime string
+
+const (
+	RuntimeDocker     Runtime = "docker"
+	RuntimeKubernetes Runtime = "kubernetes"
+	RuntimeBinary     Runtime = "binary"
+	RuntimeScript     Runtime = "script"
+	RuntimeWASM       Runtime = "wasm"
+)
+
+// Runtimes lists every supported runtime
+var Runtimes = []Runtime{RuntimeDocker, RuntimeKubernetes, RuntimeBinary, RuntimeScript, RuntimeWASM}
+
+// Spec describes what a job runs and what it needs. Exactly one of
+// Container, Binary and Script is set, matching the runtime: containers for
+// docker and kubernetes, binaries for binary and wasm.
+type Spec struct {
+	Runtime      Runtime           `json:"runtime" yaml:"runtime"`
+	Container    *Container        `json:"container,omitempty" yaml:"container,omitempty"`
+	Binary       *Binary           `json:"binary,omitempty" yaml:"binary,omitempty"`
+	Script       *Script           `json:"script,omitempty" yaml:"script,omitempty"`
+	Env          map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Resources    Resources         `json:"resources" yaml:"resources"`
+	Priority     *int              `json:"priority,omitempty" yaml:"priority,omitempty"` // 0-10, default 5
+	Timeout      Duration          `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	MaxRetries   int               `json:"maxRetries,omitempty" yaml:"maxRetries,omitempty"` // 0 uses the default
+	Ports        []Port            `json:"ports,omitempty" yaml:"ports,omitempty"`
+	SLA          *SLA              `json:"sla,omitempty" yaml:"sla,omitempty"`
+	QuoteID      string            `json:"quoteId,omitempty" yaml:"quoteId,omitempty"`                   // Marketplace quote to honor
+	MatchID      string            `json:"matchId,omitempty" yaml:"matchId,omitempty"`                   // Marketplace match the job runs under
+	Placement    string            `json:"placementProfile,omitempty" yaml:"placementProfile,omitempty"` // Scoring profile that ranks candidate agents
+	Sidecars     []Sidecar         `json:"sidecars,omitempty" yaml:"sidecars,omitempty"`                 // Docker only
+	SharedVolume *SharedVolume     `json:"sharedVolume,omitempty" yaml:"sharedVolume,omitempty"`         // Mounted into every container
+	Checkpoint   *Checkpoint       `json:"checkpoint,omitempty" yaml:"checkpoint,omitempty"`             // Docker only
+}
+
+// Container is the image a docker or kubernetes job runs
+type Container struct {
+	Image   string   `json:"image" yaml:"image"`
+	Command []string `json:"command,omitempty" yaml:"command,omitempty"`
+}
+
+// Sidecar is a container that runs alongside a docker job's main container.
+// A sidecar that exits with an error fails the job; one that exits cleanly,
+// like a loader that has staged its data, just stops.
+type Sidecar struct {
+	Name    string            `json:"name" yaml:"name"`
+	Image   string            `json:"image" yaml:"image"`
+	Command []string          `json:"command,omitempty" yaml:"command,omitempty"`
+	Env     map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+	Memory  Quantity          `json:"memory,omitempty" yaml:"memory,omitempty"` // Added to the job's memory request
+}
+
+// Volume media
+const (
+	MediumMemory = "memory" // tmpfs, counted against the job's memory
+	MediumDisk   = "disk"
+)
+
+// SharedVolume is scratch space shared by a job's containers
+type SharedVolume struct {
+	MountPath string   `json:"mountPath" yaml:"mountPath"`
+	Size      Quantity `json:"size,omitempty" yaml:"size,omitempty"`
+	Medium    string   `json:"medium,omitempty" yaml:"medium,omitempty"`
+}
+
+// Checkpoint is how a docker job saves its state when the agent predicts it
+// will run out of memory. Exactly one of Command and Signal is set.
+type Checkpoint struct {
+	Command []string `json:"command,omitempty" yaml:"command,omitempty"` // Run inside the main container
+	Signal  string   `json:"signal,omitempty" yaml:"signal,omitempty"`   // Sent to the main container, e.g. SIGUSR1
+}
+
+// CheckpointSignals lists the signals a checkpoint may use. Signals that
+// stop the process by default are excluded.
+var CheckpointSignals = []string{"SIGUSR1", "SIGUSR2", "SIGHUP"}
+
+// Binary is the executable or WebAssembly module a job runs
+type Binary struct {
+	URL  string   `json:"url" yaml:"url"`
+	Args []string `json:"args,omitempty" yaml:"args,omitempty"`
+}
+
+// Script is the source a script job runs
+type Script struct {
+	Language   string `json:"language" yaml:"language"`
+	Source     string `json:"source" yaml:"source"`
+	OutputPath string `json:"outputPath,omitempty" yaml:"outputPath,omitempty"` // Collected as an artifact
+}
+
+// Resources are what a job needs from its agent
+type Resources struct {
+	CPU          int      `json:"cpu" yaml:"cpu"` // Cores
+	Memory       Quantity `json:"memory" yaml:"memory"`
+	Storage      Quantity `json:"storage,omitempty" yaml:"storage,omitempty"`
+	GPU          *GPU     `json:"gpu,omitempty" yaml:"gpu,omitempty"`
+	NetworkMbps  int      `json:"networkMbps,omitempty" yaml:"networkMbps,omitempty"`
+	TrustedExec  bool     `json:"trustedExec,omitempty" yaml:"trustedExec,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+	MinTrustTier string   `json:"minTrustTier,omitempty" yaml:"minTrustTier,omitempty"` // Least trusted agent tier the job may run on
+}
+
+// GPU requests GPUs, optionally of one model and with a minimum driver
+// and runtime, e.g. the CUDA version the job's image was built against
+type GPU struct {
+	Count            int    `json:"count" yaml:"count"`
+	Type             string `json:"type,omitempty" yaml:"type,omitempty"`
+	MinDriverVersion string `json:"minDriverVersion,omitempty" yaml:"minDriverVersion,omitempty"`
+	MinCUDAVersion   string `json:"minCudaVersion,omitempty" yaml:"minCudaVersion,omitempty"`
+	MinROCmVersion   string `json:"minRocmVersion,omitempty" yaml:"minRocmVersion,omitempty"`
+}
+
+// Port is a job port exposed through the tunnel service
+type Port struct {
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`
+	Port     int    `json:"port" yaml:"port"`
+	Protocol string `json:"protocol,omitempty" yaml:"protocol,omitempty"` // http or tcp
+}
+
+// SLA bounds where and how a job may run
+type SLA struct {
+	MaxLatencyMs     int      `json:"maxLatencyMs,omitempty" yaml:"maxLatencyMs,omitempty"`
+	MinAvailability  float64  `json:"minAvailability,omitempty" yaml:"minAvailability,omitempty"` // Percent
+	MaxCostPerHour   float64  `json:"maxCostPerHour,omitempty" yaml:"maxCostPerHour,omitempty"`
+	PreferredRegions []string `json:"preferredRegions,omitempty" yaml:"preferredRegions,omitempty"`
+	AllowMaintenance bool     `json:"allowMaintenance,omitempty" yaml:"allowMaintenance,omitempty"` // Accept agents with a maintenance window during the run
+}
+
+// Payload is what the agent executes, in its wire format
+type Payload struct {
+	Image      string   `json:"image,omitempty"`
+	Command    []string `json:"command,omitempty"`
+	Env        []string `json:"env,omitempty"`
+	BinaryURL  string   `json:"binary_url,omitempty"`
+	Args       []string `json:"args,omitempty"`
+	Script     string   `json:"script,omitempty"`
+	Language   string   `json:"language,omitempty"`
+	OutputPath string   `json:"output_path,omitempty"`
+
+	Sidecars     []SidecarPayload   `json:"sidecars,omitempty"`
+	SharedVolume *VolumePayload     `json:"shared_volume,omitempty"`
+	Checkpoint   *CheckpointPayload `json:"checkpoint,omitempty"`
+}
+
+// SidecarPayload is a sidecar in the agent's wire format
+type SidecarPayload struct {
+	Name     string   `json:"name"`
+	Image    string   `json:"image"`
+	Command  []string `json:"command,omitempty"`
+	Env      []string `json:"env,omitempty"`
+	MemoryMB int      `json:"memory_mb,omitempty"`
+}
+
+// VolumePayload is a shared volume in the agent's wire format
+type VolumePayload struct {
+	MountPath string `json:"mount_path"`
+	SizeMB    int    `json:"size_mb"`
+	Medium    string `json:"medium"`
+}
+
+// CheckpointPayload is a checkpoint in the agent's wire format
+type CheckpointPayload struct {
+	Command []string `json:"command,omitempty"`
+	Signal  string   `json:"signal,omitempty"`
+}
+
+// Parse decodes a YAML or JSON job document, applies defaults and validates
+// it. Unknown fields are rejected so typos do not go unnoticed.
+func Parse(data []byte) (*Job, error) {
+	job, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	job.Default()
+	if err := job.Validate(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// IsDocument reports whether a JSON request body is a job document rather
+// than a plain API request, by the presence of apiVersion
+func IsDocument(data []byte) bool {
+	var probe struct {
+		APIVersion *string `json:"apiVersion"`
+	}
+	return json.Unmarshal(data, &probe) == nil && probe.APIVersion != nil
+}
+
+func decode(data []byte) (*Job, error) {
+	var job Job
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, &ValidationError{Fields: []FieldError{{Field: "apiVersion", Message: "is required (the document is empty)"}}}
+	}
+
+	if trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&job); err != nil {
+			return nil, jsonError(err)
+		}
+		return &job, nil
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(trimmed))
+	dec.KnownFields(true)
+	if err := dec.Decode(&job); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid job document: %s", strings.TrimPrefix(err.Error(), "yaml: "))
+	}
+	return &job, nil
+}
+
+// jsonError turns a JSON decoding error into one naming the field at fault
+func jsonError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return &ValidationError{Fields: []FieldError{{
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("must be %s, got %s", typeName(typeErr.Type.Kind().String()), typeErr.Value),
+		}}}
+	}
+	// Unknown fields are reported as `json: unknown field "cpus"`
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return fmt.Errorf("invalid job document: unknown field %s", name)
+	}
+	return fmt.Errorf("invalid job document: %s", strings.TrimPrefix(err.Error(), "json: "))
+}
+
+func typeName(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"):
+		return "an integer"
+	case strings.HasPrefix(kind, "float"):
+		return "a number"
+	case kind == "slice":
+		return "a list"
+	case kind == "map", kind == "struct":
+		return "an object"
+	case kind == "bool":
+		return "true or false"
+	}
+	return "a " + kind
+}
+
+// Payload returns what the agent executes for the job
+func (s *Spec) Payload() Payload {
+	payload := Payload{Env: envList(s.Env)}
+	if s.Container != nil {
+		payload.Image = s.Container.Image
+		payload.Command = s.Container.Command
+	}
+	if s.Binary != nil {
+		payload.BinaryURL = s.Binary.URL
+		payload.Args = s.Binary.Args
+	}
+	if s.Script != nil {
+		payload.Script = s.Script.Source
+		payload.Language = s.Script.Language
+		payload.OutputPath = s.Script.OutputPath
+	}
+	for _, sidecar := range s.Sidecars {
+		payload.Sidecars = append(payload.Sidecars, SidecarPayload{
+			Name:     sidecar.Name,
+			Image:    sidecar.Image,
+			Command:  sidecar.Command,
+			Env:      envList(sidecar.Env),
+			MemoryMB: sidecar.Memory.MB(),
+		})
+	}
+	if vol := s.SharedVolume; vol != nil {
+		payload.SharedVolume = &VolumePayload{MountPath: vol.MountPath, SizeMB: vol.Size.MB(), Medium: vol.Medium}
+	}
+	if checkpoint := s.Checkpoint; checkpoint != nil {
+		payload.Checkpoint = &CheckpointPayload{Command: checkpoint.Command, Signal: checkpoint.Signal}
+	}
+	return payload
+}
+
+// SidecarMemoryMB is the memory the job's sidecars need on top of the main
+// container's
+func (s *Spec) SidecarMemoryMB() int {
+	total := 0
+	for _, sidecar := range s.Sidecars {
+		total += sidecar.Memory.MB()
+	}
+	return total
+}
+
+// envList returns an environment as sorted KEY=value pairs
+func envList(vars map[string]string) []string {
+	if len(vars) == 0 {
+		return nil
+	}
+	env := make([]string, 0, len(vars))
+	for key, value := range vars {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
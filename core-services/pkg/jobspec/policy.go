@@ -0,0 +1,222 @@
+package jobspec
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Policy is what a job payload may contain. Payloads run on third-party
+// provider nodes, so embedded credentials are always rejected; privileged
+// flags and banned images are rejected as the policy says.
+type Policy struct {
+	BannedImages    []string `json:"banned_images,omitempty"` // Image patterns, * matches anything, e.g. *xmrig*
+	AllowPrivileged bool     `json:"allow_privileged"`        // Allow flags that ask for host access, such as --privileged
+}
+
+// Policy rules, reported as FieldError.Rule
+const (
+	RuleSecret         = "secret"
+	RulePrivilegedFlag = "privileged_flag"
+	RuleBannedImage    = "banned_image"
+)
+
+// secretAdvice is how to fix every embedded credential
+const secretAdvice = "credentials in a job are readable by the provider running it; remove it, rotate it, and have the job fetch it at runtime"
+
+// secretPatterns recognise well-known credential formats anywhere in a payload
+var secretPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"an AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"a private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{"a GitHub token", regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}`)},
+	{"a Slack token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"a Stripe live key", regexp.MustCompile(`\b[rs]k_live_[0-9A-Za-z]{20,}`)},
+	{"a Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{"a password in a URL", regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^/\s:@]+:[^/\s@]{3,}@`)},
+}
+
+// secretNameParts mark an environment variable as holding a credential when
+// they appear as a whole _-separated part of its name
+var secretNameParts = map[string]bool{
+	"PASSWORD": true, "PASSWD": true, "SECRET": true, "TOKEN": true, "APIKEY": true, "CREDENTIALS": true,
+}
+
+// secretNameSuffixes mark two-part names such as API_KEY
+var secretNameSuffixes = []string{"API_KEY", "ACCESS_KEY", "PRIVATE_KEY", "AUTH_KEY"}
+
+// privilegedPatterns recognise requests for host access in commands and scripts
+var privilegedPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(^|\s)--privileged\b`),
+	regexp.MustCompile(`(^|\s)--cap-add[ =]\S+`),
+	regexp.MustCompile(`(^|\s)--security-opt[ =]\S+`),
+	regexp.MustCompile(`(^|\s)--device[ =]\S+`),
+	regexp.MustCompile(`(^|\s)--(pid|ipc|uts|net|network|userns)[ =]host\b`),
+	regexp.MustCompile(`/var/run/docker\.sock`),
+	regexp.MustCompile(`(^|\s)nsenter\s`),
+}
+
+// PolicyError lists the findings that stop a payload being accepted. It
+// unwraps to a *ValidationError so callers report it like any invalid field.
+type PolicyError struct {
+	Fields []FieldError
+}
+
+func (e *PolicyError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "job payload violates policy: " + strings.Join(msgs, "; ")
+}
+
+func (e *PolicyError) Unwrap() error {
+	return &ValidationError{Fields: e.Fields}
+}
+
+// CheckPayload scans a payload in the agent's wire format and returns a
+// *PolicyError listing every finding, or nil. Findings never repeat the
+// offending value, so they are safe to log.
+func (p *Policy) CheckPayload(payload []byte) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	var tree interface{}
+	if err := json.Unmarshal(payload, &tree); err != nil {
+		return nil // Payloads that are not JSON have nothing to scan
+	}
+
+	s := &scanner{policy: p}
+	s.walk("payload", "", tree)
+	if len(s.errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(s.errs, func(i, j int) bool { return s.errs[i].Field < s.errs[j].Field })
+	return &PolicyError{Fields: s.errs}
+}
+
+type scanner struct {
+	policy *Policy
+	errs   []FieldError
+}
+
+func (s *scanner) add(field, rule, format string, args ...interface{}) {
+	s.errs = append(s.errs, FieldError{Field: field, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+// walk visits every string in the payload. key is the object key the value
+// sits under, which decides what else is checked.
+func (s *scanner) walk(path, key string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s.walk(path+"."+k, k, v[k])
+		}
+	case []interface{}:
+		for i, item := range v {
+			s.walk(fmt.Sprintf("%s[%d]", path, i), key, item)
+		}
+	case string:
+		s.scan(path, key, v)
+	}
+}
+
+func (s *scanner) scan(path, key, value string) {
+	switch key {
+	case "env":
+		if name, val, ok := strings.Cut(value, "="); ok && secretName(name) && literalSecret(val) {
+			s.add(path, RuleSecret, "%s holds a literal credential; %s", name, secretAdvice)
+			return
+		}
+	case "image":
+		if pattern := s.policy.bannedImage(value); pattern != "" {
+			s.add(path, RuleBannedImage, "image %s is banned by policy (matches %s); use a different image", value, pattern)
+		}
+	}
+
+	for _, secret := range secretPatterns {
+		if secret.pattern.MatchString(value) {
+			s.add(path, RuleSecret, "contains %s; %s", secret.kind, secretAdvice)
+			return
+		}
+	}
+
+	if !s.policy.AllowPrivileged && (key == "command" || key == "args" || key == "script") {
+		for _, pattern := range privilegedPatterns {
+			if match := pattern.FindString(value); match != "" {
+				s.add(path, RulePrivilegedFlag, "requests host access (%s), which jobs are not allowed; remove it", strings.TrimSpace(match))
+				return
+			}
+		}
+	}
+}
+
+// secretName reports whether an environment variable's name says it holds
+// a credential
+func secretName(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, part := range strings.Split(upper, "_") {
+		if secretNameParts[part] {
+			return true
+		}
+	}
+	for _, suffix := range secretNameSuffixes {
+		if upper == suffix || strings.HasSuffix(upper, "_"+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// literalSecret reports whether a value looks like a credential rather than
+// a placeholder, a reference to another variable or a flag
+func literalSecret(value string) bool {
+	if len(value) < 8 || strings.HasPrefix(value, "$") {
+		return false
+	}
+	switch strings.ToLower(value) {
+	case "changeme", "password", "placeholder", "true", "false":
+		return false
+	}
+	return true
+}
+
+// bannedImage returns the banned pattern an image matches, or ""
+func (p *Policy) bannedImage(image string) string {
+	for _, pattern := range p.BannedImages {
+		if globMatch(pattern, image) || globMatch(pattern, image+":latest") {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// globMatch matches s against a pattern where * matches any run of
+// characters, including /
+func globMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
@@ -0,0 +1,63 @@
+package jobspec
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Quantity is an amount of memory or storage written with a binary (Ki, Mi,
+// Gi, Ti) or decimal (K, M, G, T) unit, such as 512Mi. A bare number is
+// bytes.
+type Quantity string
+
+const mebibyte = 1 << 20
+
+var quantityUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+}
+
+// Bytes parses the quantity
+func (q Quantity) Bytes() (int64, error) {
+	s := strings.TrimSpace(string(q))
+	number, multiplier := s, 1.0
+	for _, unit := range quantityUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			number, multiplier = strings.TrimSuffix(s, unit.suffix), unit.bytes
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(number, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, fmt.Errorf("invalid quantity %q: use a number with a unit, such as 512Mi or 4Gi", s)
+	}
+	return int64(math.Ceil(v * multiplier)), nil
+}
+
+// MB returns the quantity in whole mebibytes, rounded up, or 0 when it is
+// empty or invalid
+func (q Quantity) MB() int {
+	bytes, err := q.Bytes()
+	if q == "" || err != nil {
+		return 0
+	}
+	return int((bytes + mebibyte - 1) / mebibyte)
+}
+
+// Duration is a length of time written as a Go duration, such as 90m or 2h
+type Duration string
+
+// Duration parses the duration
+func (d Duration) Duration() (time.Duration, error) {
+	parsed, err := time.ParseDuration(strings.TrimSpace(string(d)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: use a number with a unit, such as 30m or 2h", string(d))
+	}
+	return parsed, nil
+}
@@ -0,0 +1,425 @@
+package jobspec
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/computehive/core-services/pkg/gpuruntime"
+	"github.com/computehive/core-services/pkg/trust"
+)
+
+// Defaults applied to fields a document leaves out. They match what the
+// scheduler assumes for jobs submitted without a document.
+const (
+	DefaultCPU        = 1
+	DefaultMemory     = Quantity("1Gi")
+	DefaultPriority   = 5
+	DefaultTimeout    = Duration("1h")
+	DefaultMaxRetries = 3
+
+	DefaultSidecarMemory    = Quantity("256Mi")
+	DefaultSharedVolumeSize = Quantity("1Gi")
+)
+
+// Limits enforced by Validate
+const (
+	MaxCPU        = 256
+	MinMemoryMB   = 64
+	MaxGPUs       = 16
+	MaxPriority   = 10
+	MaxTimeout    = 7 * 24 * time.Hour
+	MaxRetries    = 10
+	MaxPorts      = 5
+	MaxTags       = 20
+	MaxTagLength  = 256
+	MaxNameLength = 63
+	MaxSidecars   = 4
+)
+
+var (
+	namePattern   = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	tagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+	envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ScriptLanguages lists the languages agents can run scripts in
+var ScriptLanguages = []string{"python", "javascript", "js", "bash", "sh", "ruby", "perl"}
+
+// FieldError is a problem with one field of a document
+type FieldError struct {
+	Field   string `json:"field"` // Path such as spec.resources.memory
+	Message string `json:"message"`
+	Rule    string `json:"rule,omitempty"` // Payload policy rule broken, for policy findings
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError lists every invalid field of a document
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.Error()
+	}
+	return "invalid job document: " + strings.Join(msgs, "; ")
+}
+
+// Default fills in the fields a document left out
+func (j *Job) Default() {
+	spec := &j.Spec
+	if spec.Resources.CPU == 0 {
+		spec.Resources.CPU = DefaultCPU
+	}
+	if spec.Resources.Memory == "" {
+		spec.Resources.Memory = DefaultMemory
+	}
+	if spec.Priority == nil {
+		priority := DefaultPriority
+		spec.Priority = &priority
+	}
+	if spec.Timeout == "" {
+		spec.Timeout = DefaultTimeout
+	}
+	if spec.MaxRetries == 0 {
+		spec.MaxRetries = DefaultMaxRetries
+	}
+	for i := range spec.Ports {
+		port := &spec.Ports[i]
+		if port.Protocol == "" {
+			port.Protocol = "http"
+		}
+		if port.Name == "" && port.Port != 0 {
+			port.Name = fmt.Sprintf("%d", port.Port)
+		}
+	}
+	for i := range spec.Sidecars {
+		if spec.Sidecars[i].Memory == "" {
+			spec.Sidecars[i].Memory = DefaultSidecarMemory
+		}
+	}
+	if vol := spec.SharedVolume; vol != nil {
+		if vol.Size == "" {
+			vol.Size = DefaultSharedVolumeSize
+		}
+		if vol.Medium == "" {
+			vol.Medium = MediumMemory
+		}
+	}
+}
+
+// validator collects field errors
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) addf(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks every field of a defaulted document and returns a
+// *ValidationError listing all problems
+func (j *Job) Validate() error {
+	v := &validator{}
+
+	switch j.APIVersion {
+	case APIVersionV1:
+	case "":
+		v.addf("apiVersion", "is required, use %s", APIVersionV1)
+	default:
+		v.addf("apiVersion", "unsupported version %q, use %s", j.APIVersion, APIVersionV1)
+	}
+	if j.Kind != KindJob {
+		v.addf("kind", "must be %s, got %q", KindJob, j.Kind)
+	}
+
+	v.metadata(&j.Metadata)
+	v.spec(&j.Spec)
+
+	if len(v.errs) > 0 {
+		return &ValidationError{Fields: v.errs}
+	}
+	return nil
+}
+
+func (v *validator) metadata(m *Metadata) {
+	if m.Name != "" && (len(m.Name) > MaxNameLength || !namePattern.MatchString(m.Name)) {
+		v.addf("metadata.name", "must be lowercase letters, digits and '-', starting and ending with a letter or digit (max %d chars)", MaxNameLength)
+	}
+	if len(m.Tags) > MaxTags {
+		v.addf("metadata.tags", "at most %d tags are allowed, got %d", MaxTags, len(m.Tags))
+	}
+	for _, key := range sortedKeys(m.Tags) {
+		if !tagKeyPattern.MatchString(key) {
+			v.addf("metadata.tags."+key, "invalid key: use lowercase letters, digits, '_', '.', '-' (max 63 chars)")
+		} else if len(m.Tags[key]) > MaxTagLength {
+			v.addf("metadata.tags."+key, "value exceeds %d characters", MaxTagLength)
+		}
+	}
+}
+
+func (v *validator) spec(s *Spec) {
+	v.runtime(s)
+
+	for _, key := range sortedKeys(s.Env) {
+		if !envKeyPattern.MatchString(key) {
+			v.addf("spec.env."+key, "invalid variable name: use letters, digits and '_', not starting with a digit")
+		}
+	}
+
+	v.resources(&s.Resources)
+
+	if s.Priority != nil && (*s.Priority < 0 || *s.Priority > MaxPriority) {
+		v.addf("spec.priority", "must be between 0 and %d, got %d", MaxPriority, *s.Priority)
+	}
+	if timeout, err := s.Timeout.Duration(); err != nil {
+		v.addf("spec.timeout", "%v", err)
+	} else if timeout <= 0 || timeout > MaxTimeout {
+		v.addf("spec.timeout", "must be positive and at most %s, got %s", MaxTimeout, s.Timeout)
+	}
+	if s.MaxRetries < 0 || s.MaxRetries > MaxRetries {
+		v.addf("spec.maxRetries", "must be between 0 and %d, got %d", MaxRetries, s.MaxRetries)
+	}
+
+	if s.Placement != "" && (len(s.Placement) > MaxNameLength || !namePattern.MatchString(s.Placement)) {
+		v.addf("spec.placementProfile", "must be a profile name: lowercase letters, digits and '-' (max %d chars)", MaxNameLength)
+	}
+
+	v.ports(s.Ports)
+	v.sidecars(s)
+	v.checkpoint(s)
+
+	if sla := s.SLA; sla != nil {
+		if sla.MaxLatencyMs < 0 {
+			v.addf("spec.sla.maxLatencyMs", "must not be negative")
+		}
+		if sla.MinAvailability < 0 || sla.MinAvailability > 100 {
+			v.addf("spec.sla.minAvailability", "must be a percentage between 0 and 100, got %g", sla.MinAvailability)
+		}
+		if sla.MaxCostPerHour < 0 {
+			v.addf("spec.sla.maxCostPerHour", "must not be negative")
+		}
+	}
+}
+
+// runtime checks the runtime and that exactly its section is set
+func (v *validator) runtime(s *Spec) {
+	want := ""
+	switch s.Runtime {
+	case RuntimeDocker, RuntimeKubernetes:
+		want = "container"
+	case RuntimeBinary, RuntimeWASM:
+		want = "binary"
+	case RuntimeScript:
+		want = "script"
+	case "":
+		v.addf("spec.runtime", "is required, use one of %s", runtimeList())
+	default:
+		v.addf("spec.runtime", "unsupported runtime %q, use one of %s", s.Runtime, runtimeList())
+	}
+
+	sections := []struct {
+		name string
+		set  bool
+	}{{"container", s.Container != nil}, {"binary", s.Binary != nil}, {"script", s.Script != nil}}
+	for _, section := range sections {
+		switch {
+		case section.name == want && !section.set:
+			v.addf("spec."+section.name, "is required for runtime %s", s.Runtime)
+		case section.name != want && section.set && want != "":
+			v.addf("spec."+section.name, "is not used by runtime %s, use spec.%s", s.Runtime, want)
+		}
+	}
+
+	if s.Container != nil && strings.TrimSpace(s.Container.Image) == "" {
+		v.addf("spec.container.image", "is required")
+	}
+	if s.Binary != nil && strings.TrimSpace(s.Binary.URL) == "" {
+		v.addf("spec.binary.url", "is required")
+	}
+	if s.Script != nil {
+		if !containsString(ScriptLanguages, s.Script.Language) {
+			v.addf("spec.script.language", "unsupported language %q, use one of %s", s.Script.Language, strings.Join(ScriptLanguages, ", "))
+		}
+		if strings.TrimSpace(s.Script.Source) == "" {
+			v.addf("spec.script.source", "is required")
+		}
+	}
+}
+
+func (v *validator) resources(r *Resources) {
+	if r.CPU < 1 || r.CPU > MaxCPU {
+		v.addf("spec.resources.cpu", "must be between 1 and %d cores, got %d", MaxCPU, r.CPU)
+	}
+	if _, err := r.Memory.Bytes(); err != nil {
+		v.addf("spec.resources.memory", "%v", err)
+	} else if r.Memory.MB() < MinMemoryMB {
+		v.addf("spec.resources.memory", "must be at least %dMi, got %s", MinMemoryMB, r.Memory)
+	}
+	if r.Storage != "" {
+		if _, err := r.Storage.Bytes(); err != nil {
+			v.addf("spec.resources.storage", "%v", err)
+		}
+	}
+	if gpu := r.GPU; gpu != nil {
+		if gpu.Count < 1 || gpu.Count > MaxGPUs {
+			v.addf("spec.resources.gpu.count", "must be between 1 and %d, got %d", MaxGPUs, gpu.Count)
+		}
+		for _, min := range []struct{ field, version string }{
+			{"minDriverVersion", gpu.MinDriverVersion},
+			{"minCudaVersion", gpu.MinCUDAVersion},
+			{"minRocmVersion", gpu.MinROCmVersion},
+		} {
+			if min.version != "" && !gpuruntime.Valid(min.version) {
+				v.addf("spec.resources.gpu."+min.field, "must be a version such as 12.2, got %q", min.version)
+			}
+		}
+	}
+	if r.NetworkMbps < 0 {
+		v.addf("spec.resources.networkMbps", "must not be negative")
+	}
+	for i, capability := range r.Capabilities {
+		if strings.TrimSpace(capability) == "" {
+			v.addf(fmt.Sprintf("spec.resources.capabilities[%d]", i), "must not be empty")
+		}
+	}
+	if _, err := trust.Parse(r.MinTrustTier); err != nil {
+		v.addf("spec.resources.minTrustTier", "%v", err)
+	}
+}
+
+func (v *validator) ports(ports []Port) {
+	if len(ports) > MaxPorts {
+		v.addf("spec.ports", "at most %d ports are allowed, got %d", MaxPorts, len(ports))
+	}
+	seen := make(map[string]bool)
+	for i, port := range ports {
+		field := fmt.Sprintf("spec.ports[%d]", i)
+		if port.Port < 1 || port.Port > 65535 {
+			v.addf(field+".port", "must be between 1 and 65535, got %d", port.Port)
+		}
+		if port.Protocol != "http" && port.Protocol != "tcp" {
+			v.addf(field+".protocol", "must be http or tcp, got %q", port.Protocol)
+		}
+		if seen[port.Name] {
+			v.addf(field+".name", "duplicate port name %q", port.Name)
+		}
+		seen[port.Name] = true
+	}
+}
+
+// sidecars checks a docker job's sidecars and shared volume. Sidecar names
+// become part of container names, and "pod" is taken by the container that
+// holds the pod's namespaces.
+func (v *validator) sidecars(s *Spec) {
+	if len(s.Sidecars) > 0 && s.Runtime != RuntimeDocker {
+		v.addf("spec.sidecars", "is only supported by runtime %s", RuntimeDocker)
+	}
+	if s.SharedVolume != nil && s.Runtime != RuntimeDocker {
+		v.addf("spec.sharedVolume", "is only supported by runtime %s", RuntimeDocker)
+	}
+	if len(s.Sidecars) > MaxSidecars {
+		v.addf("spec.sidecars", "at most %d sidecars are allowed, got %d", MaxSidecars, len(s.Sidecars))
+	}
+
+	seen := make(map[string]bool)
+	for i, sidecar := range s.Sidecars {
+		field := fmt.Sprintf("spec.sidecars[%d]", i)
+		switch {
+		case sidecar.Name == "":
+			v.addf(field+".name", "is required")
+		case len(sidecar.Name) > MaxNameLength || !namePattern.MatchString(sidecar.Name):
+			v.addf(field+".name", "must be lowercase letters, digits and '-', starting and ending with a letter or digit (max %d chars)", MaxNameLength)
+		case sidecar.Name == "pod":
+			v.addf(field+".name", "%q is reserved", sidecar.Name)
+		case seen[sidecar.Name]:
+			v.addf(field+".name", "duplicate sidecar name %q", sidecar.Name)
+		}
+		seen[sidecar.Name] = true
+
+		if strings.TrimSpace(sidecar.Image) == "" {
+			v.addf(field+".image", "is required")
+		}
+		for _, key := range sortedKeys(sidecar.Env) {
+			if !envKeyPattern.MatchString(key) {
+				v.addf(field+".env."+key, "invalid variable name: use letters, digits and '_', not starting with a digit")
+			}
+		}
+		if _, err := sidecar.Memory.Bytes(); err != nil {
+			v.addf(field+".memory", "%v", err)
+		} else if sidecar.Memory.MB() < MinMemoryMB {
+			v.addf(field+".memory", "must be at least %dMi, got %s", MinMemoryMB, sidecar.Memory)
+		}
+	}
+
+	if vol := s.SharedVolume; vol != nil {
+		switch path := vol.MountPath; {
+		case !strings.HasPrefix(path, "/"):
+			v.addf("spec.sharedVolume.mountPath", "must be an absolute path, got %q", path)
+		case path == "/" || path == "/work" || strings.HasPrefix(path, "/work/"):
+			v.addf("spec.sharedVolume.mountPath", "must not be / or the job directory /work")
+		}
+		if _, err := vol.Size.Bytes(); err != nil {
+			v.addf("spec.sharedVolume.size", "%v", err)
+		} else if vol.Size.MB() < 1 {
+			v.addf("spec.sharedVolume.size", "must be at least 1Mi, got %s", vol.Size)
+		}
+		if vol.Medium != MediumMemory && vol.Medium != MediumDisk {
+			v.addf("spec.sharedVolume.medium", "must be %s or %s, got %q", MediumMemory, MediumDisk, vol.Medium)
+		}
+	}
+}
+
+// checkpoint checks how a docker job saves its state before an OOM kill
+func (v *validator) checkpoint(s *Spec) {
+	checkpoint := s.Checkpoint
+	if checkpoint == nil {
+		return
+	}
+	if s.Runtime != RuntimeDocker {
+		v.addf("spec.checkpoint", "is only supported by runtime %s", RuntimeDocker)
+	}
+	switch {
+	case len(checkpoint.Command) == 0 && checkpoint.Signal == "":
+		v.addf("spec.checkpoint", "must set command or signal")
+	case len(checkpoint.Command) > 0 && checkpoint.Signal != "":
+		v.addf("spec.checkpoint", "must set only one of command and signal")
+	case len(checkpoint.Command) > 0 && strings.TrimSpace(checkpoint.Command[0]) == "":
+		v.addf("spec.checkpoint.command", "must not start with an empty argument")
+	case checkpoint.Signal != "" && !containsString(CheckpointSignals, checkpoint.Signal):
+		v.addf("spec.checkpoint.signal", "must be one of %s, got %q", strings.Join(CheckpointSignals, ", "), checkpoint.Signal)
+	}
+}
+
+func runtimeList() string {
+	names := make([]string, len(Runtimes))
+	for i, runtime := range Runtimes {
+		names[i] = string(runtime)
+	}
+	return strings.Join(names, ", ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+// Package maintenance describes the recurring windows in which providers take
+// their agents down for planned work.
+//
+// A window repeats weekly on the listed days, starting at a local time of
+// day in its time zone and lasting up to a day. The scheduler keeps jobs off
+// agents whose windows they would run into unless the consumer opts in, and
+// the marketplace shows the windows falling within a match so consumers
+// know about planned downtime before it happens.
+package maintenance
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	// Windows name IANA time zones, which minimal images do not ship
+	_ "time/tzdata"
+)
+
+// MaxWindows is the most windows an agent may declare
+const MaxWindows = 14
+
+// maxDurationMinutes keeps windows within a day, so occurrences of one
+// window never overlap each other
+const maxDurationMinutes = 24 * 60
+
+// Window is a weekly recurring maintenance window
+type Window struct {
+	Days            []string `json:"days,omitempty"` // mon, tue, ...; empty means every day
+	Start           string   `json:"start"`          // HH:MM in TimeZone
+	DurationMinutes int      `json:"duration_minutes"`
+	TimeZone        string   `json:"time_zone,omitempty"` // IANA name, default UTC
+	Reason          string   `json:"reason,omitempty"`
+}
+
+// Occurrence is one concrete instance of a window
+type Occurrence struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// Validate checks a set of windows an agent declares
+func Validate(windows []Window) error {
+	if len(windows) > MaxWindows {
+		return fmt.Errorf("at most %d maintenance windows are allowed", MaxWindows)
+	}
+	for i, w := range windows {
+		if err := w.Validate(); err != nil {
+			return fmt.Errorf("windows[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks a window's days, start time, duration and time zone
+func (w Window) Validate() error {
+	for _, day := range w.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown day %q, want mon through sun", day)
+		}
+	}
+	if _, _, err := w.clock(); err != nil {
+		return err
+	}
+	if w.DurationMinutes <= 0 || w.DurationMinutes > maxDurationMinutes {
+		return fmt.Errorf("duration_minutes must be between 1 and %d", maxDurationMinutes)
+	}
+	if _, err := w.location(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Occurrences returns the instances of the window that overlap [from, to),
+// oldest first. Invalid windows have none.
+func (w Window) Occurrences(from, to time.Time) []Occurrence {
+	hour, minute, err := w.clock()
+	if err != nil || w.DurationMinutes <= 0 {
+		return nil
+	}
+	loc, err := w.location()
+	if err != nil {
+		return nil
+	}
+	duration := time.Duration(w.DurationMinutes) * time.Minute
+
+	// Start a day early, since yesterday's occurrence may still be running
+	local := from.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day()-1, 0, 0, 0, 0, loc)
+
+	var occurrences []Occurrence
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !w.on(day.Weekday()) {
+			continue
+		}
+		start := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+		end := start.Add(duration)
+		if start.Before(to) && end.After(from) {
+			occurrences = append(occurrences, Occurrence{Start: start.UTC(), End: end.UTC(), Reason: w.Reason})
+		}
+	}
+	return occurrences
+}
+
+// Upcoming returns the occurrences of all windows that overlap [from, to),
+// ordered by start
+func Upcoming(windows []Window, from, to time.Time) []Occurrence {
+	var occurrences []Occurrence
+	for _, w := range windows {
+		occurrences = append(occurrences, w.Occurrences(from, to)...)
+	}
+	sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].Start.Before(occurrences[j].Start) })
+	return occurrences
+}
+
+// Overlap returns the first occurrence overlapping [from, to), or nil if the
+// period is clear of maintenance
+func Overlap(windows []Window, from, to time.Time) *Occurrence {
+	if occurrences := Upcoming(windows, from, to); len(occurrences) > 0 {
+		return &occurrences[0]
+	}
+	return nil
+}
+
+// Active returns the occurrence in progress at t, or nil
+func Active(windows []Window, t time.Time) *Occurrence {
+	return Overlap(windows, t, t.Add(time.Nanosecond))
+}
+
+func (w Window) on(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, name := range w.Days {
+		if weekday, ok := weekdays[strings.ToLower(name)]; ok && weekday == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (w Window) clock() (int, int, error) {
+	t, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid start %q, want HH:MM", w.Start)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+func (w Window) location() (*time.Location, error) {
+	if w.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", w.TimeZone)
+	}
+	return loc, nil
+}
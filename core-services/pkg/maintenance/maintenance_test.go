@@ -0,0 +1,64 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOccurrences(t *testing.T) {
+	// Sundays 23:00-01:00 UTC, spanning midnight
+	window := Window{Days: []string{"sun"}, Start: "23:00", DurationMinutes: 120}
+
+	// 2024-06-03 is a Monday; Sunday's occurrence is still running at 00:30
+	monday := time.Date(2024, 6, 3, 0, 30, 0, 0, time.UTC)
+	active := Active([]Window{window}, monday)
+	if active == nil || !active.Start.Equal(time.Date(2024, 6, 2, 23, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Expected the Sunday occurrence to be active, got %+v", active)
+	}
+	if Active([]Window{window}, monday.Add(time.Hour)) != nil {
+		t.Error("Window should have ended at 01:00")
+	}
+
+	week := window.Occurrences(monday, monday.Add(14*24*time.Hour))
+	if len(week) != 3 {
+		t.Fatalf("Expected 3 occurrences over two weeks, got %d", len(week))
+	}
+	for _, occurrence := range week[1:] {
+		if occurrence.Start.Weekday() != time.Sunday || occurrence.End.Sub(occurrence.Start) != 2*time.Hour {
+			t.Errorf("Unexpected occurrence %+v", occurrence)
+		}
+	}
+}
+
+func TestOverlapTimeZone(t *testing.T) {
+	// Daily 02:00-03:00 in New York is 06:00-07:00 UTC in summer
+	windows := []Window{{Start: "02:00", DurationMinutes: 60, TimeZone: "America/New_York"}}
+	morning := time.Date(2024, 6, 3, 4, 0, 0, 0, time.UTC)
+
+	if Overlap(windows, morning, morning.Add(time.Hour)) != nil {
+		t.Error("A run ending 05:00 UTC should not overlap")
+	}
+	overlap := Overlap(windows, morning, morning.Add(3*time.Hour))
+	if overlap == nil || overlap.Start.Hour() != 6 {
+		t.Errorf("Expected an overlap starting 06:00 UTC, got %+v", overlap)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := []Window{{Days: []string{"Sat", "sunday"}, Start: "01:30", DurationMinutes: 90, TimeZone: "Europe/Berlin"}}
+	if err := Validate(valid); err != nil {
+		t.Errorf("Valid windows rejected: %v", err)
+	}
+
+	for name, w := range map[string]Window{
+		"day":       {Days: []string{"funday"}, Start: "01:00", DurationMinutes: 60},
+		"start":     {Start: "25:00", DurationMinutes: 60},
+		"duration":  {Start: "01:00", DurationMinutes: 0},
+		"too long":  {Start: "01:00", DurationMinutes: 24*60 + 1},
+		"time zone": {Start: "01:00", DurationMinutes: 60, TimeZone: "Mars/Olympus"},
+	} {
+		if err := Validate([]Window{w}); err == nil {
+			t.Errorf("%s: invalid window accepted", name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package obs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Debug targets last 15 minutes unless asked otherwise, and never more than a day
+const (
+	defaultDebugTTL = 15 * time.Minute
+	maxDebugTTL     = 24 * time.Hour
+)
+
+// LogConfig is the runtime logging configuration of a service
+type LogConfig struct {
+	Service      string             `json:"service"`
+	Level        string             `json:"level"`
+	Sampling     map[string]float64 `json:"sampling"` // Level -> fraction of records kept
+	DebugTargets []DebugTarget      `json:"debug_targets"`
+}
+
+// LogConfigUpdate changes part of the logging configuration. Omitted fields
+// are left alone.
+type LogConfigUpdate struct {
+	Level        *string            `json:"level,omitempty"`
+	Sampling     map[string]float64 `json:"sampling,omitempty"` // A rate of 1 removes sampling
+	DebugTargets []struct {
+		UserID string `json:"user_id"`
+		JobID  string `json:"job_id"`
+		TTL    string `json:"ttl"` // e.g. "30m"
+	} `json:"debug_targets,omitempty"`
+	ClearDebugTargets bool `json:"clear_debug_targets,omitempty"`
+}
+
+// Config returns the current configuration
+func (c *LogControl) Config() LogConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	cfg := LogConfig{
+		Service:      c.service,
+		Level:        levelName(c.Level()),
+		Sampling:     make(map[string]float64, len(c.sampling)),
+		DebugTargets: c.activeTargets(time.Now()),
+	}
+	for level, rate := range c.sampling {
+		cfg.Sampling[levelName(level)] = rate
+	}
+	sort.Slice(cfg.DebugTargets, func(i, j int) bool {
+		return cfg.DebugTargets[i].ExpiresAt.Before(cfg.DebugTargets[j].ExpiresAt)
+	})
+	return cfg
+}
+
+// Apply validates an update in full before changing anything
+func (c *LogControl) Apply(update LogConfigUpdate) error {
+	var level slog.Level
+	if update.Level != nil {
+		var err error
+		if level, err = parseLevel(*update.Level); err != nil {
+			return err
+		}
+	}
+
+	sampling := make(map[slog.Level]float64, len(update.Sampling))
+	for name, rate := range update.Sampling {
+		l, err := parseLevel(name)
+		if err != nil {
+			return err
+		}
+		if l >= slog.LevelError {
+			return fmt.Errorf("errors are never sampled")
+		}
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("sampling rate for %s must be between 0 and 1", name)
+		}
+		sampling[l] = rate
+	}
+
+	ttls := make([]time.Duration, len(update.DebugTargets))
+	for i, target := range update.DebugTargets {
+		if target.UserID == "" && target.JobID == "" {
+			return fmt.Errorf("debug target needs a user_id or job_id")
+		}
+		ttls[i] = defaultDebugTTL
+		if target.TTL != "" {
+			ttl, err := time.ParseDuration(target.TTL)
+			if err != nil || ttl <= 0 {
+				return fmt.Errorf("invalid debug target ttl %q", target.TTL)
+			}
+			if ttl > maxDebugTTL {
+				return fmt.Errorf("debug target ttl may not exceed %s", maxDebugTTL)
+			}
+			ttls[i] = ttl
+		}
+	}
+
+	if update.Level != nil {
+		c.SetLevel(level)
+	}
+	for l, rate := range sampling {
+		c.SetSampling(l, rate)
+	}
+	if update.ClearDebugTargets {
+		c.ClearDebugTargets()
+	}
+	for i, target := range update.DebugTargets {
+		c.AddDebugTarget(target.UserID, target.JobID, ttls[i])
+	}
+	return nil
+}
+
+// Handler serves GET (read) and PUT (update) for the logging configuration.
+// isAdmin decides who may use it; services pass a check on their own claims.
+func (c *LogControl) Handler(isAdmin func(r *http.Request) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(r) {
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut:
+			var update LogConfigUpdate
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			if err := c.Apply(update); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			slog.Warn("Logging configuration changed", "level", levelName(c.Level()))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Config())
+	}
+}
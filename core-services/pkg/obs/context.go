@@ -0,0 +1,122 @@
+package obs
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Standard attribute keys. KeyUserID and KeyJobID are defined with the
+// debug targets in logging.go.
+const (
+	KeyService   = "service"
+	KeyRequestID = "request_id"
+	KeyTenant    = "tenant"
+	KeyCode      = "code"
+	KeyError     = "error"
+)
+
+// fields are the standard fields carried by a context
+type fields struct {
+	requestID string
+	tenant    string
+	userID    string
+	jobID     string
+}
+
+type fieldsKey struct{}
+
+// requestScope collects the fields set anywhere while serving a request, so
+// Middleware's access log carries the caller that auth identified
+type requestScope struct {
+	mu     sync.Mutex
+	fields fields
+}
+
+type scopeKey struct{}
+
+func (s *requestScope) get() fields {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fields
+}
+
+func fieldsFrom(ctx context.Context) fields {
+	if ctx == nil {
+		return fields{}
+	}
+	f, _ := ctx.Value(fieldsKey{}).(fields)
+	return f
+}
+
+func withFields(ctx context.Context, update func(*fields)) context.Context {
+	f := fieldsFrom(ctx)
+	update(&f)
+	if scope, ok := ctx.Value(scopeKey{}).(*requestScope); ok {
+		scope.mu.Lock()
+		update(&scope.fields)
+		scope.mu.Unlock()
+	}
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// WithRequestID tags a context with the request it serves
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return withFields(ctx, func(f *fields) { f.requestID = id })
+}
+
+// WithTenant tags a context with the tenant it acts for: the caller's
+// organization, or the caller themselves outside one
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return withFields(ctx, func(f *fields) { f.tenant = tenant })
+}
+
+// WithUserID tags a context with the calling user
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return withFields(ctx, func(f *fields) { f.userID = userID })
+}
+
+// WithJobID tags a context with the job being worked on
+func WithJobID(ctx context.Context, jobID string) context.Context {
+	return withFields(ctx, func(f *fields) { f.jobID = jobID })
+}
+
+// WithCaller tags a context with an authenticated caller. The tenant is the
+// caller's organization, or the caller outside one.
+func WithCaller(ctx context.Context, userID, orgID string) context.Context {
+	tenant := orgID
+	if tenant == "" {
+		tenant = userID
+	}
+	return withFields(ctx, func(f *fields) {
+		f.userID = userID
+		f.tenant = tenant
+	})
+}
+
+// RequestID returns the request a context serves, if any
+func RequestID(ctx context.Context) string {
+	return fieldsFrom(ctx).requestID
+}
+
+// Caller returns the user and tenant a context acts for, if any
+func Caller(ctx context.Context) (userID, tenant string) {
+	f := fieldsFrom(ctx)
+	return f.userID, f.tenant
+}
+
+// attrs returns the context's fields as log attributes
+func (f fields) attrs() []slog.Attr {
+	attrs := make([]slog.Attr, 0, 4)
+	for _, a := range []slog.Attr{
+		slog.String(KeyRequestID, f.requestID),
+		slog.String(KeyTenant, f.tenant),
+		slog.String(KeyUserID, f.userID),
+		slog.String(KeyJobID, f.jobID),
+	} {
+		if a.Value.String() != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,146 @@
+package obs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// Code is a machine-readable error category, stable across services
+type Code string
+
+const (
+	CodeInvalidArgument    Code = "invalid_argument"    // The request is malformed or fails validation
+	CodeUnauthenticated    Code = "unauthenticated"     // No valid credentials
+	CodePermissionDenied   Code = "permission_denied"   // Credentials lack the required role or ownership
+	CodeNotFound           Code = "not_found"           // The referenced resource does not exist
+	CodeConflict           Code = "conflict"            // The resource's state does not allow the change
+	CodeResourceExhausted  Code = "resource_exhausted"  // A quota, limit or rate was hit
+	CodeFailedPrecondition Code = "failed_precondition" // The system is not in a state to serve the request
+	CodeUnavailable        Code = "unavailable"         // A dependency is down; retrying may succeed
+	CodeUpstream           Code = "upstream_error"      // A dependency rejected or failed the call
+	CodeInternal           Code = "internal"            // A bug or unexpected failure
+)
+
+// HeaderErrorCode carries the Code of an HTTP error response
+const HeaderErrorCode = "X-Error-Code"
+
+// Status returns the HTTP status for a code
+func (c Code) Status() int {
+	switch c {
+	case CodeInvalidArgument:
+		return http.StatusBadRequest
+	case CodeUnauthenticated:
+		return http.StatusUnauthorized
+	case CodePermissionDenied:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeConflict:
+		return http.StatusConflict
+	case CodeResourceExhausted:
+		return http.StatusTooManyRequests
+	case CodeFailedPrecondition:
+		return http.StatusPreconditionFailed
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeUpstream:
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForStatus is the inverse of Code.Status, used for responses written
+// without a coded error
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge:
+		return CodeInvalidArgument
+	case http.StatusUnauthorized:
+		return CodeUnauthenticated
+	case http.StatusForbidden:
+		return CodePermissionDenied
+	case http.StatusNotFound, http.StatusGone:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests, http.StatusPaymentRequired:
+		return CodeResourceExhausted
+	case http.StatusPreconditionFailed:
+		return CodeFailedPrecondition
+	case http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return CodeUnavailable
+	case http.StatusBadGateway:
+		return CodeUpstream
+	}
+	return CodeInternal
+}
+
+// Error is an error with a code. Its message is safe to show to callers,
+// except for CodeInternal errors.
+type Error struct {
+	Code    Code
+	Message string // Defaults to the cause's message
+	Err     error  // Underlying cause, if any
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Errorf creates a coded error. A %w verb wraps the cause as with fmt.Errorf.
+func Errorf(code Code, format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	return &Error{Code: code, Message: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// Wrap attaches a code to an existing error, keeping its message
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf returns the code of the outermost coded error in err's chain.
+// Uncoded errors are internal, except context cancellation and timeouts.
+func CodeOf(err error) Code {
+	var coded *Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &coded):
+		return coded.Code
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
+
+// message returns what callers are shown for an error
+func message(err error) string {
+	var coded *Error
+	if !errors.As(err, &coded) || coded.Code == CodeInternal {
+		return "Internal server error"
+	}
+	return coded.Error()
+}
+
+// LogError logs a failed operation with its code at error level, or at warn
+// for errors a caller caused
+func LogError(ctx context.Context, msg string, err error, args ...interface{}) {
+	level := slog.LevelError
+	switch CodeOf(err) {
+	case CodeInvalidArgument, CodeUnauthenticated, CodePermissionDenied, CodeNotFound, CodeConflict, CodeResourceExhausted:
+		level = slog.LevelWarn
+	}
+	args = append(args, KeyCode, CodeOf(err), KeyError, err)
+	slog.Log(ctx, level, msg, args...)
+}
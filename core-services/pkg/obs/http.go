@@ -0,0 +1,159 @@
+package obs
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HeaderRequestID carries the request ID; the gateway sets it on proxied
+// requests
+const HeaderRequestID = "X-Request-ID"
+
+// Middleware tags each request's context with its request ID, echoes the ID
+// in the response, gives every error response an X-Error-Code and logs the
+// request once it completes: errors at error, rejected requests at info and
+// the rest at debug.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(HeaderRequestID)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		w.Header().Set(HeaderRequestID, requestID)
+
+		rec := &statusRecorder{ResponseWriter: w}
+		ctx := WithRequestID(r.Context(), requestID)
+		scope := &requestScope{fields: fieldsFrom(ctx)}
+		ctx = context.WithValue(ctx, scopeKey{}, scope)
+		start := time.Now()
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		level := slog.LevelDebug
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+		}
+		if status >= http.StatusBadRequest {
+			level = slog.LevelInfo
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			attrs = append(attrs, slog.String(KeyCode, rec.Header().Get(HeaderErrorCode)))
+		}
+		ctx = context.WithValue(ctx, fieldsKey{}, scope.get())
+		slog.LogAttrs(ctx, level, "HTTP request", attrs...)
+	})
+}
+
+// WriteError writes an error response with the status and X-Error-Code of
+// err's code. Internal errors are logged and their details withheld.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	code := CodeOf(err)
+	if code == CodeInternal {
+		slog.ErrorContext(r.Context(), "Request failed", KeyError, err)
+	}
+	w.Header().Set(HeaderErrorCode, string(code))
+	http.Error(w, message(err), code.Status())
+}
+
+// Transport returns a client transport that forwards the request ID of each
+// request's context, so calls to other services share the caller's ID. A
+// nil base uses http.DefaultTransport.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripper{base}
+}
+
+type roundTripper struct{ base http.RoundTripper }
+
+func (t roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := RequestID(req.Context()); id != "" && req.Header.Get(HeaderRequestID) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(HeaderRequestID, id)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// ResponseError turns an error response from another service into an error
+// with the same code, described by the response body
+func ResponseError(resp *http.Response, format string, args ...interface{}) error {
+	code := Code(resp.Header.Get(HeaderErrorCode))
+	if code == "" {
+		code = CodeForStatus(resp.StatusCode)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	msg := fmt.Sprintf(format, args...)
+	if detail := strings.TrimSpace(string(body)); detail != "" {
+		msg += ": " + detail
+	}
+	return &Error{Code: code, Message: msg}
+}
+
+// statusRecorder remembers the status of a response and fills in its error
+// code. It passes hijacking and flushing through for WebSockets and streams.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+		if status >= http.StatusBadRequest && rec.Header().Get(HeaderErrorCode) == "" {
+			rec.Header().Set(HeaderErrorCode, string(CodeForStatus(status)))
+		}
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
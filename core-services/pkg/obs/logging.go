@@ -0,0 +1,284 @@
+// Package obs provides the logging, error codes and request tracing shared
+// by the ComputeHive core services.
+//
+// Init installs a JSON slog logger as the process default, so the standard
+// log package is routed through it too. Records logged with a context (the
+// slog ...Context functions) carry the standard fields attached to it:
+// request_id, tenant, user_id and job_id. Middleware and MessageContext
+// attach them for HTTP requests and NATS messages.
+//
+// Errors wrapped with a Code keep a machine-readable category that
+// WriteError maps to an HTTP status and the X-Error-Code header.
+//
+// What gets written is controlled at runtime through Logging:
+//
+//   - a minimum level
+//   - debug targets: records carrying a targeted user_id or job_id are kept
+//     at any level until the target expires
+//   - per-level sampling rates that keep a fraction of routine records;
+//     errors are never sampled
+package obs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attribute keys that debug targets match against
+const (
+	KeyUserID = "user_id"
+	KeyJobID  = "job_id"
+)
+
+// DebugTarget enables debug logging for one user or job until it expires
+type DebugTarget struct {
+	UserID    string    `json:"user_id,omitempty"`
+	JobID     string    `json:"job_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// LogControl holds the runtime logging settings of a service
+type LogControl struct {
+	service  string
+	level    slog.LevelVar
+	mu       sync.RWMutex
+	sampling map[slog.Level]float64 // Fraction of records kept; absent means all
+	targets  []DebugTarget
+}
+
+// Logging is the control installed by Init
+var Logging = &LogControl{sampling: make(map[slog.Level]float64)}
+
+// Init installs the service's logger as the process default. The starting
+// level comes from LOG_LEVEL (debug, info, warn, error; default info).
+func Init(service string) *slog.Logger {
+	return initLogger(service, os.Stderr)
+}
+
+func initLogger(service string, w io.Writer) *slog.Logger {
+	Logging.service = service
+	if level, err := parseLevel(os.Getenv("LOG_LEVEL")); err == nil {
+		Logging.level.Set(level)
+	}
+
+	// The handler filters by level itself, so the inner handler lets everything through
+	inner := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug - 4})
+	logger := slog.New(&controlledHandler{control: Logging, next: inner}).With(KeyService, service)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// Fatal logs an error that leaves the service unable to run and exits
+func Fatal(msg string, err error) {
+	slog.Error(msg, KeyError, err)
+	os.Exit(1)
+}
+
+// Level returns the current minimum level
+func (c *LogControl) Level() slog.Level {
+	return c.level.Level()
+}
+
+// SetLevel changes the minimum level
+func (c *LogControl) SetLevel(level slog.Level) {
+	c.level.Set(level)
+}
+
+// SetSampling sets the fraction of records kept at a level. Errors are
+// always kept.
+func (c *LogControl) SetSampling(level slog.Level, rate float64) error {
+	if level >= slog.LevelError {
+		return fmt.Errorf("errors are never sampled")
+	}
+	if rate < 0 || rate > 1 {
+		return fmt.Errorf("sampling rate must be between 0 and 1")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rate == 1 {
+		delete(c.sampling, level)
+	} else {
+		c.sampling[level] = rate
+	}
+	return nil
+}
+
+// AddDebugTarget enables debug logging for a user or job for ttl
+func (c *LogControl) AddDebugTarget(userID, jobID string, ttl time.Duration) DebugTarget {
+	target := DebugTarget{UserID: userID, JobID: jobID, ExpiresAt: time.Now().Add(ttl)}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = append(c.activeTargets(time.Now()), target)
+	return target
+}
+
+// ClearDebugTargets removes every debug target
+func (c *LogControl) ClearDebugTargets() {
+	c.mu.Lock()
+	c.targets = nil
+	c.mu.Unlock()
+}
+
+// activeTargets returns the unexpired targets. Callers hold c.mu.
+func (c *LogControl) activeTargets(now time.Time) []DebugTarget {
+	active := make([]DebugTarget, 0, len(c.targets))
+	for _, target := range c.targets {
+		if now.Before(target.ExpiresAt) {
+			active = append(active, target)
+		}
+	}
+	return active
+}
+
+// targeted reports whether a record with these IDs matches a debug target
+func (c *LogControl) targeted(userID, jobID string) bool {
+	if userID == "" && jobID == "" {
+		return false
+	}
+	now := time.Now()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, target := range c.targets {
+		if !now.Before(target.ExpiresAt) {
+			continue
+		}
+		if (target.UserID != "" && target.UserID == userID) || (target.JobID != "" && target.JobID == jobID) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTargets reports whether any debug target is active
+func (c *LogControl) hasTargets() bool {
+	now := time.Now()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, target := range c.targets {
+		if now.Before(target.ExpiresAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// sampled reports whether a record at level survives sampling
+func (c *LogControl) sampled(level slog.Level) bool {
+	if level >= slog.LevelError {
+		return true
+	}
+
+	c.mu.RLock()
+	rate, limited := c.sampling[level]
+	c.mu.RUnlock()
+	return !limited || rand.Float64() < rate
+}
+
+// controlledHandler applies a LogControl in front of another handler
+type controlledHandler struct {
+	control *LogControl
+	next    slog.Handler
+	userID  string // Set by With(KeyUserID, ...)
+	jobID   string // Set by With(KeyJobID, ...)
+	grouped bool   // Attributes added after WithGroup are not top-level
+}
+
+func (h *controlledHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	// Below the level a record may still match a debug target
+	return level >= h.control.Level() || h.control.hasTargets()
+}
+
+func (h *controlledHandler) Handle(ctx context.Context, r slog.Record) error {
+	userID, jobID := h.userID, h.jobID
+	if !h.grouped {
+		r.Attrs(func(a slog.Attr) bool {
+			switch a.Key {
+			case KeyUserID:
+				userID = a.Value.String()
+			case KeyJobID:
+				jobID = a.Value.String()
+			}
+			return true
+		})
+	}
+
+	// Fields carried by the context fill in what the record does not say
+	f := fieldsFrom(ctx)
+	if userID != "" {
+		f.userID = ""
+	} else {
+		userID = f.userID
+	}
+	if jobID != "" {
+		f.jobID = ""
+	} else {
+		jobID = f.jobID
+	}
+	if attrs := f.attrs(); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+
+	if h.control.targeted(userID, jobID) {
+		return h.next.Handle(ctx, r)
+	}
+	if r.Level < h.control.Level() || !h.control.sampled(r.Level) {
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *controlledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	for _, a := range attrs {
+		if h.grouped {
+			break
+		}
+		switch a.Key {
+		case KeyUserID:
+			clone.userID = a.Value.String()
+		case KeyJobID:
+			clone.jobID = a.Value.String()
+		}
+	}
+	clone.next = h.next.WithAttrs(attrs)
+	return &clone
+}
+
+func (h *controlledHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.grouped = true
+	clone.next = h.next.WithGroup(name)
+	return &clone
+}
+
+// parseLevel reads a level name
+func parseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// levelName is the inverse of parseLevel
+func levelName(level slog.Level) string {
+	return strings.ToLower(level.String())
+}
@@ -0,0 +1,134 @@
+package obs
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLogger resets Logging and returns a logger writing to a buffer
+func newTestLogger(t *testing.T) (*slog.Logger, *bytes.Buffer) {
+	t.Helper()
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	Logging.SetLevel(slog.LevelInfo)
+	Logging.ClearDebugTargets()
+	Logging.mu.Lock()
+	Logging.sampling = make(map[slog.Level]float64)
+	Logging.mu.Unlock()
+
+	var buf bytes.Buffer
+	return initLogger("test-service", &buf), &buf
+}
+
+func TestLevel(t *testing.T) {
+	logger, buf := newTestLogger(t)
+
+	logger.Debug("hidden")
+	logger.Info("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Fatalf("Unexpected output at info level: %s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `"service":"test-service"`) {
+		t.Errorf("Records should carry the service: %s", buf.String())
+	}
+
+	buf.Reset()
+	Logging.SetLevel(slog.LevelDebug)
+	logger.Debug("now shown")
+	if !strings.Contains(buf.String(), "now shown") {
+		t.Errorf("Debug record should be written after lowering the level")
+	}
+}
+
+func TestDebugTargets(t *testing.T) {
+	logger, buf := newTestLogger(t)
+	Logging.AddDebugTarget("", "job-1", time.Minute)
+
+	logger.Debug("other job", KeyJobID, "job-2")
+	logger.Debug("targeted job", KeyJobID, "job-1")
+	logger.With(KeyJobID, "job-1").Debug("targeted via With")
+	logger.WithGroup("req").Debug("grouped", KeyJobID, "job-1")
+
+	out := buf.String()
+	if strings.Contains(out, "other job") || strings.Contains(out, "grouped") {
+		t.Errorf("Untargeted records should be dropped: %s", out)
+	}
+	if !strings.Contains(out, "targeted job") || !strings.Contains(out, "targeted via With") {
+		t.Errorf("Targeted records should be written: %s", out)
+	}
+
+	buf.Reset()
+	Logging.ClearDebugTargets()
+	Logging.AddDebugTarget("user-1", "", -time.Second)
+	logger.Debug("expired", KeyUserID, "user-1")
+	if buf.Len() != 0 {
+		t.Errorf("Expired target should not match: %s", buf.String())
+	}
+}
+
+func TestSampling(t *testing.T) {
+	logger, buf := newTestLogger(t)
+
+	if err := Logging.SetSampling(slog.LevelError, 0.5); err == nil {
+		t.Error("Errors should not be sampled")
+	}
+	if err := Logging.SetSampling(slog.LevelInfo, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	logger.Info("sampled out")
+	logger.Error("kept")
+	if strings.Contains(buf.String(), "sampled out") || !strings.Contains(buf.String(), "kept") {
+		t.Errorf("Unexpected output with info sampled out: %s", buf.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	newTestLogger(t)
+	allow := func(r *http.Request) bool { return r.Header.Get("X-Admin") == "yes" }
+	handler := Logging.Handler(allow)
+
+	put := func(body string, admin bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/admin/logging", strings.NewReader(body))
+		if admin {
+			req.Header.Set("X-Admin", "yes")
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	if rec := put(`{"level":"debug"}`, false); rec.Code != http.StatusForbidden {
+		t.Errorf("Non-admin update returned %d", rec.Code)
+	}
+
+	// A bad field rejects the whole update
+	if rec := put(`{"level":"debug","sampling":{"info":2}}`, true); rec.Code != http.StatusBadRequest {
+		t.Errorf("Invalid sampling rate returned %d", rec.Code)
+	}
+	if Logging.Level() != slog.LevelInfo {
+		t.Errorf("Rejected update changed the level to %s", Logging.Level())
+	}
+
+	rec := put(`{"level":"debug","sampling":{"info":0.25},"debug_targets":[{"user_id":"user-1","ttl":"30m"}]}`, true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Update returned %d: %s", rec.Code, rec.Body.String())
+	}
+	cfg := Logging.Config()
+	if cfg.Level != "debug" || cfg.Sampling["info"] != 0.25 || len(cfg.DebugTargets) != 1 {
+		t.Errorf("Unexpected config after update: %+v", cfg)
+	}
+
+	if rec := put(`{"debug_targets":[{"user_id":"user-2","ttl":"48h"}]}`, true); rec.Code != http.StatusBadRequest {
+		t.Errorf("Over-long ttl returned %d", rec.Code)
+	}
+	if rec := put(`{"clear_debug_targets":true}`, true); rec.Code != http.StatusOK || len(Logging.Config().DebugTargets) != 0 {
+		t.Errorf("Clearing targets failed: %d", rec.Code)
+	}
+}
@@ -0,0 +1,75 @@
+package obs
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS headers carrying the standard fields from publisher to subscriber
+const (
+	natsHeaderRequestID = "Computehive-Request-Id"
+	natsHeaderTenant    = "Computehive-Tenant"
+	natsHeaderUserID    = "Computehive-User-Id"
+	natsHeaderJobID     = "Computehive-Job-Id"
+)
+
+// NewMsg creates a message carrying ctx's standard fields in its headers
+func NewMsg(ctx context.Context, subject string, data []byte) *nats.Msg {
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	f := fieldsFrom(ctx)
+	for header, value := range map[string]string{
+		natsHeaderRequestID: f.requestID,
+		natsHeaderTenant:    f.tenant,
+		natsHeaderUserID:    f.userID,
+		natsHeaderJobID:     f.jobID,
+	} {
+		if value != "" {
+			msg.Header.Set(header, value)
+		}
+	}
+	return msg
+}
+
+// MessageContext returns a context carrying the standard fields of a
+// message's headers. A message without a request ID gets a new one, so
+// everything logged while handling it can be correlated.
+func MessageContext(msg *nats.Msg) context.Context {
+	f := fields{}
+	if msg.Header != nil {
+		f = fields{
+			requestID: msg.Header.Get(natsHeaderRequestID),
+			tenant:    msg.Header.Get(natsHeaderTenant),
+			userID:    msg.Header.Get(natsHeaderUserID),
+			jobID:     msg.Header.Get(natsHeaderJobID),
+		}
+	}
+	if f.requestID == "" {
+		f.requestID = newRequestID()
+	}
+	return context.WithValue(context.Background(), fieldsKey{}, f)
+}
+
+// NATSHandler adapts a handler for a core NATS subscription. The handler
+// gets the message's context; errors and panics are logged with their code
+// instead of being dropped or crashing the service.
+func NATSHandler(handler func(ctx context.Context, msg *nats.Msg) error) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		ctx := MessageContext(msg)
+		if err := Recover(func() error { return handler(ctx, msg) }); err != nil {
+			slog.ErrorContext(ctx, "Message handler failed", "subject", msg.Subject, KeyCode, CodeOf(err), KeyError, err)
+		}
+	}
+}
+
+// Recover runs fn, turning a panic into an internal error
+func Recover(fn func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = Errorf(CodeInternal, "panic: %v", p)
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,177 @@
+package obs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestCodeOf(t *testing.T) {
+	cause := errors.New("connection refused")
+	cases := []struct {
+		err  error
+		want Code
+	}{
+		{nil, ""},
+		{errors.New("boom"), CodeInternal},
+		{Errorf(CodeNotFound, "quote not found"), CodeNotFound},
+		{fmt.Errorf("redeem: %w", Errorf(CodeConflict, "quote expired")), CodeConflict},
+		{Wrap(CodeUnavailable, cause), CodeUnavailable},
+		{fmt.Errorf("query: %w", context.DeadlineExceeded), CodeUnavailable},
+	}
+	for _, c := range cases {
+		if got := CodeOf(c.err); got != c.want {
+			t.Errorf("CodeOf(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+
+	wrapped := Errorf(CodeUpstream, "failed to reach marketplace: %w", cause)
+	if !errors.Is(wrapped, cause) {
+		t.Error("Errorf should wrap a %w cause")
+	}
+	if wrapped.Error() != "failed to reach marketplace: connection refused" {
+		t.Errorf("Unexpected message %q", wrapped.Error())
+	}
+}
+
+func TestCodeStatusRoundTrip(t *testing.T) {
+	for _, code := range []Code{CodeInvalidArgument, CodeUnauthenticated, CodePermissionDenied, CodeNotFound,
+		CodeConflict, CodeResourceExhausted, CodeFailedPrecondition, CodeUnavailable, CodeUpstream, CodeInternal} {
+		if got := CodeForStatus(code.Status()); got != code {
+			t.Errorf("CodeForStatus(%d) = %q, want %q", code.Status(), got, code)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	newTestLogger(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	rec := httptest.NewRecorder()
+	WriteError(rec, req, Errorf(CodeNotFound, "quote not found"))
+	if rec.Code != http.StatusNotFound || rec.Header().Get(HeaderErrorCode) != "not_found" {
+		t.Errorf("Unexpected response %d %q", rec.Code, rec.Header().Get(HeaderErrorCode))
+	}
+	if strings.TrimSpace(rec.Body.String()) != "quote not found" {
+		t.Errorf("Unexpected body %q", rec.Body.String())
+	}
+
+	// Internal details stay in the logs
+	rec = httptest.NewRecorder()
+	WriteError(rec, req, errors.New("pq: connection reset"))
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "pq") {
+		t.Errorf("Internal error leaked: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	_, buf := newTestLogger(t)
+
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Auth identifies the caller further in
+		r = r.WithContext(WithCaller(r.Context(), "user-1", "org-1"))
+		if RequestID(r.Context()) != "req-1" {
+			t.Errorf("Handler saw request ID %q", RequestID(r.Context()))
+		}
+		http.Error(w, "Job not found", http.StatusNotFound)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/jobs/1", nil)
+	req.Header.Set(HeaderRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get(HeaderRequestID) != "req-1" {
+		t.Errorf("Request ID not echoed: %q", rec.Header().Get(HeaderRequestID))
+	}
+	if rec.Header().Get(HeaderErrorCode) != "not_found" {
+		t.Errorf("Error code not set: %q", rec.Header().Get(HeaderErrorCode))
+	}
+
+	out := buf.String()
+	for _, want := range []string{`"request_id":"req-1"`, `"user_id":"user-1"`, `"tenant":"org-1"`, `"status":404`, `"code":"not_found"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Access log missing %s: %s", want, out)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var got string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get(HeaderRequestID)
+		w.Header().Set(HeaderErrorCode, string(CodeConflict))
+		http.Error(w, "quote already redeemed", http.StatusConflict)
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: Transport(nil)}
+	req, _ := http.NewRequestWithContext(WithRequestID(context.Background(), "req-2"), "POST", upstream.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if got != "req-2" {
+		t.Errorf("Upstream saw request ID %q", got)
+	}
+	err = ResponseError(resp, "quote q-1 rejected")
+	if CodeOf(err) != CodeConflict || err.Error() != "quote q-1 rejected: quote already redeemed" {
+		t.Errorf("Unexpected error %q with code %q", err, CodeOf(err))
+	}
+}
+
+func TestMessageContext(t *testing.T) {
+	ctx := WithJobID(WithCaller(WithRequestID(context.Background(), "req-3"), "user-1", ""), "job-1")
+	msg := NewMsg(ctx, "job.completed", []byte("{}"))
+
+	f := fieldsFrom(MessageContext(msg))
+	if f.requestID != "req-3" || f.userID != "user-1" || f.tenant != "user-1" || f.jobID != "job-1" {
+		t.Errorf("Fields lost in transit: %+v", f)
+	}
+
+	if RequestID(MessageContext(NewMsg(context.Background(), "job.completed", nil))) == "" {
+		t.Error("Messages without a request ID should get one")
+	}
+}
+
+func TestContextFieldsInRecords(t *testing.T) {
+	logger, buf := newTestLogger(t)
+	Logging.AddDebugTarget("", "job-1", time.Minute)
+
+	ctx := WithJobID(WithRequestID(context.Background(), "req-4"), "job-1")
+	logger.DebugContext(ctx, "targeted through context")
+	logger.DebugContext(ctx, "explicit job wins", KeyJobID, "job-2")
+
+	out := buf.String()
+	if !strings.Contains(out, "targeted through context") || !strings.Contains(out, `"request_id":"req-4"`) {
+		t.Errorf("Context fields should be logged and targeted: %s", out)
+	}
+	if strings.Contains(out, "explicit job wins") {
+		t.Errorf("Record attributes should override the context: %s", out)
+	}
+	if strings.Count(out, `"job_id"`) != 1 {
+		t.Errorf("job_id should appear once per record: %s", out)
+	}
+}
+
+func TestNATSHandlerRecovers(t *testing.T) {
+	_, buf := newTestLogger(t)
+	handler := NATSHandler(func(ctx context.Context, msg *nats.Msg) error {
+		var m map[string]interface{}
+		_ = m["agent_id"].(string)
+		return nil
+	})
+	handler(nats.NewMsg("agent.heartbeat"))
+	if !strings.Contains(buf.String(), `"code":"internal"`) {
+		t.Errorf("Panic should be logged as an internal error: %s", buf.String())
+	}
+}
@@ -0,0 +1,154 @@
+// Package protocol negotiates the wire protocol agents speak with the
+// control plane and adapts messages from older agents to the current one.
+//
+// Agents list the protocol versions they can speak when they register, and
+// the control plane answers with the newest one both sides support. Every
+// heartbeat and job result carries the version it was written in; messages
+// in an older version are upgraded here before services read them, so
+// fleets can be upgraded gradually. Messages without a version are from
+// agents that predate negotiation and speak version 1.
+//
+// Version history:
+//
+//	1  Memory and storage in megabytes (total_mb, available_mb), CPU usage
+//	   as a 0-1 fraction. Job results report success or error.
+//	2  Memory and storage in bytes (total, available), CPU usage in percent.
+//	   Job results report completed or failed. Messages carry
+//	   protocol_version.
+//	3  GPUs report in_use.
+package protocol
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Protocol versions this package can adapt
+const (
+	Current = 3
+	Oldest  = 1
+)
+
+// legacy is the version of agents that send no protocol_version
+const legacy = 1
+
+// UnsupportedError is returned when an agent speaks no version the control
+// plane accepts
+type UnsupportedError struct {
+	Offered  []int
+	Min, Max int
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("agent speaks protocol versions %v, the control plane supports %d to %d; upgrade the agent", e.Offered, e.Min, e.Max)
+}
+
+// Negotiate returns the newest of the offered versions within [min, max].
+// Agents that offer none speak version 1.
+func Negotiate(offered []int, min, max int) (int, error) {
+	if len(offered) == 0 {
+		offered = []int{legacy}
+	}
+	best := 0
+	for _, version := range offered {
+		if version >= min && version <= max && version > best {
+			best = version
+		}
+	}
+	if best == 0 {
+		sorted := append([]int(nil), offered...)
+		sort.Ints(sorted)
+		return 0, &UnsupportedError{Offered: sorted, Min: min, Max: max}
+	}
+	return best, nil
+}
+
+// Version returns the protocol version a decoded heartbeat or job result
+// was written in
+func Version(message map[string]interface{}) int {
+	if version, ok := message["protocol_version"].(float64); ok && version >= 1 {
+		return int(version)
+	}
+	return legacy
+}
+
+// adapter upgrades a message from one version to the next
+type adapter func(message map[string]interface{})
+
+// heartbeatAdapters[v] upgrades a heartbeat from version v to v+1
+var heartbeatAdapters = map[int]adapter{
+	1: func(hb map[string]interface{}) {
+		resources, _ := hb["resources"].(map[string]interface{})
+		if resources == nil {
+			return
+		}
+		for _, key := range []string{"memory", "storage"} {
+			if section, ok := resources[key].(map[string]interface{}); ok {
+				megabytesToBytes(section, "total_mb", "total")
+				megabytesToBytes(section, "available_mb", "available")
+				megabytesToBytes(section, "used_mb", "used")
+			}
+		}
+		if cpu, ok := resources["cpu"].(map[string]interface{}); ok {
+			if usage, ok := cpu["usage"].(float64); ok {
+				cpu["usage"] = usage * 100
+			}
+		}
+	},
+	2: func(hb map[string]interface{}) {
+		resources, _ := hb["resources"].(map[string]interface{})
+		gpus, _ := resources["gpus"].([]interface{})
+		for _, raw := range gpus {
+			if gpu, ok := raw.(map[string]interface{}); ok {
+				// Without process accounting, a busy GPU is the best sign of one in use
+				usage, _ := gpu["usage"].(float64)
+				gpu["in_use"] = usage > 0
+			}
+		}
+	},
+}
+
+// jobResultAdapters[v] upgrades a job result from version v to v+1
+var jobResultAdapters = map[int]adapter{
+	1: func(result map[string]interface{}) {
+		switch result["status"] {
+		case "success":
+			result["status"] = "completed"
+		case "error":
+			result["status"] = "failed"
+		}
+	},
+}
+
+// UpgradeHeartbeat rewrites a decoded heartbeat from the given version to
+// the current one, in place
+func UpgradeHeartbeat(version int, heartbeat map[string]interface{}) error {
+	return upgrade(heartbeatAdapters, version, heartbeat)
+}
+
+// UpgradeJobResult rewrites a decoded job result from the given version to
+// the current one, in place
+func UpgradeJobResult(version int, result map[string]interface{}) error {
+	return upgrade(jobResultAdapters, version, result)
+}
+
+func upgrade(adapters map[int]adapter, version int, message map[string]interface{}) error {
+	if version < Oldest || version > Current {
+		return fmt.Errorf("protocol version %d is not supported, only %d to %d", version, Oldest, Current)
+	}
+	for v := version; v < Current; v++ {
+		if adapt := adapters[v]; adapt != nil {
+			adapt(message)
+		}
+	}
+	message["protocol_version"] = float64(Current)
+	return nil
+}
+
+// megabytesToBytes moves a megabyte field to its byte field
+func megabytesToBytes(section map[string]interface{}, from, to string) {
+	if value, ok := section[from].(float64); ok {
+		section[to] = value * 1024 * 1024
+		delete(section, from)
+	}
+}
@@ -0,0 +1,116 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		name     string
+		offered  []int
+		min, max int
+		want     int
+		err      bool
+	}{
+		{"newest common", []int{2, 3, 4}, 1, 3, 3, false},
+		{"legacy agent", nil, 1, 3, 1, false},
+		{"legacy agent dropped", nil, 2, 3, 0, true},
+		{"agent too new", []int{4, 5}, 1, 3, 0, true},
+		{"unordered", []int{3, 1, 2}, 1, 2, 2, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Negotiate(c.offered, c.min, c.max)
+			if c.err {
+				var unsupported *UnsupportedError
+				if !errors.As(err, &unsupported) {
+					t.Fatalf("Negotiate() error = %v, want *UnsupportedError", err)
+				}
+				return
+			}
+			if err != nil || got != c.want {
+				t.Fatalf("Negotiate() = %d, %v, want %d", got, err, c.want)
+			}
+		})
+	}
+}
+
+func decode(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	var message map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestUpgradeHeartbeat(t *testing.T) {
+	hb := decode(t, `{
+		"agent_id": "a1",
+		"status": "active",
+		"resources": {
+			"cpu": {"cores": 8, "usage": 0.25},
+			"memory": {"total_mb": 2048, "available_mb": 1024},
+			"storage": {"total_mb": 10240, "available_mb": 5120},
+			"gpus": [{"id": "0", "usage": 40}, {"id": "1", "usage": 0}]
+		}
+	}`)
+	version := Version(hb)
+	if version != 1 {
+		t.Fatalf("Version() = %d, want 1", version)
+	}
+	if err := UpgradeHeartbeat(version, hb); err != nil {
+		t.Fatal(err)
+	}
+
+	resources := hb["resources"].(map[string]interface{})
+	memory := resources["memory"].(map[string]interface{})
+	if memory["total"] != float64(2048*1024*1024) || memory["available"] != float64(1024*1024*1024) {
+		t.Errorf("memory = %v, want bytes", memory)
+	}
+	if _, ok := memory["total_mb"]; ok {
+		t.Errorf("memory still has total_mb")
+	}
+	if usage := resources["cpu"].(map[string]interface{})["usage"]; usage != float64(25) {
+		t.Errorf("cpu usage = %v, want 25", usage)
+	}
+	gpus := resources["gpus"].([]interface{})
+	if gpus[0].(map[string]interface{})["in_use"] != true || gpus[1].(map[string]interface{})["in_use"] != false {
+		t.Errorf("gpus = %v, want the busy one in use", gpus)
+	}
+	if Version(hb) != Current {
+		t.Errorf("upgraded heartbeat has version %d, want %d", Version(hb), Current)
+	}
+}
+
+func TestUpgradeCurrentUnchanged(t *testing.T) {
+	hb := decode(t, `{"protocol_version": 3, "resources": {"cpu": {"usage": 50}, "gpus": [{"usage": 10, "in_use": false}]}}`)
+	if err := UpgradeHeartbeat(Version(hb), hb); err != nil {
+		t.Fatal(err)
+	}
+	resources := hb["resources"].(map[string]interface{})
+	if usage := resources["cpu"].(map[string]interface{})["usage"]; usage != float64(50) {
+		t.Errorf("cpu usage = %v, want 50", usage)
+	}
+	if inUse := resources["gpus"].([]interface{})[0].(map[string]interface{})["in_use"]; inUse != false {
+		t.Errorf("in_use = %v, want the agent's own report", inUse)
+	}
+
+	if err := UpgradeHeartbeat(Current+1, hb); err == nil {
+		t.Errorf("UpgradeHeartbeat() accepted a version newer than %d", Current)
+	}
+}
+
+func TestUpgradeJobResult(t *testing.T) {
+	for status, want := range map[string]string{"success": "completed", "error": "failed", "cancelled": "cancelled"} {
+		result := map[string]interface{}{"status": status}
+		if err := UpgradeJobResult(1, result); err != nil {
+			t.Fatal(err)
+		}
+		if result["status"] != want {
+			t.Errorf("status %s upgraded to %v, want %s", status, result["status"], want)
+		}
+	}
+}
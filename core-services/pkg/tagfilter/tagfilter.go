@@ -0,0 +1,33 @@
+// Package tagfilter filters jobs and payments by their cost allocation tags.
+//
+// Listing and spend endpoints take repeated tag=key=value query parameters;
+// a record matches when its tags carry every requested pair.
+package tagfilter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Parse parses key=value filter expressions
+func Parse(filters []string) (map[string]string, error) {
+	parsed := make(map[string]string, len(filters))
+	for _, filter := range filters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag filter %q: expected key=value", filter)
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
+
+// Match reports whether tags contain every filter pair
+func Match(tags, filters map[string]string) bool {
+	for key, value := range filters {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package tagfilter
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	filters, err := Parse([]string{"team=nlp", "note=a=b", "empty="})
+	if err != nil {
+		t.Fatalf("Valid filters rejected: %v", err)
+	}
+	if len(filters) != 3 || filters["team"] != "nlp" || filters["note"] != "a=b" || filters["empty"] != "" {
+		t.Errorf("Unexpected filters %v", filters)
+	}
+
+	for _, filter := range []string{"team", "=nlp", ""} {
+		if _, err := Parse([]string{filter}); err == nil {
+			t.Errorf("Filter %q should be rejected", filter)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tags := map[string]string{"team": "nlp", "project": "alpha"}
+	cases := []struct {
+		filters map[string]string
+		want    bool
+	}{
+		{nil, true},
+		{map[string]string{"team": "nlp"}, true},
+		{map[string]string{"team": "nlp", "project": "alpha"}, true},
+		{map[string]string{"team": "vision"}, false},
+		{map[string]string{"team": "nlp", "env": "prod"}, false},
+		{map[string]string{"env": ""}, true},
+	}
+	for _, c := range cases {
+		if got := Match(tags, c.filters); got != c.want {
+			t.Errorf("Match(%v) = %v, want %v", c.filters, got, c.want)
+		}
+	}
+}
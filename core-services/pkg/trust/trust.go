@@ -0,0 +1,126 @@
+// Package trust defines the agent trust tiers shared by scheduler placement
+// and marketplace matching.
+//
+// Tiers are ordered; an agent in a tier satisfies every requirement for a
+// lower one:
+//
+//   - community:    any agent in the fleet
+//   - verified:     its operator's identity was verified and it has a track
+//     record of finishing the jobs it accepts
+//   - tee_attested: verified, and it holds a current attestation that it
+//     runs jobs in a trusted execution environment (SGX, SEV-SNP or TDX)
+//   - dedicated:    operated by the platform on single-tenant hardware
+//
+// The scheduler computes each agent's tier from its attestation, reputation
+// and ownership and publishes it as agent.trust; jobs and bids name the
+// lowest tier they accept.
+package trust
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Tier is an agent trust tier
+type Tier string
+
+// Trust tiers, from least to most trusted
+const (
+	Community   Tier = "community"
+	Verified    Tier = "verified"
+	TEEAttested Tier = "tee_attested"
+	Dedicated   Tier = "dedicated"
+)
+
+// Tiers lists the trust tiers from least to most trusted
+var Tiers = []Tier{Community, Verified, TEEAttested, Dedicated}
+
+// Ownership is what is known about who operates an agent
+type Ownership string
+
+// Agent ownership
+const (
+	OwnershipUnverified Ownership = "unverified" // Anyone who enrolled it
+	OwnershipVerified   Ownership = "verified"   // An operator whose identity was checked
+	OwnershipPlatform   Ownership = "platform"   // The platform, on dedicated hardware
+)
+
+// MinVerifiedReputation is the reputation an agent with a verified operator
+// needs to be in the verified tier or above
+const MinVerifiedReputation = 0.8
+
+// Evidence is what an agent's tier is computed from
+type Evidence struct {
+	Ownership  Ownership
+	Reputation float64 // Share of accepted jobs finished, 0 to 1
+	Attested   bool    // Holds a current, verified TEE attestation
+}
+
+// Compute returns the tier the evidence supports
+func Compute(e Evidence) Tier {
+	switch {
+	case e.Ownership == OwnershipPlatform:
+		return Dedicated
+	case e.Ownership != OwnershipVerified || e.Reputation < MinVerifiedReputation:
+		return Community
+	case e.Attested:
+		return TEEAttested
+	}
+	return Verified
+}
+
+// Parse returns the tier with the given name. An empty name is the
+// community tier, which every agent satisfies.
+func Parse(name string) (Tier, error) {
+	if name == "" {
+		return Community, nil
+	}
+	tier := Tier(strings.ToLower(strings.TrimSpace(name)))
+	if tier.rank() < 0 {
+		return "", fmt.Errorf("unknown trust tier %q, want one of %s", name, strings.Join(names(), ", "))
+	}
+	return tier, nil
+}
+
+// ParseOwnership returns the ownership with the given name
+func ParseOwnership(name string) (Ownership, error) {
+	switch ownership := Ownership(name); ownership {
+	case OwnershipUnverified, OwnershipVerified, OwnershipPlatform:
+		return ownership, nil
+	}
+	return "", fmt.Errorf("unknown ownership %q, want unverified, verified or platform", name)
+}
+
+// Meets reports whether an agent in tier t may run work that requires at
+// least tier min. Unknown tiers meet nothing but an empty requirement.
+func (t Tier) Meets(min Tier) bool {
+	if min == "" {
+		return true
+	}
+	return t.rank() >= 0 && t.rank() >= min.rank() && min.rank() >= 0
+}
+
+// Max returns the more trusted of two tiers
+func Max(a, b Tier) Tier {
+	if a.rank() >= b.rank() {
+		return a
+	}
+	return b
+}
+
+func (t Tier) rank() int {
+	for i, tier := range Tiers {
+		if tier == t {
+			return i
+		}
+	}
+	return -1
+}
+
+func names() []string {
+	names := make([]string, len(Tiers))
+	for i, tier := range Tiers {
+		names[i] = string(tier)
+	}
+	return names
+}
@@ -0,0 +1,60 @@
+package trust
+
+import "testing"
+
+func TestCompute(t *testing.T) {
+	cases := []struct {
+		name     string
+		evidence Evidence
+		want     Tier
+	}{
+		{"unknown operator", Evidence{Reputation: 1, Attested: true}, Community},
+		{"verified operator without track record", Evidence{Ownership: OwnershipVerified, Reputation: 0.5}, Community},
+		{"verified operator", Evidence{Ownership: OwnershipVerified, Reputation: 0.9}, Verified},
+		{"attested", Evidence{Ownership: OwnershipVerified, Reputation: 0.9, Attested: true}, TEEAttested},
+		{"attested without track record", Evidence{Ownership: OwnershipVerified, Reputation: 0.2, Attested: true}, Community},
+		{"platform", Evidence{Ownership: OwnershipPlatform}, Dedicated},
+	}
+	for _, c := range cases {
+		if got := Compute(c.evidence); got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestMeets(t *testing.T) {
+	cases := []struct {
+		tier, min Tier
+		want      bool
+	}{
+		{Community, "", true},
+		{Community, Community, true},
+		{Community, Verified, false},
+		{TEEAttested, Verified, true},
+		{Verified, TEEAttested, false},
+		{Dedicated, TEEAttested, true},
+		{"", Community, false},
+		{"bogus", "", true},
+		{Dedicated, "bogus", false},
+	}
+	for _, c := range cases {
+		if got := c.tier.Meets(c.min); got != c.want {
+			t.Errorf("%q meets %q: got %v, want %v", c.tier, c.min, got, c.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if tier, err := Parse(""); err != nil || tier != Community {
+		t.Errorf("empty tier: got %q, %v", tier, err)
+	}
+	if tier, err := Parse(" TEE_Attested "); err != nil || tier != TEEAttested {
+		t.Errorf("got %q, %v", tier, err)
+	}
+	if _, err := Parse("gold"); err == nil {
+		t.Error("unknown tier parsed")
+	}
+	if Max(Verified, TEEAttested) != TEEAttested || Max(Dedicated, Community) != Dedicated {
+		t.Error("Max does not pick the more trusted tier")
+	}
+}
@@ -0,0 +1,285 @@
+// Package wshub fans messages out to WebSocket clients without letting a slow
+// client hold up the others.
+//
+// Every client gets a buffered send queue drained by its own write pump, the
+// only goroutine that writes to the connection. Writes and pings carry a
+// deadline, so a client that stops reading fails its writes instead of
+// blocking forever. Broadcasts never block: a message for a client whose
+// queue is full is dropped for that client, and a client that drops
+// Config.MaxDropped messages in a row is evicted.
+//
+//	hub := wshub.New("marketplace", wshub.Config{})
+//
+//	func handle(w http.ResponseWriter, r *http.Request) {
+//		conn, _ := upgrader.Upgrade(w, r, nil)
+//		hub.Register(conn, "offers", "bids").ReadPump()
+//	}
+//
+//	hub.Broadcast("offers", data)
+package wshub
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Defaults applied to zero Config fields
+const (
+	DefaultQueueSize    = 256
+	DefaultWriteTimeout = 10 * time.Second
+	DefaultPingInterval = 30 * time.Second
+	DefaultMaxDropped   = 64
+)
+
+// Eviction reasons, as logged and counted
+const (
+	ReasonSlow        = "slow"         // Dropped MaxDropped messages in a row
+	ReasonWriteFailed = "write_failed" // A write failed or missed its deadline
+)
+
+// Config tunes a hub
+type Config struct {
+	QueueSize    int           // Messages buffered per client
+	WriteTimeout time.Duration // Deadline for each write
+	PingInterval time.Duration // How often clients are pinged; a client silent for two intervals is closed
+	MaxDropped   int           // Consecutive dropped messages before a client is evicted
+
+	// Registerer receives the hub's metrics; nil uses the default registry
+	Registerer prometheus.Registerer
+}
+
+// Hub tracks connected clients and broadcasts to them
+type Hub struct {
+	config  Config
+	clients map[*Client]struct{}
+	mu      sync.RWMutex
+
+	connections prometheus.Gauge
+	dropped     *prometheus.CounterVec
+	evicted     *prometheus.CounterVec
+}
+
+// New creates a hub. namespace prefixes its metrics, e.g.
+// telemetry_websocket_connections.
+func New(namespace string, config Config) *Hub {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultQueueSize
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = DefaultWriteTimeout
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = DefaultPingInterval
+	}
+	if config.MaxDropped <= 0 {
+		config.MaxDropped = DefaultMaxDropped
+	}
+	if config.Registerer == nil {
+		config.Registerer = prometheus.DefaultRegisterer
+	}
+
+	h := &Hub{
+		config:  config,
+		clients: make(map[*Client]struct{}),
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: namespace + "_websocket_connections",
+			Help: "Current number of WebSocket connections",
+		}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: namespace + "_websocket_messages_dropped_total",
+			Help: "Messages dropped because a client's send queue was full",
+		}, []string{"topic"}),
+		evicted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: namespace + "_websocket_clients_evicted_total",
+			Help: "WebSocket clients disconnected for falling behind or failing writes",
+		}, []string{"reason"}),
+	}
+	config.Registerer.MustRegister(h.connections, h.dropped, h.evicted)
+	return h
+}
+
+// Register adds a connection subscribed to the given topics and starts its
+// write pump. A client without topics receives every broadcast. The hub owns
+// the connection from here on: only the write pump writes to it, and it is
+// closed when the client is.
+func (h *Hub) Register(conn *websocket.Conn, topics ...string) *Client {
+	c := &Client{
+		hub:   h,
+		conn:  conn,
+		send:  make(chan []byte, h.config.QueueSize),
+		done:  make(chan struct{}),
+		addr:  conn.RemoteAddr().String(),
+		topic: make(map[string]bool, len(topics)),
+	}
+	for _, topic := range topics {
+		c.topic[topic] = true
+	}
+
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.connections.Set(float64(len(h.clients)))
+	h.mu.Unlock()
+
+	go c.writePump()
+	return c
+}
+
+// Broadcast queues a message for every client subscribed to topic. It never
+// blocks on a client.
+func (h *Hub) Broadcast(topic string, msg []byte) {
+	h.mu.RLock()
+	clients := make([]*Client, 0, len(h.clients))
+	for c := range h.clients {
+		if c.subscribed(topic) {
+			clients = append(clients, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range clients {
+		c.enqueue(topic, msg)
+	}
+}
+
+// Len returns the number of connected clients
+func (h *Hub) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+func (h *Hub) unregister(c *Client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.connections.Set(float64(len(h.clients)))
+	h.mu.Unlock()
+}
+
+// Client is one connection registered with a hub
+type Client struct {
+	hub     *Hub
+	conn    *websocket.Conn
+	send    chan []byte
+	done    chan struct{}
+	closed  atomic.Bool
+	addr    string
+	topic   map[string]bool // Read-only after Register
+	dropped atomic.Int64    // Consecutive messages dropped
+}
+
+// Send queues a message for this client alone. It reports false if the
+// message was dropped.
+func (c *Client) Send(msg []byte) bool {
+	return c.enqueue("", msg)
+}
+
+// Done is closed once the client is closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close unregisters the client. The write pump sends a close frame and
+// closes the connection. Close may be called more than once.
+func (c *Client) Close() {
+	c.shutdown()
+}
+
+// shutdown closes the client, reporting whether this call closed it
+func (c *Client) shutdown() bool {
+	if !c.closed.CompareAndSwap(false, true) {
+		return false
+	}
+	close(c.done)
+	c.hub.unregister(c)
+	return true
+}
+
+// ReadPump reads from the connection until it fails or the client is
+// closed, then closes the client. Incoming messages are discarded; pongs
+// keep the connection alive. Handlers call it last and return when it does.
+func (c *Client) ReadPump() {
+	defer c.Close()
+
+	pongWait := 2 * c.hub.config.PingInterval
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (c *Client) subscribed(topic string) bool {
+	return len(c.topic) == 0 || c.topic[topic]
+}
+
+func (c *Client) enqueue(topic string, msg []byte) bool {
+	if c.closed.Load() {
+		return false
+	}
+
+	select {
+	case c.send <- msg:
+		c.dropped.Store(0)
+		return true
+	default:
+	}
+
+	c.hub.dropped.WithLabelValues(topic).Inc()
+	if c.dropped.Add(1) >= int64(c.hub.config.MaxDropped) {
+		c.evict(ReasonSlow, nil)
+	}
+	return false
+}
+
+// evict closes a client that cannot keep up
+func (c *Client) evict(reason string, err error) {
+	if !c.shutdown() {
+		return
+	}
+	c.hub.evicted.WithLabelValues(reason).Inc()
+	if err != nil {
+		slog.Info("Evicting WebSocket client", "remote_addr", c.addr, "reason", reason, obs.KeyError, err)
+	} else {
+		slog.Info("Evicting WebSocket client", "remote_addr", c.addr, "reason", reason)
+	}
+}
+
+// writePump is the only writer to the connection
+func (c *Client) writePump() {
+	ticker := time.NewTicker(c.hub.config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	timeout := c.hub.config.WriteTimeout
+	for {
+		select {
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(timeout))
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(timeout))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.evict(ReasonWriteFailed, err)
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(timeout)); err != nil {
+				c.evict(ReasonWriteFailed, err)
+				return
+			}
+		}
+	}
+}
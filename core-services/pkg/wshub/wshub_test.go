@@ -0,0 +1,134 @@
+package wshub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// serve starts a server registering each connection with the topics in its
+// ?topic= parameters
+func serve(t *testing.T, hub *Hub) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Register(conn, r.URL.Query()["topic"]...).ReadPump()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func dial(t *testing.T, srv *httptest.Server, query string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/?" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestBroadcastByTopic(t *testing.T) {
+	hub := New("test", Config{Registerer: prometheus.NewRegistry()})
+	srv := serve(t, hub)
+
+	offers := dial(t, srv, "topic=offers")
+	bids := dial(t, srv, "topic=bids")
+	all := dial(t, srv, "")
+	waitFor(t, func() bool { return hub.Len() == 3 })
+
+	hub.Broadcast("offers", []byte("offer-1"))
+	hub.Broadcast("bids", []byte("bid-1"))
+
+	expect := func(conn *websocket.Conn, want ...string) {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		for _, w := range want {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(msg) != w {
+				t.Errorf("Got %q, want %q", msg, w)
+			}
+		}
+	}
+	expect(offers, "offer-1")
+	expect(bids, "bid-1")
+	expect(all, "offer-1", "bid-1")
+}
+
+func TestClientDisconnectUnregisters(t *testing.T) {
+	hub := New("test", Config{Registerer: prometheus.NewRegistry()})
+	srv := serve(t, hub)
+
+	conn := dial(t, srv, "")
+	waitFor(t, func() bool { return hub.Len() == 1 })
+	conn.Close()
+	waitFor(t, func() bool { return hub.Len() == 0 })
+	if got := testutil.ToFloat64(hub.connections); got != 0 {
+		t.Errorf("Connections gauge = %v, want 0", got)
+	}
+}
+
+func TestSlowClientIsEvicted(t *testing.T) {
+	hub := New("test", Config{Registerer: prometheus.NewRegistry(), QueueSize: 2, MaxDropped: 3})
+
+	// A client whose write pump never runs, so its queue only fills
+	slow := &Client{hub: hub, send: make(chan []byte, 2), done: make(chan struct{}), topic: map[string]bool{}}
+	hub.clients[slow] = struct{}{}
+
+	for i := 0; i < 4; i++ {
+		hub.Broadcast("metrics", []byte("m"))
+	}
+	if hub.Len() != 1 {
+		t.Fatal("Client should survive until MaxDropped messages are dropped")
+	}
+	if got := testutil.ToFloat64(hub.dropped.WithLabelValues("metrics")); got != 2 {
+		t.Errorf("Dropped = %v, want 2", got)
+	}
+
+	// A delivered message resets the count
+	<-slow.send
+	hub.Broadcast("metrics", []byte("m"))
+	hub.Broadcast("metrics", []byte("m"))
+	hub.Broadcast("metrics", []byte("m"))
+	if hub.Len() != 1 {
+		t.Fatal("Delivery should reset the consecutive drop count")
+	}
+
+	hub.Broadcast("metrics", []byte("m"))
+	if hub.Len() != 0 {
+		t.Fatal("Slow client should be evicted")
+	}
+	select {
+	case <-slow.Done():
+	default:
+		t.Error("Evicted client should be closed")
+	}
+	if got := testutil.ToFloat64(hub.evicted.WithLabelValues(ReasonSlow)); got != 1 {
+		t.Errorf("Evicted = %v, want 1", got)
+	}
+	if slow.Send([]byte("m")) {
+		t.Error("Closed clients accept nothing")
+	}
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultCapacityMaxAge matches the scheduler's cutoff for treating an agent
+// as live: capacity reported longer ago than this is not schedulable
+const defaultCapacityMaxAge = 2 * time.Minute
+
+// gpuBusyPercent is the utilization above which a reported GPU counts as in use
+const gpuBusyPercent = 50.0
+
+// Pressure stall percentages (averaged over 10s) at which an agent is
+// saturated: its tasks already wait for CPU or memory, so it advertises none
+// spare however idle its usage looks
+const (
+	cpuPressureLimit    = 40.0
+	memoryPressureLimit = 10.0
+)
+
+// NodeCapacity is the schedulable capacity an agent last reported
+type NodeCapacity struct {
+	AgentID            string            `json:"agent_id"`
+	Status             string            `json:"status"`
+	Region             string            `json:"region,omitempty"`
+	CPUCores           int               `json:"cpu_cores"`
+	CPUAvailable       int               `json:"cpu_available"`
+	MemoryMB           int               `json:"memory_mb"`
+	MemoryAvailableMB  int               `json:"memory_available_mb"`
+	StorageAvailableMB int               `json:"storage_available_mb"`
+	NetworkMbps        int               `json:"network_mbps"` // 0 when not reported
+	GPUs               []GPUCapacity     `json:"gpus,omitempty"`
+	Capabilities       []string          `json:"capabilities,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	UpdatedAt          time.Time         `json:"updated_at"`
+}
+
+// GPUCapacity is one GPU on an agent
+type GPUCapacity struct {
+	ID       string `json:"id"`
+	Model    string `json:"model"`
+	MemoryMB int    `json:"memory_mb"`
+	InUse    bool   `json:"in_use"`
+}
+
+// freeGPUs counts idle GPUs of a model, or of any model when model is empty
+func (n *NodeCapacity) freeGPUs(model string) int {
+	free := 0
+	for _, gpu := range n.GPUs {
+		if !gpu.InUse && (model == "" || gpu.Model == model) {
+			free++
+		}
+	}
+	return free
+}
+
+// agentHeartbeat is the part of an agent heartbeat that describes capacity.
+// Memory and storage are reported in bytes, utilization in percent.
+type agentHeartbeat struct {
+	AgentID      string            `json:"agent_id"`
+	Status       string            `json:"status"`
+	Location     string            `json:"location"`
+	Capabilities []string          `json:"capabilities"`
+	Labels       map[string]string `json:"labels"`
+	Resources    *struct {
+		CPU struct {
+			Cores int     `json:"cores"`
+			Usage float64 `json:"usage"`
+		} `json:"cpu"`
+		Memory struct {
+			Total     int64 `json:"total"`
+			Available int64 `json:"available"`
+		} `json:"memory"`
+		GPUs []struct {
+			ID       string  `json:"id"`
+			Model    string  `json:"model"`
+			MemoryMB int     `json:"memory_mb"`
+			Usage    float64 `json:"usage"`
+			InUse    bool    `json:"in_use"`
+		} `json:"gpus"`
+		Storage struct {
+			Available int64 `json:"available"`
+		} `json:"storage"`
+		Network struct {
+			Bandwidth int `json:"bandwidth_mbps"`
+		} `json:"network"`
+		Pressure *struct {
+			CPU struct {
+				SomeAvg10 float64 `json:"some_avg10"`
+			} `json:"cpu"`
+			Memory struct {
+				FullAvg10 float64 `json:"full_avg10"`
+			} `json:"memory"`
+		} `json:"pressure"`
+		Usage *usageBreakdown `json:"usage"`
+	} `json:"resources"`
+}
+
+// usageBreakdown is how an agent splits its host's usage between its jobs
+// and background load
+type usageBreakdown struct {
+	Jobs []struct {
+		CPUCores          float64 `json:"cpu_cores"`
+		MemoryBytes       int64   `json:"memory_bytes"`
+		RequestedCPUCores int     `json:"requested_cpu_cores"`
+		RequestedMemoryMB int     `json:"requested_memory_mb"`
+	} `json:"jobs"`
+	Agent      processUsage `json:"agent"`
+	Background processUsage `json:"background"`
+}
+
+type processUsage struct {
+	CPUCores    float64 `json:"cpu_cores"`
+	MemoryBytes int64   `json:"memory_bytes"`
+}
+
+// available returns the cores and memory left for new jobs. A running job
+// holds what it requested even while using less, and background load takes
+// what it actually uses.
+func (u *usageBreakdown) available(cores int, totalMemory int64) (int, int64) {
+	busyCores := u.Agent.CPUCores + u.Background.CPUCores
+	usedMemory := u.Agent.MemoryBytes + u.Background.MemoryBytes
+	for _, job := range u.Jobs {
+		busyCores += math.Max(job.CPUCores, float64(job.RequestedCPUCores))
+		usedMemory += max64(job.MemoryBytes, int64(job.RequestedMemoryMB)*1024*1024)
+	}
+	return int(math.Max(0, float64(cores)-math.Ceil(busyCores))), max64(0, totalMemory-usedMemory)
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// CapacityIndex holds the latest capacity of every agent, indexed by the
+// constraints that prune the most candidates: GPU model, capability and
+// region. Numeric requirements are checked against the narrowed set.
+type CapacityIndex struct {
+	nodes        map[string]*NodeCapacity
+	byGPUModel   map[string]map[string]bool
+	byCapability map[string]map[string]bool
+	byRegion     map[string]map[string]bool
+	mu           sync.RWMutex
+}
+
+// NewCapacityIndex creates an empty capacity index
+func NewCapacityIndex() *CapacityIndex {
+	return &CapacityIndex{
+		nodes:        make(map[string]*NodeCapacity),
+		byGPUModel:   make(map[string]map[string]bool),
+		byCapability: make(map[string]map[string]bool),
+		byRegion:     make(map[string]map[string]bool),
+	}
+}
+
+// ObserveHeartbeat updates an agent's capacity from a heartbeat message
+func (c *CapacityIndex) ObserveHeartbeat(data []byte) {
+	var hb agentHeartbeat
+	if err := json.Unmarshal(data, &hb); err != nil || hb.AgentID == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	node, exists := c.nodes[hb.AgentID]
+	if !exists {
+		node = &NodeCapacity{AgentID: hb.AgentID}
+	}
+	// Capabilities and region rarely change, so heartbeats may omit them
+	capabilities, region := node.Capabilities, node.Region
+	if len(hb.Capabilities) > 0 {
+		capabilities = hb.Capabilities
+	}
+	if hb.Location != "" {
+		region = hb.Location
+	} else if r := hb.Labels["region"]; r != "" {
+		region = r
+	}
+
+	updated := &NodeCapacity{
+		AgentID:      hb.AgentID,
+		Status:       hb.Status,
+		Region:       region,
+		Capabilities: capabilities,
+		Labels:       hb.Labels,
+		UpdatedAt:    time.Now(),
+	}
+	if res := hb.Resources; res != nil {
+		cpuAvailable := int(float64(res.CPU.Cores) * (1 - res.CPU.Usage/100))
+		memoryAvailable := res.Memory.Available
+		// Agents that break their usage down report what jobs hold, not just
+		// what they happen to use right now
+		if res.Usage != nil {
+			cores, memory := res.Usage.available(res.CPU.Cores, res.Memory.Total)
+			if cores < cpuAvailable {
+				cpuAvailable = cores
+			}
+			if memory < memoryAvailable {
+				memoryAvailable = memory
+			}
+		}
+		if p := res.Pressure; p != nil {
+			if p.CPU.SomeAvg10 >= cpuPressureLimit {
+				cpuAvailable = 0
+			}
+			if p.Memory.FullAvg10 >= memoryPressureLimit {
+				memoryAvailable = 0
+			}
+		}
+
+		updated.CPUCores = res.CPU.Cores
+		updated.CPUAvailable = cpuAvailable
+		updated.MemoryMB = int(res.Memory.Total / (1024 * 1024))
+		updated.MemoryAvailableMB = int(memoryAvailable / (1024 * 1024))
+		updated.StorageAvailableMB = int(res.Storage.Available / (1024 * 1024))
+		updated.NetworkMbps = res.Network.Bandwidth
+		for _, gpu := range res.GPUs {
+			updated.GPUs = append(updated.GPUs, GPUCapacity{
+				ID:       gpu.ID,
+				Model:    gpu.Model,
+				MemoryMB: gpu.MemoryMB,
+				InUse:    gpu.InUse || gpu.Usage >= gpuBusyPercent,
+			})
+		}
+	} else if exists {
+		// Status-only heartbeat: keep the last reported resources
+		updated.CPUCores, updated.CPUAvailable = node.CPUCores, node.CPUAvailable
+		updated.MemoryMB, updated.MemoryAvailableMB = node.MemoryMB, node.MemoryAvailableMB
+		updated.StorageAvailableMB, updated.NetworkMbps = node.StorageAvailableMB, node.NetworkMbps
+		updated.GPUs = node.GPUs
+	}
+
+	if exists {
+		c.unindex(node)
+	}
+	c.nodes[hb.AgentID] = updated
+	c.index(updated)
+}
+
+// index adds a node to the secondary indexes. Callers hold the lock.
+func (c *CapacityIndex) index(node *NodeCapacity) {
+	for _, gpu := range node.GPUs {
+		addToIndex(c.byGPUModel, gpu.Model, node.AgentID)
+	}
+	for _, capability := range node.Capabilities {
+		addToIndex(c.byCapability, capability, node.AgentID)
+	}
+	addToIndex(c.byRegion, node.Region, node.AgentID)
+}
+
+// unindex removes a node from the secondary indexes. Callers hold the lock.
+func (c *CapacityIndex) unindex(node *NodeCapacity) {
+	for _, gpu := range node.GPUs {
+		removeFromIndex(c.byGPUModel, gpu.Model, node.AgentID)
+	}
+	for _, capability := range node.Capabilities {
+		removeFromIndex(c.byCapability, capability, node.AgentID)
+	}
+	removeFromIndex(c.byRegion, node.Region, node.AgentID)
+}
+
+func addToIndex(index map[string]map[string]bool, key, agentID string) {
+	if index[key] == nil {
+		index[key] = make(map[string]bool)
+	}
+	index[key][agentID] = true
+}
+
+func removeFromIndex(index map[string]map[string]bool, key, agentID string) {
+	delete(index[key], agentID)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// CapacityQuery is a requirement set to find schedulable capacity for. It
+// mirrors the scheduler's job requirements.
+type CapacityQuery struct {
+	CPUCores      int      `json:"cpu_cores"`
+	MemoryMB      int      `json:"memory_mb"`
+	GPUCount      int      `json:"gpu_count"`
+	GPUType       string   `json:"gpu_type,omitempty"`
+	StorageMB     int      `json:"storage_mb"`
+	NetworkMbps   int      `json:"network_mbps"`
+	Capabilities  []string `json:"capabilities,omitempty"`
+	Regions       []string `json:"regions,omitempty"`  // Any of these regions
+	AgentID       string   `json:"agent_id,omitempty"` // Only this agent
+	MaxAgeSeconds int      `json:"max_age_seconds,omitempty"`
+	Limit         int      `json:"limit,omitempty"` // Maximum agents listed; counts cover all
+}
+
+// CapacityMatch is one agent that can satisfy a query
+type CapacityMatch struct {
+	AgentID            string    `json:"agent_id"`
+	Region             string    `json:"region,omitempty"`
+	CPUAvailable       int       `json:"cpu_available"`
+	MemoryAvailableMB  int       `json:"memory_available_mb"`
+	StorageAvailableMB int       `json:"storage_available_mb"`
+	FreeGPUs           int       `json:"free_gpus"`
+	UpdatedAt          time.Time `json:"updated_at"`
+	AgeSeconds         float64   `json:"age_seconds"`
+}
+
+// CapacityResult is the answer to a capacity query
+type CapacityResult struct {
+	MatchingAgents int             `json:"matching_agents"`
+	TotalCPU       int             `json:"total_cpu_available"`
+	TotalMemoryMB  int             `json:"total_memory_available_mb"`
+	TotalFreeGPUs  int             `json:"total_free_gpus"`
+	Agents         []CapacityMatch `json:"agents"`
+	StaleAgents    int             `json:"stale_agents"` // Would match but reported too long ago
+	OldestUpdate   *time.Time      `json:"oldest_update,omitempty"`
+	NewestUpdate   *time.Time      `json:"newest_update,omitempty"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+}
+
+// candidates narrows the agent set using the indexes. Callers hold the lock.
+func (c *CapacityIndex) candidates(q *CapacityQuery) map[string]bool {
+	if q.AgentID != "" {
+		if _, ok := c.nodes[q.AgentID]; ok {
+			return map[string]bool{q.AgentID: true}
+		}
+		return nil
+	}
+
+	var sets []map[string]bool
+	if q.GPUCount > 0 && q.GPUType != "" {
+		sets = append(sets, c.byGPUModel[q.GPUType])
+	}
+	for _, capability := range q.Capabilities {
+		sets = append(sets, c.byCapability[capability])
+	}
+	if len(q.Regions) > 0 {
+		union := make(map[string]bool)
+		for _, region := range q.Regions {
+			for id := range c.byRegion[region] {
+				union[id] = true
+			}
+		}
+		sets = append(sets, union)
+	}
+
+	if len(sets) == 0 {
+		all := make(map[string]bool, len(c.nodes))
+		for id := range c.nodes {
+			all[id] = true
+		}
+		return all
+	}
+
+	// Intersect starting from the smallest set
+	sort.Slice(sets, func(i, j int) bool { return len(sets[i]) < len(sets[j]) })
+	result := make(map[string]bool, len(sets[0]))
+	for id := range sets[0] {
+		result[id] = true
+	}
+	for _, set := range sets[1:] {
+		for id := range result {
+			if !set[id] {
+				delete(result, id)
+			}
+		}
+	}
+	return result
+}
+
+// Query returns the agents with capacity for a requirement set
+func (c *CapacityIndex) Query(q *CapacityQuery) *CapacityResult {
+	maxAge := defaultCapacityMaxAge
+	if q.MaxAgeSeconds > 0 {
+		maxAge = time.Duration(q.MaxAgeSeconds) * time.Second
+	}
+	now := time.Now()
+	result := &CapacityResult{Agents: make([]CapacityMatch, 0), GeneratedAt: now}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for id := range c.candidates(q) {
+		node := c.nodes[id]
+		if node.Status != "active" ||
+			node.CPUAvailable < q.CPUCores ||
+			node.MemoryAvailableMB < q.MemoryMB ||
+			node.StorageAvailableMB < q.StorageMB ||
+			(node.NetworkMbps > 0 && node.NetworkMbps < q.NetworkMbps) ||
+			node.freeGPUs(q.GPUType) < q.GPUCount {
+			continue
+		}
+		if now.Sub(node.UpdatedAt) > maxAge {
+			result.StaleAgents++
+			continue
+		}
+
+		updated := node.UpdatedAt
+		if result.OldestUpdate == nil || updated.Before(*result.OldestUpdate) {
+			result.OldestUpdate = &updated
+		}
+		if result.NewestUpdate == nil || updated.After(*result.NewestUpdate) {
+			result.NewestUpdate = &updated
+		}
+
+		match := CapacityMatch{
+			AgentID:            node.AgentID,
+			Region:             node.Region,
+			CPUAvailable:       node.CPUAvailable,
+			MemoryAvailableMB:  node.MemoryAvailableMB,
+			StorageAvailableMB: node.StorageAvailableMB,
+			FreeGPUs:           node.freeGPUs(q.GPUType),
+			UpdatedAt:          updated,
+			AgeSeconds:         now.Sub(updated).Seconds(),
+		}
+		result.MatchingAgents++
+		result.TotalCPU += match.CPUAvailable
+		result.TotalMemoryMB += match.MemoryAvailableMB
+		result.TotalFreeGPUs += match.FreeGPUs
+		result.Agents = append(result.Agents, match)
+	}
+
+	// Freshest first, so a limited listing keeps the most reliable agents
+	sort.Slice(result.Agents, func(i, j int) bool {
+		return result.Agents[i].UpdatedAt.After(result.Agents[j].UpdatedAt)
+	})
+	if q.Limit > 0 && len(result.Agents) > q.Limit {
+		result.Agents = result.Agents[:q.Limit]
+	}
+	return result
+}
+
+// QueryCapacity answers whether, and where, a requirement set can be
+// scheduled right now. The scheduler uses it for placement and dry runs.
+func (s *ResourceService) QueryCapacity(w http.ResponseWriter, r *http.Request) {
+	var query CapacityQuery
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if query.CPUCores < 0 || query.MemoryMB < 0 || query.GPUCount < 0 || query.StorageMB < 0 || query.NetworkMbps < 0 {
+		http.Error(w, "Requirements must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.capacity.Query(&query))
+}
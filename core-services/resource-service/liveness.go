@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+)
+
+// defaultAgentStaleAfter is the missed-heartbeat window after which an agent
+// is considered gone, overridable with AGENT_STALE_AFTER (e.g. "5m")
+const defaultAgentStaleAfter = 3 * time.Minute
+
+// agentStaleAfter returns the configured missed-heartbeat window
+func agentStaleAfter() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("AGENT_STALE_AFTER")); err == nil && d > 0 {
+		return d
+	}
+	return defaultAgentStaleAfter
+}
+
+// AgentLivenessEvent is published when an agent expires or returns
+type AgentLivenessEvent struct {
+	AgentID     string    `json:"agent_id"`
+	LastSeen    time.Time `json:"last_seen"`
+	Resources   []string  `json:"resources"`
+	Allocations []string  `json:"allocations"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// AgentReaper expires agents that miss heartbeats for longer than the stale
+// window: their resources become unavailable, their active allocations are
+// interrupted and agent.expired lets the marketplace expire their offers.
+// A heartbeat from an expired agent reverses all of it.
+type AgentReaper struct {
+	service    *ResourceService
+	staleAfter time.Duration
+	lastSeen   map[string]time.Time
+	expired    map[string]map[string]string // agent ID -> resource ID -> status before expiry
+	mu         sync.Mutex
+}
+
+// NewAgentReaper creates a reaper with the configured stale window
+func NewAgentReaper(s *ResourceService) *AgentReaper {
+	return &AgentReaper{
+		service:    s,
+		staleAfter: agentStaleAfter(),
+		lastSeen:   make(map[string]time.Time),
+		expired:    make(map[string]map[string]string),
+	}
+}
+
+// Seen records a heartbeat, restoring the agent if it had expired
+func (a *AgentReaper) Seen(agentID string) {
+	a.mu.Lock()
+	a.lastSeen[agentID] = time.Now()
+	statuses, wasExpired := a.expired[agentID]
+	delete(a.expired, agentID)
+	a.mu.Unlock()
+
+	if wasExpired {
+		a.restore(agentID, statuses)
+	}
+}
+
+// run checks for stale agents until the process exits
+func (a *AgentReaper) run() {
+	interval := a.staleAfter / 4
+	if interval < 10*time.Second {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		a.reap()
+	}
+}
+
+// reap expires every agent whose last heartbeat is older than the window
+func (a *AgentReaper) reap() {
+	now := time.Now()
+
+	a.mu.Lock()
+	var stale []string
+	for agentID, seen := range a.lastSeen {
+		if _, done := a.expired[agentID]; !done && now.Sub(seen) > a.staleAfter {
+			stale = append(stale, agentID)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, agentID := range stale {
+		a.expire(agentID)
+	}
+}
+
+// expire marks an agent's resources unavailable and interrupts their active
+// allocations. Allocated capacity is kept so the allocations can resume if
+// the agent returns.
+func (a *AgentReaper) expire(agentID string) {
+	s := a.service
+	event := AgentLivenessEvent{AgentID: agentID, Timestamp: time.Now()}
+	statuses := make(map[string]string)
+	var interrupted []*ResourceAllocation
+
+	// Holding the reaper lock throughout keeps a heartbeat arriving now from
+	// missing the expiry it has to undo
+	a.mu.Lock()
+	event.LastSeen = a.lastSeen[agentID]
+	if _, done := a.expired[agentID]; done || event.Timestamp.Sub(event.LastSeen) <= a.staleAfter {
+		a.mu.Unlock()
+		return
+	}
+
+	s.mu.Lock()
+	for _, resource := range s.resources {
+		if resource.AgentID != agentID || resource.Status == "unavailable" {
+			continue
+		}
+		statuses[resource.ID] = resource.Status
+		resource.Status = "unavailable"
+		resource.LastUpdated = event.Timestamp
+		event.Resources = append(event.Resources, resource.ID)
+	}
+	for _, allocation := range s.allocations {
+		if _, affected := statuses[allocation.ResourceID]; affected && allocation.Status == "active" {
+			allocation.Status = "interrupted"
+			interrupted = append(interrupted, allocation)
+			event.Allocations = append(event.Allocations, allocation.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	a.expired[agentID] = statuses
+	a.mu.Unlock()
+
+	slog.Warn("Agent missed heartbeats", "agent_id", agentID, "stale_after", a.staleAfter.String(),
+		"resources_unavailable", len(event.Resources), "allocations_interrupted", len(interrupted))
+
+	for _, allocation := range interrupted {
+		s.publishAllocationEvent("allocation.interrupted", allocation)
+	}
+	a.publish("agent.expired", event)
+}
+
+// restore returns an agent's resources to their status before expiry and
+// resumes the allocations interrupted with them
+func (a *AgentReaper) restore(agentID string, statuses map[string]string) {
+	s := a.service
+	event := AgentLivenessEvent{AgentID: agentID, LastSeen: time.Now(), Timestamp: time.Now()}
+	var resumed []*ResourceAllocation
+
+	s.mu.Lock()
+	for resourceID, status := range statuses {
+		resource, exists := s.resources[resourceID]
+		if !exists || resource.Status != "unavailable" {
+			continue
+		}
+		resource.Status = status
+		resource.LastUpdated = event.Timestamp
+		event.Resources = append(event.Resources, resource.ID)
+	}
+	for _, allocation := range s.allocations {
+		if _, affected := statuses[allocation.ResourceID]; affected && allocation.Status == "interrupted" {
+			allocation.Status = "active"
+			resumed = append(resumed, allocation)
+			event.Allocations = append(event.Allocations, allocation.ID)
+		}
+	}
+	s.mu.Unlock()
+
+	slog.Info("Agent is heartbeating again", "agent_id", agentID,
+		"resources_restored", len(event.Resources), "allocations_resumed", len(resumed))
+
+	for _, allocation := range resumed {
+		s.publishAllocationEvent("allocation.resumed", allocation)
+	}
+	a.publish("agent.restored", event)
+}
+
+func (a *AgentReaper) publish(subject string, event AgentLivenessEvent) {
+	data, _ := json.Marshal(event)
+	if err := a.service.bus.Publish(context.Background(), subject, data); err != nil {
+		obs.LogError(context.Background(), "Failed to publish liveness event", err, "event", subject, "agent_id", event.AgentID)
+	}
+}
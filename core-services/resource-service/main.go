@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/computehive/core-services/pkg/events"
+	"github.com/computehive/core-services/pkg/health"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/computehive/core-services/pkg/protocol"
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"github.com/nats-io/nats.go"
 	"github.com/prometheus/client_golang/prometheus"
@@ -21,7 +28,7 @@ type Resource struct {
 	ID                    string                 `json:"id"`
 	AgentID               string                 `json:"agent_id"`
 	Type                  string                 `json:"type"` // cpu, gpu, storage, network
-	Status                string                 `json:"status"` // available, allocated, maintenance
+	Status                string                 `json:"status"` // available, allocated, maintenance, unavailable
 	TotalCapacity         map[string]interface{} `json:"total_capacity"`
 	AllocatedCapacity     map[string]interface{} `json:"allocated_capacity"`
 	AvailableCapacity     map[string]interface{} `json:"available_capacity"`
@@ -38,15 +45,18 @@ type ResourceAllocation struct {
 	AllocatedAmount map[string]interface{} `json:"allocated_amount"`
 	StartTime       time.Time              `json:"start_time"`
 	EndTime         *time.Time             `json:"end_time,omitempty"`
-	Status          string                 `json:"status"` // active, completed, cancelled
+	Status          string                 `json:"status"` // active, interrupted, completed, cancelled
 }
 
 // ResourceService manages compute resources
 type ResourceService struct {
 	resources      map[string]*Resource
 	allocations    map[string]*ResourceAllocation
+	capacity       *CapacityIndex
+	reaper         *AgentReaper
 	mu             sync.RWMutex
 	nats           *nats.Conn
+	bus            *events.Bus
 	
 	// Metrics
 	totalResources     *prometheus.GaugeVec
@@ -66,10 +76,18 @@ func NewResourceService() (*ResourceService, error) {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 	
+	// Agent lifecycle and job completion events go through JetStream
+	bus, err := events.Connect(nc, "resource-service")
+	if err != nil {
+		return nil, err
+	}
+	
 	s := &ResourceService{
 		resources:   make(map[string]*Resource),
 		allocations: make(map[string]*ResourceAllocation),
+		capacity:    NewCapacityIndex(),
 		nats:        nc,
+		bus:         bus,
 		
 		totalResources: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -101,12 +119,15 @@ func NewResourceService() (*ResourceService, error) {
 		s.allocationDuration,
 	)
 	
+	s.reaper = NewAgentReaper(s)
+	
 	// Subscribe to events
 	s.subscribeToEvents()
 	
 	// Start background workers
 	go s.resourceMonitor()
 	go s.allocationCleanup()
+	go s.reaper.run()
 	
 	return s, nil
 }
@@ -204,6 +225,10 @@ func (s *ResourceService) AllocateResource(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Resource not found", http.StatusNotFound)
 		return
 	}
+	if resource.Status == "unavailable" {
+		http.Error(w, "Resource is unavailable: its agent stopped heartbeating", http.StatusConflict)
+		return
+	}
 	
 	// Check if sufficient capacity is available
 	for k, v := range req.Amount {
@@ -374,7 +399,7 @@ func (s *ResourceService) resourceMonitor() {
 		for _, resource := range s.resources {
 			// Check resource health
 			if time.Since(resource.LastUpdated) > 5*time.Minute {
-				log.Printf("Resource %s hasn't been updated in 5 minutes", resource.ID)
+				slog.Warn("Resource has not been updated in 5 minutes", "resource_id", resource.ID, "agent_id", resource.AgentID)
 			}
 		}
 		s.mu.RUnlock()
@@ -391,7 +416,7 @@ func (s *ResourceService) allocationCleanup() {
 		
 		for id, allocation := range s.allocations {
 			// Clean up expired allocations
-			if allocation.EndTime != nil && allocation.EndTime.Before(now) && allocation.Status == "active" {
+			if allocation.EndTime != nil && allocation.EndTime.Before(now) && (allocation.Status == "active" || allocation.Status == "interrupted") {
 				// Release the allocation
 				if resource, exists := s.resources[allocation.ResourceID]; exists {
 					for k, v := range allocation.AllocatedAmount {
@@ -412,7 +437,7 @@ func (s *ResourceService) allocationCleanup() {
 				}
 				
 				allocation.Status = "completed"
-				log.Printf("Auto-released expired allocation %s", id)
+				slog.Info("Auto-released expired allocation", "allocation_id", id, obs.KeyJobID, allocation.JobID)
 			}
 		}
 		
@@ -433,23 +458,35 @@ func (s *ResourceService) subscribeToEvents() {
 			return
 		}
 		
+		// Heartbeats from older agents are read in the current protocol
+		if err := protocol.UpgradeHeartbeat(protocol.Version(heartbeat), heartbeat); err != nil {
+			return
+		}
+		data, err := json.Marshal(heartbeat)
+		if err != nil {
+			return
+		}
+		
 		// Update resource information based on heartbeat
 		if agentID, ok := heartbeat["agent_id"].(string); ok {
 			s.updateAgentResources(agentID, heartbeat)
+			s.reaper.Seen(agentID)
 		}
+		s.capacity.ObserveHeartbeat(data)
 	})
 	
 	// Subscribe to job events
-	s.nats.Subscribe("job.completed", func(msg *nats.Msg) {
+	s.bus.Subscribe("job.completed", func(ctx context.Context, msg *nats.Msg) error {
 		var job map[string]interface{}
 		if err := json.Unmarshal(msg.Data, &job); err != nil {
-			return
+			return obs.Wrap(obs.CodeInvalidArgument, err)
 		}
 		
 		// Release resources allocated to the job
 		if jobID, ok := job["id"].(string); ok {
-			s.releaseJobResources(jobID)
+			s.releaseJobResources(obs.WithJobID(ctx, jobID), jobID)
 		}
+		return nil
 	})
 }
 
@@ -469,12 +506,12 @@ func (s *ResourceService) updateAgentResources(agentID string, heartbeat map[str
 	}
 }
 
-func (s *ResourceService) releaseJobResources(jobID string) {
+func (s *ResourceService) releaseJobResources(ctx context.Context, jobID string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	
 	for _, allocation := range s.allocations {
-		if allocation.JobID == jobID && allocation.Status == "active" {
+		if allocation.JobID == jobID && (allocation.Status == "active" || allocation.Status == "interrupted") {
 			// Release the allocation
 			if resource, exists := s.resources[allocation.ResourceID]; exists {
 				for k, v := range allocation.AllocatedAmount {
@@ -498,7 +535,7 @@ func (s *ResourceService) releaseJobResources(jobID string) {
 			now := time.Now()
 			allocation.EndTime = &now
 			
-			log.Printf("Released resources for completed job %s", jobID)
+			slog.InfoContext(ctx, "Released resources for completed job", "allocation_id", allocation.ID)
 		}
 	}
 	
@@ -557,33 +594,88 @@ func (s *ResourceService) publishAllocationEvent(event string, allocation *Resou
 	s.nats.Publish(event, data)
 }
 
+// Claims represents JWT claims
+type Claims struct {
+	UserID   string   `json:"user_id"`
+	Email    string   `json:"email"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Scopes   []string `json:"scopes"`
+	jwt.RegisteredClaims
+}
+
+// Auth middleware
+func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := r.Header.Get("Authorization")
+		if tokenString == "" {
+			http.Error(w, "Missing authorization header", http.StatusUnauthorized)
+			return
+		}
+		
+		tokenString = strings.TrimPrefix(tokenString, "Bearer ")
+		
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+			return []byte(os.Getenv("JWT_SECRET")), nil
+		})
+		
+		if err != nil || !token.Valid {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		
+		claims := token.Claims.(*Claims)
+		if claims.Role == "agent" {
+			http.Error(w, "Agent credentials cannot call user APIs", http.StatusForbidden)
+			return
+		}
+		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = obs.WithCaller(ctx, claims.UserID, "")
+		next(w, r.WithContext(ctx))
+	}
+}
+
 func generateID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
 
+// isAdmin reports whether the authenticated caller is an admin
+func isAdmin(r *http.Request) bool {
+	claims, ok := r.Context().Value("claims").(*Claims)
+	return ok && claims.Role == "admin"
+}
+
 func main() {
+	obs.Init("resource-service")
+	
 	resourceService, err := NewResourceService()
 	if err != nil {
-		log.Fatalf("Failed to create resource service: %v", err)
+		obs.Fatal("Failed to create resource service", err)
 	}
 	
 	router := mux.NewRouter()
+	router.Use(obs.Middleware)
 	
-	// Health check
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
+	// Health checks: /healthz is liveness only, /readyz runs dependency checks
+	checker := health.NewChecker("resource-service")
+	checker.AddCheck("nats", true, health.NATSCheck(resourceService.nats))
+	router.HandleFunc("/healthz", checker.LivenessHandler).Methods("GET")
+	router.HandleFunc("/readyz", checker.ReadinessHandler).Methods("GET")
+	router.HandleFunc("/health", checker.ReadinessHandler).Methods("GET") // Legacy alias
 	
 	// Metrics endpoint
 	router.Handle("/metrics", promhttp.Handler())
 	
+	// Runtime logging control
+	router.HandleFunc("/admin/logging", authMiddleware(obs.Logging.Handler(isAdmin))).Methods("GET", "PUT")
+	
 	// Resource endpoints
 	router.HandleFunc("/api/v1/resources", resourceService.RegisterResource).Methods("POST")
 	router.HandleFunc("/api/v1/resources", resourceService.GetResources).Methods("GET")
 	router.HandleFunc("/api/v1/allocations", resourceService.AllocateResource).Methods("POST")
 	router.HandleFunc("/api/v1/allocations/{id}/release", resourceService.ReleaseResource).Methods("POST")
 	router.HandleFunc("/api/v1/allocations", resourceService.GetAllocations).Methods("GET")
+	router.HandleFunc("/api/v1/capacity/query", resourceService.QueryCapacity).Methods("POST")
 	
 	// Setup CORS
 	c := cors.New(cors.Options{
@@ -601,8 +693,8 @@ func main() {
 		port = "8006"
 	}
 	
-	log.Printf("Resource service starting on port %s", port)
+	slog.Info("Resource service starting", "port", port)
 	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		obs.Fatal("Failed to start server", err)
 	}
 }
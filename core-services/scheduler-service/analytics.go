@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Right-sizing headroom applied on top of observed usage
+const (
+	cpuHeadroom    = 1.15
+	memoryHeadroom = 1.2
+	memoryStepMB   = 256
+)
+
+// JobUsage is the observed resource usage reported by the agent for a finished job
+type JobUsage struct {
+	CPUCoresAvg  float64 `json:"cpu_cores_avg"`
+	CPUCoresP95  float64 `json:"cpu_cores_p95"`
+	MemoryPeakMB int64   `json:"memory_peak_mb"`
+	Samples      int     `json:"samples"`
+}
+
+// RightsizingRecommendation suggests smaller requirements for a group of similar jobs
+type RightsizingRecommendation struct {
+	JobType             string  `json:"job_type"`
+	RequestedCPUCores   int     `json:"requested_cpu_cores"`
+	RequestedMemoryMB   int     `json:"requested_memory_mb"`
+	GPUCount            int     `json:"gpu_count,omitempty"`
+	Jobs                int     `json:"jobs"`
+	CPUCoresP95         float64 `json:"cpu_cores_p95"`
+	CPUCoresAvg         float64 `json:"cpu_cores_avg"`
+	MemoryPeakMB        int64   `json:"memory_peak_mb"`
+	RecommendedCPUCores int     `json:"recommended_cpu_cores"`
+	RecommendedMemoryMB int     `json:"recommended_memory_mb"`
+	SavingsPercent      float64 `json:"savings_percent"`
+	EstimatedSavings    float64 `json:"estimated_savings"` // Over the analyzed window at list rates
+	Message             string  `json:"message"`
+}
+
+// RightsizingReport is the response of the right-sizing analytics endpoint
+type RightsizingReport struct {
+	WindowStart       time.Time                   `json:"window_start"`
+	WindowEnd         time.Time                   `json:"window_end"`
+	JobsAnalyzed      int                         `json:"jobs_analyzed"`
+	CPUUtilization    float64                     `json:"cpu_utilization"` // p95 cores used / cores requested
+	MemoryUtilization float64                     `json:"memory_utilization"`
+	PotentialSavings  float64                     `json:"potential_savings"`
+	Recommendations   []RightsizingRecommendation `json:"recommendations"`
+}
+
+// parseJobUsage extracts usage metrics from an agent's job result
+func parseJobUsage(result map[string]interface{}) *JobUsage {
+	raw, ok := result["metrics"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var usage JobUsage
+	if err := json.Unmarshal(data, &usage); err != nil || usage.Samples == 0 {
+		return nil
+	}
+	return &usage
+}
+
+// GetRightsizing mines completed jobs' requested vs actual usage and suggests smaller requirements
+func (s *SchedulerService) GetRightsizing(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	days := 30
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 365 {
+			http.Error(w, "Invalid days", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+	minJobs := 3
+	if v := r.URL.Query().Get("min_jobs"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid min_jobs", http.StatusBadRequest)
+			return
+		}
+		minJobs = n
+	}
+
+	end := time.Now()
+	start := end.AddDate(0, 0, -days)
+
+	// Group similar jobs by type and requested shape
+	groups := make(map[string][]*Job)
+	s.mu.RLock()
+	for _, job := range s.jobs {
+		if job.UserID != claims.UserID && claims.Role != "admin" {
+			continue
+		}
+		if job.Status != "completed" || job.Usage == nil || job.CompletedAt == nil || job.CompletedAt.Before(start) {
+			continue
+		}
+		key := fmt.Sprintf("%s/%d/%d/%d", job.Type, job.Requirements.CPUCores, job.Requirements.MemoryMB, job.Requirements.GPUCount)
+		copied := *job
+		groups[key] = append(groups[key], &copied)
+	}
+	s.mu.RUnlock()
+
+	report := RightsizingReport{
+		WindowStart:     start,
+		WindowEnd:       end,
+		Recommendations: []RightsizingRecommendation{},
+	}
+
+	var requestedCores, usedCores, requestedMem, usedMem float64
+	for _, jobs := range groups {
+		report.JobsAnalyzed += len(jobs)
+		for _, job := range jobs {
+			requestedCores += float64(job.Requirements.CPUCores)
+			usedCores += job.Usage.CPUCoresP95
+			requestedMem += float64(job.Requirements.MemoryMB)
+			usedMem += float64(job.Usage.MemoryPeakMB)
+		}
+
+		if len(jobs) < minJobs {
+			continue
+		}
+		if rec, ok := recommendRightsizing(jobs); ok {
+			report.Recommendations = append(report.Recommendations, rec)
+			report.PotentialSavings += rec.EstimatedSavings
+		}
+	}
+	if requestedCores > 0 {
+		report.CPUUtilization = usedCores / requestedCores
+	}
+	if requestedMem > 0 {
+		report.MemoryUtilization = usedMem / requestedMem
+	}
+
+	sort.Slice(report.Recommendations, func(i, j int) bool {
+		return report.Recommendations[i].EstimatedSavings > report.Recommendations[j].EstimatedSavings
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// recommendRightsizing builds a recommendation for a group of jobs sharing the same requirements
+func recommendRightsizing(jobs []*Job) (RightsizingRecommendation, bool) {
+	req := jobs[0].Requirements
+
+	cpuP95s := make([]float64, 0, len(jobs))
+	var cpuAvg float64
+	var memPeak int64
+	var hours float64
+	for _, job := range jobs {
+		cpuP95s = append(cpuP95s, job.Usage.CPUCoresP95)
+		cpuAvg += job.Usage.CPUCoresAvg
+		if job.Usage.MemoryPeakMB > memPeak {
+			memPeak = job.Usage.MemoryPeakMB
+		}
+		hours += jobRunHours(job)
+	}
+	sort.Float64s(cpuP95s)
+	cpuP95 := cpuP95s[nearestRank(len(cpuP95s), 0.95)]
+
+	recCPU := int(math.Ceil(cpuP95 * cpuHeadroom))
+	if recCPU < 1 {
+		recCPU = 1
+	}
+	if recCPU > req.CPUCores {
+		recCPU = req.CPUCores
+	}
+	recMem := req.MemoryMB
+	if memPeak > 0 {
+		recMem = int(math.Ceil(float64(memPeak)*memoryHeadroom/memoryStepMB)) * memoryStepMB
+		if recMem > req.MemoryMB {
+			recMem = req.MemoryMB
+		}
+	}
+	if recCPU == req.CPUCores && recMem == req.MemoryMB {
+		return RightsizingRecommendation{}, false
+	}
+
+	recommended := req
+	recommended.CPUCores = recCPU
+	recommended.MemoryMB = recMem
+	currentRate := requirementsHourlyRate(req)
+	savedRate := currentRate - requirementsHourlyRate(recommended)
+
+	rec := RightsizingRecommendation{
+		JobType:             jobs[0].Type,
+		RequestedCPUCores:   req.CPUCores,
+		RequestedMemoryMB:   req.MemoryMB,
+		GPUCount:            req.GPUCount,
+		Jobs:                len(jobs),
+		CPUCoresP95:         math.Round(cpuP95*100) / 100,
+		CPUCoresAvg:         math.Round(cpuAvg/float64(len(jobs))*100) / 100,
+		MemoryPeakMB:        memPeak,
+		RecommendedCPUCores: recCPU,
+		RecommendedMemoryMB: recMem,
+		EstimatedSavings:    math.Round(savedRate*hours*100) / 100,
+	}
+	if currentRate > 0 {
+		rec.SavingsPercent = math.Round(savedRate / currentRate * 100)
+	}
+
+	if recCPU < req.CPUCores {
+		rec.Message = fmt.Sprintf("You requested %d cores, p95 usage was %.1f — requesting %d would save ~%.0f%%",
+			req.CPUCores, cpuP95, recCPU, rec.SavingsPercent)
+	} else {
+		rec.Message = fmt.Sprintf("You requested %d MB memory, peak usage was %d MB — requesting %d MB would save ~%.0f%%",
+			req.MemoryMB, memPeak, recMem, rec.SavingsPercent)
+	}
+	return rec, true
+}
+
+// jobRunHours returns how long a finished job ran
+func jobRunHours(job *Job) float64 {
+	started := job.StartedAt
+	if started == nil {
+		started = job.ScheduledAt
+	}
+	if started == nil || job.CompletedAt == nil {
+		return 0
+	}
+	return job.CompletedAt.Sub(*started).Hours()
+}
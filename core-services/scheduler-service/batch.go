@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Batch submission modes
+const (
+	BatchAtomic  = "atomic"  // Submit every job or none
+	BatchPartial = "partial" // Submit the valid jobs and report the rest
+)
+
+// BatchSubmitRequest is a set of job specs submitted in one call. Each job
+// is in the API's JSON form or a declarative job document, as SubmitJob
+// takes them.
+type BatchSubmitRequest struct {
+	Mode string            `json:"mode,omitempty"` // atomic, partial (default)
+	Jobs []json.RawMessage `json:"jobs"`
+}
+
+// BatchItemResult is the outcome of one job in a batch, in request order
+type BatchItemResult struct {
+	Index  int    `json:"index"`
+	JobID  string `json:"job_id,omitempty"`
+	Status string `json:"status"` // submitted, rejected, skipped
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchSubmitResponse summarizes a batch submission
+type BatchSubmitResponse struct {
+	BatchID   string            `json:"batch_id"`
+	Mode      string            `json:"mode"`
+	Submitted int               `json:"submitted"`
+	Rejected  int               `json:"rejected"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// maxBatchJobs is the largest batch accepted, from MAX_BATCH_JOBS (default 500)
+func maxBatchJobs() int {
+	if n, err := strconv.Atoi(os.Getenv("MAX_BATCH_JOBS")); err == nil && n > 0 {
+		return n
+	}
+	return 500
+}
+
+// SubmitJobBatch validates every job in a batch before submitting any. In
+// atomic mode a single invalid job rejects the whole batch; in partial mode
+// the valid jobs are submitted and the invalid ones reported. Results are
+// returned in request order.
+func (s *SchedulerService) SubmitJobBatch(w http.ResponseWriter, r *http.Request) {
+	var req BatchSubmitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Mode == "" {
+		req.Mode = BatchPartial
+	}
+	if req.Mode != BatchAtomic && req.Mode != BatchPartial {
+		http.Error(w, "Mode must be atomic or partial", http.StatusBadRequest)
+		return
+	}
+	if len(req.Jobs) == 0 {
+		http.Error(w, "Batch contains no jobs", http.StatusBadRequest)
+		return
+	}
+	if limit := maxBatchJobs(); len(req.Jobs) > limit {
+		http.Error(w, fmt.Sprintf("Batch exceeds %d jobs", limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	claims := r.Context().Value("claims").(*Claims)
+	now := time.Now()
+	region := s.federation.Region()
+
+	resp := BatchSubmitResponse{
+		Mode:    req.Mode,
+		Results: make([]BatchItemResult, len(req.Jobs)),
+	}
+
+	// Validate everything before any job is queued; jobs that cannot be
+	// decoded stay nil
+	jobs := make([]*Job, len(req.Jobs))
+	for i, body := range req.Jobs {
+		resp.Results[i] = BatchItemResult{Index: i, Status: "submitted"}
+		job, err := decodeJob(body, false)
+		if err == nil {
+			job.Status = "pending"
+			job.CreatedAt = now
+			job.Region = region
+			job.HomeRegion = region
+			job.UserID = claims.UserID
+			job.OrgID = claims.OrgID
+			jobs[i] = job
+			err = s.validateJobRequirements(job)
+		}
+		if err == nil && job.TargetAgentID != "" {
+			err = fmt.Errorf("target_agent_id is reserved for provider verification jobs")
+		}
+		if err == nil {
+			// A match prices the job only if it is the caller's
+			err = s.costs.bindMatch(job)
+		}
+		if err == nil && job.QuoteID != "" && req.Mode == BatchAtomic {
+			// A redeemed quote cannot be returned if a later job fails
+			err = fmt.Errorf("quotes cannot be redeemed in atomic batches")
+		}
+		if err != nil {
+			resp.Results[i].Status = "rejected"
+			resp.Results[i].Error = err.Error()
+			resp.Rejected++
+		}
+	}
+
+	if req.Mode == BatchAtomic && resp.Rejected > 0 {
+		for i := range resp.Results {
+			if resp.Results[i].Status == "submitted" {
+				resp.Results[i].Status = "skipped"
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	// Time based IDs would collide within a batch, so jobs are numbered
+	// after the batch ID by their position in the request
+	resp.BatchID = generateID()
+	for i, job := range jobs {
+		if job != nil {
+			job.ID = fmt.Sprintf("%s-%d", resp.BatchID, i)
+		}
+	}
+
+	// Quotes are redeemed per job; a rejected quote only fails its own job
+	for i, job := range jobs {
+		if resp.Results[i].Status != "submitted" || job.QuoteID == "" {
+			continue
+		}
+		price, err := s.redeemQuote(r.Context(), job)
+		if err != nil {
+			resp.Results[i].Status = "rejected"
+			resp.Results[i].Error = err.Error()
+			resp.Rejected++
+			continue
+		}
+		job.QuotedPrice = price
+	}
+
+	accepted := make([]*Job, 0, len(jobs))
+	s.mu.Lock()
+	for i, job := range jobs {
+		if resp.Results[i].Status != "submitted" {
+			continue
+		}
+		job.EstimatedCost = s.estimateJobCost(job)
+
+		s.jobs[job.ID] = job
+		job.QueuedAt = time.Now()
+		s.jobQueue = append(s.jobQueue, job)
+		accepted = append(accepted, job)
+		resp.Results[i].JobID = job.ID
+		resp.Submitted++
+	}
+	s.queueLength.Set(float64(len(s.jobQueue)))
+	s.mu.Unlock()
+
+	// Queued jobs are picked up by the queue processor rather than scheduled
+	// inline, so large batches do not start hundreds of goroutines at once
+	for _, job := range accepted {
+		s.publishJobEvent(r.Context(), "job.created", job)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
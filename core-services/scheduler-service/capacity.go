@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/computehive/core-services/pkg/jobspec"
+	"github.com/computehive/core-services/pkg/obs"
+)
+
+// capacityQueryTimeout bounds how long placement waits on the capacity index
+// before falling back to scanning agents locally
+const capacityQueryTimeout = 2 * time.Second
+
+// dryRunListedAgents is how many matching agents a dry run lists
+const dryRunListedAgents = 10
+
+// capacityResult is the resource-service answer to a capacity query
+type capacityResult struct {
+	MatchingAgents int `json:"matching_agents"`
+	TotalCPU       int `json:"total_cpu_available"`
+	TotalMemoryMB  int `json:"total_memory_available_mb"`
+	TotalFreeGPUs  int `json:"total_free_gpus"`
+	Agents         []struct {
+		AgentID    string    `json:"agent_id"`
+		Region     string    `json:"region,omitempty"`
+		FreeGPUs   int       `json:"free_gpus"`
+		UpdatedAt  time.Time `json:"updated_at"`
+		AgeSeconds float64   `json:"age_seconds"`
+	} `json:"agents"`
+	StaleAgents  int        `json:"stale_agents"`
+	OldestUpdate *time.Time `json:"oldest_update,omitempty"`
+	NewestUpdate *time.Time `json:"newest_update,omitempty"`
+	GeneratedAt  time.Time  `json:"generated_at"`
+}
+
+// queryCapacity asks the resource-service capacity index which agents can
+// run a job. It is the source of truth for "can anyone run this?" in both
+// placement and dry runs.
+func (s *SchedulerService) queryCapacity(ctx context.Context, job *Job) (*capacityResult, error) {
+	resourceURL := os.Getenv("RESOURCE_SERVICE_URL")
+	if resourceURL == "" {
+		resourceURL = "http://resource-service:8006"
+	}
+
+	query := map[string]interface{}{
+		"cpu_cores":    job.Requirements.CPUCores,
+		"memory_mb":    job.Requirements.MemoryMB,
+		"gpu_count":    job.Requirements.GPUCount,
+		"gpu_type":     job.Requirements.GPUType,
+		"storage_mb":   job.Requirements.StorageMB,
+		"network_mbps": job.Requirements.NetworkMbps,
+		"capabilities": job.Requirements.Capabilities,
+		"agent_id":     job.TargetAgentID,
+	}
+	if job.SLARequirements != nil {
+		query["regions"] = job.SLARequirements.PreferredRegions
+	}
+	body, _ := json.Marshal(query)
+
+	ctx, cancel := context.WithTimeout(ctx, capacityQueryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", resourceURL+"/api/v1/capacity/query", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to reach resource service: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, obs.ResponseError(resp, "capacity query failed")
+	}
+
+	var result capacityResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode capacity result: %w", err)
+	}
+	return &result, nil
+}
+
+// agentMeetsPolicy checks the constraints the capacity index does not know
+// about: agent pinning, trust tier, GPU runtime versions, maintenance
+// windows and the job's cost ceiling
+func (s *SchedulerService) agentMeetsPolicy(agent *Agent, job *Job) bool {
+	if job.TargetAgentID != "" && agent.ID != job.TargetAgentID {
+		return false
+	}
+	if !agent.TrustTier.Meets(jobMinTrustTier(job)) {
+		return false
+	}
+	if !s.acceptsNewJobs(agent) {
+		return false
+	}
+	if job.Requirements.Unmet(agent.Resources.GPURuntime) != "" {
+		return false
+	}
+	if !clearOfMaintenance(agent, job, time.Now()) {
+		return false
+	}
+	if job.SLARequirements != nil && s.calculateAgentHourlyRate(agent, job) > job.SLARequirements.MaxCostPerHour {
+		return false
+	}
+	return true
+}
+
+// indexedSuitableAgents resolves the agents the capacity index matched for a
+// job to the scheduler's agent records
+func (s *SchedulerService) indexedSuitableAgents(ctx context.Context, job *Job) ([]*Agent, *capacityResult, error) {
+	result, err := s.queryCapacity(ctx, job)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var suitable []*Agent
+	for _, match := range result.Agents {
+		agent, exists := s.agents[match.AgentID]
+		if exists && s.agentMeetsPolicy(agent, job) {
+			suitable = append(suitable, agent)
+		}
+	}
+	return suitable, result, nil
+}
+
+// DryRunResult reports whether a job would be accepted and could be placed now
+type DryRunResult struct {
+	Valid              bool                 `json:"valid"`
+	Error              string               `json:"error,omitempty"`
+	FieldErrors        []jobspec.FieldError `json:"field_errors,omitempty"` // Invalid fields of a job document
+	Schedulable        bool                 `json:"schedulable"`
+	MatchingAgents     int                  `json:"matching_agents"`
+	LimitingConstraint string               `json:"limiting_constraint,omitempty"`
+	EstimatedCost      float64              `json:"estimated_cost"`
+	Capacity           *capacityResult      `json:"capacity,omitempty"`
+	CapacitySource     string               `json:"capacity_source"` // index, local
+}
+
+// DryRunJob validates a job spec and checks it against current capacity
+// without queueing it
+func (s *SchedulerService) DryRunJob(w http.ResponseWriter, r *http.Request) {
+	result := &DryRunResult{Valid: true, CapacitySource: "index"}
+	job, err := decodeJobRequest(r)
+	if err == nil {
+		job.OrgID = r.Context().Value("claims").(*Claims).OrgID
+		err = s.validateJobRequirements(job)
+	}
+	if err != nil {
+		result.Valid = false
+		result.Error = err.Error()
+		result.FieldErrors = fieldErrors(err)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+	result.EstimatedCost = s.estimateJobCost(job)
+
+	agents, capacity, err := s.indexedSuitableAgents(r.Context(), job)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Capacity index unavailable for dry run, scanning agents", obs.KeyError, err)
+		result.CapacitySource = "local"
+		agents = s.findSuitableAgentsLocal(job)
+	} else {
+		// Keep the response small; the counts still cover every agent
+		if len(capacity.Agents) > dryRunListedAgents {
+			capacity.Agents = capacity.Agents[:dryRunListedAgents]
+		}
+		result.Capacity = capacity
+	}
+	result.MatchingAgents = len(agents)
+	result.Schedulable = result.MatchingAgents > 0
+	if !result.Schedulable {
+		result.LimitingConstraint = s.limitingConstraint(job)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
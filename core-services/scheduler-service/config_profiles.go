@@ -0,0 +1,659 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// Rollout states of a config profile revision
+const (
+	RolloutRolling  = "rolling"
+	RolloutComplete = "complete"
+	RolloutHalted   = "halted"
+)
+
+// Rollout health thresholds
+const (
+	defaultRolloutPercentage = 10
+	defaultMaxErrorRate      = 0.2
+	minRolloutReports        = 3
+	agentSilentAfter         = 2 * time.Minute
+)
+
+// knownRuntimes are the job runtimes a profile may enable
+var knownRuntimes = map[string]bool{"docker": true, "kubernetes": true, "binary": true, "wasm": true, "script": true}
+
+// ProfileSpec is the configuration pushed to agents
+type ProfileSpec struct {
+	MaxConcurrentJobs int      `json:"max_concurrent_jobs,omitempty"`
+	MaxCPUCores       int      `json:"max_cpu_cores,omitempty"` // Per job
+	MaxMemoryMB       int      `json:"max_memory_mb,omitempty"` // Per job
+	Runtimes          []string `json:"runtimes,omitempty"`      // Enabled job types; empty enables all
+	UpdateChannel     string   `json:"update_channel,omitempty"`
+}
+
+// ProfileRollout tracks the staged rollout of a profile's current revision
+type ProfileRollout struct {
+	Percentage   int       `json:"percentage"` // Share of matching agents on the new revision
+	Status       string    `json:"status"`
+	MaxErrorRate float64   `json:"max_error_rate"` // Halts the rollout when exceeded
+	HaltReason   string    `json:"halt_reason,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+}
+
+// ConfigProfile is a named agent configuration assigned to agents by label
+type ConfigProfile struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	Selector  map[string]string `json:"selector"` // Agent labels that must all match
+	Priority  int               `json:"priority"` // Highest matching priority wins
+	Spec      ProfileSpec       `json:"spec"`
+	Revision  int               `json:"revision"`
+	Previous  *ProfileSpec      `json:"previous,omitempty"` // Served to agents outside the rollout
+	Rollout   ProfileRollout    `json:"rollout"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// AgentConfigAssignment is what an agent receives when it polls for configuration
+type AgentConfigAssignment struct {
+	ProfileID string       `json:"profile_id,omitempty"` // Empty when no profile applies
+	Revision  int          `json:"revision,omitempty"`
+	Spec      *ProfileSpec `json:"spec,omitempty"`
+}
+
+// agentControlMessage is pushed to an agent over its control channel
+type agentControlMessage struct {
+	Type   string                 `json:"type"` // config
+	Config *AgentConfigAssignment `json:"config,omitempty"`
+}
+
+// agentChannel is an agent's open control channel
+type agentChannel struct {
+	conn *websocket.Conn
+	sent *AgentConfigAssignment // Last assignment pushed
+	mu   sync.Mutex             // Serializes writes and guards sent
+}
+
+// AgentConfigStatus is an agent's report after applying a profile revision
+type AgentConfigStatus struct {
+	AgentID    string    `json:"agent_id"`
+	ProfileID  string    `json:"profile_id"`
+	Revision   int       `json:"revision"`
+	Error      string    `json:"error,omitempty"`
+	ReportedAt time.Time `json:"reported_at"`
+}
+
+// ConfigProfiles manages fleet configuration profiles and their rollouts.
+// Agents hold a control channel open, over which each one is pushed its
+// assignment whenever a profile change, rollout step or halt changes it.
+type ConfigProfiles struct {
+	scheduler *SchedulerService
+	profiles  map[string]*ConfigProfile
+	status    map[string]*AgentConfigStatus // by agent ID
+	channels  map[string]*agentChannel      // by agent ID
+	upgrader  websocket.Upgrader
+	mu        sync.RWMutex
+	pushMu    sync.Mutex // Orders pushes, so an older assignment never follows a newer one
+}
+
+// NewConfigProfiles creates an empty profile registry
+func NewConfigProfiles(s *SchedulerService) *ConfigProfiles {
+	return &ConfigProfiles{
+		scheduler: s,
+		profiles:  make(map[string]*ConfigProfile),
+		status:    make(map[string]*AgentConfigStatus),
+		channels:  make(map[string]*agentChannel),
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				// Agents are authenticated by token, not origin
+				return true
+			},
+		},
+	}
+}
+
+// validate checks a profile spec
+func (spec *ProfileSpec) validate() error {
+	if spec.MaxConcurrentJobs < 0 || spec.MaxCPUCores < 0 || spec.MaxMemoryMB < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	for _, runtime := range spec.Runtimes {
+		if !knownRuntimes[runtime] {
+			return fmt.Errorf("unknown runtime %q", runtime)
+		}
+	}
+	switch spec.UpdateChannel {
+	case "", "stable", "beta", "canary":
+	default:
+		return fmt.Errorf("update_channel must be stable, beta or canary")
+	}
+	return nil
+}
+
+// matches reports whether an agent's labels satisfy the profile selector
+func (p *ConfigProfile) matches(labels map[string]string) bool {
+	for key, value := range p.Selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// inCohort deterministically places an agent inside or outside the rollout percentage
+func (p *ConfigProfile) inCohort(agentID string) bool {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%s/%d", p.ID, agentID, p.Revision)
+	return int(h.Sum32()%100) < p.Rollout.Percentage
+}
+
+// resolve picks the configuration an agent should run. Callers hold c.mu.
+func (c *ConfigProfiles) resolve(agentID string, labels map[string]string) AgentConfigAssignment {
+	var best *ConfigProfile
+	for _, profile := range c.profiles {
+		if !profile.matches(labels) {
+			continue
+		}
+		if best == nil || profile.Priority > best.Priority ||
+			(profile.Priority == best.Priority && profile.CreatedAt.Before(best.CreatedAt)) {
+			best = profile
+		}
+	}
+	if best == nil {
+		return AgentConfigAssignment{}
+	}
+
+	// Halted rollouts only keep agents that already applied the new revision
+	onNew := best.inCohort(agentID)
+	if best.Rollout.Status == RolloutHalted {
+		status := c.status[agentID]
+		onNew = status != nil && status.ProfileID == best.ID && status.Revision == best.Revision && status.Error == ""
+	}
+	if best.Rollout.Status == RolloutComplete || onNew {
+		spec := best.Spec
+		return AgentConfigAssignment{ProfileID: best.ID, Revision: best.Revision, Spec: &spec}
+	}
+	if best.Previous != nil {
+		spec := *best.Previous
+		return AgentConfigAssignment{ProfileID: best.ID, Revision: best.Revision - 1, Spec: &spec}
+	}
+	return AgentConfigAssignment{}
+}
+
+// evaluateRollout halts a rollout whose agents fail to apply it or stop reporting. Callers hold c.mu.
+func (c *ConfigProfiles) evaluateRollout(profile *ConfigProfile, lastSeen map[string]time.Time, now time.Time) {
+	if profile.Rollout.Status == RolloutHalted {
+		return
+	}
+
+	var reports, failures int
+	for agentID, status := range c.status {
+		if status.ProfileID != profile.ID || status.Revision != profile.Revision {
+			continue
+		}
+		reports++
+		if status.Error != "" {
+			failures++
+		} else if seen, ok := lastSeen[agentID]; ok && now.Sub(seen) > agentSilentAfter {
+			failures++
+		}
+	}
+	if reports < minRolloutReports {
+		return
+	}
+
+	rate := float64(failures) / float64(reports)
+	if rate <= profile.Rollout.MaxErrorRate {
+		return
+	}
+
+	profile.Rollout.Status = RolloutHalted
+	profile.Rollout.HaltReason = fmt.Sprintf("error rate %.0f%% across %d agents exceeded %.0f%%",
+		rate*100, reports, profile.Rollout.MaxErrorRate*100)
+	slog.Warn("Config profile rollout halted", "profile", profile.Name, "revision", profile.Revision, "reason", profile.Rollout.HaltReason)
+
+	data, _ := json.Marshal(profile)
+	c.scheduler.nats.Publish("config.rollout_halted", data)
+}
+
+// agentLabels snapshots agent labels
+func (c *ConfigProfiles) agentLabels() map[string]map[string]string {
+	s := c.scheduler
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	labels := make(map[string]map[string]string, len(s.agents))
+	for id, agent := range s.agents {
+		labels[id] = agent.Labels
+	}
+	return labels
+}
+
+// push sends an agent its assignment over its control channel unless it
+// was the last one sent
+func (ch *agentChannel) push(assignment AgentConfigAssignment) error {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	if ch.sent != nil && ch.sent.ProfileID == assignment.ProfileID && ch.sent.Revision == assignment.Revision {
+		return nil
+	}
+	ch.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := ch.conn.WriteJSON(agentControlMessage{Type: "config", Config: &assignment}); err != nil {
+		return err
+	}
+	ch.sent = &assignment
+	return nil
+}
+
+// pushAssignments pushes every connected agent its assignment if it changed
+func (c *ConfigProfiles) pushAssignments() {
+	c.pushMu.Lock()
+	defer c.pushMu.Unlock()
+	labels := c.agentLabels()
+
+	c.mu.RLock()
+	channels := make(map[*agentChannel]AgentConfigAssignment, len(c.channels))
+	for agentID, ch := range c.channels {
+		channels[ch] = c.resolve(agentID, labels[agentID])
+	}
+	c.mu.RUnlock()
+
+	for ch, assignment := range channels {
+		if err := ch.push(assignment); err != nil {
+			// The agent's read loop ends with the connection and unregisters it
+			ch.conn.Close()
+		}
+	}
+}
+
+// agentLastSeen snapshots agent heartbeat times
+func (c *ConfigProfiles) agentLastSeen() map[string]time.Time {
+	s := c.scheduler
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]time.Time, len(s.agents))
+	for id, agent := range s.agents {
+		seen[id] = agent.LastSeen
+	}
+	return seen
+}
+
+// monitorRollouts re-evaluates rollouts so agents that go silent are noticed
+func (c *ConfigProfiles) monitorRollouts() {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		lastSeen := c.agentLastSeen()
+		now := time.Now()
+
+		c.mu.Lock()
+		for _, profile := range c.profiles {
+			c.evaluateRollout(profile, lastSeen, now)
+		}
+		c.mu.Unlock()
+
+		// Also catches agents whose labels changed
+		c.pushAssignments()
+	}
+}
+
+// HTTP Handlers
+
+// CreateProfile creates a config profile and starts rolling out its first revision
+func (c *ConfigProfiles) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	var req struct {
+		Name         string            `json:"name"`
+		Selector     map[string]string `json:"selector"`
+		Priority     int               `json:"priority"`
+		Spec         ProfileSpec       `json:"spec"`
+		Percentage   *int              `json:"rollout_percentage"`
+		MaxErrorRate float64           `json:"max_error_rate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if err := req.Spec.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rollout, err := newRollout(req.Percentage, req.MaxErrorRate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	profile := &ConfigProfile{
+		ID:        generateID(),
+		Name:      req.Name,
+		Selector:  req.Selector,
+		Priority:  req.Priority,
+		Spec:      req.Spec,
+		Revision:  1,
+		Rollout:   rollout,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	c.mu.Lock()
+	c.profiles[profile.ID] = profile
+	view := *profile
+	c.mu.Unlock()
+	go c.pushAssignments()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+// ListProfiles returns all config profiles by priority
+func (c *ConfigProfiles) ListProfiles(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	c.mu.RLock()
+	profiles := make([]ConfigProfile, 0, len(c.profiles))
+	for _, profile := range c.profiles {
+		profiles = append(profiles, *profile)
+	}
+	c.mu.RUnlock()
+
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Priority > profiles[j].Priority
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// GetProfile returns a profile with per-agent rollout status
+func (c *ConfigProfiles) GetProfile(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	profileID := mux.Vars(r)["id"]
+
+	c.mu.RLock()
+	profile, exists := c.profiles[profileID]
+	if !exists {
+		c.mu.RUnlock()
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	view := struct {
+		ConfigProfile
+		Agents []AgentConfigStatus `json:"agents"`
+	}{ConfigProfile: *profile, Agents: []AgentConfigStatus{}}
+	for _, status := range c.status {
+		if status.ProfileID == profileID {
+			view.Agents = append(view.Agents, *status)
+		}
+	}
+	c.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// UpdateProfile publishes a new revision of a profile and restarts its staged rollout
+func (c *ConfigProfiles) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	profileID := mux.Vars(r)["id"]
+
+	var req struct {
+		Selector     map[string]string `json:"selector"`
+		Priority     *int              `json:"priority"`
+		Spec         ProfileSpec       `json:"spec"`
+		Percentage   *int              `json:"rollout_percentage"`
+		MaxErrorRate float64           `json:"max_error_rate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Spec.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rollout, err := newRollout(req.Percentage, req.MaxErrorRate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	profile, exists := c.profiles[profileID]
+	if !exists {
+		c.mu.Unlock()
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	if req.Selector != nil {
+		profile.Selector = req.Selector
+	}
+	if req.Priority != nil {
+		profile.Priority = *req.Priority
+	}
+
+	// Agents outside the new cohort stay on the revision they were running
+	previous := profile.Spec
+	if profile.Rollout.Status == RolloutHalted && profile.Previous != nil {
+		previous = *profile.Previous
+	}
+	profile.Previous = &previous
+	profile.Spec = req.Spec
+	profile.Revision++
+	profile.Rollout = rollout
+	profile.UpdatedAt = time.Now()
+	view := *profile
+	c.mu.Unlock()
+	go c.pushAssignments()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// SetRollout advances a rollout's percentage, resuming it if it was halted
+func (c *ConfigProfiles) SetRollout(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	profileID := mux.Vars(r)["id"]
+
+	var req struct {
+		Percentage int `json:"percentage"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Percentage < 0 || req.Percentage > 100 {
+		http.Error(w, "Percentage must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	profile, exists := c.profiles[profileID]
+	if !exists {
+		c.mu.Unlock()
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	profile.Rollout.Percentage = req.Percentage
+	profile.Rollout.Status = RolloutRolling
+	profile.Rollout.HaltReason = ""
+	if req.Percentage == 100 {
+		profile.Rollout.Status = RolloutComplete
+	}
+	profile.UpdatedAt = time.Now()
+	view := *profile
+	c.mu.Unlock()
+	go c.pushAssignments()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// DeleteProfile removes a profile; matching agents fall back to their local configuration
+func (c *ConfigProfiles) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	profileID := mux.Vars(r)["id"]
+
+	c.mu.Lock()
+	_, exists := c.profiles[profileID]
+	delete(c.profiles, profileID)
+	c.mu.Unlock()
+
+	if !exists {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	go c.pushAssignments()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AgentControl holds an agent's control channel, pushing the agent its
+// configuration on connect and whenever it changes
+func (c *ConfigProfiles) AgentControl(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	conn, err := c.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Agent control channel upgrade failed", "agent_id", agentID, obs.KeyError, err)
+		return
+	}
+	ch := &agentChannel{conn: conn}
+
+	c.mu.Lock()
+	previous := c.channels[agentID]
+	c.channels[agentID] = ch
+	c.mu.Unlock()
+	if previous != nil {
+		previous.conn.Close()
+	}
+	c.pushAssignments()
+
+	// The agent only reads on this connection; a read error means it went away
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	c.mu.Lock()
+	if c.channels[agentID] == ch {
+		delete(c.channels, agentID)
+	}
+	c.mu.Unlock()
+	conn.Close()
+}
+
+// GetAgentConfig returns the configuration an agent should run; agents
+// fetch it when their control channel connects
+func (c *ConfigProfiles) GetAgentConfig(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	s := c.scheduler
+	s.mu.RLock()
+	var labels map[string]string
+	if agent, exists := s.agents[agentID]; exists {
+		labels = agent.Labels
+	}
+	s.mu.RUnlock()
+
+	c.mu.RLock()
+	assignment := c.resolve(agentID, labels)
+	c.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(assignment)
+}
+
+// ReportAgentConfig records whether an agent applied a profile revision
+func (c *ConfigProfiles) ReportAgentConfig(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	var status AgentConfigStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	status.AgentID = agentID
+	status.ReportedAt = time.Now()
+
+	lastSeen := c.agentLastSeen()
+
+	c.mu.Lock()
+	c.status[agentID] = &status
+	if profile, exists := c.profiles[status.ProfileID]; exists {
+		c.evaluateRollout(profile, lastSeen, status.ReportedAt)
+	}
+	c.mu.Unlock()
+	go c.pushAssignments()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// newRollout builds the rollout state for a new revision
+func newRollout(percentage *int, maxErrorRate float64) (ProfileRollout, error) {
+	rollout := ProfileRollout{
+		Percentage:   defaultRolloutPercentage,
+		Status:       RolloutRolling,
+		MaxErrorRate: defaultMaxErrorRate,
+		StartedAt:    time.Now(),
+	}
+	if percentage != nil {
+		if *percentage < 0 || *percentage > 100 {
+			return rollout, fmt.Errorf("rollout_percentage must be between 0 and 100")
+		}
+		rollout.Percentage = *percentage
+	}
+	if maxErrorRate < 0 || maxErrorRate > 1 {
+		return rollout, fmt.Errorf("max_error_rate must be between 0 and 1")
+	}
+	if maxErrorRate > 0 {
+		rollout.MaxErrorRate = maxErrorRate
+	}
+	if rollout.Percentage == 100 {
+		rollout.Status = RolloutComplete
+	}
+	return rollout, nil
+}
+
+// requireAdmin rejects non-admin callers
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Agent connectivity classes
+const (
+	ConnectivityDirect  = "direct"  // No address translation between the agent and the control plane
+	ConnectivityRelayed = "relayed" // Behind NAT or CGNAT, reached only through agent-initiated connections
+)
+
+// AgentConnectivity is how an agent is connected, as it reports in
+// heartbeats. Agents open every connection to the control plane themselves,
+// so both classes run jobs and expose ports through the tunnel service.
+type AgentConnectivity struct {
+	Class           string    `json:"class"`
+	ObservedAddress string    `json:"observed_address,omitempty"` // Address the control plane saw the agent connect from
+	Addresses       []string  `json:"addresses,omitempty"`        // Routable addresses on the agent's interfaces
+	IPv6            bool      `json:"ipv6"`
+	CheckedAt       time.Time `json:"checked_at"`
+}
+
+// ConnectivityReport counts recently seen agents by connectivity class
+type ConnectivityReport struct {
+	Direct      int       `json:"direct"`
+	Relayed     int       `json:"relayed"`
+	Unknown     int       `json:"unknown"` // Agents that do not report connectivity
+	IPv6        int       `json:"ipv6"`
+	RelayedIDs  []string  `json:"relayed_agent_ids,omitempty"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// parseHeartbeatConnectivity reads the connectivity section of a heartbeat
+func parseHeartbeatConnectivity(raw interface{}) *AgentConnectivity {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var conn AgentConnectivity
+	if err := json.Unmarshal(data, &conn); err != nil {
+		return nil
+	}
+	if conn.Class != ConnectivityDirect && conn.Class != ConnectivityRelayed {
+		return nil
+	}
+	return &conn
+}
+
+// connectivityReport counts the agents heard from recently
+func (s *SchedulerService) connectivityReport(now time.Time) ConnectivityReport {
+	report := ConnectivityReport{GeneratedAt: now}
+
+	s.mu.RLock()
+	for id, agent := range s.agents {
+		if now.Sub(agent.LastSeen) > protocolActiveWindow {
+			continue
+		}
+		conn := agent.Connectivity
+		switch {
+		case conn == nil:
+			report.Unknown++
+		case conn.Class == ConnectivityDirect:
+			report.Direct++
+		default:
+			report.Relayed++
+			report.RelayedIDs = append(report.RelayedIDs, id)
+		}
+		if conn != nil && conn.IPv6 {
+			report.IPv6++
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(report.RelayedIDs)
+	return report
+}
+
+// HTTP Handlers
+
+// ReflectAddress tells an agent the address it connected from, which it
+// compares with its own addresses to detect NAT
+func (s *SchedulerService) ReflectAddress(w http.ResponseWriter, r *http.Request) {
+	ip := s.enrollment.clientIP(r)
+	if ip == nil {
+		http.Error(w, "Could not determine the request's address", http.StatusBadRequest)
+		return
+	}
+
+	family := "ipv6"
+	if ip.To4() != nil {
+		family = "ipv4"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"address": ip.String(),
+		"family":  family,
+	})
+}
+
+// GetConnectivityReport shows how many agents connect directly and how
+// many are relayed (admin only)
+func (s *SchedulerService) GetConnectivityReport(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.connectivityReport(time.Now()))
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+)
+
+// poolLabel is the agent label that groups agents into pools
+const poolLabel = "pool"
+
+// AgentCordon closes an agent to new placements. Jobs already on it keep
+// running unless it is drained.
+type AgentCordon struct {
+	Reason string    `json:"reason"`
+	By     string    `json:"by"`
+	Source string    `json:"source,omitempty"` // What asked for it, e.g. alert:<id> for remediations
+	At     time.Time `json:"at"`
+}
+
+// PoolLimit caps the jobs each agent in a pool runs at once, to scale down
+// an oversubscribed pool without taking its agents out
+type PoolLimit struct {
+	Pool            string    `json:"pool"`
+	MaxJobsPerAgent int       `json:"max_jobs_per_agent"`
+	Reason          string    `json:"reason"`
+	By              string    `json:"by"`
+	Source          string    `json:"source,omitempty"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// fleetControlRequest is the body of cordon, drain and scale-down calls
+type fleetControlRequest struct {
+	Reason string  `json:"reason"`
+	Source string  `json:"source,omitempty"`
+	Factor float64 `json:"factor,omitempty"` // Scale down: share of the current limit kept, default 0.5
+}
+
+// fleetController returns who is cordoning, draining or scaling down: an
+// admin, or another service presenting SERVICE_TOKEN, such as telemetry
+// running alert remediations
+func fleetController(r *http.Request) (string, bool) {
+	if isServiceCaller(r) {
+		return "service", true
+	}
+	if isAdmin(r) {
+		return r.Context().Value("claims").(*Claims).UserID, true
+	}
+	return "", false
+}
+
+// isServiceCaller reports whether a request presents SERVICE_TOKEN
+func isServiceCaller(r *http.Request) bool {
+	token := os.Getenv("SERVICE_TOKEN")
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1
+}
+
+// decodeFleetControl authorizes a fleet control call and decodes its
+// optional body
+func decodeFleetControl(w http.ResponseWriter, r *http.Request) (*fleetControlRequest, string, bool) {
+	by, ok := fleetController(r)
+	if !ok {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return nil, "", false
+	}
+	var req fleetControlRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return nil, "", false
+		}
+	}
+	return &req, by, true
+}
+
+// acceptsNewJobs reports whether placement may add a job to the agent; callers
+// hold s.mu
+func (s *SchedulerService) acceptsNewJobs(agent *Agent) bool {
+	if agent.Cordon != nil {
+		return false
+	}
+	if limit, limited := s.poolLimits[agent.Labels[poolLabel]]; limited && agent.Labels[poolLabel] != "" {
+		return len(agent.ActiveJobs) < limit.MaxJobsPerAgent
+	}
+	return true
+}
+
+// CordonAgent stops new jobs from being placed on an agent
+func (s *SchedulerService) CordonAgent(w http.ResponseWriter, r *http.Request) {
+	req, by, ok := decodeFleetControl(w, r)
+	if !ok {
+		return
+	}
+	agent, ok := s.cordon(mux.Vars(r)["id"], req, by)
+	if !ok {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Agent cordoned", "agent_id", agent.ID, "by", by, "source", req.Source, "reason", req.Reason)
+	s.publishAgentControl(r.Context(), "agent.cordoned", agent, req.Source)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(agent)
+}
+
+// UncordonAgent opens a cordoned agent to new jobs again
+func (s *SchedulerService) UncordonAgent(w http.ResponseWriter, r *http.Request) {
+	req, by, ok := decodeFleetControl(w, r)
+	if !ok {
+		return
+	}
+	agentID := mux.Vars(r)["id"]
+
+	s.mu.Lock()
+	agent, exists := s.agents[agentID]
+	var snapshot Agent
+	if exists {
+		agent.Cordon = nil
+		snapshot = *agent
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Agent uncordoned", "agent_id", agentID, "by", by, "source", req.Source)
+	s.publishAgentControl(r.Context(), "agent.uncordoned", &snapshot, req.Source)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// DrainAgent cordons an agent and moves its jobs elsewhere. Jobs are
+// cancelled on the agent and queued again without spending a retry.
+// Replicas of job groups cannot move alone, so they fail and take their
+// group down with them.
+func (s *SchedulerService) DrainAgent(w http.ResponseWriter, r *http.Request) {
+	req, by, ok := decodeFleetControl(w, r)
+	if !ok {
+		return
+	}
+	agent, ok := s.cordon(mux.Vars(r)["id"], req, by)
+	if !ok {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	var requeued, failed []*Job
+	now := time.Now()
+
+	s.mu.Lock()
+	if live, exists := s.agents[agent.ID]; exists {
+		for _, jobID := range live.ActiveJobs {
+			job, exists := s.jobs[jobID]
+			if !exists || job.AssignedAgentID != agent.ID || job.CompletedAt != nil {
+				continue
+			}
+			job.AssignedAgentID = ""
+			job.ScheduledAt = nil
+			if job.GroupID != "" {
+				job.Status = "failed"
+				job.CompletedAt = &now
+				failed = append(failed, job)
+				continue
+			}
+			job.Status = "pending"
+			job.QueuedAt = now
+			s.jobQueue = append(s.jobQueue, job)
+			requeued = append(requeued, job)
+		}
+		live.ActiveJobs = make([]string, 0)
+		agent.ActiveJobs = live.ActiveJobs
+	}
+	s.queueLength.Set(float64(len(s.jobQueue)))
+	s.mu.Unlock()
+
+	for _, job := range append(requeued, failed...) {
+		s.notifyAgentJobCancelled(agent.ID, job.ID)
+	}
+	for _, job := range requeued {
+		s.publishJobEvent(r.Context(), "job.rescheduled", job)
+	}
+	for _, job := range failed {
+		s.jobsFailed.Inc()
+		s.publishJobEvent(r.Context(), "job.failed", job)
+	}
+
+	slog.InfoContext(r.Context(), "Agent drained", "agent_id", agent.ID, "by", by, "source", req.Source,
+		"reason", req.Reason, "requeued", len(requeued), "failed", len(failed))
+	s.publishAgentControl(r.Context(), "agent.drained", agent, req.Source)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"agent":    agent,
+		"requeued": len(requeued),
+		"failed":   len(failed),
+	})
+}
+
+// cordon marks an agent cordoned, keeping the first cordon's record if it
+// already is, and returns a snapshot of it
+func (s *SchedulerService) cordon(agentID string, req *fleetControlRequest, by string) (*Agent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	agent, exists := s.agents[agentID]
+	if !exists {
+		return nil, false
+	}
+	if agent.Cordon == nil {
+		agent.Cordon = &AgentCordon{Reason: req.Reason, By: by, Source: req.Source, At: time.Now()}
+	}
+	snapshot := *agent
+	return &snapshot, true
+}
+
+// ScaleDownPool lowers the number of jobs each agent in a pool may run at
+// once. The first scale-down starts from the busiest agent's current load.
+func (s *SchedulerService) ScaleDownPool(w http.ResponseWriter, r *http.Request) {
+	req, by, ok := decodeFleetControl(w, r)
+	if !ok {
+		return
+	}
+	pool := mux.Vars(r)["pool"]
+	factor := req.Factor
+	if factor == 0 {
+		factor = 0.5
+	}
+	if factor <= 0 || factor >= 1 {
+		http.Error(w, "factor must be between 0 and 1", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	current, agents := 0, 0
+	for _, agent := range s.agents {
+		if agent.Labels[poolLabel] != pool {
+			continue
+		}
+		agents++
+		if len(agent.ActiveJobs) > current {
+			current = len(agent.ActiveJobs)
+		}
+	}
+	if limit, limited := s.poolLimits[pool]; limited {
+		current = limit.MaxJobsPerAgent
+	}
+	if agents == 0 {
+		s.mu.Unlock()
+		http.Error(w, "Pool not found", http.StatusNotFound)
+		return
+	}
+	limit := &PoolLimit{
+		Pool:            pool,
+		MaxJobsPerAgent: int(math.Max(1, math.Floor(float64(current)*factor))),
+		Reason:          req.Reason,
+		By:              by,
+		Source:          req.Source,
+		UpdatedAt:       time.Now(),
+	}
+	s.poolLimits[pool] = limit
+	s.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Pool scaled down", "pool", pool, "max_jobs_per_agent", limit.MaxJobsPerAgent,
+		"previous", current, "by", by, "source", req.Source, "reason", req.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limit)
+}
+
+// ResetPoolLimit lifts a pool's job limit
+func (s *SchedulerService) ResetPoolLimit(w http.ResponseWriter, r *http.Request) {
+	req, by, ok := decodeFleetControl(w, r)
+	if !ok {
+		return
+	}
+	pool := mux.Vars(r)["pool"]
+
+	s.mu.Lock()
+	_, limited := s.poolLimits[pool]
+	delete(s.poolLimits, pool)
+	s.mu.Unlock()
+
+	if !limited {
+		http.Error(w, "Pool has no limit", http.StatusNotFound)
+		return
+	}
+	slog.InfoContext(r.Context(), "Pool limit lifted", "pool", pool, "by", by, "source", req.Source)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListPoolLimits returns the pools running under a job limit
+func (s *SchedulerService) ListPoolLimits(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	limits := make([]*PoolLimit, 0, len(s.poolLimits))
+	for _, limit := range s.poolLimits {
+		snapshot := *limit
+		limits = append(limits, &snapshot)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(limits, func(i, j int) bool { return limits[i].Pool < limits[j].Pool })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+func (s *SchedulerService) publishAgentControl(ctx context.Context, event string, agent *Agent, source string) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"agent_id": agent.ID,
+		"cordon":   agent.Cordon,
+		"source":   source,
+	})
+	if err := s.bus.Publish(ctx, event, data); err != nil {
+		obs.LogError(ctx, "Failed to publish agent control event", err, "event", event, "agent_id", agent.ID)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/nats-io/nats.go"
+)
+
+// Cost meter settings
+const (
+	costMeterMaxGap   = 2 * time.Minute // Longest stretch accrued between two samples
+	costEventInterval = time.Minute     // Cost events per job on its event stream
+)
+
+// Price sources, from what settlement honors first
+const (
+	PriceSourceQuote = "quote" // Hourly price locked by a marketplace quote
+	PriceSourceMatch = "match" // Price agreed in the job's marketplace match
+	PriceSourceList  = "list"  // List rates for the job's requirements
+)
+
+// JobCost is what a job has cost so far
+type JobCost struct {
+	JobID        string     `json:"job_id"`
+	PricePerHour float64    `json:"price_per_hour"`
+	PriceSource  string     `json:"price_source"`
+	CostToDate   float64    `json:"cost_to_date"`
+	MeteredHours float64    `json:"metered_hours"`
+	CPUCores     float64    `json:"cpu_cores"` // In the latest sample
+	MemoryMB     int64      `json:"memory_mb"`
+	LastSampleAt *time.Time `json:"last_sample_at,omitempty"`
+	Final        bool       `json:"final"` // The job finished; the cost no longer changes
+}
+
+// matchTerms is what the scheduler knows of a confirmed marketplace match
+type matchTerms struct {
+	consumerID string
+	price      float64 // Agreed per hour
+}
+
+// jobMeter accrues one running job's cost
+type jobMeter struct {
+	cost      JobCost
+	lastEvent time.Time
+}
+
+// heartbeatJobUsage is a running job's usage in a heartbeat
+type heartbeatJobUsage struct {
+	JobID       string  `json:"job_id"`
+	CPUCores    float64 `json:"cpu_cores"`
+	MemoryBytes int64   `json:"memory_bytes"`
+}
+
+// CostMeter turns agent heartbeats into a live cost-to-date per running
+// job, so consumers can watch spend accumulate and cancel runaway jobs
+// before they are billed.
+//
+// Every heartbeat listing a job accrues its hourly price over the time since
+// the previous one. Stretches longer than costMeterMaxGap are cut short, so
+// a job on an agent that stopped reporting stops accruing. The price is the
+// job's quote, else its marketplace match's agreed price, else list rates,
+// re-read on every sample so resizes and re-pricing show up immediately.
+// A match price only applies to jobs of the match's consumer.
+// Cost updates go out on the job's event stream at most once a minute.
+type CostMeter struct {
+	scheduler *SchedulerService
+	meters    map[string]*jobMeter
+	matches   map[string]matchTerms // by match ID
+	mu        sync.Mutex
+}
+
+// NewCostMeter creates the cost meter
+func NewCostMeter(s *SchedulerService) *CostMeter {
+	return &CostMeter{
+		scheduler: s,
+		meters:    make(map[string]*jobMeter),
+		matches:   make(map[string]matchTerms),
+	}
+}
+
+// subscribe follows the prices agreed in marketplace matches
+func (c *CostMeter) subscribe(nc *nats.Conn) {
+	c.scheduler.bus.Subscribe("match.confirmed", func(ctx context.Context, msg *nats.Msg) error {
+		c.recordMatchPrice(msg.Data)
+		return nil
+	})
+	nc.Subscribe("match.resized", func(msg *nats.Msg) {
+		var resized struct {
+			Match json.RawMessage `json:"match"`
+		}
+		if err := json.Unmarshal(msg.Data, &resized); err == nil {
+			c.recordMatchPrice(resized.Match)
+		}
+	})
+}
+
+// recordMatchPrice keeps the consumer and agreed price of a match
+func (c *CostMeter) recordMatchPrice(data []byte) {
+	var match struct {
+		ID          string      `json:"id"`
+		ConsumerID  string      `json:"consumer_id"`
+		AgreedPrice json.Number `json:"agreed_price"`
+	}
+	if err := json.Unmarshal(data, &match); err != nil || match.ID == "" || match.ConsumerID == "" {
+		return
+	}
+	price, err := match.AgreedPrice.Float64()
+	if err != nil || price < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.matches[match.ID] = matchTerms{consumerID: match.ConsumerID, price: price}
+	c.mu.Unlock()
+}
+
+// bindMatch checks that a submitted job's match is a confirmed match of the
+// job's user, so it cannot run at the price of someone else's match
+func (c *CostMeter) bindMatch(job *Job) error {
+	if job.MatchID == "" {
+		return nil
+	}
+	c.mu.Lock()
+	terms, known := c.matches[job.MatchID]
+	c.mu.Unlock()
+	if !known || terms.consumerID != job.UserID {
+		return obs.Errorf(obs.CodePermissionDenied, "match %s is not a confirmed match of the caller", job.MatchID)
+	}
+	return nil
+}
+
+// price returns a job's hourly price and where it comes from. Callers hold
+// the scheduler lock.
+func (c *CostMeter) price(job *Job) (float64, string) {
+	if job.QuotedPrice > 0 {
+		return job.QuotedPrice, PriceSourceQuote
+	}
+	if job.MatchID != "" {
+		c.mu.Lock()
+		terms, known := c.matches[job.MatchID]
+		c.mu.Unlock()
+		if known && terms.consumerID == job.UserID {
+			return terms.price, PriceSourceMatch
+		}
+	}
+	return requirementsHourlyRate(job.Requirements), PriceSourceList
+}
+
+// observe accrues the cost of the jobs an agent reports running
+func (c *CostMeter) observe(agentID string, heartbeat map[string]interface{}, now time.Time) {
+	usage := make(map[string]heartbeatJobUsage)
+	if resources, ok := heartbeat["resources"].(map[string]interface{}); ok {
+		if breakdown, ok := resources["usage"].(map[string]interface{}); ok {
+			data, _ := json.Marshal(breakdown["jobs"])
+			var jobs []heartbeatJobUsage
+			if json.Unmarshal(data, &jobs) == nil {
+				for _, job := range jobs {
+					usage[job.JobID] = job
+				}
+			}
+		}
+	}
+	running := make(map[string]bool, len(usage))
+	for _, jobID := range stringList(heartbeat["active_jobs"]) {
+		running[jobID] = true
+	}
+	for jobID := range usage {
+		running[jobID] = true
+	}
+
+	s := c.scheduler
+	for jobID := range running {
+		s.mu.RLock()
+		job, exists := s.jobs[jobID]
+		if !exists || job.AssignedAgentID != agentID || job.CompletedAt != nil {
+			s.mu.RUnlock()
+			continue
+		}
+		price, source := c.price(job)
+		start := job.StartedAt
+		if start == nil {
+			start = job.ScheduledAt
+		}
+		s.mu.RUnlock()
+
+		c.mu.Lock()
+		meter := c.meters[jobID]
+		if meter == nil {
+			meter = &jobMeter{cost: JobCost{JobID: jobID}}
+			c.meters[jobID] = meter
+		}
+		since := start
+		if meter.cost.LastSampleAt != nil {
+			since = meter.cost.LastSampleAt
+		}
+		if since == nil || since.After(now) {
+			since = &now
+		}
+		accrue(&meter.cost, price, now.Sub(*since))
+		meter.cost.PricePerHour = price
+		meter.cost.PriceSource = source
+		sampledAt := now
+		meter.cost.LastSampleAt = &sampledAt
+		if sample, ok := usage[jobID]; ok {
+			meter.cost.CPUCores = sample.CPUCores
+			meter.cost.MemoryMB = sample.MemoryBytes / (1024 * 1024)
+		}
+		cost := meter.cost
+		emit := now.Sub(meter.lastEvent) >= costEventInterval
+		if emit {
+			meter.lastEvent = now
+		}
+		c.mu.Unlock()
+
+		c.update(jobID, &cost, emit)
+	}
+}
+
+// accrue adds a stretch of running time at a price, cut to costMeterMaxGap
+func accrue(cost *JobCost, price float64, elapsed time.Duration) {
+	if elapsed <= 0 {
+		return
+	}
+	if elapsed > costMeterMaxGap {
+		elapsed = costMeterMaxGap
+	}
+	cost.CostToDate += price * elapsed.Hours()
+	cost.MeteredHours += elapsed.Hours()
+}
+
+// finish closes a finished job's meter, accruing up to its completion, and
+// sends the final cost
+func (c *CostMeter) finish(jobID string) {
+	s := c.scheduler
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	var completedAt time.Time
+	var price float64
+	var source string
+	if exists {
+		completedAt = time.Now()
+		if job.CompletedAt != nil {
+			completedAt = *job.CompletedAt
+		}
+		price, source = c.price(job)
+	}
+	s.mu.RUnlock()
+
+	c.mu.Lock()
+	meter, metered := c.meters[jobID]
+	delete(c.meters, jobID)
+	c.mu.Unlock()
+	if !exists || !metered {
+		return
+	}
+
+	cost := meter.cost
+	accrue(&cost, price, completedAt.Sub(*cost.LastSampleAt))
+	cost.PricePerHour = price
+	cost.PriceSource = source
+	cost.Final = true
+	c.update(jobID, &cost, true)
+}
+
+// update stores a job's cost to date and, when emit is set, sends it on the
+// job's event stream
+func (c *CostMeter) update(jobID string, cost *JobCost, emit bool) {
+	s := c.scheduler
+	s.mu.Lock()
+	job, exists := s.jobs[jobID]
+	var status string
+	if exists {
+		job.CostToDate = cost.CostToDate
+		status = job.Status
+	}
+	s.mu.Unlock()
+
+	if exists && emit {
+		s.events.Record(JobEvent{
+			JobID:  jobID,
+			Type:   "cost",
+			Event:  "job.cost",
+			Status: status,
+			Cost:   cost,
+		})
+	}
+}
+
+// current returns a job's cost to date. Callers hold the scheduler lock.
+func (c *CostMeter) current(job *Job) JobCost {
+	c.mu.Lock()
+	meter, metered := c.meters[job.ID]
+	var cost JobCost
+	if metered {
+		cost = meter.cost
+	}
+	c.mu.Unlock()
+	if metered {
+		return cost
+	}
+
+	price, source := c.price(job)
+	return JobCost{
+		JobID:        job.ID,
+		PricePerHour: price,
+		PriceSource:  source,
+		CostToDate:   job.CostToDate,
+		Final:        isTerminalJobStatus(job.Status),
+	}
+}
+
+// HTTP Handlers
+
+// GetJobCost returns what a job has cost so far
+func (c *CostMeter) GetJobCost(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	jobID := mux.Vars(r)["id"]
+
+	s := c.scheduler
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	if !exists {
+		s.mu.RUnlock()
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if job.UserID != claims.UserID && claims.Role != "admin" {
+		s.mu.RUnlock()
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	cost := c.current(job)
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cost)
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Cost allocation tags are free-form key/value pairs (team=nlp,
+// project=alpha) that consumers attach to jobs. They travel with the job
+// through job events so metering and billing can break spend down by tag.
+
+const (
+	maxCostTags        = 20
+	maxCostTagValueLen = 256
+)
+
+var costTagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,62}$`)
+
+// validateCostTags checks tag count, key format and value length
+func validateCostTags(tags map[string]string) error {
+	if len(tags) > maxCostTags {
+		return fmt.Errorf("at most %d tags are allowed, got %d", maxCostTags, len(tags))
+	}
+	for key, value := range tags {
+		if !costTagKeyPattern.MatchString(key) {
+			return fmt.Errorf("invalid tag key %q: use lowercase letters, digits, '_', '.', '-' (max 63 chars)", key)
+		}
+		if len(value) > maxCostTagValueLen {
+			return fmt.Errorf("tag %q value exceeds %d characters", key, maxCostTagValueLen)
+		}
+	}
+	return nil
+}
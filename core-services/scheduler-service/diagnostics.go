@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+)
+
+// Diagnostics request states
+const (
+	DiagnosticsRequested = "requested"
+	DiagnosticsUploaded  = "uploaded"
+	DiagnosticsFailed    = "failed"
+)
+
+// Diagnostics bundle limits
+const (
+	defaultDiagnosticsLogLines   = 500
+	maxDiagnosticsLogLines       = 2000
+	defaultDiagnosticsJobResults = 20
+	maxDiagnosticsJobResults     = 50
+	diagnosticsTimeout           = time.Hour // Requests an agent never answers fail after this
+)
+
+// DiagnosticsRequest is a support bundle requested from an agent
+type DiagnosticsRequest struct {
+	ID          string     `json:"id"`
+	AgentID     string     `json:"agent_id"`
+	TicketID    string     `json:"ticket_id"`
+	RequestedBy string     `json:"requested_by"`
+	LogLines    int        `json:"log_lines"`
+	JobResults  int        `json:"job_results"`
+	Status      string     `json:"status"`
+	ObjectKey   string     `json:"object_key,omitempty"` // Encrypted bundle in the bundle store
+	SizeBytes   int64      `json:"size_bytes,omitempty"`
+	SHA256      string     `json:"sha256,omitempty"`     // Of the encrypted bundle
+	BundleURL   string     `json:"bundle_url,omitempty"` // Decrypted download, for the support ticket
+	Error       string     `json:"error,omitempty"`
+	RequestedAt time.Time  `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	key []byte
+}
+
+// agentDiagnosticsCommand is what the agent receives: the request and the
+// key to seal its bundle with
+type agentDiagnosticsCommand struct {
+	ID         string `json:"id"`
+	Key        string `json:"key"`
+	LogLines   int    `json:"log_lines"`
+	JobResults int    `json:"job_results"`
+}
+
+// BundleStore is the object storage diagnostics bundles are uploaded to
+type BundleStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// dirBundleStore keeps bundles on a local or mounted volume
+type dirBundleStore struct {
+	dir string
+}
+
+func (d *dirBundleStore) Put(ctx context.Context, key string, data []byte) error {
+	path := filepath.Join(d.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func (d *dirBundleStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(d.dir, filepath.FromSlash(key)))
+}
+
+// httpBundleStore PUTs and GETs bundles under a bucket URL, e.g. an
+// S3-compatible endpoint or an upload proxy in front of one
+type httpBundleStore struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func (h *httpBundleStore) do(ctx context.Context, method, key string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("bundle store returned %d", resp.StatusCode)
+	}
+	return data, nil
+}
+
+func (h *httpBundleStore) Put(ctx context.Context, key string, data []byte) error {
+	_, err := h.do(ctx, http.MethodPut, key, data)
+	return err
+}
+
+func (h *httpBundleStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return h.do(ctx, http.MethodGet, key, nil)
+}
+
+// AgentDiagnostics collects support bundles from agents without SSH access
+// to provider machines.
+//
+// An admin requests a bundle for a support ticket; the agent picks the
+// request up while polling, gathers recent logs, its configuration with
+// secrets redacted, a resource snapshot and its last job results, and
+// uploads them sealed with AES-GCM under a key generated for that request.
+// Bundles are stored encrypted in DIAGNOSTICS_STORE_URL (or the
+// DIAGNOSTICS_STORE_DIR volume) and decrypted only when an admin downloads
+// one. Keys live in the scheduler, so the store never holds readable data.
+type AgentDiagnostics struct {
+	scheduler *SchedulerService
+	store     BundleStore
+	maxBytes  int64
+	requests  map[string]*DiagnosticsRequest
+	mu        sync.RWMutex
+}
+
+// NewAgentDiagnostics creates the diagnostics registry from the environment
+func NewAgentDiagnostics(s *SchedulerService) *AgentDiagnostics {
+	var store BundleStore
+	if url := os.Getenv("DIAGNOSTICS_STORE_URL"); url != "" {
+		store = &httpBundleStore{
+			baseURL: strings.TrimSuffix(url, "/"),
+			token:   os.Getenv("DIAGNOSTICS_STORE_TOKEN"),
+			client:  &http.Client{Timeout: 60 * time.Second},
+		}
+	} else {
+		dir := os.Getenv("DIAGNOSTICS_STORE_DIR")
+		if dir == "" {
+			dir = filepath.Join(os.TempDir(), "computehive-diagnostics")
+		}
+		store = &dirBundleStore{dir: dir}
+	}
+
+	maxMB := 64
+	if n, err := strconv.Atoi(os.Getenv("DIAGNOSTICS_MAX_BUNDLE_MB")); err == nil && n > 0 {
+		maxMB = n
+	}
+
+	return &AgentDiagnostics{
+		scheduler: s,
+		store:     store,
+		maxBytes:  int64(maxMB) << 20,
+		requests:  make(map[string]*DiagnosticsRequest),
+	}
+}
+
+// expire fails requests the agent never answered. Callers hold d.mu.
+func (d *AgentDiagnostics) expire(now time.Time) {
+	for _, req := range d.requests {
+		if req.Status == DiagnosticsRequested && now.Sub(req.RequestedAt) > diagnosticsTimeout {
+			req.Status = DiagnosticsFailed
+			req.Error = "agent did not upload a bundle in time"
+			req.CompletedAt = &now
+			req.key = nil
+		}
+	}
+}
+
+func (d *AgentDiagnostics) publish(event string, req *DiagnosticsRequest) {
+	data, _ := json.Marshal(req)
+	d.scheduler.nats.Publish(event, data)
+}
+
+// openBundle decrypts a sealed bundle
+func openBundle(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("bundle too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+// HTTP Handlers
+
+// RequestDiagnostics asks an agent for a diagnostics bundle (admin only)
+func (d *AgentDiagnostics) RequestDiagnostics(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		TicketID   string `json:"ticket_id"`
+		LogLines   int    `json:"log_lines"`
+		JobResults *int   `json:"job_results"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.TicketID == "" {
+		http.Error(w, "ticket_id is required", http.StatusBadRequest)
+		return
+	}
+	if body.LogLines == 0 {
+		body.LogLines = defaultDiagnosticsLogLines
+	}
+	jobResults := defaultDiagnosticsJobResults
+	if body.JobResults != nil {
+		jobResults = *body.JobResults
+	}
+	if body.LogLines < 0 || body.LogLines > maxDiagnosticsLogLines {
+		http.Error(w, fmt.Sprintf("log_lines must be between 1 and %d", maxDiagnosticsLogLines), http.StatusBadRequest)
+		return
+	}
+	if jobResults < 0 || jobResults > maxDiagnosticsJobResults {
+		http.Error(w, fmt.Sprintf("job_results must be between 0 and %d", maxDiagnosticsJobResults), http.StatusBadRequest)
+		return
+	}
+
+	agentID := mux.Vars(r)["id"]
+	d.scheduler.mu.RLock()
+	_, known := d.scheduler.agents[agentID]
+	d.scheduler.mu.RUnlock()
+	if !known {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		http.Error(w, "Failed to generate bundle key", http.StatusInternalServerError)
+		return
+	}
+	req := &DiagnosticsRequest{
+		ID:          generateID(),
+		AgentID:     agentID,
+		TicketID:    body.TicketID,
+		RequestedBy: claims.UserID,
+		LogLines:    body.LogLines,
+		JobResults:  jobResults,
+		Status:      DiagnosticsRequested,
+		RequestedAt: time.Now(),
+		key:         key,
+	}
+
+	d.mu.Lock()
+	d.requests[req.ID] = req
+	view := *req
+	d.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Diagnostics requested", "agent_id", agentID, "ticket_id", req.TicketID, "request_id", req.ID)
+	d.publish("agent.diagnostics.requested", &view)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(view)
+}
+
+// ListDiagnostics lists diagnostics requests, newest first, filtered by
+// ?agent_id= and ?ticket_id= (admin only)
+func (d *AgentDiagnostics) ListDiagnostics(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	agentID := r.URL.Query().Get("agent_id")
+	ticketID := r.URL.Query().Get("ticket_id")
+
+	d.mu.Lock()
+	d.expire(time.Now())
+	requests := make([]DiagnosticsRequest, 0)
+	for _, req := range d.requests {
+		if (agentID == "" || req.AgentID == agentID) && (ticketID == "" || req.TicketID == ticketID) {
+			requests = append(requests, *req)
+		}
+	}
+	d.mu.Unlock()
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].RequestedAt.After(requests[j].RequestedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(requests)
+}
+
+// GetDiagnostics returns one diagnostics request (admin only)
+func (d *AgentDiagnostics) GetDiagnostics(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	d.mu.Lock()
+	d.expire(time.Now())
+	req, exists := d.requests[mux.Vars(r)["id"]]
+	var view DiagnosticsRequest
+	if exists {
+		view = *req
+	}
+	d.mu.Unlock()
+
+	if !exists {
+		http.Error(w, "Diagnostics request not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// DownloadDiagnostics fetches a bundle from the store and returns it
+// decrypted, as a gzipped tar (admin only)
+func (d *AgentDiagnostics) DownloadDiagnostics(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	d.mu.RLock()
+	req, exists := d.requests[mux.Vars(r)["id"]]
+	var view DiagnosticsRequest
+	if exists {
+		view = *req
+	}
+	d.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Diagnostics request not found", http.StatusNotFound)
+		return
+	}
+	if view.Status != DiagnosticsUploaded {
+		http.Error(w, fmt.Sprintf("Bundle not available: request is %s", view.Status), http.StatusConflict)
+		return
+	}
+
+	sealed, err := d.store.Get(r.Context(), view.ObjectKey)
+	if err != nil {
+		obs.WriteError(w, r, obs.Wrap(obs.CodeUnavailable, err))
+		return
+	}
+	bundle, err := openBundle(view.key, sealed)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to decrypt diagnostics bundle", "request_id", view.ID, obs.KeyError, err)
+		http.Error(w, "Failed to decrypt bundle", http.StatusInternalServerError)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Diagnostics bundle downloaded", "request_id", view.ID, "ticket_id", view.TicketID, "user_id", claims.UserID)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="diagnostics-%s-%s.tar.gz"`, view.AgentID, view.ID))
+	w.Write(bundle)
+}
+
+// ListAgentDiagnostics returns the requests an agent has yet to answer, with
+// their keys
+func (d *AgentDiagnostics) ListAgentDiagnostics(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	d.mu.Lock()
+	d.expire(time.Now())
+	commands := make([]agentDiagnosticsCommand, 0)
+	for _, req := range d.requests {
+		if req.AgentID == agentID && req.Status == DiagnosticsRequested {
+			commands = append(commands, agentDiagnosticsCommand{
+				ID:         req.ID,
+				Key:        base64.StdEncoding.EncodeToString(req.key),
+				LogLines:   req.LogLines,
+				JobResults: req.JobResults,
+			})
+		}
+	}
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commands)
+}
+
+// UploadDiagnostics stores an agent's sealed bundle
+func (d *AgentDiagnostics) UploadDiagnostics(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	d.mu.RLock()
+	req, exists := d.requests[vars["request"]]
+	valid := exists && req.AgentID == vars["id"] && req.Status == DiagnosticsRequested
+	d.mu.RUnlock()
+	if !valid {
+		http.Error(w, "Diagnostics request not found", http.StatusNotFound)
+		return
+	}
+
+	sealed, err := io.ReadAll(io.LimitReader(r.Body, d.maxBytes+1))
+	if err != nil {
+		http.Error(w, "Failed to read bundle", http.StatusBadRequest)
+		return
+	}
+	if int64(len(sealed)) > d.maxBytes {
+		http.Error(w, fmt.Sprintf("Bundle exceeds %d MB", d.maxBytes>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	objectKey := fmt.Sprintf("diagnostics/%s/%s.tar.gz.enc", req.AgentID, req.ID)
+	if err := d.store.Put(r.Context(), objectKey, sealed); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to store diagnostics bundle", "request_id", req.ID, obs.KeyError, err)
+		http.Error(w, "Failed to store bundle", http.StatusBadGateway)
+		return
+	}
+
+	sum := sha256.Sum256(sealed)
+	now := time.Now()
+	d.mu.Lock()
+	if req.Status != DiagnosticsRequested {
+		// Expired while uploading
+		d.mu.Unlock()
+		http.Error(w, "Diagnostics request expired", http.StatusGone)
+		return
+	}
+	req.Status = DiagnosticsUploaded
+	req.ObjectKey = objectKey
+	req.SizeBytes = int64(len(sealed))
+	req.SHA256 = hex.EncodeToString(sum[:])
+	req.BundleURL = fmt.Sprintf("/api/v1/diagnostics/%s/bundle", req.ID)
+	req.CompletedAt = &now
+	view := *req
+	d.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Diagnostics bundle uploaded", "agent_id", view.AgentID, "ticket_id", view.TicketID,
+		"request_id", view.ID, "size_bytes", view.SizeBytes)
+	// Support tooling attaches the bundle link to the ticket
+	d.publish("agent.diagnostics.uploaded", &view)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReportDiagnosticsFailure records that an agent could not collect a bundle
+func (d *AgentDiagnostics) ReportDiagnosticsFailure(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	req, exists := d.requests[vars["request"]]
+	if !exists || req.AgentID != vars["id"] || req.Status != DiagnosticsRequested {
+		d.mu.Unlock()
+		http.Error(w, "Diagnostics request not found", http.StatusNotFound)
+		return
+	}
+	req.Status = DiagnosticsFailed
+	req.Error = body.Error
+	req.CompletedAt = &now
+	req.key = nil
+	view := *req
+	d.mu.Unlock()
+
+	slog.WarnContext(r.Context(), "Agent failed to collect diagnostics", "agent_id", view.AgentID, "request_id", view.ID, "reason", view.Error)
+	d.publish("agent.diagnostics.failed", &view)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,691 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Enrollment states
+const (
+	EnrollmentPending  = "pending"
+	EnrollmentApproved = "approved"
+	EnrollmentRejected = "rejected"
+	EnrollmentRevoked  = "revoked"
+)
+
+// Join token lifetimes
+const (
+	defaultJoinTokenTTL = time.Hour
+	maxJoinTokenTTL     = 7 * 24 * time.Hour
+	joinTokenPrefix     = "chj_"
+)
+
+// JoinToken lets new agents request enrollment. Only a hash of the secret is
+// kept; the secret itself is returned once, when the token is minted.
+type JoinToken struct {
+	ID           string     `json:"id"`
+	Description  string     `json:"description,omitempty"`
+	AllowedCIDRs []string   `json:"allowed_cidrs,omitempty"`        // Source addresses agents may enroll from
+	Fingerprint  string     `json:"hardware_fingerprint,omitempty"` // Hardware agents must report
+	MaxUses      int        `json:"max_uses,omitempty"`             // 0 is unlimited
+	Uses         int        `json:"uses"`
+	CreatedBy    string     `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+
+	networks []*net.IPNet
+}
+
+// usable reports why the token cannot enroll another agent, if it cannot
+func (t *JoinToken) usable(now time.Time) error {
+	switch {
+	case t.RevokedAt != nil:
+		return fmt.Errorf("join token revoked")
+	case !now.Before(t.ExpiresAt):
+		return fmt.Errorf("join token expired")
+	case t.MaxUses > 0 && t.Uses >= t.MaxUses:
+		return fmt.Errorf("join token used up")
+	}
+	return nil
+}
+
+// allows reports whether an agent at ip with the given fingerprint may use
+// the token
+func (t *JoinToken) allows(ip net.IP, fingerprint string) error {
+	if t.Fingerprint != "" && t.Fingerprint != fingerprint {
+		return fmt.Errorf("hardware fingerprint does not match join token")
+	}
+	if len(t.networks) == 0 {
+		return nil
+	}
+	for _, network := range t.networks {
+		if ip != nil && network.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("address not allowed by join token")
+}
+
+// Enrollment is an agent's request to join the fleet
+type Enrollment struct {
+	AgentID         string          `json:"agent_id"`
+	TokenID         string          `json:"token_id"`
+	Status          string          `json:"status"`
+	RemoteAddr      string          `json:"remote_addr"`
+	Fingerprint     string          `json:"hardware_fingerprint,omitempty"`
+	Version         string          `json:"version,omitempty"`
+	Platform        json.RawMessage `json:"platform,omitempty"`
+	Capabilities    []string        `json:"capabilities,omitempty"`
+	ProtocolVersion int             `json:"protocol_version"` // Negotiated at registration and on every credentials request
+	RequestedAt     time.Time       `json:"requested_at"`
+	DecidedAt       *time.Time      `json:"decided_at,omitempty"`
+	DecidedBy       string          `json:"decided_by,omitempty"`
+	Reason          string          `json:"reason,omitempty"`
+
+	secretHash string
+}
+
+// EnrollmentResponse is what an enrolling agent receives
+type EnrollmentResponse struct {
+	Status           string     `json:"status"`
+	EnrollmentSecret string     `json:"enrollment_secret,omitempty"` // Only on the first response; proves the agent when it polls
+	Token            string     `json:"token,omitempty"`             // Agent credentials, once approved
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	Reason           string     `json:"reason,omitempty"`
+	ProtocolVersion  int        `json:"protocol_version"`      // The version the agent is to speak
+	Deprecation      string     `json:"deprecation,omitempty"` // Set when that version will stop being accepted
+}
+
+// Enrollments admits agents to the fleet.
+//
+// Admins mint short-lived join tokens, optionally locked to source CIDRs and
+// a hardware fingerprint. An agent presents a token to /api/v1/agents/register
+// and lands in the approval queue with a secret only it holds; it polls with
+// that secret until an admin approves or rejects it. Approved agents receive
+// signed credentials and, with AGENT_ENROLLMENT_REQUIRED (default true), only
+// their heartbeats add them to the schedulable fleet.
+type Enrollments struct {
+	scheduler      *SchedulerService
+	required       bool
+	credentialTTL  time.Duration
+	signingKey     []byte
+	trustedProxies []*net.IPNet
+
+	tokens      map[string]*JoinToken  // by ID
+	tokenHashes map[string]string      // secret hash -> token ID
+	enrollments map[string]*Enrollment // by agent ID
+	mu          sync.RWMutex
+
+	pending    prometheus.Gauge
+	outcomes   *prometheus.CounterVec
+	unenrolled prometheus.Counter
+}
+
+// NewEnrollments creates the enrollment registry from the environment
+func NewEnrollments(s *SchedulerService) *Enrollments {
+	e := &Enrollments{
+		scheduler:     s,
+		required:      os.Getenv("AGENT_ENROLLMENT_REQUIRED") != "false",
+		credentialTTL: 30 * 24 * time.Hour,
+		signingKey:    []byte(os.Getenv("AGENT_JWT_SECRET")),
+		tokens:        make(map[string]*JoinToken),
+		tokenHashes:   make(map[string]string),
+		enrollments:   make(map[string]*Enrollment),
+		pending: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "scheduler_agent_enrollments_pending",
+			Help: "Agent enrollments awaiting approval",
+		}),
+		outcomes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_agent_enrollments_total",
+			Help: "Agent enrollment requests and decisions",
+		}, []string{"outcome"}),
+		unenrolled: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "scheduler_unenrolled_heartbeats_total",
+			Help: "Heartbeats ignored because the agent is not enrolled",
+		}),
+	}
+	if d, err := time.ParseDuration(os.Getenv("AGENT_CREDENTIAL_TTL")); err == nil && d > 0 {
+		e.credentialTTL = d
+	}
+	for _, cidr := range strings.Split(os.Getenv("ENROLLMENT_TRUSTED_PROXIES"), ",") {
+		if _, network, err := net.ParseCIDR(strings.TrimSpace(cidr)); err == nil {
+			e.trustedProxies = append(e.trustedProxies, network)
+		}
+	}
+	if !e.required {
+		slog.Warn("Agent enrollment not required; any agent that heartbeats becomes schedulable")
+	}
+
+	prometheus.MustRegister(e.pending, e.outcomes, e.unenrolled)
+	return e
+}
+
+// admits reports whether heartbeats from the agent may add it to the fleet.
+// Agents' heartbeats reach the bus through ReceiveHeartbeat, which checks
+// their credentials; other publishers are trusted services.
+func (e *Enrollments) admits(agentID string) bool {
+	if !e.required {
+		return true
+	}
+	e.mu.RLock()
+	enrollment, ok := e.enrollments[agentID]
+	admitted := ok && enrollment.Status == EnrollmentApproved
+	e.mu.RUnlock()
+
+	if !admitted {
+		e.unenrolled.Inc()
+	}
+	return admitted
+}
+
+// updatePending refreshes the queue gauge; callers hold e.mu
+func (e *Enrollments) updatePending() {
+	pending := 0
+	for _, enrollment := range e.enrollments {
+		if enrollment.Status == EnrollmentPending {
+			pending++
+		}
+	}
+	e.pending.Set(float64(pending))
+}
+
+// clientIP returns the address a request came from, trusting
+// X-Forwarded-For only from configured proxies such as the API gateway
+func (e *Enrollments) clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+
+	forwarded := r.Header.Get("X-Forwarded-For")
+	if ip == nil || forwarded == "" {
+		return ip
+	}
+	for _, proxy := range e.trustedProxies {
+		if proxy.Contains(ip) {
+			// The proxy appends the address it saw; earlier entries are client-supplied
+			hops := strings.Split(forwarded, ",")
+			return net.ParseIP(strings.TrimSpace(hops[len(hops)-1]))
+		}
+	}
+	return ip
+}
+
+// agentCredentialAudience marks agent credentials. They are signed with
+// AGENT_JWT_SECRET rather than the user JWT_SECRET, so services accepting
+// user tokens cannot be called with them.
+const agentCredentialAudience = "computehive-agent"
+
+// issueCredentials signs an agent's credentials
+func (e *Enrollments) issueCredentials(agentID string) (string, time.Time, error) {
+	if len(e.signingKey) == 0 {
+		return "", time.Time{}, fmt.Errorf("AGENT_JWT_SECRET not configured")
+	}
+	now := time.Now()
+	expiresAt := now.Add(e.credentialTTL)
+	claims := &Claims{
+		UserID: agentID,
+		Role:   "agent",
+		Scopes: []string{"agent"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "computehive-scheduler",
+			Subject:   agentID,
+			Audience:  jwt.ClaimStrings{agentCredentialAudience},
+			ID:        generateID(),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(e.signingKey)
+	return token, expiresAt, err
+}
+
+// verifyCredentials checks agent credentials, returning their claims
+func (e *Enrollments) verifyCredentials(tokenString string) (*Claims, error) {
+	if len(e.signingKey) == 0 {
+		return nil, fmt.Errorf("AGENT_JWT_SECRET not configured")
+	}
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return e.signingKey, nil
+	}, jwt.WithAudience(agentCredentialAudience))
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid || claims.Role != "agent" || claims.Subject == "" {
+		return nil, fmt.Errorf("not agent credentials")
+	}
+	return claims, nil
+}
+
+// agentMiddleware authenticates the agent side of the API. Callers present
+// the credentials enrollment issued, which must belong to the agent in the
+// route's {id}; with enrollment required the agent must still be approved,
+// so revoking it takes effect before its credentials expire.
+func (e *Enrollments) agentMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if tokenString == "" {
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+		claims, err := e.verifyCredentials(tokenString)
+		if err != nil {
+			http.Error(w, "Invalid agent credentials", http.StatusUnauthorized)
+			return
+		}
+		if agentID, ok := mux.Vars(r)["id"]; ok && claims.Subject != agentID {
+			http.Error(w, "Credentials were issued to another agent", http.StatusForbidden)
+			return
+		}
+		if e.required {
+			e.mu.RLock()
+			enrollment, ok := e.enrollments[claims.Subject]
+			approved := ok && enrollment.Status == EnrollmentApproved
+			e.mu.RUnlock()
+			if !approved {
+				http.Error(w, "Agent not enrolled", http.StatusForbidden)
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = obs.WithCaller(ctx, claims.Subject, "")
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func (e *Enrollments) publish(event string, enrollment *Enrollment) {
+	data, _ := json.Marshal(enrollment)
+	e.scheduler.nats.Publish(event, data)
+}
+
+// randomSecret returns a random secret with a prefix and its hash
+func randomSecret(prefix string) (string, string) {
+	b := make([]byte, 24)
+	rand.Read(b)
+	secret := prefix + hex.EncodeToString(b)
+	return secret, hashSecret(secret)
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// HTTP Handlers
+
+// CreateJoinToken mints a join token (admin only)
+func (e *Enrollments) CreateJoinToken(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Description  string   `json:"description"`
+		TTLMinutes   int      `json:"ttl_minutes"`
+		AllowedCIDRs []string `json:"allowed_cidrs"`
+		Fingerprint  string   `json:"hardware_fingerprint"`
+		MaxUses      int      `json:"max_uses"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ttl := defaultJoinTokenTTL
+	if req.TTLMinutes > 0 {
+		ttl = time.Duration(req.TTLMinutes) * time.Minute
+	}
+	if req.TTLMinutes < 0 || ttl > maxJoinTokenTTL {
+		http.Error(w, fmt.Sprintf("ttl_minutes must be between 1 and %d", int(maxJoinTokenTTL.Minutes())), http.StatusBadRequest)
+		return
+	}
+	if req.MaxUses < 0 {
+		http.Error(w, "max_uses must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	token := &JoinToken{
+		ID:           generateID(),
+		Description:  req.Description,
+		AllowedCIDRs: req.AllowedCIDRs,
+		Fingerprint:  req.Fingerprint,
+		MaxUses:      req.MaxUses,
+		CreatedBy:    claims.UserID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(ttl),
+	}
+	for _, cidr := range req.AllowedCIDRs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid CIDR %q", cidr), http.StatusBadRequest)
+			return
+		}
+		token.networks = append(token.networks, network)
+	}
+
+	secret, hash := randomSecret(joinTokenPrefix)
+	e.mu.Lock()
+	e.tokens[token.ID] = token
+	e.tokenHashes[hash] = token.ID
+	e.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Join token created", "token_id", token.ID, "expires_at", token.ExpiresAt, "created_by", claims.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":  token,
+		"secret": secret,
+	})
+}
+
+// ListJoinTokens lists join tokens, newest first (admin only)
+func (e *Enrollments) ListJoinTokens(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	e.mu.RLock()
+	tokens := make([]JoinToken, 0, len(e.tokens))
+	for _, token := range e.tokens {
+		tokens = append(tokens, *token)
+	}
+	e.mu.RUnlock()
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// RevokeJoinToken stops a join token enrolling more agents (admin only).
+// Agents already enrolled with it are unaffected.
+func (e *Enrollments) RevokeJoinToken(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	e.mu.Lock()
+	token, exists := e.tokens[mux.Vars(r)["id"]]
+	if exists && token.RevokedAt == nil {
+		now := time.Now()
+		token.RevokedAt = &now
+	}
+	e.mu.Unlock()
+
+	if !exists {
+		http.Error(w, "Join token not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Register queues an agent presenting a join token for approval. It needs no
+// credentials: the join token authenticates the request.
+func (e *Enrollments) Register(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AgentID      string          `json:"agent_id"`
+		JoinToken    string          `json:"join_token"`
+		Fingerprint  string          `json:"hardware_fingerprint"`
+		Version      string          `json:"version"`
+		Platform     json.RawMessage `json:"platform"`
+		Capabilities []string        `json:"capabilities"`
+		Protocols    []int           `json:"protocol_versions"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.AgentID == "" || req.JoinToken == "" {
+		http.Error(w, "agent_id and join_token are required", http.StatusBadRequest)
+		return
+	}
+	protocolVersion, deprecation, err := e.scheduler.protocols.negotiate(req.Protocols)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Agent enrollment refused", "agent_id", req.AgentID, "version", req.Version, "reason", err.Error())
+		http.Error(w, err.Error(), http.StatusUpgradeRequired)
+		return
+	}
+
+	ip := e.clientIP(r)
+	now := time.Now()
+
+	e.mu.Lock()
+	token, found := e.tokens[e.tokenHashes[hashSecret(req.JoinToken)]]
+	err = fmt.Errorf("invalid join token")
+	if found {
+		if err = token.usable(now); err == nil {
+			err = token.allows(ip, req.Fingerprint)
+		}
+	}
+	if err != nil {
+		e.mu.Unlock()
+		e.outcomes.WithLabelValues("denied").Inc()
+		slog.WarnContext(r.Context(), "Agent enrollment denied", "agent_id", req.AgentID, "remote_addr", ip.String(), "reason", err.Error())
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if _, exists := e.enrollments[req.AgentID]; exists {
+		e.mu.Unlock()
+		http.Error(w, "Agent already enrolled; poll with its enrollment secret", http.StatusConflict)
+		return
+	}
+
+	secret, hash := randomSecret("")
+	enrollment := &Enrollment{
+		AgentID:         req.AgentID,
+		TokenID:         token.ID,
+		Status:          EnrollmentPending,
+		RemoteAddr:      ip.String(),
+		Fingerprint:     req.Fingerprint,
+		Version:         req.Version,
+		Platform:        req.Platform,
+		Capabilities:    req.Capabilities,
+		ProtocolVersion: protocolVersion,
+		RequestedAt:     now,
+		secretHash:      hash,
+	}
+	token.Uses++
+	e.enrollments[req.AgentID] = enrollment
+	e.updatePending()
+	view := *enrollment
+	e.mu.Unlock()
+
+	e.outcomes.WithLabelValues("requested").Inc()
+	slog.InfoContext(r.Context(), "Agent awaiting enrollment approval", "agent_id", req.AgentID, "token_id", token.ID, "remote_addr", view.RemoteAddr)
+	e.publish("agent.enrollment.requested", &view)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(EnrollmentResponse{
+		Status:           EnrollmentPending,
+		EnrollmentSecret: secret,
+		ProtocolVersion:  protocolVersion,
+		Deprecation:      deprecation,
+	})
+}
+
+// GetCredentials reports an enrolling agent's status, with fresh credentials
+// once it is approved. Agents authenticate with their enrollment secret.
+func (e *Enrollments) GetCredentials(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		EnrollmentSecret string `json:"enrollment_secret"`
+		Protocols        []int  `json:"protocol_versions"` // Agents may have been upgraded since they enrolled
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	e.mu.RLock()
+	enrollment, exists := e.enrollments[mux.Vars(r)["agent_id"]]
+	var view Enrollment
+	if exists {
+		view = *enrollment
+	}
+	e.mu.RUnlock()
+
+	if !exists || subtle.ConstantTimeCompare([]byte(view.secretHash), []byte(hashSecret(req.EnrollmentSecret))) != 1 {
+		http.Error(w, "Unknown enrollment", http.StatusForbidden)
+		return
+	}
+
+	protocolVersion, deprecation, err := e.scheduler.protocols.negotiate(req.Protocols)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUpgradeRequired)
+		return
+	}
+	e.mu.Lock()
+	enrollment.ProtocolVersion = protocolVersion
+	e.mu.Unlock()
+
+	resp := EnrollmentResponse{Status: view.Status, Reason: view.Reason, ProtocolVersion: protocolVersion, Deprecation: deprecation}
+	if view.Status == EnrollmentApproved {
+		token, expiresAt, err := e.issueCredentials(view.AgentID)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to issue agent credentials", "agent_id", view.AgentID, obs.KeyError, err)
+			http.Error(w, "Failed to issue credentials", http.StatusInternalServerError)
+			return
+		}
+		resp.Token = token
+		resp.ExpiresAt = &expiresAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// ListEnrollments returns enrollments, oldest first, filtered by ?status=
+// (admin only). ?status=pending is the approval queue.
+func (e *Enrollments) ListEnrollments(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	e.mu.RLock()
+	enrollments := make([]Enrollment, 0)
+	for _, enrollment := range e.enrollments {
+		if status == "" || enrollment.Status == status {
+			enrollments = append(enrollments, *enrollment)
+		}
+	}
+	e.mu.RUnlock()
+
+	sort.Slice(enrollments, func(i, j int) bool {
+		return enrollments[i].RequestedAt.Before(enrollments[j].RequestedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(enrollments)
+}
+
+// ApproveEnrollment admits a pending agent (admin only)
+func (e *Enrollments) ApproveEnrollment(w http.ResponseWriter, r *http.Request) {
+	e.decide(w, r, EnrollmentPending, EnrollmentApproved)
+}
+
+// RejectEnrollment turns a pending agent away (admin only)
+func (e *Enrollments) RejectEnrollment(w http.ResponseWriter, r *http.Request) {
+	e.decide(w, r, EnrollmentPending, EnrollmentRejected)
+}
+
+// RevokeEnrollment removes an approved agent from the fleet (admin only). It
+// can no longer fetch credentials and its heartbeats are ignored.
+func (e *Enrollments) RevokeEnrollment(w http.ResponseWriter, r *http.Request) {
+	e.decide(w, r, EnrollmentApproved, EnrollmentRevoked)
+}
+
+// decide moves an enrollment from one state to another, with an optional
+// reason in the body
+func (e *Enrollments) decide(w http.ResponseWriter, r *http.Request, from, to string) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	agentID := mux.Vars(r)["agent_id"]
+	e.mu.Lock()
+	enrollment, exists := e.enrollments[agentID]
+	if !exists {
+		e.mu.Unlock()
+		http.Error(w, "Enrollment not found", http.StatusNotFound)
+		return
+	}
+	if enrollment.Status != from {
+		status := enrollment.Status
+		e.mu.Unlock()
+		http.Error(w, fmt.Sprintf("Enrollment is %s, not %s", status, from), http.StatusConflict)
+		return
+	}
+	now := time.Now()
+	enrollment.Status = to
+	enrollment.DecidedAt = &now
+	enrollment.DecidedBy = claims.UserID
+	enrollment.Reason = req.Reason
+	e.updatePending()
+	view := *enrollment
+	e.mu.Unlock()
+
+	if to == EnrollmentRevoked {
+		s := e.scheduler
+		s.mu.Lock()
+		delete(s.agents, agentID)
+		s.mu.Unlock()
+	}
+
+	e.outcomes.WithLabelValues(to).Inc()
+	slog.InfoContext(r.Context(), "Agent enrollment "+to, "agent_id", agentID, "decided_by", claims.UserID, "reason", req.Reason)
+	e.publish("agent.enrollment."+to, &view)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
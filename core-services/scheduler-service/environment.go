@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ExecutionEnvironment is the environment snapshot an agent reports with
+// every job result
+type ExecutionEnvironment struct {
+	ImageRef            string    `json:"image_ref,omitempty"`
+	ImageDigest         string    `json:"image_digest,omitempty"`
+	ArtifactDigest      string    `json:"artifact_digest,omitempty"`
+	Runtime             string    `json:"runtime"`
+	RuntimeVersion      string    `json:"runtime_version,omitempty"`
+	DriverVersion       string    `json:"driver_version,omitempty"`
+	CUDAVersion         string    `json:"cuda_version,omitempty"`
+	EnvHash             string    `json:"env_hash"`
+	HardwareFingerprint string    `json:"hardware_fingerprint"`
+	CPUModel            string    `json:"cpu_model,omitempty"`
+	GPUModels           []string  `json:"gpu_models,omitempty"`
+	OS                  string    `json:"os"`
+	Arch                string    `json:"arch"`
+	AgentVersion        string    `json:"agent_version"`
+	CapturedAt          time.Time `json:"captured_at"`
+}
+
+// ReproductionReport describes how closely a re-run matches the job it
+// reproduces. Before the run the differences are predicted from the pinned
+// agent's last known environment; once the run reports its own environment
+// they are replaced by the observed ones.
+type ReproductionReport struct {
+	OriginalJobID string   `json:"original_job_id"`
+	PinnedAgentID string   `json:"pinned_agent_id,omitempty"`
+	PinnedImage   string   `json:"pinned_image,omitempty"`
+	Exact         bool     `json:"exact"`
+	Differences   []string `json:"differences,omitempty"`
+	Verified      bool     `json:"verified"` // Differences were observed rather than predicted
+}
+
+// parseJobEnvironment extracts the environment snapshot from an agent's job result
+func parseJobEnvironment(result map[string]interface{}) *ExecutionEnvironment {
+	raw, ok := result["environment"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var env ExecutionEnvironment
+	if err := json.Unmarshal(data, &env); err != nil || env.HardwareFingerprint == "" {
+		return nil
+	}
+	return &env
+}
+
+// recordJobEnvironment stores a job's environment, remembers it as its
+// agent's current environment and verifies re-runs against their original.
+// The caller must hold s.mu.
+func (s *SchedulerService) recordJobEnvironment(job *Job, env *ExecutionEnvironment) {
+	job.Environment = env
+	s.agentEnvironments[job.AssignedAgentID] = env
+
+	if job.Reproduction == nil {
+		return
+	}
+	original, exists := s.jobs[job.Reproduction.OriginalJobID]
+	if !exists || original.Environment == nil || original.UserID != job.UserID {
+		return
+	}
+	job.Reproduction.Differences = environmentDifferences(original.Environment, env, true)
+	job.Reproduction.Exact = len(job.Reproduction.Differences) == 0
+	job.Reproduction.Verified = true
+}
+
+// environmentDifferences lists where got differs from want. Host-level
+// comparisons leave out what belongs to the job itself (image, artifact and
+// environment variables) since those are predicted separately.
+func environmentDifferences(want, got *ExecutionEnvironment, includeJob bool) []string {
+	var diffs []string
+	compare := func(field, a, b string) {
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", field, orUnknown(a), orUnknown(b)))
+		}
+	}
+
+	if includeJob {
+		compare("image_digest", want.ImageDigest, got.ImageDigest)
+		compare("artifact_digest", want.ArtifactDigest, got.ArtifactDigest)
+		compare("env_hash", want.EnvHash, got.EnvHash)
+	}
+	compare("runtime", want.Runtime, got.Runtime)
+	compare("runtime_version", want.RuntimeVersion, got.RuntimeVersion)
+	compare("driver_version", want.DriverVersion, got.DriverVersion)
+	compare("cuda_version", want.CUDAVersion, got.CUDAVersion)
+	compare("hardware_fingerprint", want.HardwareFingerprint, got.HardwareFingerprint)
+	compare("os", want.OS, got.OS)
+	compare("arch", want.Arch, got.Arch)
+	return diffs
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// agentLive reports whether an agent is heartbeating and accepting jobs
+func agentLive(agent *Agent) bool {
+	return agent.Status == "active" && time.Since(agent.LastSeen) <= 2*time.Minute
+}
+
+// pinReproductionAgent picks the agent a re-run should be pinned to: the
+// original agent while it still runs the same environment, otherwise the
+// live agent whose last known environment differs the least. The caller
+// must hold s.mu.
+func (s *SchedulerService) pinReproductionAgent(original *Job) (string, []string) {
+	want := original.Environment
+
+	if agent, exists := s.agents[original.AssignedAgentID]; exists && agentLive(agent) {
+		if current, known := s.agentEnvironments[agent.ID]; known {
+			if diffs := environmentDifferences(want, current, false); len(diffs) == 0 {
+				return agent.ID, nil
+			}
+		}
+	}
+
+	var bestID string
+	var bestDiffs []string
+	for id, env := range s.agentEnvironments {
+		agent, exists := s.agents[id]
+		if !exists || !agentLive(agent) {
+			continue
+		}
+		diffs := environmentDifferences(want, env, false)
+		if bestID == "" || len(diffs) < len(bestDiffs) || (len(diffs) == len(bestDiffs) && id < bestID) {
+			bestID, bestDiffs = id, diffs
+		}
+	}
+	if bestID == "" {
+		return "", []string{"no live agent has reported an environment; placement is unpinned"}
+	}
+	return bestID, bestDiffs
+}
+
+// pinPayloadImage rewrites a docker payload to run the exact image the
+// original job ran. Registry digests work anywhere; a local image ID only
+// works on the agent that built it.
+func pinPayloadImage(payload json.RawMessage, env *ExecutionEnvironment, sameAgent bool) (json.RawMessage, string, []string) {
+	if env.Runtime != "docker" {
+		return payload, "", nil
+	}
+
+	pinned := ""
+	if at := strings.Index(env.ImageDigest, "@sha256:"); at > 0 {
+		pinned = env.ImageDigest
+	} else if strings.HasPrefix(env.ImageDigest, "sha256:") && sameAgent {
+		pinned = env.ImageDigest
+	}
+	if pinned == "" {
+		return payload, "", []string{fmt.Sprintf("image_digest: %s has no registry digest; the tag may resolve to a different image", orUnknown(env.ImageRef))}
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return payload, "", []string{"image_digest: payload could not be rewritten to pin the image"}
+	}
+	fields["image"] = pinned
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return payload, "", []string{"image_digest: payload could not be rewritten to pin the image"}
+	}
+	return data, pinned, nil
+}
+
+// RerunJob re-runs a past job pinned to an environment equivalent to the one
+// it originally ran in. Differences that cannot be avoided are flagged on the
+// new job; with "strict" the re-run is refused instead.
+func (s *SchedulerService) RerunJob(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+	claims := r.Context().Value("claims").(*Claims)
+
+	var req struct {
+		Strict bool `json:"strict"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.RLock()
+	original, exists := s.jobs[jobID]
+	if !exists {
+		s.mu.RUnlock()
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if original.UserID != claims.UserID && claims.Role != "admin" {
+		s.mu.RUnlock()
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	if original.GroupID != "" {
+		s.mu.RUnlock()
+		http.Error(w, "Replicas of a job group cannot be re-run on their own", http.StatusConflict)
+		return
+	}
+	if original.Environment == nil {
+		s.mu.RUnlock()
+		http.Error(w, "Job has no recorded execution environment", http.StatusConflict)
+		return
+	}
+
+	job := Job{
+		UserID:          original.UserID,
+		OrgID:           original.OrgID,
+		Type:            original.Type,
+		Priority:        original.Priority,
+		Requirements:    original.Requirements,
+		MaxRetries:      original.MaxRetries,
+		Timeout:         original.Timeout,
+		SLARequirements: original.SLARequirements,
+		Tags:            original.Tags,
+		ExposedPorts:    original.ExposedPorts,
+		RerunOf:         original.ID,
+	}
+	agentID, differences := s.pinReproductionAgent(original)
+	payload, pinnedImage, imageDiffs := pinPayloadImage(original.Payload, original.Environment, agentID == original.AssignedAgentID)
+	s.mu.RUnlock()
+
+	job.Payload = payload
+	job.TargetAgentID = agentID
+	differences = append(differences, imageDiffs...)
+	sort.Strings(differences)
+	job.Reproduction = &ReproductionReport{
+		OriginalJobID: original.ID,
+		PinnedAgentID: agentID,
+		PinnedImage:   pinnedImage,
+		Exact:         len(differences) == 0,
+		Differences:   differences,
+	}
+
+	if req.Strict && !job.Reproduction.Exact {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(job.Reproduction)
+		return
+	}
+
+	job.ID = generateID()
+	job.Status = "pending"
+	job.CreatedAt = time.Now()
+	job.Region = s.federation.Region()
+	job.HomeRegion = s.federation.Region()
+
+	if err := s.validateJobRequirements(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	job.EstimatedCost = s.estimateJobCost(&job)
+
+	s.mu.Lock()
+	s.jobs[job.ID] = &job
+	job.QueuedAt = time.Now()
+	s.jobQueue = append(s.jobQueue, &job)
+	s.queueLength.Set(float64(len(s.jobQueue)))
+	s.mu.Unlock()
+
+	go s.scheduleJob(&job)
+	s.publishJobEvent(r.Context(), "job.created", &job)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
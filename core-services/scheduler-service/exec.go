@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// execAttachTimeout bounds how long a consumer waits for the agent to attach
+const execAttachTimeout = 30 * time.Second
+
+// ExecPolicy controls interactive exec sessions for an organization
+type ExecPolicy struct {
+	Enabled bool `json:"enabled"`
+	Record  bool `json:"record"` // Store session transcripts as job artifacts
+}
+
+// ExecSession is an interactive session into a running job. The consumer
+// connects first; the assigned agent picks the session up while polling and
+// attaches its side, after which the relay copies frames in both directions.
+type ExecSession struct {
+	ID        string    `json:"id"`
+	JobID     string    `json:"job_id"`
+	AgentID   string    `json:"-"`
+	UserID    string    `json:"user_id"`
+	Command   []string  `json:"command,omitempty"`
+	TTY       bool      `json:"tty"`
+	Cols      uint16    `json:"cols,omitempty"`
+	Rows      uint16    `json:"rows,omitempty"`
+	Record    bool      `json:"record"`
+	CreatedAt time.Time `json:"created_at"`
+
+	agentConn chan *websocket.Conn
+}
+
+// ExecRelay brokers exec sessions between consumers and agents.
+//
+// Sessions are allowed by default; EXEC_DEFAULT_ENABLED=false disables them
+// and EXEC_DEFAULT_RECORD=true records them unless an org policy overrides.
+type ExecRelay struct {
+	scheduler     *SchedulerService
+	sessions      map[string]*ExecSession
+	policies      map[string]*ExecPolicy // org ID -> policy
+	defaultPolicy ExecPolicy
+	upgrader      websocket.Upgrader
+	mu            sync.RWMutex
+}
+
+// NewExecRelay creates an exec relay from the environment
+func NewExecRelay(s *SchedulerService) *ExecRelay {
+	return &ExecRelay{
+		scheduler: s,
+		sessions:  make(map[string]*ExecSession),
+		policies:  make(map[string]*ExecPolicy),
+		defaultPolicy: ExecPolicy{
+			Enabled: os.Getenv("EXEC_DEFAULT_ENABLED") != "false",
+			Record:  os.Getenv("EXEC_DEFAULT_RECORD") == "true",
+		},
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				// Sessions are authenticated by token, not origin
+				return true
+			},
+		},
+	}
+}
+
+// policyFor returns the effective exec policy for an organization
+func (e *ExecRelay) policyFor(orgID string) ExecPolicy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if policy, exists := e.policies[orgID]; exists && orgID != "" {
+		return *policy
+	}
+	return e.defaultPolicy
+}
+
+// HTTP Handlers
+
+// ExecJob opens an interactive session into a running job (consumer side).
+// Query: tty=true&cols=120&rows=40&command=/bin/bash
+func (e *ExecRelay) ExecJob(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	jobID := mux.Vars(r)["id"]
+
+	policy := e.policyFor(claims.OrgID)
+	if !policy.Enabled {
+		http.Error(w, "Exec sessions are disabled by organization policy", http.StatusForbidden)
+		return
+	}
+
+	e.scheduler.mu.RLock()
+	job, exists := e.scheduler.jobs[jobID]
+	var agentID, status, ownerID string
+	if exists {
+		agentID, status, ownerID = job.AssignedAgentID, job.Status, job.UserID
+	}
+	e.scheduler.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if ownerID != claims.UserID && claims.Role != "admin" {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	if agentID == "" || (status != "scheduled" && status != "running") {
+		http.Error(w, "Job is not running", http.StatusConflict)
+		return
+	}
+
+	query := r.URL.Query()
+	cols, _ := strconv.ParseUint(query.Get("cols"), 10, 16)
+	rows, _ := strconv.ParseUint(query.Get("rows"), 10, 16)
+	session := &ExecSession{
+		ID:        generateID(),
+		JobID:     jobID,
+		AgentID:   agentID,
+		UserID:    claims.UserID,
+		Command:   query["command"],
+		TTY:       query.Get("tty") == "true",
+		Cols:      uint16(cols),
+		Rows:      uint16(rows),
+		Record:    policy.Record,
+		CreatedAt: time.Now(),
+		agentConn: make(chan *websocket.Conn, 1),
+	}
+
+	conn, err := e.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Exec WebSocket upgrade failed", obs.KeyError, err)
+		return
+	}
+	defer conn.Close()
+
+	e.mu.Lock()
+	e.sessions[session.ID] = session
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		delete(e.sessions, session.ID)
+		e.mu.Unlock()
+	}()
+
+	// Wait for the agent to dial back
+	var agentConn *websocket.Conn
+	select {
+	case agentConn = <-session.agentConn:
+	case <-time.After(execAttachTimeout):
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"error","error":"agent did not attach"}`))
+		return
+	case <-r.Context().Done():
+		return
+	}
+	defer agentConn.Close()
+
+	e.publishSessionEvent("job.exec.started", session)
+	relayFrames(conn, agentConn)
+	e.publishSessionEvent("job.exec.ended", session)
+}
+
+// ListAgentExecSessions returns sessions waiting for an agent to attach
+func (e *ExecRelay) ListAgentExecSessions(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	e.mu.RLock()
+	sessions := make([]*ExecSession, 0)
+	for _, session := range e.sessions {
+		if session.AgentID == agentID && len(session.agentConn) == 0 {
+			sessions = append(sessions, session)
+		}
+	}
+	e.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// AttachAgentExecSession is the agent side of an exec session
+func (e *ExecRelay) AttachAgentExecSession(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	e.mu.RLock()
+	session, exists := e.sessions[vars["session"]]
+	e.mu.RUnlock()
+
+	if !exists || session.AgentID != vars["id"] {
+		http.Error(w, "Exec session not found", http.StatusNotFound)
+		return
+	}
+
+	conn, err := e.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Exec WebSocket upgrade failed", obs.KeyError, err)
+		return
+	}
+
+	select {
+	case session.agentConn <- conn:
+	default:
+		// Another agent connection already attached
+		conn.Close()
+	}
+}
+
+// GetExecPolicy returns an organization's exec policy
+func (e *ExecRelay) GetExecPolicy(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	orgID := mux.Vars(r)["org"]
+	if claims.OrgID != orgID && claims.Role != "admin" {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e.policyFor(orgID))
+}
+
+// SetExecPolicy updates an organization's exec policy (admin only)
+func (e *ExecRelay) SetExecPolicy(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	var policy ExecPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	orgID := mux.Vars(r)["org"]
+	e.mu.Lock()
+	e.policies[orgID] = &policy
+	e.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+func (e *ExecRelay) publishSessionEvent(event string, session *ExecSession) {
+	data, _ := json.Marshal(session)
+	e.scheduler.nats.Publish(event, data)
+}
+
+// relayFrames copies WebSocket frames between two connections until either closes
+func relayFrames(a, b *websocket.Conn) {
+	done := make(chan struct{}, 2)
+	copyFrames := func(dst, src *websocket.Conn) {
+		defer func() { done <- struct{}{} }()
+		for {
+			msgType, data, err := src.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := dst.WriteMessage(msgType, data); err != nil {
+				return
+			}
+		}
+	}
+
+	go copyFrames(a, b)
+	go copyFrames(b, a)
+	<-done
+}
@@ -0,0 +1,509 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+)
+
+// Federation lets several regional control planes cooperate. Each region
+// runs its own scheduler; peers periodically exchange capacity summaries so
+// that a job which cannot be placed locally can be forwarded to the region
+// that owns matching capacity. The region that accepted the job from the
+// consumer stays its home region and remains responsible for billing.
+
+// RegionCapacity summarizes the schedulable capacity of one region
+type RegionCapacity struct {
+	Region            string         `json:"region"`
+	ActiveAgents      int            `json:"active_agents"`
+	CPUAvailable      int            `json:"cpu_available"`
+	MemoryAvailableMB int            `json:"memory_available_mb"`
+	MaxAgentCPU       int            `json:"max_agent_cpu"`
+	MaxAgentMemoryMB  int            `json:"max_agent_memory_mb"`
+	FreeGPUs          map[string]int `json:"free_gpus"`
+	MaxAgentGPUs      int            `json:"max_agent_gpus"`
+	Locations         []string       `json:"locations"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// FederationPeer is a remote regional scheduler
+type FederationPeer struct {
+	Region    string          `json:"region"`
+	URL       string          `json:"url"`
+	Healthy   bool            `json:"healthy"`
+	LastError string          `json:"last_error,omitempty"`
+	Capacity  *RegionCapacity `json:"capacity,omitempty"`
+}
+
+// Federation tracks peer regions and forwards jobs between them
+type Federation struct {
+	region     string
+	token      string
+	peers      map[string]*FederationPeer
+	mu         sync.RWMutex
+	httpClient *http.Client
+	scheduler  *SchedulerService
+}
+
+// NewFederation configures federation from the environment.
+//
+// REGION names the local region and FEDERATION_PEERS lists the other
+// regions as comma-separated region=url pairs, e.g.
+// "eu-west=http://scheduler.eu-west:8002,us-east=http://scheduler.us-east:8002".
+// FEDERATION_TOKEN is a shared secret presented on inter-region calls.
+func NewFederation(s *SchedulerService) *Federation {
+	region := os.Getenv("REGION")
+	if region == "" {
+		region = "default"
+	}
+
+	f := &Federation{
+		region:     region,
+		token:      os.Getenv("FEDERATION_TOKEN"),
+		peers:      make(map[string]*FederationPeer),
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: obs.Transport(nil)},
+		scheduler:  s,
+	}
+
+	for _, entry := range strings.Split(os.Getenv("FEDERATION_PEERS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			slog.Warn("Ignoring malformed federation peer", "peer", entry)
+			continue
+		}
+		if parts[0] == region {
+			continue
+		}
+		f.peers[parts[0]] = &FederationPeer{
+			Region: parts[0],
+			URL:    strings.TrimRight(parts[1], "/"),
+		}
+	}
+
+	return f
+}
+
+// Enabled reports whether any peer regions are configured
+func (f *Federation) Enabled() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.peers) > 0
+}
+
+// Region returns the local region name
+func (f *Federation) Region() string {
+	return f.region
+}
+
+// Regions returns the local region and every configured peer region
+func (f *Federation) Regions() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	regions := []string{f.region}
+	for region := range f.peers {
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// localCapacity builds the capacity summary for this region
+func (f *Federation) localCapacity() *RegionCapacity {
+	s := f.scheduler
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	capacity := &RegionCapacity{
+		Region:    f.region,
+		FreeGPUs:  make(map[string]int),
+		UpdatedAt: time.Now(),
+	}
+
+	locations := make(map[string]bool)
+	for _, agent := range s.agents {
+		if agent.Status != "active" || time.Since(agent.LastSeen) > 2*time.Minute {
+			continue
+		}
+
+		capacity.ActiveAgents++
+		capacity.CPUAvailable += agent.Resources.CPU.Available
+		capacity.MemoryAvailableMB += agent.Resources.Memory.AvailableMB
+		if agent.Resources.CPU.Available > capacity.MaxAgentCPU {
+			capacity.MaxAgentCPU = agent.Resources.CPU.Available
+		}
+		if agent.Resources.Memory.AvailableMB > capacity.MaxAgentMemoryMB {
+			capacity.MaxAgentMemoryMB = agent.Resources.Memory.AvailableMB
+		}
+
+		freeGPUs := 0
+		for _, gpu := range agent.Resources.GPUs {
+			if !gpu.InUse {
+				capacity.FreeGPUs[gpu.Model]++
+				freeGPUs++
+			}
+		}
+		if freeGPUs > capacity.MaxAgentGPUs {
+			capacity.MaxAgentGPUs = freeGPUs
+		}
+
+		if agent.Location != "" {
+			locations[agent.Location] = true
+		}
+	}
+
+	for location := range locations {
+		capacity.Locations = append(capacity.Locations, location)
+	}
+	sort.Strings(capacity.Locations)
+
+	return capacity
+}
+
+// canHost reports whether a region's summary suggests it can run the job.
+// Summaries are aggregates, so this is a pre-filter: the remote scheduler
+// still performs exact placement.
+func (c *RegionCapacity) canHost(job *Job) bool {
+	if c == nil || c.ActiveAgents == 0 {
+		return false
+	}
+	if c.MaxAgentCPU < job.Requirements.CPUCores {
+		return false
+	}
+	if c.MaxAgentMemoryMB < job.Requirements.MemoryMB {
+		return false
+	}
+	if job.Requirements.GPUCount > 0 {
+		if c.MaxAgentGPUs < job.Requirements.GPUCount {
+			return false
+		}
+		if job.Requirements.GPUType != "" && c.FreeGPUs[job.Requirements.GPUType] < job.Requirements.GPUCount {
+			return false
+		}
+	}
+	if job.SLARequirements != nil && len(job.SLARequirements.PreferredRegions) > 0 {
+		found := false
+		for _, preferred := range job.SLARequirements.PreferredRegions {
+			for _, location := range c.Locations {
+				if preferred == location {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// run periodically refreshes peer capacity summaries
+func (f *Federation) run(ctx context.Context) {
+	f.refreshPeers(ctx)
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.refreshPeers(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (f *Federation) refreshPeers(ctx context.Context) {
+	f.mu.RLock()
+	peers := make([]*FederationPeer, 0, len(f.peers))
+	for _, peer := range f.peers {
+		peers = append(peers, peer)
+	}
+	f.mu.RUnlock()
+
+	for _, peer := range peers {
+		var capacity RegionCapacity
+		err := f.doRequest(ctx, "GET", peer.URL+"/api/v1/federation/capacity", nil, &capacity)
+
+		f.mu.Lock()
+		if err != nil {
+			peer.Healthy = false
+			peer.LastError = err.Error()
+			slog.Warn("Failed to refresh region capacity", "region", peer.Region, obs.KeyError, err)
+		} else {
+			peer.Healthy = true
+			peer.LastError = ""
+			peer.Capacity = &capacity
+		}
+		f.mu.Unlock()
+	}
+}
+
+// selectRegion picks the peer region best able to run a job, preferring the
+// one with the most free CPU. It returns nil if no peer qualifies.
+func (f *Federation) selectRegion(job *Job) *FederationPeer {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var best *FederationPeer
+	for _, peer := range f.peers {
+		if !peer.Healthy || !peer.Capacity.canHost(job) {
+			continue
+		}
+		if best == nil || peer.Capacity.CPUAvailable > best.Capacity.CPUAvailable {
+			best = peer
+		}
+	}
+	return best
+}
+
+// forwardJob hands a job that cannot be placed locally to a peer region.
+// It returns true if a peer accepted it.
+func (f *Federation) forwardJob(job *Job) bool {
+	// Never bounce a job that was itself forwarded here
+	if job.HomeRegion != "" && job.HomeRegion != f.region {
+		return false
+	}
+
+	// Pinned jobs target a local agent
+	if job.TargetAgentID != "" {
+		return false
+	}
+
+	peer := f.selectRegion(job)
+	if peer == nil {
+		return false
+	}
+
+	s := f.scheduler
+	s.mu.RLock()
+	forwarded := *job
+	s.mu.RUnlock()
+	forwarded.HomeRegion = f.region
+
+	var accepted Job
+	err := f.doRequest(context.Background(), "POST", peer.URL+"/api/v1/federation/jobs", &forwarded, &accepted)
+	if err != nil {
+		slog.Warn("Failed to forward job", obs.KeyJobID, job.ID, "region", peer.Region, obs.KeyError, err)
+		return false
+	}
+
+	s.mu.Lock()
+	job.Status = "forwarded"
+	job.HomeRegion = f.region
+	job.Region = peer.Region
+	now := time.Now()
+	job.ScheduledAt = &now
+	s.mu.Unlock()
+
+	slog.Info("Forwarded job", obs.KeyJobID, job.ID, "region", peer.Region)
+	s.publishJobEvent(context.Background(), "job.forwarded", job)
+	return true
+}
+
+// reportToHome sends the final state of a forwarded job back to its home
+// region, which owns billing for it
+func (f *Federation) reportToHome(job *Job) {
+	f.mu.RLock()
+	peer, exists := f.peers[job.HomeRegion]
+	f.mu.RUnlock()
+
+	if !exists {
+		slog.Error("Job has unknown home region", obs.KeyJobID, job.ID, "region", job.HomeRegion)
+		return
+	}
+
+	s := f.scheduler
+	s.mu.RLock()
+	snapshot := *job
+	s.mu.RUnlock()
+
+	endpoint := fmt.Sprintf("%s/api/v1/federation/jobs/%s/result", peer.URL, job.ID)
+	if err := f.doRequest(context.Background(), "POST", endpoint, &snapshot, nil); err != nil {
+		slog.Error("Failed to report job to home region", obs.KeyJobID, job.ID, "region", job.HomeRegion, obs.KeyError, err)
+	}
+}
+
+func (f *Federation) doRequest(ctx context.Context, method, url string, body, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Federation-Token", f.token)
+	req.Header.Set("X-Federation-Region", f.region)
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return obs.ResponseError(resp, "peer returned status %d", resp.StatusCode)
+	}
+
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// HTTP Handlers
+
+// federationMiddleware authenticates calls from peer regions
+func (f *Federation) federationMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if f.token == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Federation-Token")), []byte(f.token)) != 1 {
+			http.Error(w, "Invalid federation token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// GetCapacity returns this region's capacity summary to peers
+func (f *Federation) GetCapacity(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f.localCapacity())
+}
+
+// ListRegions returns the global view: the local region plus every peer
+func (f *Federation) ListRegions(w http.ResponseWriter, r *http.Request) {
+	regions := []*FederationPeer{{
+		Region:   f.region,
+		Healthy:  true,
+		Capacity: f.localCapacity(),
+	}}
+
+	f.mu.RLock()
+	for _, peer := range f.peers {
+		p := *peer
+		regions = append(regions, &p)
+	}
+	f.mu.RUnlock()
+
+	sort.Slice(regions[1:], func(i, j int) bool {
+		return regions[i+1].Region < regions[j+1].Region
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(regions)
+}
+
+// AcceptForwardedJob accepts a job forwarded from its home region
+func (f *Federation) AcceptForwardedJob(w http.ResponseWriter, r *http.Request) {
+	var job Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if job.ID == "" || job.HomeRegion == "" {
+		http.Error(w, "Forwarded jobs require id and home_region", http.StatusBadRequest)
+		return
+	}
+
+	s := f.scheduler
+	if err := s.validateJobRequirements(&job); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job.Status = "pending"
+	job.Region = f.region
+	job.AssignedAgentID = ""
+	job.RetryCount = 0
+
+	s.mu.Lock()
+	if _, exists := s.jobs[job.ID]; exists {
+		s.mu.Unlock()
+		http.Error(w, "Job already exists", http.StatusConflict)
+		return
+	}
+	s.jobs[job.ID] = &job
+	job.QueuedAt = time.Now()
+	s.jobQueue = append(s.jobQueue, &job)
+	s.queueLength.Set(float64(len(s.jobQueue)))
+	accepted := job
+	s.mu.Unlock()
+
+	// Scheduling mutates the job, so the response is encoded from a snapshot
+	go s.scheduleJob(&job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(accepted)
+}
+
+// ReceiveForwardedResult updates a home-region job with the outcome reported
+// by the region that executed it, and republishes the event locally so that
+// billing happens in the home region. Only the region a job was forwarded to
+// may report it, once.
+func (f *Federation) ReceiveForwardedResult(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	var remote Job
+	if err := json.NewDecoder(r.Body).Decode(&remote); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if remote.Status != "completed" && remote.Status != "failed" {
+		http.Error(w, "Forwarded results must be completed or failed", http.StatusBadRequest)
+		return
+	}
+
+	s := f.scheduler
+	s.mu.Lock()
+	job, exists := s.jobs[jobID]
+	if !exists {
+		s.mu.Unlock()
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if job.Status != "forwarded" {
+		s.mu.Unlock()
+		http.Error(w, "Job is not awaiting a forwarded result", http.StatusConflict)
+		return
+	}
+	if job.Region != r.Header.Get("X-Federation-Region") {
+		s.mu.Unlock()
+		http.Error(w, "Job was not forwarded to this region", http.StatusForbidden)
+		return
+	}
+	job.Status = remote.Status
+	job.StartedAt = remote.StartedAt
+	job.CompletedAt = remote.CompletedAt
+	job.ActualCost = remote.ActualCost
+	job.Usage = remote.Usage
+	s.mu.Unlock()
+
+	s.publishJobEvent(r.Context(), fmt.Sprintf("job.%s", remote.Status), job)
+	w.WriteHeader(http.StatusNoContent)
+}
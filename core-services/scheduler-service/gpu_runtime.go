@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/computehive/core-services/pkg/gpuruntime"
+	"github.com/computehive/core-services/pkg/obs"
+)
+
+// gpuRuntimeChanged reports whether an agent's heartbeat reports different
+// GPU runtime versions than the last one
+func gpuRuntimeChanged(previous, current *gpuruntime.Versions) bool {
+	if previous.IsZero() || current.IsZero() {
+		return previous.IsZero() != current.IsZero()
+	}
+	return *previous != *current
+}
+
+// publishGPURuntime tells the marketplace which runtime an agent has, so its
+// offers show the versions and bids requiring newer ones skip them
+func (s *SchedulerService) publishGPURuntime(agentID string, versions *gpuruntime.Versions) {
+	ctx := context.Background()
+	if versions == nil {
+		versions = &gpuruntime.Versions{}
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"agent_id":    agentID,
+		"gpu_runtime": versions,
+	})
+	if err := s.bus.Publish(ctx, "agent.gpu_runtime", data); err != nil {
+		obs.LogError(ctx, "Failed to publish agent GPU runtime", err, "agent_id", agentID)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/computehive/core-services/pkg/gpuruntime"
+)
+
+// maxHeartbeatBytes bounds a heartbeat posted over HTTP
+const maxHeartbeatBytes = 1 << 20
+
+// heartbeatResources is the resource section of an agent heartbeat. Memory
+// and storage are reported in bytes, CPU utilization in percent.
+type heartbeatResources struct {
+	CPU struct {
+		Cores int     `json:"cores"`
+		Usage float64 `json:"usage"`
+	} `json:"cpu"`
+	Memory struct {
+		Total     int64 `json:"total"`
+		Available int64 `json:"available"`
+	} `json:"memory"`
+	GPUs []struct {
+		ID       string `json:"id"`
+		Model    string `json:"model"`
+		MemoryMB int    `json:"memory_mb"`
+		InUse    bool   `json:"in_use"`
+	} `json:"gpus"`
+	Storage struct {
+		Total     int64 `json:"total"`
+		Available int64 `json:"available"`
+	} `json:"storage"`
+	Network struct {
+		BandwidthMbps int `json:"bandwidth_mbps"`
+	} `json:"network"`
+	GPURuntime *gpuruntime.Versions `json:"gpu_runtime"`
+}
+
+// parseHeartbeatResources converts the resources an agent reports into the
+// scheduler's view of them
+func parseHeartbeatResources(raw interface{}) (AgentResources, bool) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return AgentResources{}, false
+	}
+	var hb heartbeatResources
+	if err := json.Unmarshal(data, &hb); err != nil {
+		return AgentResources{}, false
+	}
+
+	const mb = 1024 * 1024
+	resources := AgentResources{
+		CPU: CPUInfo{
+			Cores:     hb.CPU.Cores,
+			Available: int(float64(hb.CPU.Cores) * (1 - hb.CPU.Usage/100)),
+			Usage:     hb.CPU.Usage,
+		},
+		Memory:  MemoryInfo{TotalMB: int(hb.Memory.Total / mb), AvailableMB: int(hb.Memory.Available / mb)},
+		Storage: StorageInfo{TotalMB: int(hb.Storage.Total / mb), AvailableMB: int(hb.Storage.Available / mb)},
+		Network: NetworkInfo{BandwidthMbps: hb.Network.BandwidthMbps},
+	}
+	if !hb.GPURuntime.IsZero() {
+		resources.GPURuntime = hb.GPURuntime
+	}
+	for _, gpu := range hb.GPUs {
+		resources.GPUs = append(resources.GPUs, GPUInfo{ID: gpu.ID, Model: gpu.Model, MemoryMB: gpu.MemoryMB, InUse: gpu.InUse})
+	}
+	return resources, true
+}
+
+// stringList converts a JSON array of strings
+func stringList(raw interface{}) []string {
+	values, ok := raw.([]interface{})
+	if !ok {
+		return nil
+	}
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			list = append(list, str)
+		}
+	}
+	return list
+}
+
+// HTTP Handlers
+
+// ReceiveHeartbeat takes a heartbeat an agent posts and publishes it on
+// agent.heartbeat for the scheduler and the services that follow the fleet.
+// The heartbeat must be from the agent the credentials were issued to.
+func (s *SchedulerService) ReceiveHeartbeat(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxHeartbeatBytes+1))
+	if err != nil || len(data) > maxHeartbeatBytes {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var heartbeat struct {
+		AgentID string `json:"agent_id"`
+	}
+	if err := json.Unmarshal(data, &heartbeat); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if heartbeat.AgentID != claims.Subject {
+		http.Error(w, "Credentials were issued to another agent", http.StatusForbidden)
+		return
+	}
+
+	if err := s.nats.Publish("agent.heartbeat", data); err != nil {
+		http.Error(w, "Failed to publish heartbeat", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
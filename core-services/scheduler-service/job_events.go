@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+)
+
+// maxJobEvents is the number of recent events retained per job for resume
+const maxJobEvents = 100
+
+// finishedJobEventRetention is how long a finished job's events stay
+// available for streams resuming after its end
+const finishedJobEventRetention = 15 * time.Minute
+
+// jobStreamKeepalive is how often an idle event stream sends a comment so
+// proxies do not time the connection out
+const jobStreamKeepalive = 15 * time.Second
+
+// JobEvent is a state transition, progress update, warning or cost update of
+// one job. IDs increase monotonically across all jobs so a client can resume
+// with Last-Event-ID.
+type JobEvent struct {
+	ID        uint64      `json:"id"`
+	JobID     string      `json:"job_id"`
+	Type      string      `json:"type"`  // state, progress, warning, cost
+	Event     string      `json:"event"` // e.g. job.scheduled
+	Status    string      `json:"status"`
+	Progress  *float64    `json:"progress,omitempty"` // Percent complete, 0-100
+	Message   string      `json:"message,omitempty"`
+	Warning   *JobWarning `json:"warning,omitempty"`
+	Cost      *JobCost    `json:"cost,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// JobEvents retains recent events per job and fans them out to live streams
+type JobEvents struct {
+	seq         uint64
+	events      map[string][]JobEvent
+	evicted     map[string]uint64    // job -> ID of the newest event dropped from retention
+	finished    map[string]time.Time // job -> when it reached a terminal state
+	subscribers map[string]map[chan JobEvent]struct{}
+	mu          sync.Mutex
+}
+
+// NewJobEvents creates an empty event store
+func NewJobEvents() *JobEvents {
+	return &JobEvents{
+		events:      make(map[string][]JobEvent),
+		evicted:     make(map[string]uint64),
+		finished:    make(map[string]time.Time),
+		subscribers: make(map[string]map[chan JobEvent]struct{}),
+	}
+}
+
+// Record assigns the event an ID, retains it and delivers it to subscribers.
+// Slow subscribers miss live events rather than blocking the scheduler; they
+// recover them by reconnecting with Last-Event-ID.
+func (e *JobEvents) Record(event JobEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.seq++
+	event.ID = e.seq
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	kept := append(e.events[event.JobID], event)
+	if len(kept) > maxJobEvents {
+		e.evicted[event.JobID] = kept[len(kept)-maxJobEvents-1].ID
+		kept = append([]JobEvent(nil), kept[len(kept)-maxJobEvents:]...)
+	}
+	e.events[event.JobID] = kept
+	if _, done := e.finished[event.JobID]; !done && event.Type == "state" && isTerminalJobStatus(event.Status) {
+		e.finished[event.JobID] = event.Timestamp
+	}
+
+	for ch := range e.subscribers[event.JobID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Since returns the retained events of a job newer than lastID. complete is
+// false when events after lastID have already been dropped from retention.
+func (e *JobEvents) Since(jobID string, lastID uint64) (events []JobEvent, complete bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, event := range e.events[jobID] {
+		if event.ID > lastID {
+			events = append(events, event)
+		}
+	}
+	return events, lastID >= e.evicted[jobID]
+}
+
+// Latest returns the ID of the most recently recorded event of any job
+func (e *JobEvents) Latest() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.seq
+}
+
+// Subscribe registers a channel receiving a job's live events
+func (e *JobEvents) Subscribe(jobID string) chan JobEvent {
+	ch := make(chan JobEvent, 64)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.subscribers[jobID] == nil {
+		e.subscribers[jobID] = make(map[chan JobEvent]struct{})
+	}
+	e.subscribers[jobID][ch] = struct{}{}
+	return ch
+}
+
+// Unsubscribe removes a channel registered with Subscribe
+func (e *JobEvents) Unsubscribe(jobID string, ch chan JobEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.subscribers[jobID], ch)
+	if len(e.subscribers[jobID]) == 0 {
+		delete(e.subscribers, jobID)
+	}
+}
+
+// run drops the events of jobs that finished more than
+// finishedJobEventRetention ago
+func (e *JobEvents) run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		e.mu.Lock()
+		for jobID, at := range e.finished {
+			if now.Sub(at) > finishedJobEventRetention {
+				delete(e.events, jobID)
+				delete(e.evicted, jobID)
+				delete(e.finished, jobID)
+			}
+		}
+		e.mu.Unlock()
+	}
+}
+
+// JobProgress is how far a running job has got, as its agent reports it
+type JobProgress struct {
+	Progress float64 `json:"progress"` // Percent complete, 0-100
+	Message  string  `json:"message,omitempty"`
+}
+
+// ReportJobProgress records the progress an agent reported for one of its
+// running jobs, streams it to the job's watchers and publishes it as
+// job.progress
+func (s *SchedulerService) ReportJobProgress(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var update JobProgress
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if update.Progress < 0 || update.Progress > 100 {
+		http.Error(w, "Progress must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	job, exists := s.jobs[vars["job"]]
+	valid := exists && job.AssignedAgentID == vars["id"] && !isTerminalJobStatus(job.Status)
+	var status, owner string
+	if valid {
+		status, owner = job.Status, job.UserID
+	}
+	s.mu.RUnlock()
+	if !valid {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	slog.DebugContext(obs.WithJobID(r.Context(), vars["job"]), "Agent reported job progress", "agent_id", vars["id"], "progress", update.Progress)
+
+	s.events.Record(JobEvent{
+		JobID:    vars["job"],
+		Type:     "progress",
+		Event:    "job.progress",
+		Status:   status,
+		Progress: &update.Progress,
+		Message:  update.Message,
+	})
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"job_id":   vars["job"],
+		"user_id":  owner,
+		"progress": update.Progress,
+		"message":  update.Message,
+	})
+	s.nats.Publish("job.progress", data)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isTerminalJobStatus reports whether a job will see no further transitions
+func isTerminalJobStatus(status string) bool {
+	switch status {
+	case "completed", "failed", "cancelled":
+		return true
+	}
+	return false
+}
+
+// StreamJobEvents pushes a job's state transitions, progress updates and
+// warnings as server-sent events. A new stream starts with a snapshot of the
+// job; a stream resumed with Last-Event-ID replays the events it missed, or
+// sends a fresh snapshot when they are no longer retained. The stream ends
+// with an "end" event once the job reaches a terminal state.
+func (s *SchedulerService) StreamJobEvents(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	var owner string
+	if exists {
+		owner = job.UserID
+	}
+	s.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	claims := r.Context().Value("claims").(*Claims)
+	if owner != claims.UserID && claims.Role != "admin" {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var lastID uint64
+	resumed := false
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastID = id
+		resumed = true
+	}
+
+	// Subscribe before replaying so no event falls between the two
+	live := s.events.Subscribe(jobID)
+	defer s.events.Unsubscribe(jobID, live)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: 3000\n\n")
+
+	missed, complete := s.events.Since(jobID, lastID)
+	if !resumed || !complete {
+		// The snapshot carries the current position so a reconnect resumes
+		// after it; events recorded while it is taken arrive live
+		id := s.events.Latest()
+		s.mu.RLock()
+		snapshot, _ := json.Marshal(job)
+		s.mu.RUnlock()
+
+		writeSSE(w, id, "snapshot", snapshot)
+		missed = nil
+		lastID = id
+	}
+
+	for _, event := range missed {
+		if !s.writeJobEvent(w, event) {
+			flusher.Flush()
+			return
+		}
+		lastID = event.ID
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(jobStreamKeepalive)
+	defer keepalive.Stop()
+
+	for {
+		s.mu.RLock()
+		status := job.Status
+		s.mu.RUnlock()
+		if isTerminalJobStatus(status) && len(live) == 0 {
+			writeSSE(w, lastID, "end", []byte(fmt.Sprintf(`{"job_id":%q,"status":%q}`, jobID, status)))
+			flusher.Flush()
+			return
+		}
+
+		select {
+		case event := <-live:
+			if event.ID <= lastID {
+				continue
+			}
+			if !s.writeJobEvent(w, event) {
+				flusher.Flush()
+				return
+			}
+			lastID = event.ID
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprintf(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeJobEvent writes one event and reports whether the stream should continue
+func (s *SchedulerService) writeJobEvent(w http.ResponseWriter, event JobEvent) bool {
+	data, _ := json.Marshal(event)
+	writeSSE(w, event.ID, event.Type, data)
+
+	if event.Type == "state" && isTerminalJobStatus(event.Status) {
+		writeSSE(w, event.ID, "end", []byte(fmt.Sprintf(`{"job_id":%q,"status":%q}`, event.JobID, event.Status)))
+		return false
+	}
+	return true
+}
+
+// writeSSE writes one server-sent event
+func writeSSE(w http.ResponseWriter, id uint64, event string, data []byte) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, event, data)
+}
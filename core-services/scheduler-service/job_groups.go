@@ -0,0 +1,699 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+)
+
+// Job group limits
+const (
+	maxGroupRoles   = 8
+	maxRoleReplicas = 64
+	maxGroupJobs    = 256
+)
+
+// groupCheckInterval is how often pending groups are placed and running
+// groups checked for finished replicas
+const groupCheckInterval = 5 * time.Second
+
+// Job group states
+const (
+	GroupPending   = "pending" // Waiting for capacity for every replica at once
+	GroupRunning   = "running" // Every replica was started
+	GroupCompleted = "completed"
+	GroupFailed    = "failed"
+	GroupCancelled = "cancelled"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// JobGroup is a job made of replicas in different roles with their own
+// requirements, such as a parameter server on a CPU node and GPU workers.
+// Replicas are placed all at once or not at all, started role by role in
+// the order the roles declare, and fail together: when one replica fails
+// or is cancelled the others are cancelled.
+type JobGroup struct {
+	ID          string       `json:"id"`
+	Name        string       `json:"name,omitempty"`
+	UserID      string       `json:"user_id"`
+	Status      string       `json:"status"` // pending, running, completed, failed, cancelled
+	Roles       []*GroupRole `json:"roles"`
+	MaxRetries  int          `json:"max_retries"` // Placement attempts before the group fails
+	Attempts    int          `json:"attempts"`
+	Error       string       `json:"error,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	StartedAt   *time.Time   `json:"started_at,omitempty"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+
+	nextAttempt time.Time
+	placing     bool
+}
+
+// GroupRole is a set of identical replicas within a job group
+type GroupRole struct {
+	Name       string   `json:"name"`
+	Count      int      `json:"count"`
+	StartAfter []string `json:"start_after,omitempty"` // Roles whose replicas must be started first
+	Job        Job      `json:"job"`                   // Template every replica is created from
+	JobIDs     []string `json:"job_ids,omitempty"`     // Replica jobs, by index
+}
+
+// GroupReplica is the state of one replica of a job group
+type GroupReplica struct {
+	JobID   string `json:"job_id"`
+	Role    string `json:"role"`
+	Index   int    `json:"index"`
+	Status  string `json:"status"`
+	AgentID string `json:"agent_id,omitempty"`
+}
+
+// JobGroups places, starts and tracks job groups
+type JobGroups struct {
+	s         *SchedulerService
+	groups    map[string]*JobGroup
+	tunnelURL string // Public URL of the tunnel service, for peer endpoints
+	mu        sync.Mutex
+}
+
+// NewJobGroups creates the job group coordinator
+func NewJobGroups(s *SchedulerService) *JobGroups {
+	tunnelURL := os.Getenv("TUNNEL_PUBLIC_URL")
+	if tunnelURL == "" {
+		tunnelURL = "http://localhost:8007"
+	}
+	return &JobGroups{
+		s:         s,
+		groups:    make(map[string]*JobGroup),
+		tunnelURL: strings.TrimSuffix(tunnelURL, "/"),
+	}
+}
+
+// startWaves orders roles into waves: every role starts after all roles of
+// the previous waves it names in start_after. It fails on unknown roles and
+// cycles.
+func startWaves(roles []*GroupRole) ([][]*GroupRole, error) {
+	byName := make(map[string]*GroupRole, len(roles))
+	for _, role := range roles {
+		byName[role.Name] = role
+	}
+	for _, role := range roles {
+		for _, dep := range role.StartAfter {
+			if byName[dep] == nil {
+				return nil, fmt.Errorf("role %s starts after unknown role %q", role.Name, dep)
+			}
+			if dep == role.Name {
+				return nil, fmt.Errorf("role %s cannot start after itself", role.Name)
+			}
+		}
+	}
+
+	var waves [][]*GroupRole
+	started := make(map[string]bool)
+	for len(started) < len(roles) {
+		var wave []*GroupRole
+		for _, role := range roles {
+			if started[role.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range role.StartAfter {
+				ready = ready && started[dep]
+			}
+			if ready {
+				wave = append(wave, role)
+			}
+		}
+		if len(wave) == 0 {
+			return nil, fmt.Errorf("roles have a start_after cycle")
+		}
+		for _, role := range wave {
+			started[role.Name] = true
+		}
+		waves = append(waves, wave)
+	}
+	return waves, nil
+}
+
+// SubmitJobGroup validates a job group and creates a job for every replica.
+// Each replica's environment tells it its role and index and how to reach
+// the replicas of every role.
+func (g *JobGroups) SubmitJobGroup(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name       string       `json:"name"`
+		MaxRetries int          `json:"max_retries"`
+		Roles      []*GroupRole `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	claims := r.Context().Value("claims").(*Claims)
+	for _, role := range req.Roles {
+		clearServerFields(&role.Job)
+		role.Job.OrgID = claims.OrgID
+	}
+
+	if err := g.validate(req.Roles); err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+	if req.MaxRetries <= 0 {
+		req.MaxRetries = 3
+	}
+
+	now := time.Now()
+	group := &JobGroup{
+		ID:         generateID(),
+		Name:       req.Name,
+		UserID:     claims.UserID,
+		Status:     GroupPending,
+		Roles:      req.Roles,
+		MaxRetries: req.MaxRetries,
+		CreatedAt:  now,
+	}
+	for _, role := range group.Roles {
+		role.JobIDs = make([]string, role.Count)
+		for i := range role.JobIDs {
+			role.JobIDs[i] = fmt.Sprintf("%s-%s-%d", group.ID, role.Name, i)
+		}
+	}
+
+	// Replica IDs are known up front, so every replica learns its peers
+	// before any of them is placed
+	var replicas []*Job
+	for _, role := range group.Roles {
+		for i, jobID := range role.JobIDs {
+			job := role.Job
+			job.ID = jobID
+			job.Status = "pending"
+			job.UserID = claims.UserID
+			job.CreatedAt = now
+			job.QueuedAt = now
+			job.Region = g.s.federation.Region()
+			job.HomeRegion = job.Region
+			job.GroupID = group.ID
+			job.Role = role.Name
+			job.RoleIndex = i
+			payload, err := withEnv(job.Payload, g.replicaEnv(group, role, i))
+			if err != nil {
+				obs.WriteError(w, r, obs.Errorf(obs.CodeInvalidArgument, "role %s: invalid payload", role.Name))
+				return
+			}
+			job.Payload = payload
+			job.EstimatedCost = g.s.estimateJobCost(&job)
+			replicas = append(replicas, &job)
+		}
+	}
+
+	g.s.mu.Lock()
+	for _, job := range replicas {
+		g.s.jobs[job.ID] = job
+	}
+	g.s.mu.Unlock()
+
+	g.mu.Lock()
+	g.groups[group.ID] = group
+	view := g.view(group)
+	g.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Job group submitted", "group_id", group.ID, "roles", len(group.Roles), "replicas", len(replicas))
+	for _, job := range replicas {
+		g.s.publishJobEvent(r.Context(), "job.created", job)
+	}
+	go g.place(group)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(view)
+}
+
+// validate checks a group's roles and applies job defaults to their templates
+func (g *JobGroups) validate(roles []*GroupRole) error {
+	if len(roles) == 0 {
+		return obs.Errorf(obs.CodeInvalidArgument, "a job group needs at least one role")
+	}
+	if len(roles) > maxGroupRoles {
+		return obs.Errorf(obs.CodeInvalidArgument, "at most %d roles are allowed", maxGroupRoles)
+	}
+
+	seen := make(map[string]bool)
+	total := 0
+	for _, role := range roles {
+		if !roleNamePattern.MatchString(role.Name) || len(role.Name) > 63 {
+			return obs.Errorf(obs.CodeInvalidArgument, "role name %q must be lowercase letters, digits and '-'", role.Name)
+		}
+		if seen[role.Name] {
+			return obs.Errorf(obs.CodeInvalidArgument, "duplicate role %q", role.Name)
+		}
+		seen[role.Name] = true
+		if role.Count < 1 || role.Count > maxRoleReplicas {
+			return obs.Errorf(obs.CodeInvalidArgument, "role %s: count must be between 1 and %d", role.Name, maxRoleReplicas)
+		}
+		total += role.Count
+		if role.Job.QuoteID != "" {
+			return obs.Errorf(obs.CodeInvalidArgument, "role %s: quotes cannot be shared by replicas", role.Name)
+		}
+		if err := g.s.validateJobRequirements(&role.Job); err != nil {
+			return obs.Errorf(obs.CodeOf(err), "role %s: %v", role.Name, err)
+		}
+	}
+	if total > maxGroupJobs {
+		return obs.Errorf(obs.CodeInvalidArgument, "a job group may have at most %d replicas, got %d", maxGroupJobs, total)
+	}
+	if _, err := startWaves(roles); err != nil {
+		return obs.Wrap(obs.CodeInvalidArgument, err)
+	}
+	return nil
+}
+
+// replicaEnv is the environment injected into one replica: its group, role
+// and index, and for every role the replica count, job IDs and the tunnel
+// endpoints of each exposed port, comma separated by replica index
+func (g *JobGroups) replicaEnv(group *JobGroup, role *GroupRole, index int) []string {
+	env := []string{
+		"COMPUTEHIVE_GROUP_ID=" + group.ID,
+		"COMPUTEHIVE_ROLE=" + role.Name,
+		fmt.Sprintf("COMPUTEHIVE_ROLE_INDEX=%d", index),
+	}
+	for _, peer := range group.Roles {
+		prefix := "COMPUTEHIVE_ROLE_" + envName(peer.Name)
+		env = append(env,
+			fmt.Sprintf("%s_COUNT=%d", prefix, peer.Count),
+			prefix+"_JOB_IDS="+strings.Join(peer.JobIDs, ","))
+		for _, port := range peer.Job.ExposedPorts {
+			endpoints := make([]string, len(peer.JobIDs))
+			for i, jobID := range peer.JobIDs {
+				endpoints[i] = g.tunnelEndpoint(jobID, port)
+			}
+			env = append(env, fmt.Sprintf("%s_%s_ENDPOINTS=%s", prefix, envName(port.Name), strings.Join(endpoints, ",")))
+		}
+	}
+	return env
+}
+
+// tunnelEndpoint is where the tunnel service serves a job's port
+func (g *JobGroups) tunnelEndpoint(jobID string, port ExposedPort) string {
+	if port.Protocol == "tcp" {
+		return fmt.Sprintf("%s/api/v1/tunnels/%s/ports/%s/connect", g.tunnelURL, jobID, port.Name)
+	}
+	return fmt.Sprintf("%s/t/%s/%s/", g.tunnelURL, jobID, port.Name)
+}
+
+// envName turns a role or port name into part of a variable name
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(name))
+}
+
+// withEnv appends variables to the env list of a job payload
+func withEnv(payload json.RawMessage, env []string) (json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if len(payload) > 0 && string(payload) != "null" {
+		if err := json.Unmarshal(payload, &fields); err != nil {
+			return nil, err
+		}
+	}
+	var existing []string
+	if raw, ok := fields["env"]; ok {
+		if err := json.Unmarshal(raw, &existing); err != nil {
+			return nil, err
+		}
+	}
+	fields["env"], _ = json.Marshal(append(existing, env...))
+	return json.Marshal(fields)
+}
+
+// run places pending groups when their retry is due and settles groups
+// whose replicas have finished
+func (g *JobGroups) run() {
+	ticker := time.NewTicker(groupCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		g.mu.Lock()
+		var due, active []*JobGroup
+		for _, group := range g.groups {
+			switch {
+			case group.placing:
+			case group.Status == GroupPending && time.Now().After(group.nextAttempt):
+				due = append(due, group)
+			case group.Status == GroupRunning:
+				active = append(active, group)
+			}
+		}
+		g.mu.Unlock()
+
+		for _, group := range active {
+			g.settle(group)
+		}
+		for _, group := range due {
+			if g.settle(group) {
+				go g.place(group)
+			}
+		}
+	}
+}
+
+// place reserves an agent for every replica, then starts the roles wave by
+// wave. If any replica cannot be placed or its agent declines, the replicas
+// already started are withdrawn and the group waits for its next attempt.
+func (g *JobGroups) place(group *JobGroup) {
+	g.mu.Lock()
+	if group.Status != GroupPending || group.placing {
+		g.mu.Unlock()
+		return
+	}
+	group.placing = true
+	group.Attempts++
+	g.mu.Unlock()
+
+	waves, _ := startWaves(group.Roles)
+	plan, err := g.plan(waves)
+	if err == nil {
+		err = g.start(group, waves, plan)
+	}
+
+	g.mu.Lock()
+	group.placing = false
+	if err == nil {
+		now := time.Now()
+		group.Status = GroupRunning
+		group.StartedAt = &now
+		group.Error = ""
+		g.mu.Unlock()
+		slog.Info("Job group started", "group_id", group.ID, "attempt", group.Attempts)
+		return
+	}
+
+	group.Error = err.Error()
+	exhausted := group.Attempts > group.MaxRetries
+	if !exhausted {
+		group.nextAttempt = time.Now().Add(time.Duration(math.Pow(2, float64(group.Attempts))) * time.Second)
+	}
+	g.mu.Unlock()
+
+	slog.Info("Job group not placed", "group_id", group.ID, "attempt", group.Attempts, obs.KeyError, err)
+	if exhausted {
+		g.finish(group, GroupFailed, fmt.Sprintf("not placed after %d attempts: %v", group.Attempts, err))
+	}
+}
+
+// plan picks an agent for every replica, counting the replicas already
+// planned onto an agent against its free resources
+func (g *JobGroups) plan(waves [][]*GroupRole) (map[string]*Agent, error) {
+	plan := make(map[string]*Agent)
+	planned := make(map[string]ResourceRequirements)
+	for _, wave := range waves {
+		for _, role := range wave {
+			candidates := g.s.scoreAgents(g.s.findSuitableAgents(&role.Job), &role.Job)
+
+			g.s.mu.RLock()
+			for i, jobID := range role.JobIDs {
+				for _, candidate := range candidates {
+					agent := candidate.agent
+					if fitsAlongside(agent, planned[agent.ID], role.Job.Requirements) {
+						plan[jobID] = agent
+						planned[agent.ID] = addRequirements(planned[agent.ID], role.Job.Requirements)
+						break
+					}
+				}
+				if plan[jobID] == nil {
+					g.s.mu.RUnlock()
+					return nil, fmt.Errorf("no capacity for replica %d of role %s", i, role.Name)
+				}
+			}
+			g.s.mu.RUnlock()
+		}
+	}
+	return plan, nil
+}
+
+// fitsAlongside reports whether an agent has room for a replica on top of
+// the replicas already planned onto it. Callers hold the scheduler lock.
+func fitsAlongside(agent *Agent, planned, req ResourceRequirements) bool {
+	free := agent.Resources
+	if free.CPU.Available < planned.CPUCores+req.CPUCores ||
+		free.Memory.AvailableMB < planned.MemoryMB+req.MemoryMB ||
+		free.Storage.AvailableMB < planned.StorageMB+req.StorageMB {
+		return false
+	}
+	if req.GPUCount == 0 {
+		return true
+	}
+	freeGPUs := 0
+	for _, gpu := range free.GPUs {
+		if !gpu.InUse && (req.GPUType == "" || gpu.Model == req.GPUType) {
+			freeGPUs++
+		}
+	}
+	// Planned GPUs may be of any model, so they count against every type
+	return freeGPUs-planned.GPUCount >= req.GPUCount
+}
+
+func addRequirements(a, b ResourceRequirements) ResourceRequirements {
+	a.CPUCores += b.CPUCores
+	a.MemoryMB += b.MemoryMB
+	a.StorageMB += b.StorageMB
+	a.GPUCount += b.GPUCount
+	return a
+}
+
+// start assigns the replicas wave by wave, so a role's replicas are only
+// dispatched once every replica of the roles it starts after was accepted
+func (g *JobGroups) start(group *JobGroup, waves [][]*GroupRole, plan map[string]*Agent) error {
+	var started []*Job
+	for _, wave := range waves {
+		for _, role := range wave {
+			for i, jobID := range role.JobIDs {
+				g.s.mu.RLock()
+				job := g.s.jobs[jobID]
+				pending := job != nil && job.Status == "pending"
+				g.s.mu.RUnlock()
+				if !pending {
+					g.withdraw(started)
+					return fmt.Errorf("replica %d of role %s is no longer pending", i, role.Name)
+				}
+
+				if !g.s.assignJobToAgent(job, plan[jobID]) {
+					g.withdraw(started)
+					return fmt.Errorf("agent %s declined replica %d of role %s", plan[jobID].ID, i, role.Name)
+				}
+				started = append(started, job)
+			}
+		}
+	}
+	return nil
+}
+
+// withdraw takes back replicas started by a failed placement attempt and
+// returns them to pending
+func (g *JobGroups) withdraw(jobs []*Job) {
+	for _, job := range jobs {
+		g.s.mu.Lock()
+		agentID := job.AssignedAgentID
+		job.Status = "pending"
+		job.QueuedAt = time.Now()
+		job.AssignedAgentID = ""
+		job.ScheduledAt = nil
+		if agent, exists := g.s.agents[agentID]; exists {
+			remaining := make([]string, 0, len(agent.ActiveJobs))
+			for _, activeJobID := range agent.ActiveJobs {
+				if activeJobID != job.ID {
+					remaining = append(remaining, activeJobID)
+				}
+			}
+			agent.ActiveJobs = remaining
+		}
+		g.s.mu.Unlock()
+
+		if agentID != "" {
+			g.s.notifyAgentJobCancelled(agentID, job.ID)
+		}
+	}
+}
+
+// settle finishes a group whose replicas are all done, or one of which
+// failed or was cancelled. It reports whether the group is still pending
+// or running.
+func (g *JobGroups) settle(group *JobGroup) bool {
+	completed, total := 0, 0
+	var failed *Job
+	g.s.mu.RLock()
+	for _, role := range group.Roles {
+		for _, jobID := range role.JobIDs {
+			total++
+			job := g.s.jobs[jobID]
+			switch {
+			case job == nil:
+			case job.Status == "completed":
+				completed++
+			case (job.Status == "failed" || job.Status == "cancelled") && failed == nil:
+				failed = job
+			}
+		}
+	}
+	var reason string
+	if failed != nil {
+		reason = fmt.Sprintf("replica %d of role %s %s", failed.RoleIndex, failed.Role, failed.Status)
+	}
+	g.s.mu.RUnlock()
+
+	switch {
+	case failed != nil:
+		g.finish(group, GroupFailed, reason)
+		return false
+	case completed == total:
+		g.finish(group, GroupCompleted, "")
+		return false
+	}
+	return true
+}
+
+// finish moves a group to a terminal state and cancels its unfinished replicas
+func (g *JobGroups) finish(group *JobGroup, status, reason string) {
+	g.mu.Lock()
+	if group.CompletedAt != nil {
+		g.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	group.Status = status
+	group.CompletedAt = &now
+	if reason != "" {
+		group.Error = reason
+	}
+	g.mu.Unlock()
+
+	slog.Info("Job group finished", "group_id", group.ID, "status", status, "reason", reason)
+	for _, role := range group.Roles {
+		for _, jobID := range role.JobIDs {
+			g.s.mu.Lock()
+			job := g.s.jobs[jobID]
+			if job == nil || isTerminalJobStatus(job.Status) {
+				g.s.mu.Unlock()
+				continue
+			}
+			job.Status = "cancelled"
+			job.CompletedAt = &now
+			agentID := job.AssignedAgentID
+			g.s.mu.Unlock()
+
+			if agentID != "" {
+				g.s.notifyAgentJobCancelled(agentID, jobID)
+			}
+			g.s.publishJobEvent(context.Background(), "job.cancelled", job)
+		}
+	}
+}
+
+// view is a group as returned by the API, with the state of every replica.
+// Callers hold the group lock.
+func (g *JobGroups) view(group *JobGroup) interface{} {
+	replicas := make([]GroupReplica, 0)
+	g.s.mu.RLock()
+	for _, role := range group.Roles {
+		for i, jobID := range role.JobIDs {
+			replica := GroupReplica{JobID: jobID, Role: role.Name, Index: i}
+			if job := g.s.jobs[jobID]; job != nil {
+				replica.Status = job.Status
+				replica.AgentID = job.AssignedAgentID
+			}
+			replicas = append(replicas, replica)
+		}
+	}
+	g.s.mu.RUnlock()
+
+	copied := *group
+	return struct {
+		*JobGroup
+		Replicas []GroupReplica `json:"replicas"`
+	}{&copied, replicas}
+}
+
+// lookup returns a group the caller may see
+func (g *JobGroups) lookup(w http.ResponseWriter, r *http.Request) *JobGroup {
+	g.mu.Lock()
+	group, exists := g.groups[mux.Vars(r)["id"]]
+	g.mu.Unlock()
+	if !exists {
+		http.Error(w, "Job group not found", http.StatusNotFound)
+		return nil
+	}
+	claims := r.Context().Value("claims").(*Claims)
+	if group.UserID != claims.UserID && claims.Role != "admin" {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return nil
+	}
+	return group
+}
+
+// ListJobGroups lists the caller's job groups, newest first
+func (g *JobGroups) ListJobGroups(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	g.mu.Lock()
+	var groups []*JobGroup
+	for _, group := range g.groups {
+		if group.UserID == claims.UserID || claims.Role == "admin" {
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].CreatedAt.After(groups[j].CreatedAt) })
+	views := make([]interface{}, len(groups))
+	for i, group := range groups {
+		views[i] = g.view(group)
+	}
+	g.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// GetJobGroup returns a job group with the state of its replicas
+func (g *JobGroups) GetJobGroup(w http.ResponseWriter, r *http.Request) {
+	group := g.lookup(w, r)
+	if group == nil {
+		return
+	}
+	g.mu.Lock()
+	view := g.view(group)
+	g.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// CancelJobGroup cancels every unfinished replica of a group
+func (g *JobGroups) CancelJobGroup(w http.ResponseWriter, r *http.Request) {
+	group := g.lookup(w, r)
+	if group == nil {
+		return
+	}
+	g.mu.Lock()
+	finished := group.CompletedAt != nil
+	g.mu.Unlock()
+	if finished {
+		http.Error(w, "Job group already finished", http.StatusConflict)
+		return
+	}
+
+	g.finish(group, GroupCancelled, "cancelled by "+r.Context().Value("claims").(*Claims).UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
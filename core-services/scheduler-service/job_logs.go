@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Job log limits
+const (
+	maxJobLogLines      = 1000 // Recent lines retained per job
+	maxJobLogLineLength = 4096 // Longer lines agents ship are cut
+)
+
+// JobLogLine is one retained line of job output
+type JobLogLine struct {
+	Timestamp time.Time `json:"timestamp"`
+	Stream    string    `json:"stream,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// JobLogs retains the most recent output lines of each job
+type JobLogs struct {
+	lines    map[string][]JobLogLine
+	streamed map[string]bool // Jobs whose agent shipped output while they ran
+	mu       sync.RWMutex
+}
+
+// NewJobLogs creates an empty log store
+func NewJobLogs() *JobLogs {
+	return &JobLogs{lines: make(map[string][]JobLogLine), streamed: make(map[string]bool)}
+}
+
+// Append adds lines to a job's log, dropping the oldest beyond the retention limit
+func (l *JobLogs) Append(jobID string, lines ...JobLogLine) {
+	if len(lines) == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	kept := append(l.lines[jobID], lines...)
+	if len(kept) > maxJobLogLines {
+		kept = append([]JobLogLine(nil), kept[len(kept)-maxJobLogLines:]...)
+	}
+	l.lines[jobID] = kept
+}
+
+// AppendOutput splits captured output into lines and appends them. The
+// output of jobs whose agent shipped it while they ran is already retained.
+func (l *JobLogs) AppendOutput(jobID, stream, output string) {
+	output = strings.TrimRight(output, "\n")
+	if output == "" {
+		return
+	}
+	l.mu.RLock()
+	streamed := l.streamed[jobID]
+	l.mu.RUnlock()
+	if streamed && stream == "output" {
+		return
+	}
+
+	now := time.Now()
+	parts := strings.Split(output, "\n")
+	lines := make([]JobLogLine, 0, len(parts))
+	for _, part := range parts {
+		lines = append(lines, JobLogLine{Timestamp: now, Stream: stream, Message: part})
+	}
+	l.Append(jobID, lines...)
+}
+
+// Tail returns up to n of a job's most recent lines
+func (l *JobLogs) Tail(jobID string, n int) []JobLogLine {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	lines := l.lines[jobID]
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return append([]JobLogLine{}, lines...)
+}
+
+// appendStreamed retains lines an agent shipped while the job ran
+func (l *JobLogs) appendStreamed(jobID string, lines []JobLogLine) {
+	l.mu.Lock()
+	l.streamed[jobID] = true
+	l.mu.Unlock()
+	l.Append(jobID, lines...)
+}
+
+// ReportJobLogs retains output lines an agent shipped for one of its
+// running jobs
+func (s *SchedulerService) ReportJobLogs(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var lines []JobLogLine
+	if err := json.NewDecoder(r.Body).Decode(&lines); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(lines) > maxJobLogLines {
+		http.Error(w, "Too many lines", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	s.mu.RLock()
+	job, exists := s.jobs[vars["job"]]
+	valid := exists && job.AssignedAgentID == vars["id"] && !isTerminalJobStatus(job.Status)
+	s.mu.RUnlock()
+	if !valid {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	for i := range lines {
+		if lines[i].Timestamp.IsZero() || lines[i].Timestamp.After(now) {
+			lines[i].Timestamp = now
+		}
+		if len(lines[i].Message) > maxJobLogLineLength {
+			lines[i].Message = lines[i].Message[:maxJobLogLineLength]
+		}
+	}
+	s.logs.appendStreamed(vars["job"], lines)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetJobLogs returns a job's most recent log lines
+func (s *SchedulerService) GetJobLogs(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	var owner string
+	if exists {
+		owner = job.UserID
+	}
+	s.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	claims := r.Context().Value("claims").(*Claims)
+	if owner != claims.UserID && claims.Role != "admin" {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	tail := 100
+	if v := r.URL.Query().Get("tail"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxJobLogLines {
+			http.Error(w, "Invalid tail", http.StatusBadRequest)
+			return
+		}
+		tail = n
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.logs.Tail(jobID, tail))
+}
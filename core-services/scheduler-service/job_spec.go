@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/computehive/core-services/pkg/jobspec"
+	"github.com/computehive/core-services/pkg/obs"
+)
+
+// maxJobRequestBytes bounds a job submission body
+const maxJobRequestBytes = 1 << 20
+
+// sidecarCapability is advertised by agents that run jobs with sidecars
+const sidecarCapability = "sidecars"
+
+// decodeJobRequest reads a submitted job. The body is either a job in the
+// API's JSON form or a declarative job document (YAML, or JSON with an
+// apiVersion), which is validated and converted.
+func decodeJobRequest(r *http.Request) (*Job, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxJobRequestBytes+1))
+	if err != nil {
+		return nil, obs.Errorf(obs.CodeInvalidArgument, "Invalid request body")
+	}
+	if len(body) > maxJobRequestBytes {
+		return nil, obs.Errorf(obs.CodeInvalidArgument, "Request body exceeds %d bytes", maxJobRequestBytes)
+	}
+	return decodeJob(body, isYAMLRequest(r))
+}
+
+// decodeJob reads one submitted job, a declarative document when yaml is
+// set or the body has an apiVersion, and the API's JSON form otherwise
+func decodeJob(body []byte, yaml bool) (*Job, error) {
+	if yaml || jobspec.IsDocument(body) {
+		doc, err := jobspec.Parse(body)
+		if err != nil {
+			return nil, obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		return jobFromDocument(doc), nil
+	}
+
+	var job Job
+	if err := json.Unmarshal(body, &job); err != nil {
+		return nil, obs.Errorf(obs.CodeInvalidArgument, "Invalid request body")
+	}
+	clearServerFields(&job)
+	return &job, nil
+}
+
+// clearServerFields drops what only the scheduler sets on a job, so a
+// submitted job cannot claim a placement, a run history or another job's
+// reproduction record
+func clearServerFields(job *Job) {
+	job.ID = ""
+	job.UserID = ""
+	job.Status = ""
+	job.AssignedAgentID = ""
+	job.ScheduledAt = nil
+	job.StartedAt = nil
+	job.CompletedAt = nil
+	job.EstimatedCost = 0
+	job.ActualCost = 0
+	job.CostToDate = 0
+	job.RetryCount = 0
+	job.Region = ""
+	job.HomeRegion = ""
+	job.QuotedPrice = 0
+	job.Usage = nil
+	job.Environment = nil
+	job.RerunOf = ""
+	job.Reproduction = nil
+	job.GroupID = ""
+	job.Role = ""
+	job.RoleIndex = 0
+}
+
+// isYAMLRequest reports whether a request body is declared as YAML
+func isYAMLRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return false
+}
+
+// fieldErrors returns the per-field problems of an invalid job document
+func fieldErrors(err error) []jobspec.FieldError {
+	var verr *jobspec.ValidationError
+	if errors.As(err, &verr) {
+		return verr.Fields
+	}
+	return nil
+}
+
+// jobFromDocument converts a validated job document into a job
+func jobFromDocument(doc *jobspec.Job) *Job {
+	spec := &doc.Spec
+	payload, _ := json.Marshal(spec.Payload())
+	timeout, _ := spec.Timeout.Duration()
+
+	job := &Job{
+		Name:     doc.Metadata.Name,
+		Type:     string(spec.Runtime),
+		Priority: *spec.Priority,
+		Requirements: ResourceRequirements{
+			CPUCores:     spec.Resources.CPU,
+			MemoryMB:     spec.Resources.Memory.MB() + spec.SidecarMemoryMB(),
+			StorageMB:    spec.Resources.Storage.MB(),
+			NetworkMbps:  spec.Resources.NetworkMbps,
+			TrustedExec:  spec.Resources.TrustedExec,
+			Capabilities: spec.Resources.Capabilities,
+			MinTrustTier: spec.Resources.MinTrustTier,
+		},
+		Payload:          payload,
+		MaxRetries:       spec.MaxRetries,
+		Timeout:          timeout,
+		Tags:             doc.Metadata.Tags,
+		QuoteID:          spec.QuoteID,
+		MatchID:          spec.MatchID,
+		PlacementProfile: spec.Placement,
+	}
+	if gpu := spec.Resources.GPU; gpu != nil {
+		job.Requirements.GPUCount = gpu.Count
+		job.Requirements.GPUType = gpu.Type
+		job.Requirements.MinDriverVersion = gpu.MinDriverVersion
+		job.Requirements.MinCUDAVersion = gpu.MinCUDAVersion
+		job.Requirements.MinROCmVersion = gpu.MinROCmVersion
+	}
+	// Sidecars run on the job's agent as one unit, which older agents cannot do
+	if len(spec.Sidecars) > 0 {
+		job.Requirements.Capabilities = append(append([]string(nil), job.Requirements.Capabilities...), sidecarCapability)
+	}
+	for _, port := range spec.Ports {
+		job.ExposedPorts = append(job.ExposedPorts, ExposedPort{Name: port.Name, Port: port.Port, Protocol: port.Protocol})
+	}
+	if sla := spec.SLA; sla != nil {
+		job.SLARequirements = &SLARequirements{
+			MaxLatencyMs:     sla.MaxLatencyMs,
+			MinAvailability:  sla.MinAvailability,
+			MaxCostPerHour:   sla.MaxCostPerHour,
+			PreferredRegions: sla.PreferredRegions,
+			AllowMaintenance: sla.AllowMaintenance,
+		}
+	}
+	return job
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+)
+
+// Job warning kinds
+const (
+	WarningMemoryPressure   = "memory_pressure"   // The job is predicted to run out of memory
+	WarningCheckpointFailed = "checkpoint_failed" // The checkpoint triggered by a warning failed
+)
+
+// JobWarning is a problem an agent saw while running a job that the job's
+// owner should know about before it fails the job
+type JobWarning struct {
+	Kind                string  `json:"kind"`
+	MemoryMB            int64   `json:"memory_mb,omitempty"`
+	LimitMB             int64   `json:"limit_mb,omitempty"`
+	GrowthMBPerMinute   float64 `json:"growth_mb_per_minute,omitempty"`
+	PredictedOOMSeconds int     `json:"predicted_oom_seconds,omitempty"` // Until the memory limit is reached at the current growth rate
+	Checkpoint          string  `json:"checkpoint,omitempty"`            // triggered or failed, empty when the job declares none
+	Message             string  `json:"message"`
+}
+
+// ReportJobWarning records a warning an agent raised for one of its running
+// jobs, streams it to the job's watchers and publishes it as job.warning
+func (s *SchedulerService) ReportJobWarning(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var warning JobWarning
+	if err := json.NewDecoder(r.Body).Decode(&warning); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if warning.Kind != WarningMemoryPressure && warning.Kind != WarningCheckpointFailed {
+		http.Error(w, fmt.Sprintf("Unknown warning kind %q", warning.Kind), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.RLock()
+	job, exists := s.jobs[vars["job"]]
+	valid := exists && job.AssignedAgentID == vars["id"] && !isTerminalJobStatus(job.Status)
+	var status, owner string
+	if valid {
+		status, owner = job.Status, job.UserID
+	}
+	s.mu.RUnlock()
+	if !valid {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	ctx := obs.WithJobID(r.Context(), vars["job"])
+	slog.WarnContext(ctx, "Agent raised job warning", "agent_id", vars["id"], obs.KeyUserID, owner,
+		"kind", warning.Kind, "memory_mb", warning.MemoryMB, "limit_mb", warning.LimitMB,
+		"predicted_oom_seconds", warning.PredictedOOMSeconds, "checkpoint", warning.Checkpoint)
+
+	s.events.Record(JobEvent{
+		JobID:   vars["job"],
+		Type:    "warning",
+		Event:   "job.warning",
+		Status:  status,
+		Message: warning.Message,
+		Warning: &warning,
+	})
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"job_id":  vars["job"],
+		"user_id": owner,
+		"warning": warning,
+	})
+	s.nats.Publish("job.warning", data)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"net/http"
 	"os"
@@ -12,6 +12,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/computehive/core-services/pkg/events"
+	"github.com/computehive/core-services/pkg/gpuruntime"
+	"github.com/computehive/core-services/pkg/health"
+	"github.com/computehive/core-services/pkg/maintenance"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/computehive/core-services/pkg/tagfilter"
+	"github.com/computehive/core-services/pkg/trust"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"github.com/nats-io/nats.go"
@@ -23,7 +30,9 @@ import (
 // Job represents a compute job
 type Job struct {
 	ID               string               `json:"id"`
+	Name             string               `json:"name,omitempty"` // From the job document's metadata
 	UserID           string               `json:"user_id"`
+	OrgID            string               `json:"org_id,omitempty"` // Organization of the submitting user
 	Type             string               `json:"type"`
 	Status           string               `json:"status"`
 	Priority         int                  `json:"priority"`
@@ -31,15 +40,40 @@ type Job struct {
 	Payload          json.RawMessage      `json:"payload"`
 	AssignedAgentID  string               `json:"assigned_agent_id,omitempty"`
 	CreatedAt        time.Time            `json:"created_at"`
+	QueuedAt         time.Time            `json:"queued_at"` // Last time the job entered the queue, on submission or retry
 	ScheduledAt      *time.Time           `json:"scheduled_at,omitempty"`
 	StartedAt        *time.Time           `json:"started_at,omitempty"`
 	CompletedAt      *time.Time           `json:"completed_at,omitempty"`
 	EstimatedCost    float64              `json:"estimated_cost"`
 	ActualCost       float64              `json:"actual_cost,omitempty"`
+	CostToDate       float64              `json:"cost_to_date,omitempty"`   // Metered from heartbeats while running
 	MaxRetries       int                  `json:"max_retries"`
 	RetryCount       int                  `json:"retry_count"`
 	Timeout          time.Duration        `json:"timeout"`
 	SLARequirements  *SLARequirements     `json:"sla_requirements,omitempty"`
+	PlacementProfile string               `json:"placement_profile,omitempty"` // Scoring profile that ranks candidate agents
+	Region           string               `json:"region,omitempty"`      // Region executing the job
+	HomeRegion       string               `json:"home_region,omitempty"` // Region that accepted and bills the job
+	Tags             map[string]string    `json:"tags,omitempty"`        // Cost allocation tags, e.g. team=nlp
+	TargetAgentID    string               `json:"target_agent_id,omitempty"` // Pins the job to one agent (provider verification)
+	ExposedPorts     []ExposedPort        `json:"exposed_ports,omitempty"`   // Ports reachable through the tunnel service
+	QuoteID          string               `json:"quote_id,omitempty"`        // Marketplace quote honored at settlement
+	MatchID          string               `json:"match_id,omitempty"`        // Marketplace match the job runs under
+	QuotedPrice      float64              `json:"quoted_price_per_hour,omitempty"` // Hourly price locked by the quote
+	Usage            *JobUsage            `json:"usage,omitempty"`           // Observed usage reported by the agent
+	Environment      *ExecutionEnvironment `json:"environment,omitempty"`    // Environment the job ran in, for reproduction
+	RerunOf          string               `json:"rerun_of,omitempty"`        // Job this one reproduces
+	Reproduction     *ReproductionReport  `json:"reproduction,omitempty"`    // How closely a re-run matches its original
+	GroupID          string               `json:"group_id,omitempty"`        // Job group the job is a replica of
+	Role             string               `json:"role,omitempty"`            // Role of the replica within its group
+	RoleIndex        int                  `json:"role_index,omitempty"`      // Index of the replica within its role
+}
+
+// ExposedPort is a job port that consumers reach through an agent-initiated tunnel
+type ExposedPort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"` // http, tcp
 }
 
 // ResourceRequirements specifies job resource needs
@@ -52,6 +86,8 @@ type ResourceRequirements struct {
 	NetworkMbps  int      `json:"network_mbps"`
 	TrustedExec  bool     `json:"trusted_exec"`
 	Capabilities []string `json:"capabilities,omitempty"`
+	MinTrustTier string   `json:"min_trust_tier,omitempty"` // community, verified, tee_attested or dedicated
+	gpuruntime.Requirements // Minimum GPU driver, CUDA and ROCm versions
 }
 
 // SLARequirements defines service level agreement requirements
@@ -60,6 +96,7 @@ type SLARequirements struct {
 	MinAvailability  float64 `json:"min_availability"`
 	MaxCostPerHour   float64 `json:"max_cost_per_hour"`
 	PreferredRegions []string `json:"preferred_regions,omitempty"`
+	AllowMaintenance bool    `json:"allow_maintenance,omitempty"` // Accept agents with a maintenance window during the run
 }
 
 // Agent represents a compute agent
@@ -73,15 +110,21 @@ type Agent struct {
 	Reputation   float64             `json:"reputation"`
 	LastSeen     time.Time           `json:"last_seen"`
 	ActiveJobs   []string            `json:"active_jobs"`
+	Labels       map[string]string   `json:"labels,omitempty"` // Used to assign config profiles
+	TrustTier    trust.Tier          `json:"trust_tier"`
+	Cordon       *AgentCordon        `json:"cordon,omitempty"` // Closed to new jobs
+	Maintenance  []maintenance.Window `json:"maintenance,omitempty"` // Recurring windows the provider takes the agent down in
+	Connectivity *AgentConnectivity  `json:"connectivity,omitempty"` // Direct or relayed, as the agent last reported
 }
 
 // AgentResources represents available resources on an agent
 type AgentResources struct {
-	CPU     CPUInfo     `json:"cpu"`
-	Memory  MemoryInfo  `json:"memory"`
-	GPUs    []GPUInfo   `json:"gpus"`
-	Storage StorageInfo `json:"storage"`
-	Network NetworkInfo `json:"network"`
+	CPU        CPUInfo              `json:"cpu"`
+	Memory     MemoryInfo           `json:"memory"`
+	GPUs       []GPUInfo            `json:"gpus"`
+	Storage    StorageInfo          `json:"storage"`
+	Network    NetworkInfo          `json:"network"`
+	GPURuntime *gpuruntime.Versions `json:"gpu_runtime,omitempty"` // Driver and CUDA/ROCm versions, when the agent has GPUs
 }
 
 // Resource info types
@@ -117,9 +160,29 @@ type SchedulerService struct {
 	jobs       map[string]*Job
 	agents     map[string]*Agent
 	jobQueue   []*Job
+	placing    map[string]bool // Jobs a scheduleJob call is placing
 	mu         sync.RWMutex
 	nats       *nats.Conn
+	bus        *events.Bus
 	httpClient *http.Client
+	federation *Federation
+	exec       *ExecRelay
+	placements *PlacementHistory
+	queueWaits *QueueWaitStats
+	logs       *JobLogs
+	events     *JobEvents
+	profiles   *ConfigProfiles
+	enrollment *Enrollments
+	diagnostics *AgentDiagnostics
+	groups     *JobGroups
+	trust      *TrustRegistry
+	payloads   *PayloadPolicy
+	resizes    *JobResizes
+	protocols  *AgentProtocols
+	costs      *CostMeter
+	scoring    *PlacementProfiles
+	poolLimits map[string]*PoolLimit // Per-agent job limits of scaled-down pools
+	agentEnvironments map[string]*ExecutionEnvironment // Last environment each agent reported
 	
 	// Metrics
 	jobsScheduled   prometheus.Counter
@@ -142,12 +205,25 @@ func NewSchedulerService() (*SchedulerService, error) {
 		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 	
+	// Job lifecycle events go through JetStream so consumers that are down catch up
+	bus, err := events.Connect(nc, "scheduler-service")
+	if err != nil {
+		return nil, err
+	}
+	
 	s := &SchedulerService{
 		jobs:       make(map[string]*Job),
 		agents:     make(map[string]*Agent),
 		jobQueue:   make([]*Job, 0),
+		placing:    make(map[string]bool),
+		poolLimits: make(map[string]*PoolLimit),
 		nats:       nc,
-		httpClient: &http.Client{Timeout: 10 * time.Second},
+		bus:        bus,
+		httpClient: &http.Client{Timeout: 10 * time.Second, Transport: obs.Transport(nil)},
+		placements: NewPlacementHistory(),
+		logs:       NewJobLogs(),
+		events:     NewJobEvents(),
+		agentEnvironments: make(map[string]*ExecutionEnvironment),
 		
 		// Initialize metrics
 		jobsScheduled: prometheus.NewCounter(prometheus.CounterOpts{
@@ -176,6 +252,43 @@ func NewSchedulerService() (*SchedulerService, error) {
 	// Register metrics
 	prometheus.MustRegister(s.jobsScheduled, s.jobsCompleted, s.jobsFailed, s.schedulingTime, s.queueLength)
 	
+	// Configure multi-region federation
+	s.federation = NewFederation(s)
+	s.queueWaits = NewQueueWaitStats(s.federation.Regions())
+	
+	// Interactive exec sessions into running jobs
+	s.exec = NewExecRelay(s)
+	
+	// Fleet configuration profiles pushed to agents
+	s.profiles = NewConfigProfiles(s)
+	
+	// Agents join the fleet through join tokens and admin approval
+	s.enrollment = NewEnrollments(s)
+	
+	// Protocol negotiation and adapters for older agents
+	s.protocols = NewAgentProtocols(s)
+	
+	// Support bundles collected from agents on request
+	s.diagnostics = NewAgentDiagnostics(s)
+	
+	// Live cost-to-date of running jobs
+	s.costs = NewCostMeter(s)
+	
+	// Named placement scoring profiles and placement explanations
+	s.scoring = NewPlacementProfiles(s)
+	
+	// Multi-role job groups placed and started together
+	s.groups = NewJobGroups(s)
+	
+	// Agent trust tiers from ownership, reputation and TEE attestation
+	s.trust = NewTrustRegistry(s)
+	
+	// Payload scanning for embedded credentials, host access and banned images
+	s.payloads = NewPayloadPolicy(s)
+	
+	// Vertical resizes of running container jobs
+	s.resizes = NewJobResizes(s)
+	
 	// Subscribe to agent events
 	s.subscribeToAgentEvents()
 	
@@ -184,9 +297,9 @@ func NewSchedulerService() (*SchedulerService, error) {
 
 // SubmitJob handles job submission
 func (s *SchedulerService) SubmitJob(w http.ResponseWriter, r *http.Request) {
-	var job Job
-	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	job, err := decodeJobRequest(r)
+	if err != nil {
+		obs.WriteError(w, r, err)
 		return
 	}
 	
@@ -194,32 +307,59 @@ func (s *SchedulerService) SubmitJob(w http.ResponseWriter, r *http.Request) {
 	job.ID = generateID()
 	job.Status = "pending"
 	job.CreatedAt = time.Now()
+	job.Region = s.federation.Region()
+	job.HomeRegion = s.federation.Region()
 	
 	// Extract user ID from JWT token
 	claims := r.Context().Value("claims").(*Claims)
 	job.UserID = claims.UserID
+	job.OrgID = claims.OrgID
+	
+	// Only the marketplace pins jobs to an agent, to verify a provider
+	if job.TargetAgentID != "" && (!isServiceCaller(r) || job.Tags["purpose"] != "provider-verification") {
+		obs.WriteError(w, r, obs.Errorf(obs.CodePermissionDenied, "target_agent_id is reserved for provider verification jobs"))
+		return
+	}
 	
 	// Validate job requirements
-	if err := s.validateJobRequirements(&job); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := s.validateJobRequirements(job); err != nil {
+		obs.WriteError(w, r, err)
 		return
 	}
 	
+	// A match prices the job only if it is the caller's
+	if err := s.costs.bindMatch(job); err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+	
+	// A redeemed quote fixes the hourly price for the job
+	job.QuotedPrice = 0
+	if job.QuoteID != "" {
+		price, err := s.redeemQuote(r.Context(), job)
+		if err != nil {
+			obs.WriteError(w, r, err)
+			return
+		}
+		job.QuotedPrice = price
+	}
+	
 	// Estimate cost based on requirements and market rates
-	job.EstimatedCost = s.estimateJobCost(&job)
+	job.EstimatedCost = s.estimateJobCost(job)
 	
 	// Store job
 	s.mu.Lock()
-	s.jobs[job.ID] = &job
-	s.jobQueue = append(s.jobQueue, &job)
+	s.jobs[job.ID] = job
+	job.QueuedAt = time.Now()
+	s.jobQueue = append(s.jobQueue, job)
 	s.queueLength.Set(float64(len(s.jobQueue)))
 	s.mu.Unlock()
 	
 	// Trigger scheduling
-	go s.scheduleJob(&job)
+	go s.scheduleJob(job)
 	
 	// Publish job created event
-	s.publishJobEvent("job.created", &job)
+	s.publishJobEvent(r.Context(), "job.created", job)
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(job)
@@ -254,12 +394,23 @@ func (s *SchedulerService) GetJob(w http.ResponseWriter, r *http.Request) {
 func (s *SchedulerService) ListJobs(w http.ResponseWriter, r *http.Request) {
 	claims := r.Context().Value("claims").(*Claims)
 	
+	// Optional cost tag filters, e.g. ?tag=team=nlp&tag=project=alpha
+	tagFilters, err := tagfilter.Parse(r.URL.Query()["tag"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	
 	var userJobs []*Job
 	s.mu.RLock()
 	for _, job := range s.jobs {
-		if job.UserID == claims.UserID || claims.Role == "admin" {
-			userJobs = append(userJobs, job)
+		if job.UserID != claims.UserID && claims.Role != "admin" {
+			continue
+		}
+		if !tagfilter.Match(job.Tags, tagFilters) {
+			continue
 		}
+		userJobs = append(userJobs, job)
 	}
 	s.mu.RUnlock()
 	
@@ -299,26 +450,50 @@ func (s *SchedulerService) CancelJob(w http.ResponseWriter, r *http.Request) {
 	job.CompletedAt = &now
 	s.mu.Unlock()
 	
+	// Close the job's cost meter at cancellation
+	s.costs.finish(jobID)
+	
 	// Notify assigned agent if any
 	if job.AssignedAgentID != "" {
 		s.notifyAgentJobCancelled(job.AssignedAgentID, jobID)
 	}
 	
 	// Publish cancellation event
-	s.publishJobEvent("job.cancelled", job)
+	s.publishJobEvent(r.Context(), "job.cancelled", job)
 	
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // scheduleJob finds the best agent for a job and assigns it
 func (s *SchedulerService) scheduleJob(job *Job) {
+	// Submitted jobs are queued and scheduled right away, so the queue can
+	// hand out a job that is already being placed, was placed or cancelled
+	s.mu.Lock()
+	if job.Status != "pending" || s.placing[job.ID] {
+		s.mu.Unlock()
+		return
+	}
+	s.placing[job.ID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.placing, job.ID)
+		s.mu.Unlock()
+	}()
+	
 	timer := prometheus.NewTimer(s.schedulingTime)
 	defer timer.ObserveDuration()
 	
 	// Find suitable agents
 	agents := s.findSuitableAgents(job)
 	if len(agents) == 0 {
-		log.Printf("No suitable agents found for job %s", job.ID)
+		slog.Info("No suitable agents found", obs.KeyJobID, job.ID)
+		
+		// Another region may own matching capacity
+		if s.federation.Enabled() && s.federation.forwardJob(job) {
+			return
+		}
+		
 		s.requeueJob(job)
 		return
 	}
@@ -329,6 +504,7 @@ func (s *SchedulerService) scheduleJob(job *Job) {
 	// Try to assign to the best agent
 	for _, sa := range scoredAgents {
 		if s.assignJobToAgent(job, sa.agent) {
+			s.scoring.record(job, scoredAgents, sa.agent)
 			s.jobsScheduled.Inc()
 			return
 		}
@@ -338,8 +514,19 @@ func (s *SchedulerService) scheduleJob(job *Job) {
 	s.requeueJob(job)
 }
 
-// findSuitableAgents finds agents that meet job requirements
+// findSuitableAgents finds agents that meet job requirements, asking the
+// capacity index first and scanning agents locally if it is unreachable
 func (s *SchedulerService) findSuitableAgents(job *Job) []*Agent {
+	agents, _, err := s.indexedSuitableAgents(context.Background(), job)
+	if err == nil {
+		return agents
+	}
+	slog.Warn("Capacity index unavailable, scanning agents", obs.KeyJobID, job.ID, obs.KeyError, err)
+	return s.findSuitableAgentsLocal(job)
+}
+
+// findSuitableAgentsLocal scans the scheduler's own agent records
+func (s *SchedulerService) findSuitableAgentsLocal(job *Job) []*Agent {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	
@@ -360,6 +547,26 @@ func (s *SchedulerService) agentMeetsRequirements(agent *Agent, job *Job) bool {
 		return false
 	}
 	
+	// Pinned jobs only run on their target agent
+	if job.TargetAgentID != "" && agent.ID != job.TargetAgentID {
+		return false
+	}
+	
+	// Confidential work only runs on sufficiently trusted agents
+	if !agent.TrustTier.Meets(jobMinTrustTier(job)) {
+		return false
+	}
+	
+	// Cordoned agents and full agents of scaled-down pools take no new jobs
+	if !s.acceptsNewJobs(agent) {
+		return false
+	}
+	
+	// Jobs stay clear of planned maintenance unless their owner opted in
+	if !clearOfMaintenance(agent, job, time.Now()) {
+		return false
+	}
+	
 	// Check last seen time (agent should be recently active)
 	if time.Since(agent.LastSeen) > 2*time.Minute {
 		return false
@@ -390,6 +597,11 @@ func (s *SchedulerService) agentMeetsRequirements(agent *Agent, job *Job) bool {
 		}
 	}
 	
+	// Images built against a newer driver or runtime fail to start
+	if job.Requirements.Unmet(agent.Resources.GPURuntime) != "" {
+		return false
+	}
+	
 	// Check storage requirements
 	if agent.Resources.Storage.AvailableMB < job.Requirements.StorageMB {
 		return false
@@ -435,32 +647,17 @@ func (s *SchedulerService) agentMeetsRequirements(agent *Agent, job *Job) bool {
 	return true
 }
 
-// scoreAgents scores agents based on various factors
+// scoreAgents scores agents with the job's placement profile
 func (s *SchedulerService) scoreAgents(agents []*Agent, job *Job) []scoredAgent {
 	scored := make([]scoredAgent, len(agents))
+	profile := s.scoring.resolve(job)
 	
 	for i, agent := range agents {
-		score := 0.0
-		
-		// Factor 1: Cost (lower is better)
-		hourlyRate := s.calculateAgentHourlyRate(agent, job)
-		costScore := 1.0 / (1.0 + hourlyRate/100.0) // Normalize cost impact
-		score += costScore * 0.3
-		
-		// Factor 2: Reputation
-		score += agent.Reputation * 0.3
-		
-		// Factor 3: Resource availability (more available is better)
-		availabilityScore := float64(agent.Resources.CPU.Available) / float64(agent.Resources.CPU.Cores)
-		score += availabilityScore * 0.2
-		
-		// Factor 4: Current load (fewer active jobs is better)
-		loadScore := 1.0 / (1.0 + float64(len(agent.ActiveJobs)))
-		score += loadScore * 0.2
-		
+		score, factors := s.scoring.score(agent, job, profile.Weights)
 		scored[i] = scoredAgent{
-			agent: agent,
-			score: score,
+			agent:   agent,
+			score:   score,
+			factors: factors,
 		}
 	}
 	
@@ -473,8 +670,9 @@ func (s *SchedulerService) scoreAgents(agents []*Agent, job *Job) []scoredAgent
 }
 
 type scoredAgent struct {
-	agent *Agent
-	score float64
+	agent   *Agent
+	score   float64
+	factors []FactorScore
 }
 
 // calculateAgentHourlyRate calculates the hourly rate for a job on an agent
@@ -505,7 +703,7 @@ func (s *SchedulerService) assignJobToAgent(job *Job, agent *Agent) bool {
 	data, _ := json.Marshal(assignment)
 	msg, err := s.nats.Request(fmt.Sprintf("agent.%s.assign", agent.ID), data, 5*time.Second)
 	if err != nil {
-		log.Printf("Failed to assign job %s to agent %s: %v", job.ID, agent.ID, err)
+		slog.Warn("Failed to assign job", obs.KeyJobID, job.ID, "agent_id", agent.ID, obs.KeyError, err)
 		return false
 	}
 	
@@ -520,13 +718,15 @@ func (s *SchedulerService) assignJobToAgent(job *Job, agent *Agent) bool {
 	job.AssignedAgentID = agent.ID
 	now := time.Now()
 	job.ScheduledAt = &now
+	s.placements.Record(resourceClass(job.Requirements), now.Sub(job.CreatedAt))
+	s.queueWaits.Record(job, now)
 	
 	// Update agent's active jobs
 	agent.ActiveJobs = append(agent.ActiveJobs, job.ID)
 	s.mu.Unlock()
 	
 	// Publish assignment event
-	s.publishJobEvent("job.scheduled", job)
+	s.publishJobEvent(context.Background(), "job.scheduled", job)
 	
 	return true
 }
@@ -534,22 +734,26 @@ func (s *SchedulerService) assignJobToAgent(job *Job, agent *Agent) bool {
 // requeueJob puts a job back in the queue for retry
 func (s *SchedulerService) requeueJob(job *Job) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	
 	job.RetryCount++
 	if job.RetryCount > job.MaxRetries {
 		job.Status = "failed"
 		s.jobsFailed.Inc()
-		s.publishJobEvent("job.failed", job)
+		snapshot := *job
+		s.mu.Unlock()
+		
+		// Publishing waits for the stream's ack, so it runs without the lock
+		s.publishJobEvent(context.Background(), "job.failed", &snapshot)
 		return
 	}
+	backoff := time.Duration(math.Pow(2, float64(job.RetryCount))) * time.Second
+	s.mu.Unlock()
 	
 	// Add back to queue with exponential backoff
 	go func() {
-		backoff := time.Duration(math.Pow(2, float64(job.RetryCount))) * time.Second
 		time.Sleep(backoff)
 		
 		s.mu.Lock()
+		job.QueuedAt = time.Now()
 		s.jobQueue = append(s.jobQueue, job)
 		s.queueLength.Set(float64(len(s.jobQueue)))
 		s.mu.Unlock()
@@ -560,26 +764,44 @@ func (s *SchedulerService) requeueJob(job *Job) {
 
 func (s *SchedulerService) subscribeToAgentEvents() {
 	// Subscribe to agent heartbeats
-	s.nats.Subscribe("agent.heartbeat", func(msg *nats.Msg) {
+	s.nats.Subscribe("agent.heartbeat", obs.NATSHandler(func(ctx context.Context, msg *nats.Msg) error {
 		var heartbeat map[string]interface{}
 		if err := json.Unmarshal(msg.Data, &heartbeat); err != nil {
-			return
+			return obs.Wrap(obs.CodeInvalidArgument, err)
 		}
 		
-		agentID := heartbeat["agent_id"].(string)
+		agentID, ok := heartbeat["agent_id"].(string)
+		if !ok {
+			return obs.Errorf(obs.CodeInvalidArgument, "heartbeat has no agent_id")
+		}
+		if err := s.protocols.adaptHeartbeat(ctx, agentID, heartbeat); err != nil {
+			return err
+		}
 		s.updateAgentStatus(agentID, heartbeat)
-	})
+		s.costs.observe(agentID, heartbeat, time.Now())
+		return nil
+	}))
 	
 	// Subscribe to job results
-	s.nats.Subscribe("job.result", func(msg *nats.Msg) {
+	s.bus.Subscribe("job.result", func(ctx context.Context, msg *nats.Msg) error {
 		var result map[string]interface{}
 		if err := json.Unmarshal(msg.Data, &result); err != nil {
-			return
+			return obs.Wrap(obs.CodeInvalidArgument, err)
 		}
 		
-		jobID := result["job_id"].(string)
-		s.handleJobResult(jobID, result)
+		jobID, ok := result["job_id"].(string)
+		if !ok {
+			return obs.Errorf(obs.CodeInvalidArgument, "job result has no job_id")
+		}
+		if err := s.protocols.adaptJobResult(ctx, result); err != nil {
+			return err
+		}
+		s.handleJobResult(obs.WithJobID(ctx, jobID), jobID, result)
+		return nil
 	})
+	
+	// Follow agreed match prices for job cost meters
+	s.costs.subscribe(s.nats)
 }
 
 func (s *SchedulerService) updateAgentStatus(agentID string, heartbeat map[string]interface{}) {
@@ -588,11 +810,15 @@ func (s *SchedulerService) updateAgentStatus(agentID string, heartbeat map[strin
 	
 	agent, exists := s.agents[agentID]
 	if !exists {
-		// New agent registration
+		// New agent registration, for enrolled agents only
+		if !s.enrollment.admits(agentID) {
+			return
+		}
 		agent = &Agent{
 			ID:           agentID,
 			PricePerHour: make(map[string]float64),
 			ActiveJobs:   make([]string, 0),
+			TrustTier:    s.trust.tier(agentID),
 		}
 		s.agents[agentID] = agent
 	}
@@ -601,14 +827,38 @@ func (s *SchedulerService) updateAgentStatus(agentID string, heartbeat map[strin
 	agent.Status = heartbeat["status"].(string)
 	agent.LastSeen = time.Now()
 	
+	if labels, ok := heartbeat["labels"].(map[string]interface{}); ok {
+		agent.Labels = make(map[string]string, len(labels))
+		for key, value := range labels {
+			if str, ok := value.(string); ok {
+				agent.Labels[key] = str
+			}
+		}
+	}
+	
 	// Update resources if provided
-	if resources, ok := heartbeat["resources"].(map[string]interface{}); ok {
-		// Parse and update resources (simplified)
-		// In production, this would properly unmarshal the resources
+	if raw, ok := heartbeat["resources"]; ok {
+		if resources, ok := parseHeartbeatResources(raw); ok {
+			if gpuRuntimeChanged(agent.Resources.GPURuntime, resources.GPURuntime) {
+				go s.publishGPURuntime(agentID, resources.GPURuntime)
+			}
+			agent.Resources = resources
+		}
+	}
+	
+	// Capabilities and location rarely change, so heartbeats may omit them
+	if capabilities := stringList(heartbeat["capabilities"]); len(capabilities) > 0 {
+		agent.Capabilities = capabilities
+	}
+	if location, ok := heartbeat["location"].(string); ok && location != "" {
+		agent.Location = location
+	}
+	if conn := parseHeartbeatConnectivity(heartbeat["connectivity"]); conn != nil {
+		agent.Connectivity = conn
 	}
 }
 
-func (s *SchedulerService) handleJobResult(jobID string, result map[string]interface{}) {
+func (s *SchedulerService) handleJobResult(ctx context.Context, jobID string, result map[string]interface{}) {
 	s.mu.Lock()
 	job, exists := s.jobs[jobID]
 	if !exists {
@@ -617,10 +867,35 @@ func (s *SchedulerService) handleJobResult(jobID string, result map[string]inter
 	}
 	
 	// Update job status
-	status := result["status"].(string)
+	status, _ := result["status"].(string)
+	
+	// A redelivered result must not finish the job, count or bill it twice
+	if job.CompletedAt != nil && job.Status == status {
+		s.mu.Unlock()
+		return
+	}
+	
+	// Jobs drained off an agent ignore what that agent reports afterwards
+	if agentID, _ := result["agent_id"].(string); agentID != "" && agentID != job.AssignedAgentID {
+		s.mu.Unlock()
+		return
+	}
 	job.Status = status
 	now := time.Now()
 	
+	if usage := parseJobUsage(result); usage != nil {
+		job.Usage = usage
+	}
+	if env := parseJobEnvironment(result); env != nil {
+		s.recordJobEnvironment(job, env)
+	}
+	if output, ok := result["output"].(string); ok {
+		s.logs.AppendOutput(jobID, "output", output)
+	}
+	if errMsg, ok := result["error"].(string); ok {
+		s.logs.AppendOutput(jobID, "error", errMsg)
+	}
+	
 	if status == "completed" {
 		job.CompletedAt = &now
 		s.jobsCompleted.Inc()
@@ -640,15 +915,41 @@ func (s *SchedulerService) handleJobResult(jobID string, result map[string]inter
 		agent.ActiveJobs = newActiveJobs
 	}
 	
+	forwarded := job.HomeRegion != "" && job.HomeRegion != s.federation.Region()
+	agentID := job.AssignedAgentID
+	finished := job.CompletedAt != nil
 	s.mu.Unlock()
 	
+	// Finished jobs stop accruing cost
+	if finished {
+		s.costs.finish(jobID)
+	}
+	
+	// Finished jobs build the agent's reputation
+	s.trust.recordOutcome(ctx, agentID, status)
+	
+	// Forwarded jobs are billed by their home region
+	if forwarded && (status == "completed" || status == "failed") {
+		go s.federation.reportToHome(job)
+	}
+	
 	// Publish completion event
-	s.publishJobEvent(fmt.Sprintf("job.%s", status), job)
+	s.publishJobEvent(ctx, fmt.Sprintf("job.%s", status), job)
 }
 
-func (s *SchedulerService) publishJobEvent(event string, job *Job) {
+func (s *SchedulerService) publishJobEvent(ctx context.Context, event string, job *Job) {
+	ctx = obs.WithJobID(ctx, job.ID)
 	data, _ := json.Marshal(job)
-	s.nats.Publish(event, data)
+	if err := s.bus.Publish(ctx, event, data); err != nil {
+		obs.LogError(ctx, "Failed to publish job event", err, "event", event)
+	}
+	
+	s.events.Record(JobEvent{
+		JobID:  job.ID,
+		Type:   "state",
+		Event:  event,
+		Status: job.Status,
+	})
 }
 
 func (s *SchedulerService) notifyAgentJobCancelled(agentID, jobID string) {
@@ -663,10 +964,10 @@ func (s *SchedulerService) notifyAgentJobCancelled(agentID, jobID string) {
 // validateJobRequirements validates job requirements
 func (s *SchedulerService) validateJobRequirements(job *Job) error {
 	if job.Requirements.CPUCores <= 0 {
-		return fmt.Errorf("CPU cores must be positive")
+		return obs.Errorf(obs.CodeInvalidArgument, "CPU cores must be positive")
 	}
 	if job.Requirements.MemoryMB <= 0 {
-		return fmt.Errorf("memory must be positive")
+		return obs.Errorf(obs.CodeInvalidArgument, "memory must be positive")
 	}
 	if job.Timeout <= 0 {
 		job.Timeout = 1 * time.Hour // Default timeout
@@ -677,28 +978,94 @@ func (s *SchedulerService) validateJobRequirements(job *Job) error {
 	if job.Priority < 0 || job.Priority > 10 {
 		job.Priority = 5 // Default priority
 	}
+	if err := validateCostTags(job.Tags); err != nil {
+		return obs.Wrap(obs.CodeInvalidArgument, err)
+	}
+	if err := validateExposedPorts(job.ExposedPorts); err != nil {
+		return obs.Wrap(obs.CodeInvalidArgument, err)
+	}
+	if len(job.ExposedPorts) > 0 && job.Type != "docker" {
+		// Other job types share the provider's network, where a port could reach any of its services
+		return obs.Errorf(obs.CodeInvalidArgument, "exposed_ports require a docker job")
+	}
+	if job.Requirements.MinTrustTier != "" {
+		tier, err := trust.Parse(job.Requirements.MinTrustTier)
+		if err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		job.Requirements.MinTrustTier = string(tier)
+	}
+	if err := job.Requirements.Requirements.Validate(); err != nil {
+		return obs.Wrap(obs.CodeInvalidArgument, err)
+	}
+	if err := s.payloads.check(job); err != nil {
+		return err
+	}
+	if err := s.scoring.check(job); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateExposedPorts checks the ports a job asks to expose
+func validateExposedPorts(ports []ExposedPort) error {
+	if len(ports) > 5 {
+		return fmt.Errorf("at most 5 exposed ports are allowed")
+	}
+	seen := make(map[string]bool)
+	for i := range ports {
+		port := &ports[i]
+		if port.Port < 1 || port.Port > 65535 {
+			return fmt.Errorf("invalid exposed port %d", port.Port)
+		}
+		if port.Name == "" {
+			port.Name = fmt.Sprintf("%d", port.Port)
+		}
+		if seen[port.Name] {
+			return fmt.Errorf("duplicate exposed port name %q", port.Name)
+		}
+		seen[port.Name] = true
+		switch port.Protocol {
+		case "":
+			port.Protocol = "http"
+		case "http", "tcp":
+		default:
+			return fmt.Errorf("exposed port protocol must be http or tcp")
+		}
+	}
 	return nil
 }
 
 // estimateJobCost estimates the cost of running a job
 func (s *SchedulerService) estimateJobCost(job *Job) float64 {
+	baseRate := requirementsHourlyRate(job.Requirements)
+	
+	// Estimate job duration (simplified)
+	estimatedHours := float64(job.Timeout) / float64(time.Hour)
+	
+	if job.QuotedPrice > 0 {
+		return job.QuotedPrice * estimatedHours
+	}
+	
+	return baseRate * estimatedHours
+}
+
+// requirementsHourlyRate returns the list hourly rate for a set of requirements
+func requirementsHourlyRate(req ResourceRequirements) float64 {
 	// Base estimates (would be more sophisticated in production)
-	cpuHourlyRate := 0.05 * float64(job.Requirements.CPUCores)
-	memoryHourlyRate := 0.01 * float64(job.Requirements.MemoryMB) / 1024.0
-	storageHourlyRate := 0.001 * float64(job.Requirements.StorageMB) / 1024.0
+	cpuHourlyRate := 0.05 * float64(req.CPUCores)
+	memoryHourlyRate := 0.01 * float64(req.MemoryMB) / 1024.0
+	storageHourlyRate := 0.001 * float64(req.StorageMB) / 1024.0
 	
 	baseRate := cpuHourlyRate + memoryHourlyRate + storageHourlyRate
 	
 	// Add GPU premium
-	if job.Requirements.GPUCount > 0 {
-		gpuRate := 0.5 * float64(job.Requirements.GPUCount) // $0.50 per GPU hour
+	if req.GPUCount > 0 {
+		gpuRate := 0.5 * float64(req.GPUCount) // $0.50 per GPU hour
 		baseRate += gpuRate
 	}
 	
-	// Estimate job duration (simplified)
-	estimatedHours := float64(job.Timeout) / float64(time.Hour)
-	
-	return baseRate * estimatedHours
+	return baseRate
 }
 
 // Process job queue periodically
@@ -733,6 +1100,7 @@ type Claims struct {
 	Email    string   `json:"email"`
 	Username string   `json:"username"`
 	Role     string   `json:"role"`
+	OrgID    string   `json:"org_id,omitempty"`
 	Scopes   []string `json:"scopes"`
 	jwt.RegisteredClaims
 }
@@ -754,6 +1122,7 @@ func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 		
 		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = obs.WithCaller(ctx, claims.UserID, claims.OrgID)
 		next(w, r.WithContext(ctx))
 	}
 }
@@ -762,33 +1131,161 @@ func generateID() string {
 	return fmt.Sprintf("%d", time.Now().UnixNano())
 }
 
+// isAdmin reports whether the authenticated caller is an admin
+func isAdmin(r *http.Request) bool {
+	claims, ok := r.Context().Value("claims").(*Claims)
+	return ok && claims.Role == "admin"
+}
+
 func main() {
+	obs.Init("scheduler-service")
+	
 	// Create scheduler service
 	scheduler, err := NewSchedulerService()
 	if err != nil {
-		log.Fatalf("Failed to create scheduler service: %v", err)
+		obs.Fatal("Failed to create scheduler service", err)
 	}
 	
 	// Start queue processor
 	go scheduler.processQueue()
 	
+	// Watch config profile rollouts for elevated agent error rates
+	go scheduler.profiles.monitorRollouts()
+	
+	// Place pending job groups and settle finished ones
+	go scheduler.groups.run()
+	
+	// Demote agents whose TEE attestation expired
+	go scheduler.trust.run()
+	
+	// Count agents by protocol version for deprecation tracking
+	go scheduler.protocols.run()
+	
+	// Drop the events of long-finished jobs
+	go scheduler.events.run()
+	
+	// Start federation peer sync
+	if scheduler.federation.Enabled() {
+		go scheduler.federation.run(context.Background())
+	}
+	
 	// Setup routes
 	router := mux.NewRouter()
+	router.Use(obs.Middleware)
 	
-	// Health check
-	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	}).Methods("GET")
+	// Health checks: /healthz is liveness only, /readyz runs dependency checks
+	checker := health.NewChecker("scheduler-service")
+	checker.AddCheck("nats", true, health.NATSCheck(scheduler.nats))
+	router.HandleFunc("/healthz", checker.LivenessHandler).Methods("GET")
+	router.HandleFunc("/readyz", checker.ReadinessHandler).Methods("GET")
+	router.HandleFunc("/health", checker.ReadinessHandler).Methods("GET") // Legacy alias
 	
 	// Metrics endpoint
 	router.Handle("/metrics", promhttp.Handler())
 	
+	// Runtime logging control
+	router.HandleFunc("/admin/logging", authMiddleware(obs.Logging.Handler(isAdmin))).Methods("GET", "PUT")
+	
 	// Job endpoints
 	router.HandleFunc("/api/v1/jobs", authMiddleware(scheduler.SubmitJob)).Methods("POST")
 	router.HandleFunc("/api/v1/jobs", authMiddleware(scheduler.ListJobs)).Methods("GET")
+	router.HandleFunc("/api/v1/jobs/batch", authMiddleware(scheduler.SubmitJobBatch)).Methods("POST")
+	router.HandleFunc("/api/v1/jobs/dry-run", authMiddleware(scheduler.DryRunJob)).Methods("POST")
 	router.HandleFunc("/api/v1/jobs/{id}", authMiddleware(scheduler.GetJob)).Methods("GET")
 	router.HandleFunc("/api/v1/jobs/{id}/cancel", authMiddleware(scheduler.CancelJob)).Methods("POST")
+	router.HandleFunc("/api/v1/jobs/{id}/rerun", authMiddleware(scheduler.RerunJob)).Methods("POST")
+	router.HandleFunc("/api/v1/jobs/{id}/logs", authMiddleware(scheduler.GetJobLogs)).Methods("GET")
+	router.HandleFunc("/api/v1/jobs/{id}/events/stream", authMiddleware(scheduler.StreamJobEvents)).Methods("GET")
+	router.HandleFunc("/api/v1/jobs/{id}/queue", authMiddleware(scheduler.GetQueueStatus)).Methods("GET")
+	router.HandleFunc("/api/v1/jobs/{id}/exec", authMiddleware(scheduler.exec.ExecJob)).Methods("GET")
+	router.HandleFunc("/api/v1/jobs/{id}/resize", authMiddleware(scheduler.resizes.ResizeJob)).Methods("POST")
+	router.HandleFunc("/api/v1/jobs/{id}/resizes", authMiddleware(scheduler.resizes.ListJobResizes)).Methods("GET")
+	router.HandleFunc("/api/v1/jobs/{id}/cost", authMiddleware(scheduler.costs.GetJobCost)).Methods("GET")
+	router.HandleFunc("/api/v1/jobs/{id}/placement", authMiddleware(scheduler.scoring.GetJobPlacement)).Methods("GET")
+	router.HandleFunc("/api/v1/placement/explain", authMiddleware(scheduler.scoring.ExplainPlacement)).Methods("POST")
+	router.HandleFunc("/api/v1/placement/profiles/{org}", authMiddleware(scheduler.scoring.ListPlacementProfiles)).Methods("GET")
+	router.HandleFunc("/api/v1/placement/profiles/{org}/{name}", authMiddleware(scheduler.scoring.SetPlacementProfile)).Methods("PUT")
+	router.HandleFunc("/api/v1/placement/profiles/{org}/{name}", authMiddleware(scheduler.scoring.DeletePlacementProfile)).Methods("DELETE")
+	router.HandleFunc("/api/v1/job-groups", authMiddleware(scheduler.groups.SubmitJobGroup)).Methods("POST")
+	router.HandleFunc("/api/v1/job-groups", authMiddleware(scheduler.groups.ListJobGroups)).Methods("GET")
+	router.HandleFunc("/api/v1/job-groups/{id}", authMiddleware(scheduler.groups.GetJobGroup)).Methods("GET")
+	router.HandleFunc("/api/v1/job-groups/{id}/cancel", authMiddleware(scheduler.groups.CancelJobGroup)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/{id}/jobs/{job}/warnings", scheduler.enrollment.agentMiddleware(scheduler.ReportJobWarning)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/{id}/jobs/{job}/progress", scheduler.enrollment.agentMiddleware(scheduler.ReportJobProgress)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/{id}/jobs/{job}/logs", scheduler.enrollment.agentMiddleware(scheduler.ReportJobLogs)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/{id}/trust", authMiddleware(scheduler.trust.GetAgentTrust)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/{id}/ownership", authMiddleware(scheduler.trust.SetOwnership)).Methods("PUT")
+	router.HandleFunc("/api/v1/agents/{id}/attestation", scheduler.enrollment.agentMiddleware(scheduler.trust.SubmitAttestation)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/{id}/cordon", authMiddleware(scheduler.CordonAgent)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/{id}/cordon", authMiddleware(scheduler.UncordonAgent)).Methods("DELETE")
+	router.HandleFunc("/api/v1/agents/{id}/maintenance", authMiddleware(scheduler.GetAgentMaintenance)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/{id}/maintenance", authMiddleware(scheduler.SetAgentMaintenance)).Methods("PUT")
+	router.HandleFunc("/api/v1/agents/{id}/drain", authMiddleware(scheduler.DrainAgent)).Methods("POST")
+	router.HandleFunc("/api/v1/pools/limits", authMiddleware(scheduler.ListPoolLimits)).Methods("GET")
+	router.HandleFunc("/api/v1/pools/{pool}/scale-down", authMiddleware(scheduler.ScaleDownPool)).Methods("POST")
+	router.HandleFunc("/api/v1/pools/{pool}/limit", authMiddleware(scheduler.ResetPoolLimit)).Methods("DELETE")
+	
+	// Analytics endpoints
+	router.HandleFunc("/api/v1/analytics/rightsizing", authMiddleware(scheduler.GetRightsizing)).Methods("GET")
+	router.HandleFunc("/api/v1/queue/wait-times", authMiddleware(scheduler.GetQueueWaitTimes)).Methods("GET")
+	
+	// Exec session endpoints for agents and org policy
+	router.HandleFunc("/api/v1/agents/{id}/exec-sessions", scheduler.enrollment.agentMiddleware(scheduler.exec.ListAgentExecSessions)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/{id}/exec-sessions/{session}/attach", scheduler.enrollment.agentMiddleware(scheduler.exec.AttachAgentExecSession)).Methods("GET")
+	router.HandleFunc("/api/v1/exec/policies/{org}", authMiddleware(scheduler.exec.GetExecPolicy)).Methods("GET")
+	router.HandleFunc("/api/v1/exec/policies/{org}", authMiddleware(scheduler.exec.SetExecPolicy)).Methods("PUT")
+	router.HandleFunc("/api/v1/job-policy", authMiddleware(scheduler.payloads.GetPayloadPolicy)).Methods("GET")
+	router.HandleFunc("/api/v1/job-policy", authMiddleware(scheduler.payloads.SetPayloadPolicy)).Methods("PUT")
+	
+	// Fleet config profile endpoints
+	profiles := scheduler.profiles
+	router.HandleFunc("/api/v1/config-profiles", authMiddleware(profiles.CreateProfile)).Methods("POST")
+	router.HandleFunc("/api/v1/config-profiles", authMiddleware(profiles.ListProfiles)).Methods("GET")
+	router.HandleFunc("/api/v1/config-profiles/{id}", authMiddleware(profiles.GetProfile)).Methods("GET")
+	router.HandleFunc("/api/v1/config-profiles/{id}", authMiddleware(profiles.UpdateProfile)).Methods("PUT")
+	router.HandleFunc("/api/v1/config-profiles/{id}", authMiddleware(profiles.DeleteProfile)).Methods("DELETE")
+	router.HandleFunc("/api/v1/config-profiles/{id}/rollout", authMiddleware(profiles.SetRollout)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/{id}/control", scheduler.enrollment.agentMiddleware(profiles.AgentControl)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/{id}/config", scheduler.enrollment.agentMiddleware(profiles.GetAgentConfig)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/{id}/config/status", scheduler.enrollment.agentMiddleware(profiles.ReportAgentConfig)).Methods("POST")
+	
+	// Agent enrollment; agents authenticate register and credentials with their join token and enrollment secret,
+	// and the agent side of the API with the credentials enrollment issues
+	enrollment := scheduler.enrollment
+	router.HandleFunc("/api/v1/agents/heartbeat", enrollment.agentMiddleware(scheduler.ReceiveHeartbeat)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/join-tokens", authMiddleware(enrollment.CreateJoinToken)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/join-tokens", authMiddleware(enrollment.ListJoinTokens)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/join-tokens/{id}", authMiddleware(enrollment.RevokeJoinToken)).Methods("DELETE")
+	router.HandleFunc("/api/v1/agents/register", enrollment.Register).Methods("POST")
+	router.HandleFunc("/api/v1/agents/enrollments", authMiddleware(enrollment.ListEnrollments)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/enrollments/{agent_id}/credentials", enrollment.GetCredentials).Methods("POST")
+	router.HandleFunc("/api/v1/agents/enrollments/{agent_id}/approve", authMiddleware(enrollment.ApproveEnrollment)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/enrollments/{agent_id}/reject", authMiddleware(enrollment.RejectEnrollment)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/enrollments/{agent_id}/revoke", authMiddleware(enrollment.RevokeEnrollment)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/protocol", authMiddleware(scheduler.protocols.GetProtocolReport)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/connectivity", authMiddleware(scheduler.GetConnectivityReport)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/{id}/reflect", enrollment.agentMiddleware(scheduler.ReflectAddress)).Methods("GET")
+	
+	// Remote diagnostics bundles
+	diagnostics := scheduler.diagnostics
+	router.HandleFunc("/api/v1/agents/{id}/diagnostics", authMiddleware(diagnostics.RequestDiagnostics)).Methods("POST")
+	router.HandleFunc("/api/v1/agents/{id}/diagnostics/pending", enrollment.agentMiddleware(diagnostics.ListAgentDiagnostics)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/{id}/diagnostics/{request}/bundle", enrollment.agentMiddleware(diagnostics.UploadDiagnostics)).Methods("PUT")
+	router.HandleFunc("/api/v1/agents/{id}/diagnostics/{request}/failure", enrollment.agentMiddleware(diagnostics.ReportDiagnosticsFailure)).Methods("POST")
+	router.HandleFunc("/api/v1/diagnostics", authMiddleware(diagnostics.ListDiagnostics)).Methods("GET")
+	router.HandleFunc("/api/v1/diagnostics/{id}", authMiddleware(diagnostics.GetDiagnostics)).Methods("GET")
+	router.HandleFunc("/api/v1/diagnostics/{id}/bundle", authMiddleware(diagnostics.DownloadDiagnostics)).Methods("GET")
+	
+	// Resizes agents apply to their running jobs
+	router.HandleFunc("/api/v1/agents/{id}/resizes/pending", enrollment.agentMiddleware(scheduler.resizes.ListAgentResizes)).Methods("GET")
+	router.HandleFunc("/api/v1/agents/{id}/resizes/{resize}/result", enrollment.agentMiddleware(scheduler.resizes.ReportAgentResize)).Methods("POST")
+	
+	// Federation endpoints
+	federation := scheduler.federation
+	router.HandleFunc("/api/v1/federation/regions", authMiddleware(federation.ListRegions)).Methods("GET")
+	router.HandleFunc("/api/v1/federation/capacity", federation.federationMiddleware(federation.GetCapacity)).Methods("GET")
+	router.HandleFunc("/api/v1/federation/jobs", federation.federationMiddleware(federation.AcceptForwardedJob)).Methods("POST")
+	router.HandleFunc("/api/v1/federation/jobs/{id}/result", federation.federationMiddleware(federation.ReceiveForwardedResult)).Methods("POST")
 	
 	// Setup CORS
 	c := cors.New(cors.Options{
@@ -806,8 +1303,8 @@ func main() {
 		port = "8002"
 	}
 	
-	log.Printf("Scheduler service starting on port %s", port)
+	slog.Info("Scheduler service starting", "port", port)
 	if err := http.ListenAndServe(":"+port, handler); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		obs.Fatal("Failed to start server", err)
 	}
 } 
\ No newline at end of file
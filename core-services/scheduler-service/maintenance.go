@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/computehive/core-services/pkg/maintenance"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+)
+
+// maintenanceHorizon is how far ahead upcoming maintenance is listed
+const maintenanceHorizon = 7 * 24 * time.Hour
+
+// clearOfMaintenance reports whether a job placed now keeps clear of the
+// agent's maintenance windows. No job starts during a window; jobs whose
+// SLA allows maintenance may run into one that starts later, the rest must
+// be able to finish within their timeout first.
+func clearOfMaintenance(agent *Agent, job *Job, now time.Time) bool {
+	if len(agent.Maintenance) == 0 {
+		return true
+	}
+	if maintenance.Active(agent.Maintenance, now) != nil {
+		return false
+	}
+	if job.SLARequirements != nil && job.SLARequirements.AllowMaintenance {
+		return true
+	}
+	return maintenance.Overlap(agent.Maintenance, now, now.Add(job.Timeout)) == nil
+}
+
+// GetAgentMaintenance returns an agent's maintenance windows and their
+// occurrences over the next week
+func (s *SchedulerService) GetAgentMaintenance(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	s.mu.RLock()
+	agent, exists := s.agents[agentID]
+	var windows []maintenance.Window
+	if exists {
+		windows = agent.Maintenance
+	}
+	s.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"agent_id": agentID,
+		"windows":  windows,
+		"upcoming": maintenance.Upcoming(windows, now, now.Add(maintenanceHorizon)),
+	})
+}
+
+// SetAgentMaintenance replaces an agent's maintenance windows. Only the
+// agent's owner or an admin may declare them.
+func (s *SchedulerService) SetAgentMaintenance(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	agentID := mux.Vars(r)["id"]
+
+	if claims.Role != "admin" && s.trust.owner(agentID) != claims.UserID {
+		http.Error(w, "Only the agent's owner can set its maintenance windows", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		Windows []maintenance.Window `json:"windows"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := maintenance.Validate(body.Windows); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	agent, exists := s.agents[agentID]
+	if exists {
+		agent.Maintenance = body.Windows
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Agent maintenance windows set", "agent_id", agentID, "windows", len(body.Windows), "by", claims.UserID)
+	s.publishAgentMaintenance(r.Context(), agentID, body.Windows)
+
+	now := time.Now()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"agent_id": agentID,
+		"windows":  body.Windows,
+		"upcoming": maintenance.Upcoming(body.Windows, now, now.Add(maintenanceHorizon)),
+	})
+}
+
+// publishAgentMaintenance tells the marketplace about an agent's windows, so
+// its offers and matches show them
+func (s *SchedulerService) publishAgentMaintenance(ctx context.Context, agentID string, windows []maintenance.Window) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"agent_id": agentID,
+		"windows":  windows,
+	})
+	if err := s.bus.Publish(ctx, "agent.maintenance", data); err != nil {
+		obs.LogError(ctx, "Failed to publish agent maintenance windows", err, "agent_id", agentID)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/computehive/core-services/pkg/jobspec"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PayloadPolicy rejects jobs whose payload embeds credentials, asks for host
+// access or uses a banned image, before they are queued.
+//
+// JOB_BANNED_IMAGES is a comma-separated list of image patterns banned at
+// startup, and JOB_ALLOW_PRIVILEGED=true lets payloads ask for host access;
+// admins can replace the policy at runtime.
+type PayloadPolicy struct {
+	scheduler *SchedulerService
+	policy    jobspec.Policy
+	mu        sync.RWMutex
+
+	hits *prometheus.CounterVec
+}
+
+// NewPayloadPolicy creates the payload policy from the environment
+func NewPayloadPolicy(s *SchedulerService) *PayloadPolicy {
+	p := &PayloadPolicy{
+		scheduler: s,
+		policy: jobspec.Policy{
+			AllowPrivileged: os.Getenv("JOB_ALLOW_PRIVILEGED") == "true",
+		},
+		hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_job_policy_hits_total",
+			Help: "Job payload findings that rejected a job, by rule",
+		}, []string{"rule"}),
+	}
+	for _, image := range strings.Split(os.Getenv("JOB_BANNED_IMAGES"), ",") {
+		if image = strings.TrimSpace(image); image != "" {
+			p.policy.BannedImages = append(p.policy.BannedImages, image)
+		}
+	}
+
+	prometheus.MustRegister(p.hits)
+	return p
+}
+
+// check scans a job's payload, logging and counting every finding
+func (p *PayloadPolicy) check(job *Job) error {
+	p.mu.RLock()
+	policy := p.policy
+	p.mu.RUnlock()
+
+	err := policy.CheckPayload(job.Payload)
+	var violation *jobspec.PolicyError
+	if !errors.As(err, &violation) {
+		return nil
+	}
+	for _, finding := range violation.Fields {
+		p.hits.WithLabelValues(finding.Rule).Inc()
+		slog.Warn("Job rejected by payload policy",
+			"user_id", job.UserID, "job_name", job.Name, "rule", finding.Rule, "field", finding.Field)
+	}
+	return obs.Wrap(obs.CodeInvalidArgument, err)
+}
+
+// HTTP Handlers
+
+// GetPayloadPolicy returns the payload policy (admin only)
+func (p *PayloadPolicy) GetPayloadPolicy(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	p.mu.RLock()
+	policy := p.policy
+	p.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
+
+// SetPayloadPolicy replaces the payload policy (admin only)
+func (p *PayloadPolicy) SetPayloadPolicy(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	var policy jobspec.Policy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	for _, image := range policy.BannedImages {
+		if strings.TrimSpace(image) == "" {
+			http.Error(w, "Banned image patterns must not be empty", http.StatusBadRequest)
+			return
+		}
+	}
+
+	p.mu.Lock()
+	p.policy = policy
+	p.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Job payload policy updated",
+		"banned_images", len(policy.BannedImages), "allow_privileged", policy.AllowPrivileged, "user_id", claims.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(policy)
+}
@@ -0,0 +1,527 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+)
+
+// Placement scoring factors
+const (
+	FactorCost         = "cost"         // Cheaper agents score higher
+	FactorReputation   = "reputation"   // The agent's reputation
+	FactorLocality     = "locality"     // Agents in the job's preferred or home region score higher
+	FactorLoad         = "load"         // Agents running fewer jobs score higher
+	FactorAvailability = "availability" // Agents with more free CPU score higher
+	FactorCarbon       = "carbon"       // Agents on cleaner grids score higher
+)
+
+// Built-in placement profiles
+const (
+	ProfileBalanced     = "balanced" // Used when a job names no profile
+	ProfileCheapest     = "cheapest"
+	ProfileMostReliable = "most-reliable"
+	ProfileGreenest     = "greenest"
+)
+
+// Placement settings
+const (
+	placementExplainCandidates = 5     // Agents listed in a placement explanation
+	maxPlacementExplanations   = 10000 // Explanations retained, oldest dropped first
+	maxOrgPlacementProfiles    = 20
+	carbonIntensityLabel       = "carbon_intensity" // Agent label with its grid's carbon intensity in gCO2/kWh
+	carbonUnknownScore         = 0.5                // Carbon score of agents without carbon data
+)
+
+// placementProfileName matches profile names, like job document names
+var placementProfileName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// PlacementWeights weighs the factors candidate agents are scored on.
+// Weights are relative: an agent's score is the weighted mean of its factor
+// scores, each between 0 and 1.
+type PlacementWeights struct {
+	Cost         float64 `json:"cost"`
+	Reputation   float64 `json:"reputation"`
+	Locality     float64 `json:"locality"`
+	Load         float64 `json:"load"`
+	Availability float64 `json:"availability"`
+	Carbon       float64 `json:"carbon"`
+}
+
+// of returns the weight of a factor
+func (w PlacementWeights) of(factor string) float64 {
+	switch factor {
+	case FactorCost:
+		return w.Cost
+	case FactorReputation:
+		return w.Reputation
+	case FactorLocality:
+		return w.Locality
+	case FactorLoad:
+		return w.Load
+	case FactorAvailability:
+		return w.Availability
+	case FactorCarbon:
+		return w.Carbon
+	}
+	return 0
+}
+
+func (w PlacementWeights) total() float64 {
+	return w.Cost + w.Reputation + w.Locality + w.Load + w.Availability + w.Carbon
+}
+
+// validate checks that weights are usable
+func (w PlacementWeights) validate() error {
+	for _, factor := range []string{FactorCost, FactorReputation, FactorLocality, FactorLoad, FactorAvailability, FactorCarbon} {
+		if w.of(factor) < 0 {
+			return fmt.Errorf("weight of %s must not be negative", factor)
+		}
+	}
+	if w.total() <= 0 {
+		return fmt.Errorf("at least one weight must be positive")
+	}
+	return nil
+}
+
+// PlacementProfile is a named set of scoring weights jobs select with
+// placement_profile
+type PlacementProfile struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Weights     PlacementWeights `json:"weights"`
+	OrgID       string           `json:"org_id,omitempty"` // Empty for built-in profiles
+	UpdatedBy   string           `json:"updated_by,omitempty"`
+	UpdatedAt   *time.Time       `json:"updated_at,omitempty"`
+}
+
+// builtinPlacementProfiles are available to every organization. Balanced
+// keeps the scheduler's original weights.
+var builtinPlacementProfiles = map[string]PlacementProfile{
+	ProfileBalanced: {
+		Name:        ProfileBalanced,
+		Description: "Weighs price, reputation, free capacity and load",
+		Weights:     PlacementWeights{Cost: 0.3, Reputation: 0.3, Availability: 0.2, Load: 0.2},
+	},
+	ProfileCheapest: {
+		Name:        ProfileCheapest,
+		Description: "Prefers the lowest hourly price",
+		Weights:     PlacementWeights{Cost: 0.7, Reputation: 0.1, Availability: 0.1, Load: 0.1},
+	},
+	ProfileMostReliable: {
+		Name:        ProfileMostReliable,
+		Description: "Prefers agents with the best reputation and the most headroom",
+		Weights:     PlacementWeights{Reputation: 0.6, Availability: 0.15, Load: 0.15, Cost: 0.1},
+	},
+	ProfileGreenest: {
+		Name:        ProfileGreenest,
+		Description: "Prefers agents on grids with the lowest carbon intensity",
+		Weights:     PlacementWeights{Carbon: 0.6, Cost: 0.2, Reputation: 0.1, Load: 0.1},
+	},
+}
+
+// FactorScore is one factor's part in an agent's score
+type FactorScore struct {
+	Factor       string  `json:"factor"`
+	Value        float64 `json:"value"`        // 0-1, higher is better
+	Weight       float64 `json:"weight"`       // Share of the profile's total weight
+	Contribution float64 `json:"contribution"` // Value times weight; contributions add up to the score
+	Detail       string  `json:"detail,omitempty"`
+}
+
+// AgentScore is a candidate agent's score and how it came about
+type AgentScore struct {
+	AgentID string        `json:"agent_id"`
+	Score   float64       `json:"score"`
+	Factors []FactorScore `json:"factors"`
+}
+
+// PlacementExplanation shows how an agent was chosen for a job
+type PlacementExplanation struct {
+	JobID          string           `json:"job_id,omitempty"`
+	Profile        string           `json:"profile"`
+	ProfileOrgID   string           `json:"profile_org_id,omitempty"` // Set when the organization's own profile was used
+	Weights        PlacementWeights `json:"weights"`
+	ChosenAgentID  string           `json:"chosen_agent_id,omitempty"`
+	CandidateCount int              `json:"candidate_count"` // Agents that met the job's requirements
+	Candidates     []AgentScore     `json:"candidates"`      // Best first, the chosen agent included
+	DecidedAt      time.Time        `json:"decided_at"`
+}
+
+// PlacementProfiles ranks candidate agents for jobs with named weight
+// profiles, and records why each job went where it did.
+//
+// Jobs select a profile with placement_profile, falling back to balanced.
+// Organizations may define their own profiles, which shadow built-in ones
+// of the same name for their jobs; redefining balanced changes their
+// default. Carbon intensity comes from the agent's carbon_intensity label,
+// else from PLACEMENT_CARBON_INTENSITY (location=gCO2/kWh pairs, comma
+// separated); agents with neither score neutrally on carbon.
+type PlacementProfiles struct {
+	scheduler    *SchedulerService
+	orgProfiles  map[string]map[string]*PlacementProfile // org ID -> name -> profile
+	carbon       map[string]float64                      // Location -> gCO2/kWh
+	explanations map[string]*PlacementExplanation        // by job ID
+	explained    []string                                // Job IDs in the order explained
+	mu           sync.RWMutex
+}
+
+// NewPlacementProfiles creates the placement profiles from the environment
+func NewPlacementProfiles(s *SchedulerService) *PlacementProfiles {
+	p := &PlacementProfiles{
+		scheduler:    s,
+		orgProfiles:  make(map[string]map[string]*PlacementProfile),
+		carbon:       make(map[string]float64),
+		explanations: make(map[string]*PlacementExplanation),
+	}
+	for _, pair := range strings.Split(os.Getenv("PLACEMENT_CARBON_INTENSITY"), ",") {
+		location, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			continue
+		}
+		if intensity, err := strconv.ParseFloat(value, 64); err == nil && intensity >= 0 {
+			p.carbon[location] = intensity
+		}
+	}
+	return p
+}
+
+// lookup finds the profile a job of an organization selects by name
+func (p *PlacementProfiles) lookup(orgID, name string) (PlacementProfile, bool) {
+	if name == "" {
+		name = ProfileBalanced
+	}
+	p.mu.RLock()
+	profile, custom := p.orgProfiles[orgID][name]
+	p.mu.RUnlock()
+	if custom && orgID != "" {
+		return *profile, true
+	}
+	builtin, exists := builtinPlacementProfiles[name]
+	return builtin, exists
+}
+
+// check rejects jobs that name a profile their organization does not have.
+// Jobs forwarded from another region may name that region's organization
+// profiles; they are placed with balanced here.
+func (p *PlacementProfiles) check(job *Job) error {
+	if job.HomeRegion != "" && job.HomeRegion != p.scheduler.federation.Region() {
+		return nil
+	}
+	if _, exists := p.lookup(job.OrgID, job.PlacementProfile); !exists {
+		return obs.Errorf(obs.CodeInvalidArgument, "unknown placement profile %q", job.PlacementProfile)
+	}
+	return nil
+}
+
+// resolve returns the profile a job is placed with
+func (p *PlacementProfiles) resolve(job *Job) PlacementProfile {
+	profile, exists := p.lookup(job.OrgID, job.PlacementProfile)
+	if !exists {
+		slog.Warn("Placement profile not found, using balanced", obs.KeyJobID, job.ID, "profile", job.PlacementProfile)
+		profile = builtinPlacementProfiles[ProfileBalanced]
+	}
+	return profile
+}
+
+// score rates an agent for a job, returning the weighted score and the
+// factors that made it up
+func (p *PlacementProfiles) score(agent *Agent, job *Job, weights PlacementWeights) (float64, []FactorScore) {
+	rate := p.scheduler.calculateAgentHourlyRate(agent, job)
+	availability := 0.0
+	if agent.Resources.CPU.Cores > 0 {
+		availability = float64(agent.Resources.CPU.Available) / float64(agent.Resources.CPU.Cores)
+	}
+	locality, localityDetail := p.locality(agent, job)
+	carbon, carbonDetail := p.carbonScore(agent)
+
+	factors := []FactorScore{
+		{Factor: FactorCost, Value: 1.0 / (1.0 + rate/100.0), Detail: fmt.Sprintf("%.4f per hour", rate)},
+		{Factor: FactorReputation, Value: agent.Reputation, Detail: fmt.Sprintf("reputation %.2f", agent.Reputation)},
+		{Factor: FactorLocality, Value: locality, Detail: localityDetail},
+		{Factor: FactorLoad, Value: 1.0 / (1.0 + float64(len(agent.ActiveJobs))), Detail: fmt.Sprintf("%d active jobs", len(agent.ActiveJobs))},
+		{Factor: FactorAvailability, Value: availability, Detail: fmt.Sprintf("%d of %d cores free", agent.Resources.CPU.Available, agent.Resources.CPU.Cores)},
+		{Factor: FactorCarbon, Value: carbon, Detail: carbonDetail},
+	}
+
+	total := weights.total()
+	score := 0.0
+	weighted := factors[:0]
+	for _, factor := range factors {
+		weight := weights.of(factor.Factor)
+		if weight == 0 {
+			continue
+		}
+		factor.Weight = weight / total
+		factor.Contribution = factor.Value * factor.Weight
+		score += factor.Contribution
+		weighted = append(weighted, factor)
+	}
+	return score, weighted
+}
+
+// locality scores an agent's location against the job's preferred regions,
+// earlier ones scoring higher, or else against the job's home region
+func (p *PlacementProfiles) locality(agent *Agent, job *Job) (float64, string) {
+	if job.SLARequirements != nil && len(job.SLARequirements.PreferredRegions) > 0 {
+		regions := job.SLARequirements.PreferredRegions
+		for i, region := range regions {
+			if agent.Location == region {
+				return 1 - float64(i)/float64(len(regions)), fmt.Sprintf("%s, preferred region %d of %d", agent.Location, i+1, len(regions))
+			}
+		}
+		return 0, fmt.Sprintf("%s, not a preferred region", agent.Location)
+	}
+
+	home := job.HomeRegion
+	if home == "" {
+		home = p.scheduler.federation.Region()
+	}
+	if agent.Location == home {
+		return 1, fmt.Sprintf("%s, the job's home region", agent.Location)
+	}
+	return 0, fmt.Sprintf("%s, outside home region %s", agent.Location, home)
+}
+
+// carbonScore scores an agent's grid carbon intensity
+func (p *PlacementProfiles) carbonScore(agent *Agent) (float64, string) {
+	intensity, err := strconv.ParseFloat(agent.Labels[carbonIntensityLabel], 64)
+	known := err == nil && intensity >= 0
+	if !known {
+		intensity, known = p.carbon[agent.Location]
+	}
+	if !known {
+		return carbonUnknownScore, "carbon intensity unknown"
+	}
+	return 1.0 / (1.0 + intensity/200.0), fmt.Sprintf("%.0f gCO2/kWh", intensity)
+}
+
+// explain builds the explanation of a ranking
+func (p *PlacementProfiles) explain(job *Job, ranked []scoredAgent, chosen *Agent) *PlacementExplanation {
+	profile := p.resolve(job)
+	explanation := &PlacementExplanation{
+		JobID:          job.ID,
+		Profile:        profile.Name,
+		ProfileOrgID:   profile.OrgID,
+		Weights:        profile.Weights,
+		CandidateCount: len(ranked),
+		Candidates:     []AgentScore{},
+		DecidedAt:      time.Now(),
+	}
+	if chosen != nil {
+		explanation.ChosenAgentID = chosen.ID
+	}
+	for i, candidate := range ranked {
+		// Agents ahead of the chosen one that refused the job stay listed
+		if i >= placementExplainCandidates && (chosen == nil || candidate.agent.ID != chosen.ID) {
+			continue
+		}
+		explanation.Candidates = append(explanation.Candidates, AgentScore{
+			AgentID: candidate.agent.ID,
+			Score:   candidate.score,
+			Factors: candidate.factors,
+		})
+	}
+	return explanation
+}
+
+// record keeps the explanation of a job's placement
+func (p *PlacementProfiles) record(job *Job, ranked []scoredAgent, chosen *Agent) {
+	explanation := p.explain(job, ranked, chosen)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.explanations[job.ID]; !exists {
+		p.explained = append(p.explained, job.ID)
+	}
+	p.explanations[job.ID] = explanation
+	for len(p.explained) > maxPlacementExplanations {
+		delete(p.explanations, p.explained[0])
+		p.explained = p.explained[1:]
+	}
+}
+
+// canManageOrg reports whether a caller may change an organization's
+// placement profiles
+func canManageOrg(claims *Claims, orgID string) bool {
+	return claims.Role == "admin" || (claims.OrgID != "" && claims.OrgID == orgID)
+}
+
+// HTTP Handlers
+
+// ListPlacementProfiles returns the built-in profiles and an organization's
+// own
+func (p *PlacementProfiles) ListPlacementProfiles(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	orgID := mux.Vars(r)["org"]
+	if !canManageOrg(claims, orgID) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	profiles := make([]PlacementProfile, 0, len(builtinPlacementProfiles))
+	for _, profile := range builtinPlacementProfiles {
+		profiles = append(profiles, profile)
+	}
+	p.mu.RLock()
+	for _, profile := range p.orgProfiles[orgID] {
+		profiles = append(profiles, *profile)
+	}
+	p.mu.RUnlock()
+	sort.Slice(profiles, func(i, j int) bool {
+		if profiles[i].Name != profiles[j].Name {
+			return profiles[i].Name < profiles[j].Name
+		}
+		return profiles[i].OrgID < profiles[j].OrgID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profiles)
+}
+
+// SetPlacementProfile creates or replaces one of an organization's profiles
+func (p *PlacementProfiles) SetPlacementProfile(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	vars := mux.Vars(r)
+	orgID, name := vars["org"], vars["name"]
+	if !canManageOrg(claims, orgID) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	if len(name) > 63 || !placementProfileName.MatchString(name) {
+		http.Error(w, "Profile names are lowercase letters, digits and '-' (max 63 chars)", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Description string           `json:"description"`
+		Weights     PlacementWeights `json:"weights"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Weights.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	profile := &PlacementProfile{
+		Name:        name,
+		Description: req.Description,
+		Weights:     req.Weights,
+		OrgID:       orgID,
+		UpdatedBy:   claims.UserID,
+		UpdatedAt:   &now,
+	}
+
+	p.mu.Lock()
+	if p.orgProfiles[orgID] == nil {
+		p.orgProfiles[orgID] = make(map[string]*PlacementProfile)
+	}
+	if _, exists := p.orgProfiles[orgID][name]; !exists && len(p.orgProfiles[orgID]) >= maxOrgPlacementProfiles {
+		p.mu.Unlock()
+		http.Error(w, fmt.Sprintf("An organization may have at most %d placement profiles", maxOrgPlacementProfiles), http.StatusConflict)
+		return
+	}
+	p.orgProfiles[orgID][name] = profile
+	p.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(profile)
+}
+
+// DeletePlacementProfile removes one of an organization's profiles. Queued
+// jobs that named it are placed with the built-in profile of the same name,
+// or balanced.
+func (p *PlacementProfiles) DeletePlacementProfile(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	vars := mux.Vars(r)
+	orgID, name := vars["org"], vars["name"]
+	if !canManageOrg(claims, orgID) {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	p.mu.Lock()
+	_, exists := p.orgProfiles[orgID][name]
+	delete(p.orgProfiles[orgID], name)
+	p.mu.Unlock()
+	if !exists {
+		http.Error(w, "Placement profile not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetJobPlacement explains how a job's agent was chosen
+func (p *PlacementProfiles) GetJobPlacement(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	jobID := mux.Vars(r)["id"]
+
+	s := p.scheduler
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	authorized := exists && (job.UserID == claims.UserID || claims.Role == "admin")
+	s.mu.RUnlock()
+	if !exists {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if !authorized {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	p.mu.RLock()
+	explanation, explained := p.explanations[jobID]
+	p.mu.RUnlock()
+	if !explained {
+		http.Error(w, "Job has not been placed", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(explanation)
+}
+
+// ExplainPlacement ranks the agents a job would be placed on right now,
+// without submitting it. The chosen agent is the one the scheduler would
+// offer the job first.
+func (p *PlacementProfiles) ExplainPlacement(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	job, err := decodeJobRequest(r)
+	if err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+	job.UserID = claims.UserID
+	job.OrgID = claims.OrgID
+	s := p.scheduler
+	if err := s.validateJobRequirements(job); err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+
+	ranked := s.scoreAgents(s.findSuitableAgents(job), job)
+	var chosen *Agent
+	if len(ranked) > 0 {
+		chosen = ranked[0].agent
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.explain(job, ranked, chosen))
+}
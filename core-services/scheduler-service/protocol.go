@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/computehive/core-services/pkg/protocol"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Agent protocol tracking settings
+const (
+	protocolActiveWindow   = time.Hour // Agents silent for longer are left out of the counts
+	protocolReportInterval = time.Minute
+)
+
+// ProtocolVersionCount is how many agents speak a protocol version
+type ProtocolVersionCount struct {
+	Version    int      `json:"version"`
+	Agents     int      `json:"agents"`
+	Deprecated bool     `json:"deprecated"`
+	AgentIDs   []string `json:"agent_ids,omitempty"` // Listed for deprecated versions, to find who to upgrade
+}
+
+// ProtocolReport shows which protocol versions the fleet speaks, so support
+// for old versions is only dropped once no agents need them
+type ProtocolReport struct {
+	Current         int                    `json:"current"`
+	MinVersion      int                    `json:"min_version"`
+	DeprecatedBelow int                    `json:"deprecated_below"`
+	Versions        []ProtocolVersionCount `json:"versions"`
+}
+
+// AgentProtocols negotiates protocol versions with registering agents and
+// adapts heartbeats and job results from older agents to the current
+// protocol.
+//
+// AGENT_PROTOCOL_MIN_VERSION is the oldest version still accepted; agents
+// below it cannot register and their messages are dropped. Versions below
+// AGENT_PROTOCOL_DEPRECATED_BELOW, the current version by default, still
+// work but are logged and counted, so operators can see how many agents
+// would break before raising the minimum.
+type AgentProtocols struct {
+	scheduler       *SchedulerService
+	min             int
+	deprecatedBelow int
+	versions        map[string]int // Agent ID -> version of its last message
+	mu              sync.Mutex
+
+	agents  *prometheus.GaugeVec
+	refused *prometheus.CounterVec
+}
+
+// NewAgentProtocols creates the protocol registry from the environment
+func NewAgentProtocols(s *SchedulerService) *AgentProtocols {
+	p := &AgentProtocols{
+		scheduler:       s,
+		min:             protocol.Oldest,
+		deprecatedBelow: protocol.Current,
+		versions:        make(map[string]int),
+		agents: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scheduler_agents_protocol_version",
+			Help: "Active agents by the protocol version they speak",
+		}, []string{"version", "deprecated"}),
+		refused: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scheduler_agent_protocol_refused_total",
+			Help: "Registrations and messages refused for an unsupported protocol version, by the agent's newest version",
+		}, []string{"version"}),
+	}
+	if v, err := strconv.Atoi(os.Getenv("AGENT_PROTOCOL_MIN_VERSION")); err == nil && v >= protocol.Oldest && v <= protocol.Current {
+		p.min = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("AGENT_PROTOCOL_DEPRECATED_BELOW")); err == nil && v <= protocol.Current {
+		p.deprecatedBelow = v
+	}
+	if p.deprecatedBelow < p.min {
+		p.deprecatedBelow = p.min
+	}
+
+	prometheus.MustRegister(p.agents, p.refused)
+	return p
+}
+
+// negotiate picks the protocol version a registering agent will speak and
+// returns a notice to pass on when that version is deprecated
+func (p *AgentProtocols) negotiate(offered []int) (int, string, error) {
+	version, err := protocol.Negotiate(offered, p.min, protocol.Current)
+	if err != nil {
+		newest := 1 // Agents that offer nothing predate negotiation
+		for _, v := range offered {
+			if v > newest {
+				newest = v
+			}
+		}
+		p.refused.WithLabelValues(strconv.Itoa(newest)).Inc()
+		return 0, "", obs.Wrap(obs.CodeFailedPrecondition, err)
+	}
+	return version, p.deprecation(version), nil
+}
+
+// deprecation returns the notice for agents speaking a deprecated version
+func (p *AgentProtocols) deprecation(version int) string {
+	if version >= p.deprecatedBelow {
+		return ""
+	}
+	return fmt.Sprintf("protocol version %d is deprecated and will stop being accepted; upgrade the agent to speak version %d", version, protocol.Current)
+}
+
+// accept checks the version of an agent's message and records it, warning
+// the first time an agent is seen speaking a deprecated version
+func (p *AgentProtocols) accept(ctx context.Context, agentID string, version int) error {
+	if version < p.min || version > protocol.Current {
+		p.refused.WithLabelValues(strconv.Itoa(version)).Inc()
+		return obs.Errorf(obs.CodeFailedPrecondition, "agent %s speaks protocol version %d, only %d to %d are accepted", agentID, version, p.min, protocol.Current)
+	}
+
+	p.mu.Lock()
+	previous, known := p.versions[agentID]
+	p.versions[agentID] = version
+	p.mu.Unlock()
+
+	if (!known || previous != version) && version < p.deprecatedBelow {
+		slog.WarnContext(ctx, "Agent speaks a deprecated protocol version", "agent_id", agentID, "version", version, "current", protocol.Current)
+	}
+	return nil
+}
+
+// adaptHeartbeat upgrades a heartbeat to the current protocol in place
+func (p *AgentProtocols) adaptHeartbeat(ctx context.Context, agentID string, heartbeat map[string]interface{}) error {
+	version := protocol.Version(heartbeat)
+	if err := p.accept(ctx, agentID, version); err != nil {
+		return err
+	}
+	if err := protocol.UpgradeHeartbeat(version, heartbeat); err != nil {
+		return obs.Wrap(obs.CodeInvalidArgument, err)
+	}
+	return nil
+}
+
+// adaptJobResult upgrades a job result to the current protocol in place
+func (p *AgentProtocols) adaptJobResult(ctx context.Context, result map[string]interface{}) error {
+	version := protocol.Version(result)
+	agentID, _ := result["agent_id"].(string)
+	if err := p.accept(ctx, agentID, version); err != nil {
+		return err
+	}
+	if err := protocol.UpgradeJobResult(version, result); err != nil {
+		return obs.Wrap(obs.CodeInvalidArgument, err)
+	}
+	return nil
+}
+
+// report counts the agents heard from recently by protocol version
+func (p *AgentProtocols) report(now time.Time) ProtocolReport {
+	s := p.scheduler
+	s.mu.RLock()
+	var active []string
+	for id, agent := range s.agents {
+		if now.Sub(agent.LastSeen) <= protocolActiveWindow {
+			active = append(active, id)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Strings(active)
+
+	byVersion := make(map[int]*ProtocolVersionCount)
+	p.mu.Lock()
+	for _, id := range active {
+		version, known := p.versions[id]
+		if !known {
+			continue
+		}
+		count := byVersion[version]
+		if count == nil {
+			count = &ProtocolVersionCount{Version: version, Deprecated: version < p.deprecatedBelow}
+			byVersion[version] = count
+		}
+		count.Agents++
+		if count.Deprecated {
+			count.AgentIDs = append(count.AgentIDs, id)
+		}
+	}
+	p.mu.Unlock()
+
+	report := ProtocolReport{Current: protocol.Current, MinVersion: p.min, DeprecatedBelow: p.deprecatedBelow, Versions: make([]ProtocolVersionCount, 0, len(byVersion))}
+	for _, count := range byVersion {
+		report.Versions = append(report.Versions, *count)
+	}
+	sort.Slice(report.Versions, func(i, j int) bool { return report.Versions[i].Version < report.Versions[j].Version })
+	return report
+}
+
+// run keeps the per-version agent gauge current
+func (p *AgentProtocols) run() {
+	ticker := time.NewTicker(protocolReportInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		p.agents.Reset()
+		for _, count := range p.report(now).Versions {
+			p.agents.WithLabelValues(strconv.Itoa(count.Version), strconv.FormatBool(count.Deprecated)).Set(float64(count.Agents))
+		}
+	}
+}
+
+// HTTP Handlers
+
+// GetProtocolReport shows how many agents speak each protocol version
+// (admin only)
+func (p *AgentProtocols) GetProtocolReport(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.report(time.Now()))
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// placementHistorySize is the number of recent placements kept per resource class
+const placementHistorySize = 200
+
+// QueueStatus describes where a pending job stands and when it may start
+type QueueStatus struct {
+	JobID              string     `json:"job_id"`
+	Status             string     `json:"status"`
+	Position           int        `json:"position"` // 1-based among pending jobs, 0 once placed
+	PendingJobs        int        `json:"pending_jobs"`
+	ResourceClass      string     `json:"resource_class"`
+	LimitingConstraint string     `json:"limiting_constraint,omitempty"`
+	Waited             string     `json:"waited"`
+	ETASeconds         *float64   `json:"eta_seconds,omitempty"` // nil when no estimate is possible
+	EstimatedStart     *time.Time `json:"estimated_start,omitempty"`
+	Confidence         string     `json:"confidence"` // none, low, medium, high
+	Samples            int        `json:"samples"`
+}
+
+// PlacementHistory records how long jobs waited before placement, per resource class
+type PlacementHistory struct {
+	waits map[string][]time.Duration
+	mu    sync.RWMutex
+}
+
+// NewPlacementHistory creates an empty placement history
+func NewPlacementHistory() *PlacementHistory {
+	return &PlacementHistory{waits: make(map[string][]time.Duration)}
+}
+
+// Record adds a placement wait for a resource class
+func (h *PlacementHistory) Record(class string, wait time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	waits := append(h.waits[class], wait)
+	if len(waits) > placementHistorySize {
+		waits = waits[len(waits)-placementHistorySize:]
+	}
+	h.waits[class] = waits
+}
+
+// Percentile returns the p-th percentile wait for a class and the sample count
+func (h *PlacementHistory) Percentile(class string, p float64) (time.Duration, int) {
+	h.mu.RLock()
+	waits := append([]time.Duration(nil), h.waits[class]...)
+	h.mu.RUnlock()
+
+	if len(waits) == 0 {
+		return 0, 0
+	}
+	sort.Slice(waits, func(i, j int) bool { return waits[i] < waits[j] })
+	idx := int(p * float64(len(waits)-1))
+	return waits[idx], len(waits)
+}
+
+// resourceClass buckets requirements so placement times are comparable
+func resourceClass(req ResourceRequirements) string {
+	switch {
+	case req.GPUCount > 0 && req.GPUType != "":
+		return "gpu:" + strings.ToLower(req.GPUType)
+	case req.GPUCount > 0:
+		return "gpu"
+	case req.CPUCores >= 16 || req.MemoryMB >= 64*1024:
+		return "cpu-large"
+	default:
+		return "cpu"
+	}
+}
+
+// GetQueueStatus returns queue position, limiting constraint and ETA for a job
+func (s *SchedulerService) GetQueueStatus(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	if !exists {
+		s.mu.RUnlock()
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	claims := r.Context().Value("claims").(*Claims)
+	if job.UserID != claims.UserID && claims.Role != "admin" {
+		s.mu.RUnlock()
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	status := &QueueStatus{
+		JobID:         job.ID,
+		Status:        job.Status,
+		ResourceClass: resourceClass(job.Requirements),
+		Confidence:    "none",
+	}
+
+	// Jobs ahead: higher priority, or same priority submitted earlier
+	if job.Status == "pending" {
+		position := 1
+		for _, other := range s.jobs {
+			if other.Status != "pending" {
+				continue
+			}
+			status.PendingJobs++
+			if other.ID == job.ID {
+				continue
+			}
+			if other.Priority > job.Priority ||
+				(other.Priority == job.Priority && other.CreatedAt.Before(job.CreatedAt)) {
+				position++
+			}
+		}
+		status.Position = position
+	}
+	createdAt := job.CreatedAt
+	s.mu.RUnlock()
+
+	if status.Status != "pending" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	waited := time.Since(createdAt)
+	status.Waited = waited.Round(time.Second).String()
+	status.LimitingConstraint = s.limitingConstraint(job)
+
+	// Without matching capacity, history says nothing about when it appears
+	if status.LimitingConstraint == "" {
+		p50, samples := s.placements.Percentile(status.ResourceClass, 0.5)
+		status.Samples = samples
+		if samples > 0 {
+			remaining := p50 - waited
+			if remaining < 0 {
+				remaining = 0
+			}
+			eta := remaining.Seconds()
+			start := time.Now().Add(remaining)
+			status.ETASeconds = &eta
+			status.EstimatedStart = &start
+
+			switch {
+			case samples >= 50:
+				status.Confidence = "high"
+			case samples >= 10:
+				status.Confidence = "medium"
+			default:
+				status.Confidence = "low"
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// limitingConstraint narrows the agent pool one requirement at a time, in
+// the order agentMeetsRequirements checks them, and reports the first
+// requirement that leaves no candidates
+func (s *SchedulerService) limitingConstraint(job *Job) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	candidates := make([]*Agent, 0, len(s.agents))
+	for _, agent := range s.agents {
+		if agent.Status == "active" && time.Since(agent.LastSeen) <= 2*time.Minute {
+			candidates = append(candidates, agent)
+		}
+	}
+	if len(candidates) == 0 {
+		return "no active agents"
+	}
+
+	req := job.Requirements
+	location := ""
+	if job.SLARequirements != nil && len(job.SLARequirements.PreferredRegions) > 0 {
+		location = " in " + strings.Join(job.SLARequirements.PreferredRegions, "/")
+	}
+
+	steps := []struct {
+		description string
+		fits        func(*Agent) bool
+	}{
+		{
+			"target agent is unavailable",
+			func(a *Agent) bool { return job.TargetAgentID == "" || a.ID == job.TargetAgentID },
+		},
+		{
+			fmt.Sprintf("no agent of trust tier %s or above", jobMinTrustTier(job)),
+			func(a *Agent) bool { return a.TrustTier.Meets(jobMinTrustTier(job)) },
+		},
+		{
+			"every agent is cordoned or at its pool's job limit",
+			func(a *Agent) bool { return s.acceptsNewJobs(a) },
+		},
+		{
+			"every suitable agent has planned maintenance during the run",
+			func(a *Agent) bool { return clearOfMaintenance(a, job, time.Now()) },
+		},
+		{
+			fmt.Sprintf("no agent with %d free CPU cores", req.CPUCores),
+			func(a *Agent) bool { return a.Resources.CPU.Available >= req.CPUCores },
+		},
+		{
+			fmt.Sprintf("no agent with %d MB free memory", req.MemoryMB),
+			func(a *Agent) bool { return a.Resources.Memory.AvailableMB >= req.MemoryMB },
+		},
+		{
+			fmt.Sprintf("no agent with %d free GPU(s) %s", req.GPUCount, req.GPUType),
+			func(a *Agent) bool {
+				free := 0
+				for _, gpu := range a.Resources.GPUs {
+					if !gpu.InUse && (req.GPUType == "" || gpu.Model == req.GPUType) {
+						free++
+					}
+				}
+				return free >= req.GPUCount
+			},
+		},
+		{
+			"no agent with the GPU driver or runtime versions required",
+			func(a *Agent) bool { return req.Unmet(a.Resources.GPURuntime) == "" },
+		},
+		{
+			fmt.Sprintf("no agent with %d MB free storage", req.StorageMB),
+			func(a *Agent) bool { return a.Resources.Storage.AvailableMB >= req.StorageMB },
+		},
+		{
+			fmt.Sprintf("no agent with capabilities %s", strings.Join(req.Capabilities, ",")),
+			func(a *Agent) bool {
+				for _, required := range req.Capabilities {
+					found := false
+					for _, capability := range a.Capabilities {
+						if capability == required {
+							found = true
+							break
+						}
+					}
+					if !found {
+						return false
+					}
+				}
+				return true
+			},
+		},
+		{
+			"no agent within the maximum cost per hour",
+			func(a *Agent) bool {
+				return job.SLARequirements == nil ||
+					s.calculateAgentHourlyRate(a, job) <= job.SLARequirements.MaxCostPerHour
+			},
+		},
+		{
+			"no capacity in preferred regions" + location,
+			func(a *Agent) bool {
+				if job.SLARequirements == nil || len(job.SLARequirements.PreferredRegions) == 0 {
+					return true
+				}
+				for _, region := range job.SLARequirements.PreferredRegions {
+					if a.Location == region {
+						return true
+					}
+				}
+				return false
+			},
+		},
+	}
+
+	for _, step := range steps {
+		remaining := candidates[:0:0]
+		for _, agent := range candidates {
+			if step.fits(agent) {
+				remaining = append(remaining, agent)
+			}
+		}
+		if len(remaining) == 0 {
+			return step.description
+		}
+		candidates = remaining
+	}
+
+	return ""
+}
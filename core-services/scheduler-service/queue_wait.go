@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// queueWaitHistorySize is the number of recent placements kept for the wait summary
+const queueWaitHistorySize = 5000
+
+// queueWaitSample is one job's time in queue before placement
+type queueWaitSample struct {
+	at       time.Time
+	wait     time.Duration
+	class    string
+	region   string
+	priority int
+}
+
+// QueueWaitStats records time in queue per wait class, region and priority,
+// both as a Prometheus histogram and as recent samples for the summary API
+type QueueWaitStats struct {
+	histogram *prometheus.HistogramVec
+	regions   map[string]bool // Federation regions, the only region labels besides any and other
+	samples   []queueWaitSample
+	next      int
+	mu        sync.Mutex
+}
+
+// NewQueueWaitStats creates and registers the queue wait histogram, labelled
+// by the given federation regions
+func NewQueueWaitStats(regions []string) *QueueWaitStats {
+	q := &QueueWaitStats{
+		regions: make(map[string]bool, len(regions)),
+		histogram: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scheduler_queue_wait_seconds",
+			Help:    "Time jobs spent queued before placement",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600, 7200},
+		}, []string{"resource_class", "region", "priority"}),
+		samples: make([]queueWaitSample, 0, queueWaitHistorySize),
+	}
+	for _, region := range regions {
+		q.regions[region] = true
+	}
+	prometheus.MustRegister(q.histogram)
+	return q
+}
+
+// waitClass buckets requirements into the coarse classes wait times are
+// reported by. Unlike resourceClass it ignores GPU models so the metric's
+// label set stays small.
+func waitClass(req ResourceRequirements) string {
+	switch {
+	case req.GPUCount > 1:
+		return "multi-gpu"
+	case req.GPUCount == 1:
+		return "single-gpu"
+	default:
+		return "cpu-only"
+	}
+}
+
+// waitRegion is the region a job asked for, "any" without a preference, or
+// "other" for a region outside the federation. Preferences are user input,
+// so they are not used as labels directly.
+func (q *QueueWaitStats) waitRegion(job *Job) string {
+	if job.SLARequirements == nil || len(job.SLARequirements.PreferredRegions) == 0 {
+		return "any"
+	}
+	if region := job.SLARequirements.PreferredRegions[0]; q.regions[region] {
+		return region
+	}
+	return "other"
+}
+
+// queuedAt is when a job last entered the queue. A retried job waits from
+// its requeue rather than its submission, so the time it spent running does
+// not count as queue wait. Jobs stored before enqueue times were recorded
+// fall back to their creation time.
+func queuedAt(job *Job) time.Time {
+	if job.QueuedAt.IsZero() {
+		return job.CreatedAt
+	}
+	return job.QueuedAt
+}
+
+// nearestRank is the index of the p-th percentile (0 < p <= 1) of n sorted
+// values by the nearest-rank method, the definition every percentile the
+// scheduler reports uses
+func nearestRank(n int, p float64) int {
+	return int(math.Ceil(p*float64(n))) - 1
+}
+
+// Record observes the queue wait of a job that was just placed. Callers hold
+// the scheduler lock.
+func (q *QueueWaitStats) Record(job *Job, placedAt time.Time) {
+	sample := queueWaitSample{
+		at:       placedAt,
+		wait:     placedAt.Sub(queuedAt(job)),
+		class:    waitClass(job.Requirements),
+		region:   q.waitRegion(job),
+		priority: job.Priority,
+	}
+
+	q.histogram.WithLabelValues(sample.class, sample.region, strconv.Itoa(sample.priority)).Observe(sample.wait.Seconds())
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.samples) < queueWaitHistorySize {
+		q.samples = append(q.samples, sample)
+		return
+	}
+	q.samples[q.next] = sample
+	q.next = (q.next + 1) % queueWaitHistorySize
+}
+
+// since returns the samples placed after a point in time
+func (q *QueueWaitStats) since(t time.Time) []queueWaitSample {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	samples := make([]queueWaitSample, 0, len(q.samples))
+	for _, sample := range q.samples {
+		if sample.at.After(t) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// QueueWaitSummary is the wait time of one group of jobs
+type QueueWaitSummary struct {
+	ResourceClass        string  `json:"resource_class,omitempty"`
+	Region               string  `json:"region,omitempty"`
+	Priority             *int    `json:"priority,omitempty"`
+	Placements           int     `json:"placements"`
+	P50Seconds           float64 `json:"p50_seconds"`
+	P95Seconds           float64 `json:"p95_seconds"`
+	Pending              int     `json:"pending"`
+	OldestPendingSeconds float64 `json:"oldest_pending_seconds"`
+}
+
+// GetQueueWaitTimes summarizes p50/p95 queue wait of jobs placed within a
+// window (default 1h), grouped by resource class and region and optionally
+// priority. Jobs still pending are included as a count and their oldest age,
+// since a capacity shortage shows up there before any placement completes.
+// The summary covers every user's jobs, so it is admin only.
+func (s *SchedulerService) GetQueueWaitTimes(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	window := time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		window = d
+	}
+
+	byClass, byRegion, byPriority := true, true, false
+	if v := r.URL.Query().Get("group_by"); v != "" {
+		byClass, byRegion = false, false
+		for _, field := range strings.Split(v, ",") {
+			switch strings.TrimSpace(field) {
+			case "resource_class":
+				byClass = true
+			case "region":
+				byRegion = true
+			case "priority":
+				byPriority = true
+			default:
+				http.Error(w, "group_by accepts resource_class, region and priority", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	groups := make(map[string]*QueueWaitSummary)
+	waits := make(map[string][]time.Duration)
+	group := func(class, region string, priority int) string {
+		summary := QueueWaitSummary{}
+		key := ""
+		if byClass {
+			summary.ResourceClass = class
+			key += class
+		}
+		key += "|"
+		if byRegion {
+			summary.Region = region
+			key += region
+		}
+		key += "|"
+		if byPriority {
+			p := priority
+			summary.Priority = &p
+			key += strconv.Itoa(priority)
+		}
+		if _, ok := groups[key]; !ok {
+			groups[key] = &summary
+		}
+		return key
+	}
+
+	now := time.Now()
+	for _, sample := range s.queueWaits.since(now.Add(-window)) {
+		key := group(sample.class, sample.region, sample.priority)
+		waits[key] = append(waits[key], sample.wait)
+	}
+
+	s.mu.RLock()
+	for _, job := range s.jobs {
+		if job.Status != "pending" {
+			continue
+		}
+		key := group(waitClass(job.Requirements), s.queueWaits.waitRegion(job), job.Priority)
+		summary := groups[key]
+		summary.Pending++
+		if age := now.Sub(queuedAt(job)).Seconds(); age > summary.OldestPendingSeconds {
+			summary.OldestPendingSeconds = age
+		}
+	}
+	s.mu.RUnlock()
+
+	result := make([]*QueueWaitSummary, 0, len(groups))
+	for key, summary := range groups {
+		samples := waits[key]
+		summary.Placements = len(samples)
+		if len(samples) > 0 {
+			sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+			summary.P50Seconds = samples[nearestRank(len(samples), 0.5)].Seconds()
+			summary.P95Seconds = samples[nearestRank(len(samples), 0.95)].Seconds()
+		}
+		result = append(result, summary)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.ResourceClass != b.ResourceClass {
+			return a.ResourceClass < b.ResourceClass
+		}
+		if a.Region != b.Region {
+			return a.Region < b.Region
+		}
+		return a.Priority != nil && b.Priority != nil && *a.Priority > *b.Priority
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"window": window.String(),
+		"groups": result,
+	})
+}
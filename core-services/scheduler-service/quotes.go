@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+)
+
+// marketplaceURL returns the marketplace service's base URL
+func marketplaceURL() string {
+	if url := os.Getenv("MARKETPLACE_URL"); url != "" {
+		return url
+	}
+	return "http://marketplace-service:8003"
+}
+
+// redeemQuote binds a marketplace price quote to a job and returns the
+// quoted price per hour, which settlement honors instead of market rates.
+// Only the scheduler may redeem quotes, with SERVICE_TOKEN, as it vouches
+// for the job's owner.
+func (s *SchedulerService) redeemQuote(ctx context.Context, job *Job) (float64, error) {
+	token := os.Getenv("SERVICE_TOKEN")
+	if token == "" {
+		return 0, obs.Errorf(obs.CodeUnavailable, "quotes cannot be redeemed: SERVICE_TOKEN not configured")
+	}
+	var regions []string
+	if job.SLARequirements != nil {
+		regions = job.SLARequirements.PreferredRegions
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"job_id":      job.ID,
+		"consumer_id": job.UserID,
+		"requirements": map[string]interface{}{
+			"cpu_cores":          job.Requirements.CPUCores,
+			"memory_mb":          job.Requirements.MemoryMB,
+			"gpu_count":          job.Requirements.GPUCount,
+			"gpu_type":           job.Requirements.GPUType,
+			"storage_mb":         job.Requirements.StorageMB,
+			"network_mbps":       job.Requirements.NetworkMbps,
+			"duration_hours":     job.Timeout.Hours(),
+			"regions":            regions,
+			"min_trust_tier":     jobMinTrustTier(job),
+			"min_driver_version": job.Requirements.MinDriverVersion,
+			"min_cuda_version":   job.Requirements.MinCUDAVersion,
+			"min_rocm_version":   job.Requirements.MinROCmVersion,
+		},
+	})
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/v1/quotes/%s/redeem", marketplaceURL(), job.QuoteID), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to reach marketplace: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, obs.ResponseError(resp, "quote %s rejected", job.QuoteID)
+	}
+
+	var quote struct {
+		PricePerHour string    `json:"price_per_hour"`
+		ExpiresAt    time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&quote); err != nil {
+		return 0, obs.Wrap(obs.CodeUpstream, fmt.Errorf("failed to decode quote: %w", err))
+	}
+
+	price, err := strconv.ParseFloat(quote.PricePerHour, 64)
+	if err != nil {
+		return 0, obs.Errorf(obs.CodeUpstream, "invalid quoted price %q", quote.PricePerHour)
+	}
+	return price, nil
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+)
+
+// Job resize states
+const (
+	ResizePending = "pending" // Waiting for the agent to apply it
+	ResizeApplied = "applied"
+	ResizeFailed  = "failed"
+)
+
+// resizeTimeout fails resizes the agent never reports on
+const resizeTimeout = 10 * time.Minute
+
+// ResizeResources are the resources a resize changes
+type ResizeResources struct {
+	CPUCores int `json:"cpu_cores"`
+	MemoryMB int `json:"memory_mb"`
+	GPUCount int `json:"gpu_count"`
+}
+
+// JobResize is a vertical resize of a running job
+type JobResize struct {
+	ID            string          `json:"id"`
+	JobID         string          `json:"job_id"`
+	AgentID       string          `json:"agent_id"`
+	RequestedBy   string          `json:"requested_by"`
+	From          ResizeResources `json:"from"`
+	To            ResizeResources `json:"to"`
+	Restart       bool            `json:"restart"` // Applied by restarting the job's container
+	Status        string          `json:"status"`
+	PreviousPrice float64         `json:"previous_price_per_hour"`
+	PricePerHour  float64         `json:"price_per_hour"` // After the resize: the match's, the quote's or list rates
+	Error         string          `json:"error,omitempty"`
+	RequestedAt   time.Time       `json:"requested_at"`
+	CompletedAt   *time.Time      `json:"completed_at,omitempty"`
+
+	matchID    string
+	consumerID string // The job's owner, whose match is re-priced
+}
+
+// agentResizeCommand is what the agent receives
+type agentResizeCommand struct {
+	ID       string `json:"id"`
+	JobID    string `json:"job_id"`
+	CPUCores int    `json:"cpu_cores"`
+	MemoryMB int    `json:"memory_mb"`
+	GPUCount int    `json:"gpu_count"`
+	Restart  bool   `json:"restart"`
+}
+
+// JobResizes changes the resources of running container jobs, such as
+// long-running services that need more memory or another GPU.
+//
+// A resize is checked against the free capacity of the agent hosting the
+// job, re-priced, and picked up by the agent while polling. The agent
+// updates the container in place, or restarts it when GPUs change, which
+// the requester must allow. Jobs under a marketplace match are re-priced
+// on the provider's offer; quoted jobs keep their discount on list rates.
+type JobResizes struct {
+	scheduler *SchedulerService
+	resizes   map[string]*JobResize
+	pending   map[string]string // job ID -> pending resize ID
+	mu        sync.Mutex
+}
+
+// NewJobResizes creates the resize registry
+func NewJobResizes(s *SchedulerService) *JobResizes {
+	return &JobResizes{
+		scheduler: s,
+		resizes:   make(map[string]*JobResize),
+		pending:   make(map[string]string),
+	}
+}
+
+// validateResize checks a resize of a job on an agent. Callers hold the
+// scheduler lock.
+func validateResize(job *Job, agent *Agent, to ResizeResources, allowRestart bool) error {
+	if job.Type != "docker" {
+		return obs.Errorf(obs.CodeFailedPrecondition, "only docker jobs can be resized in place")
+	}
+	if to.CPUCores <= 0 || to.MemoryMB <= 0 || to.GPUCount < 0 {
+		return obs.Errorf(obs.CodeInvalidArgument, "cpu_cores and memory_mb must be positive and gpu_count not negative")
+	}
+	from := job.Requirements
+	if to.CPUCores == from.CPUCores && to.MemoryMB == from.MemoryMB && to.GPUCount == from.GPUCount {
+		return obs.Errorf(obs.CodeInvalidArgument, "the job already has these resources")
+	}
+	if to.GPUCount != from.GPUCount && !allowRestart {
+		return obs.Errorf(obs.CodeFailedPrecondition, "changing gpu_count restarts the job's container; set allow_restart to accept the restart")
+	}
+
+	if extra := to.CPUCores - from.CPUCores; extra > agent.Resources.CPU.Available {
+		return obs.Errorf(obs.CodeResourceExhausted, "agent %s has %d free CPU cores, %d more requested", agent.ID, agent.Resources.CPU.Available, extra)
+	}
+	if extra := to.MemoryMB - from.MemoryMB; extra > agent.Resources.Memory.AvailableMB {
+		return obs.Errorf(obs.CodeResourceExhausted, "agent %s has %d MB of free memory, %d MB more requested", agent.ID, agent.Resources.Memory.AvailableMB, extra)
+	}
+	if extra := to.GPUCount - from.GPUCount; extra > 0 {
+		free := 0
+		for _, gpu := range agent.Resources.GPUs {
+			if !gpu.InUse && (from.GPUType == "" || gpu.Model == from.GPUType) {
+				free++
+			}
+		}
+		if extra > free {
+			return obs.Errorf(obs.CodeResourceExhausted, "agent %s has %d free GPUs of the job's type, %d more requested", agent.ID, free, extra)
+		}
+	}
+	return nil
+}
+
+// resizeMatch re-prices a job's marketplace match for new resources and
+// returns the match's new hourly price. It calls with SERVICE_TOKEN, never the
+// requester's credentials, so a failed resize can be undone after the
+// request is gone.
+func (j *JobResizes) resizeMatch(ctx context.Context, matchID, consumerID string, to ResizeResources) (float64, error) {
+	token := os.Getenv("SERVICE_TOKEN")
+	if token == "" {
+		return 0, obs.Errorf(obs.CodeUnavailable, "matches cannot be re-priced: SERVICE_TOKEN not configured")
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"cpu_cores":   to.CPUCores,
+		"memory_mb":   to.MemoryMB,
+		"gpu_count":   to.GPUCount,
+		"consumer_id": consumerID,
+	})
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/api/v1/matches/%s/resize", marketplaceURL(), matchID), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := j.scheduler.httpClient.Do(req)
+	if err != nil {
+		return 0, obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to reach marketplace: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, obs.ResponseError(resp, "match %s could not be re-priced", matchID)
+	}
+
+	var match struct {
+		AgreedPrice json.Number `json:"agreed_price"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&match); err != nil {
+		return 0, obs.Wrap(obs.CodeUpstream, fmt.Errorf("failed to decode match: %w", err))
+	}
+	price, err := match.AgreedPrice.Float64()
+	if err != nil {
+		return 0, obs.Errorf(obs.CodeUpstream, "invalid agreed price %q", match.AgreedPrice)
+	}
+	return price, nil
+}
+
+// hourlyPrice returns what a job costs per hour: its quoted price, or list
+// rates for its requirements
+func hourlyPrice(job *Job) float64 {
+	if job.QuotedPrice > 0 {
+		return job.QuotedPrice
+	}
+	return requirementsHourlyRate(job.Requirements)
+}
+
+// resized returns a job's requirements after a resize
+func resized(req ResourceRequirements, to ResizeResources) ResourceRequirements {
+	req.CPUCores = to.CPUCores
+	req.MemoryMB = to.MemoryMB
+	req.GPUCount = to.GPUCount
+	return req
+}
+
+// expire fails resizes the agent never reported on and returns them.
+// Callers hold j.mu.
+func (j *JobResizes) expire(now time.Time) []JobResize {
+	var expired []JobResize
+	for _, resize := range j.resizes {
+		if resize.Status == ResizePending && now.Sub(resize.RequestedAt) > resizeTimeout {
+			resize.Status = ResizeFailed
+			resize.Error = "agent did not apply the resize in time"
+			resize.CompletedAt = &now
+			delete(j.pending, resize.JobID)
+			expired = append(expired, *resize)
+		}
+	}
+	return expired
+}
+
+// failed puts back the match price of resizes that did not apply and tells
+// subscribers the job kept its resources
+func (j *JobResizes) failed(ctx context.Context, resizes []JobResize) {
+	s := j.scheduler
+	for _, resize := range resizes {
+		slog.WarnContext(ctx, "Job resize failed", "job_id", resize.JobID, "resize_id", resize.ID, "reason", resize.Error)
+		if resize.matchID != "" {
+			if _, err := j.resizeMatch(ctx, resize.matchID, resize.consumerID, resize.From); err != nil {
+				obs.LogError(ctx, "Failed to restore match price after a failed resize", err, "job_id", resize.JobID, "match_id", resize.matchID)
+			}
+		}
+
+		s.mu.RLock()
+		job, exists := s.jobs[resize.JobID]
+		var snapshot Job
+		if exists {
+			snapshot = *job
+		}
+		s.mu.RUnlock()
+		if exists {
+			s.publishJobEvent(ctx, "job.resize_failed", &snapshot)
+		}
+	}
+}
+
+// HTTP Handlers
+
+// ResizeJob asks for a running job's resources to change. Fields left out
+// keep their current value.
+func (j *JobResizes) ResizeJob(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	jobID := mux.Vars(r)["id"]
+
+	var body struct {
+		CPUCores     int  `json:"cpu_cores"`
+		MemoryMB     int  `json:"memory_mb"`
+		GPUCount     *int `json:"gpu_count"`
+		AllowRestart bool `json:"allow_restart"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	s := j.scheduler
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	if !exists {
+		s.mu.RUnlock()
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if job.UserID != claims.UserID && claims.Role != "admin" {
+		s.mu.RUnlock()
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+	agent, assigned := s.agents[job.AssignedAgentID]
+	if !assigned || job.CompletedAt != nil || (job.Status != "scheduled" && job.Status != "running") {
+		s.mu.RUnlock()
+		http.Error(w, "Job is not running", http.StatusConflict)
+		return
+	}
+
+	from := ResizeResources{CPUCores: job.Requirements.CPUCores, MemoryMB: job.Requirements.MemoryMB, GPUCount: job.Requirements.GPUCount}
+	to := from
+	if body.CPUCores != 0 {
+		to.CPUCores = body.CPUCores
+	}
+	if body.MemoryMB != 0 {
+		to.MemoryMB = body.MemoryMB
+	}
+	if body.GPUCount != nil {
+		to.GPUCount = *body.GPUCount
+	}
+	err := validateResize(job, agent, to, body.AllowRestart)
+	resize := &JobResize{
+		ID:            generateID(),
+		JobID:         job.ID,
+		AgentID:       agent.ID,
+		RequestedBy:   claims.UserID,
+		From:          from,
+		To:            to,
+		Restart:       to.GPUCount != from.GPUCount,
+		Status:        ResizePending,
+		PreviousPrice: hourlyPrice(job),
+		RequestedAt:   time.Now(),
+		matchID:       job.MatchID,
+		consumerID:    job.UserID,
+	}
+	if job.QuotedPrice > 0 {
+		resize.PricePerHour = job.QuotedPrice * requirementsHourlyRate(resized(job.Requirements, to)) / requirementsHourlyRate(job.Requirements)
+	} else {
+		resize.PricePerHour = requirementsHourlyRate(resized(job.Requirements, to))
+	}
+	s.mu.RUnlock()
+	if err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+
+	j.mu.Lock()
+	if _, busy := j.pending[jobID]; busy {
+		j.mu.Unlock()
+		http.Error(w, "A resize of this job is already in progress", http.StatusConflict)
+		return
+	}
+	j.pending[jobID] = resize.ID
+	j.mu.Unlock()
+
+	// The provider agrees the new price before anything changes on the agent
+	if resize.matchID != "" {
+		price, err := j.resizeMatch(r.Context(), resize.matchID, resize.consumerID, to)
+		if err != nil {
+			j.mu.Lock()
+			delete(j.pending, jobID)
+			j.mu.Unlock()
+			obs.WriteError(w, r, err)
+			return
+		}
+		resize.PricePerHour = price
+	}
+
+	j.mu.Lock()
+	j.resizes[resize.ID] = resize
+	view := *resize
+	j.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Job resize requested", "job_id", jobID, "agent_id", view.AgentID, "resize_id", view.ID,
+		"cpu_cores", to.CPUCores, "memory_mb", to.MemoryMB, "gpu_count", to.GPUCount, "restart", view.Restart)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(view)
+}
+
+// ListJobResizes lists a job's resizes, newest first
+func (j *JobResizes) ListJobResizes(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	jobID := mux.Vars(r)["id"]
+
+	s := j.scheduler
+	s.mu.RLock()
+	job, exists := s.jobs[jobID]
+	owner := exists && (job.UserID == claims.UserID || claims.Role == "admin")
+	s.mu.RUnlock()
+	if !exists {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if !owner {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	j.mu.Lock()
+	expired := j.expire(time.Now())
+	resizes := make([]JobResize, 0)
+	for _, resize := range j.resizes {
+		if resize.JobID == jobID {
+			resizes = append(resizes, *resize)
+		}
+	}
+	j.mu.Unlock()
+	go j.failed(context.Background(), expired)
+
+	sort.Slice(resizes, func(a, b int) bool {
+		return resizes[a].RequestedAt.After(resizes[b].RequestedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resizes)
+}
+
+// ListAgentResizes returns the resizes an agent has yet to apply
+func (j *JobResizes) ListAgentResizes(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	j.mu.Lock()
+	expired := j.expire(time.Now())
+	commands := make([]agentResizeCommand, 0)
+	for _, resize := range j.resizes {
+		if resize.AgentID == agentID && resize.Status == ResizePending {
+			commands = append(commands, agentResizeCommand{
+				ID:       resize.ID,
+				JobID:    resize.JobID,
+				CPUCores: resize.To.CPUCores,
+				MemoryMB: resize.To.MemoryMB,
+				GPUCount: resize.To.GPUCount,
+				Restart:  resize.Restart,
+			})
+		}
+	}
+	j.mu.Unlock()
+	go j.failed(context.Background(), expired)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commands)
+}
+
+// ReportAgentResize records whether an agent applied a resize. Applied
+// resizes update the job's requirements and price.
+func (j *JobResizes) ReportAgentResize(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var body struct {
+		Applied bool   `json:"applied"`
+		Error   string `json:"error"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	j.mu.Lock()
+	resize, exists := j.resizes[vars["resize"]]
+	if !exists || resize.AgentID != vars["id"] || resize.Status != ResizePending {
+		j.mu.Unlock()
+		http.Error(w, "Resize not found", http.StatusNotFound)
+		return
+	}
+	resize.CompletedAt = &now
+	delete(j.pending, resize.JobID)
+	if !body.Applied {
+		resize.Status = ResizeFailed
+		resize.Error = body.Error
+		view := *resize
+		j.mu.Unlock()
+
+		j.failed(r.Context(), []JobResize{view})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	resize.Status = ResizeApplied
+	view := *resize
+	j.mu.Unlock()
+
+	s := j.scheduler
+	s.mu.Lock()
+	job, exists := s.jobs[view.JobID]
+	var snapshot Job
+	if exists {
+		job.Requirements = resized(job.Requirements, view.To)
+		if job.QuotedPrice > 0 {
+			job.QuotedPrice = view.PricePerHour
+		}
+		job.EstimatedCost = s.estimateJobCost(job)
+		snapshot = *job
+	}
+	s.mu.Unlock()
+
+	slog.InfoContext(r.Context(), "Job resized", "job_id", view.JobID, "agent_id", view.AgentID, "resize_id", view.ID,
+		"cpu_cores", view.To.CPUCores, "memory_mb", view.To.MemoryMB, "gpu_count", view.To.GPUCount,
+		"price_per_hour", view.PricePerHour)
+	if exists {
+		s.publishJobEvent(r.Context(), "job.resized", &snapshot)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/computehive/core-services/pkg/trust"
+	"github.com/gorilla/mux"
+)
+
+// Attestation settings
+const (
+	defaultAttestationTTL = 24 * time.Hour
+	attestationTimeout    = 10 * time.Second
+	trustRecheckInterval  = time.Minute // Catches attestations expiring
+)
+
+// AgentTrust is an agent's trust tier and the evidence it was computed from
+type AgentTrust struct {
+	AgentID      string          `json:"agent_id"`
+	Tier         trust.Tier      `json:"tier"`
+	Ownership    trust.Ownership `json:"ownership"`
+	OwnerID      string          `json:"owner_id,omitempty"`
+	Reputation   float64         `json:"reputation"`
+	JobsFinished int             `json:"jobs_finished"`
+	Attestation  *Attestation    `json:"attestation,omitempty"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+
+	jobsCompleted int
+}
+
+// Attestation is a verified report that an agent runs jobs inside a TEE
+type Attestation struct {
+	TEE         string    `json:"tee"` // sgx, sev-snp, tdx
+	Measurement string    `json:"measurement"`
+	VerifiedAt  time.Time `json:"verified_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// current reports whether the attestation is still valid
+func (a *Attestation) current(now time.Time) bool {
+	return a != nil && now.Before(a.ExpiresAt)
+}
+
+// TrustRegistry computes agent trust tiers from ownership records set by
+// admins, the share of accepted jobs agents finish, and TEE attestations
+// checked by an external verifier against the measurements admins trust.
+// Tier changes are applied to the agent for placement and published as
+// agent.trust for the marketplace.
+type TrustRegistry struct {
+	scheduler    *SchedulerService
+	verifierURL  string          // ATTESTATION_VERIFIER_URL; attestations are refused without it
+	measurements map[string]bool // TEE_TRUSTED_MEASUREMENTS
+	ttl          time.Duration
+	agents       map[string]*AgentTrust
+	mu           sync.Mutex
+}
+
+// NewTrustRegistry creates the trust registry from the environment
+func NewTrustRegistry(s *SchedulerService) *TrustRegistry {
+	t := &TrustRegistry{
+		scheduler:    s,
+		verifierURL:  strings.TrimSuffix(os.Getenv("ATTESTATION_VERIFIER_URL"), "/"),
+		measurements: make(map[string]bool),
+		ttl:          defaultAttestationTTL,
+		agents:       make(map[string]*AgentTrust),
+	}
+	for _, measurement := range strings.Split(os.Getenv("TEE_TRUSTED_MEASUREMENTS"), ",") {
+		if measurement = strings.ToLower(strings.TrimSpace(measurement)); measurement != "" {
+			t.measurements[measurement] = true
+		}
+	}
+	if d, err := time.ParseDuration(os.Getenv("TEE_ATTESTATION_TTL")); err == nil && d > 0 {
+		t.ttl = d
+	}
+	return t
+}
+
+// record returns an agent's trust record, creating it; callers hold t.mu
+func (t *TrustRegistry) record(agentID string) *AgentTrust {
+	record, exists := t.agents[agentID]
+	if !exists {
+		record = &AgentTrust{
+			AgentID:    agentID,
+			Tier:       trust.Community,
+			Ownership:  trust.OwnershipUnverified,
+			Reputation: reputation(0, 0),
+			UpdatedAt:  time.Now(),
+		}
+		t.agents[agentID] = record
+	}
+	return record
+}
+
+// reputation is the share of finished jobs an agent completed, smoothed so
+// an agent needs a track record before it counts as reliable
+func reputation(completed, finished int) float64 {
+	return float64(completed+1) / float64(finished+2)
+}
+
+// update recomputes an agent's tier after its evidence changed, applies it
+// to the agent and publishes it if the tier or owner changed
+func (t *TrustRegistry) update(ctx context.Context, agentID string, change func(*AgentTrust)) AgentTrust {
+	now := time.Now()
+
+	t.mu.Lock()
+	record := t.record(agentID)
+	previousOwner := record.OwnerID
+	change(record)
+	previous := record.Tier
+	record.Tier = trust.Compute(trust.Evidence{
+		Ownership:  record.Ownership,
+		Reputation: record.Reputation,
+		Attested:   record.Attestation.current(now),
+	})
+	record.UpdatedAt = now
+	snapshot := *record
+	t.mu.Unlock()
+
+	t.scheduler.mu.Lock()
+	if agent, exists := t.scheduler.agents[agentID]; exists {
+		agent.TrustTier = snapshot.Tier
+		agent.Reputation = snapshot.Reputation
+	}
+	t.scheduler.mu.Unlock()
+
+	if snapshot.Tier != previous {
+		slog.InfoContext(ctx, "Agent trust tier changed", "agent_id", agentID, "from", previous, "to", snapshot.Tier)
+	}
+	if snapshot.Tier != previous || snapshot.OwnerID != previousOwner {
+		t.publish(ctx, snapshot)
+	}
+	return snapshot
+}
+
+func (t *TrustRegistry) publish(ctx context.Context, record AgentTrust) {
+	data, _ := json.Marshal(record)
+	if err := t.scheduler.bus.Publish(ctx, "agent.trust", data); err != nil {
+		obs.LogError(ctx, "Failed to publish agent trust", err, "agent_id", record.AgentID)
+	}
+}
+
+// tier returns an agent's current tier; callers may hold the scheduler lock
+func (t *TrustRegistry) tier(agentID string) trust.Tier {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.record(agentID).Tier
+}
+
+// owner returns the user an agent belongs to, or "" if ownership was never
+// set
+func (t *TrustRegistry) owner(agentID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if record, exists := t.agents[agentID]; exists {
+		return record.OwnerID
+	}
+	return ""
+}
+
+// recordOutcome counts a finished job toward its agent's reputation
+func (t *TrustRegistry) recordOutcome(ctx context.Context, agentID, status string) {
+	if agentID == "" || (status != "completed" && status != "failed") {
+		return
+	}
+	t.update(ctx, agentID, func(record *AgentTrust) {
+		record.JobsFinished++
+		if status == "completed" {
+			record.jobsCompleted++
+		}
+		record.Reputation = reputation(record.jobsCompleted, record.JobsFinished)
+	})
+}
+
+// run demotes agents whose attestation expired
+func (t *TrustRegistry) run() {
+	ticker := time.NewTicker(trustRecheckInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		var expired []string
+		t.mu.Lock()
+		for agentID, record := range t.agents {
+			if record.Attestation != nil && !record.Attestation.current(now) {
+				expired = append(expired, agentID)
+			}
+		}
+		t.mu.Unlock()
+
+		for _, agentID := range expired {
+			t.update(context.Background(), agentID, func(record *AgentTrust) {
+				record.Attestation = nil
+			})
+		}
+	}
+}
+
+// jobMinTrustTier is the least trusted tier a job may run on. Trusted
+// execution needs an attested TEE.
+func jobMinTrustTier(job *Job) trust.Tier {
+	tier, _ := trust.Parse(job.Requirements.MinTrustTier)
+	if job.Requirements.TrustedExec {
+		tier = trust.Max(tier, trust.TEEAttested)
+	}
+	return tier
+}
+
+// verifyAttestation has the verifier check a TEE report and returns the
+// measurement it vouches for
+func (t *TrustRegistry) verifyAttestation(ctx context.Context, agentID, tee, report string) (string, error) {
+	body, _ := json.Marshal(map[string]string{
+		"agent_id": agentID,
+		"tee":      tee,
+		"report":   report,
+	})
+
+	ctx, cancel := context.WithTimeout(ctx, attestationTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", t.verifierURL+"/verify", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.scheduler.httpClient.Do(req)
+	if err != nil {
+		return "", obs.Wrap(obs.CodeUnavailable, fmt.Errorf("failed to reach attestation verifier: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", obs.ResponseError(resp, "attestation verification failed")
+	}
+
+	var result struct {
+		Verified    bool   `json:"verified"`
+		Measurement string `json:"measurement"`
+		Reason      string `json:"reason,omitempty"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", obs.Wrap(obs.CodeUpstream, fmt.Errorf("failed to decode attestation verdict: %w", err))
+	}
+	if !result.Verified {
+		return "", obs.Errorf(obs.CodePermissionDenied, "attestation rejected: %s", result.Reason)
+	}
+	return strings.ToLower(result.Measurement), nil
+}
+
+// SubmitAttestation takes a TEE report from an agent. A report the verifier
+// accepts, for a measurement admins trust, makes the agent attested until
+// TEE_ATTESTATION_TTL passes; agents re-attest before then.
+func (t *TrustRegistry) SubmitAttestation(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	var body struct {
+		TEE    string `json:"tee"`
+		Report string `json:"report"` // Base64 report or quote, as the TEE produced it
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	switch body.TEE {
+	case "sgx", "sev-snp", "tdx":
+	default:
+		http.Error(w, "tee must be sgx, sev-snp or tdx", http.StatusBadRequest)
+		return
+	}
+	if body.Report == "" {
+		http.Error(w, "report is required", http.StatusBadRequest)
+		return
+	}
+
+	t.scheduler.mu.RLock()
+	_, known := t.scheduler.agents[agentID]
+	t.scheduler.mu.RUnlock()
+	if !known {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	if t.verifierURL == "" {
+		http.Error(w, "Attestation is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	measurement, err := t.verifyAttestation(r.Context(), agentID, body.TEE, body.Report)
+	if err == nil && !t.measurements[measurement] {
+		err = obs.Errorf(obs.CodePermissionDenied, "measurement %s is not trusted", measurement)
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "Agent attestation refused", "agent_id", agentID, "tee", body.TEE, obs.KeyError, err)
+		obs.WriteError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	record := t.update(r.Context(), agentID, func(record *AgentTrust) {
+		record.Attestation = &Attestation{
+			TEE:         body.TEE,
+			Measurement: measurement,
+			VerifiedAt:  now,
+			ExpiresAt:   now.Add(t.ttl),
+		}
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// SetOwnership records who operates an agent, as checked by an admin
+func (t *TrustRegistry) SetOwnership(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+	agentID := mux.Vars(r)["id"]
+
+	var body struct {
+		Ownership string `json:"ownership"`
+		OwnerID   string `json:"owner_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	ownership, err := trust.ParseOwnership(body.Ownership)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t.scheduler.mu.RLock()
+	_, known := t.scheduler.agents[agentID]
+	t.scheduler.mu.RUnlock()
+	if !known {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	record := t.update(r.Context(), agentID, func(record *AgentTrust) {
+		record.Ownership = ownership
+		record.OwnerID = body.OwnerID
+	})
+	slog.InfoContext(r.Context(), "Agent ownership set", "agent_id", agentID, "ownership", ownership, "owner_id", body.OwnerID, "by", claims.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// GetAgentTrust returns an agent's trust tier and the evidence behind it
+func (t *TrustRegistry) GetAgentTrust(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["id"]
+
+	t.scheduler.mu.RLock()
+	_, known := t.scheduler.agents[agentID]
+	t.scheduler.mu.RUnlock()
+	if !known {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	t.mu.Lock()
+	record := *t.record(agentID)
+	t.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
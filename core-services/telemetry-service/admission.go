@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Ingestion priority classes, highest first
+const (
+	PriorityCritical = "critical" // Heartbeats, job events and metrics alert rules watch
+	PriorityStandard = "standard"
+	PriorityVerbose  = "verbose" // Debug and per-process detail, shed first
+)
+
+// Ingestion sources
+const (
+	SourceHTTP     = "http"     // Can be told to retry later
+	SourceNATS     = "nats"     // Cannot push back; overflow is spilled or shed
+	SourceInternal = "internal" // Metrics the service derives itself
+)
+
+// Ingestion admission settings
+const (
+	defaultIngestCapacity = 200000 // Points held in memory, queued or being written
+	defaultSpillMaxMB     = 1024
+	spillFilePoints       = 5000 // Points per spill file, replayed a file at a time
+	replayWatermark       = 0.25 // Spilled points are replayed while the buffer is below this fill
+	flushThreshold        = 5000 // Queued points that trigger a flush before the next tick
+)
+
+// ingestPriorities lists the priority classes, highest first
+var ingestPriorities = []string{PriorityCritical, PriorityStandard, PriorityVerbose}
+
+// criticalMetricPrefixes name the metrics ingested as critical
+var criticalMetricPrefixes = []string{"agent.heartbeat", "job.", "events.dead_letters"}
+
+// AdmissionStatus shows how far ingestion is behind and what it is shedding
+type AdmissionStatus struct {
+	Capacity      int                `json:"capacity"`
+	Queued        map[string]int     `json:"queued"` // by priority
+	Writing       int                `json:"writing"`
+	Fill          float64            `json:"fill"`
+	Watermarks    map[string]float64 `json:"watermarks"`
+	OverWatermark []string           `json:"over_watermark"` // Priorities no longer buffered in memory
+	SpillFiles    int                `json:"spill_files"`
+	SpillBytes    int64              `json:"spill_bytes"`
+	SpillMaxBytes int64              `json:"spill_max_bytes"`
+	RetryAfter    int                `json:"retry_after_seconds"`
+}
+
+// spillFile is a batch of points spilled to disk
+type spillFile struct {
+	path string
+	size int64
+}
+
+// IngestBuffer holds ingested metric points until they are written, with
+// admission control so a database that falls behind cannot run the service
+// out of memory.
+//
+// Every point has a priority class, derived from its name by the service
+// alone so clients cannot promote their own points: heartbeats, job events and metrics alert rules watch are critical,
+// names matching TELEMETRY_VERBOSE_PREFIXES (default "debug.,process.") are
+// verbose, the rest standard. Each class has a watermark, a fill of the
+// buffer's TELEMETRY_INGEST_CAPACITY points above which it is no longer
+// buffered in memory: verbose at TELEMETRY_VERBOSE_WATERMARK (default 0.5),
+// standard at TELEMETRY_STANDARD_WATERMARK (default 0.8), critical when full.
+//
+// Over its watermark, a point from HTTP ingestion is refused with a 429 and
+// Retry-After, except critical points, which are spilled to disk. Points
+// from sources that cannot retry are spilled, verbose ones shed. Spill files
+// live in TELEMETRY_SPILL_DIR up to TELEMETRY_SPILL_MAX_MB, survive restarts,
+// and are replayed oldest first once the buffer drains; batches the database
+// rejects are spilled too. With the spill full, points are refused or shed.
+type IngestBuffer struct {
+	service         *TelemetryService
+	capacity        int
+	watermarks      map[string]float64
+	verbosePrefixes []string
+	queued          map[string][]*MetricPoint // by priority
+	writing         int                       // Points taken by the flush in progress
+	flushing        bool
+	spillDir        string
+	spillMaxBytes   int64
+	spillBytes      int64
+	spillFiles      []spillFile // Oldest first
+	spillSeq        int
+	mu              sync.Mutex
+
+	points        *prometheus.CounterVec
+	fill          prometheus.Gauge
+	spillSize     prometheus.Gauge
+	overWatermark *prometheus.GaugeVec
+}
+
+// NewIngestBuffer creates the ingestion buffer from the environment and
+// adopts points spilled before a restart
+func NewIngestBuffer(s *TelemetryService) *IngestBuffer {
+	spillDir := os.Getenv("TELEMETRY_SPILL_DIR")
+	if spillDir == "" {
+		spillDir = filepath.Join(os.TempDir(), "telemetry-spill")
+	}
+	verbose := os.Getenv("TELEMETRY_VERBOSE_PREFIXES")
+	if verbose == "" {
+		verbose = "debug.,process."
+	}
+
+	b := &IngestBuffer{
+		service:  s,
+		capacity: envInt("TELEMETRY_INGEST_CAPACITY", defaultIngestCapacity),
+		watermarks: map[string]float64{
+			PriorityCritical: 1,
+			PriorityStandard: envFraction("TELEMETRY_STANDARD_WATERMARK", 0.8),
+			PriorityVerbose:  envFraction("TELEMETRY_VERBOSE_WATERMARK", 0.5),
+		},
+		queued:        make(map[string][]*MetricPoint),
+		spillDir:      spillDir,
+		spillMaxBytes: int64(envInt("TELEMETRY_SPILL_MAX_MB", defaultSpillMaxMB)) << 20,
+		points: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_ingest_points_total",
+			Help: "Ingested metric points by priority and outcome: buffered, spilled, refused (429), shed (dropped) or replayed",
+		}, []string{"source", "priority", "result"}),
+		fill: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "telemetry_ingest_buffer_fill",
+			Help: "Fraction of the ingestion buffer's capacity in use",
+		}),
+		spillSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "telemetry_ingest_spill_bytes",
+			Help: "Bytes of metric points spilled to disk awaiting replay",
+		}),
+		overWatermark: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "telemetry_ingest_over_watermark",
+			Help: "1 while points of a priority are over their watermark and deferred or shed",
+		}, []string{"priority"}),
+	}
+	for _, prefix := range strings.Split(verbose, ",") {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			b.verbosePrefixes = append(b.verbosePrefixes, prefix)
+		}
+	}
+	if b.watermarks[PriorityVerbose] > b.watermarks[PriorityStandard] {
+		b.watermarks[PriorityVerbose] = b.watermarks[PriorityStandard]
+	}
+	prometheus.MustRegister(b.points, b.fill, b.spillSize, b.overWatermark)
+
+	if err := b.adoptSpill(); err != nil {
+		slog.Error("Failed to read spilled metrics", "dir", spillDir, obs.KeyError, err)
+	}
+	return b
+}
+
+// envFraction reads a fraction between 0 and 1
+func envFraction(name string, fallback float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && v > 0 && v <= 1 {
+		return v
+	}
+	return fallback
+}
+
+// priority returns a point's priority class
+func (b *IngestBuffer) priority(point *MetricPoint, alerted map[string]bool) string {
+	if alerted[point.Name] {
+		return PriorityCritical
+	}
+	for _, prefix := range criticalMetricPrefixes {
+		if strings.HasPrefix(point.Name, prefix) {
+			return PriorityCritical
+		}
+	}
+	for _, prefix := range b.verbosePrefixes {
+		if strings.HasPrefix(point.Name, prefix) {
+			return PriorityVerbose
+		}
+	}
+	return PriorityStandard
+}
+
+// alertedMetrics returns the names of metrics alert rules watch
+func (s *TelemetryService) alertedMetrics() map[string]bool {
+	s.alertMu.RLock()
+	defer s.alertMu.RUnlock()
+	names := make(map[string]bool, len(s.alerts))
+	for _, alert := range s.alerts {
+		names[alert.MetricName] = true
+	}
+	return names
+}
+
+// inMemory returns the points queued and being written. Callers hold the lock.
+func (b *IngestBuffer) inMemory() int {
+	total := b.writing
+	for _, points := range b.queued {
+		total += len(points)
+	}
+	return total
+}
+
+// admits reports whether one more point of a priority fits in memory.
+// Callers hold the lock.
+func (b *IngestBuffer) admits(priority string, inMemory int) bool {
+	limit := int(float64(b.capacity) * b.watermarks[priority])
+	return inMemory < limit
+}
+
+// Add buffers points, spilling or shedding what is over its watermark. It
+// returns the indices of the points HTTP clients should resend later, in
+// order; other sources never get points back.
+func (b *IngestBuffer) Add(points []*MetricPoint, source string) []int {
+	if len(points) == 0 {
+		return nil
+	}
+	alerted := b.service.alertedMetrics()
+
+	b.mu.Lock()
+	inMemory := b.inMemory()
+	var spill []*MetricPoint
+	var spillIndices, refused []int
+	spillPriorities := make(map[string]int)
+	counts := make(map[string]map[string]int) // priority -> result -> points
+	count := func(priority, result string, n int) {
+		if counts[priority] == nil {
+			counts[priority] = make(map[string]int)
+		}
+		counts[priority][result] += n
+	}
+	for i, point := range points {
+		priority := b.priority(point, alerted)
+		switch {
+		case b.admits(priority, inMemory):
+			b.queued[priority] = append(b.queued[priority], point)
+			inMemory++
+			count(priority, "buffered", 1)
+		case source == SourceHTTP && priority != PriorityCritical:
+			count(priority, "refused", 1)
+			refused = append(refused, i)
+		case source != SourceHTTP && priority == PriorityVerbose:
+			count(priority, "shed", 1)
+		default:
+			spill = append(spill, point)
+			spillIndices = append(spillIndices, i)
+			spillPriorities[priority]++
+		}
+	}
+	if len(spill) > 0 {
+		if err := b.spill(spill); err != nil {
+			slog.Warn("Failed to spill metrics", "points", len(spill), obs.KeyError, err)
+			result := "shed"
+			if source == SourceHTTP {
+				result = "refused"
+				refused = append(refused, spillIndices...)
+				sort.Ints(refused)
+			}
+			for priority, n := range spillPriorities {
+				count(priority, result, n)
+			}
+		} else {
+			for priority, n := range spillPriorities {
+				count(priority, "spilled", n)
+			}
+		}
+	}
+	flush := len(b.queued[PriorityCritical])+len(b.queued[PriorityStandard])+len(b.queued[PriorityVerbose]) >= flushThreshold
+	b.updateGauges(inMemory)
+	b.mu.Unlock()
+
+	for priority, results := range counts {
+		for result, n := range results {
+			b.points.WithLabelValues(source, priority, result).Add(float64(n))
+		}
+	}
+	if flush {
+		go b.service.flushBuffer()
+	}
+	return refused
+}
+
+// take hands the queued points to a flush, critical first. It returns nil
+// while another flush is writing.
+func (b *IngestBuffer) take() []*MetricPoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.flushing {
+		return nil
+	}
+	var batch []*MetricPoint
+	for _, priority := range ingestPriorities {
+		batch = append(batch, b.queued[priority]...)
+		b.queued[priority] = nil
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	b.flushing = true
+	b.writing = len(batch)
+	return batch
+}
+
+// done ends a flush. A batch the database did not take is spilled for a
+// later attempt rather than lost.
+func (b *IngestBuffer) done(batch []*MetricPoint, written bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushing = false
+	b.writing = 0
+	if !written {
+		if err := b.spill(batch); err != nil {
+			slog.Error("Failed to spill unwritten metrics, dropping them", "points", len(batch), obs.KeyError, err)
+			b.points.WithLabelValues(SourceInternal, "all", "shed").Add(float64(len(batch)))
+		} else {
+			b.points.WithLabelValues(SourceInternal, "all", "spilled").Add(float64(len(batch)))
+		}
+	}
+	b.updateGauges(b.inMemory())
+}
+
+// replay moves spilled points back into the buffer, oldest first, while it
+// has drained below the replay watermark
+func (b *IngestBuffer) replay() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.spillFiles) > 0 {
+		inMemory := b.inMemory()
+		if float64(inMemory+spillFilePoints) > float64(b.capacity)*replayWatermark {
+			break
+		}
+		file := b.spillFiles[0]
+		points, err := readSpillFile(file.path)
+		if err != nil {
+			slog.Error("Failed to read spilled metrics, dropping them", "file", file.path, obs.KeyError, err)
+		}
+		os.Remove(file.path)
+		b.spillFiles = b.spillFiles[1:]
+		b.spillBytes -= file.size
+
+		// Replayed points were admitted once; they only wait their turn
+		for _, point := range points {
+			b.queued[PriorityStandard] = append(b.queued[PriorityStandard], point)
+		}
+		b.points.WithLabelValues(SourceInternal, "all", "replayed").Add(float64(len(points)))
+	}
+	b.updateGauges(b.inMemory())
+}
+
+// spill writes points to disk in files of at most spillFilePoints. Callers
+// hold the lock.
+func (b *IngestBuffer) spill(points []*MetricPoint) error {
+	if err := os.MkdirAll(b.spillDir, 0700); err != nil {
+		return err
+	}
+	for start := 0; start < len(points); start += spillFilePoints {
+		end := start + spillFilePoints
+		if end > len(points) {
+			end = len(points)
+		}
+
+		var data bytes.Buffer
+		encoder := json.NewEncoder(&data)
+		for _, point := range points[start:end] {
+			if err := encoder.Encode(point); err != nil {
+				return err
+			}
+		}
+		size := int64(data.Len())
+		if b.spillBytes+size > b.spillMaxBytes {
+			return fmt.Errorf("spill directory holds its maximum of %d MB", b.spillMaxBytes>>20)
+		}
+
+		// Names sort by age, so replay order survives restarts
+		b.spillSeq++
+		path := filepath.Join(b.spillDir, fmt.Sprintf("%020d-%06d.ndjson", time.Now().UnixNano(), b.spillSeq))
+		if err := os.WriteFile(path+".tmp", data.Bytes(), 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return err
+		}
+		b.spillFiles = append(b.spillFiles, spillFile{path: path, size: size})
+		b.spillBytes += size
+	}
+	return nil
+}
+
+// adoptSpill picks up spill files left by a previous run
+func (b *IngestBuffer) adoptSpill() error {
+	entries, err := os.ReadDir(b.spillDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".ndjson") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		b.spillFiles = append(b.spillFiles, spillFile{path: filepath.Join(b.spillDir, entry.Name()), size: info.Size()})
+		b.spillBytes += info.Size()
+	}
+	sort.Slice(b.spillFiles, func(i, j int) bool { return b.spillFiles[i].path < b.spillFiles[j].path })
+	if len(b.spillFiles) > 0 {
+		slog.Info("Replaying spilled metrics from a previous run", "files", len(b.spillFiles), "bytes", b.spillBytes)
+	}
+	b.spillSize.Set(float64(b.spillBytes))
+	return nil
+}
+
+// readSpillFile reads the points in a spill file
+func readSpillFile(path string) ([]*MetricPoint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var points []*MetricPoint
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var point MetricPoint
+		if err := json.Unmarshal(scanner.Bytes(), &point); err != nil {
+			return points, err
+		}
+		points = append(points, &point)
+	}
+	return points, scanner.Err()
+}
+
+// updateGauges refreshes the buffer's gauges. Callers hold the lock.
+func (b *IngestBuffer) updateGauges(inMemory int) {
+	b.service.bufferSize.Set(float64(inMemory))
+	b.fill.Set(float64(inMemory) / float64(b.capacity))
+	b.spillSize.Set(float64(b.spillBytes))
+	for _, priority := range ingestPriorities {
+		over := 0.0
+		if !b.admits(priority, inMemory) {
+			over = 1
+		}
+		b.overWatermark.WithLabelValues(priority).Set(over)
+	}
+}
+
+// retryAfter is how long refused clients should wait, longer while spilled
+// points show the database is behind. Callers hold the lock.
+func (b *IngestBuffer) retryAfter() int {
+	if len(b.spillFiles) > 0 {
+		return 30
+	}
+	return 10
+}
+
+// RetryAfter is how many seconds refused clients should wait
+func (b *IngestBuffer) RetryAfter() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.retryAfter()
+}
+
+// Admitting reports whether points of a priority are buffered, and if not
+// how many seconds clients should wait
+func (b *IngestBuffer) Admitting(priority string) (bool, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.admits(priority, b.inMemory()), b.retryAfter()
+}
+
+// Status describes the buffer's fill and what it is deferring
+func (b *IngestBuffer) Status() AdmissionStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	inMemory := b.inMemory()
+	status := AdmissionStatus{
+		Capacity:      b.capacity,
+		Queued:        make(map[string]int),
+		Writing:       b.writing,
+		Fill:          float64(inMemory) / float64(b.capacity),
+		Watermarks:    b.watermarks,
+		OverWatermark: []string{},
+		SpillFiles:    len(b.spillFiles),
+		SpillBytes:    b.spillBytes,
+		SpillMaxBytes: b.spillMaxBytes,
+		RetryAfter:    b.retryAfter(),
+	}
+	for _, priority := range ingestPriorities {
+		status.Queued[priority] = len(b.queued[priority])
+		if !b.admits(priority, inMemory) {
+			status.OverWatermark = append(status.OverWatermark, priority)
+		}
+	}
+	return status
+}
+
+// HTTP Handlers
+
+// GetIngestionStatus shows the ingestion buffer's fill, spill and what it
+// is deferring (admin only)
+func (s *TelemetryService) GetIngestionStatus(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.ingest.Status())
+}
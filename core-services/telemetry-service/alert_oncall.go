@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// OnCallRotation hands alert ownership to members in turn, one shift each
+type OnCallRotation struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Members    []string  `json:"members"` // User IDs in rotation order
+	ShiftHours int       `json:"shift_hours"`
+	StartsAt   time.Time `json:"starts_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OnCall returns the member on call at the given time
+func (r *OnCallRotation) OnCall(at time.Time) string {
+	if len(r.Members) == 0 {
+		return ""
+	}
+	if at.Before(r.StartsAt) {
+		return r.Members[0]
+	}
+	shift := int(at.Sub(r.StartsAt) / (time.Duration(r.ShiftHours) * time.Hour))
+	return r.Members[shift%len(r.Members)]
+}
+
+// ackDeadline is how long a critical alert may fire unacknowledged before reminders start
+func ackDeadline() time.Duration {
+	if v := os.Getenv("ALERT_ACK_DEADLINE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+	}
+	return 15 * time.Minute
+}
+
+// alertAssignee resolves who currently owns an alert. Callers hold s.alertMu.
+func (s *TelemetryService) alertAssignee(alert *Alert) string {
+	if alert.AssignedTo != "" {
+		return alert.AssignedTo
+	}
+	if rotation, exists := s.rotations[alert.RotationID]; exists {
+		return rotation.OnCall(time.Now())
+	}
+	return ""
+}
+
+// AcknowledgeAlert marks a firing alert as being handled by the caller
+func (s *TelemetryService) AcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	alertID := mux.Vars(r)["id"]
+
+	s.alertMu.Lock()
+	alert, exists := s.alerts[alertID]
+	if !exists {
+		s.alertMu.Unlock()
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+	if alert.State != "firing" {
+		s.alertMu.Unlock()
+		http.Error(w, "Only firing alerts can be acknowledged", http.StatusConflict)
+		return
+	}
+	now := time.Now()
+	alert.AckedBy = claims.UserID
+	alert.AckedAt = &now
+	snapshot := *alert
+	s.alertMu.Unlock()
+
+	s.updateAlertState(&snapshot)
+	s.publishAlertEvent("alerts.acknowledged", &snapshot, map[string]interface{}{
+		"acknowledged_by": claims.UserID,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// UnacknowledgeAlert clears an acknowledgement so reminders resume
+func (s *TelemetryService) UnacknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	alertID := mux.Vars(r)["id"]
+
+	s.alertMu.Lock()
+	alert, exists := s.alerts[alertID]
+	if !exists {
+		s.alertMu.Unlock()
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+	alert.AckedBy = ""
+	alert.AckedAt = nil
+	alert.RemindedAt = nil
+	snapshot := *alert
+	s.alertMu.Unlock()
+
+	s.updateAlertState(&snapshot)
+	s.publishAlertEvent("alerts.unacknowledged", &snapshot, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// AssignAlert routes an alert to an on-call user or rotation
+func (s *TelemetryService) AssignAlert(w http.ResponseWriter, r *http.Request) {
+	alertID := mux.Vars(r)["id"]
+
+	var req struct {
+		UserID     string `json:"user_id"`
+		RotationID string `json:"rotation_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if (req.UserID == "") == (req.RotationID == "") {
+		http.Error(w, "Exactly one of user_id or rotation_id is required", http.StatusBadRequest)
+		return
+	}
+
+	s.alertMu.Lock()
+	alert, exists := s.alerts[alertID]
+	if !exists {
+		s.alertMu.Unlock()
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+	if req.RotationID != "" {
+		if _, exists := s.rotations[req.RotationID]; !exists {
+			s.alertMu.Unlock()
+			http.Error(w, "Rotation not found", http.StatusNotFound)
+			return
+		}
+	}
+	alert.AssignedTo = req.UserID
+	alert.RotationID = req.RotationID
+	assignee := s.alertAssignee(alert)
+	snapshot := *alert
+	s.alertMu.Unlock()
+
+	if err := s.saveAlert(&snapshot); err != nil {
+		http.Error(w, "Failed to save alert", http.StatusInternalServerError)
+		return
+	}
+	s.publishAlertEvent("alerts.assigned", &snapshot, map[string]interface{}{
+		"assignee": assignee,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// CreateRotation creates an on-call rotation
+func (s *TelemetryService) CreateRotation(w http.ResponseWriter, r *http.Request) {
+	var rotation OnCallRotation
+	if err := json.NewDecoder(r.Body).Decode(&rotation); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if rotation.Name == "" || len(rotation.Members) == 0 {
+		http.Error(w, "Name and members are required", http.StatusBadRequest)
+		return
+	}
+	if rotation.ShiftHours <= 0 {
+		rotation.ShiftHours = 168 // Weekly
+	}
+
+	rotation.ID = generateID()
+	rotation.CreatedAt = time.Now()
+	if rotation.StartsAt.IsZero() {
+		rotation.StartsAt = rotation.CreatedAt
+	}
+
+	if err := s.saveRotation(&rotation); err != nil {
+		http.Error(w, "Failed to save rotation", http.StatusInternalServerError)
+		return
+	}
+
+	s.alertMu.Lock()
+	s.rotations[rotation.ID] = &rotation
+	s.alertMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rotation)
+}
+
+// ListRotations returns all on-call rotations with the member currently on call
+func (s *TelemetryService) ListRotations(w http.ResponseWriter, r *http.Request) {
+	type rotationView struct {
+		OnCallRotation
+		OnCall string `json:"on_call"`
+	}
+
+	now := time.Now()
+	s.alertMu.RLock()
+	rotations := make([]rotationView, 0, len(s.rotations))
+	for _, rotation := range s.rotations {
+		rotations = append(rotations, rotationView{*rotation, rotation.OnCall(now)})
+	}
+	s.alertMu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rotations)
+}
+
+// ackReminder re-notifies assignees of critical alerts left unacknowledged past the deadline
+func (s *TelemetryService) ackReminder() {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.sendAckReminders(time.Now(), ackDeadline())
+	}
+}
+
+func (s *TelemetryService) sendAckReminders(now time.Time, deadline time.Duration) {
+	type reminder struct {
+		alert    Alert
+		assignee string
+	}
+	var due []reminder
+
+	s.alertMu.Lock()
+	for _, alert := range s.alerts {
+		if alert.State != "firing" || alert.Severity != "critical" || alert.AckedAt != nil || alert.LastTriggered == nil {
+			continue
+		}
+		if now.Sub(*alert.LastTriggered) < deadline {
+			continue
+		}
+		if alert.RemindedAt != nil && now.Sub(*alert.RemindedAt) < deadline {
+			continue
+		}
+		reminded := now
+		alert.RemindedAt = &reminded
+		due = append(due, reminder{*alert, s.alertAssignee(alert)})
+	}
+	s.alertMu.Unlock()
+
+	for _, r := range due {
+		s.updateAlertState(&r.alert)
+		s.publishAlertEvent("alerts.reminder", &r.alert, map[string]interface{}{
+			"assignee":       r.assignee,
+			"firing_for":     now.Sub(*r.alert.LastTriggered).String(),
+			"ack_deadline":   deadline.String(),
+			"unacknowledged": true,
+		})
+		slog.Warn("Alert unacknowledged, reminded assignee", "alert_id", r.alert.ID, "alert", r.alert.Name,
+			"firing_for", now.Sub(*r.alert.LastTriggered).String(), "assignee", r.assignee)
+	}
+}
+
+// publishAlertEvent publishes an alert lifecycle notification
+func (s *TelemetryService) publishAlertEvent(subject string, alert *Alert, extra map[string]interface{}) {
+	notification := map[string]interface{}{
+		"alert_id":   alert.ID,
+		"alert_name": alert.Name,
+		"severity":   alert.Severity,
+		"state":      alert.State,
+		"timestamp":  time.Now(),
+	}
+	for key, value := range extra {
+		notification[key] = value
+	}
+
+	data, _ := json.Marshal(notification)
+	s.nats.Publish(subject, data)
+}
+
+func (s *TelemetryService) loadRotations() error {
+	rows, err := s.db.Query(`
+		SELECT id, name, members, shift_hours, starts_at, created_at
+		FROM oncall_rotations
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rotation OnCallRotation
+		var membersJSON []byte
+		if err := rows.Scan(&rotation.ID, &rotation.Name, &membersJSON,
+			&rotation.ShiftHours, &rotation.StartsAt, &rotation.CreatedAt); err != nil {
+			continue
+		}
+		json.Unmarshal(membersJSON, &rotation.Members)
+
+		s.alertMu.Lock()
+		s.rotations[rotation.ID] = &rotation
+		s.alertMu.Unlock()
+	}
+
+	return nil
+}
+
+func (s *TelemetryService) saveRotation(rotation *OnCallRotation) error {
+	membersJSON, _ := json.Marshal(rotation.Members)
+
+	_, err := s.db.Exec(`
+		INSERT INTO oncall_rotations (id, name, members, shift_hours, starts_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, rotation.ID, rotation.Name, membersJSON, rotation.ShiftHours, rotation.StartsAt, rotation.CreatedAt)
+
+	return err
+}
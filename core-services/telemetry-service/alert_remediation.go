@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Remediation action types
+const (
+	RemediationCordonAgent   = "cordon_agent"    // Stop placing jobs on the agent, e.g. its disk is full
+	RemediationDrainAgent    = "drain_agent"     // Cordon the agent and move its jobs, e.g. on ECC errors
+	RemediationScaleDownPool = "scale_down_pool" // Lower the jobs each agent in the pool runs
+)
+
+// Remediation outcomes recorded in the audit trail
+const (
+	RemediationSucceeded = "succeeded"
+	RemediationFailed    = "failed"
+	RemediationSkipped   = "skipped" // Cooling down, or nothing breached the condition
+	RemediationDryRun    = "dry_run"
+)
+
+const (
+	defaultRemediationTargets  = 3
+	defaultRemediationCooldown = 30 // Minutes
+	maxRemediationAudit        = 500
+)
+
+// RemediationAction binds an action to an alert. When the alert fires the
+// action runs against each agent, or each agent's pool, whose own average
+// over the evaluation window breaches the alert's condition.
+type RemediationAction struct {
+	Type            string  `json:"type"`                       // cordon_agent, drain_agent, scale_down_pool
+	Pool            string  `json:"pool,omitempty"`             // scale_down_pool: this pool instead of the breaching agents' pools
+	Factor          float64 `json:"factor,omitempty"`           // scale_down_pool: share of the pool's job limit kept, default 0.5
+	MaxTargets      int     `json:"max_targets,omitempty"`      // Most agents or pools one firing acts on, worst first; default 3
+	CooldownMinutes int     `json:"cooldown_minutes,omitempty"` // Before the same target is acted on again; default 30
+	DryRun          bool    `json:"dry_run,omitempty"`          // Audit what would run without calling the scheduler
+}
+
+// RemediationRecord is an audit entry for one action taken, or not taken,
+// when an alert fired
+type RemediationRecord struct {
+	ID         string    `json:"id"`
+	AlertID    string    `json:"alert_id"`
+	AlertName  string    `json:"alert_name"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target,omitempty"` // Agent ID or pool
+	Value      float64   `json:"value"`            // The target's value that breached the condition
+	Status     string    `json:"status"`           // succeeded, failed, skipped, dry_run
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	ExecutedAt time.Time `json:"executed_at"`
+}
+
+// remediationTarget is an agent or pool breaching an alert's condition
+type remediationTarget struct {
+	id    string
+	value float64
+}
+
+// AlertRemediator runs the actions bound to alerts against the scheduler.
+//
+// Calls are authenticated with SERVICE_TOKEN and sent to SCHEDULER_URL.
+// Every outcome, including skips and dry runs, is written to the
+// alert_remediations table and published on alerts.remediation.
+type AlertRemediator struct {
+	service      *TelemetryService
+	httpClient   *http.Client
+	schedulerURL string
+	serviceToken string
+	lastRun      map[string]time.Time // alert/action/target -> last executed
+	mu           sync.Mutex
+	executed     *prometheus.CounterVec
+}
+
+// NewAlertRemediator creates the remediator and registers its metrics
+func NewAlertRemediator(s *TelemetryService) *AlertRemediator {
+	schedulerURL := os.Getenv("SCHEDULER_URL")
+	if schedulerURL == "" {
+		schedulerURL = "http://scheduler-service:8002"
+	}
+
+	m := &AlertRemediator{
+		service:      s,
+		httpClient:   &http.Client{Timeout: 30 * time.Second, Transport: obs.Transport(nil)},
+		schedulerURL: schedulerURL,
+		serviceToken: os.Getenv("SERVICE_TOKEN"),
+		lastRun:      make(map[string]time.Time),
+		executed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_alert_remediations_total",
+			Help: "Remediation actions run for firing alerts, by outcome",
+		}, []string{"action", "status"}),
+	}
+	prometheus.MustRegister(m.executed)
+	return m
+}
+
+// validateRemediations checks the actions bound to an alert and fills in
+// their defaults
+func validateRemediations(actions []RemediationAction) error {
+	for i := range actions {
+		action := &actions[i]
+		switch action.Type {
+		case RemediationCordonAgent, RemediationDrainAgent:
+			if action.Pool != "" || action.Factor != 0 {
+				return fmt.Errorf("actions[%d]: pool and factor only apply to %s", i, RemediationScaleDownPool)
+			}
+		case RemediationScaleDownPool:
+			if action.Factor == 0 {
+				action.Factor = 0.5
+			}
+			if action.Factor <= 0 || action.Factor >= 1 {
+				return fmt.Errorf("actions[%d]: factor must be between 0 and 1", i)
+			}
+		default:
+			return fmt.Errorf("actions[%d]: unknown type %q, want %s, %s or %s", i, action.Type,
+				RemediationCordonAgent, RemediationDrainAgent, RemediationScaleDownPool)
+		}
+		if action.MaxTargets < 0 || action.CooldownMinutes < 0 {
+			return fmt.Errorf("actions[%d]: max_targets and cooldown_minutes cannot be negative", i)
+		}
+		if action.MaxTargets == 0 {
+			action.MaxTargets = defaultRemediationTargets
+		}
+		if action.CooldownMinutes == 0 {
+			action.CooldownMinutes = defaultRemediationCooldown
+		}
+	}
+	return nil
+}
+
+// remediate runs an alert's actions after it started firing
+func (m *AlertRemediator) remediate(alert Alert) {
+	ctx := context.Background()
+	for _, action := range alert.Actions {
+		targets, err := m.targets(alert, action)
+		if err != nil {
+			m.record(ctx, &RemediationRecord{AlertID: alert.ID, AlertName: alert.Name, Action: action.Type,
+				Status: RemediationFailed, Error: "finding targets: " + err.Error()})
+			continue
+		}
+		if len(targets) == 0 {
+			m.record(ctx, &RemediationRecord{AlertID: alert.ID, AlertName: alert.Name, Action: action.Type,
+				Status: RemediationSkipped, Error: "no agent breaches the condition on its own verified metrics"})
+			continue
+		}
+		for _, target := range targets {
+			m.record(ctx, m.execute(ctx, alert, action, target))
+		}
+	}
+}
+
+// targets returns the agents or pools an action runs against, worst first.
+// Only points agents sent with their own credentials count, so whoever can
+// post metrics cannot pick which agents get cordoned or drained.
+func (m *AlertRemediator) targets(alert Alert, action RemediationAction) ([]remediationTarget, error) {
+	if action.Pool != "" {
+		return []remediationTarget{{id: action.Pool}}, nil
+	}
+
+	group := "agent_id"
+	if action.Type == RemediationScaleDownPool {
+		group = "tags->>'pool'"
+	}
+	rows, err := m.service.reads.fresh().db.Query(fmt.Sprintf(`
+		SELECT %[1]s, AVG(value)
+		FROM metrics
+		WHERE name = $1
+			AND timestamp > NOW() - INTERVAL '5 minutes'
+			AND verified
+			AND %[1]s <> ''
+		GROUP BY %[1]s
+	`, group), alert.MetricName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var targets []remediationTarget
+	for rows.Next() {
+		var target remediationTarget
+		if err := rows.Scan(&target.id, &target.value); err != nil {
+			return nil, err
+		}
+		if conditionMet(alert.Condition, target.value, alert.Threshold) {
+			targets = append(targets, target)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(targets, func(i, j int) bool {
+		return math.Abs(targets[i].value-alert.Threshold) > math.Abs(targets[j].value-alert.Threshold)
+	})
+	if len(targets) > action.MaxTargets {
+		targets = targets[:action.MaxTargets]
+	}
+	return targets, nil
+}
+
+// execute runs one action against one target, unless the target is still
+// cooling down from an earlier run
+func (m *AlertRemediator) execute(ctx context.Context, alert Alert, action RemediationAction, target remediationTarget) *RemediationRecord {
+	record := &RemediationRecord{
+		AlertID:   alert.ID,
+		AlertName: alert.Name,
+		Action:    action.Type,
+		Target:    target.id,
+		Value:     target.value,
+	}
+
+	key := alert.ID + "/" + action.Type + "/" + target.id
+	cooldown := time.Duration(action.CooldownMinutes) * time.Minute
+	m.mu.Lock()
+	last, ran := m.lastRun[key]
+	if ran && time.Since(last) < cooldown {
+		m.mu.Unlock()
+		record.Status = RemediationSkipped
+		record.Error = fmt.Sprintf("cooling down until %s", last.Add(cooldown).Format(time.RFC3339))
+		return record
+	}
+	if !action.DryRun {
+		m.lastRun[key] = time.Now()
+	}
+	m.mu.Unlock()
+
+	var path string
+	switch action.Type {
+	case RemediationCordonAgent:
+		path = "/api/v1/agents/" + url.PathEscape(target.id) + "/cordon"
+	case RemediationDrainAgent:
+		path = "/api/v1/agents/" + url.PathEscape(target.id) + "/drain"
+	case RemediationScaleDownPool:
+		path = "/api/v1/pools/" + url.PathEscape(target.id) + "/scale-down"
+	}
+
+	if action.DryRun {
+		record.Status = RemediationDryRun
+		return record
+	}
+	if m.serviceToken == "" {
+		record.Status = RemediationFailed
+		record.Error = "SERVICE_TOKEN is not set"
+		return record
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"reason": fmt.Sprintf("alert %q: %s %s %g (value %.4g)", alert.Name, alert.MetricName, alert.Condition, alert.Threshold, target.value),
+		"source": "alert:" + alert.ID,
+		"factor": action.Factor,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.schedulerURL+path, bytes.NewReader(body))
+	if err != nil {
+		record.Status = RemediationFailed
+		record.Error = err.Error()
+		return record
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.serviceToken)
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		record.Status = RemediationFailed
+		record.Error = err.Error()
+		return record
+	}
+	defer resp.Body.Close()
+
+	record.StatusCode = resp.StatusCode
+	if resp.StatusCode != http.StatusOK {
+		record.Status = RemediationFailed
+		record.Error = obs.ResponseError(resp, "POST %s", path).Error()
+		return record
+	}
+	record.Status = RemediationSucceeded
+	return record
+}
+
+// record writes an audit entry, publishes it and counts it
+func (m *AlertRemediator) record(ctx context.Context, record *RemediationRecord) {
+	record.ID = generateID()
+	record.ExecutedAt = time.Now()
+	m.executed.WithLabelValues(record.Action, record.Status).Inc()
+
+	_, err := m.service.db.Exec(`
+		INSERT INTO alert_remediations (id, alert_id, alert_name, action, target, value,
+			status, status_code, error, executed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, record.ID, record.AlertID, record.AlertName, record.Action, record.Target, record.Value,
+		record.Status, record.StatusCode, record.Error, record.ExecutedAt)
+	if err != nil {
+		obs.LogError(ctx, "Failed to save remediation audit", err, "alert_id", record.AlertID, "action", record.Action)
+	}
+
+	data, _ := json.Marshal(record)
+	m.service.nats.Publish("alerts.remediation", data)
+
+	if record.Status == RemediationFailed {
+		slog.WarnContext(ctx, "Alert remediation failed", "alert_id", record.AlertID, "action", record.Action,
+			"target", record.Target, "error", record.Error)
+		return
+	}
+	slog.InfoContext(ctx, "Alert remediation", "alert_id", record.AlertID, "action", record.Action,
+		"target", record.Target, "status", record.Status)
+}
+
+// ListRemediations returns the remediation audit trail, newest first,
+// optionally filtered by alert, action, target or status
+func (s *TelemetryService) ListRemediations(w http.ResponseWriter, r *http.Request) {
+	if !isAdmin(r) {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	if alertID := mux.Vars(r)["id"]; alertID != "" {
+		query.Set("alert_id", alertID)
+	}
+	limit := maxRemediationAudit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, alert_id, alert_name, action, target, value, status, status_code,
+			error, executed_at
+		FROM alert_remediations
+		WHERE ($1 = '' OR alert_id = $1) AND ($2 = '' OR action = $2)
+			AND ($3 = '' OR target = $3) AND ($4 = '' OR status = $4)
+		ORDER BY executed_at DESC
+		LIMIT $5
+	`, query.Get("alert_id"), query.Get("action"), query.Get("target"), query.Get("status"), limit)
+	if err != nil {
+		http.Error(w, "Failed to query remediations", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	records := make([]*RemediationRecord, 0)
+	for rows.Next() {
+		var record RemediationRecord
+		var target, errMsg sql.NullString
+		if err := rows.Scan(&record.ID, &record.AlertID, &record.AlertName, &record.Action, &target,
+			&record.Value, &record.Status, &record.StatusCode, &errMsg, &record.ExecutedAt); err != nil {
+			http.Error(w, "Failed to read remediations", http.StatusInternalServerError)
+			return
+		}
+		record.Target = target.String
+		record.Error = errMsg.String
+		records = append(records, &record)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
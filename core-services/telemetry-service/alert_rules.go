@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// GetAlert retrieves a single alert rule with its current state
+func (s *TelemetryService) GetAlert(w http.ResponseWriter, r *http.Request) {
+	alertID := mux.Vars(r)["id"]
+
+	s.alertMu.RLock()
+	alert, exists := s.alerts[alertID]
+	var snapshot Alert
+	if exists {
+		snapshot = *alert
+	}
+	s.alertMu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// UpdateAlert replaces an alert rule's definition. Firing state and
+// acknowledgements are kept, so editing a rule does not silence it.
+func (s *TelemetryService) UpdateAlert(w http.ResponseWriter, r *http.Request) {
+	alertID := mux.Vars(r)["id"]
+
+	var update Alert
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if update.Name == "" || update.MetricName == "" || update.Condition == "" {
+		http.Error(w, "Missing required fields", http.StatusBadRequest)
+		return
+	}
+	if err := validateRemediations(update.Actions); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.alertMu.Lock()
+	alert, exists := s.alerts[alertID]
+	if !exists {
+		s.alertMu.Unlock()
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+	// Editing a rule that remediates changes what it acts on
+	if (len(alert.Actions) > 0 || len(update.Actions) > 0) && !isAdmin(r) {
+		s.alertMu.Unlock()
+		http.Error(w, "Admin access required to change remediation actions", http.StatusForbidden)
+		return
+	}
+	alert.Name = update.Name
+	alert.Condition = update.Condition
+	alert.Threshold = update.Threshold
+	alert.MetricName = update.MetricName
+	alert.Tags = update.Tags
+	alert.Severity = update.Severity
+	alert.NotifyWebhook = update.NotifyWebhook
+	alert.NotifyEmail = update.NotifyEmail
+	alert.Metadata = update.Metadata
+	alert.AssignedTo = update.AssignedTo
+	alert.RotationID = update.RotationID
+	alert.Actions = update.Actions
+	snapshot := *alert
+	s.alertMu.Unlock()
+
+	if err := s.saveAlert(&snapshot); err != nil {
+		http.Error(w, "Failed to save alert", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// DeleteAlert deactivates an alert rule. The row is kept for history.
+func (s *TelemetryService) DeleteAlert(w http.ResponseWriter, r *http.Request) {
+	alertID := mux.Vars(r)["id"]
+
+	s.alertMu.Lock()
+	_, exists := s.alerts[alertID]
+	delete(s.alerts, alertID)
+	s.alertMu.Unlock()
+
+	if !exists {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := s.db.Exec(`UPDATE alerts SET active = false WHERE id = $1`, alertID); err != nil {
+		http.Error(w, "Failed to delete alert", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
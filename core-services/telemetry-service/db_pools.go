@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Data sources reported in X-Data-Source
+const (
+	sourcePrimary = "primary"
+	sourceReplica = "replica"
+)
+
+// replicaLagQuery measures how far a replica's replay trails the primary. A
+// replica that has replayed everything it received is current, however old
+// its last replayed transaction.
+const replicaLagQuery = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END::float8
+`
+
+// ReadPools keeps metric queries off the ingest write path.
+//
+// The service's write pool (TelemetryService.db, TELEMETRY_WRITE_POOL_SIZE
+// connections) carries ingestion, rollups, retention and alert state. Queries
+// run on read pools of TELEMETRY_READ_POOL_SIZE connections each: one on the
+// primary, and one per replica in TIMESCALE_READ_REPLICA_URLS
+// (comma-separated). Replicas are checked every TIMESCALE_REPLICA_CHECK_INTERVAL
+// and skipped while unreachable or lagging more than TIMESCALE_REPLICA_MAX_LAG.
+//
+// Rollup queries go to a healthy replica, round-robin. Raw queries go to a
+// replica only when its lag still covers the queried range, and real-time
+// reads stay on the primary. Every read reports where it ran and the time its
+// data is complete up to, so responses can carry staleness annotations.
+type ReadPools struct {
+	primary  *sql.DB
+	replicas []*replica
+	maxLag   time.Duration
+	interval time.Duration
+	next     atomic.Uint64
+
+	lag     *prometheus.GaugeVec
+	healthy *prometheus.GaugeVec
+	queries *prometheus.CounterVec
+}
+
+// replica is one read replica and its last health check
+type replica struct {
+	name string // Host, for logs and metrics; never the credentials
+	db   *sql.DB
+
+	mu        sync.RWMutex
+	healthy   bool
+	lag       time.Duration
+	checkedAt time.Time
+}
+
+// readTarget is the pool a read runs on. Data committed on the primary before
+// asOf is guaranteed visible.
+type readTarget struct {
+	db      *sql.DB
+	source  string
+	replica string
+	asOf    time.Time
+}
+
+// openPool opens a connection pool of at most size connections
+func openPool(dsn string, size int) (*sql.DB, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(size)
+	db.SetMaxIdleConns(size)
+	db.SetConnMaxLifetime(30 * time.Minute)
+	return db, nil
+}
+
+// NewReadPools opens the read pools configured in the environment
+func NewReadPools(primaryURL string) (*ReadPools, error) {
+	size := envInt("TELEMETRY_READ_POOL_SIZE", 10)
+
+	primary, err := openPool(primaryURL, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open read pool: %w", err)
+	}
+
+	p := &ReadPools{
+		primary:  primary,
+		maxLag:   envDuration("TIMESCALE_REPLICA_MAX_LAG", 30*time.Second),
+		interval: envDuration("TIMESCALE_REPLICA_CHECK_INTERVAL", 10*time.Second),
+		lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "telemetry_replica_lag_seconds",
+			Help: "Replication lag of each read replica at its last check",
+		}, []string{"replica"}),
+		healthy: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "telemetry_replica_healthy",
+			Help: "Whether each read replica is serving queries (1) or skipped (0)",
+		}, []string{"replica"}),
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_read_queries_total",
+			Help: "Metrics queries by the pool they ran on",
+		}, []string{"source"}),
+	}
+
+	for i, dsn := range strings.Split(os.Getenv("TIMESCALE_READ_REPLICA_URLS"), ",") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			continue
+		}
+		db, err := openPool(dsn, size)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open read replica pool: %w", err)
+		}
+		name := fmt.Sprintf("replica-%d", i)
+		if u, err := url.Parse(dsn); err == nil && u.Host != "" {
+			name = u.Host
+		}
+		p.replicas = append(p.replicas, &replica{name: name, db: db})
+	}
+
+	prometheus.MustRegister(p.lag, p.healthy, p.queries)
+
+	if len(p.replicas) > 0 {
+		// Route to replicas from the first query rather than after the first tick
+		p.checkReplicas()
+		go p.monitor()
+	}
+	return p, nil
+}
+
+// envInt reads a positive integer from the environment, falling back to a default
+func envInt(name string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+func (p *ReadPools) monitor() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		p.checkReplicas()
+	}
+}
+
+// checkReplicas measures each replica's lag and marks it healthy if it is
+// reachable and within maxLag
+func (p *ReadPools) checkReplicas() {
+	for _, r := range p.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		var lagSeconds float64
+		err := r.db.QueryRowContext(ctx, replicaLagQuery).Scan(&lagSeconds)
+		cancel()
+
+		lag := time.Duration(lagSeconds * float64(time.Second))
+		healthy := err == nil && lag <= p.maxLag
+
+		r.mu.Lock()
+		wasHealthy := r.healthy
+		r.healthy = healthy
+		if err == nil {
+			r.lag = lag
+			r.checkedAt = time.Now()
+		}
+		r.mu.Unlock()
+
+		if err == nil {
+			p.lag.WithLabelValues(r.name).Set(lagSeconds)
+		}
+		if healthy {
+			p.healthy.WithLabelValues(r.name).Set(1)
+		} else {
+			p.healthy.WithLabelValues(r.name).Set(0)
+		}
+
+		switch {
+		case wasHealthy && err != nil:
+			slog.Warn("Read replica unreachable, routing reads elsewhere", "replica", r.name, obs.KeyError, err)
+		case wasHealthy && !healthy:
+			slog.Warn("Read replica lagging, routing reads elsewhere", "replica", r.name, "lag", lag, "max_lag", p.maxLag)
+		case !wasHealthy && healthy:
+			slog.Info("Read replica serving queries", "replica", r.name, "lag", lag)
+		}
+	}
+}
+
+// asOf returns the time the replica's data is complete up to, if it is healthy
+func (r *replica) asOf() (time.Time, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.checkedAt.Add(-r.lag), r.healthy
+}
+
+// forRollups returns a pool for aggregation queries: a healthy replica when
+// there is one
+func (p *ReadPools) forRollups() readTarget {
+	return p.pick(time.Time{})
+}
+
+// forRange returns a pool for a query over data up to end. A replica serves
+// it only if it is known to have replayed everything up to end.
+func (p *ReadPools) forRange(end time.Time) readTarget {
+	return p.pick(end)
+}
+
+// fresh returns the primary read pool, for reads that need the latest data
+func (p *ReadPools) fresh() readTarget {
+	p.queries.WithLabelValues(sourcePrimary).Inc()
+	return readTarget{db: p.primary, source: sourcePrimary, asOf: time.Now()}
+}
+
+func (p *ReadPools) pick(needed time.Time) readTarget {
+	n := uint64(len(p.replicas))
+	start := p.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		r := p.replicas[(start+i)%n]
+		asOf, healthy := r.asOf()
+		if !healthy || asOf.Before(needed) {
+			continue
+		}
+		p.queries.WithLabelValues(sourceReplica).Inc()
+		return readTarget{db: r.db, source: sourceReplica, replica: r.name, asOf: asOf}
+	}
+	return p.fresh()
+}
+
+// check reports replicas configured but none serving; reads still fall back
+// to the primary, so it is not critical
+func (p *ReadPools) check(ctx context.Context) error {
+	if len(p.replicas) == 0 {
+		return nil
+	}
+	for _, r := range p.replicas {
+		if _, healthy := r.asOf(); healthy {
+			return nil
+		}
+	}
+	return fmt.Errorf("no healthy read replicas, reads served by primary")
+}
+
+// annotate sets the staleness headers for data read from source, complete up
+// to asOf
+func annotate(w http.ResponseWriter, source string, asOf time.Time) {
+	staleness := time.Since(asOf)
+	if staleness < 0 {
+		staleness = 0
+	}
+	w.Header().Set("X-Data-Source", source)
+	w.Header().Set("X-Data-As-Of", asOf.UTC().Format(time.RFC3339))
+	w.Header().Set("X-Data-Staleness-Seconds", strconv.FormatFloat(staleness.Seconds(), 'f', 1, 64))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/events"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// deadLetterRetention is how many dead letters are kept for the API
+const deadLetterRetention = 500
+
+// DeadLetter is an event a service gave up on after exhausting its deliveries
+type DeadLetter struct {
+	Subject    string          `json:"subject"` // Original subject
+	Consumer   string          `json:"consumer"`
+	Deliveries int             `json:"deliveries"`
+	Error      string          `json:"error"`
+	StreamSeq  uint64          `json:"stream_seq"` // Position in the original stream
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+// DeadLetterMonitor watches the dead-letter subjects. Every dead letter is
+// counted in Prometheus and recorded as an "events.dead_letters" metric so
+// alert rules can fire on it, e.g. on missed payment events.
+type DeadLetterMonitor struct {
+	service *TelemetryService
+	recent  []*DeadLetter
+	mu      sync.RWMutex
+	total   *prometheus.CounterVec
+}
+
+// NewDeadLetterMonitor creates the monitor and registers its metrics
+func NewDeadLetterMonitor(s *TelemetryService) *DeadLetterMonitor {
+	m := &DeadLetterMonitor{
+		service: s,
+		total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_dead_letters_total",
+			Help: "Events dead-lettered after exhausting their deliveries",
+		}, []string{"subject", "consumer"}),
+	}
+	prometheus.MustRegister(m.total)
+	return m
+}
+
+func (m *DeadLetterMonitor) subscribe() {
+	m.service.bus.Subscribe(events.DeadLetterPrefix+">", func(ctx context.Context, msg *nats.Msg) error {
+		m.record(ctx, msg)
+		return nil
+	})
+}
+
+// record stores a dead letter. ctx carries the request fields of whoever
+// published the original event.
+func (m *DeadLetterMonitor) record(ctx context.Context, msg *nats.Msg) {
+	deliveries, _ := strconv.Atoi(msg.Header.Get(events.HeaderDeliveries))
+	streamSeq, _ := strconv.ParseUint(msg.Header.Get(events.HeaderStreamSeq), 10, 64)
+	letter := &DeadLetter{
+		Subject:    strings.TrimPrefix(msg.Subject, events.DeadLetterPrefix),
+		Consumer:   msg.Header.Get(events.HeaderConsumer),
+		Deliveries: deliveries,
+		Error:      msg.Header.Get(events.HeaderError),
+		StreamSeq:  streamSeq,
+		ReceivedAt: time.Now(),
+	}
+	if json.Valid(msg.Data) {
+		letter.Payload = json.RawMessage(msg.Data)
+	}
+
+	m.mu.Lock()
+	m.recent = append(m.recent, letter)
+	if len(m.recent) > deadLetterRetention {
+		m.recent = m.recent[len(m.recent)-deadLetterRetention:]
+	}
+	m.mu.Unlock()
+
+	m.total.WithLabelValues(letter.Subject, letter.Consumer).Inc()
+	slog.WarnContext(ctx, "Dead letter received", "subject", letter.Subject, "consumer", letter.Consumer,
+		"deliveries", letter.Deliveries, obs.KeyError, letter.Error)
+
+	metric := &MetricPoint{
+		Name:       "events.dead_letters",
+		Value:      1,
+		Tags:       map[string]string{"subject": letter.Subject, "consumer": letter.Consumer},
+		Timestamp:  letter.ReceivedAt,
+		MetricType: "counter",
+	}
+	m.service.ingest.Add([]*MetricPoint{metric}, SourceInternal)
+}
+
+// ListDeadLetters returns recent dead letters, newest first, optionally
+// filtered by original subject or consumer
+func (s *TelemetryService) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	subject := r.URL.Query().Get("subject")
+	consumer := r.URL.Query().Get("consumer")
+
+	m := s.deadLetters
+	m.mu.RLock()
+	letters := make([]*DeadLetter, 0)
+	for i := len(m.recent) - 1; i >= 0; i-- {
+		letter := m.recent[i]
+		if subject != "" && letter.Subject != subject {
+			continue
+		}
+		if consumer != "" && letter.Consumer != consumer {
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	m.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(letters)
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/nats-io/nats.go"
+	"github.com/parquet-go/parquet-go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Export kinds and formats
+const (
+	exportMetrics = "metrics"
+	exportLogs    = "logs"
+
+	formatNDJSON  = "ndjson"
+	formatParquet = "parquet"
+)
+
+const (
+	exportBatchSize      = 1000
+	exportFlushBytes     = 64 << 10
+	logFlushPeriod       = 5 * time.Second
+	jobTenantRetention   = "30 days"
+	jobLogRetention      = "7 days"
+	defaultExportRateMiB = 8
+)
+
+// ExportedMetric is one metric sample in an export
+type ExportedMetric struct {
+	Timestamp  time.Time         `json:"timestamp" parquet:"timestamp,timestamp(microsecond)"`
+	Name       string            `json:"name" parquet:"name,dict"`
+	Value      float64           `json:"value" parquet:"value"`
+	JobID      string            `json:"job_id" parquet:"job_id,dict"`
+	AgentID    string            `json:"agent_id,omitempty" parquet:"agent_id,dict"`
+	MetricType string            `json:"metric_type,omitempty" parquet:"metric_type,dict"`
+	Unit       string            `json:"unit,omitempty" parquet:"unit,dict"`
+	Tags       map[string]string `json:"tags,omitempty" parquet:"tags"`
+}
+
+// ExportedLog is one log line in an export
+type ExportedLog struct {
+	Timestamp time.Time         `json:"timestamp" parquet:"timestamp,timestamp(microsecond)"`
+	JobID     string            `json:"job_id" parquet:"job_id,dict"`
+	AgentID   string            `json:"agent_id,omitempty" parquet:"agent_id,dict"`
+	Source    string            `json:"source,omitempty" parquet:"source,dict"`
+	Stream    string            `json:"stream,omitempty" parquet:"stream,dict"`
+	Message   string            `json:"message" parquet:"message"`
+	Labels    map[string]string `json:"labels,omitempty" parquet:"labels"`
+}
+
+// exportCursor is where an export page starts. It travels to clients as an
+// opaque token and carries everything needed to fetch the page again, so an
+// interrupted page is resumed by repeating the request with the same cursor.
+type exportCursor struct {
+	Kind   string    `json:"kind"`
+	Tenant string    `json:"tenant"`
+	Format string    `json:"format"`
+	Metric string    `json:"metric,omitempty"`
+	JobID  string    `json:"job_id,omitempty"`
+	From   time.Time `json:"from"`
+	End    time.Time `json:"end"`
+}
+
+func (c *exportCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeExportCursor(token string) (*exportCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var cursor exportCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.From.IsZero() || !cursor.End.After(cursor.From) ||
+		(cursor.Format != formatNDJSON && cursor.Format != formatParquet) {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// DataExports streams a tenant's metrics and job logs in bulk, for loading
+// into their own warehouse.
+//
+// Metrics and logs belong to the tenant that submitted the job named by their
+// job_id tag or field; job ownership is learned from job.created. Job log
+// lines are kept for export for 7 days, like raw metrics.
+//
+// An export covers a time range in pages of EXPORT_PAGE_WINDOW (default 1h).
+// Each response is one complete page, NDJSON or a Parquet file, and names the
+// next page's cursor in X-Export-Cursor until the range is exhausted. Exports
+// read from replicas where they can, and each tenant may run
+// EXPORT_MAX_CONCURRENT (default 2) at once, each streamed at no more than
+// EXPORT_RATE_MIB_PER_SECOND (default 8).
+type DataExports struct {
+	service       *TelemetryService
+	pageWindow    time.Duration
+	bytesPerSec   int
+	maxConcurrent int
+	running       map[string]int // tenant -> exports in progress
+	mu            sync.Mutex
+	logBuffer     []LogEntry
+	bufferMu      sync.Mutex
+
+	rows     *prometheus.CounterVec
+	rejected *prometheus.CounterVec
+}
+
+// NewDataExports configures exports from the environment and registers their metrics
+func NewDataExports(s *TelemetryService) *DataExports {
+	pageWindow := time.Hour
+	if v := os.Getenv("EXPORT_PAGE_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			pageWindow = d
+		}
+	}
+
+	e := &DataExports{
+		service:       s,
+		pageWindow:    pageWindow,
+		bytesPerSec:   envInt("EXPORT_RATE_MIB_PER_SECOND", defaultExportRateMiB) << 20,
+		maxConcurrent: envInt("EXPORT_MAX_CONCURRENT", 2),
+		running:       make(map[string]int),
+		rows: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_export_rows_total",
+			Help: "Rows streamed by bulk exports",
+		}, []string{"kind", "format"}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_exports_rejected_total",
+			Help: "Bulk exports rejected by the per-tenant concurrency limit",
+		}, []string{"kind"}),
+	}
+	prometheus.MustRegister(e.rows, e.rejected)
+	return e
+}
+
+// subscribe learns which tenant owns each job
+func (e *DataExports) subscribe() {
+	e.service.bus.Subscribe("job.created", func(ctx context.Context, msg *nats.Msg) error {
+		var job struct {
+			ID     string `json:"id"`
+			UserID string `json:"user_id"`
+		}
+		if err := json.Unmarshal(msg.Data, &job); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		if job.ID == "" || job.UserID == "" {
+			return nil
+		}
+		_, err := e.service.db.ExecContext(ctx, `
+			INSERT INTO job_tenants (job_id, tenant) VALUES ($1, $2)
+			ON CONFLICT (job_id) DO NOTHING
+		`, job.ID, job.UserID)
+		return err
+	})
+}
+
+// run flushes buffered job log lines
+func (e *DataExports) run() {
+	ticker := time.NewTicker(logFlushPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		e.flushLogs()
+	}
+}
+
+// retainLogs keeps the log lines of jobs for export. Lines that belong to no
+// job belong to no tenant and are not kept.
+func (e *DataExports) retainLogs(entries []LogEntry) {
+	e.bufferMu.Lock()
+	defer e.bufferMu.Unlock()
+	for _, entry := range entries {
+		if entry.JobID != "" {
+			e.logBuffer = append(e.logBuffer, entry)
+		}
+	}
+}
+
+func (e *DataExports) flushLogs() {
+	e.bufferMu.Lock()
+	entries := e.logBuffer
+	e.logBuffer = nil
+	e.bufferMu.Unlock()
+	if len(entries) == 0 {
+		return
+	}
+
+	tx, err := e.service.db.Begin()
+	if err != nil {
+		slog.Error("Failed to begin job log transaction", obs.KeyError, err)
+		return
+	}
+	stmt, err := tx.Prepare(`
+		INSERT INTO job_logs (timestamp, job_id, agent_id, source, stream, message, labels)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`)
+	if err != nil {
+		tx.Rollback()
+		slog.Error("Failed to prepare job log insert", obs.KeyError, err)
+		return
+	}
+	defer stmt.Close()
+
+	for _, entry := range entries {
+		labelsJSON, _ := json.Marshal(entry.Labels)
+		if _, err := stmt.Exec(entry.Timestamp, entry.JobID, entry.AgentID, entry.Source,
+			entry.Stream, entry.Message, labelsJSON); err != nil {
+			slog.Error("Failed to insert job log line", obs.KeyJobID, entry.JobID, obs.KeyError, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		slog.Error("Failed to commit job log transaction", obs.KeyError, err)
+	}
+}
+
+// cleanup expires job log lines and job ownership past their retention
+func (e *DataExports) cleanup() {
+	if _, err := e.service.db.Exec(`DELETE FROM job_logs WHERE timestamp < NOW() - INTERVAL '` + jobLogRetention + `'`); err != nil {
+		slog.Error("Failed to clean up job logs", obs.KeyError, err)
+	}
+	if _, err := e.service.db.Exec(`DELETE FROM job_tenants WHERE created_at < NOW() - INTERVAL '` + jobTenantRetention + `'`); err != nil {
+		slog.Error("Failed to clean up job tenants", obs.KeyError, err)
+	}
+}
+
+// acquire takes one of a tenant's export slots
+func (e *DataExports) acquire(tenant string) (func(), bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running[tenant] >= e.maxConcurrent {
+		return nil, false
+	}
+	e.running[tenant]++
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if e.running[tenant]--; e.running[tenant] == 0 {
+			delete(e.running, tenant)
+		}
+	}, true
+}
+
+// ExportMetrics streams a page of the caller's job metrics
+func (s *TelemetryService) ExportMetrics(w http.ResponseWriter, r *http.Request) {
+	s.exports.serve(w, r, exportMetrics)
+}
+
+// ExportLogs streams a page of the caller's job logs
+func (s *TelemetryService) ExportLogs(w http.ResponseWriter, r *http.Request) {
+	s.exports.serve(w, r, exportLogs)
+}
+
+// serve resolves the page an export request asks for and streams it.
+//
+// A first request names start (RFC3339), and optionally end (default now),
+// format (ndjson or parquet), metric or job_id. Follow-up requests pass only
+// cursor. Admins may export another tenant's data with tenant.
+func (e *DataExports) serve(w http.ResponseWriter, r *http.Request, kind string) {
+	claims := r.Context().Value("claims").(*Claims)
+	query := r.URL.Query()
+
+	tenant := claims.UserID
+	if requested := query.Get("tenant"); requested != "" && requested != tenant {
+		if !isAdmin(r) {
+			http.Error(w, "Admin access required to export another tenant's data", http.StatusForbidden)
+			return
+		}
+		tenant = requested
+	}
+
+	var cursor *exportCursor
+	if token := query.Get("cursor"); token != "" {
+		var err error
+		if cursor, err = decodeExportCursor(token); err != nil || cursor.Kind != kind {
+			http.Error(w, "Invalid cursor", http.StatusBadRequest)
+			return
+		}
+		if cursor.Tenant != claims.UserID && !isAdmin(r) {
+			http.Error(w, "Cursor belongs to another tenant", http.StatusForbidden)
+			return
+		}
+	} else {
+		start, err := time.Parse(time.RFC3339, query.Get("start"))
+		if err != nil {
+			http.Error(w, "start is required as an RFC3339 time", http.StatusBadRequest)
+			return
+		}
+		end := time.Now()
+		if v := query.Get("end"); v != "" {
+			if end, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "Invalid end", http.StatusBadRequest)
+				return
+			}
+		}
+		if !end.After(start) {
+			http.Error(w, "end must be after start", http.StatusBadRequest)
+			return
+		}
+		format := query.Get("format")
+		if format == "" {
+			format = formatNDJSON
+		}
+		if format != formatNDJSON && format != formatParquet {
+			http.Error(w, "format must be ndjson or parquet", http.StatusBadRequest)
+			return
+		}
+		cursor = &exportCursor{
+			Kind:   kind,
+			Tenant: tenant,
+			Format: format,
+			Metric: query.Get("metric"),
+			JobID:  query.Get("job_id"),
+			From:   start.UTC(),
+			End:    end.UTC(),
+		}
+	}
+
+	release, ok := e.acquire(cursor.Tenant)
+	if !ok {
+		e.rejected.WithLabelValues(kind).Inc()
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "Too many exports in progress", http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+
+	to := cursor.From.Add(e.pageWindow)
+	if to.After(cursor.End) {
+		to = cursor.End
+	}
+	read := e.service.reads.forRange(to)
+	rows, err := e.query(r.Context(), read.db, cursor, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Export failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	contentType := "application/x-ndjson"
+	if cursor.Format == formatParquet {
+		contentType = "application/vnd.apache.parquet"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("%s-%s.%s", kind, cursor.From.Format("20060102T150405Z"), cursor.Format)))
+	w.Header().Set("X-Export-Page-Start", cursor.From.Format(time.RFC3339))
+	w.Header().Set("X-Export-Page-End", to.Format(time.RFC3339))
+	if to.Before(cursor.End) {
+		next := *cursor
+		next.From = to
+		w.Header().Set("X-Export-Cursor", next.encode())
+	}
+	annotate(w, read.source, read.asOf)
+
+	out := &throttledWriter{w: w, bytesPerSec: e.bytesPerSec, start: time.Now()}
+	if flusher, ok := w.(http.Flusher); ok {
+		out.flush = flusher.Flush
+	}
+	var count int
+	if kind == exportMetrics {
+		count, err = streamRows(out, cursor.Format, rows, scanExportedMetric)
+	} else {
+		count, err = streamRows(out, cursor.Format, rows, scanExportedLog)
+	}
+	e.rows.WithLabelValues(kind, cursor.Format).Add(float64(count))
+	if err != nil {
+		// The status is already sent; cut the connection so the client
+		// sees a failed page rather than a short one
+		obs.LogError(r.Context(), "Export failed mid-stream", err, "kind", kind, "tenant", cursor.Tenant, "rows", count)
+		panic(http.ErrAbortHandler)
+	}
+	slog.InfoContext(r.Context(), "Export page streamed", "kind", kind, "format", cursor.Format,
+		"tenant", cursor.Tenant, "from", cursor.From, "to", to, "rows", count, "bytes", out.written)
+}
+
+// query selects a page of a tenant's rows, oldest first
+func (e *DataExports) query(ctx context.Context, db *sql.DB, cursor *exportCursor, to time.Time) (*sql.Rows, error) {
+	if cursor.Kind == exportMetrics {
+		return db.QueryContext(ctx, `
+			SELECT m.timestamp, m.name, m.value, t.job_id, COALESCE(m.agent_id, ''),
+				COALESCE(m.metric_type, ''), COALESCE(m.unit, ''), m.tags
+			FROM metrics m
+			JOIN job_tenants t ON t.job_id = m.tags->>'job_id'
+			WHERE t.tenant = $1 AND m.timestamp >= $2 AND m.timestamp < $3
+				AND ($4 = '' OR m.name = $4) AND ($5 = '' OR t.job_id = $5)
+			ORDER BY m.timestamp
+		`, cursor.Tenant, cursor.From, to, cursor.Metric, cursor.JobID)
+	}
+	return db.QueryContext(ctx, `
+		SELECT l.timestamp, l.job_id, COALESCE(l.agent_id, ''), COALESCE(l.source, ''),
+			COALESCE(l.stream, ''), l.message, l.labels
+		FROM job_logs l
+		JOIN job_tenants t ON t.job_id = l.job_id
+		WHERE t.tenant = $1 AND l.timestamp >= $2 AND l.timestamp < $3
+			AND ($4 = '' OR l.job_id = $4)
+		ORDER BY l.timestamp
+	`, cursor.Tenant, cursor.From, to, cursor.JobID)
+}
+
+func scanExportedMetric(rows *sql.Rows) (ExportedMetric, error) {
+	var metric ExportedMetric
+	var tagsJSON []byte
+	err := rows.Scan(&metric.Timestamp, &metric.Name, &metric.Value, &metric.JobID, &metric.AgentID,
+		&metric.MetricType, &metric.Unit, &tagsJSON)
+	if err == nil {
+		json.Unmarshal(tagsJSON, &metric.Tags)
+	}
+	return metric, err
+}
+
+func scanExportedLog(rows *sql.Rows) (ExportedLog, error) {
+	var entry ExportedLog
+	var labelsJSON []byte
+	err := rows.Scan(&entry.Timestamp, &entry.JobID, &entry.AgentID, &entry.Source, &entry.Stream,
+		&entry.Message, &labelsJSON)
+	if err == nil {
+		json.Unmarshal(labelsJSON, &entry.Labels)
+	}
+	return entry, err
+}
+
+// streamRows writes rows as NDJSON lines or as one Parquet file and returns
+// how many it wrote
+func streamRows[T any](w io.Writer, format string, rows *sql.Rows, scan func(*sql.Rows) (T, error)) (int, error) {
+	count := 0
+	if format == formatNDJSON {
+		encoder := json.NewEncoder(w)
+		for rows.Next() {
+			record, err := scan(rows)
+			if err != nil {
+				return count, err
+			}
+			if err := encoder.Encode(record); err != nil {
+				return count, err
+			}
+			count++
+		}
+		return count, rows.Err()
+	}
+
+	writer := parquet.NewGenericWriter[T](w)
+	batch := make([]T, 0, exportBatchSize)
+	for rows.Next() {
+		record, err := scan(rows)
+		if err != nil {
+			return count, err
+		}
+		if batch = append(batch, record); len(batch) == exportBatchSize {
+			if _, err := writer.Write(batch); err != nil {
+				return count, err
+			}
+			count += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	if _, err := writer.Write(batch); err != nil {
+		return count, err
+	}
+	count += len(batch)
+	return count, writer.Close()
+}
+
+// throttledWriter holds a stream to a byte rate, flushing as it goes so
+// clients receive data steadily
+type throttledWriter struct {
+	w           io.Writer
+	flush       func()
+	bytesPerSec int
+	start       time.Time
+	written     int
+	unflushed   int
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.written += n
+	if t.unflushed += n; t.unflushed >= exportFlushBytes && t.flush != nil {
+		t.flush()
+		t.unflushed = 0
+	}
+	due := time.Duration(float64(t.written) / float64(t.bytesPerSec) * float64(time.Second))
+	if wait := due - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
@@ -0,0 +1,715 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Limits that keep log-derived series from overwhelming ingestion
+const (
+	maxLogRules          = 200
+	maxLogPatternLength  = 1024
+	maxLogSeriesPerRule  = 1000
+	logMetricFlushPeriod = time.Minute
+	logOwnerTTL          = 10 * time.Minute // Caching of the tenant owning a job
+	logLateLineGrace     = 15 * time.Minute // Lines of a job its agent may still send after the job ended
+	logUnownedTTL        = time.Minute      // Caching of jobs with no known tenant yet
+)
+
+var logMetricNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.:]*$`)
+
+// LogEntry is a single log line submitted for metric extraction. Lines of jobs
+// are also kept for a while for tenant exports; other lines are not stored,
+// only the series derived from them are.
+type LogEntry struct {
+	Timestamp time.Time         `json:"timestamp"`
+	AgentID   string            `json:"agent_id,omitempty"`
+	JobID     string            `json:"job_id,omitempty"`
+	Source    string            `json:"source,omitempty"` // e.g. job, agent, service name
+	Stream    string            `json:"stream,omitempty"` // stdout, stderr
+	Message   string            `json:"message"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// LogMetricRule derives a metric series from log lines matching a pattern
+type LogMetricRule struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	MetricName  string            `json:"metric_name"`
+	Type        string            `json:"type"`                  // count, extract
+	Pattern     string            `json:"pattern"`               // RE2 regex a line must match
+	Field       string            `json:"field,omitempty"`       // extract: named capture group or top-level JSON key
+	Aggregation string            `json:"aggregation,omitempty"` // extract: avg, sum, min, max, last
+	Match       map[string]string `json:"match,omitempty"`       // Required entry labels, e.g. source=job
+	GroupBy     []string          `json:"group_by,omitempty"`    // Labels or capture groups copied into series tags
+	Unit        string            `json:"unit,omitempty"`
+	Enabled     bool              `json:"enabled"`
+	Global      bool              `json:"global,omitempty"` // Matches every tenant's lines; admins only
+	CreatedBy   string            `json:"created_by"`       // Tenant whose job lines the rule matches
+	CreatedAt   time.Time         `json:"created_at"`
+
+	re *regexp.Regexp
+}
+
+// logSeries accumulates one rule's values for one tag set during a flush period
+type logSeries struct {
+	tags  map[string]string
+	count int64
+	sum   float64
+	min   float64
+	max   float64
+	last  float64
+}
+
+// logOwner caches the tenant owning a job
+type logOwner struct {
+	tenant  string // Empty when the job has no known tenant
+	expires time.Time
+}
+
+// LogMetricEngine evaluates log metric rules at ingestion and emits
+// per-minute series. Rules belong to the tenant that created them and only
+// match lines of that tenant's jobs, as recorded in job_tenants; global
+// rules, which only admins create, match every line.
+type LogMetricEngine struct {
+	service  *TelemetryService
+	rules    map[string]*LogMetricRule
+	series   map[string]map[string]*logSeries // rule ID -> series key -> series
+	mu       sync.Mutex
+	owners   map[string]logOwner // by job ID
+	ownersMu sync.Mutex
+
+	linesReceived prometheus.Counter
+	ruleMatches   *prometheus.CounterVec
+	seriesDropped *prometheus.CounterVec
+}
+
+// NewLogMetricEngine creates the engine and loads persisted rules
+func NewLogMetricEngine(s *TelemetryService) *LogMetricEngine {
+	e := &LogMetricEngine{
+		service: s,
+		rules:   make(map[string]*LogMetricRule),
+		series:  make(map[string]map[string]*logSeries),
+		owners:  make(map[string]logOwner),
+		linesReceived: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "telemetry_log_lines_received_total",
+			Help: "Total number of log lines evaluated against log metric rules",
+		}),
+		ruleMatches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_log_rule_matches_total",
+			Help: "Total number of log lines matched per log metric rule",
+		}, []string{"rule"}),
+		seriesDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_log_series_dropped_total",
+			Help: "Log lines dropped because a rule exceeded its series limit",
+		}, []string{"rule"}),
+	}
+	prometheus.MustRegister(e.linesReceived, e.ruleMatches, e.seriesDropped)
+
+	if err := e.loadRules(); err != nil {
+		slog.Error("Failed to load log metric rules", obs.KeyError, err)
+	}
+	return e
+}
+
+// validate checks a rule and compiles its pattern
+func (rule *LogMetricRule) validate() error {
+	if rule.Name == "" || rule.MetricName == "" {
+		return fmt.Errorf("name and metric_name are required")
+	}
+	if !logMetricNamePattern.MatchString(rule.MetricName) {
+		return fmt.Errorf("invalid metric_name %q", rule.MetricName)
+	}
+	if rule.Pattern == "" {
+		return fmt.Errorf("pattern is required")
+	}
+	if len(rule.Pattern) > maxLogPatternLength {
+		return fmt.Errorf("pattern exceeds %d characters", maxLogPatternLength)
+	}
+	re, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+	rule.re = re
+
+	switch rule.Type {
+	case "count":
+		rule.Field = ""
+		rule.Aggregation = ""
+	case "extract":
+		if rule.Field == "" {
+			return fmt.Errorf("extract rules require a field")
+		}
+		if rule.Aggregation == "" {
+			rule.Aggregation = "avg"
+		}
+		switch rule.Aggregation {
+		case "avg", "sum", "min", "max", "last":
+		default:
+			return fmt.Errorf("invalid aggregation %q", rule.Aggregation)
+		}
+	default:
+		return fmt.Errorf("type must be count or extract")
+	}
+	return nil
+}
+
+// Ingest evaluates log lines against the enabled rules of the tenants
+// owning them
+func (e *LogMetricEngine) Ingest(entries []LogEntry) {
+	e.linesReceived.Add(float64(len(entries)))
+	tenants := e.jobTenants(entries)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rule := range e.rules {
+		if !rule.Enabled {
+			continue
+		}
+		for i := range entries {
+			if !rule.Global && tenants[entries[i].JobID] != rule.CreatedBy {
+				continue
+			}
+			matched, dropped := e.evaluate(rule, &entries[i])
+			if matched {
+				e.ruleMatches.WithLabelValues(rule.ID).Inc()
+			}
+			if dropped {
+				e.seriesDropped.WithLabelValues(rule.ID).Inc()
+			}
+		}
+	}
+}
+
+// jobTenants returns the tenants owning the entries' jobs, by job ID
+func (e *LogMetricEngine) jobTenants(entries []LogEntry) map[string]string {
+	now := time.Now()
+	tenants := make(map[string]string)
+	var missing []string
+
+	e.ownersMu.Lock()
+	for _, entry := range entries {
+		if _, seen := tenants[entry.JobID]; seen || entry.JobID == "" {
+			continue
+		}
+		if owner, ok := e.owners[entry.JobID]; ok && now.Before(owner.expires) {
+			tenants[entry.JobID] = owner.tenant
+			continue
+		}
+		tenants[entry.JobID] = ""
+		missing = append(missing, entry.JobID)
+	}
+	e.ownersMu.Unlock()
+	if len(missing) == 0 {
+		return tenants
+	}
+
+	rows, err := e.service.db.Query(`SELECT job_id, tenant FROM job_tenants WHERE job_id = ANY($1)`, pq.Array(missing))
+	if err != nil {
+		// Lines of unresolved jobs only match global rules this time
+		slog.Error("Failed to look up job tenants for log metrics", obs.KeyError, err)
+		return tenants
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var jobID, tenant string
+		if err := rows.Scan(&jobID, &tenant); err == nil {
+			tenants[jobID] = tenant
+		}
+	}
+
+	e.ownersMu.Lock()
+	for _, jobID := range missing {
+		owner := logOwner{tenant: tenants[jobID], expires: now.Add(logOwnerTTL)}
+		if owner.tenant == "" {
+			owner.expires = now.Add(logUnownedTTL)
+		}
+		e.owners[jobID] = owner
+	}
+	e.ownersMu.Unlock()
+	return tenants
+}
+
+// evaluate applies one rule to one log line, reporting whether it matched and
+// whether the line was dropped by the series limit. Callers hold e.mu.
+func (e *LogMetricEngine) evaluate(rule *LogMetricRule, entry *LogEntry) (matched, dropped bool) {
+	for key, want := range rule.Match {
+		if entryLabel(entry, key) != want {
+			return false, false
+		}
+	}
+
+	groups := rule.re.FindStringSubmatch(entry.Message)
+	if groups == nil {
+		return false, false
+	}
+
+	value := 1.0
+	if rule.Type == "extract" {
+		v, ok := extractLogField(rule, entry.Message, groups)
+		if !ok {
+			return false, false
+		}
+		value = v
+	}
+
+	tags := map[string]string{"rule": rule.ID}
+	for _, key := range rule.GroupBy {
+		if idx := rule.re.SubexpIndex(key); idx > 0 {
+			tags[key] = groups[idx]
+		} else {
+			tags[key] = entryLabel(entry, key)
+		}
+	}
+
+	ruleSeries := e.series[rule.ID]
+	if ruleSeries == nil {
+		ruleSeries = make(map[string]*logSeries)
+		e.series[rule.ID] = ruleSeries
+	}
+	key := seriesKey(tags)
+	series, exists := ruleSeries[key]
+	if !exists {
+		if len(ruleSeries) >= maxLogSeriesPerRule {
+			return true, true
+		}
+		series = &logSeries{tags: tags, min: value, max: value}
+		ruleSeries[key] = series
+	}
+
+	series.count++
+	series.sum += value
+	series.min = math.Min(series.min, value)
+	series.max = math.Max(series.max, value)
+	series.last = value
+	return true, false
+}
+
+// entryLabel resolves a label name against a log entry
+func entryLabel(entry *LogEntry, key string) string {
+	switch key {
+	case "agent_id":
+		return entry.AgentID
+	case "job_id":
+		return entry.JobID
+	case "source":
+		return entry.Source
+	case "stream":
+		return entry.Stream
+	}
+	return entry.Labels[key]
+}
+
+// extractLogField reads a rule's numeric field from a capture group or a JSON log line
+func extractLogField(rule *LogMetricRule, message string, groups []string) (float64, bool) {
+	if idx := rule.re.SubexpIndex(rule.Field); idx > 0 {
+		v, err := strconv.ParseFloat(groups[idx], 64)
+		return v, err == nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(message), &fields); err != nil {
+		return 0, false
+	}
+	switch v := fields[rule.Field].(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// seriesKey builds a stable key for a tag set
+func seriesKey(tags map[string]string) string {
+	data, _ := json.Marshal(tags) // map keys are marshalled in sorted order
+	return string(data)
+}
+
+// run flushes accumulated series into the metric pipeline every period
+func (e *LogMetricEngine) run() {
+	ticker := time.NewTicker(logMetricFlushPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		e.flush(time.Now())
+	}
+}
+
+// flush converts the current period's series into regular metric points
+func (e *LogMetricEngine) flush(now time.Time) {
+	e.mu.Lock()
+	var points []MetricPoint
+	for ruleID, ruleSeries := range e.series {
+		rule, exists := e.rules[ruleID]
+		if !exists {
+			continue
+		}
+		for _, series := range ruleSeries {
+			points = append(points, rule.point(series, now))
+		}
+	}
+	e.series = make(map[string]map[string]*logSeries)
+	e.mu.Unlock()
+
+	e.ownersMu.Lock()
+	for jobID, owner := range e.owners {
+		if now.After(owner.expires) {
+			delete(e.owners, jobID)
+		}
+	}
+	e.ownersMu.Unlock()
+
+	if len(points) == 0 {
+		return
+	}
+
+	s := e.service
+	buffered := make([]*MetricPoint, len(points))
+	for i := range points {
+		buffered[i] = &points[i]
+	}
+	s.ingest.Add(buffered, SourceInternal)
+
+	go s.streamMetrics(points)
+}
+
+// point renders one series as a metric point
+func (rule *LogMetricRule) point(series *logSeries, now time.Time) MetricPoint {
+	point := MetricPoint{
+		Name:      rule.MetricName,
+		Tags:      series.tags,
+		Timestamp: now,
+		Unit:      rule.Unit,
+		Fields: map[string]interface{}{
+			"count": series.count,
+			"sum":   series.sum,
+			"min":   series.min,
+			"max":   series.max,
+		},
+		Description: fmt.Sprintf("Derived from logs by rule %s", rule.Name),
+	}
+
+	if rule.Type == "count" {
+		point.Value = float64(series.count)
+		point.MetricType = "counter"
+		if point.Unit == "" {
+			point.Unit = "lines/min"
+		}
+		return point
+	}
+
+	point.MetricType = "gauge"
+	switch rule.Aggregation {
+	case "sum":
+		point.Value = series.sum
+	case "min":
+		point.Value = series.min
+	case "max":
+		point.Value = series.max
+	case "last":
+		point.Value = series.last
+	default:
+		point.Value = series.sum / float64(series.count)
+	}
+	return point
+}
+
+// HTTP Handlers
+
+// agentLogEntries keeps the lines an agent may send, its own and those of
+// jobs it runs or ran in the last logLateLineGrace, and returns how many it
+// refused
+func (s *TelemetryService) agentLogEntries(ctx context.Context, agentID string, entries []LogEntry) ([]LogEntry, int, error) {
+	seen := make(map[string]bool)
+	var jobIDs []string
+	for _, entry := range entries {
+		if entry.JobID != "" && !seen[entry.JobID] {
+			seen[entry.JobID] = true
+			jobIDs = append(jobIDs, entry.JobID)
+		}
+	}
+
+	assigned := make(map[string]bool)
+	if len(jobIDs) > 0 {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT DISTINCT job_id FROM agent_job_runs
+			WHERE agent_id = $1 AND job_id = ANY($2)
+				AND (ended_at IS NULL OR ended_at > $3)
+		`, agentID, pq.Array(jobIDs), time.Now().Add(-logLateLineGrace))
+		if err != nil {
+			return nil, 0, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var jobID string
+			if err := rows.Scan(&jobID); err != nil {
+				return nil, 0, err
+			}
+			assigned[jobID] = true
+		}
+		if err := rows.Err(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.JobID != "" && !assigned[entry.JobID] {
+			continue
+		}
+		entry.AgentID = agentID
+		kept = append(kept, entry)
+	}
+	return kept, len(entries) - len(kept), nil
+}
+
+// IngestLogs evaluates submitted log lines against log metric rules
+func (s *TelemetryService) IngestLogs(w http.ResponseWriter, r *http.Request) {
+	var entries []LogEntry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Log lines become standard priority metrics, so they wait while those are deferred
+	if ok, retryAfter := s.ingest.Admitting(PriorityStandard); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		http.Error(w, "Telemetry ingestion is behind, retry later", http.StatusTooManyRequests)
+		return
+	}
+
+	// Agents send only the lines of their own jobs; services are trusted
+	rejected := 0
+	if claims, ok := r.Context().Value("claims").(*Claims); ok {
+		var err error
+		entries, rejected, err = s.agentLogEntries(r.Context(), claims.Subject, entries)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Failed to check log line jobs", "agent_id", claims.Subject, obs.KeyError, err)
+			http.Error(w, "Failed to check log lines", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	now := time.Now()
+	for i := range entries {
+		if entries[i].Timestamp.IsZero() {
+			entries[i].Timestamp = now
+		}
+	}
+	s.logMetrics.Ingest(entries)
+	s.exports.retainLogs(entries)
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "accepted",
+		"count":    len(entries),
+		"rejected": rejected,
+	})
+}
+
+// CreateLogMetricRule creates a rule that derives metrics from log lines
+func (s *TelemetryService) CreateLogMetricRule(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	var rule LogMetricRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := rule.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if rule.Global && claims.Role != "admin" {
+		http.Error(w, "Admin access required for global rules", http.StatusForbidden)
+		return
+	}
+
+	rule.ID = generateID()
+	rule.Enabled = true
+	rule.CreatedBy = claims.UserID
+	rule.CreatedAt = time.Now()
+
+	e := s.logMetrics
+	e.mu.Lock()
+	if len(e.rules) >= maxLogRules {
+		e.mu.Unlock()
+		http.Error(w, "Log metric rule limit reached", http.StatusConflict)
+		return
+	}
+	e.rules[rule.ID] = &rule
+	e.mu.Unlock()
+
+	if err := e.saveRule(&rule); err != nil {
+		e.mu.Lock()
+		delete(e.rules, rule.ID)
+		e.mu.Unlock()
+		http.Error(w, "Failed to save rule", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+// ListLogMetricRules returns the caller's log metric rules; admins see all
+func (s *TelemetryService) ListLogMetricRules(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+
+	e := s.logMetrics
+	e.mu.Lock()
+	rules := make([]LogMetricRule, 0)
+	for _, rule := range e.rules {
+		if rule.CreatedBy == claims.UserID || claims.Role == "admin" {
+			rules = append(rules, *rule)
+		}
+	}
+	e.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// DeleteLogMetricRule removes a log metric rule; its existing series are kept
+func (s *TelemetryService) DeleteLogMetricRule(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	ruleID := mux.Vars(r)["id"]
+
+	e := s.logMetrics
+	e.mu.Lock()
+	rule, exists := e.rules[ruleID]
+	if !exists {
+		e.mu.Unlock()
+		http.Error(w, "Rule not found", http.StatusNotFound)
+		return
+	}
+	if rule.CreatedBy != claims.UserID && claims.Role != "admin" {
+		e.mu.Unlock()
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+	delete(e.rules, ruleID)
+	delete(e.series, ruleID)
+	e.mu.Unlock()
+
+	if _, err := s.db.Exec(`UPDATE log_metric_rules SET active = false WHERE id = $1`, ruleID); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to delete log metric rule", "rule_id", ruleID, obs.KeyError, err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TestLogMetricRule dry-runs a rule against sample lines without emitting series
+func (s *TelemetryService) TestLogMetricRule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rule  LogMetricRule `json:"rule"`
+		Lines []LogEntry    `json:"lines"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Rule.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Rule.ID = "test"
+
+	e := &LogMetricEngine{series: make(map[string]map[string]*logSeries)}
+	matched := 0
+	for i := range req.Lines {
+		if ok, _ := e.evaluate(&req.Rule, &req.Lines[i]); ok {
+			matched++
+		}
+	}
+
+	points := make([]MetricPoint, 0)
+	for _, series := range e.series["test"] {
+		points = append(points, req.Rule.point(series, time.Now()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"lines":   len(req.Lines),
+		"matched": matched,
+		"series":  points,
+	})
+}
+
+// Persistence
+
+func (e *LogMetricEngine) loadRules() error {
+	rows, err := e.service.db.Query(`
+		SELECT id, name, metric_name, type, pattern, field, aggregation,
+			match, group_by, unit, enabled, global, created_by, created_at
+		FROM log_metric_rules WHERE active = true
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule LogMetricRule
+		var matchJSON, groupByJSON []byte
+		var field, aggregation, unit sql.NullString
+		var global sql.NullBool
+
+		err := rows.Scan(&rule.ID, &rule.Name, &rule.MetricName, &rule.Type, &rule.Pattern,
+			&field, &aggregation, &matchJSON, &groupByJSON, &unit, &rule.Enabled,
+			&global, &rule.CreatedBy, &rule.CreatedAt)
+		if err != nil {
+			continue
+		}
+		rule.Field = field.String
+		rule.Aggregation = aggregation.String
+		rule.Unit = unit.String
+		rule.Global = global.Bool
+		json.Unmarshal(matchJSON, &rule.Match)
+		json.Unmarshal(groupByJSON, &rule.GroupBy)
+
+		if err := rule.validate(); err != nil {
+			slog.Warn("Skipping invalid log metric rule", "rule_id", rule.ID, obs.KeyError, err)
+			continue
+		}
+
+		e.mu.Lock()
+		e.rules[rule.ID] = &rule
+		e.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (e *LogMetricEngine) saveRule(rule *LogMetricRule) error {
+	matchJSON, _ := json.Marshal(rule.Match)
+	groupByJSON, _ := json.Marshal(rule.GroupBy)
+
+	_, err := e.service.db.Exec(`
+		INSERT INTO log_metric_rules (id, name, metric_name, type, pattern, field,
+			aggregation, match, group_by, unit, enabled, global, created_by, created_at, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, true)
+	`, rule.ID, rule.Name, rule.MetricName, rule.Type, rule.Pattern, rule.Field,
+		rule.Aggregation, matchJSON, groupByJSON, rule.Unit, rule.Enabled,
+		rule.Global, rule.CreatedBy, rule.CreatedAt)
+
+	return err
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxCachedQueries bounds the number of cached query results
+const maxCachedQueries = 1000
+
+// queryCacheEntry is a cached, already-encoded query result and where it was
+// read from, so hits carry the same staleness annotations
+type queryCacheEntry struct {
+	body      []byte
+	source    string
+	asOf      time.Time
+	expiresAt time.Time
+}
+
+// RunningQuery describes an in-flight metrics query
+type RunningQuery struct {
+	ID        string    `json:"id"`
+	Tenant    string    `json:"tenant"`
+	Query     string    `json:"query"`
+	StartedAt time.Time `json:"started_at"`
+	Elapsed   string    `json:"elapsed"`
+
+	cancel context.CancelFunc
+}
+
+// QueryLimiter caches query results and bounds concurrent queries per tenant
+type QueryLimiter struct {
+	cacheTTL      time.Duration
+	maxConcurrent int
+	queueTimeout  time.Duration
+	slowQuery     time.Duration
+
+	cache   map[string]queryCacheEntry
+	slots   map[string]chan struct{} // tenant -> concurrency semaphore
+	running map[string]*RunningQuery
+	mu      sync.Mutex
+
+	cacheRequests *prometheus.CounterVec
+	slowQueries   prometheus.Counter
+	rejected      *prometheus.CounterVec
+}
+
+// NewQueryLimiter creates a limiter configured from the environment
+func NewQueryLimiter() *QueryLimiter {
+	l := &QueryLimiter{
+		cacheTTL:      envDuration("TELEMETRY_QUERY_CACHE_TTL", 10*time.Second),
+		maxConcurrent: 4,
+		queueTimeout:  envDuration("TELEMETRY_QUERY_QUEUE_TIMEOUT", 10*time.Second),
+		slowQuery:     envDuration("TELEMETRY_SLOW_QUERY_THRESHOLD", 2*time.Second),
+		cache:         make(map[string]queryCacheEntry),
+		slots:         make(map[string]chan struct{}),
+		running:       make(map[string]*RunningQuery),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_query_cache_requests_total",
+			Help: "Metrics query cache lookups",
+		}, []string{"result"}),
+		slowQueries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "telemetry_slow_queries_total",
+			Help: "Metrics queries slower than the slow query threshold",
+		}),
+		rejected: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "telemetry_queries_rejected_total",
+			Help: "Metrics queries rejected by the concurrency limit or killed",
+		}, []string{"reason"}),
+	}
+	if v, err := strconv.Atoi(os.Getenv("TELEMETRY_MAX_CONCURRENT_QUERIES")); err == nil && v > 0 {
+		l.maxConcurrent = v
+	}
+	prometheus.MustRegister(l.cacheRequests, l.slowQueries, l.rejected)
+
+	go l.evictExpired()
+	return l
+}
+
+// envDuration reads a duration from the environment, falling back to a default
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+// cacheKey normalizes a query so equivalent requests share a cache entry. Relative
+// ranges (no explicit start/end) are snapped to the cache TTL so auto-refreshing
+// dashboards hit the same entry.
+func (l *QueryLimiter) cacheKey(metric, agentID string, tags map[string]string,
+	aggregation, interval string, start, end time.Time, relative bool) string {
+	if relative && l.cacheTTL > 0 {
+		span := end.Sub(start)
+		end = end.Truncate(l.cacheTTL)
+		start = end.Add(-span)
+	} else {
+		start = start.Truncate(time.Second)
+		end = end.Truncate(time.Second)
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tagPairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		tagPairs = append(tagPairs, k+"="+tags[k])
+	}
+
+	return fmt.Sprintf("%s|%s|%v|%s|%s|%d|%d", metric, agentID, tagPairs,
+		aggregation, interval, start.Unix(), end.Unix())
+}
+
+// cached returns a fresh cached result
+func (l *QueryLimiter) cached(key string) (queryCacheEntry, bool) {
+	if l.cacheTTL == 0 {
+		return queryCacheEntry{}, false
+	}
+
+	l.mu.Lock()
+	entry, ok := l.cache[key]
+	l.mu.Unlock()
+
+	if ok && time.Now().Before(entry.expiresAt) {
+		l.cacheRequests.WithLabelValues("hit").Inc()
+		return entry, true
+	}
+	l.cacheRequests.WithLabelValues("miss").Inc()
+	return queryCacheEntry{}, false
+}
+
+// store caches an encoded result
+func (l *QueryLimiter) store(key string, body []byte, read readTarget) {
+	if l.cacheTTL == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.cache) >= maxCachedQueries {
+		// Drop an arbitrary entry; the cache only smooths refresh bursts
+		for k := range l.cache {
+			delete(l.cache, k)
+			break
+		}
+	}
+	l.cache[key] = queryCacheEntry{
+		body:      body,
+		source:    read.source,
+		asOf:      read.asOf,
+		expiresAt: time.Now().Add(l.cacheTTL),
+	}
+}
+
+func (l *QueryLimiter) evictExpired() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		l.mu.Lock()
+		for key, entry := range l.cache {
+			if now.After(entry.expiresAt) {
+				delete(l.cache, key)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// acquire waits for a query slot for the tenant and registers the query. The
+// returned context is cancelled when the query is killed; release must be called.
+func (l *QueryLimiter) acquire(ctx context.Context, tenant, query string) (context.Context, func(), error) {
+	l.mu.Lock()
+	slots, exists := l.slots[tenant]
+	if !exists {
+		slots = make(chan struct{}, l.maxConcurrent)
+		l.slots[tenant] = slots
+	}
+	l.mu.Unlock()
+
+	wait, cancelWait := context.WithTimeout(ctx, l.queueTimeout)
+	defer cancelWait()
+	select {
+	case slots <- struct{}{}:
+	case <-wait.Done():
+		l.rejected.WithLabelValues("queue_timeout").Inc()
+		return nil, nil, obs.Errorf(obs.CodeResourceExhausted, "too many concurrent queries")
+	}
+
+	queryCtx, cancel := context.WithCancel(ctx)
+	running := &RunningQuery{
+		ID:        generateID(),
+		Tenant:    tenant,
+		Query:     query,
+		StartedAt: time.Now(),
+		cancel:    cancel,
+	}
+	l.mu.Lock()
+	l.running[running.ID] = running
+	l.mu.Unlock()
+
+	release := func() {
+		cancel()
+		<-slots
+
+		l.mu.Lock()
+		delete(l.running, running.ID)
+		l.mu.Unlock()
+
+		if elapsed := time.Since(running.StartedAt); elapsed >= l.slowQuery {
+			l.slowQueries.Inc()
+			slog.WarnContext(ctx, "Slow query", "query_id", running.ID, "duration_ms", elapsed.Milliseconds(), "query", query)
+		}
+	}
+	return queryCtx, release, nil
+}
+
+// ListRunningQueries returns in-flight metrics queries (admin only)
+func (s *TelemetryService) ListRunningQueries(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	l := s.queryLimiter
+	now := time.Now()
+	l.mu.Lock()
+	queries := make([]RunningQuery, 0, len(l.running))
+	for _, q := range l.running {
+		view := *q
+		view.Elapsed = now.Sub(q.StartedAt).String()
+		queries = append(queries, view)
+	}
+	l.mu.Unlock()
+
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].StartedAt.Before(queries[j].StartedAt)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(queries)
+}
+
+// KillQuery cancels an in-flight metrics query (admin only)
+func (s *TelemetryService) KillQuery(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*Claims)
+	if claims.Role != "admin" {
+		http.Error(w, "Admin access required", http.StatusForbidden)
+		return
+	}
+
+	queryID := mux.Vars(r)["id"]
+
+	l := s.queryLimiter
+	l.mu.Lock()
+	q, exists := l.running[queryID]
+	l.mu.Unlock()
+	if !exists {
+		http.Error(w, "Query not found", http.StatusNotFound)
+		return
+	}
+
+	q.cancel()
+	l.rejected.WithLabelValues("killed").Inc()
+	slog.WarnContext(r.Context(), "Query killed", "query_id", queryID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,673 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reliabilityWindows are the windows a reliability report can cover
+var reliabilityWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+}
+
+const (
+	defaultReliabilityWindow = "7d"
+	reliabilityRetention     = "90 days"
+	latencyFlushPeriod       = time.Minute
+	maxProviderAgents        = 1000
+)
+
+// heartbeatBuckets are the upper bounds, in milliseconds, of the heartbeat
+// latency histogram. A last bucket counts everything slower.
+var heartbeatBuckets = []float64{50, 100, 250, 500, 1000, 2500, 5000}
+
+// ReliabilityReport is how dependable an agent, or all of a provider's
+// agents, was over a window. Rates are nil when there is nothing to base
+// them on, such as an MTBF for an agent that never failed.
+type ReliabilityReport struct {
+	AgentID          string              `json:"agent_id,omitempty"`
+	ProviderID       string              `json:"provider_id,omitempty"`
+	Window           string              `json:"window"`
+	Start            time.Time           `json:"start"`
+	End              time.Time           `json:"end"`
+	ObservedSeconds  float64             `json:"observed_seconds"` // Time in the window since the agent was first seen
+	DowntimeSeconds  float64             `json:"downtime_seconds"`
+	UptimePercent    *float64            `json:"uptime_percent"`
+	Failures         int                 `json:"failures"` // Times the agent stopped heartbeating
+	MTBFSeconds      *float64            `json:"mtbf_seconds"`
+	JobRuns          int                 `json:"job_runs"`
+	JobsInterrupted  int                 `json:"jobs_interrupted"` // Runs cut short by an outage or a drain
+	InterruptionRate *float64            `json:"interruption_rate"`
+	HeartbeatLatency LatencyDistribution `json:"heartbeat_latency"`
+	Agents           []ReliabilityReport `json:"agents,omitempty"` // Provider reports: each agent's report
+}
+
+// LatencyDistribution summarises heartbeat latencies. Percentiles are
+// interpolated within histogram buckets.
+type LatencyDistribution struct {
+	Count   int64           `json:"count"`
+	MeanMs  float64         `json:"mean_ms"`
+	P50Ms   float64         `json:"p50_ms"`
+	P90Ms   float64         `json:"p90_ms"`
+	P99Ms   float64         `json:"p99_ms"`
+	Buckets []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket counts heartbeats at most LeMs late; the last bucket has no
+// bound
+type LatencyBucket struct {
+	LeMs  *float64 `json:"le_ms"`
+	Count int64    `json:"count"`
+}
+
+// latencyHistogram counts heartbeats per bucket of heartbeatBuckets
+type latencyHistogram struct {
+	counts []int64
+	sumMs  float64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{counts: make([]int64, len(heartbeatBuckets)+1)}
+}
+
+func (h *latencyHistogram) observe(ms float64) {
+	i := 0
+	for i < len(heartbeatBuckets) && ms > heartbeatBuckets[i] {
+		i++
+	}
+	h.counts[i]++
+	h.sumMs += ms
+}
+
+func (h *latencyHistogram) add(counts []int64, sumMs float64) {
+	for i := 0; i < len(h.counts) && i < len(counts); i++ {
+		h.counts[i] += counts[i]
+	}
+	h.sumMs += sumMs
+}
+
+func (h *latencyHistogram) total() int64 {
+	var n int64
+	for _, c := range h.counts {
+		n += c
+	}
+	return n
+}
+
+// quantile estimates the q-th latency by interpolating within its bucket.
+// Latencies in the unbounded bucket are reported as its lower bound.
+func (h *latencyHistogram) quantile(q float64) float64 {
+	total := h.total()
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var seen float64
+	for i, c := range h.counts {
+		if c == 0 || seen+float64(c) < rank {
+			seen += float64(c)
+			continue
+		}
+		if i == len(heartbeatBuckets) {
+			return heartbeatBuckets[i-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = heartbeatBuckets[i-1]
+		}
+		return lower + (heartbeatBuckets[i]-lower)*(rank-seen)/float64(c)
+	}
+	return heartbeatBuckets[len(heartbeatBuckets)-1]
+}
+
+func (h *latencyHistogram) distribution() LatencyDistribution {
+	d := LatencyDistribution{Count: h.total(), Buckets: make([]LatencyBucket, len(h.counts))}
+	for i, c := range h.counts {
+		d.Buckets[i].Count = c
+		if i < len(heartbeatBuckets) {
+			d.Buckets[i].LeMs = &heartbeatBuckets[i]
+		}
+	}
+	if d.Count > 0 {
+		d.MeanMs = h.sumMs / float64(d.Count)
+		d.P50Ms = h.quantile(0.5)
+		d.P90Ms = h.quantile(0.9)
+		d.P99Ms = h.quantile(0.99)
+	}
+	return d
+}
+
+// agentReliability is what a report is computed from for one agent
+type agentReliability struct {
+	firstSeen   time.Time
+	downtime    time.Duration
+	failures    int
+	runs        int
+	interrupted int
+	latency     *latencyHistogram
+}
+
+type latencyKey struct {
+	agentID string
+	hour    time.Time
+}
+
+// AgentReliability derives agent reliability from telemetry: outages from
+// the resource service's liveness events, job runs and interruptions from
+// job events and drains, heartbeat latency from the heartbeats themselves,
+// and providers from agent ownership.
+//
+// Heartbeat latency is the time from the agent stamping a heartbeat to
+// telemetry receiving it, so it includes any clock skew between the two.
+// Latencies are kept as hourly histograms per agent, so reports over long
+// windows do not depend on raw metric retention.
+type AgentReliability struct {
+	service *TelemetryService
+
+	mu      sync.Mutex
+	latency map[latencyKey]*latencyHistogram
+	seen    map[string]bool // Agents whose first heartbeat is recorded
+}
+
+// NewAgentReliability creates the reliability tracker
+func NewAgentReliability(s *TelemetryService) *AgentReliability {
+	return &AgentReliability{
+		service: s,
+		latency: make(map[latencyKey]*latencyHistogram),
+		seen:    make(map[string]bool),
+	}
+}
+
+// subscribe follows the events reliability is derived from
+func (a *AgentReliability) subscribe() {
+	s := a.service
+
+	s.nats.QueueSubscribe("agent.heartbeat", "telemetry-service", func(msg *nats.Msg) {
+		var heartbeat struct {
+			AgentID   string    `json:"agent_id"`
+			Timestamp time.Time `json:"timestamp"`
+		}
+		if err := json.Unmarshal(msg.Data, &heartbeat); err != nil || heartbeat.AgentID == "" {
+			return
+		}
+		a.heartbeat(heartbeat.AgentID, heartbeat.Timestamp, time.Now())
+	})
+
+	s.bus.Subscribe("agent.trust", func(ctx context.Context, msg *nats.Msg) error {
+		var event struct {
+			AgentID string `json:"agent_id"`
+			OwnerID string `json:"owner_id"`
+		}
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		if event.AgentID == "" {
+			return obs.Errorf(obs.CodeInvalidArgument, "trust event has no agent_id")
+		}
+		if event.OwnerID == "" {
+			_, err := s.db.ExecContext(ctx, `UPDATE reliability_agents SET provider_id = NULL WHERE agent_id = $1`, event.AgentID)
+			return err
+		}
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO reliability_agents (agent_id, provider_id) VALUES ($1, $2)
+			ON CONFLICT (agent_id) DO UPDATE SET provider_id = EXCLUDED.provider_id
+		`, event.AgentID, event.OwnerID)
+		return err
+	})
+
+	// An agent that stops heartbeating has failed, and interrupts what it runs
+	s.bus.Subscribe("agent.expired", func(ctx context.Context, msg *nats.Msg) error {
+		var event struct {
+			AgentID   string    `json:"agent_id"`
+			LastSeen  time.Time `json:"last_seen"`
+			Timestamp time.Time `json:"timestamp"`
+		}
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		if event.AgentID == "" {
+			return obs.Errorf(obs.CodeInvalidArgument, "liveness event has no agent_id")
+		}
+		if event.LastSeen.IsZero() {
+			event.LastSeen = event.Timestamp
+		}
+		if _, err := s.db.ExecContext(ctx, `
+			INSERT INTO agent_outages (agent_id, started_at) VALUES ($1, $2)
+			ON CONFLICT (agent_id, started_at) DO NOTHING
+		`, event.AgentID, event.LastSeen); err != nil {
+			return err
+		}
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE agent_job_runs SET interrupted = true
+			WHERE agent_id = $1 AND ended_at IS NULL AND started_at < $2
+		`, event.AgentID, event.Timestamp)
+		return err
+	})
+
+	s.bus.Subscribe("agent.restored", func(ctx context.Context, msg *nats.Msg) error {
+		var event struct {
+			AgentID   string    `json:"agent_id"`
+			Timestamp time.Time `json:"timestamp"`
+		}
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		if event.AgentID == "" {
+			return obs.Errorf(obs.CodeInvalidArgument, "liveness event has no agent_id")
+		}
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE agent_outages SET ended_at = $2
+			WHERE agent_id = $1 AND ended_at IS NULL AND started_at <= $2
+		`, event.AgentID, event.Timestamp)
+		return err
+	})
+
+	s.bus.Subscribe("job.scheduled", func(ctx context.Context, msg *nats.Msg) error {
+		var job struct {
+			ID              string     `json:"id"`
+			AssignedAgentID string     `json:"assigned_agent_id"`
+			ScheduledAt     *time.Time `json:"scheduled_at"`
+		}
+		if err := json.Unmarshal(msg.Data, &job); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		if job.ID == "" || job.AssignedAgentID == "" || job.ScheduledAt == nil {
+			return nil
+		}
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO agent_job_runs (job_id, agent_id, started_at) VALUES ($1, $2, $3)
+			ON CONFLICT (job_id, agent_id, started_at) DO NOTHING
+		`, job.ID, job.AssignedAgentID, *job.ScheduledAt)
+		return err
+	})
+
+	for _, outcome := range []string{"completed", "failed", "cancelled"} {
+		outcome := outcome
+		s.bus.Subscribe("job."+outcome, func(ctx context.Context, msg *nats.Msg) error {
+			var job struct {
+				ID          string     `json:"id"`
+				CompletedAt *time.Time `json:"completed_at"`
+			}
+			if err := json.Unmarshal(msg.Data, &job); err != nil {
+				return obs.Wrap(obs.CodeInvalidArgument, err)
+			}
+			endedAt := time.Now()
+			if job.CompletedAt != nil {
+				endedAt = *job.CompletedAt
+			}
+			_, err := s.db.ExecContext(ctx, `
+				UPDATE agent_job_runs SET ended_at = $2, outcome = $3
+				WHERE job_id = $1 AND ended_at IS NULL
+			`, job.ID, endedAt, outcome)
+			return err
+		})
+	}
+
+	// Drains move jobs to other agents, interrupting their runs
+	s.nats.QueueSubscribe("job.rescheduled", "telemetry-service", func(msg *nats.Msg) {
+		var job struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(msg.Data, &job); err != nil || job.ID == "" {
+			return
+		}
+		if _, err := s.db.Exec(`
+			UPDATE agent_job_runs SET ended_at = NOW(), outcome = 'rescheduled', interrupted = true
+			WHERE job_id = $1 AND ended_at IS NULL
+		`, job.ID); err != nil {
+			slog.Error("Failed to record interrupted job run", "job_id", job.ID, obs.KeyError, err)
+		}
+	})
+}
+
+// heartbeat records a heartbeat's latency, and the agent's first sighting
+func (a *AgentReliability) heartbeat(agentID string, sentAt, receivedAt time.Time) {
+	latency := float64(receivedAt.Sub(sentAt)) / float64(time.Millisecond)
+	if sentAt.IsZero() || latency < 0 {
+		latency = 0
+	}
+
+	a.mu.Lock()
+	key := latencyKey{agentID: agentID, hour: receivedAt.UTC().Truncate(time.Hour)}
+	h, exists := a.latency[key]
+	if !exists {
+		h = newLatencyHistogram()
+		a.latency[key] = h
+	}
+	h.observe(latency)
+	first := !a.seen[agentID]
+	a.seen[agentID] = true
+	a.mu.Unlock()
+
+	if first {
+		if _, err := a.service.db.Exec(`
+			INSERT INTO reliability_agents (agent_id, first_seen) VALUES ($1, $2)
+			ON CONFLICT (agent_id) DO UPDATE SET first_seen = LEAST(reliability_agents.first_seen, EXCLUDED.first_seen)
+		`, agentID, receivedAt); err != nil {
+			slog.Error("Failed to record agent", "agent_id", agentID, obs.KeyError, err)
+			a.mu.Lock()
+			delete(a.seen, agentID)
+			a.mu.Unlock()
+		}
+	}
+}
+
+// run flushes heartbeat latencies until the process exits
+func (a *AgentReliability) run() {
+	ticker := time.NewTicker(latencyFlushPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		a.flushLatency()
+	}
+}
+
+// flushLatency adds the buffered histograms to the stored ones
+func (a *AgentReliability) flushLatency() {
+	a.mu.Lock()
+	pending := a.latency
+	a.latency = make(map[latencyKey]*latencyHistogram)
+	a.mu.Unlock()
+
+	for key, h := range pending {
+		_, err := a.service.db.Exec(`
+			INSERT INTO agent_heartbeat_latency (agent_id, hour, buckets, count, sum_ms)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (agent_id, hour) DO UPDATE SET
+				buckets = (
+					SELECT array_agg(stored + added ORDER BY i)
+					FROM unnest(agent_heartbeat_latency.buckets, EXCLUDED.buckets) WITH ORDINALITY AS b(stored, added, i)
+				),
+				count = agent_heartbeat_latency.count + EXCLUDED.count,
+				sum_ms = agent_heartbeat_latency.sum_ms + EXCLUDED.sum_ms
+		`, key.agentID, key.hour, pq.Array(h.counts), h.total(), h.sumMs)
+		if err != nil {
+			slog.Error("Failed to store heartbeat latency", "agent_id", key.agentID, obs.KeyError, err)
+		}
+	}
+}
+
+// cleanup drops reliability history older than any report window
+func (a *AgentReliability) cleanup() {
+	for _, query := range []string{
+		`DELETE FROM agent_outages WHERE ended_at < NOW() - INTERVAL '` + reliabilityRetention + `'`,
+		`DELETE FROM agent_job_runs WHERE started_at < NOW() - INTERVAL '` + reliabilityRetention + `'`,
+		`DELETE FROM agent_heartbeat_latency WHERE hour < NOW() - INTERVAL '` + reliabilityRetention + `'`,
+	} {
+		if _, err := a.service.db.Exec(query); err != nil {
+			slog.Error("Failed to clean up reliability history", obs.KeyError, err)
+		}
+	}
+}
+
+// load reads what reports are computed from for agents over [start, end).
+// Agents never seen are left out.
+func (a *AgentReliability) load(ctx context.Context, db *sql.DB, agentIDs []string, start, end time.Time) (map[string]*agentReliability, error) {
+	stats := make(map[string]*agentReliability)
+	ids := pq.Array(agentIDs)
+
+	rows, err := db.QueryContext(ctx, `SELECT agent_id, first_seen FROM reliability_agents WHERE agent_id = ANY($1)`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load agents: %w", err)
+	}
+	for rows.Next() {
+		var agentID string
+		var firstSeen time.Time
+		if err := rows.Scan(&agentID, &firstSeen); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats[agentID] = &agentReliability{firstSeen: firstSeen, latency: newLatencyHistogram()}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Outages still open count as down until the end of the window
+	rows, err = db.QueryContext(ctx, `
+		SELECT agent_id,
+			COALESCE(SUM(EXTRACT(EPOCH FROM LEAST(COALESCE(ended_at, $3), $3) - GREATEST(started_at, $2))), 0),
+			COUNT(*) FILTER (WHERE started_at >= $2)
+		FROM agent_outages
+		WHERE agent_id = ANY($1) AND started_at < $3 AND COALESCE(ended_at, $3) > $2
+		GROUP BY agent_id
+	`, ids, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outages: %w", err)
+	}
+	for rows.Next() {
+		var agentID string
+		var seconds float64
+		var failures int
+		if err := rows.Scan(&agentID, &seconds, &failures); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if st, ok := stats[agentID]; ok {
+			st.downtime = time.Duration(seconds * float64(time.Second))
+			st.failures = failures
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT agent_id, COUNT(*), COUNT(*) FILTER (WHERE interrupted)
+		FROM agent_job_runs
+		WHERE agent_id = ANY($1) AND started_at >= $2 AND started_at < $3
+		GROUP BY agent_id
+	`, ids, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job runs: %w", err)
+	}
+	for rows.Next() {
+		var agentID string
+		var runs, interrupted int
+		if err := rows.Scan(&agentID, &runs, &interrupted); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if st, ok := stats[agentID]; ok {
+			st.runs, st.interrupted = runs, interrupted
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT agent_id, buckets, sum_ms
+		FROM agent_heartbeat_latency
+		WHERE agent_id = ANY($1) AND hour >= $2 AND hour < $3
+	`, ids, start.UTC().Truncate(time.Hour), end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load heartbeat latency: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var agentID string
+		var counts []int64
+		var sumMs float64
+		if err := rows.Scan(&agentID, pq.Array(&counts), &sumMs); err != nil {
+			return nil, err
+		}
+		if st, ok := stats[agentID]; ok {
+			st.latency.add(counts, sumMs)
+		}
+	}
+	return stats, rows.Err()
+}
+
+// report combines the reliability of one or more agents over [start, end)
+func report(stats []*agentReliability, start, end time.Time) ReliabilityReport {
+	r := ReliabilityReport{Start: start, End: end}
+	latency := newLatencyHistogram()
+	for _, st := range stats {
+		from := start
+		if st.firstSeen.After(from) {
+			from = st.firstSeen
+		}
+		if observed := end.Sub(from); observed > 0 {
+			r.ObservedSeconds += observed.Seconds()
+		}
+		r.DowntimeSeconds += st.downtime.Seconds()
+		r.Failures += st.failures
+		r.JobRuns += st.runs
+		r.JobsInterrupted += st.interrupted
+		latency.add(st.latency.counts, st.latency.sumMs)
+	}
+	r.DowntimeSeconds = math.Min(r.DowntimeSeconds, r.ObservedSeconds)
+
+	up := r.ObservedSeconds - r.DowntimeSeconds
+	if r.ObservedSeconds > 0 {
+		uptime := 100 * up / r.ObservedSeconds
+		r.UptimePercent = &uptime
+	}
+	if r.Failures > 0 {
+		mtbf := up / float64(r.Failures)
+		r.MTBFSeconds = &mtbf
+	}
+	if r.JobRuns > 0 {
+		rate := float64(r.JobsInterrupted) / float64(r.JobRuns)
+		r.InterruptionRate = &rate
+	}
+	r.HeartbeatLatency = latency.distribution()
+	return r
+}
+
+// reliabilityWindow reads the window a report request asks for
+func reliabilityWindow(r *http.Request) (string, time.Duration, error) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		window = defaultReliabilityWindow
+	}
+	d, ok := reliabilityWindows[window]
+	if !ok {
+		return "", 0, obs.Errorf(obs.CodeInvalidArgument, "window must be one of 24h, 7d, 30d or 90d")
+	}
+	return window, d, nil
+}
+
+// HTTP Handlers
+
+// GetAgentReliability reports an agent's reliability over a window
+// Query: window=24h|7d|30d|90d
+func (a *AgentReliability) GetAgentReliability(w http.ResponseWriter, r *http.Request) {
+	agentID := mux.Vars(r)["agent_id"]
+	window, d, err := reliabilityWindow(r)
+	if err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+	end := time.Now()
+	start := end.Add(-d)
+
+	timer := prometheus.NewTimer(a.service.queryDuration.WithLabelValues("reliability"))
+	defer timer.ObserveDuration()
+
+	read := a.service.reads.forRange(end)
+	stats, err := a.load(r.Context(), read.db, []string{agentID}, start, end)
+	if err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+	st, exists := stats[agentID]
+	if !exists {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	result := report([]*agentReliability{st}, start, end)
+	result.AgentID = agentID
+	result.Window = window
+
+	w.Header().Set("Content-Type", "application/json")
+	annotate(w, read.source, read.asOf)
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetProviderReliability reports the combined reliability of a provider's
+// agents over a window, with each agent's own report
+// Query: window=24h|7d|30d|90d
+func (a *AgentReliability) GetProviderReliability(w http.ResponseWriter, r *http.Request) {
+	providerID := mux.Vars(r)["provider_id"]
+	window, d, err := reliabilityWindow(r)
+	if err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+	end := time.Now()
+	start := end.Add(-d)
+
+	timer := prometheus.NewTimer(a.service.queryDuration.WithLabelValues("reliability"))
+	defer timer.ObserveDuration()
+
+	read := a.service.reads.forRange(end)
+	rows, err := read.db.QueryContext(r.Context(), `
+		SELECT agent_id FROM reliability_agents WHERE provider_id = $1 ORDER BY agent_id LIMIT $2
+	`, providerID, maxProviderAgents)
+	if err != nil {
+		obs.WriteError(w, r, fmt.Errorf("failed to load provider agents: %w", err))
+		return
+	}
+	var agentIDs []string
+	for rows.Next() {
+		var agentID string
+		if err := rows.Scan(&agentID); err == nil {
+			agentIDs = append(agentIDs, agentID)
+		}
+	}
+	rows.Close()
+	if len(agentIDs) == 0 {
+		http.Error(w, "Provider not found", http.StatusNotFound)
+		return
+	}
+
+	stats, err := a.load(r.Context(), read.db, agentIDs, start, end)
+	if err != nil {
+		obs.WriteError(w, r, err)
+		return
+	}
+	all := make([]*agentReliability, 0, len(stats))
+	agents := make([]ReliabilityReport, 0, len(stats))
+	for _, agentID := range agentIDs {
+		st, exists := stats[agentID]
+		if !exists {
+			continue
+		}
+		all = append(all, st)
+		agentReport := report([]*agentReliability{st}, start, end)
+		agentReport.AgentID = agentID
+		agentReport.Window = window
+		agents = append(agents, agentReport)
+	}
+
+	result := report(all, start, end)
+	result.ProviderID = providerID
+	result.Window = window
+	result.Agents = agents
+
+	w.Header().Set("Content-Type", "application/json")
+	annotate(w, read.source, read.asOf)
+	json.NewEncoder(w).Encode(result)
+}
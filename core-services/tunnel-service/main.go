@@ -0,0 +1,638 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/computehive/core-services/pkg/events"
+	"github.com/computehive/core-services/pkg/health"
+	"github.com/computehive/core-services/pkg/obs"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/cors"
+)
+
+// dialTimeout bounds how long a consumer waits for the agent to open a data connection
+const dialTimeout = 15 * time.Second
+
+// ExposedPort is a job port that consumers reach through the tunnel
+type ExposedPort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"` // http, tcp
+}
+
+// Endpoint is a consumer-facing address for an exposed port
+type Endpoint struct {
+	ExposedPort
+	URL string `json:"url"`
+}
+
+// JobTunnel tracks the tunnel for one job. The agent holds a control
+// connection open; for every consumer connection the service asks the agent
+// over that control connection to dial back with a fresh data connection,
+// so providers never need inbound firewall rules.
+type JobTunnel struct {
+	JobID     string        `json:"job_id"`
+	UserID    string        `json:"user_id"`
+	AgentID   string        `json:"agent_id"`
+	Ports     []ExposedPort `json:"ports"`
+	CreatedAt time.Time     `json:"created_at"`
+
+	control   *websocket.Conn
+	controlMu sync.Mutex // serializes writes on the control connection
+	pending   map[string]chan *websocket.Conn
+	transport *http.Transport // Shared by HTTP requests to the job's ports, so data connections are reused
+}
+
+// controlMessage is sent to the agent on the control connection
+type controlMessage struct {
+	Type   string `json:"type"` // open
+	ConnID string `json:"conn_id"`
+	Port   int    `json:"port"`
+}
+
+// TunnelService brokers agent-initiated reverse tunnels to job ports
+type TunnelService struct {
+	tunnels   map[string]*JobTunnel
+	mu        sync.RWMutex
+	nats      *nats.Conn
+	bus       *events.Bus
+	upgrader  websocket.Upgrader
+	publicURL string
+
+	// Metrics
+	activeTunnels prometheus.Gauge
+	connections   *prometheus.CounterVec
+}
+
+// NewTunnelService creates a new tunnel service
+func NewTunnelService() (*TunnelService, error) {
+	natsURL := os.Getenv("NATS_URL")
+	if natsURL == "" {
+		natsURL = "nats://localhost:4222"
+	}
+
+	nc, err := nats.Connect(natsURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	// Job lifecycle events go through JetStream so no tunnel is left dangling
+	bus, err := events.Connect(nc, "tunnel-service")
+	if err != nil {
+		return nil, err
+	}
+
+	publicURL := os.Getenv("TUNNEL_PUBLIC_URL")
+	if publicURL == "" {
+		publicURL = "http://localhost:8007"
+	}
+
+	s := &TunnelService{
+		tunnels:   make(map[string]*JobTunnel),
+		nats:      nc,
+		bus:       bus,
+		publicURL: publicURL,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				// Connections are authenticated by token, not origin
+				return true
+			},
+		},
+
+		activeTunnels: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tunnel_active_tunnels",
+			Help: "Number of jobs with a connected agent tunnel",
+		}),
+		connections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tunnel_connections_total",
+			Help: "Consumer connections through tunnels by result",
+		}, []string{"result"}),
+	}
+
+	prometheus.MustRegister(s.activeTunnels, s.connections)
+
+	s.subscribeToEvents()
+
+	return s, nil
+}
+
+// HTTP Handlers
+
+// GetTunnel returns the endpoints exposed by a job
+func (s *TunnelService) GetTunnel(w http.ResponseWriter, r *http.Request) {
+	tunnel, ok := s.authorizedTunnel(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.RLock()
+	connected := tunnel.control != nil
+	s.mu.RUnlock()
+
+	endpoints := make([]Endpoint, 0, len(tunnel.Ports))
+	for _, port := range tunnel.Ports {
+		endpoint := Endpoint{ExposedPort: port}
+		if port.Protocol == "http" {
+			endpoint.URL = fmt.Sprintf("%s/t/%s/%s/", s.publicURL, tunnel.JobID, port.Name)
+		} else {
+			endpoint.URL = fmt.Sprintf("%s/api/v1/tunnels/%s/ports/%s/connect", s.publicURL, tunnel.JobID, port.Name)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":    tunnel.JobID,
+		"connected": connected,
+		"endpoints": endpoints,
+	})
+}
+
+// AgentControl holds the agent's control connection for a job
+func (s *TunnelService) AgentControl(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["job"]
+
+	s.mu.RLock()
+	tunnel, exists := s.tunnels[jobID]
+	s.mu.RUnlock()
+
+	claims := r.Context().Value("claims").(*Claims)
+	if !exists || tunnel.AgentID != claims.Subject {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Tunnel control upgrade failed", obs.KeyError, err)
+		return
+	}
+
+	s.mu.Lock()
+	previous := tunnel.control
+	tunnel.control = conn
+	s.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	} else {
+		s.activeTunnels.Inc()
+	}
+
+	// The agent only reads on this connection; a read error means it went away
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	if tunnel.control == conn {
+		tunnel.control = nil
+		s.activeTunnels.Dec()
+	}
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// AgentData accepts a data connection the agent opened for a consumer
+func (s *TunnelService) AgentData(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	claims := r.Context().Value("claims").(*Claims)
+
+	s.mu.Lock()
+	var waiting chan *websocket.Conn
+	if tunnel, exists := s.tunnels[vars["job"]]; exists && tunnel.AgentID == claims.Subject {
+		waiting = tunnel.pending[vars["conn"]]
+		delete(tunnel.pending, vars["conn"])
+	}
+	s.mu.Unlock()
+
+	if waiting == nil {
+		http.Error(w, "Connection not found", http.StatusNotFound)
+		return
+	}
+
+	// dial is told even when the upgrade fails, so it never waits on a
+	// connection that is not coming
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Tunnel data upgrade failed", obs.KeyError, err)
+		waiting <- nil
+		return
+	}
+	waiting <- conn
+}
+
+// ConnectPort relays a raw TCP stream over a consumer WebSocket (port-forward)
+func (s *TunnelService) ConnectPort(w http.ResponseWriter, r *http.Request) {
+	tunnel, ok := s.authorizedTunnel(w, r)
+	if !ok {
+		return
+	}
+
+	port, ok := tunnel.port(mux.Vars(r)["port"])
+	if !ok {
+		http.Error(w, "Port not exposed", http.StatusNotFound)
+		return
+	}
+
+	upstream, err := s.dial(r.Context(), tunnel, port.Port)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Tunnel connect upgrade failed", obs.KeyError, err)
+		return
+	}
+	defer conn.Close()
+
+	client := newWSConn(conn)
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(upstream, client); done <- struct{}{} }()
+	go func() { io.Copy(client, upstream); done <- struct{}{} }()
+	<-done
+}
+
+// ProxyHTTP proxies HTTP (and WebSocket) requests to an exposed http port.
+// Path: /t/{job}/{port}/...
+func (s *TunnelService) ProxyHTTP(w http.ResponseWriter, r *http.Request) {
+	tunnel, ok := s.authorizedTunnel(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	port, ok := tunnel.port(vars["port"])
+	if !ok || port.Protocol != "http" {
+		http.Error(w, "Port not exposed over http", http.StatusNotFound)
+		return
+	}
+
+	target, _ := url.Parse(fmt.Sprintf("http://job.tunnel:%d", port.Port))
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = tunnel.transport
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		http.Error(w, "Tunnel unavailable: "+err.Error(), http.StatusBadGateway)
+	}
+
+	r.URL.Path = "/" + vars["path"]
+	proxy.ServeHTTP(w, r)
+}
+
+// dial asks the agent for a new data connection to a job port
+func (s *TunnelService) dial(ctx context.Context, tunnel *JobTunnel, port int) (net.Conn, error) {
+	connID := generateID()
+	waiting := make(chan *websocket.Conn, 1)
+
+	s.mu.Lock()
+	control := tunnel.control
+	if control != nil {
+		tunnel.pending[connID] = waiting
+	}
+	s.mu.Unlock()
+
+	if control == nil {
+		s.connections.WithLabelValues("agent_disconnected").Inc()
+		return nil, fmt.Errorf("agent is not connected")
+	}
+
+	data, _ := json.Marshal(controlMessage{Type: "open", ConnID: connID, Port: port})
+	tunnel.controlMu.Lock()
+	err := control.WriteMessage(websocket.TextMessage, data)
+	tunnel.controlMu.Unlock()
+	if err != nil {
+		s.abandon(tunnel, connID, waiting)
+		s.connections.WithLabelValues("error").Inc()
+		return nil, fmt.Errorf("failed to signal agent: %w", err)
+	}
+
+	timer := time.NewTimer(dialTimeout)
+	defer timer.Stop()
+
+	select {
+	case conn := <-waiting:
+		if conn == nil {
+			s.connections.WithLabelValues("error").Inc()
+			return nil, fmt.Errorf("agent connection failed")
+		}
+		s.connections.WithLabelValues("ok").Inc()
+		return newWSConn(conn), nil
+	case <-timer.C:
+		s.abandon(tunnel, connID, waiting)
+		s.connections.WithLabelValues("timeout").Inc()
+		return nil, fmt.Errorf("agent did not open a connection")
+	case <-ctx.Done():
+		s.abandon(tunnel, connID, waiting)
+		return nil, ctx.Err()
+	}
+}
+
+// abandon gives up on a data connection. If the agent already claimed it,
+// the connection AgentData hands over is closed rather than left open.
+func (s *TunnelService) abandon(tunnel *JobTunnel, connID string, waiting chan *websocket.Conn) {
+	s.mu.Lock()
+	_, unclaimed := tunnel.pending[connID]
+	delete(tunnel.pending, connID)
+	s.mu.Unlock()
+
+	if !unclaimed {
+		go func() {
+			if conn := <-waiting; conn != nil {
+				conn.Close()
+			}
+		}()
+	}
+}
+
+// newTransport returns the transport HTTP requests to a tunnel's ports
+// share; it dials the port named in the address
+func (s *TunnelService) newTransport(tunnel *JobTunnel) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			_, portString, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			port, err := strconv.Atoi(portString)
+			if err != nil {
+				return nil, err
+			}
+			return s.dial(ctx, tunnel, port)
+		},
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     30 * time.Second,
+	}
+}
+
+// authorizedTunnel looks up the request's tunnel and checks the caller owns the job
+func (s *TunnelService) authorizedTunnel(w http.ResponseWriter, r *http.Request) (*JobTunnel, bool) {
+	s.mu.RLock()
+	tunnel, exists := s.tunnels[mux.Vars(r)["job"]]
+	s.mu.RUnlock()
+
+	if !exists {
+		http.Error(w, "Tunnel not found", http.StatusNotFound)
+		return nil, false
+	}
+
+	claims := r.Context().Value("claims").(*Claims)
+	if tunnel.UserID != claims.UserID && claims.Role != "admin" {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return nil, false
+	}
+	return tunnel, true
+}
+
+// port finds an exposed port by name or number
+func (t *JobTunnel) port(nameOrNumber string) (ExposedPort, bool) {
+	number, _ := strconv.Atoi(nameOrNumber)
+	for _, port := range t.Ports {
+		if port.Name == nameOrNumber || port.Port == number {
+			return port, true
+		}
+	}
+	return ExposedPort{}, false
+}
+
+// Event handling
+
+func (s *TunnelService) subscribeToEvents() {
+	// Register tunnels when jobs with exposed ports are placed on an agent
+	s.bus.Subscribe("job.scheduled", func(ctx context.Context, msg *nats.Msg) error {
+		var job struct {
+			ID              string        `json:"id"`
+			UserID          string        `json:"user_id"`
+			AssignedAgentID string        `json:"assigned_agent_id"`
+			ExposedPorts    []ExposedPort `json:"exposed_ports"`
+		}
+		if err := json.Unmarshal(msg.Data, &job); err != nil {
+			return obs.Wrap(obs.CodeInvalidArgument, err)
+		}
+		if len(job.ExposedPorts) == 0 {
+			return nil
+		}
+
+		s.mu.Lock()
+		// A redelivered placement must not drop an agent's live tunnel
+		if existing, exists := s.tunnels[job.ID]; exists && existing.AgentID == job.AssignedAgentID {
+			s.mu.Unlock()
+			return nil
+		}
+		if existing, exists := s.tunnels[job.ID]; exists {
+			existing.transport.CloseIdleConnections()
+		}
+		tunnel := &JobTunnel{
+			JobID:     job.ID,
+			UserID:    job.UserID,
+			AgentID:   job.AssignedAgentID,
+			Ports:     job.ExposedPorts,
+			CreatedAt: time.Now(),
+			pending:   make(map[string]chan *websocket.Conn),
+		}
+		tunnel.transport = s.newTransport(tunnel)
+		s.tunnels[job.ID] = tunnel
+		s.mu.Unlock()
+		return nil
+	})
+
+	// Tear tunnels down when jobs end
+	for _, subject := range []string{"job.completed", "job.failed", "job.cancelled"} {
+		s.bus.Subscribe(subject, func(ctx context.Context, msg *nats.Msg) error {
+			var job struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(msg.Data, &job); err != nil {
+				return obs.Wrap(obs.CodeInvalidArgument, err)
+			}
+			s.closeTunnel(job.ID)
+			return nil
+		})
+	}
+}
+
+func (s *TunnelService) closeTunnel(jobID string) {
+	s.mu.Lock()
+	var control *websocket.Conn
+	var transport *http.Transport
+	if tunnel, exists := s.tunnels[jobID]; exists {
+		control = tunnel.control
+		transport = tunnel.transport
+		delete(s.tunnels, jobID)
+	}
+	s.mu.Unlock()
+
+	if transport != nil {
+		transport.CloseIdleConnections()
+	}
+
+	// Closing the control connection ends AgentControl, which updates metrics
+	if control != nil {
+		control.Close()
+	}
+}
+
+// JWT Claims type
+type Claims struct {
+	UserID   string   `json:"user_id"`
+	Email    string   `json:"email"`
+	Username string   `json:"username"`
+	Role     string   `json:"role"`
+	Scopes   []string `json:"scopes"`
+	jwt.RegisteredClaims
+}
+
+// authMiddleware authenticates consumers with user tokens signed with
+// JWT_SECRET; agent credentials are refused
+func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		secret := os.Getenv("JWT_SECRET")
+		if tokenString == "" || secret == "" {
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(secret), nil
+		})
+		if err != nil || !token.Valid {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		claims := token.Claims.(*Claims)
+		if claims.Role == "agent" || claims.UserID == "" {
+			http.Error(w, "User credentials required", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = obs.WithCaller(ctx, claims.UserID, "")
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// agentCredentialAudience marks the agent credentials the scheduler signs
+// with AGENT_JWT_SECRET
+const agentCredentialAudience = "computehive-agent"
+
+// agentAuthMiddleware authenticates agents with the credentials the
+// scheduler issued them at enrollment; the agent is the token's subject
+func agentAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tokenString := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		secret := os.Getenv("AGENT_JWT_SECRET")
+		if tokenString == "" || secret == "" {
+			http.Error(w, "Authorization required", http.StatusUnauthorized)
+			return
+		}
+
+		token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return []byte(secret), nil
+		}, jwt.WithAudience(agentCredentialAudience))
+		if err != nil || !token.Valid {
+			http.Error(w, "Invalid agent credentials", http.StatusUnauthorized)
+			return
+		}
+		claims := token.Claims.(*Claims)
+		if claims.Role != "agent" || claims.Subject == "" {
+			http.Error(w, "Agent credentials required", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), "claims", claims)
+		ctx = obs.WithCaller(ctx, claims.Subject, "")
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func generateID() string {
+	return fmt.Sprintf("%d", time.Now().UnixNano())
+}
+
+// isAdmin reports whether the authenticated caller is an admin
+func isAdmin(r *http.Request) bool {
+	claims, ok := r.Context().Value("claims").(*Claims)
+	return ok && claims.Role == "admin"
+}
+
+func main() {
+	obs.Init("tunnel-service")
+
+	tunnelService, err := NewTunnelService()
+	if err != nil {
+		obs.Fatal("Failed to create tunnel service", err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(obs.Middleware)
+
+	// Health checks: /healthz is liveness only, /readyz runs dependency checks
+	checker := health.NewChecker("tunnel-service")
+	checker.AddCheck("nats", true, health.NATSCheck(tunnelService.nats))
+	router.HandleFunc("/healthz", checker.LivenessHandler).Methods("GET")
+	router.HandleFunc("/readyz", checker.ReadinessHandler).Methods("GET")
+
+	// Metrics endpoint
+	router.Handle("/metrics", promhttp.Handler())
+
+	// Runtime logging control
+	router.HandleFunc("/admin/logging", authMiddleware(obs.Logging.Handler(isAdmin))).Methods("GET", "PUT")
+
+	// Consumer endpoints
+	router.HandleFunc("/api/v1/tunnels/{job}", authMiddleware(tunnelService.GetTunnel)).Methods("GET")
+	router.HandleFunc("/api/v1/tunnels/{job}/ports/{port}/connect", authMiddleware(tunnelService.ConnectPort)).Methods("GET")
+	router.HandleFunc("/t/{job}/{port}/{path:.*}", authMiddleware(tunnelService.ProxyHTTP))
+
+	// Agent endpoints
+	router.HandleFunc("/api/v1/tunnels/{job}/control", agentAuthMiddleware(tunnelService.AgentControl)).Methods("GET")
+	router.HandleFunc("/api/v1/tunnels/{job}/data/{conn}", agentAuthMiddleware(tunnelService.AgentData)).Methods("GET")
+
+	// Setup CORS
+	c := cors.New(cors.Options{
+		AllowedOrigins:   []string{"http://localhost:3000", "https://computehive.io"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		AllowCredentials: true,
+	})
+
+	handler := c.Handler(router)
+
+	// Start server
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8007"
+	}
+
+	slog.Info("Tunnel service starting", "port", port)
+	if err := http.ListenAndServe(":"+port, handler); err != nil {
+		obs.Fatal("Failed to start server", err)
+	}
+}
@@ -0,0 +1,60 @@
+package computehive
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// AlertRule fires when a metric crosses a threshold
+type AlertRule struct {
+	ID            string                 `json:"id,omitempty"`
+	Name          string                 `json:"name"`
+	Condition     string                 `json:"condition"` // >, <, >=, <=, ==
+	Threshold     float64                `json:"threshold"`
+	MetricName    string                 `json:"metric_name"`
+	Tags          map[string]string      `json:"tags,omitempty"`
+	Severity      string                 `json:"severity,omitempty"` // critical, warning, info
+	State         string                 `json:"state,omitempty"`
+	LastTriggered *time.Time             `json:"last_triggered,omitempty"`
+	NotifyWebhook string                 `json:"notify_webhook,omitempty"`
+	NotifyEmail   []string               `json:"notify_email,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	AssignedTo    string                 `json:"assigned_to,omitempty"`
+	RotationID    string                 `json:"rotation_id,omitempty"`
+}
+
+const alertsPath = "/api/v1/telemetry/api/v1/alerts"
+
+// CreateAlertRule creates an alert rule
+func (c *Client) CreateAlertRule(ctx context.Context, rule *AlertRule) (*AlertRule, error) {
+	var created AlertRule
+	if err := c.do(ctx, http.MethodPost, alertsPath, rule, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetAlertRule retrieves an alert rule with its current state
+func (c *Client) GetAlertRule(ctx context.Context, id string) (*AlertRule, error) {
+	var rule AlertRule
+	if err := c.do(ctx, http.MethodGet, alertsPath+"/"+url.PathEscape(id), nil, &rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// UpdateAlertRule replaces an alert rule's definition
+func (c *Client) UpdateAlertRule(ctx context.Context, id string, rule *AlertRule) (*AlertRule, error) {
+	var updated AlertRule
+	if err := c.do(ctx, http.MethodPut, alertsPath+"/"+url.PathEscape(id), rule, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteAlertRule deactivates an alert rule
+func (c *Client) DeleteAlertRule(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, alertsPath+"/"+url.PathEscape(id), nil, nil)
+}
@@ -0,0 +1,132 @@
+// Package computehive is the Go client for the ComputeHive API. Requests go
+// through the API gateway, which routes /api/v1/{service}/... to each service.
+package computehive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Version is the SDK version sent in the User-Agent header
+const Version = "1.0.0"
+
+// DefaultAPIURL is used when neither the caller nor COMPUTEHIVE_API_URL sets one
+const DefaultAPIURL = "https://api.computehive.io"
+
+// ErrNotFound is returned when the requested object does not exist
+var ErrNotFound = errors.New("computehive: not found")
+
+// APIError is a non-2xx response from the API
+type APIError struct {
+	StatusCode int
+	Code       string // Machine-readable category, e.g. "invalid_argument" or "conflict"
+	Message    string
+	RequestID  string // Quote this when reporting a problem
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("computehive: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client talks to the ComputeHive API gateway
+type Client struct {
+	apiURL     string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithAPIURL overrides the API gateway URL
+func WithAPIURL(url string) Option {
+	return func(c *Client) {
+		c.apiURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithHTTPClient replaces the default HTTP client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// NewClient creates a client. An empty apiKey falls back to
+// COMPUTEHIVE_API_KEY, and the URL to COMPUTEHIVE_API_URL.
+func NewClient(apiKey string, opts ...Option) (*Client, error) {
+	if apiKey == "" {
+		apiKey = os.Getenv("COMPUTEHIVE_API_KEY")
+	}
+	if apiKey == "" {
+		return nil, errors.New("computehive: API key is required; set COMPUTEHIVE_API_KEY or pass one")
+	}
+
+	c := &Client{
+		apiURL:     DefaultAPIURL,
+		apiKey:     apiKey,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	if url := os.Getenv("COMPUTEHIVE_API_URL"); url != "" {
+		c.apiURL = strings.TrimRight(url, "/")
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// do sends a request and decodes a JSON response into out when out is non-nil
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("computehive: failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ComputeHive-Go-SDK/"+Version)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("computehive: network error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Code:       resp.Header.Get("X-Error-Code"),
+			Message:    strings.TrimSpace(string(msg)),
+			RequestID:  resp.Header.Get("X-Request-ID"),
+		}
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("computehive: failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package computehive
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Offer is compute capacity a provider lists on the marketplace
+type Offer struct {
+	ID            string                `json:"id,omitempty"`
+	ProviderID    string                `json:"provider_id,omitempty"`
+	AgentID       string                `json:"agent_id"`
+	Resources     ResourceSpecification `json:"resources"`
+	PricePerHour  map[string]string     `json:"price_per_hour"` // Decimal prices per resource, e.g. "cpu": "0.05"
+	MinDuration   time.Duration         `json:"min_duration,omitempty"`
+	MaxDuration   time.Duration         `json:"max_duration,omitempty"`
+	Location      string                `json:"location,omitempty"`
+	Features      []string              `json:"features,omitempty"`
+	Status        string                `json:"status,omitempty"` // active, reserved, expired, cancelled
+	CreatedAt     time.Time             `json:"created_at,omitempty"`
+	UpdatedAt     time.Time             `json:"updated_at,omitempty"`
+	ExpiresAt     time.Time             `json:"expires_at,omitempty"`
+	ClientOrderID string                `json:"client_order_id,omitempty"`
+	ExpiredReason string                `json:"expired_reason,omitempty"`
+}
+
+// ResourceSpecification describes the hardware behind an offer
+type ResourceSpecification struct {
+	CPU     CPUSpec     `json:"cpu"`
+	Memory  MemorySpec  `json:"memory"`
+	GPU     []GPUSpec   `json:"gpu,omitempty"`
+	Storage StorageSpec `json:"storage"`
+	Network NetworkSpec `json:"network"`
+}
+
+type CPUSpec struct {
+	Cores int    `json:"cores"`
+	Model string `json:"model,omitempty"`
+}
+
+type MemorySpec struct {
+	TotalMB int    `json:"total_mb"`
+	Type    string `json:"type,omitempty"`
+}
+
+type GPUSpec struct {
+	Model    string `json:"model"`
+	MemoryMB int    `json:"memory_mb"`
+	Count    int    `json:"count"`
+}
+
+type StorageSpec struct {
+	TotalMB int    `json:"total_mb"`
+	Type    string `json:"type,omitempty"` // ssd, hdd, nvme
+}
+
+type NetworkSpec struct {
+	BandwidthMbps int `json:"bandwidth_mbps"`
+}
+
+// CreateOffer lists an offer owned by the caller
+func (c *Client) CreateOffer(ctx context.Context, offer *Offer) (*Offer, error) {
+	var created Offer
+	if err := c.do(ctx, http.MethodPost, "/api/v1/marketplace/api/v1/offers", offer, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetOffer retrieves an offer in any status
+func (c *Client) GetOffer(ctx context.Context, id string) (*Offer, error) {
+	var offer Offer
+	if err := c.do(ctx, http.MethodGet, "/api/v1/marketplace/api/v1/offers/"+url.PathEscape(id), nil, &offer); err != nil {
+		return nil, err
+	}
+	return &offer, nil
+}
+
+// CancelOffer withdraws an active offer
+func (c *Client) CancelOffer(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/marketplace/api/v1/offers/"+url.PathEscape(id), nil, nil)
+}
@@ -0,0 +1,3 @@
+module github.com/computehive/sdk-go
+
+go 1.21
@@ -0,0 +1,254 @@
+"""
+ComputeHive command line interface
+
+Usage:
+    computehive jobs exec [-i] [-t] <job_id> [command ...]
+    computehive jobs port-forward <job_id> [local_port:]<port>
+    computehive analytics rightsizing [--days N] [--min-jobs N] [--json]
+"""
+
+import argparse
+import json
+import os
+import shutil
+import signal
+import socket
+import sys
+import threading
+from typing import List, Optional
+from urllib.parse import urlencode
+
+
+def _ws_base(api_url: str) -> str:
+    """Convert an API URL to its WebSocket equivalent"""
+    if api_url.startswith("https://"):
+        return "wss://" + api_url[len("https://"):]
+    if api_url.startswith("http://"):
+        return "ws://" + api_url[len("http://"):]
+    return api_url
+
+
+def _exec_url(api_url: str, job_id: str, tty: bool, command: List[str]) -> str:
+    """Build the WebSocket URL for an exec session"""
+    base = _ws_base(api_url)
+
+    params = [("tty", "true" if tty else "false")]
+    if tty:
+        size = shutil.get_terminal_size()
+        params += [("cols", size.columns), ("rows", size.lines)]
+    params += [("command", part) for part in command]
+
+    return f"{base.rstrip('/')}/api/v1/jobs/{job_id}/exec?{urlencode(params)}"
+
+
+def jobs_exec(args: argparse.Namespace) -> int:
+    """Open an interactive session into a running job"""
+    try:
+        import websocket  # websocket-client
+    except ImportError:
+        print("jobs exec requires websocket-client: pip install computehive[exec]", file=sys.stderr)
+        return 1
+
+    api_url = os.getenv("COMPUTEHIVE_API_URL", "https://api.computehive.io")
+    api_key = os.getenv("COMPUTEHIVE_API_KEY")
+    if not api_key:
+        print("COMPUTEHIVE_API_KEY is not set", file=sys.stderr)
+        return 1
+
+    tty = args.tty and sys.stdin.isatty()
+    ws = websocket.create_connection(
+        _exec_url(api_url, args.job_id, tty, args.command),
+        header=[f"Authorization: Bearer {api_key}"],
+    )
+
+    exit_code = 0
+    old_attrs = None
+    if tty:
+        import termios
+        import tty as ttymod
+
+        old_attrs = termios.tcgetattr(sys.stdin.fileno())
+        ttymod.setraw(sys.stdin.fileno())
+
+        def on_resize(signum, frame):
+            size = shutil.get_terminal_size()
+            ws.send(json.dumps({"type": "resize", "cols": size.columns, "rows": size.lines}))
+
+        signal.signal(signal.SIGWINCH, on_resize)
+
+    def forward_input():
+        try:
+            while True:
+                data = os.read(sys.stdin.fileno(), 4096)
+                if not data:
+                    break
+                ws.send_binary(data)
+        except Exception:
+            pass
+
+    if args.interactive or tty:
+        threading.Thread(target=forward_input, daemon=True).start()
+
+    try:
+        while True:
+            opcode, data = ws.recv_data()
+            if opcode == websocket.ABNF.OPCODE_BINARY:
+                sys.stdout.buffer.write(data)
+                sys.stdout.buffer.flush()
+            elif opcode == websocket.ABNF.OPCODE_TEXT:
+                msg = json.loads(data)
+                if msg.get("type") == "exit":
+                    exit_code = msg.get("exit_code", 0)
+                    break
+                if msg.get("type") == "error":
+                    print(f"\r\nexec error: {msg.get('error')}", file=sys.stderr)
+                    exit_code = 1
+                    break
+            elif opcode == websocket.ABNF.OPCODE_CLOSE:
+                break
+    except websocket.WebSocketConnectionClosedException:
+        pass
+    finally:
+        if old_attrs is not None:
+            import termios
+            termios.tcsetattr(sys.stdin.fileno(), termios.TCSADRAIN, old_attrs)
+        ws.close()
+
+    return exit_code
+
+
+def jobs_port_forward(args: argparse.Namespace) -> int:
+    """Forward a local port to a port exposed by a running job"""
+    try:
+        import websocket  # websocket-client
+    except ImportError:
+        print("jobs port-forward requires websocket-client: pip install computehive[exec]", file=sys.stderr)
+        return 1
+
+    api_url = os.getenv("COMPUTEHIVE_API_URL", "https://api.computehive.io")
+    api_key = os.getenv("COMPUTEHIVE_API_KEY")
+    if not api_key:
+        print("COMPUTEHIVE_API_KEY is not set", file=sys.stderr)
+        return 1
+
+    local_port, _, remote_port = args.mapping.rpartition(":")
+    local_port = int(local_port or remote_port)
+    url = f"{_ws_base(api_url).rstrip('/')}/api/v1/tunnels/{args.job_id}/ports/{remote_port}/connect"
+
+    def handle(client: socket.socket):
+        try:
+            ws = websocket.create_connection(url, header=[f"Authorization: Bearer {api_key}"])
+        except Exception as e:
+            print(f"tunnel connection failed: {e}", file=sys.stderr)
+            client.close()
+            return
+
+        def upstream():
+            try:
+                while True:
+                    data = client.recv(32 * 1024)
+                    if not data:
+                        break
+                    ws.send_binary(data)
+            except Exception:
+                pass
+            ws.close()
+
+        threading.Thread(target=upstream, daemon=True).start()
+        try:
+            while True:
+                opcode, data = ws.recv_data()
+                if opcode != websocket.ABNF.OPCODE_BINARY:
+                    break
+                client.sendall(data)
+        except Exception:
+            pass
+        client.close()
+
+    listener = socket.socket(socket.AF_INET, socket.SOCK_STREAM)
+    listener.setsockopt(socket.SOL_SOCKET, socket.SO_REUSEADDR, 1)
+    listener.bind(("127.0.0.1", local_port))
+    listener.listen()
+    print(f"Forwarding 127.0.0.1:{local_port} -> job {args.job_id} port {remote_port}")
+
+    try:
+        while True:
+            client, _ = listener.accept()
+            threading.Thread(target=handle, args=(client,), daemon=True).start()
+    except KeyboardInterrupt:
+        pass
+    finally:
+        listener.close()
+    return 0
+
+
+def analytics_rightsizing(args: argparse.Namespace) -> int:
+    """Print right-sizing recommendations for recently completed jobs"""
+    from .client import ComputeHiveClient, ComputeHiveError
+
+    try:
+        report = ComputeHiveClient().get_rightsizing(days=args.days, min_jobs=args.min_jobs)
+    except ComputeHiveError as e:
+        print(str(e), file=sys.stderr)
+        return 1
+
+    if args.json:
+        print(json.dumps(report, indent=2))
+        return 0
+
+    print(f"Analyzed {report['jobs_analyzed']} completed jobs over the last {args.days} days")
+    print(f"CPU utilization (p95 / requested): {report['cpu_utilization'] * 100:.0f}%")
+    print(f"Memory utilization (peak / requested): {report['memory_utilization'] * 100:.0f}%")
+
+    recommendations = report.get("recommendations") or []
+    if not recommendations:
+        print("No right-sizing recommendations; requested resources match observed usage.")
+        return 0
+
+    print()
+    print(f"{'TYPE':<12} {'JOBS':>5} {'CPU':>9} {'MEMORY MB':>13} {'SAVINGS':>8}")
+    for rec in recommendations:
+        cpu = f"{rec['requested_cpu_cores']}->{rec['recommended_cpu_cores']}"
+        mem = f"{rec['requested_memory_mb']}->{rec['recommended_memory_mb']}"
+        print(f"{rec['job_type']:<12} {rec['jobs']:>5} {cpu:>9} {mem:>13} {rec['savings_percent']:>7.0f}%")
+    print()
+    for rec in recommendations:
+        print(f"- {rec['message']}")
+    print(f"\nPotential savings over the window: ${report['potential_savings']:.2f}")
+    return 0
+
+
+def main(argv: Optional[List[str]] = None) -> int:
+    parser = argparse.ArgumentParser(prog="computehive", description="ComputeHive command line interface")
+    subparsers = parser.add_subparsers(dest="group", required=True)
+
+    jobs = subparsers.add_parser("jobs", help="Manage compute jobs")
+    jobs_sub = jobs.add_subparsers(dest="command_name", required=True)
+
+    exec_parser = jobs_sub.add_parser("exec", help="Open a session into a running job")
+    exec_parser.add_argument("-i", "--interactive", action="store_true", help="Forward stdin to the job")
+    exec_parser.add_argument("-t", "--tty", action="store_true", help="Allocate a terminal")
+    exec_parser.add_argument("job_id", help="Job ID")
+    exec_parser.add_argument("command", nargs=argparse.REMAINDER, help="Command to run (default: /bin/sh)")
+    exec_parser.set_defaults(func=jobs_exec)
+
+    forward_parser = jobs_sub.add_parser("port-forward", help="Forward a local port to a job's exposed port")
+    forward_parser.add_argument("job_id", help="Job ID")
+    forward_parser.add_argument("mapping", help="[local_port:]port, where port is the exposed port name or number")
+    forward_parser.set_defaults(func=jobs_port_forward)
+
+    analytics = subparsers.add_parser("analytics", help="Usage analytics")
+    analytics_sub = analytics.add_subparsers(dest="command_name", required=True)
+
+    rightsizing_parser = analytics_sub.add_parser("rightsizing", help="Suggest right-sized job requirements")
+    rightsizing_parser.add_argument("--days", type=int, default=30, help="Days of completed jobs to analyze")
+    rightsizing_parser.add_argument("--min-jobs", type=int, default=3, help="Minimum similar jobs per recommendation")
+    rightsizing_parser.add_argument("--json", action="store_true", help="Print the raw report")
+    rightsizing_parser.set_defaults(func=analytics_rightsizing)
+
+    args = parser.parse_args(argv)
+    return args.func(args)
+
+
+if __name__ == "__main__":
+    sys.exit(main())
@@ -7,7 +7,7 @@ import os
 import time
 import json
 import hashlib
-from typing import Dict, List, Optional, Any, Callable
+from typing import Dict, List, Optional, Any, Callable, Iterator
 from dataclasses import dataclass, asdict
 from enum import Enum
 import requests
@@ -187,7 +187,10 @@ class ComputeHiveClient:
         priority: int = 5,
         timeout: int = 3600,
         max_retries: int = 3,
-        sla_requirements: Optional[SLARequirements] = None
+        sla_requirements: Optional[SLARequirements] = None,
+        tags: Optional[Dict[str, str]] = None,
+        exposed_ports: Optional[List[Dict]] = None,
+        quote_id: Optional[str] = None
     ) -> Dict:
         """
         Submit a new compute job
@@ -200,6 +203,10 @@ class ComputeHiveClient:
             timeout: Job timeout in seconds
             max_retries: Maximum retries if job fails
             sla_requirements: Optional SLA requirements
+            tags: Optional cost allocation tags (e.g. {"team": "nlp"})
+            exposed_ports: Optional ports to expose through the tunnel service
+                (e.g. [{"name": "notebook", "port": 8888, "protocol": "http"}])
+            quote_id: Optional price quote ID; the quoted hourly price is honored at settlement
             
         Returns:
             Job details including job ID
@@ -216,12 +223,182 @@ class ComputeHiveClient:
         if sla_requirements:
             data["sla_requirements"] = sla_requirements.to_dict()
         
+        if tags:
+            data["tags"] = tags
+        
+        if exposed_ports:
+            data["exposed_ports"] = exposed_ports
+        
+        if quote_id:
+            data["quote_id"] = quote_id
+        
         return self._make_request("POST", "/api/v1/jobs", data=data)
     
+    def submit_jobs_batch(self, jobs: List[Dict], atomic: bool = False) -> Dict:
+        """
+        Submit many jobs in one request
+        
+        Every job is validated before any is queued. With atomic=True one
+        invalid job rejects the whole batch; otherwise the valid jobs are
+        submitted and the rest reported.
+        
+        Args:
+            jobs: Job specs with the same fields as submit_job's request body
+            atomic: Submit all jobs or none
+            
+        Returns:
+            Batch ID, counts, and per-job results in request order
+        """
+        data = {
+            "mode": "atomic" if atomic else "partial",
+            "jobs": jobs,
+        }
+        return self._make_request("POST", "/api/v1/jobs/batch", data=data)
+    
+    def create_quote(
+        self,
+        requirements: ResourceRequirements,
+        duration_hours: float = 1.0,
+        regions: Optional[List[str]] = None
+    ) -> Dict:
+        """
+        Get a binding price quote for a requirement set
+        
+        Args:
+            requirements: Resource requirements to price
+            duration_hours: Expected job duration in hours
+            regions: Optional regions to restrict the quote to
+            
+        Returns:
+            Quote including ID, price per hour and expiry
+        """
+        data = requirements.to_dict()
+        data["duration_hours"] = duration_hours
+        if regions:
+            data["regions"] = regions
+        
+        return self._make_request("POST", "/api/v1/quotes", data=data)
+    
+    def simulate_earnings(
+        self,
+        resources: Dict,
+        region: Optional[str] = None,
+        location: Optional[str] = None,
+        price_per_hour: Optional[Dict[str, str]] = None,
+        hours_per_day: float = 24,
+        lookback_days: int = 7
+    ) -> Dict:
+        """
+        Estimate utilization and revenue for hardware before listing it
+        
+        Args:
+            resources: Hardware spec (cpu, memory, gpu, storage, network)
+            region: Price index region, defaults to the marketplace's own region
+            location: Offer location within the region
+            price_per_hour: Optional prices per resource, defaults to index medians
+            hours_per_day: Hours per day the hardware would be available
+            lookback_days: Days of marketplace demand to replay
+            
+        Returns:
+            Low, expected and high utilization and revenue scenarios
+        """
+        data = {
+            "resources": resources,
+            "hours_per_day": hours_per_day,
+            "lookback_days": lookback_days,
+        }
+        if region:
+            data["region"] = region
+        if location:
+            data["location"] = location
+        if price_per_hour:
+            data["price_per_hour"] = price_per_hour
+        
+        return self._make_request("POST", "/api/v1/providers/earnings/simulate", data=data)
+    
+    def get_price_floors(self) -> Dict:
+        """
+        Get your provider price floors and the markets currently below them
+        
+        Returns:
+            Floors by resource and location, plus active breaches
+        """
+        return self._make_request("GET", "/api/v1/providers/price-floors")
+    
+    def set_price_floors(
+        self,
+        default: Optional[Dict[str, str]] = None,
+        locations: Optional[Dict[str, Dict[str, str]]] = None
+    ) -> Dict:
+        """
+        Set the minimum prices your offers trade at, replacing any existing floors
+        
+        Args:
+            default: Minimum price per unit hour by resource (cpu, memory, gpu, storage)
+            locations: Floors for offers in specific locations, replacing the default there
+            
+        Returns:
+            The saved price floors
+        """
+        data = {
+            "default": default or {},
+            "locations": locations or {},
+        }
+        return self._make_request("PUT", "/api/v1/providers/price-floors", data=data)
+    
+    def dry_run_job(self, job_spec: Dict) -> Dict:
+        """
+        Validate a job spec and check it against current capacity without submitting it
+        
+        Args:
+            job_spec: Job specification as accepted by submit_job
+            
+        Returns:
+            Validity, matching agent count and the limiting constraint if none match
+        """
+        return self._make_request("POST", "/api/v1/jobs/dry-run", data=job_spec)
+    
     def get_job(self, job_id: str) -> Dict:
         """Get job details by ID"""
         return self._make_request("GET", f"/api/v1/jobs/{job_id}")
     
+    def rerun_job(self, job_id: str, strict: bool = False) -> Dict:
+        """
+        Re-run a past job pinned to an environment equivalent to its original
+        
+        Args:
+            job_id: Job to reproduce
+            strict: Refuse the re-run unless the environment can be matched exactly
+            
+        Returns:
+            The new job, with a reproduction report listing any environment differences
+        """
+        return self._make_request("POST", f"/api/v1/jobs/{job_id}/rerun", data={"strict": strict})
+    
+    def get_job_view(self, job_id: str) -> Dict:
+        """Get a job with its status, cost to date, recent logs and resource timeline in one call"""
+        return self._make_request("GET", f"/api/v1/views/jobs/{job_id}")
+    
+    def get_queue_status(self, job_id: str) -> Dict:
+        """Get queue position, limiting constraint and ETA for a pending job"""
+        return self._make_request("GET", f"/api/v1/jobs/{job_id}/queue")
+    
+    def get_rightsizing(self, days: int = 30, min_jobs: int = 3) -> Dict:
+        """Get right-sizing recommendations mined from completed jobs' actual usage"""
+        params = {"days": days, "min_jobs": min_jobs}
+        return self._make_request("GET", "/api/v1/analytics/rightsizing", params=params)
+    
+    def get_queue_wait_times(self, window: str = "1h", group_by: Optional[List[str]] = None) -> Dict:
+        """Get p50/p95 queue wait times by resource class and region, plus pending job counts"""
+        params = {"window": window}
+        if group_by:
+            params["group_by"] = ",".join(group_by)
+        return self._make_request("GET", "/api/v1/queue/wait-times", params=params)
+    
+    def get_job_endpoints(self, job_id: str) -> Dict:
+        """Get the tunnel endpoints for a job's exposed ports"""
+        return self._make_request("GET", f"/api/v1/tunnels/{job_id}")
+    
     def list_jobs(
         self,
         status: Optional[JobStatus] = None,
@@ -293,6 +470,54 @@ class ComputeHiveClient:
         
         raise JobError(f"Job {job_id} did not complete within {timeout} seconds")
     
+    def watch_job(self, job_id: str, last_event_id: Optional[str] = None) -> Iterator[Dict]:
+        """
+        Stream a job's state transitions and progress updates as they happen
+        
+        Reconnects with Last-Event-ID after a dropped connection, so no events
+        are missed. The stream ends once the job reaches a terminal state.
+        
+        Args:
+            job_id: Job ID to watch
+            last_event_id: Resume after this event ID instead of starting with a snapshot
+            
+        Yields:
+            Events with "event" (snapshot, state, progress or end), "id" and "data"
+        """
+        url = f"{self.api_url}/api/v1/jobs/{job_id}/events/stream"
+        
+        while True:
+            headers = {"Accept": "text/event-stream"}
+            if last_event_id:
+                headers["Last-Event-ID"] = last_event_id
+            
+            try:
+                with self.session.get(url, headers=headers, stream=True, timeout=(self.timeout, 60)) as response:
+                    response.raise_for_status()
+                    event = {}
+                    for line in response.iter_lines(decode_unicode=True):
+                        if line is None:
+                            continue
+                        if line == "":
+                            if "data" in event:
+                                if event.get("id"):
+                                    last_event_id = event["id"]
+                                event["data"] = json.loads(event["data"])
+                                yield event
+                                if event.get("event") == "end":
+                                    return
+                            event = {}
+                        elif not line.startswith(":") and ":" in line:
+                            field, value = line.split(":", 1)
+                            if field in ("id", "event", "data"):
+                                event[field] = value.lstrip(" ")
+            except requests.exceptions.HTTPError as e:
+                if e.response.status_code == 401:
+                    raise AuthenticationError("Invalid API key or authentication failed")
+                raise ComputeHiveError(f"API request failed: {e}")
+            except requests.exceptions.RequestException:
+                time.sleep(3)
+    
     def submit_docker_job(
         self,
         image: str,
@@ -443,6 +668,85 @@ class ComputeHiveClient:
             params["end_date"] = end_date
         
         return self._make_request("GET", "/api/v1/stats/usage", params=params)
+    
+    def get_spend_by_tag(
+        self,
+        group_by: str,
+        tags: Optional[Dict[str, str]] = None,
+        start: Optional[str] = None,
+        end: Optional[str] = None
+    ) -> Dict:
+        """
+        Get job spend grouped by a cost allocation tag
+        
+        Args:
+            group_by: Tag key to group spend by (e.g. "team")
+            tags: Optional tag filters that every job must match
+            start: Period start (RFC3339)
+            end: Period end (RFC3339)
+            
+        Returns:
+            Spend breakdown per tag value
+        """
+        params = {"group_by": group_by}
+        if tags:
+            params["tag"] = [f"{key}={value}" for key, value in tags.items()]
+        if start:
+            params["start"] = start
+        if end:
+            params["end"] = end
+        
+        return self._make_request("GET", "/api/v1/payments/usage/tags", params=params)
+    
+    def get_usage_report(
+        self,
+        period: Optional[str] = None,
+        start: Optional[str] = None,
+        end: Optional[str] = None
+    ) -> Dict:
+        """
+        Get job usage with a daily breakdown, costs per job type and projections
+        
+        Args:
+            period: current_month (default), last_month, last_7_days or last_30_days
+            start: Custom period start (RFC3339), instead of period
+            end: Custom period end (RFC3339), defaults to now
+            
+        Returns:
+            Usage report
+        """
+        params = {}
+        if period:
+            params["period"] = period
+        if start:
+            params["start"] = start
+        if end:
+            params["end"] = end
+        
+        return self._make_request("GET", "/api/v1/payments/usage", params=params)
+    
+    def submit_invoice(self, invoice_id: str, po_number: Optional[str] = None) -> Dict:
+        """
+        Submit a draft enterprise invoice for approval
+        
+        Args:
+            invoice_id: Invoice ID
+            po_number: Purchase order number to set before submitting
+            
+        Returns:
+            Invoice pending approval
+        """
+        if po_number is not None:
+            self._make_request("PUT", f"/api/v1/payments/invoices/{invoice_id}/po", data={"po_number": po_number})
+        return self._make_request("POST", f"/api/v1/payments/invoices/{invoice_id}/submit")
+    
+    def approve_invoice(self, invoice_id: str) -> Dict:
+        """Approve an invoice pending approval, making it payable"""
+        return self._make_request("POST", f"/api/v1/payments/invoices/{invoice_id}/approve")
+    
+    def reject_invoice(self, invoice_id: str, reason: str) -> Dict:
+        """Reject an invoice pending approval, returning it to draft"""
+        return self._make_request("POST", f"/api/v1/payments/invoices/{invoice_id}/reject", data={"reason": reason})
 
 
 # Convenience functions
@@ -37,6 +37,9 @@ setup(
         "dataclasses>=0.6;python_version<'3.7'",
     ],
     extras_require={
+        "exec": [
+            "websocket-client>=1.6.0",
+        ],
         "dev": [
             "pytest>=7.0.0",
             "pytest-cov>=4.0.0",
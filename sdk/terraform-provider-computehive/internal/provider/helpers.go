@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// validateDuration accepts Go duration strings such as "90m" or "2h"
+func validateDuration(v interface{}, key string) ([]string, []error) {
+	if _, err := time.ParseDuration(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%s: %w", key, err)}
+	}
+	return nil, nil
+}
+
+// formatDuration keeps the configured spelling of a duration ("60m" stays
+// "60m" rather than becoming "1h0m0s") as long as it still means the same
+func formatDuration(configured string, actual time.Duration) string {
+	if d, err := time.ParseDuration(configured); err == nil && d == actual {
+		return configured
+	}
+	return actual.String()
+}
+
+// formatPrices keeps the configured spelling of each price ("1.10" rather
+// than the marketplace's "1.1") as long as the amount is unchanged
+func formatPrices(configured map[string]interface{}, actual map[string]string) map[string]string {
+	prices := make(map[string]string, len(actual))
+	for resource, price := range actual {
+		prices[resource] = price
+		want, ok := configured[resource].(string)
+		if !ok {
+			continue
+		}
+		a, errA := strconv.ParseFloat(want, 64)
+		b, errB := strconv.ParseFloat(price, 64)
+		if errA == nil && errB == nil && a == b {
+			prices[resource] = want
+		}
+	}
+	return prices
+}
@@ -0,0 +1,45 @@
+// Package provider implements the ComputeHive Terraform provider on top of
+// the Go SDK
+package provider
+
+import (
+	"context"
+
+	"github.com/computehive/sdk-go/computehive"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// New returns the provider schema and resources
+func New() *schema.Provider {
+	return &schema.Provider{
+		Schema: map[string]*schema.Schema{
+			"api_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("COMPUTEHIVE_API_URL", computehive.DefaultAPIURL),
+				Description: "ComputeHive API gateway URL",
+			},
+			"api_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("COMPUTEHIVE_API_KEY", nil),
+				Description: "API key; defaults to COMPUTEHIVE_API_KEY",
+			},
+		},
+		ResourcesMap: map[string]*schema.Resource{
+			"computehive_offer":      resourceOffer(),
+			"computehive_alert_rule": resourceAlertRule(),
+		},
+		ConfigureContextFunc: configure,
+	}
+}
+
+func configure(ctx context.Context, d *schema.ResourceData) (interface{}, diag.Diagnostics) {
+	client, err := computehive.NewClient(d.Get("api_key").(string), computehive.WithAPIURL(d.Get("api_url").(string)))
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
+	return client, nil
+}
@@ -0,0 +1,136 @@
+package provider
+
+import (
+	"context"
+	"errors"
+
+	"github.com/computehive/sdk-go/computehive"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// resourceAlertRule manages a telemetry alert rule. Updates are applied in
+// place and keep the rule's firing state and acknowledgements.
+func resourceAlertRule() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A telemetry alert rule that fires when a metric crosses a threshold",
+		CreateContext: resourceAlertRuleCreate,
+		ReadContext:   resourceAlertRuleRead,
+		UpdateContext: resourceAlertRuleUpdate,
+		DeleteContext: resourceAlertRuleDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"name":        {Type: schema.TypeString, Required: true},
+			"metric_name": {Type: schema.TypeString, Required: true},
+			"condition": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringInSlice([]string{">", "<", ">=", "<=", "==", "gt", "lt", "gte", "lte", "eq"}, false),
+			},
+			"threshold": {Type: schema.TypeFloat, Required: true},
+			"severity": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "warning",
+				ValidateFunc: validation.StringInSlice([]string{"critical", "warning", "info"}, false),
+			},
+			"tags": {
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"notify_webhook": {Type: schema.TypeString, Optional: true, ValidateFunc: validation.IsURLWithHTTPorHTTPS},
+			"notify_email": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"assigned_to": {Type: schema.TypeString, Optional: true, Description: "On-call user who owns the alert"},
+			"rotation_id": {Type: schema.TypeString, Optional: true, Description: "On-call rotation used when no user is assigned"},
+			"state":       {Type: schema.TypeString, Computed: true},
+		},
+	}
+}
+
+// alertRuleFromData builds the rule definition from configuration
+func alertRuleFromData(d *schema.ResourceData) *computehive.AlertRule {
+	rule := &computehive.AlertRule{
+		Name:          d.Get("name").(string),
+		MetricName:    d.Get("metric_name").(string),
+		Condition:     d.Get("condition").(string),
+		Threshold:     d.Get("threshold").(float64),
+		Severity:      d.Get("severity").(string),
+		NotifyWebhook: d.Get("notify_webhook").(string),
+		AssignedTo:    d.Get("assigned_to").(string),
+		RotationID:    d.Get("rotation_id").(string),
+	}
+	if tags := d.Get("tags").(map[string]interface{}); len(tags) > 0 {
+		rule.Tags = make(map[string]string, len(tags))
+		for k, v := range tags {
+			rule.Tags[k] = v.(string)
+		}
+	}
+	for _, email := range d.Get("notify_email").([]interface{}) {
+		rule.NotifyEmail = append(rule.NotifyEmail, email.(string))
+	}
+	return rule
+}
+
+func resourceAlertRuleCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*computehive.Client)
+
+	created, err := client.CreateAlertRule(ctx, alertRuleFromData(d))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(created.ID)
+	return resourceAlertRuleRead(ctx, d, meta)
+}
+
+func resourceAlertRuleRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*computehive.Client)
+
+	rule, err := client.GetAlertRule(ctx, d.Id())
+	if errors.Is(err, computehive.ErrNotFound) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.Set("name", rule.Name)
+	d.Set("metric_name", rule.MetricName)
+	d.Set("condition", rule.Condition)
+	d.Set("threshold", rule.Threshold)
+	d.Set("severity", rule.Severity)
+	d.Set("tags", rule.Tags)
+	d.Set("notify_webhook", rule.NotifyWebhook)
+	d.Set("notify_email", rule.NotifyEmail)
+	d.Set("assigned_to", rule.AssignedTo)
+	d.Set("rotation_id", rule.RotationID)
+	d.Set("state", rule.State)
+	return nil
+}
+
+func resourceAlertRuleUpdate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*computehive.Client)
+
+	if _, err := client.UpdateAlertRule(ctx, d.Id(), alertRuleFromData(d)); err != nil {
+		return diag.FromErr(err)
+	}
+	return resourceAlertRuleRead(ctx, d, meta)
+}
+
+func resourceAlertRuleDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*computehive.Client)
+
+	if err := client.DeleteAlertRule(ctx, d.Id()); err != nil && !errors.Is(err, computehive.ErrNotFound) {
+		return diag.FromErr(err)
+	}
+	d.SetId("")
+	return nil
+}
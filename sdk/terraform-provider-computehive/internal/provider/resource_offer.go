@@ -0,0 +1,189 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/computehive/sdk-go/computehive"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// resourceOffer manages a marketplace offer. Offers cannot be amended outside
+// the institutional order API, so every change replaces the offer. An offer
+// that expired or was cancelled out of band drops out of state and is listed
+// again on the next apply.
+func resourceOffer() *schema.Resource {
+	return &schema.Resource{
+		Description:   "A compute offer listed on the ComputeHive marketplace",
+		CreateContext: resourceOfferCreate,
+		ReadContext:   resourceOfferRead,
+		DeleteContext: resourceOfferDelete,
+		Importer: &schema.ResourceImporter{
+			StateContext: schema.ImportStatePassthroughContext,
+		},
+		Schema: map[string]*schema.Schema{
+			"agent_id":   {Type: schema.TypeString, Required: true, ForceNew: true},
+			"cpu_cores":  {Type: schema.TypeInt, Required: true, ForceNew: true, ValidateFunc: validation.IntAtLeast(1)},
+			"cpu_model":  {Type: schema.TypeString, Optional: true, ForceNew: true},
+			"memory_mb":  {Type: schema.TypeInt, Required: true, ForceNew: true, ValidateFunc: validation.IntAtLeast(1)},
+			"storage_mb": {Type: schema.TypeInt, Optional: true, ForceNew: true},
+			"storage_type": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringInSlice([]string{"ssd", "hdd", "nvme"}, false),
+			},
+			"bandwidth_mbps": {Type: schema.TypeInt, Optional: true, ForceNew: true},
+			"gpu": {
+				Type:     schema.TypeList,
+				Optional: true,
+				ForceNew: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"model":     {Type: schema.TypeString, Required: true, ForceNew: true},
+						"memory_mb": {Type: schema.TypeInt, Required: true, ForceNew: true},
+						"count":     {Type: schema.TypeInt, Optional: true, ForceNew: true, Default: 1},
+					},
+				},
+			},
+			"price_per_hour": {
+				Type:        schema.TypeMap,
+				Required:    true,
+				ForceNew:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Decimal hourly price per resource, e.g. { cpu = \"0.05\" }",
+			},
+			"min_duration": {Type: schema.TypeString, Optional: true, ForceNew: true, Default: "1h", ValidateFunc: validateDuration},
+			"max_duration": {Type: schema.TypeString, Optional: true, ForceNew: true, Default: "24h", ValidateFunc: validateDuration},
+			"location":     {Type: schema.TypeString, Optional: true, ForceNew: true},
+			"features": {
+				Type:     schema.TypeList,
+				Optional: true,
+				ForceNew: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"expires_at": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.IsRFC3339Time,
+				Description:  "RFC 3339 expiry; the marketplace defaults to 24 hours",
+			},
+			"client_order_id": {Type: schema.TypeString, Optional: true, ForceNew: true},
+			"provider_id":     {Type: schema.TypeString, Computed: true},
+			"status":          {Type: schema.TypeString, Computed: true},
+		},
+	}
+}
+
+func resourceOfferCreate(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*computehive.Client)
+
+	offer := &computehive.Offer{
+		AgentID:       d.Get("agent_id").(string),
+		Location:      d.Get("location").(string),
+		ClientOrderID: d.Get("client_order_id").(string),
+		PricePerHour:  make(map[string]string),
+	}
+	offer.Resources.CPU.Cores = d.Get("cpu_cores").(int)
+	offer.Resources.CPU.Model = d.Get("cpu_model").(string)
+	offer.Resources.Memory.TotalMB = d.Get("memory_mb").(int)
+	offer.Resources.Storage.TotalMB = d.Get("storage_mb").(int)
+	offer.Resources.Storage.Type = d.Get("storage_type").(string)
+	offer.Resources.Network.BandwidthMbps = d.Get("bandwidth_mbps").(int)
+
+	for _, raw := range d.Get("gpu").([]interface{}) {
+		gpu := raw.(map[string]interface{})
+		offer.Resources.GPU = append(offer.Resources.GPU, computehive.GPUSpec{
+			Model:    gpu["model"].(string),
+			MemoryMB: gpu["memory_mb"].(int),
+			Count:    gpu["count"].(int),
+		})
+	}
+	for resource, price := range d.Get("price_per_hour").(map[string]interface{}) {
+		offer.PricePerHour[resource] = price.(string)
+	}
+	for _, feature := range d.Get("features").([]interface{}) {
+		offer.Features = append(offer.Features, feature.(string))
+	}
+
+	// Validated by the schema
+	offer.MinDuration, _ = time.ParseDuration(d.Get("min_duration").(string))
+	offer.MaxDuration, _ = time.ParseDuration(d.Get("max_duration").(string))
+	if v, ok := d.GetOk("expires_at"); ok {
+		offer.ExpiresAt, _ = time.Parse(time.RFC3339, v.(string))
+	}
+
+	created, err := client.CreateOffer(ctx, offer)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.SetId(created.ID)
+	return resourceOfferRead(ctx, d, meta)
+}
+
+func resourceOfferRead(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*computehive.Client)
+
+	offer, err := client.GetOffer(ctx, d.Id())
+	if errors.Is(err, computehive.ErrNotFound) {
+		d.SetId("")
+		return nil
+	}
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	if offer.Status == "expired" || offer.Status == "cancelled" {
+		d.SetId("")
+		return nil
+	}
+
+	gpus := make([]interface{}, 0, len(offer.Resources.GPU))
+	for _, gpu := range offer.Resources.GPU {
+		gpus = append(gpus, map[string]interface{}{
+			"model":     gpu.Model,
+			"memory_mb": gpu.MemoryMB,
+			"count":     gpu.Count,
+		})
+	}
+
+	d.Set("agent_id", offer.AgentID)
+	d.Set("cpu_cores", offer.Resources.CPU.Cores)
+	d.Set("cpu_model", offer.Resources.CPU.Model)
+	d.Set("memory_mb", offer.Resources.Memory.TotalMB)
+	d.Set("storage_mb", offer.Resources.Storage.TotalMB)
+	d.Set("storage_type", offer.Resources.Storage.Type)
+	d.Set("bandwidth_mbps", offer.Resources.Network.BandwidthMbps)
+	d.Set("gpu", gpus)
+	d.Set("price_per_hour", formatPrices(d.Get("price_per_hour").(map[string]interface{}), offer.PricePerHour))
+	d.Set("min_duration", formatDuration(d.Get("min_duration").(string), offer.MinDuration))
+	d.Set("max_duration", formatDuration(d.Get("max_duration").(string), offer.MaxDuration))
+	d.Set("location", offer.Location)
+	d.Set("features", offer.Features)
+	d.Set("expires_at", offer.ExpiresAt.UTC().Format(time.RFC3339))
+	d.Set("client_order_id", offer.ClientOrderID)
+	d.Set("provider_id", offer.ProviderID)
+	d.Set("status", offer.Status)
+	return nil
+}
+
+func resourceOfferDelete(ctx context.Context, d *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*computehive.Client)
+
+	err := client.CancelOffer(ctx, d.Id())
+	var apiErr *computehive.APIError
+	switch {
+	case err == nil, errors.Is(err, computehive.ErrNotFound):
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict:
+		// Already expired, reserved or cancelled; nothing left to withdraw
+	default:
+		return diag.FromErr(err)
+	}
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/computehive/terraform-provider-computehive/internal/provider"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
+)
+
+func main() {
+	var debug bool
+	flag.BoolVar(&debug, "debug", false, "run the provider with support for debuggers like delve")
+	flag.Parse()
+
+	plugin.Serve(&plugin.ServeOpts{
+		ProviderFunc: provider.New,
+		ProviderAddr: "registry.terraform.io/computehive/computehive",
+		Debug:        debug,
+	})
+}
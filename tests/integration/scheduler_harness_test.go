@@ -0,0 +1,241 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/computehive/core-services/pkg/agentsim"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// SchedulerHarnessTestSuite runs a real scheduler against fleets of simulated
+// agents. It needs a dedicated scheduler: simulated agents stay registered
+// with it until their heartbeats expire. Simulated agents do not enroll, so
+// the scheduler runs with AGENT_ENROLLMENT_REQUIRED=false.
+//
+//	TEST_NATS_URL=nats://localhost:4222 TEST_SCHEDULER_URL=http://localhost:8002 \
+//	    go test -tags=integration -run TestSchedulerHarness ./tests/integration/...
+type SchedulerHarnessTestSuite struct {
+	suite.Suite
+	nc           *nats.Conn
+	schedulerURL string
+	authToken    string
+	httpClient   *http.Client
+	runID        string
+}
+
+// SetupSuite connects to NATS, skipping the suite when no NATS is configured
+func (s *SchedulerHarnessTestSuite) SetupSuite() {
+	natsURL := getEnvOrDefault("TEST_NATS_URL", "")
+	if natsURL == "" {
+		s.T().Skip("TEST_NATS_URL not set")
+	}
+
+	nc, err := nats.Connect(natsURL)
+	require.NoError(s.T(), err)
+	s.nc = nc
+
+	s.schedulerURL = getEnvOrDefault("TEST_SCHEDULER_URL", "http://localhost:8002")
+	s.authToken = getEnvOrDefault("TEST_AUTH_TOKEN", "test-token")
+	s.httpClient = &http.Client{Timeout: 30 * time.Second}
+	s.runID = strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// TearDownSuite closes the NATS connection
+func (s *SchedulerHarnessTestSuite) TearDownSuite() {
+	if s.nc != nil {
+		s.nc.Close()
+	}
+}
+
+// Test GPU jobs only land on agents with matching GPUs
+func (s *SchedulerHarnessTestSuite) TestPlacementHonorsGPURequirements() {
+	fleet := s.startFleet(func(f *agentsim.Fleet) {
+		f.Add(s.prefix("cpu"), 200, agentsim.Spec{CPUCores: 16, MemoryMB: 32768})
+		f.Add(s.prefix("t4"), 4, agentsim.Spec{CPUCores: 16, MemoryMB: 65536, GPUs: []agentsim.GPU{{Model: "T4"}}})
+		f.Add(s.prefix("a100"), 4, agentsim.Spec{CPUCores: 32, MemoryMB: 131072, GPUs: []agentsim.GPU{{Model: "A100"}, {Model: "A100"}}})
+	})
+
+	var jobIDs []string
+	for i := 0; i < 8; i++ {
+		jobIDs = append(jobIDs, s.submitJob(2, 4096, 1, "A100"))
+	}
+	s.waitForJobs(fleet, 2*time.Minute, jobIDs...)
+
+	for _, jobID := range jobIDs {
+		assert.True(s.T(), strings.HasPrefix(fleet.PlacedOn(jobID), s.prefix("a100")),
+			"job %s placed on %s", jobID, fleet.PlacedOn(jobID))
+	}
+}
+
+// Test jobs refused by agents are retried on agents that accept them
+func (s *SchedulerHarnessTestSuite) TestRetriesAfterRejection() {
+	fleet := s.startFleet(func(f *agentsim.Fleet) {
+		f.Add(s.prefix("refusing"), 30, agentsim.Spec{CPUCores: 8, MemoryMB: 16384, Failure: agentsim.Failure{RejectRate: 1}})
+		f.Add(s.prefix("accepting"), 1, agentsim.Spec{CPUCores: 8, MemoryMB: 16384})
+	})
+
+	var jobIDs []string
+	for i := 0; i < 4; i++ {
+		jobIDs = append(jobIDs, s.submitJob(1, 1024, 0, ""))
+	}
+	s.waitForJobs(fleet, 2*time.Minute, jobIDs...)
+
+	for _, jobID := range jobIDs {
+		assert.Equal(s.T(), s.prefix("accepting")+"-0", fleet.PlacedOn(jobID))
+		s.waitForStatus(jobID, "completed")
+	}
+	assert.Greater(s.T(), fleet.Stats().Rejected, 0)
+}
+
+// Test jobs are placed past agents that never answer assignments
+func (s *SchedulerHarnessTestSuite) TestSkipsUnresponsiveAgents() {
+	fleet := s.startFleet(func(f *agentsim.Fleet) {
+		f.Add(s.prefix("silent"), 2, agentsim.Spec{CPUCores: 64, MemoryMB: 262144, Failure: agentsim.Failure{Unresponsive: true}})
+		f.Add(s.prefix("healthy"), 2, agentsim.Spec{CPUCores: 8, MemoryMB: 16384})
+	})
+
+	jobID := s.submitJob(2, 2048, 0, "")
+	s.waitForJobs(fleet, 2*time.Minute, jobID)
+	assert.True(s.T(), strings.HasPrefix(fleet.PlacedOn(jobID), s.prefix("healthy")))
+}
+
+// Test failures reported by agents reach the job
+func (s *SchedulerHarnessTestSuite) TestFailedJobsAreReported() {
+	fleet := s.startFleet(func(f *agentsim.Fleet) {
+		f.Add(s.prefix("failing"), 5, agentsim.Spec{CPUCores: 8, MemoryMB: 16384, Failure: agentsim.Failure{FailRate: 1}})
+	})
+
+	jobID := s.submitJob(1, 1024, 0, "")
+	results := s.waitForJobs(fleet, 2*time.Minute, jobID)
+	assert.Equal(s.T(), "failed", results[jobID])
+	s.waitForStatus(jobID, "failed")
+}
+
+// Test the scheduler places and completes a burst of jobs across a large fleet
+func (s *SchedulerHarnessTestSuite) TestThroughput() {
+	jobs, _ := strconv.Atoi(getEnvOrDefault("TEST_HARNESS_JOBS", "500"))
+	fleet := s.startFleet(func(f *agentsim.Fleet) {
+		f.Add(s.prefix("fleet"), 300, agentsim.Spec{
+			CPUCores:      8,
+			MemoryMB:      16384,
+			AssignLatency: 10 * time.Millisecond,
+			RunTime:       2 * time.Second,
+			Failure:       agentsim.Failure{RejectRate: 0.05},
+		})
+	})
+
+	start := time.Now()
+	jobIDs := make([]string, 0, jobs)
+	for i := 0; i < jobs; i++ {
+		jobIDs = append(jobIDs, s.submitJob(2, 2048, 0, ""))
+	}
+	s.waitForJobs(fleet, 5*time.Minute, jobIDs...)
+
+	elapsed := time.Since(start)
+	stats := fleet.Stats()
+	s.T().Logf("%d jobs in %s (%.1f jobs/s), %d assignment requests, %d rejected",
+		jobs, elapsed.Round(time.Millisecond), float64(jobs)/elapsed.Seconds(), stats.Assignments, stats.Rejected)
+	assert.Equal(s.T(), jobs, stats.Completed)
+}
+
+// Helper methods
+
+func (s *SchedulerHarnessTestSuite) prefix(name string) string {
+	return fmt.Sprintf("sim-%s-%s", s.runID, name)
+}
+
+// startFleet starts a fleet and gives the scheduler a heartbeat to see it
+func (s *SchedulerHarnessTestSuite) startFleet(add func(f *agentsim.Fleet)) *agentsim.Fleet {
+	fleet, err := agentsim.NewFleet(s.nc, agentsim.Config{Seed: 1, HeartbeatInterval: time.Second})
+	require.NoError(s.T(), err)
+	add(fleet)
+	require.NoError(s.T(), fleet.Start())
+	s.T().Cleanup(fleet.Stop)
+
+	time.Sleep(2 * time.Second)
+	return fleet
+}
+
+func (s *SchedulerHarnessTestSuite) waitForJobs(fleet *agentsim.Fleet, timeout time.Duration, jobIDs ...string) map[string]string {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	results, err := fleet.WaitForJobs(ctx, jobIDs...)
+	require.NoError(s.T(), err)
+	return results
+}
+
+// waitForStatus waits for the scheduler to process a result the fleet reported
+func (s *SchedulerHarnessTestSuite) waitForStatus(jobID, status string) {
+	require.Eventually(s.T(), func() bool {
+		return s.getJob(jobID)["status"] == status
+	}, 30*time.Second, 500*time.Millisecond, "job %s never reached %s", jobID, status)
+}
+
+func (s *SchedulerHarnessTestSuite) submitJob(cpuCores, memoryMB, gpuCount int, gpuType string) string {
+	jobData := map[string]interface{}{
+		"type":     "docker",
+		"priority": 5,
+		"requirements": map[string]interface{}{
+			"cpu_cores": cpuCores,
+			"memory_mb": memoryMB,
+			"gpu_count": gpuCount,
+			"gpu_type":  gpuType,
+		},
+		"payload": map[string]interface{}{
+			"image":   "alpine:latest",
+			"command": []string{"true"},
+		},
+		"timeout":     int64(10 * time.Minute),
+		"max_retries": 3,
+	}
+
+	resp := s.schedulerRequest("POST", "/api/v1/jobs", jobData)
+	defer resp.Body.Close()
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+
+	var job map[string]interface{}
+	require.NoError(s.T(), json.NewDecoder(resp.Body).Decode(&job))
+	return job["id"].(string)
+}
+
+func (s *SchedulerHarnessTestSuite) getJob(jobID string) map[string]interface{} {
+	resp := s.schedulerRequest("GET", "/api/v1/jobs/"+jobID, nil)
+	defer resp.Body.Close()
+	require.Equal(s.T(), http.StatusOK, resp.StatusCode)
+
+	var job map[string]interface{}
+	require.NoError(s.T(), json.NewDecoder(resp.Body).Decode(&job))
+	return job
+}
+
+func (s *SchedulerHarnessTestSuite) schedulerRequest(method, path string, body interface{}) *http.Response {
+	var data []byte
+	if body != nil {
+		data = mustMarshal(body)
+	}
+
+	req, err := http.NewRequest(method, s.schedulerURL+path, bytes.NewReader(data))
+	require.NoError(s.T(), err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.authToken)
+
+	resp, err := s.httpClient.Do(req)
+	require.NoError(s.T(), err)
+	return resp
+}
+
+func TestSchedulerHarness(t *testing.T) {
+	suite.Run(t, new(SchedulerHarnessTestSuite))
+}
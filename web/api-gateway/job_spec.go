@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/computehive/core-services/pkg/jobspec"
+)
+
+// maxJobDocumentBytes is the largest job submission the gateway validates;
+// larger bodies are left to the scheduler
+const maxJobDocumentBytes = 1 << 20
+
+// validateJobDocument rejects invalid job documents submitted to the
+// scheduler before they are proxied, with the field errors the scheduler
+// would return. It reports whether the request may be forwarded; other
+// bodies pass through untouched.
+func validateJobDocument(w http.ResponseWriter, r *http.Request) bool {
+	if r.ContentLength <= 0 || r.ContentLength > maxJobDocumentBytes {
+		return true
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	yaml := mediaType == "application/yaml" || mediaType == "application/x-yaml" ||
+		mediaType == "text/yaml" || mediaType == "text/x-yaml"
+	if !yaml && !jobspec.IsDocument(body) {
+		return true
+	}
+
+	if _, err := jobspec.Parse(body); err != nil {
+		w.Header().Set("X-Error-Code", "invalid_argument")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// isJobSubmission reports whether a request to a backend submits a job
+func isJobSubmission(serviceName string, r *http.Request) bool {
+	return serviceName == "scheduler" && r.Method == http.MethodPost && r.URL.Path == "/jobs"
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// jobViewTimeout bounds each backend call made to compose a job view
+const jobViewTimeout = 3 * time.Second
+
+// maxTimelinePoints is the number of points kept per resource timeline series
+const maxTimelinePoints = 120
+
+// JobView is the composed job page: the job plus everything the dashboard shows beside it
+type JobView struct {
+	Job         json.RawMessage            `json:"job"`
+	Status      string                     `json:"status"`
+	CostToDate  float64                    `json:"cost_to_date"`
+	Allocations json.RawMessage            `json:"allocations,omitempty"`
+	Payments    json.RawMessage            `json:"payments,omitempty"`
+	Logs        json.RawMessage            `json:"logs,omitempty"`
+	Timeline    map[string][]TimelinePoint `json:"timeline"`
+	Errors      map[string]string          `json:"errors,omitempty"` // Parts that could not be loaded
+	GeneratedAt time.Time                  `json:"generated_at"`
+}
+
+// TimelinePoint is one resource usage sample on the job's agent
+type TimelinePoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// jobSummary holds the job fields needed to compose the rest of the view
+type jobSummary struct {
+	Status          string     `json:"status"`
+	AssignedAgentID string     `json:"assigned_agent_id"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ScheduledAt     *time.Time `json:"scheduled_at"`
+	StartedAt       *time.Time `json:"started_at"`
+	CompletedAt     *time.Time `json:"completed_at"`
+	EstimatedCost   float64    `json:"estimated_cost"`
+	ActualCost      float64    `json:"actual_cost"`
+	CostToDate      float64    `json:"cost_to_date"` // Metered by the scheduler while running
+	Timeout         int64      `json:"timeout"`      // nanoseconds
+}
+
+// timelineMetrics returns the telemetry metrics charted on the job page
+func timelineMetrics() []string {
+	if v := os.Getenv("JOB_VIEW_TIMELINE_METRICS"); v != "" {
+		return strings.Split(v, ",")
+	}
+	return []string{"cpu_usage", "memory_usage"}
+}
+
+// getJobView composes a job page from the scheduler, resource, payment and telemetry
+// services in one round trip. Missing parts are reported in errors rather than failing.
+func (g *APIGateway) getJobView(w http.ResponseWriter, r *http.Request) {
+	jobID := mux.Vars(r)["id"]
+	auth := r.Header.Get("Authorization")
+
+	// The job itself is required; everything else is best effort
+	ctx, cancel := context.WithTimeout(r.Context(), jobViewTimeout)
+	jobBody, status, err := g.fetchService(ctx, "scheduler", "/api/v1/jobs/"+url.PathEscape(jobID), auth)
+	cancel()
+	if err != nil {
+		http.Error(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if status != http.StatusOK {
+		http.Error(w, strings.TrimSpace(string(jobBody)), status)
+		return
+	}
+
+	var job jobSummary
+	if err := json.Unmarshal(jobBody, &job); err != nil {
+		http.Error(w, "Invalid job response", http.StatusBadGateway)
+		return
+	}
+
+	view := &JobView{
+		Job:         jobBody,
+		Status:      job.Status,
+		Timeline:    make(map[string][]TimelinePoint),
+		Errors:      make(map[string]string),
+		GeneratedAt: time.Now(),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	fetch := func(part, service, path string, store func([]byte)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(r.Context(), jobViewTimeout)
+			defer cancel()
+
+			body, status, err := g.fetchService(ctx, service, path, auth)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				view.Errors[part] = err.Error()
+			case status != http.StatusOK:
+				view.Errors[part] = fmt.Sprintf("%s returned %d", service, status)
+			default:
+				store(body)
+			}
+		}()
+	}
+
+	query := url.Values{"job_id": {jobID}}.Encode()
+	fetch("allocations", "resource", "/api/v1/allocations?"+query, func(body []byte) { view.Allocations = body })
+	fetch("payments", "payment", "/api/v1/payments?"+query, func(body []byte) { view.Payments = body })
+	fetch("logs", "scheduler", "/api/v1/jobs/"+url.PathEscape(jobID)+"/logs?tail=100", func(body []byte) { view.Logs = body })
+
+	// Resource timeline of the job's agent over the job's run window
+	if job.AssignedAgentID != "" {
+		start, end := jobWindow(&job)
+		for _, metric := range timelineMetrics() {
+			metric := strings.TrimSpace(metric)
+			params := url.Values{
+				"metric":   {metric},
+				"agent_id": {job.AssignedAgentID},
+				"start":    {start.Format(time.RFC3339)},
+				"end":      {end.Format(time.RFC3339)},
+			}
+			fetch("timeline."+metric, "telemetry", "/api/v1/metrics/query?"+params.Encode(), func(body []byte) {
+				var points []TimelinePoint
+				if err := json.Unmarshal(body, &points); err == nil {
+					view.Timeline[metric] = downsample(points, maxTimelinePoints)
+				}
+			})
+		}
+	}
+
+	wg.Wait()
+
+	view.CostToDate = costToDate(&job, view.Payments, time.Now())
+	if len(view.Errors) == 0 {
+		view.Errors = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// fetchService calls a backend service directly, forwarding the caller's credentials
+func (g *APIGateway) fetchService(ctx context.Context, name, path, auth string) ([]byte, int, error) {
+	service, exists := g.services[name]
+	if !exists {
+		return nil, 0, fmt.Errorf("service %s is not configured", name)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", service.URL.String()+path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("X-Request-ID", generateRequestID())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s unavailable: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, resp.StatusCode, nil
+}
+
+// jobWindow returns the time range the job has been running over
+func jobWindow(job *jobSummary) (time.Time, time.Time) {
+	start := job.CreatedAt
+	if job.StartedAt != nil {
+		start = *job.StartedAt
+	} else if job.ScheduledAt != nil {
+		start = *job.ScheduledAt
+	}
+	end := time.Now()
+	if job.CompletedAt != nil {
+		end = *job.CompletedAt
+	}
+	return start, end
+}
+
+// costToDate settles on billed payments when there are any, then on what the
+// scheduler metered while the job ran, otherwise prorates the estimate by how
+// much of the job's timeout has elapsed
+func costToDate(job *jobSummary, payments json.RawMessage, now time.Time) float64 {
+	if job.ActualCost > 0 {
+		return job.ActualCost
+	}
+
+	var billed []struct {
+		Type   string `json:"type"`
+		Amount string `json:"amount"`
+		Status string `json:"status"`
+	}
+	if len(payments) > 0 && json.Unmarshal(payments, &billed) == nil {
+		var total float64
+		for _, p := range billed {
+			if p.Type != "job_payment" || p.Status == "failed" {
+				continue
+			}
+			if amount, err := strconv.ParseFloat(p.Amount, 64); err == nil {
+				total += amount
+			}
+		}
+		if total > 0 {
+			return total
+		}
+	}
+
+	if job.CostToDate > 0 {
+		return job.CostToDate
+	}
+	if job.StartedAt == nil && job.ScheduledAt == nil {
+		return 0
+	}
+	start, end := jobWindow(job)
+	if end.After(now) {
+		end = now
+	}
+	if job.Timeout <= 0 {
+		return job.EstimatedCost
+	}
+	fraction := float64(end.Sub(start)) / float64(job.Timeout)
+	if fraction > 1 {
+		fraction = 1
+	}
+	return job.EstimatedCost * fraction
+}
+
+// downsample keeps at most max evenly spaced points
+func downsample(points []TimelinePoint, max int) []TimelinePoint {
+	if len(points) <= max {
+		return points
+	}
+	step := float64(len(points)) / float64(max)
+	sampled := make([]TimelinePoint, 0, max)
+	for i := 0; i < max; i++ {
+		sampled = append(sampled, points[int(float64(i)*step)])
+	}
+	return sampled
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -127,12 +128,14 @@ func (g *APIGateway) initializeServices() {
 		defaultURL  string
 		healthCheck string
 	}{
-		{"auth", "AUTH_SERVICE_URL", "http://localhost:8001", "/health"},
-		{"scheduler", "SCHEDULER_SERVICE_URL", "http://localhost:8002", "/health"},
-		{"marketplace", "MARKETPLACE_SERVICE_URL", "http://localhost:8003", "/health"},
-		{"payment", "PAYMENT_SERVICE_URL", "http://localhost:8004", "/health"},
-		{"telemetry", "TELEMETRY_SERVICE_URL", "http://localhost:8005", "/health"},
-		{"resource", "RESOURCE_SERVICE_URL", "http://localhost:8006", "/health"},
+		{"auth", "AUTH_SERVICE_URL", "http://localhost:8001", "/readyz"},
+		{"scheduler", "SCHEDULER_SERVICE_URL", "http://localhost:8002", "/readyz"},
+		{"marketplace", "MARKETPLACE_SERVICE_URL", "http://localhost:8003", "/readyz"},
+		{"payment", "PAYMENT_SERVICE_URL", "http://localhost:8004", "/readyz"},
+		{"telemetry", "TELEMETRY_SERVICE_URL", "http://localhost:8005", "/readyz"},
+		{"resource", "RESOURCE_SERVICE_URL", "http://localhost:8006", "/readyz"},
+		{"tunnel", "TUNNEL_SERVICE_URL", "http://localhost:8007", "/readyz"},
+		{"flags", "FLAGS_SERVICE_URL", "http://localhost:8008", "/readyz"},
 	}
 	
 	for _, config := range serviceConfigs {
@@ -240,6 +243,8 @@ func (g *APIGateway) authMiddleware(next http.Handler) http.Handler {
 		if strings.HasPrefix(path, "/api/v1/auth/login") ||
 			strings.HasPrefix(path, "/api/v1/auth/register") ||
 			strings.HasPrefix(path, "/api/v1/auth/refresh") ||
+			strings.HasPrefix(path, "/api/v1/scheduler/agents/register") || // Join token authenticates
+			isEnrollmentCredentialsPath(path) || // Enrollment secret authenticates
 			strings.HasPrefix(path, "/health") ||
 			strings.HasPrefix(path, "/metrics") {
 			next.ServeHTTP(w, r)
@@ -309,6 +314,11 @@ func (g *APIGateway) routeRequest(w http.ResponseWriter, r *http.Request) {
 		r.URL.Path = "/"
 	}
 	
+	// Reject invalid job documents at the edge
+	if isJobSubmission(serviceName, r) && !validateJobDocument(w, r) {
+		return
+	}
+	
 	// Forward request to service
 	service.Proxy.ServeHTTP(w, r)
 }
@@ -337,6 +347,67 @@ func (g *APIGateway) healthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(health)
 }
 
+// livenessCheck reports that the gateway process is serving requests
+func (g *APIGateway) livenessCheck(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"service": "api-gateway",
+		"status":  "up",
+		"time":    time.Now().UTC(),
+	})
+}
+
+// readinessCheck probes every backend's /readyz concurrently. The gateway is
+// degraded while some backends are down and only reports 503 when none of
+// them can serve traffic.
+func (g *APIGateway) readinessCheck(w http.ResponseWriter, r *http.Request) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]string, len(g.services))
+	
+	for name, service := range g.services {
+		wg.Add(1)
+		go func(name string, service *Service) {
+			defer wg.Done()
+			status := "up"
+			if !g.checkServiceHealth(service) {
+				status = "down"
+			}
+			mu.Lock()
+			results[name] = status
+			mu.Unlock()
+		}(name, service)
+	}
+	wg.Wait()
+	
+	down := 0
+	for _, status := range results {
+		if status == "down" {
+			down++
+		}
+	}
+	
+	status := "up"
+	code := http.StatusOK
+	switch {
+	case len(results) > 0 && down == len(results):
+		status = "down"
+		code = http.StatusServiceUnavailable
+	case down > 0:
+		status = "degraded"
+	}
+	
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"service":  "api-gateway",
+		"status":   status,
+		"time":     time.Now().UTC(),
+		"services": results,
+	})
+}
+
 // checkServiceHealth checks if a service is healthy
 func (g *APIGateway) checkServiceHealth(service *Service) bool {
 	client := &http.Client{Timeout: 2 * time.Second}
@@ -380,16 +451,12 @@ func (g *APIGateway) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// WebSocket proxy requires special handling
-	target := service.URL
-	targetURL := "ws://" + target.Host + strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/api/v1/%s", serviceName))
-	
-	// Create WebSocket proxy
-	proxyURL, _ := url.Parse(targetURL)
-	proxy := httputil.NewSingleHostReverseProxy(proxyURL)
+	// The reverse proxy handles the protocol upgrade and then
+	// copies frames in both directions
+	r.URL.Path = strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/api/v1/%s", serviceName))
 	
 	// Forward the request
-	proxy.ServeHTTP(w, r)
+	service.Proxy.ServeHTTP(w, r)
 }
 
 // Helper functions
@@ -453,6 +520,12 @@ func extractServiceName(path string) string {
 	return ""
 }
 
+// isEnrollmentCredentialsPath matches the endpoint enrolling agents poll for
+// their credentials
+func isEnrollmentCredentialsPath(path string) bool {
+	return strings.HasPrefix(path, "/api/v1/scheduler/agents/enrollments/") && strings.HasSuffix(path, "/credentials")
+}
+
 // getClientIP extracts client IP from request
 func getClientIP(r *http.Request) string {
 	// Check X-Forwarded-For header
@@ -468,10 +541,10 @@ func getClientIP(r *http.Request) string {
 		return realIP
 	}
 	
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	if colon := strings.LastIndex(ip, ":"); colon != -1 {
-		ip = ip[:colon]
+	// Fall back to RemoteAddr, which brackets IPv6 hosts
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
 	
 	return ip
@@ -495,6 +568,18 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush lets the reverse proxy push server-sent events through immediately
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Admin endpoints
 
 // reloadConfig reloads gateway configuration
@@ -543,6 +628,8 @@ func main() {
 	
 	// Health and metrics endpoints (no auth required)
 	router.HandleFunc("/health", gateway.healthCheck).Methods("GET")
+	router.HandleFunc("/healthz", gateway.livenessCheck).Methods("GET")
+	router.HandleFunc("/readyz", gateway.readinessCheck).Methods("GET")
 	router.Handle("/metrics", promhttp.Handler())
 	
 	// Admin endpoints
@@ -558,6 +645,11 @@ func main() {
 	// WebSocket routes (special handling)
 	apiRouter.HandleFunc("/marketplace/ws", gateway.handleWebSocket)
 	apiRouter.HandleFunc("/telemetry/ws", gateway.handleWebSocket)
+	apiRouter.HandleFunc("/scheduler/jobs/{id}/exec", gateway.handleWebSocket)
+	apiRouter.HandleFunc("/tunnel/tunnels/{job}/ports/{port}/connect", gateway.handleWebSocket)
+	
+	// Composite views
+	apiRouter.HandleFunc("/views/jobs/{id}", gateway.getJobView).Methods("GET")
 	
 	// Service routes
 	apiRouter.PathPrefix("/").HandlerFunc(gateway.routeRequest)
@@ -566,8 +658,8 @@ func main() {
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "https://computehive.io"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Request-ID"},
-		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type", "X-Request-ID", "Last-Event-ID", "If-Match"},
+		ExposedHeaders:   []string{"X-Request-ID", "X-Error-Code", "ETag"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
@@ -1,4 +1,5 @@
 import React, { useState, useEffect } from 'react';
+import axios from 'axios';
 import {
   Box,
   Card,
@@ -136,6 +137,32 @@ interface PerformanceAnalytics {
   metrics: { timestamp: string; cpu: number; memory: number; gpu: number; network: number }[];
 }
 
+interface RightsizingRecommendation {
+  job_type: string;
+  requested_cpu_cores: number;
+  requested_memory_mb: number;
+  gpu_count?: number;
+  jobs: number;
+  cpu_cores_p95: number;
+  cpu_cores_avg: number;
+  memory_peak_mb: number;
+  recommended_cpu_cores: number;
+  recommended_memory_mb: number;
+  savings_percent: number;
+  estimated_savings: number;
+  message: string;
+}
+
+interface RightsizingReport {
+  window_start: string;
+  window_end: string;
+  jobs_analyzed: number;
+  cpu_utilization: number;
+  memory_utilization: number;
+  potential_savings: number;
+  recommendations: RightsizingRecommendation[];
+}
+
 interface TrendData {
   date: string;
   jobs: number;
@@ -151,6 +178,17 @@ const Analytics: React.FC = () => {
   const [timeRange, setTimeRange] = useState('30d');
   const [tabValue, setTabValue] = useState(0);
   const [refreshKey, setRefreshKey] = useState(0);
+  const [rightsizing, setRightsizing] = useState<RightsizingReport | null>(null);
+  const [rightsizingError, setRightsizingError] = useState<string | null>(null);
+
+  // Right-sizing recommendations mined from completed jobs' actual usage
+  useEffect(() => {
+    const days = timeRange === '7d' ? 7 : timeRange === '30d' ? 30 : 90;
+    setRightsizingError(null);
+    axios.get<RightsizingReport>('/api/v1/analytics/rightsizing', { params: { days } })
+      .then((response) => setRightsizing(response.data))
+      .catch(() => setRightsizingError('Failed to load right-sizing recommendations'));
+  }, [timeRange, refreshKey]);
 
   // Mock data
   useEffect(() => {
@@ -437,6 +475,7 @@ const Analytics: React.FC = () => {
             <Tab label="Costs" icon={<AttachMoney />} />
             <Tab label="Performance" icon={<Speed />} />
             <Tab label="Trends" icon={<TimelineIcon />} />
+            <Tab label="Right-sizing" icon={<Insights />} />
           </Tabs>
           
           <Box sx={{ mt: 3 }}>
@@ -837,6 +876,89 @@ const Analytics: React.FC = () => {
                 </Grid>
               </Grid>
             )}
+
+            {/* Right-sizing Tab */}
+            {tabValue === 6 && (
+              <Grid container spacing={3}>
+                {rightsizingError && (
+                  <Grid item xs={12}>
+                    <Alert severity="error">{rightsizingError}</Alert>
+                  </Grid>
+                )}
+                {rightsizing && (
+                  <>
+                    <Grid item xs={12} md={3}>
+                      <Typography color="textSecondary" gutterBottom>Jobs Analyzed</Typography>
+                      <Typography variant="h5">{rightsizing.jobs_analyzed}</Typography>
+                    </Grid>
+                    <Grid item xs={12} md={3}>
+                      <Typography color="textSecondary" gutterBottom>CPU Utilization (p95)</Typography>
+                      <Typography variant="h5">{(rightsizing.cpu_utilization * 100).toFixed(0)}%</Typography>
+                      <LinearProgress variant="determinate" value={Math.min(rightsizing.cpu_utilization * 100, 100)} />
+                    </Grid>
+                    <Grid item xs={12} md={3}>
+                      <Typography color="textSecondary" gutterBottom>Memory Utilization (peak)</Typography>
+                      <Typography variant="h5">{(rightsizing.memory_utilization * 100).toFixed(0)}%</Typography>
+                      <LinearProgress variant="determinate" value={Math.min(rightsizing.memory_utilization * 100, 100)} />
+                    </Grid>
+                    <Grid item xs={12} md={3}>
+                      <Typography color="textSecondary" gutterBottom>Potential Savings</Typography>
+                      <Typography variant="h5" color="success.main">${rightsizing.potential_savings.toFixed(2)}</Typography>
+                    </Grid>
+
+                    <Grid item xs={12}>
+                      <Typography variant="h6" gutterBottom>Recommendations</Typography>
+                      {rightsizing.recommendations.length === 0 ? (
+                        <Alert severity="success">
+                          Requested resources match observed usage. No changes recommended.
+                        </Alert>
+                      ) : (
+                        <TableContainer component={Paper}>
+                          <Table>
+                            <TableHead>
+                              <TableRow>
+                                <TableCell>Job Type</TableCell>
+                                <TableCell align="right">Jobs</TableCell>
+                                <TableCell align="right">CPU Cores</TableCell>
+                                <TableCell align="right">p95 Used</TableCell>
+                                <TableCell align="right">Memory (MB)</TableCell>
+                                <TableCell align="right">Peak Used</TableCell>
+                                <TableCell align="right">Savings</TableCell>
+                                <TableCell>Recommendation</TableCell>
+                              </TableRow>
+                            </TableHead>
+                            <TableBody>
+                              {rightsizing.recommendations.map((rec, index) => (
+                                <TableRow key={index}>
+                                  <TableCell>{rec.job_type}</TableCell>
+                                  <TableCell align="right">{rec.jobs}</TableCell>
+                                  <TableCell align="right">
+                                    {rec.requested_cpu_cores} → {rec.recommended_cpu_cores}
+                                  </TableCell>
+                                  <TableCell align="right">{rec.cpu_cores_p95.toFixed(1)}</TableCell>
+                                  <TableCell align="right">
+                                    {rec.requested_memory_mb} → {rec.recommended_memory_mb}
+                                  </TableCell>
+                                  <TableCell align="right">{rec.memory_peak_mb}</TableCell>
+                                  <TableCell align="right">
+                                    <Chip
+                                      label={`~${rec.savings_percent.toFixed(0)}% ($${rec.estimated_savings.toFixed(2)})`}
+                                      color="success"
+                                      size="small"
+                                    />
+                                  </TableCell>
+                                  <TableCell>{rec.message}</TableCell>
+                                </TableRow>
+                              ))}
+                            </TableBody>
+                          </Table>
+                        </TableContainer>
+                      )}
+                    </Grid>
+                  </>
+                )}
+              </Grid>
+            )}
           </Box>
         </CardContent>
       </Card>